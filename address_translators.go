@@ -36,6 +36,18 @@ type AddressTranslator interface {
 	Translate(addr net.IP, port int) (net.IP, int)
 }
 
+// SocketAddressTranslator is an AddressTranslator which can also translate node
+// addresses to Unix domain sockets, for example to connect to the nodes through
+// a sidecar proxy colocated with the application.
+type SocketAddressTranslator interface {
+	AddressTranslator
+
+	// TranslateSocket returns the path of the Unix domain socket to connect
+	// to the node at the address and port returned by Translate, or an empty
+	// string to connect to it over TCP.
+	TranslateSocket(addr net.IP, port int) string
+}
+
 type AddressTranslatorFunc func(addr net.IP, port int) (net.IP, int)
 
 func (fn AddressTranslatorFunc) Translate(addr net.IP, port int) (net.IP, int) {
@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AnalyticsConfig configures a session dedicated to analytics and batch jobs
+// reading a cluster shared with OLTP traffic, see ClusterConfig.Analytics.
+type AnalyticsConfig struct {
+	// DC is the datacenter dedicated to analytics, the only one the session
+	// connects to. Required.
+	DC string
+
+	// Consistency is the default consistency of the queries, it must be local
+	// to the datacenter so that the coordinators do not reach the replicas of
+	// the other datacenters.
+	// Default: LocalOne
+	Consistency Consistency
+
+	// PageSize is the default page size of the queries.
+	// Default: 5000
+	PageSize int
+
+	// NumConns is the number of connections per host.
+	// Default: 1
+	NumConns int
+
+	// MaxRequestsPerHost limits the number of requests in flight to each host,
+	// so that the jobs do not overload the datacenter, see
+	// ClusterConfig.MaxRequestsPerHost.
+	// Default: 32
+	MaxRequestsPerHost int
+
+	// MaxRequestsPerHostQueueTimeout is how long requests wait for a host which
+	// reached MaxRequestsPerHost.
+	// Default: 5s
+	MaxRequestsPerHostQueueTimeout time.Duration
+}
+
+// applyAnalytics adjusts the config to the analytics mode configured by
+// cfg.Analytics, if any.
+func (cfg *ClusterConfig) applyAnalytics() error {
+	a := cfg.Analytics
+	if a == nil {
+		return nil
+	}
+	if a.DC == "" {
+		return errors.New("gocql: analytics mode requires a datacenter")
+	}
+
+	cons := a.Consistency
+	if cons == 0 {
+		cons = LocalOne
+	}
+	if cons != LocalOne && cons != LocalQuorum {
+		return fmt.Errorf("gocql: analytics mode requires a local consistency, got %v", cons)
+	}
+	cfg.Consistency = cons
+
+	cfg.PageSize = a.PageSize
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 5000
+	}
+	cfg.NumConns = a.NumConns
+	if cfg.NumConns <= 0 {
+		cfg.NumConns = 1
+	}
+	cfg.MaxRequestsPerHost = a.MaxRequestsPerHost
+	if cfg.MaxRequestsPerHost <= 0 {
+		cfg.MaxRequestsPerHost = 32
+	}
+	cfg.MaxRequestsPerHostQueueTimeout = a.MaxRequestsPerHostQueueTimeout
+	if cfg.MaxRequestsPerHostQueueTimeout <= 0 {
+		cfg.MaxRequestsPerHostQueueTimeout = 5 * time.Second
+	}
+
+	dcFilter := DataCentreHostFilter(a.DC)
+	if filter := cfg.HostFilter; filter != nil {
+		cfg.HostFilter = HostFilterFunc(func(host *HostInfo) bool {
+			return dcFilter.Accept(host) && filter.Accept(host)
+		})
+	} else {
+		cfg.HostFilter = dcFilter
+	}
+	if cfg.PoolConfig.HostSelectionPolicy == nil {
+		cfg.PoolConfig.HostSelectionPolicy = TokenAwareHostPolicy(DCAwareRoundRobinPolicy(a.DC))
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BackpressureConfig configures the throttling of the requests of a session by
+// the overload hints of the servers, see ClusterConfig.Backpressure.
+//
+// The rate of requests is adjusted like a congestion window: it is decreased
+// by DecreaseFactor on overload hints, and increased by IncreaseFactor every
+// RecoveryInterval without hints until the throttling stops.
+type BackpressureConfig struct {
+	// MinRate is the lowest rate of requests per second the session is
+	// throttled to.
+	// Default: 10
+	MinRate float64
+
+	// MaxRate, if greater than 0, is the rate of requests per second the
+	// session is always throttled to without overload hints. Otherwise the
+	// session is not throttled until the first hint, which decreases the rate
+	// the requests were sent at, and the throttling stops once the rate
+	// recovered to it.
+	// Default: 0
+	MaxRate float64
+
+	// DecreaseFactor multiplies the rate on overload hints, which decrease the
+	// rate at most once per RecoveryInterval.
+	// Default: 0.5
+	DecreaseFactor float64
+
+	// IncreaseFactor is the fraction the rate is increased by every
+	// RecoveryInterval without overload hints.
+	// Default: 0.1
+	IncreaseFactor float64
+
+	// RecoveryInterval is the period of the increases of the rate.
+	// Default: 1s
+	RecoveryInterval time.Duration
+
+	// Hint reports whether the response of a request, with the given error and
+	// custom payload, is an overload hint.
+	// Default: OverloadedErrorHint
+	Hint func(err error, payload map[string][]byte) bool
+
+	// OnRateChange, if not nil, is called with the new rate of requests per
+	// second when it changes, 0 when the throttling stops. It is not called
+	// concurrently and must not block.
+	OnRateChange func(rate float64)
+}
+
+// OverloadedErrorHint reports overloaded errors as overload hints. Scylla
+// returns them when it is configured with THROW_ON_OVERLOAD (see
+// ClusterConfig.StartupOptions) instead of queuing the requests it cannot keep
+// up with.
+func OverloadedErrorHint(err error, payload map[string][]byte) bool {
+	var reqErr RequestError
+	return errors.As(err, &reqErr) && reqErr.Code() == ErrCodeOverloaded
+}
+
+// backpressureThrottler paces the requests of a session at a rate adjusted to
+// the overload hints of the responses.
+type backpressureThrottler struct {
+	cfg BackpressureConfig
+	now func() time.Time
+
+	mu sync.Mutex
+	// rate is the rate of requests per second, 0 when not throttled.
+	rate float64
+	// ceiling is the rate the throttling stops at, 0 if it never stops.
+	ceiling float64
+	// next is the time the next request can be sent at.
+	next time.Time
+	// adjusted is the time the rate was last adjusted.
+	adjusted time.Time
+
+	// sent counts the requests sent since windowStart when not throttled, to
+	// measure their rate, which was lastRate in the previous window.
+	sent        int
+	windowStart time.Time
+	lastRate    float64
+}
+
+func newBackpressureThrottler(cfg BackpressureConfig) *backpressureThrottler {
+	if cfg.MinRate <= 0 {
+		cfg.MinRate = 10
+	}
+	if cfg.MaxRate > 0 && cfg.MaxRate < cfg.MinRate {
+		cfg.MaxRate = cfg.MinRate
+	}
+	if cfg.DecreaseFactor <= 0 || cfg.DecreaseFactor >= 1 {
+		cfg.DecreaseFactor = 0.5
+	}
+	if cfg.IncreaseFactor <= 0 {
+		cfg.IncreaseFactor = 0.1
+	}
+	if cfg.RecoveryInterval <= 0 {
+		cfg.RecoveryInterval = time.Second
+	}
+	if cfg.Hint == nil {
+		cfg.Hint = OverloadedErrorHint
+	}
+
+	t := &backpressureThrottler{cfg: cfg, now: time.Now}
+	t.rate = cfg.MaxRate
+	t.ceiling = cfg.MaxRate
+	return t
+}
+
+// wait waits until the next request can be sent.
+func (t *backpressureThrottler) wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	now := t.now()
+	t.recover(now)
+	if t.rate == 0 {
+		if elapsed := now.Sub(t.windowStart); elapsed >= t.cfg.RecoveryInterval {
+			t.lastRate = float64(t.sent) / elapsed.Seconds()
+			t.sent = 0
+			t.windowStart = now
+		}
+		t.sent++
+		t.mu.Unlock()
+		return nil
+	}
+
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(float64(time.Second) / t.rate))
+	t.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recover increases the rate if it was not adjusted for RecoveryInterval.
+func (t *backpressureThrottler) recover(now time.Time) {
+	if t.rate == 0 || now.Sub(t.adjusted) < t.cfg.RecoveryInterval {
+		return
+	}
+
+	rate := t.rate * (1 + t.cfg.IncreaseFactor)
+	if t.ceiling > 0 && rate >= t.ceiling {
+		rate = t.cfg.MaxRate
+		if rate == 0 {
+			// the throttling stops, the rate is measured again
+			t.sent = 0
+			t.windowStart = now
+		}
+	}
+	t.setRate(rate, now)
+}
+
+// observe adjusts the rate to the response of a request.
+func (t *backpressureThrottler) observe(iter *Iter) {
+	if t == nil || !t.cfg.Hint(iter.err, iter.GetCustomPayload()) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	rate := t.rate
+	if rate == 0 {
+		rate = t.lastRate
+		if elapsed := now.Sub(t.windowStart).Seconds(); elapsed > 0 && float64(t.sent)/elapsed > rate {
+			rate = float64(t.sent) / elapsed
+		}
+		if rate < t.cfg.MinRate {
+			rate = t.cfg.MinRate
+		}
+		t.ceiling = rate
+	} else if now.Sub(t.adjusted) < t.cfg.RecoveryInterval {
+		// the previous decrease did not take effect yet
+		return
+	}
+
+	rate *= t.cfg.DecreaseFactor
+	if rate < t.cfg.MinRate {
+		rate = t.cfg.MinRate
+	}
+	t.setRate(rate, now)
+}
+
+func (t *backpressureThrottler) setRate(rate float64, now time.Time) {
+	t.adjusted = now
+	if rate == t.rate {
+		return
+	}
+	t.rate = rate
+	if t.cfg.OnRateChange != nil {
+		t.cfg.OnRateChange(rate)
+	}
+}
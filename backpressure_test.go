@@ -0,0 +1,125 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOverloadedErrorHint(t *testing.T) {
+	overloaded := errorFrame{code: ErrCodeOverloaded, message: "overloaded"}
+	if !OverloadedErrorHint(overloaded, nil) {
+		t.Error("expected overloaded error to be a hint")
+	}
+	if !OverloadedErrorHint(fmt.Errorf("wrapped: %w", overloaded), nil) {
+		t.Error("expected wrapped overloaded error to be a hint")
+	}
+	if OverloadedErrorHint(errorFrame{code: ErrCodeInvalid}, nil) || OverloadedErrorHint(nil, nil) {
+		t.Error("expected other errors not to be hints")
+	}
+}
+
+func TestBackpressureThrottler(t *testing.T) {
+	var rates []float64
+	tr := newBackpressureThrottler(BackpressureConfig{
+		MinRate: 20,
+		OnRateChange: func(rate float64) {
+			rates = append(rates, rate)
+		},
+	})
+	now := time.Unix(0, 0)
+	tr.now = func() time.Time { return now }
+	overloaded := &Iter{err: errorFrame{code: ErrCodeOverloaded}}
+	ctx := context.Background()
+
+	// 100 requests per second are sent unthrottled
+	for i := 0; i < 200; i++ {
+		if err := tr.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * time.Millisecond)
+	}
+	tr.observe(&Iter{})
+	if tr.rate != 0 {
+		t.Fatalf("expected no throttling without hints, got rate %v", tr.rate)
+	}
+
+	tr.observe(overloaded)
+	if math.Abs(tr.rate-50) > 1 {
+		t.Fatalf("expected rate of 50 after the first hint, got %v", tr.rate)
+	}
+	// the hints before the decrease takes effect are ignored
+	tr.observe(overloaded)
+	if math.Abs(tr.rate-50) > 1 {
+		t.Fatalf("expected rate of 50 after a second hint, got %v", tr.rate)
+	}
+	now = now.Add(time.Second)
+	tr.observe(overloaded)
+	tr.observe(overloaded)
+	now = now.Add(time.Second)
+	tr.observe(overloaded)
+	if tr.rate != 20 {
+		t.Fatalf("expected rate bounded by MinRate, got %v", tr.rate)
+	}
+
+	// the rate recovers until the throttling stops
+	for i := 0; i < 20 && tr.rate != 0; i++ {
+		now = now.Add(time.Second)
+		tr.mu.Lock()
+		tr.recover(now)
+		tr.mu.Unlock()
+	}
+	if tr.rate != 0 {
+		t.Fatalf("expected throttling to stop, got rate %v", tr.rate)
+	}
+	if len(rates) < 4 || rates[len(rates)-1] != 0 || rates[2] != 20 || rates[3] != 22 {
+		t.Fatalf("unexpected rate changes %v", rates)
+	}
+}
+
+func TestBackpressureThrottlerWait(t *testing.T) {
+	tr := newBackpressureThrottler(BackpressureConfig{MinRate: 1, MaxRate: 1})
+	now := time.Unix(0, 0)
+	tr.now = func() time.Time { return now }
+
+	if err := tr.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.next.Equal(now.Add(time.Second)) {
+		t.Fatalf("expected next request in 1s, got %v", tr.next.Sub(now))
+	}
+
+	// the second request waits for a second
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tr.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	var nilThrottler *backpressureThrottler
+	if err := nilThrottler.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nilThrottler.observe(&Iter{})
+}
@@ -0,0 +1,308 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BatchSplit configures the splitting of a batch into several batches, see
+// Batch.Split.
+type BatchSplit struct {
+	// MaxStatements is the maximum number of statements of each batch.
+	// Default: 0 (BatchSizeMaximum)
+	MaxStatements int
+
+	// MaxBytes is the maximum size in bytes of the bound values of the
+	// statements of each batch, for example to stay below the
+	// batch_size_fail_threshold of the cluster. Sizing the statements
+	// requires preparing them before the batches are executed.
+	// Default: 0 (no limit)
+	MaxBytes int
+
+	// GroupByPartition keeps the statements of the same partition in the
+	// same batch, unless they exceed the limits on their own, so that they
+	// are still applied together. It requires the routing keys of the
+	// statements, statements without a routing key form their own group.
+	GroupByPartition bool
+}
+
+// SplitBatchResult is the result of one of the batches a batch was split
+// into.
+type SplitBatchResult struct {
+	// Entries are the indexes in Batch.Entries of the statements of the
+	// batch.
+	Entries []int
+	// Bytes is the size of the bound values of the statements, only
+	// computed if BatchSplit.MaxBytes is set.
+	Bytes int
+
+	Attempts int
+	Latency  time.Duration
+	Err      error
+}
+
+// BatchSplitResult is the aggregate result of a batch split by
+// Session.ExecuteBatchSplit.
+type BatchSplitResult struct {
+	// Batches are the results of the batches executed, in order.
+	Batches []SplitBatchResult
+	// Skipped are the indexes in Batch.Entries of the statements which were
+	// not executed because a previous batch failed.
+	Skipped []int
+}
+
+// Statements returns the number of statements applied by the batches which
+// succeeded.
+func (r BatchSplitResult) Statements() int {
+	var n int
+	for _, batch := range r.Batches {
+		if batch.Err == nil {
+			n += len(batch.Entries)
+		}
+	}
+	return n
+}
+
+// ErrBatchSplitCAS is returned when executing a batch with a BatchSplit with
+// Session.ExecuteBatchCAS, Session.MapExecuteBatchCAS or
+// Session.ExecuteBatchCASResult, as a conditional batch can not be split.
+var ErrBatchSplitCAS = errors.New("gocql: conditional batches can not be split")
+
+// Split sets how the batch is split into several batches when it exceeds
+// the limits of split, which are executed in order by Session.ExecuteBatch
+// and Session.ExecuteBatchSplit, each one with the type, consistency,
+// policies and options of b. Each batch is applied atomically, but not the
+// batches together, so a batch can fail after the previous ones were
+// applied. Split with a nil split disables it.
+func (b *Batch) Split(split *BatchSplit) *Batch {
+	b.split = split
+	return b
+}
+
+// ExecuteBatchSplit executes the batch, split into several batches if it has
+// a BatchSplit, in order, and reports the result of each one. It stops at the
+// first batch which fails and returns its error.
+func (s *Session) ExecuteBatchSplit(batch *Batch) (BatchSplitResult, error) {
+	var result BatchSplitResult
+	if batch.Size() == 0 {
+		return result, nil
+	}
+
+	groups, err := s.splitBatch(batch)
+	if err != nil {
+		return result, err
+	}
+
+	for i, group := range groups {
+		part := batch.part(group.entries)
+		err := s.executeBatch(part).Close()
+		result.Batches = append(result.Batches, SplitBatchResult{
+			Entries:  group.entries,
+			Bytes:    group.size,
+			Attempts: part.Attempts(),
+			Latency:  time.Duration(part.Latency()),
+			Err:      err,
+		})
+		if err != nil {
+			for _, group := range groups[i+1:] {
+				result.Skipped = append(result.Skipped, group.entries...)
+			}
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// part returns a copy of b with the given entries.
+func (b *Batch) part(entries []int) *Batch {
+	if len(entries) == len(b.Entries) {
+		return b
+	}
+
+	part := *b
+	part.Entries = make([]BatchEntry, len(entries))
+	for i, entry := range entries {
+		part.Entries[i] = b.Entries[entry]
+	}
+	part.routingKey = nil
+	part.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
+	part.routingInfo = &queryRoutingInfo{}
+	return &part
+}
+
+// batchGroup is a group of statements of a batch which are executed
+// together, with the sizes of their bound values.
+type batchGroup struct {
+	entries []int
+	sizes   []int
+	size    int
+}
+
+func (g *batchGroup) add(entry, size int) {
+	g.entries = append(g.entries, entry)
+	g.sizes = append(g.sizes, size)
+	g.size += size
+}
+
+// splitBatch returns the groups of statements of batch to execute in
+// separate batches.
+func (s *Session) splitBatch(batch *Batch) ([]batchGroup, error) {
+	split := BatchSplit{}
+	if batch.split != nil {
+		split = *batch.split
+	}
+	if split.MaxStatements <= 0 || split.MaxStatements > BatchSizeMaximum {
+		split.MaxStatements = BatchSizeMaximum
+	}
+
+	ctx := batch.Context()
+	groups := make([]batchGroup, 0, len(batch.Entries))
+	partitions := make(map[string]int)
+	for i, entry := range batch.Entries {
+		var (
+			size int
+			key  string
+			err  error
+		)
+		if split.MaxBytes > 0 {
+			if size, err = s.batchEntrySize(ctx, entry); err != nil {
+				return nil, err
+			}
+		}
+		if split.GroupByPartition {
+			if key, err = s.batchEntryPartition(ctx, entry); err != nil {
+				return nil, err
+			}
+		}
+
+		if key != "" {
+			if g, ok := partitions[key]; ok {
+				groups[g].add(i, size)
+				continue
+			}
+			partitions[key] = len(groups)
+		}
+		var group batchGroup
+		group.add(i, size)
+		groups = append(groups, group)
+	}
+
+	return packBatchGroups(groups, split.MaxStatements, split.MaxBytes), nil
+}
+
+// packBatchGroups packs groups, in order, in as few batches as the limits
+// allow, splitting the groups exceeding the limits on their own. A statement
+// exceeding maxBytes on its own is executed alone.
+func packBatchGroups(groups []batchGroup, maxStatements, maxBytes int) []batchGroup {
+	fits := func(batch *batchGroup, entries, size int) bool {
+		if len(batch.entries)+entries > maxStatements {
+			return false
+		}
+		return maxBytes <= 0 || batch.size+size <= maxBytes ||
+			(len(batch.entries) == 0 && entries == 1)
+	}
+
+	var (
+		batches []batchGroup
+		current batchGroup
+	)
+	next := func() {
+		if len(current.entries) > 0 {
+			batches = append(batches, current)
+			current = batchGroup{}
+		}
+	}
+	for _, group := range groups {
+		if fits(&batchGroup{}, len(group.entries), group.size) {
+			if !fits(&current, len(group.entries), group.size) {
+				next()
+			}
+			for i, entry := range group.entries {
+				current.add(entry, group.sizes[i])
+			}
+			continue
+		}
+
+		// the group exceeds the limits on its own, its statements are split
+		// like the statements of different partitions
+		for i, entry := range group.entries {
+			if !fits(&current, 1, group.sizes[i]) {
+				next()
+			}
+			current.add(entry, group.sizes[i])
+		}
+	}
+	next()
+	return batches
+}
+
+// batchEntrySize returns the size in bytes of the bound values of entry,
+// 0 for statements bound with Batch.Bind.
+func (s *Session) batchEntrySize(ctx context.Context, entry BatchEntry) (int, error) {
+	if entry.binding != nil || len(entry.Args) == 0 {
+		return 0, nil
+	}
+
+	conn := s.getConn()
+	if conn == nil {
+		return 0, ErrNoConnections
+	}
+	info, err := conn.prepareStatement(ctx, entry.Stmt, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(entry.Args) != info.request.actualColCount {
+		return 0, fmt.Errorf("gocql: batch statement %q expected %d values send got %d", entry.Stmt, info.request.actualColCount, len(entry.Args))
+	}
+
+	var size int
+	for i, arg := range entry.Args {
+		if arg == UnsetValue {
+			continue
+		}
+		data, err := s.cfg.Codecs.Marshal(info.request.columns[i].TypeInfo, arg)
+		if err != nil {
+			return 0, err
+		}
+		size += len(data)
+	}
+	return size, nil
+}
+
+// batchEntryPartition returns the table and the routing key of entry, empty
+// if it has none.
+func (s *Session) batchEntryPartition(ctx context.Context, entry BatchEntry) (string, error) {
+	if entry.binding != nil {
+		return "", nil
+	}
+
+	info, err := s.routingKeyInfo(ctx, entry.Stmt)
+	if err != nil || info == nil {
+		return "", err
+	}
+	key, err := createRoutingKey(info, entry.Args)
+	if err != nil {
+		return "", err
+	}
+	return info.keyspace + "." + info.table + "/" + string(key), nil
+}
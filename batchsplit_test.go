@@ -0,0 +1,112 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/*
+ * Content before git sha 34fdeebefcbf183ed7f916f931aa0586fdaa1b40
+ * Copyright (c) 2016, The Gocql authors,
+ * provided under the BSD-3-Clause License.
+ * See the NOTICE file distributed with this work for additional information.
+ */
+
+package gocql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackBatchGroups(t *testing.T) {
+	group := func(sizes ...int) batchGroup {
+		return batchGroup{sizes: sizes}
+	}
+	tests := []struct {
+		name          string
+		groups        []batchGroup
+		maxStatements int
+		maxBytes      int
+		want          [][]int
+	}{
+		{
+			name:          "statements",
+			groups:        []batchGroup{group(0), group(0), group(0), group(0), group(0)},
+			maxStatements: 2,
+			want:          [][]int{{0, 1}, {2, 3}, {4}},
+		},
+		{
+			name:          "bytes",
+			groups:        []batchGroup{group(40), group(40), group(40), group(100), group(10)},
+			maxStatements: BatchSizeMaximum,
+			maxBytes:      100,
+			want:          [][]int{{0, 1}, {2}, {3}, {4}},
+		},
+		{
+			name:          "statement exceeding the bytes",
+			groups:        []batchGroup{group(10), group(200), group(10)},
+			maxStatements: BatchSizeMaximum,
+			maxBytes:      100,
+			want:          [][]int{{0}, {1}, {2}},
+		},
+		{
+			name:          "partitions kept together",
+			groups:        []batchGroup{group(0), group(0, 0), group(0)},
+			maxStatements: 2,
+			want:          [][]int{{0}, {1, 2}, {3}},
+		},
+		{
+			name:          "partition exceeding the limits",
+			groups:        []batchGroup{group(0), group(0, 0, 0)},
+			maxStatements: 2,
+			want:          [][]int{{0, 1}, {2, 3}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// number the statements in order
+			var n int
+			for i := range test.groups {
+				g := &test.groups[i]
+				for _, size := range g.sizes {
+					g.entries = append(g.entries, n)
+					g.size += size
+					n++
+				}
+			}
+
+			var got [][]int
+			for _, batch := range packBatchGroups(test.groups, test.maxStatements, test.maxBytes) {
+				got = append(got, batch.entries)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("expected batches %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestBatchSplitResultStatements(t *testing.T) {
+	result := BatchSplitResult{
+		Batches: []SplitBatchResult{
+			{Entries: []int{0, 1}},
+			{Entries: []int{2}, Err: ErrTimeoutNoResponse},
+		},
+		Skipped: []int{3},
+	}
+	if n := result.Statements(); n != 2 {
+		t.Fatalf("expected 2 statements applied, got %d", n)
+	}
+}
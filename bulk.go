@@ -0,0 +1,403 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBulkWriterClosed is returned by BulkWriter.Add once the writer is closed.
+var ErrBulkWriterClosed = errors.New("gocql: bulk writer is closed")
+
+// BulkWriterConfig configures a BulkWriter.
+type BulkWriterConfig struct {
+	// MaxBatchStatements is the maximum number of statements of a batch.
+	// Default: 20
+	MaxBatchStatements int
+
+	// GroupByReplica batches together the statements of all the partitions
+	// whose primary replica is the same host, rather than only the statements
+	// of the same partition. It produces larger batches, which are sent to a
+	// replica of all their partitions, for tables with few rows per
+	// partition. The token ring is the one known when the writer is created.
+	GroupByReplica bool
+
+	// Concurrency is the maximum number of batches executed at the same time,
+	// Add and Flush block once it is reached. Default: 8
+	Concurrency int
+
+	// FlushInterval is how long statements wait at most in an incomplete
+	// batch before it is executed.
+	// Default: 0 (incomplete batches are only executed by Flush and Close)
+	FlushInterval time.Duration
+
+	// Consistency is the consistency of the batches, the default consistency
+	// of the session if nil.
+	Consistency *Consistency
+
+	// RetryPolicy is the retry policy of the batches, the retry policy of the
+	// session if nil.
+	RetryPolicy RetryPolicy
+
+	// OnError, if not nil, is called with the statements of each batch which
+	// failed, for example to write them to a dead letter queue.
+	OnError func(entries []BatchEntry, err error)
+}
+
+// bulkGroup is the incomplete batch of the statements of a partition or of
+// a replica.
+type bulkGroup struct {
+	key        string
+	entries    []BatchEntry
+	routingKey []byte
+	created    time.Time
+}
+
+// BulkWriter writes large numbers of statements efficiently, grouping the
+// statements of the same partition into unlogged batches which are executed
+// concurrently. Unlike batches of statements of many partitions, which put
+// the load of contacting all their replicas on a single coordinator, such
+// batches are applied by the replicas of their partition in a single mutation.
+//
+// The statements are executed asynchronously: the errors of the batches are
+// returned by the next call to Flush or Close, and reported to
+// BulkWriterConfig.OnError.
+type BulkWriter struct {
+	session *Session
+	cfg     BulkWriterConfig
+	// meta is the token ring the statements are grouped by replica with, nil
+	// unless GroupByReplica is set.
+	meta *TokenMetadata
+	// routingKey computes the partition of the statements and exec executes
+	// the batches, they are replaced in tests.
+	routingKey func(ctx context.Context, stmt string, values []interface{}) ([]byte, error)
+	exec       func(entries []BatchEntry, routingKey []byte) error
+
+	mu     sync.Mutex
+	groups map[string]*bulkGroup
+	// full are the complete batches which were put back without being
+	// executed, they are executed by the next flush.
+	full   []*bulkGroup
+	closed bool
+	// err is the first error of the batches since the last Flush.
+	err error
+	// inflight is the number of batches being executed, idle is signaled
+	// when it drops to zero.
+	inflight int
+	idle     *sync.Cond
+
+	sem  chan struct{}
+	quit chan struct{}
+}
+
+// NewBulkWriter returns a BulkWriter executing the statements with s. It fails
+// if GroupByReplica is set and the token ring is not known.
+func NewBulkWriter(s *Session, cfg BulkWriterConfig) (*BulkWriter, error) {
+	w := newBulkWriter(cfg)
+	w.session = s
+	w.routingKey = w.statementRoutingKey
+	w.exec = w.execBatch
+	if cfg.GroupByReplica {
+		meta, err := s.TokenMetadata()
+		if err != nil {
+			return nil, err
+		}
+		w.meta = meta
+	}
+
+	if w.cfg.FlushInterval > 0 {
+		go w.flushLoop()
+	}
+	return w, nil
+}
+
+func newBulkWriter(cfg BulkWriterConfig) *BulkWriter {
+	if cfg.MaxBatchStatements <= 0 {
+		cfg.MaxBatchStatements = 20
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 8
+	}
+	w := &BulkWriter{
+		cfg:    cfg,
+		groups: make(map[string]*bulkGroup),
+		sem:    make(chan struct{}, cfg.Concurrency),
+		quit:   make(chan struct{}),
+	}
+	w.idle = sync.NewCond(&w.mu)
+	return w
+}
+
+// Add adds the statement stmt with the given values. The statement is executed
+// once its batch is complete, or by Flush. ctx bounds the wait for a batch to
+// be executed when Concurrency batches are in flight: if ctx is done first, the
+// batch is kept for the next call to Flush and ctx's error is returned.
+func (w *BulkWriter) Add(ctx context.Context, stmt string, values ...interface{}) error {
+	routingKey, err := w.routingKey(ctx, stmt, values)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrBulkWriterClosed
+	}
+	key := w.groupKey(routingKey)
+	g, ok := w.groups[key]
+	if !ok {
+		g = &bulkGroup{key: key, routingKey: routingKey, created: time.Now()}
+		w.groups[key] = g
+	}
+	g.entries = append(g.entries, BatchEntry{Stmt: stmt, Args: values})
+	if routingKey != nil && len(g.entries) < w.cfg.MaxBatchStatements {
+		w.mu.Unlock()
+		return nil
+	}
+	delete(w.groups, key)
+	w.mu.Unlock()
+
+	if err := w.flushGroup(ctx, g); err != nil {
+		w.restore([]*bulkGroup{g})
+		return err
+	}
+	return nil
+}
+
+// groupKey returns the key of the group of a statement with the given routing
+// key. The statements whose partition is not known are executed one by one.
+func (w *BulkWriter) groupKey(routingKey []byte) string {
+	if routingKey == nil {
+		return ""
+	}
+	if w.meta != nil {
+		host, _ := w.meta.ring.GetHostForToken(w.meta.ring.partitioner.Hash(routingKey))
+		if host != nil {
+			return "host:" + host.HostID()
+		}
+	}
+	return "partition:" + string(routingKey)
+}
+
+// flushGroup executes the batch of g once fewer than Concurrency batches are in
+// flight. It returns ctx's error, without executing the batch, if ctx is done
+// first.
+func (w *BulkWriter) flushGroup(ctx context.Context, g *bulkGroup) error {
+	select {
+	case w.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	w.mu.Lock()
+	w.inflight++
+	w.mu.Unlock()
+	go func() {
+		defer func() {
+			<-w.sem
+			w.mu.Lock()
+			w.inflight--
+			if w.inflight == 0 {
+				w.idle.Broadcast()
+			}
+			w.mu.Unlock()
+		}()
+		if err := w.exec(g.entries, g.routingKey); err != nil {
+			w.fail(g.entries, err)
+		}
+	}()
+	return nil
+}
+
+// fail records the failure of a batch.
+func (w *BulkWriter) fail(entries []BatchEntry, err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+
+	if w.cfg.OnError != nil {
+		w.cfg.OnError(entries, err)
+	}
+}
+
+// Flush executes the incomplete batches and waits for all the batches in
+// flight to complete. It returns the first error of the batches executed since
+// the previous call to Flush, if any. If ctx is done before all the incomplete
+// batches are executed, the batches not executed yet are kept for the next
+// call to Flush and ctx's error is returned, which is not a batch error.
+func (w *BulkWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	groups := w.full
+	for _, g := range w.groups {
+		groups = append(groups, g)
+	}
+	w.groups = make(map[string]*bulkGroup)
+	w.full = nil
+	w.mu.Unlock()
+
+	for i, g := range groups {
+		if err := w.flushGroup(ctx, g); err != nil {
+			w.restore(groups[i:])
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	w.mu.Lock()
+	err := w.err
+	w.err = nil
+	w.mu.Unlock()
+	return err
+}
+
+// wait waits for the batches in flight to complete.
+func (w *BulkWriter) wait() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.inflight > 0 {
+		w.idle.Wait()
+	}
+}
+
+// restore puts back groups which were not executed, before the statements added
+// to the same groups since. The groups are split so that no batch has more than
+// MaxBatchStatements statements, or more than one statement if its partition is
+// not known.
+func (w *BulkWriter) restore(groups []*bulkGroup) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, g := range groups {
+		entries := g.entries
+		if added, ok := w.groups[g.key]; ok {
+			entries = append(entries[:len(entries):len(entries)], added.entries...)
+			delete(w.groups, g.key)
+		}
+
+		max := w.cfg.MaxBatchStatements
+		if g.routingKey == nil {
+			max = 1
+		}
+		for len(entries) >= max {
+			w.full = append(w.full, &bulkGroup{
+				key:        g.key,
+				entries:    entries[:max:max],
+				routingKey: g.routingKey,
+				created:    g.created,
+			})
+			entries = entries[max:]
+		}
+		if len(entries) > 0 {
+			w.groups[g.key] = &bulkGroup{
+				key:        g.key,
+				entries:    entries,
+				routingKey: g.routingKey,
+				created:    g.created,
+			}
+		}
+	}
+}
+
+// Close flushes the writer and stops it, see Flush.
+func (w *BulkWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.quit)
+	w.mu.Unlock()
+
+	return w.Flush(context.Background())
+}
+
+// flushLoop executes the incomplete batches older than FlushInterval until the
+// writer is closed.
+func (w *BulkWriter) flushLoop() {
+	ticker := time.NewTicker(w.cfg.FlushInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flushExpired(time.Now().Add(-w.cfg.FlushInterval))
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// flushExpired executes the incomplete batches created before deadline, and the
+// complete batches which were put back without being executed.
+func (w *BulkWriter) flushExpired(deadline time.Time) {
+	w.mu.Lock()
+	expired := w.full
+	w.full = nil
+	for key, g := range w.groups {
+		if !g.created.After(deadline) {
+			expired = append(expired, g)
+			delete(w.groups, key)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, g := range expired {
+		w.flushGroup(context.Background(), g)
+	}
+}
+
+// statementRoutingKey returns the routing key of a statement with the given
+// values, nil if it is not known.
+func (w *BulkWriter) statementRoutingKey(ctx context.Context, stmt string, values []interface{}) ([]byte, error) {
+	info, err := w.session.routingKeyInfo(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	return createRoutingKey(info, values)
+}
+
+// execBatch executes entries in an unlogged batch routed with routingKey.
+func (w *BulkWriter) execBatch(entries []BatchEntry, routingKey []byte) error {
+	batch := w.session.NewBatch(UnloggedBatch)
+	batch.Entries = entries
+	batch.routingKey = routingKey
+	if w.cfg.Consistency != nil {
+		batch.SetConsistency(*w.cfg.Consistency)
+	}
+	if w.cfg.RetryPolicy != nil {
+		batch.RetryPolicy(w.cfg.RetryPolicy)
+	}
+	return w.session.ExecuteBatch(batch)
+}
@@ -0,0 +1,306 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkRecorder records the batches executed by a BulkWriter.
+type bulkRecorder struct {
+	mu      sync.Mutex
+	batches [][]string
+	err     error
+}
+
+func (r *bulkRecorder) exec(entries []BatchEntry, routingKey []byte) error {
+	stmts := make([]string, len(entries))
+	for i, e := range entries {
+		stmts[i] = e.Stmt
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, stmts)
+	return r.err
+}
+
+func (r *bulkRecorder) sorted() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.Slice(r.batches, func(i, j int) bool {
+		return r.batches[i][0] < r.batches[j][0]
+	})
+	return r.batches
+}
+
+func newTestBulkWriter(cfg BulkWriterConfig, r *bulkRecorder) *BulkWriter {
+	w := newBulkWriter(cfg)
+	// the first value of the statements is their routing key
+	w.routingKey = func(ctx context.Context, stmt string, values []interface{}) ([]byte, error) {
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return []byte(values[0].(string)), nil
+	}
+	w.exec = r.exec
+	return w
+}
+
+func TestBulkWriter(t *testing.T) {
+	r := &bulkRecorder{}
+	w := newTestBulkWriter(BulkWriterConfig{MaxBatchStatements: 2}, r)
+	ctx := context.Background()
+
+	for _, add := range []struct {
+		stmt string
+		key  []interface{}
+	}{
+		{"a1", []interface{}{"a"}},
+		{"b1", []interface{}{"b"}},
+		{"a2", []interface{}{"a"}},
+		{"a3", []interface{}{"a"}},
+		{"n1", nil},
+	} {
+		if err := w.Add(ctx, add.stmt, add.key...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{"a1", "a2"}, {"a3"}, {"b1"}, {"n1"}}
+	if batches := r.sorted(); !reflect.DeepEqual(batches, expected) {
+		t.Fatalf("expected batches %v, got %v", expected, batches)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(ctx, "a4", "a"); err != ErrBulkWriterClosed {
+		t.Fatalf("expected ErrBulkWriterClosed, got %v", err)
+	}
+}
+
+func TestBulkWriterError(t *testing.T) {
+	errExec := errors.New("batch failed")
+	r := &bulkRecorder{err: errExec}
+	var failed []BatchEntry
+	w := newTestBulkWriter(BulkWriterConfig{
+		OnError: func(entries []BatchEntry, err error) {
+			failed = append(failed, entries...)
+		},
+	}, r)
+	ctx := context.Background()
+
+	if err := w.Add(ctx, "a1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(ctx); err != errExec {
+		t.Fatalf("expected %v, got %v", errExec, err)
+	}
+	if len(failed) != 1 || failed[0].Stmt != "a1" {
+		t.Fatalf("expected the failed statements to be reported, got %v", failed)
+	}
+
+	// the error is only returned once
+	if err := w.Flush(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestBulkWriterGroupByReplica(t *testing.T) {
+	hosts := []*HostInfo{
+		{hostId: "a", tokens: []string{"-3074457345618258603"}},
+		{hostId: "b", tokens: []string{"3074457345618258602"}},
+		{hostId: "c", tokens: []string{"9223372036854775807"}},
+	}
+	ring, err := newTokenRing("Murmur3Partitioner", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &bulkRecorder{}
+	w := newTestBulkWriter(BulkWriterConfig{MaxBatchStatements: 100}, r)
+	w.meta = &TokenMetadata{ring: ring}
+
+	ctx := context.Background()
+	keys := []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"}
+	replicas := make(map[string]bool)
+	for _, key := range keys {
+		host, _ := ring.GetHostForToken(ring.partitioner.Hash([]byte(key)))
+		replicas[host.HostID()] = true
+		if err := w.Add(ctx, key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if batches := r.sorted(); len(batches) != len(replicas) {
+		t.Fatalf("expected one batch per replica (%d), got %v", len(replicas), batches)
+	}
+}
+
+func TestBulkWriterFlushExpired(t *testing.T) {
+	r := &bulkRecorder{}
+	w := newTestBulkWriter(BulkWriterConfig{FlushInterval: time.Minute}, r)
+	ctx := context.Background()
+
+	if err := w.Add(ctx, "a1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	w.flushExpired(time.Now().Add(-time.Minute))
+	if err := w.Add(ctx, "b1", "b"); err != nil {
+		t.Fatal(err)
+	}
+	w.flushExpired(time.Now())
+	w.wait()
+
+	if batches := r.sorted(); !reflect.DeepEqual(batches, [][]string{{"a1"}, {"b1"}}) {
+		t.Fatalf("expected expired batches to be executed, got %v", batches)
+	}
+}
+
+func TestBulkWriterFlushCanceled(t *testing.T) {
+	r := &bulkRecorder{}
+	var failed [][]BatchEntry
+	w := newTestBulkWriter(BulkWriterConfig{
+		Concurrency: 1,
+		OnError: func(entries []BatchEntry, err error) {
+			failed = append(failed, entries)
+		},
+	}, r)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		if err := w.Add(ctx, key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// no batch can be executed
+	w.sem <- struct{}{}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := w.Flush(canceled); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := w.Add(canceled, "d"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	<-w.sem
+	if len(failed) != 0 {
+		t.Fatalf("expected no batch to fail, got %v", failed)
+	}
+
+	// the batches not executed are kept for the next flush, which does not
+	// return the error of the context
+	if err := w.Add(ctx, "a2", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var executed []string
+	for _, batch := range r.sorted() {
+		executed = append(executed, batch...)
+	}
+	sort.Strings(executed)
+	if expected := []string{"a", "a2", "b", "c", "d"}; !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("expected the statements %v to be executed, got %v", expected, executed)
+	}
+}
+
+func TestBulkWriterRestoreSplit(t *testing.T) {
+	r := &bulkRecorder{}
+	w := newTestBulkWriter(BulkWriterConfig{MaxBatchStatements: 3}, r)
+	ctx := context.Background()
+	for _, stmt := range []string{"a3", "a4"} {
+		if err := w.Add(ctx, stmt, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the batches put back are merged with the statements added since
+	w.restore([]*bulkGroup{
+		{
+			key:        w.groupKey([]byte("a")),
+			entries:    []BatchEntry{{Stmt: "a1"}, {Stmt: "a2"}},
+			routingKey: []byte("a"),
+		},
+		{
+			key:     w.groupKey(nil),
+			entries: []BatchEntry{{Stmt: "x"}, {Stmt: "y"}},
+		},
+	})
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{"a1", "a2", "a3"}, {"a4"}, {"x"}, {"y"}}
+	if batches := r.sorted(); !reflect.DeepEqual(batches, expected) {
+		t.Fatalf("expected batches %v, got %v", expected, batches)
+	}
+}
+
+func TestBulkWriterFlushConcurrent(t *testing.T) {
+	r := &bulkRecorder{}
+	w := newTestBulkWriter(BulkWriterConfig{MaxBatchStatements: 2}, r)
+	ctx := context.Background()
+
+	// batches are executed by Add and the flush loop while Flush waits
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := w.Add(ctx, "a", "a"); err != nil {
+					t.Error(err)
+					return
+				}
+				w.flushExpired(time.Now())
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if err := w.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var executed int
+	for _, batch := range r.sorted() {
+		executed += len(batch)
+	}
+	if executed != 200 {
+		t.Fatalf("expected 200 statements to be executed, got %d", executed)
+	}
+}
@@ -27,7 +27,12 @@ package gocql
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -57,8 +62,17 @@ type ClusterConfig struct {
 	// address, which is used to index connected hosts. If the domain name specified
 	// resolves to more than 1 IP address then the driver may connect multiple times to
 	// the same host, and will not mark the node being down or up from events.
+	// Hosts reached through a Unix domain socket, such as a colocated sidecar
+	// proxy, are given as unix:///path/to/socket, see HostInfo.SocketPath.
 	Hosts []string
 
+	// ContactPointResolver, if not nil, supplies contact points in addition to
+	// Hosts, for example from DNS SRV records with SRVResolver. It is called
+	// when the session is created and whenever the contact points are resolved
+	// again, see ContactPointsTTL.
+	// Default: nil
+	ContactPointResolver ContactPointResolver
+
 	// CQL version (default: 3.0.0)
 	CQLVersion string
 
@@ -79,6 +93,7 @@ type ClusterConfig struct {
 	// so that retries don't overload the server.
 	// Timeout has a default value of 11 seconds, which is higher than default server timeout for most query types.
 	// Timeout is not applied to requests during initial connection setup, see ConnectTimeout.
+	// Timeout can be overridden for the queries and batches executed with a context, see WithTimeout.
 	Timeout time.Duration
 
 	// ConnectTimeout limits the time spent during connection setup.
@@ -88,11 +103,25 @@ type ClusterConfig struct {
 	// ConnectTimeout also limits the duration of dialing a new TCP connection
 	// in case there is no Dialer nor HostDialer configured.
 	// ConnectTimeout has a default value of 11 seconds.
+	// DialTimeout and HandshakeTimeout override it for each step of connection setup.
 	ConnectTimeout time.Duration
 
+	// DialTimeout limits the duration of dialing a new TCP connection, including the TLS handshake,
+	// in case there is no Dialer nor HostDialer configured.
+	// A short DialTimeout lets connection storms to unreachable hosts fail fast, without shortening
+	// the handshake of hosts which are reachable but slow to authenticate.
+	// DialTimeout defaults to the value of ConnectTimeout.
+	DialTimeout time.Duration
+
+	// HandshakeTimeout limits the overall time spent setting up a dialed connection, the exchange
+	// of the OPTIONS, STARTUP and AUTH requests and their responses as a whole.
+	// HandshakeTimeout defaults to the value of ConnectTimeout.
+	HandshakeTimeout time.Duration
+
 	// WriteTimeout limits the time the driver waits to write a request to a network connection.
 	// WriteTimeout should be lower than or equal to Timeout.
 	// WriteTimeout defaults to the value of Timeout.
+	// WriteTimeout can be overridden for the queries and batches executed with a context, see WithWriteTimeout.
 	WriteTimeout time.Duration
 
 	// Port used when dialing.
@@ -106,14 +135,92 @@ type ClusterConfig struct {
 	// Default: 2
 	NumConns int
 
+	// MaxConns enables adaptive sizing of the connection pools when greater than
+	// NumConns. A new connection to a host is opened, up to MaxConns, when the
+	// least busy connection to the host has at least NewConnThreshold requests
+	// in flight. Connections beyond NumConns are closed once they have been idle
+	// for ConnIdleTimeout.
+	// Default: 0 (pools have exactly NumConns connections)
+	MaxConns int
+
+	// NewConnThreshold is the number of requests in flight on the least busy
+	// connection to a host above which a new connection is opened, see MaxConns.
+	// Default: 800
+	NewConnThreshold int
+
+	// ConnIdleTimeout is how long a connection beyond NumConns may be idle before
+	// it is closed, see MaxConns.
+	// Default: 2 minutes
+	ConnIdleTimeout time.Duration
+
+	// ConnMaxLifetime is the maximum time a connection is used. Older connections
+	// are replaced by new ones and closed once their requests in flight are
+	// completed. This avoids connections being silently dropped by NAT devices or
+	// load balancers which limit the lifetime of TCP sessions. Each connection
+	// is recycled after a random lifetime of 80% to 100% of ConnMaxLifetime, so
+	// that the connections established together are not all recycled at once,
+	// or after exactly ConnMaxLifetime when built with the
+	// gocql_upstream_defaults tag.
+	// Default: 0 (connections are not recycled)
+	ConnMaxLifetime time.Duration
+
+	// ConnStaleTimeout is how long a connection may go without receiving any
+	// response from the server before it is verified with an OPTIONS request
+	// prior to executing a query on it. Connections failing the check are closed
+	// and the query is sent to the next host. This avoids sending queries on
+	// connections silently dropped by NAT devices or firewalls after being idle.
+	// Default: 0 (connections are not checked)
+	ConnStaleTimeout time.Duration
+
+	// ConnStallTimeout is how long a connection with requests in flight may go
+	// without receiving any bytes from the server before it is considered
+	// stalled. Stalled connections are closed, failing their requests in flight,
+	// and the pool dials a replacement. The native protocol can not cancel
+	// requests, so the streams of requests abandoned by their callers are only
+	// released once the server replies; this also reclaims the streams of
+	// requests the server never replies to.
+	// Default: 0 (connections are not watched)
+	ConnStallTimeout time.Duration
+
 	// Default consistency level.
 	// Default: Quorum
 	Consistency Consistency
 
-	// Compression algorithm.
+	// Compression algorithm. Protocol v5 connections compress segments rather
+	// than frames, and only use it if it implements SegmentCompressor.
 	// Default: nil
 	Compressor Compressor
 
+	// Compressors lists the names of registered compressors in order of
+	// preference. Each connection uses the first one supported by its host.
+	// See RegisterCompressor. Ignored if Compressor is set.
+	// Default: nil
+	Compressors []string
+
+	// MinCompressSize is the size in bytes of the frame body below which
+	// request frames are sent uncompressed, as compressing small frames costs
+	// CPU while barely reducing, or even growing, their size. It only applies
+	// to the frames sent by the driver: whether responses are compressed is
+	// decided by the server, and compressed responses are always decompressed.
+	// Default: 0 (all frames are compressed)
+	MinCompressSize int
+
+	// StartupOptions are added to the options sent in the STARTUP message of
+	// every connection, for example THROW_ON_OVERLOAD for Scylla, and can
+	// override DRIVER_NAME and DRIVER_VERSION. CQL_VERSION and COMPRESSION are
+	// always set by the driver, from CQLVersion and the negotiated compressor.
+	// Default: nil
+	StartupOptions map[string]string
+
+	// ApplicationName, ApplicationVersion and ClientID identify the
+	// application to the servers, which show them in system_views.clients on
+	// Cassandra 4.0 and later. They are sent in the STARTUP message as
+	// APPLICATION_NAME, APPLICATION_VERSION and CLIENT_ID, unless empty.
+	// Default: empty
+	ApplicationName    string
+	ApplicationVersion string
+	ClientID           UUID
+
 	// Default: nil
 	Authenticator Authenticator
 
@@ -140,6 +247,23 @@ type ClusterConfig struct {
 	// Default: 1000
 	MaxPreparedStmts int
 
+	// Time after which a prepared statement which was not used is removed
+	// from the cache and prepared again on its next use. 0 means never.
+	// Default: 0
+	PreparedStmtTTL time.Duration
+
+	// Maximum cache size for prepared statements of each keyspace, so that
+	// the statements of a keyspace do not evict the statements of the other
+	// keyspaces. 0 means no limit besides MaxPreparedStmts.
+	// Default: 0
+	MaxPreparedStmtsPerKeyspace int
+
+	// Number of statements, used most recently, prepared again in the
+	// background on a host after its connections are established again.
+	// 0 disables it.
+	// Default: 100, 0 when built with the gocql_upstream_defaults tag
+	ReprepareStatements int
+
 	// Maximum cache size for query info about statements for each session.
 	// Default: 1000
 	MaxRoutingKeyInfo int
@@ -167,6 +291,32 @@ type ClusterConfig struct {
 	// If not zero, gocql attempt to reconnect known DOWN nodes in every ReconnectInterval.
 	ReconnectInterval time.Duration
 
+	// ContactPointsTTL is how long the addresses the hostnames in Hosts, and
+	// the contact points of ContactPointResolver, resolve to are cached. Go does
+	// not expose the TTL of DNS records, so it should be set to the TTL of the
+	// records of the hostnames.
+	//
+	// The contact points are only resolved again, once expired, when the driver
+	// can not reach any of its hosts, so that it survives clusters whose
+	// addresses change:
+	//
+	//   - when the control connection can not reconnect to any host of the ring;
+	//   - every ReconnectInterval, if all the hosts are down and the ring is not
+	//     discovered, because HostDiscovery is DiscoverContactPoints or the
+	//     control connection is disabled. The hosts are then replaced by the
+	//     addresses the contact points resolve to.
+	//
+	// Default: 30 seconds, a zero value resolving the contact points every time.
+	// 0 when built with the gocql_upstream_defaults tag.
+	ContactPointsTTL time.Duration
+
+	// SeverityRefreshInterval is how often the severity of the hosts, see
+	// HostInfo.Severity, is read from the system_views.gossip_info table, which
+	// is available from Cassandra 4.1. Hosts under heavy compaction or repair
+	// report a higher severity, which SeverityAwareHostPolicy uses to avoid them.
+	// Default: 0 (the severity is not read)
+	SeverityRefreshInterval time.Duration
+
 	// The maximum amount of time to wait for schema agreement in a cluster after
 	// receiving a schema change frame. (default: 60s)
 	MaxWaitSchemaAgreement time.Duration
@@ -194,8 +344,32 @@ type ClusterConfig struct {
 	// hosts supplied and will not attempt to lookup the hosts information, this will
 	// mean that data_centre, rack and token information will not be available and as
 	// such host filtering and token aware query routing will not be available.
+	//
+	// The hosts are still read from the system.peers table by the ring refreshes
+	// following topology events and control connection reconnects.
+	//
+	// Deprecated: set HostDiscovery to DiscoverContactPoints, which also skips
+	// the ring refreshes, and describe the hosts with StaticHosts.
 	DisableInitialHostLookup bool
 
+	// HostDiscovery selects the hosts the driver connects to: all the hosts of
+	// the cluster, the contact points only, or the contact points and the hosts
+	// of the local data center.
+	// Default: DiscoverAllHosts
+	HostDiscovery HostDiscovery
+
+	// LocalDC is the data center of the hosts discovered with DiscoverLocalDC.
+	// Default: the data center of the first host the control connection
+	// connects to.
+	LocalDC string
+
+	// StaticHosts are contact points, like Hosts, whose data center, rack and
+	// tokens are set rather than read from the system tables, for proxied or
+	// firewalled topologies where the system.peers table describes addresses
+	// which can not be reached. They describe the ring with DiscoverContactPoints,
+	// otherwise they are replaced by the hosts discovered once connected.
+	StaticHosts []StaticHost
+
 	// Configure events the driver will register for
 	Events struct {
 		// disable registering for status events (node up/down)
@@ -204,6 +378,36 @@ type ClusterConfig struct {
 		DisableTopologyEvents bool
 		// disable registering for schema events (keyspace/table/function removed/created/updated)
 		DisableSchemaEvents bool
+
+		// DebounceTime is how long node and schema events are buffered after
+		// the last one received before being handled.
+		// Default: 1s
+		DebounceTime time.Duration
+		// BufferSize is the maximum number of node or schema events buffered,
+		// further events are dropped until the buffer is handled.
+		// Default: 1000
+		BufferSize int
+		// RingRefreshDebounceTime is the minimum interval between refreshes of
+		// the ring triggered by topology events.
+		// Default: 1s
+		RingRefreshDebounceTime time.Duration
+		// OnDropped, if not nil, is called for each event dropped because the
+		// buffer is full, with "NodeEvents" or "SchemaEvents".
+		OnDropped func(stream string)
+	}
+
+	// Configure how the control connection, which receives the events and
+	// refreshes the ring, fails over when its host fails
+	ControlConnection struct {
+		// PreferredHosts are the addresses, in the format of Hosts, the
+		// control connection reconnects to first, in order, before trying
+		// its previous host and then the other hosts of the ring in random
+		// order.
+		PreferredHosts []string
+		// Standby keeps a connection open to a second host, to which the
+		// control connection fails over without dialing when its host fails.
+		// The standby connection does not register for events.
+		Standby bool
 	}
 
 	// DisableSkipMetadata will override the internal result metadata cache so that the driver does not
@@ -226,17 +430,64 @@ type ClusterConfig struct {
 	// created from this session.
 	ConnectObserver ConnectObserver
 
+	// PoolObserver will be notified of the connections opened, closed and failing to connect
+	// in the connection pools, of the hosts added to and removed from the pools and of the
+	// pools running out of streams or requests.
+	PoolObserver PoolObserver
+
 	// FrameHeaderObserver will set the provided frame header observer on all frames' headers created from this session.
 	// Use it to collect metrics / stats from frames by providing an implementation of FrameHeaderObserver.
 	FrameHeaderObserver FrameHeaderObserver
 
+	// FrameObserver will be notified of every request and response frame written or read by
+	// the connections of this session, including its opcode, stream, size and latency.
+	// Intended for debugging, as it is called for every frame.
+	FrameObserver FrameObserver
+
 	// StreamObserver will be notified of stream state changes.
 	// This can be used to track in-flight protocol requests and responses.
 	StreamObserver StreamObserver
 
+	// MetadataObserver will be notified of ring refreshes and schema agreement
+	// waits, for example to track how long schema agreement takes during deploys.
+	MetadataObserver MetadataObserver
+
+	// UnpreparedObserver will be notified when a host replies that a statement
+	// is not prepared, for example to track hosts losing their statements.
+	UnpreparedObserver UnpreparedObserver
+
+	// WarningHandler, if not nil, is called with the warnings the server
+	// returns with the responses of queries and batches, which are otherwise
+	// only available from Iter.Warnings. Requires protocol version 4 or later.
+	WarningHandler WarningHandler
+
+	// SlowQuery, if not nil, reports the attempts of queries taking longer
+	// than its threshold, with their statement, the sizes of their values,
+	// their coordinator and their page, to its observer or to the logger.
+	// Default: nil
+	SlowQuery *SlowQueryConfig
+
+	// HealthCheck, if not nil, periodically probes a pooled connection of
+	// each host and marks the hosts down after consecutive failed probes,
+	// detecting unresponsive hosts before the queries sent to them time out.
+	// Default: nil
+	HealthCheck *HealthCheckConfig
+
 	// Default idempotence for queries
 	DefaultIdempotence bool
 
+	// ExecuteAs, if set, is the default user the queries and batches are
+	// executed on behalf of, see Query.ExecuteAs.
+	ExecuteAs string
+
+	// TraceProbability is the probability, between 0 and 1, with which an
+	// attempt of a query or batch without a Tracer is traced by the server, so
+	// that some traces are always available. The ids of the traces are reported
+	// to the observers in ObservedQuery.TraceID and ObservedBatch.TraceID. It
+	// can be overridden per query with Query.TraceProbability.
+	// Default: 0 (queries are only traced with Query.Trace)
+	TraceProbability float64
+
 	// The time to wait for frames before flushing the frames connection to Cassandra.
 	// Can help reduce syscall overhead by making less calls to write. Set to 0 to
 	// disable.
@@ -244,6 +495,31 @@ type ClusterConfig struct {
 	// (default: 200 microseconds)
 	WriteCoalesceWaitTime time.Duration
 
+	// WriteFairnessThreshold is the size in bytes above which request frames are
+	// written after the smaller frames coalesced with them, so that a goroutine
+	// sending large batches does not delay the requests of other goroutines
+	// sharing the connection. It only applies when write coalescing is enabled.
+	// Set to 0 to disable.
+	//
+	// (default: 0)
+	WriteFairnessThreshold int
+
+	// MaxRequestsPerHost limits the number of queries and batches in flight to a
+	// single host. When the limit is reached, a request waits up to
+	// MaxRequestsPerHostQueueTimeout for another request to the host to complete
+	// and otherwise tries the next host of the query plan. If no host of the query
+	// plan accepts the request, it fails with ErrHostOverloaded.
+	// Set to 0 to disable the limit.
+	//
+	// (default: 0)
+	MaxRequestsPerHost int
+
+	// MaxRequestsPerHostQueueTimeout is how long a request waits for a host that
+	// reached MaxRequestsPerHost. Set to 0 to move to the next host immediately.
+	//
+	// (default: 0)
+	MaxRequestsPerHostQueueTimeout time.Duration
+
 	// Dialer will be used to establish all connections created for this Cluster.
 	// If not provided, a default dialer configured with ConnectTimeout will be used.
 	// Dialer is ignored if HostDialer is provided.
@@ -253,10 +529,76 @@ type ClusterConfig struct {
 	// If not provided, Dialer will be used instead.
 	HostDialer HostDialer
 
+	// TransportFactory creates the transports of all connections for this Cluster,
+	// allowing to use transports other than TCP connections.
+	// TransportFactory is ignored if HostDialer is provided, Dialer and SslOpts are
+	// ignored if TransportFactory is provided.
+	//
+	// Experimental, this field may change.
+	TransportFactory TransportFactory
+
 	// Logger for this ClusterConfig.
 	// If not specified, defaults to the global gocql.Logger.
 	Logger StdLogger
 
+	// LogSampleInterval collapses identical messages logged by the session
+	// within the interval, such as the ones repeated for every event or host
+	// during cluster incidents: the first occurrence is logged, and the number
+	// of suppressed occurrences is reported with the next one logged after the
+	// interval, or after the interval if the message is not logged again.
+	// Default: 0 (every message is logged)
+	LogSampleInterval time.Duration
+
+	// LogEffectiveConfig logs the configuration in effect for the session, as
+	// returned by Session.EffectiveConfig, once the session is created.
+	// Default: false
+	LogEffectiveConfig bool
+
+	// CustomTypesAsBytes reads the values of custom server types, for which
+	// the driver has no Go type, as []byte in MapScan, SliceMap and RowData,
+	// instead of failing with an UnknownTypeError. Values of custom types can
+	// always be scanned into and bound from []byte.
+	// Default: false
+	CustomTypesAsBytes bool
+
+	// AdaptivePageSize, if not nil, adapts the page size of each statement to
+	// the size of its rows and the latency of its pages, starting from PageSize.
+	// Queries with a page size set by Query.PageSize are not adapted.
+	// Default: nil (the page size is PageSize)
+	AdaptivePageSize *AdaptivePageSizeConfig
+
+	// Codecs, if not nil, marshals and unmarshals the values of the types
+	// registered in it, in place of Marshal and Unmarshal.
+	// Default: nil
+	Codecs *TypeCodecs
+
+	// Analytics, if not nil, dedicates the session to analytics and batch jobs
+	// sharing the cluster with OLTP traffic: the session only connects to the
+	// analytics datacenter, never falling back to the other datacenters, and
+	// its default consistency, page size, number of connections and limits of
+	// requests in flight are replaced by the ones of the AnalyticsConfig.
+	// The host selection policy defaults to a token aware policy over the
+	// analytics datacenter.
+	// Default: nil
+	Analytics *AnalyticsConfig
+
+	// Backpressure, if not nil, throttles the requests of the session by the
+	// overload hints of the servers, such as the overloaded errors Scylla
+	// returns with THROW_ON_OVERLOAD or hints in the custom payloads of the
+	// responses, so that the session slows down when the cluster cannot keep
+	// up. Every attempt of a request is throttled, including retries and
+	// speculative executions.
+	// Default: nil
+	Backpressure *BackpressureConfig
+
+	// RetryBudget, if not nil, bounds the retries of the session to a ratio of
+	// its successful attempts, so that the retries of the queries failing
+	// during an incident do not amplify the load of the cluster into a full
+	// outage. Retries shed by the budget return a RetryBudgetExhaustedError
+	// and are counted by Session.RetryBudgetStats.
+	// Default: nil
+	RetryBudget *RetryBudgetConfig
+
 	// internal config for testing
 	disableControlConn bool
 }
@@ -282,17 +624,59 @@ func NewCluster(hosts ...string) *ClusterConfig {
 		ConnectTimeout:         11 * time.Second,
 		Port:                   9042,
 		NumConns:               2,
+		NewConnThreshold:       800,
+		ConnIdleTimeout:        2 * time.Minute,
 		Consistency:            Quorum,
 		MaxPreparedStmts:       defaultMaxPreparedStmts,
+		ReprepareStatements:    defaultReprepareStatements,
 		MaxRoutingKeyInfo:      1000,
 		PageSize:               5000,
 		DefaultTimestamp:       true,
 		MaxWaitSchemaAgreement: 60 * time.Second,
 		ReconnectInterval:      60 * time.Second,
+		ContactPointsTTL:       30 * time.Second,
 		ConvictionPolicy:       &SimpleConvictionPolicy{},
 		ReconnectionPolicy:     &ConstantReconnectionPolicy{MaxRetries: 3, Interval: 1 * time.Second},
 		WriteCoalesceWaitTime:  200 * time.Microsecond,
 	}
+	if upstreamDefaults {
+		cfg.ReprepareStatements = 0
+		cfg.ContactPointsTTL = 0
+	}
+	return cfg
+}
+
+// NewProductionClusterConfig returns the config of NewCluster adjusted for
+// production workloads:
+//
+//   - queries are routed to their replicas, with a token aware policy falling
+//     back to round-robin;
+//   - failed queries are retried up to 3 times with exponential backoff, but
+//     only when they are marked as idempotent (see IdempotentRetryPolicy);
+//   - connections are established within 5 seconds and requests are written
+//     within 5 seconds, the timeout of requests remains above the timeouts of
+//     the server;
+//   - connections are checked with TCP keepalives and, after 30 seconds
+//     without a response, with an OPTIONS request before being used (see
+//     ConnStaleTimeout).
+//
+// The other options, such as the bound of the prepared statement cache and
+// the log level, keep the defaults of NewCluster.
+//
+// The returned config can be adjusted like the one of NewCluster, for example
+// to select the hosts of the local datacenter with DCAwareRoundRobinPolicy.
+func NewProductionClusterConfig(hosts ...string) *ClusterConfig {
+	cfg := NewCluster(hosts...)
+	cfg.ConnectTimeout = 5 * time.Second
+	cfg.WriteTimeout = 5 * time.Second
+	cfg.SocketKeepalive = 30 * time.Second
+	cfg.ConnStaleTimeout = 30 * time.Second
+	cfg.RetryPolicy = IdempotentRetryPolicy(&ExponentialBackoffRetryPolicy{
+		NumRetries: 3,
+		Min:        100 * time.Millisecond,
+		Max:        time.Second,
+	})
+	cfg.PoolConfig.HostSelectionPolicy = TokenAwareHostPolicy(RoundRobinHostPolicy())
 	return cfg
 }
 
@@ -317,17 +701,102 @@ func (cfg *ClusterConfig) translateAddressPort(addr net.IP, port int) (net.IP, i
 	if cfg.AddressTranslator == nil || len(addr) == 0 {
 		return addr, port
 	}
-	newAddr, newPort := cfg.AddressTranslator.Translate(addr, port)
-	if gocqlDebug {
-		cfg.logger().Printf("gocql: translating address '%v:%d' to '%v:%d'", addr, port, newAddr, newPort)
+	return cfg.AddressTranslator.Translate(addr, port)
+}
+
+// translateSocket returns the Unix domain socket path the node at addr and port
+// is translated to by the AddressTranslator, if it is a SocketAddressTranslator.
+func (cfg *ClusterConfig) translateSocket(addr net.IP, port int) string {
+	translator, ok := cfg.AddressTranslator.(SocketAddressTranslator)
+	if !ok || len(addr) == 0 {
+		return ""
 	}
-	return newAddr, newPort
+	return translator.TranslateSocket(addr, port)
 }
 
 func (cfg *ClusterConfig) filterHost(host *HostInfo) bool {
 	return !(cfg.HostFilter == nil || cfg.HostFilter.Accept(host))
 }
 
+// EffectiveConfig is the configuration in effect for a session, once the
+// defaults of the driver and the environment are applied to its ClusterConfig.
+type EffectiveConfig struct {
+	// Settings maps the name of each setting of the ClusterConfig, prefixed by
+	// the names of the structs it is nested in like PoolConfig.HostSelectionPolicy,
+	// to its value. Interfaces and pointers to types of other packages are
+	// represented by their type so that no credentials are included, and functions
+	// by whether they are set.
+	Settings map[string]string `json:"settings"`
+	// Env maps the environment variables read by the driver which are set to
+	// their value.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// driverEnv lists the environment variables read by the driver.
+var driverEnv = []string{"GOCQL_HOST_LOOKUP_PREFER_V4"}
+
+func newEffectiveConfig(cfg *ClusterConfig) EffectiveConfig {
+	c := EffectiveConfig{Settings: make(map[string]string)}
+	configSettings("", reflect.ValueOf(cfg).Elem(), c.Settings)
+	for _, name := range driverEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			if c.Env == nil {
+				c.Env = make(map[string]string)
+			}
+			c.Env[name] = v
+		}
+	}
+	return c
+}
+
+func configSettings(prefix string, v reflect.Value, settings map[string]string) {
+	pkg := reflect.TypeOf(ClusterConfig{}).PkgPath()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := prefix + f.Name
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.Struct:
+			configSettings(name+".", fv, settings)
+		case reflect.Ptr, reflect.Interface:
+			switch {
+			case fv.IsNil():
+				settings[name] = "<nil>"
+			case fv.Kind() == reflect.Ptr && fv.Elem().Kind() == reflect.Struct && fv.Elem().Type().PkgPath() == pkg:
+				n := len(settings)
+				if configSettings(name+".", fv.Elem(), settings); len(settings) == n {
+					settings[name] = fmt.Sprintf("%T", fv.Interface())
+				}
+			default:
+				settings[name] = fmt.Sprintf("%T", fv.Interface())
+			}
+		case reflect.Func:
+			settings[name] = fmt.Sprint(!fv.IsNil())
+		default:
+			settings[name] = fmt.Sprint(fv.Interface())
+		}
+	}
+}
+
+// String returns the settings and the environment variables as space separated
+// name=value pairs sorted by name.
+func (c EffectiveConfig) String() string {
+	pairs := make([]string, 0, len(c.Settings)+len(c.Env))
+	for name, v := range c.Settings {
+		pairs = append(pairs, name+"="+v)
+	}
+	for name, v := range c.Env {
+		pairs = append(pairs, name+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
 var (
 	ErrNoHosts              = errors.New("no hosts provided")
 	ErrNoConnectionsStarted = errors.New("no connections were made when creating the session")
@@ -27,6 +27,7 @@ package gocql
 import (
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -44,12 +45,88 @@ func TestNewCluster_Defaults(t *testing.T) {
 	assertEqual(t, "cluster config default timestamp", true, cfg.DefaultTimestamp)
 	assertEqual(t, "cluster config max wait schema agreement", 60*time.Second, cfg.MaxWaitSchemaAgreement)
 	assertEqual(t, "cluster config reconnect interval", 60*time.Second, cfg.ReconnectInterval)
+	contactPointsTTL := 30 * time.Second
+	if upstreamDefaults {
+		contactPointsTTL = 0
+	}
+	assertEqual(t, "cluster config contact points ttl", contactPointsTTL, cfg.ContactPointsTTL)
 	assertTrue(t, "cluster config conviction policy",
 		reflect.DeepEqual(&SimpleConvictionPolicy{}, cfg.ConvictionPolicy))
 	assertTrue(t, "cluster config reconnection policy",
 		reflect.DeepEqual(&ConstantReconnectionPolicy{MaxRetries: 3, Interval: 1 * time.Second}, cfg.ReconnectionPolicy))
 }
 
+func TestNewEffectiveConfig(t *testing.T) {
+	cfg := NewCluster("addr1")
+	cfg.Authenticator = PasswordAuthenticator{Username: "user", Password: "secret"}
+	cfg.SslOpts = &SslOptions{CaPath: "ca.pem"}
+	c := newEffectiveConfig(cfg)
+
+	for name, want := range map[string]string{
+		"Hosts":                          "[addr1]",
+		"NumConns":                       "2",
+		"Consistency":                    "QUORUM",
+		"Timeout":                        "11s",
+		"Authenticator":                  "gocql.PasswordAuthenticator",
+		"SslOpts.CaPath":                 "ca.pem",
+		"SslOpts.Config":                 "<nil>",
+		"PoolConfig.HostSelectionPolicy": "<nil>",
+		"ConvictionPolicy":               "*gocql.SimpleConvictionPolicy",
+		"HostDialer":                     "<nil>",
+	} {
+		if got := c.Settings[name]; got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if strings.Contains(c.String(), "secret") {
+		t.Errorf("credentials included in %q", c.String())
+	}
+}
+
+func TestNewProductionClusterConfig(t *testing.T) {
+	cfg := NewProductionClusterConfig("addr1")
+	assertDeepEqual(t, "cluster config hosts", []string{"addr1"}, cfg.Hosts)
+	assertEqual(t, "cluster config connect timeout", 5*time.Second, cfg.ConnectTimeout)
+	assertEqual(t, "cluster config stale timeout", 30*time.Second, cfg.ConnStaleTimeout)
+	assertEqual(t, "cluster config max prepared statements", defaultMaxPreparedStmts, cfg.MaxPreparedStmts)
+	if _, ok := cfg.RetryPolicy.(*idempotentRetryPolicy); !ok {
+		t.Errorf("cluster config retry policy is %T, expected idempotent retry policy", cfg.RetryPolicy)
+	}
+	if _, ok := cfg.PoolConfig.HostSelectionPolicy.(*tokenAwareHostPolicy); !ok {
+		t.Errorf("cluster config host selection policy is %T, expected token aware policy", cfg.PoolConfig.HostSelectionPolicy)
+	}
+}
+
+func TestClusterConfig_applyAnalytics(t *testing.T) {
+	cfg := NewCluster("addr1")
+	cfg.HostFilter = HostFilterFunc(func(host *HostInfo) bool {
+		return host.Rack() != "excluded"
+	})
+	cfg.Analytics = &AnalyticsConfig{DC: "analytics", PageSize: 10000}
+	if err := cfg.applyAnalytics(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "cluster config consistency", LocalOne, cfg.Consistency)
+	assertEqual(t, "cluster config page size", 10000, cfg.PageSize)
+	assertEqual(t, "cluster config connections", 1, cfg.NumConns)
+	assertEqual(t, "cluster config max requests per host", 32, cfg.MaxRequestsPerHost)
+	assertEqual(t, "cluster config max requests queue timeout", 5*time.Second, cfg.MaxRequestsPerHostQueueTimeout)
+	if _, ok := cfg.PoolConfig.HostSelectionPolicy.(*tokenAwareHostPolicy); !ok {
+		t.Errorf("cluster config host selection policy is %T, expected token aware policy", cfg.PoolConfig.HostSelectionPolicy)
+	}
+	assertTrue(t, "analytics host accepted", !cfg.filterHost(&HostInfo{dataCenter: "analytics"}))
+	assertTrue(t, "oltp host filtered", cfg.filterHost(&HostInfo{dataCenter: "oltp"}))
+	assertTrue(t, "excluded host filtered", cfg.filterHost(&HostInfo{dataCenter: "analytics", rack: "excluded"}))
+
+	for _, a := range []AnalyticsConfig{{}, {DC: "analytics", Consistency: Quorum}} {
+		cfg := NewCluster("addr1")
+		cfg.Analytics = &a
+		if err := cfg.applyAnalytics(); err == nil {
+			t.Errorf("expected error with analytics config %+v", a)
+		}
+	}
+}
+
 func TestNewCluster_WithHosts(t *testing.T) {
 	cfg := NewCluster("addr1", "addr2")
 	assertEqual(t, "cluster config hosts length", 2, len(cfg.Hosts))
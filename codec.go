@@ -0,0 +1,112 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package gocql
+
+import "reflect"
+
+// TypeCodec marshals and unmarshals values in place of Marshal and Unmarshal,
+// for the CQL type or the Go type it is registered for in TypeCodecs. Either
+// function may be nil for the codec to be used in one direction only.
+type TypeCodec struct {
+	Marshal   func(info TypeInfo, value interface{}) ([]byte, error)
+	Unmarshal func(info TypeInfo, data []byte, value interface{}) error
+}
+
+// TypeCodecs is a registry of codecs consulted before Marshal and Unmarshal to
+// bind the values of queries and batches and to scan the columns of rows, see
+// ClusterConfig.Codecs. Codecs registered for a Go type take precedence over
+// the ones registered for a CQL type. The codecs are not consulted for the
+// elements of collections, tuples and user defined types.
+//
+// Codecs must be registered before sessions are created with the registry.
+//
+//	codecs := gocql.NewTypeCodecs()
+//	codecs.RegisterGoType(decimal.Decimal{}, gocql.TypeCodec{
+//		Marshal: func(info gocql.TypeInfo, value interface{}) ([]byte, error) {
+//			...
+//		},
+//		Unmarshal: func(info gocql.TypeInfo, data []byte, value interface{}) error {
+//			...
+//		},
+//	})
+//	cluster.Codecs = codecs
+//
+// The codecs can be tested against the golden fixtures of the marshaltest
+// package.
+type TypeCodecs struct {
+	types   map[Type]TypeCodec
+	goTypes map[reflect.Type]TypeCodec
+}
+
+// NewTypeCodecs returns an empty registry.
+func NewTypeCodecs() *TypeCodecs {
+	return &TypeCodecs{
+		types:   make(map[Type]TypeCodec),
+		goTypes: make(map[reflect.Type]TypeCodec),
+	}
+}
+
+// RegisterType registers codec for the values of the CQL type typ, whatever
+// their Go type. The codec may call Marshal and Unmarshal for the Go types it
+// does not handle.
+func (c *TypeCodecs) RegisterType(typ Type, codec TypeCodec) {
+	c.types[typ] = codec
+}
+
+// RegisterGoType registers codec for the values of the Go type of v, whatever
+// their CQL type. The codec marshals values of the type and non nil pointers
+// to it, and unmarshals into pointers to it.
+func (c *TypeCodecs) RegisterGoType(v interface{}, codec TypeCodec) {
+	c.goTypes[reflect.TypeOf(v)] = codec
+}
+
+// Marshal marshals value with the codec registered for it, or with Marshal if
+// there is none. It can be called on a nil registry.
+func (c *TypeCodecs) Marshal(info TypeInfo, value interface{}) ([]byte, error) {
+	if c != nil {
+		t := reflect.TypeOf(value)
+		if codec, ok := c.goTypes[t]; ok && codec.Marshal != nil {
+			return codec.Marshal(info, value)
+		}
+		if t != nil && t.Kind() == reflect.Ptr && !reflect.ValueOf(value).IsNil() {
+			if codec, ok := c.goTypes[t.Elem()]; ok && codec.Marshal != nil {
+				return codec.Marshal(info, value)
+			}
+		}
+		if codec, ok := c.types[info.Type()]; ok && codec.Marshal != nil {
+			return codec.Marshal(info, value)
+		}
+	}
+	return Marshal(info, value)
+}
+
+// Unmarshal unmarshals data into value with the codec registered for it, or
+// with Unmarshal if there is none. It can be called on a nil registry.
+func (c *TypeCodecs) Unmarshal(info TypeInfo, data []byte, value interface{}) error {
+	if c != nil {
+		if t := reflect.TypeOf(value); t != nil && t.Kind() == reflect.Ptr {
+			if codec, ok := c.goTypes[t.Elem()]; ok && codec.Unmarshal != nil {
+				return codec.Unmarshal(info, data, value)
+			}
+		}
+		if codec, ok := c.types[info.Type()]; ok && codec.Unmarshal != nil {
+			return codec.Unmarshal(info, data, value)
+		}
+	}
+	return Unmarshal(info, data, value)
+}
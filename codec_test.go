@@ -0,0 +1,121 @@
+//go:build all || unit
+// +build all unit
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type celsius float64
+
+func TestTypeCodecs(t *testing.T) {
+	codecs := NewTypeCodecs()
+	codecs.RegisterGoType(celsius(0), TypeCodec{
+		Marshal: func(info TypeInfo, value interface{}) ([]byte, error) {
+			if p, ok := value.(*celsius); ok {
+				value = *p
+			}
+			return Marshal(info, float64(value.(celsius))+273.15)
+		},
+		Unmarshal: func(info TypeInfo, data []byte, value interface{}) error {
+			var kelvin float64
+			if err := Unmarshal(info, data, &kelvin); err != nil {
+				return err
+			}
+			*value.(*celsius) = celsius(kelvin - 273.15)
+			return nil
+		},
+	})
+	codecs.RegisterType(TypeVarchar, TypeCodec{
+		Unmarshal: func(info TypeInfo, data []byte, value interface{}) error {
+			*value.(*string) = strings.ToUpper(string(data))
+			return nil
+		},
+	})
+
+	double := NativeType{proto: protoVersion4, typ: TypeDouble}
+	varchar := NativeType{proto: protoVersion4, typ: TypeVarchar}
+	expected, err := Marshal(double, 273.15)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := celsius(0)
+	for _, v := range []interface{}{c, &c} {
+		data, err := codecs.Marshal(double, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("got %x marshaling %T, expected %x", data, v, expected)
+		}
+	}
+	if data, err := codecs.Marshal(double, (*celsius)(nil)); err != nil || data != nil {
+		t.Errorf("got %x, %v marshaling nil pointer, expected null", data, err)
+	}
+
+	c = 100
+	if err := codecs.Unmarshal(double, expected, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c != 0 {
+		t.Errorf("got %v unmarshaling, expected 0", c)
+	}
+
+	// the marshaling of varchar values is not overridden
+	data, err := codecs.Marshal(varchar, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if _, err := scanColumn(codecs, data, ColumnInfo{TypeInfo: varchar}, []interface{}{&s}); err != nil {
+		t.Fatal(err)
+	}
+	if s != "ABC" {
+		t.Errorf("got %q scanning, expected ABC", s)
+	}
+
+	// a nil registry falls back to Marshal and Unmarshal
+	var nilCodecs *TypeCodecs
+	if data, err := nilCodecs.Marshal(double, c); err != nil || bytes.Equal(data, expected) {
+		t.Errorf("got %x, %v marshaling without codecs", data, err)
+	}
+	var f float64
+	if err := nilCodecs.Unmarshal(double, expected, &f); err != nil || f != 273.15 {
+		t.Errorf("got %v, %v unmarshaling without codecs", f, err)
+	}
+
+	info := &routingKeyInfo{indexes: []int{0}, types: []TypeInfo{double}, codecs: codecs}
+	if key, err := createRoutingKey(info, []interface{}{celsius(0)}); err != nil || !bytes.Equal(key, expected) {
+		t.Errorf("got routing key %x, %v, expected %x", key, err, expected)
+	}
+
+	var dst queryValues
+	if err := marshalQueryValue(codecs, double, NamedValue("t", celsius(0)), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.name != "t" || !bytes.Equal(dst.value, expected) {
+		t.Errorf("got query value %q=%x, expected t=%x", dst.name, dst.value, expected)
+	}
+}
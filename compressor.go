@@ -25,6 +25,8 @@
 package gocql
 
 import (
+	"sync"
+
 	"github.com/golang/snappy"
 )
 
@@ -34,6 +36,87 @@ type Compressor interface {
 	Decode(data []byte) ([]byte, error)
 }
 
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{}
+)
+
+func init() {
+	RegisterCompressor(SnappyCompressor{})
+}
+
+// RegisterCompressor makes a compressor available by its name to
+// ClusterConfig.Compressors, replacing any compressor registered with the same
+// name. The snappy compressor is registered by default; others, such as the
+// ones of github.com/gocql/gocql/lz4 and github.com/gocql/gocql/zstd, must be
+// registered before creating a session:
+//
+//	gocql.RegisterCompressor(lz4.LZ4Compressor{})
+//	cluster.Compressors = []string{"lz4", "snappy"}
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	compressors[c.Name()] = c
+	compressorsMu.Unlock()
+}
+
+func registeredCompressor(name string) (Compressor, bool) {
+	compressorsMu.RLock()
+	c, ok := compressors[name]
+	compressorsMu.RUnlock()
+	return c, ok
+}
+
+// negotiateCompressor returns the first of the preferred compressors which is
+// registered, supported by the server and usable with the protocol version, or
+// nil if there is none.
+func negotiateCompressor(preferred []string, supported []string, version uint8) Compressor {
+	for _, name := range preferred {
+		if !supportsCompressor(supported, name) {
+			continue
+		}
+		if c, ok := registeredCompressor(name); ok && compressesVersion(c, version) {
+			return c
+		}
+	}
+	return nil
+}
+
+// startupCompressor returns the compressor of a connection to a server
+// supporting the given compressors: the configured compressor, registered or
+// not, if the server supports it, or else the compressor negotiated from the
+// preferred ones if no compressor is configured.
+func startupCompressor(configured Compressor, preferred []string, supported []string, version uint8) Compressor {
+	if configured != nil {
+		if supportsCompressor(supported, configured.Name()) && compressesVersion(configured, version) {
+			return configured
+		}
+		return nil
+	}
+	return negotiateCompressor(preferred, supported, version)
+}
+
+// compressesVersion reports whether c can compress the frames of the protocol
+// version. Protocol v5 compresses segments rather than frames, which needs a
+// SegmentCompressor.
+func compressesVersion(c Compressor, version uint8) bool {
+	if version < protoVersion5 {
+		return true
+	}
+	_, ok := c.(SegmentCompressor)
+	return ok
+}
+
+// supportsCompressor reports whether name is in the compressors supported by
+// the server.
+func supportsCompressor(supported []string, name string) bool {
+	for _, s := range supported {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
 // SnappyCompressor implements the Compressor interface and can be used to
 // compress incoming and outgoing frames. The snappy compression algorithm
 // aims for very high speeds and reasonable compression.
@@ -50,3 +133,13 @@ func (s SnappyCompressor) Encode(data []byte) ([]byte, error) {
 func (s SnappyCompressor) Decode(data []byte) ([]byte, error) {
 	return snappy.Decode(nil, data)
 }
+
+// SegmentCompressor is implemented by compressors which support the
+// segment level compression of protocol v5, where the uncompressed length of
+// a block is carried by the segment header rather than by the block itself.
+// Connections using protocol v5 only negotiate compressors implementing it.
+type SegmentCompressor interface {
+	Compressor
+	EncodeBlock(data []byte) ([]byte, error)
+	DecodeBlock(data []byte, uncompressedLength int) ([]byte, error)
+}
@@ -60,3 +60,64 @@ func TestSnappyCompressor(t *testing.T) {
 		t.Fatal("failed to match the expected decoded value with the result decoded value.")
 	}
 }
+
+type testCompressor struct {
+	SnappyCompressor
+	name string
+}
+
+func (c testCompressor) Name() string {
+	return c.name
+}
+
+func TestNegotiateCompressor(t *testing.T) {
+	RegisterCompressor(testCompressor{name: "test-negotiate"})
+
+	tests := []struct {
+		preferred []string
+		supported []string
+		expected  string
+	}{
+		{[]string{"test-negotiate", "snappy"}, []string{"snappy", "test-negotiate"}, "test-negotiate"},
+		{[]string{"test-negotiate", "snappy"}, []string{"lz4", "snappy"}, "snappy"},
+		{[]string{"unregistered", "snappy"}, []string{"unregistered", "snappy"}, "snappy"},
+		{[]string{"test-negotiate"}, []string{"lz4"}, ""},
+	}
+
+	for _, test := range tests {
+		c := negotiateCompressor(test.preferred, test.supported, protoVersion4)
+		var name string
+		if c != nil {
+			name = c.Name()
+		}
+		if name != test.expected {
+			t.Errorf("negotiating %v against %v: expected %q, got %q", test.preferred, test.supported, test.expected, name)
+		}
+	}
+}
+
+func TestStartupCompressor(t *testing.T) {
+	// the configured compressor is kept even if it is not registered
+	configured := testCompressor{name: "test-unregistered"}
+	if c := startupCompressor(configured, nil, []string{"snappy", "test-unregistered"}, protoVersion4); c != configured {
+		t.Fatalf("expected the configured compressor, got %v", c)
+	}
+	if c := startupCompressor(configured, []string{"snappy"}, []string{"snappy"}, protoVersion4); c != nil {
+		t.Fatalf("expected no compressor when the server does not support the configured one, got %v", c)
+	}
+	if c := startupCompressor(nil, []string{"snappy"}, []string{"snappy"}, protoVersion4); c == nil || c.Name() != "snappy" {
+		t.Fatalf("expected the registered snappy compressor, got %v", c)
+	}
+
+	// protocol v5 compresses segments, which frame compressors can not do
+	if c := startupCompressor(nil, []string{"snappy"}, []string{"snappy"}, protoVersion5); c != nil {
+		t.Fatalf("expected no compressor for protocol v5, got %v", c)
+	}
+	if c := startupCompressor(SnappyCompressor{}, nil, []string{"snappy"}, protoVersion5); c != nil {
+		t.Fatalf("expected no compressor for protocol v5, got %v", c)
+	}
+	segmented := snappySegmentCompressor{}
+	if c := startupCompressor(segmented, nil, []string{"snappy"}, protoVersion5); c != segmented {
+		t.Fatalf("expected the configured segment compressor, got %v", c)
+	}
+}
@@ -39,7 +39,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/gocql/gocql/internal/lru"
 	"github.com/gocql/gocql/internal/streams"
 )
 
@@ -81,26 +80,57 @@ func JoinHostPort(addr string, port int) string {
 	return addr
 }
 
+// Authenticator authenticates the connections to the nodes. If the
+// Authenticator returned by Challenge implements io.Closer, it is closed when
+// the authentication fails before it is done.
 type Authenticator interface {
 	Challenge(req []byte) (resp []byte, auth Authenticator, err error)
 	Success(data []byte) error
 }
 
+// CredentialsProvider provides the credentials of a PasswordAuthenticator.
+type CredentialsProvider interface {
+	// Credentials returns the username and password to authenticate with.
+	// It is called each time a connection is authenticated, so it can
+	// return credentials which are rotated, for example fetched from a
+	// secret store, without recreating the Session. It should cache them
+	// rather than fetch them for each connection.
+	Credentials() (username, password string, err error)
+}
+
+// CredentialsProviderFunc is a function implementing CredentialsProvider.
+type CredentialsProviderFunc func() (username, password string, err error)
+
+func (fn CredentialsProviderFunc) Credentials() (string, string, error) {
+	return fn()
+}
+
 type PasswordAuthenticator struct {
 	Username              string
 	Password              string
 	AllowedAuthenticators []string
+
+	// CredentialsProvider, if not nil, provides the credentials instead of
+	// Username and Password.
+	CredentialsProvider CredentialsProvider
 }
 
 func (p PasswordAuthenticator) Challenge(req []byte) ([]byte, Authenticator, error) {
 	if !approve(string(req), p.AllowedAuthenticators) {
 		return nil, nil, fmt.Errorf("unexpected authenticator %q", req)
 	}
-	resp := make([]byte, 2+len(p.Username)+len(p.Password))
+	username, password := p.Username, p.Password
+	if p.CredentialsProvider != nil {
+		var err error
+		if username, password, err = p.CredentialsProvider.Credentials(); err != nil {
+			return nil, nil, fmt.Errorf("unable to get credentials: %v", err)
+		}
+	}
+	resp := make([]byte, 2+len(username)+len(password))
 	resp[0] = 0
-	copy(resp[1:], p.Username)
-	resp[len(p.Username)+1] = 0
-	copy(resp[2+len(p.Username):], p.Password)
+	copy(resp[1:], username)
+	resp[len(username)+1] = 0
+	copy(resp[2+len(username):], password)
 	return resp, nil, nil
 }
 
@@ -137,6 +167,16 @@ type SslOptions struct {
 	//
 	// See SslOptions documentation to see how EnableHostVerification interacts with the provided tls.Config.
 	EnableHostVerification bool
+
+	// GetConfig, if not nil, returns the TLS configuration of each new
+	// connection to host, so that rotated certificates and CAs are used by
+	// the new connections without recreating the Session. The other options
+	// are ignored when it is set, and the returned config is used as is,
+	// except for ServerName which defaults to the hostname of host.
+	//
+	// The returned config must not be modified after it is returned, return
+	// a new one instead.
+	GetConfig func(ctx context.Context, host *HostInfo) (*tls.Config, error)
 }
 
 type ConnConfig struct {
@@ -145,9 +185,22 @@ type ConnConfig struct {
 	Timeout        time.Duration
 	WriteTimeout   time.Duration
 	ConnectTimeout time.Duration
-	Dialer         Dialer
-	HostDialer     HostDialer
-	Compressor     Compressor
+	// DialTimeout and HandshakeTimeout default to ConnectTimeout.
+	DialTimeout      time.Duration
+	HandshakeTimeout time.Duration
+	Dialer           Dialer
+	HostDialer       HostDialer
+	Compressor       Compressor
+	Compressors      []string
+	// MinCompressSize is the body size below which request frames are sent
+	// uncompressed.
+	MinCompressSize int
+	// CustomTypesAsBytes reads the values of custom types as []byte.
+	CustomTypesAsBytes bool
+	// Codecs marshals and unmarshals the values of the types registered in it.
+	Codecs *TypeCodecs
+	// StartupOptions are added to the options of the STARTUP message.
+	StartupOptions map[string]string
 	Authenticator  Authenticator
 	AuthProvider   func(h *HostInfo) (Authenticator, error)
 	Keepalive      time.Duration
@@ -187,13 +240,14 @@ var TimeoutLimit int64 = 0
 // level API.
 type Conn struct {
 	conn net.Conn
-	r    *bufio.Reader
+	r    io.Reader
 	w    contextWriter
 
 	timeout        time.Duration
 	writeTimeout   time.Duration
 	cfg            *ConnConfig
 	frameObserver  FrameHeaderObserver
+	wireObserver   FrameObserver
 	streamObserver StreamObserver
 
 	headerBuf [maxFrameHeaderSize]byte
@@ -210,7 +264,13 @@ type Conn struct {
 	auth         Authenticator
 	addr         string
 
-	version         uint8
+	version uint8
+	// segmented is set once a protocol v5 connection wraps its frames in
+	// segments, which it does from the READY or AUTHENTICATE response to the
+	// STARTUP request on. Frames in segments are not compressed, the segments
+	// are.
+	segmented bool
+
 	currentKeyspace string
 	host            *HostInfo
 	isSchemaV2      bool
@@ -224,6 +284,22 @@ type Conn struct {
 	cancel context.CancelFunc
 
 	timeouts int64
+	// timers expires the timeouts of the requests.
+	timers *timerWheel
+
+	// created is when the connection was established.
+	created time.Time
+	// lifetime is how long the connection is used by its pool before it is
+	// recycled, 0 if it is not, see ClusterConfig.ConnMaxLifetime.
+	lifetime time.Duration
+
+	// used is when the connection was last used to execute a query or batch,
+	// in nanoseconds since the epoch. It is accessed atomically.
+	used int64
+
+	// responded is when the connection last received a frame from the server,
+	// in nanoseconds since the epoch. It is accessed atomically.
+	responded int64
 
 	logger StdLogger
 }
@@ -246,6 +322,9 @@ func (s *Session) dial(ctx context.Context, host *HostInfo, connConfig *ConnConf
 	if s.connectObserver != nil {
 		obs.End = time.Now()
 		obs.Err = err
+		if err == nil {
+			obs.TLS = conn.TLSConnectionState()
+		}
 		s.connectObserver.ObserveConnect(obs)
 	}
 
@@ -281,6 +360,7 @@ func (s *Session) dialWithoutObserver(ctx context.Context, host *HostInfo, cfg *
 		host:          host,
 		isSchemaV2:    true, // Try using "system.peers_v2" until proven otherwise
 		frameObserver: s.frameObserver,
+		wireObserver:  s.wireObserver,
 		w: &deadlineContextWriter{
 			w:         dialedHost.Conn,
 			timeout:   writeTimeout,
@@ -289,9 +369,13 @@ func (s *Session) dialWithoutObserver(ctx context.Context, host *HostInfo, cfg *
 		},
 		ctx:            ctx,
 		cancel:         cancel,
+		timers:         newTimerWheel(ctx, timerWheelTick, timerWheelSlots),
 		logger:         cfg.logger(),
 		streamObserver: s.streamObserver,
 		writeTimeout:   writeTimeout,
+		created:        time.Now(),
+		used:           time.Now().UnixNano(),
+		responded:      time.Now().UnixNano(),
 	}
 
 	if err := c.init(ctx, dialedHost); err != nil {
@@ -300,9 +384,27 @@ func (s *Session) dialWithoutObserver(ctx context.Context, host *HostInfo, cfg *
 		return nil, err
 	}
 
+	if state := c.TLSConnectionState(); state != nil {
+		host.setTLSConnectionState(state)
+	}
+
 	return c, nil
 }
 
+// TLSConnectionState returns the TLS state negotiated by the connection, such
+// as the TLS version, cipher suite and peer certificates, or nil if the
+// connection does not use TLS.
+func (c *Conn) TLSConnectionState() *tls.ConnectionState {
+	tlsConn, ok := c.conn.(interface {
+		ConnectionState() tls.ConnectionState
+	})
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
 func (c *Conn) init(ctx context.Context, dialedHost *DialedHost) error {
 	if c.session.cfg.AuthProvider != nil {
 		var err error
@@ -320,6 +422,9 @@ func (c *Conn) init(ctx context.Context, dialedHost *DialedHost) error {
 	}
 
 	c.timeout = c.cfg.ConnectTimeout
+	if c.cfg.HandshakeTimeout > 0 {
+		c.timeout = c.cfg.HandshakeTimeout
+	}
 	if err := startup.setupConn(ctx); err != nil {
 		return err
 	}
@@ -328,11 +433,16 @@ func (c *Conn) init(ctx context.Context, dialedHost *DialedHost) error {
 
 	// dont coalesce startup frames
 	if c.session.cfg.WriteCoalesceWaitTime > 0 && !c.cfg.disableCoalesce && !dialedHost.DisableCoalesce {
-		c.w = newWriteCoalescer(c.conn, c.writeTimeout, c.session.cfg.WriteCoalesceWaitTime, ctx.Done())
+		wc := newWriteCoalescer(c.conn, c.writeTimeout, c.session.cfg.WriteCoalesceWaitTime, ctx.Done())
+		wc.fairnessThreshold = c.session.cfg.WriteFairnessThreshold
+		c.w = wc
 	}
 
 	go c.serve(ctx)
 	go c.heartBeat(ctx)
+	if stallTimeout := c.session.cfg.ConnStallTimeout; stallTimeout > 0 {
+		go c.watchStalls(ctx, stallTimeout)
+	}
 
 	return nil
 }
@@ -445,24 +555,18 @@ func (s *startupCoordinator) options(ctx context.Context) error {
 
 func (s *startupCoordinator) startup(ctx context.Context, supported map[string][]string) error {
 	m := map[string]string{
-		"CQL_VERSION":    s.conn.cfg.CQLVersion,
 		"DRIVER_NAME":    driverName,
 		"DRIVER_VERSION": driverVersion,
 	}
+	for k, v := range s.conn.cfg.StartupOptions {
+		m[k] = v
+	}
+	m["CQL_VERSION"] = s.conn.cfg.CQLVersion
+	delete(m, "COMPRESSION")
 
+	s.conn.compressor = startupCompressor(s.conn.compressor, s.conn.cfg.Compressors, supported["COMPRESSION"], s.conn.version)
 	if s.conn.compressor != nil {
-		comp := supported["COMPRESSION"]
-		name := s.conn.compressor.Name()
-		for _, compressor := range comp {
-			if compressor == name {
-				m["COMPRESSION"] = compressor
-				break
-			}
-		}
-
-		if _, ok := m["COMPRESSION"]; !ok {
-			s.conn.compressor = nil
-		}
+		m["COMPRESSION"] = s.conn.compressor.Name()
 	}
 
 	frame, err := s.write(ctx, &writeStartupFrame{opts: m})
@@ -482,7 +586,7 @@ func (s *startupCoordinator) startup(ctx context.Context, supported map[string][
 	}
 }
 
-func (s *startupCoordinator) authenticateHandshake(ctx context.Context, authFrame *authenticateFrame) error {
+func (s *startupCoordinator) authenticateHandshake(ctx context.Context, authFrame *authenticateFrame) (err error) {
 	if s.conn.auth == nil {
 		return fmt.Errorf("authentication required (using %q)", authFrame.class)
 	}
@@ -491,6 +595,13 @@ func (s *startupCoordinator) authenticateHandshake(ctx context.Context, authFram
 	if err != nil {
 		return err
 	}
+	defer func() {
+		// release the state of the authentication, such as a security
+		// context, when the node or the connection fails it
+		if c, ok := challenger.(io.Closer); ok && err != nil {
+			c.Close()
+		}
+	}()
 
 	req := &writeAuthResponseFrame{data: resp}
 	for {
@@ -508,10 +619,12 @@ func (s *startupCoordinator) authenticateHandshake(ctx context.Context, authFram
 			}
 			return nil
 		case *authChallengeFrame:
-			resp, challenger, err = challenger.Challenge(v.data)
+			var next Authenticator
+			resp, next, err = challenger.Challenge(v.data)
 			if err != nil {
 				return err
 			}
+			challenger = next
 
 			req = &writeAuthResponseFrame{
 				data: resp,
@@ -554,9 +667,7 @@ func (c *Conn) closeWithError(err error) {
 		}
 		if req.streamObserverContext != nil {
 			req.streamObserverEndOnce.Do(func() {
-				req.streamObserverContext.StreamAbandoned(ObservedStream{
-					Host: c.host,
-				})
+				req.streamObserverContext.StreamAbandoned(req.observedStream(c.host))
 			})
 		}
 	}
@@ -612,6 +723,47 @@ func (p *protocolError) Error() string {
 	return fmt.Sprintf("gocql: received unexpected frame on stream %d: %v", p.frame.Header().stream, p.frame)
 }
 
+// watchStalls closes the connection once it received nothing for
+// stallTimeout while requests were in flight.
+func (c *Conn) watchStalls(ctx context.Context, stallTimeout time.Duration) {
+	interval := stallTimeout / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// since is when requests were first seen in flight without the
+	// connection receiving anything since responded.
+	var (
+		responded int64
+		since     time.Time
+	)
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+
+		if c.inFlightStreams() == 0 {
+			since = time.Time{}
+			continue
+		}
+		if r := atomic.LoadInt64(&c.responded); since.IsZero() || r != responded {
+			responded, since = r, now
+			continue
+		}
+		if now.Sub(since) >= stallTimeout {
+			c.logger.Printf("gocql: closing connection to %s which received nothing for %v with %d requests in flight\n",
+				c.addr, now.Sub(since), c.inFlightStreams())
+			c.closeWithError(ErrConnStalled)
+			return
+		}
+	}
+}
+
 func (c *Conn) heartBeat(ctx context.Context) {
 	sleepTime := 1 * time.Second
 	timer := time.NewTimer(sleepTime)
@@ -675,6 +827,7 @@ func (c *Conn) recv(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt64(&c.responded, headEndTime.UnixNano())
 
 	if c.frameObserver != nil {
 		c.frameObserver.ObserveFrameHeader(context.Background(), ObservedFrameHeader{
@@ -693,16 +846,17 @@ func (c *Conn) recv(ctx context.Context) error {
 		return fmt.Errorf("gocql: frame header stream is beyond call expected bounds: %d", head.stream)
 	} else if head.stream == -1 {
 		// TODO: handle cassandra event frames, we shouldnt get any currently
-		framer := newFramer(c.compressor, c.version)
+		framer := c.newFramer()
 		if err := framer.readFrame(c, &head); err != nil {
 			return err
 		}
+		c.observeFrame(head, false, 0)
 		go c.session.handleEvent(framer)
 		return nil
 	} else if head.stream <= 0 {
 		// reserved stream that we dont use, probably due to a protocol error
 		// or a bug in Cassandra, this should be an error, parse it and return.
-		framer := newFramer(c.compressor, c.version)
+		framer := c.newFramer()
 		if err := framer.readFrame(c, &head); err != nil {
 			return err
 		}
@@ -732,9 +886,15 @@ func (c *Conn) recv(ctx context.Context) error {
 		panic(fmt.Sprintf("call has incorrect streamID: got %d expected %d", call.streamID, head.stream))
 	}
 
-	framer := newFramer(c.compressor, c.version)
+	framer := c.newFramer()
 
 	err = framer.readFrame(c, &head)
+	if err == nil && c.version == protoVersion5 && !c.segmented && (head.op == opReady || head.op == opAuthenticate) {
+		c.startSegments()
+	}
+	if c.wireObserver != nil && err == nil {
+		c.observeFrame(head, false, time.Since(time.Unix(0, atomic.LoadInt64(&call.enqueued))))
+	}
 	if err != nil {
 		// only net errors should cause the connection to be closed. Though
 		// cassandra returning corrupt frames will be returned here as well.
@@ -755,22 +915,66 @@ func (c *Conn) recv(ctx context.Context) error {
 	return nil
 }
 
+// newFramer returns a framer for a frame written to or read from the connection.
+func (c *Conn) newFramer() *framer {
+	if c.segmented {
+		return newFramer(nil, c.version)
+	}
+	return newFramer(c.compressor, c.version)
+}
+
+// startSegments makes the connection read and write the frames following the
+// READY or AUTHENTICATE response to the STARTUP request in protocol v5
+// segments, which includes the authentication exchange.
+func (c *Conn) startSegments() {
+	compressor, _ := c.compressor.(SegmentCompressor)
+	c.r = &segmentReader{r: c.r, compressor: compressor}
+	c.segmented = true
+}
+
+// segments returns the segments carrying frame, or frame itself if the
+// connection does not use segments.
+func (c *Conn) segments(frame []byte) ([]byte, error) {
+	if !c.segmented {
+		return frame, nil
+	}
+	compressor, _ := c.compressor.(SegmentCompressor)
+	return appendFrameSegments(nil, frame, compressor, c.cfg.MinCompressSize)
+}
+
 func (c *Conn) releaseStream(call *callReq) {
-	if call.timer != nil {
-		call.timer.Stop()
+	if c.timers != nil {
+		c.timers.stop(&call.timer)
 	}
 
 	c.streams.Clear(call.streamID)
 
 	if call.streamObserverContext != nil {
 		call.streamObserverEndOnce.Do(func() {
-			call.streamObserverContext.StreamFinished(ObservedStream{
-				Host: c.host,
-			})
+			call.streamObserverContext.StreamFinished(call.observedStream(c.host))
 		})
 	}
 }
 
+// observeFrame reports a frame written or read with head to the wire observer.
+func (c *Conn) observeFrame(head frameHeader, request bool, latency time.Duration) {
+	if c.wireObserver == nil {
+		return
+	}
+	c.wireObserver.ObserveFrame(context.Background(), ObservedFrame{
+		Host:       c.host,
+		Request:    request,
+		Version:    protoVersion(head.version),
+		Flags:      head.flags,
+		Stream:     int16(head.stream),
+		Opcode:     frameOp(head.op),
+		Length:     int32(head.length),
+		Compressed: head.flags&flagCompress == flagCompress,
+		Time:       time.Now(),
+		Latency:    latency,
+	})
+}
+
 func (c *Conn) handleTimeout() {
 	if TimeoutLimit > 0 && atomic.AddInt64(&c.timeouts, 1) > TimeoutLimit {
 		c.closeWithError(ErrTooManyTimeouts)
@@ -783,7 +987,7 @@ type callReq struct {
 	timeout  chan struct{} // indicates to recv() that a call has timed out
 	streamID int           // current stream in use
 
-	timer *time.Timer
+	timer wheelTimer
 
 	// streamObserverContext is notified about events regarding this stream
 	streamObserverContext StreamObserverContext
@@ -791,6 +995,26 @@ type callReq struct {
 	// streamObserverEndOnce ensures that either StreamAbandoned or StreamFinished is called,
 	// but not both.
 	streamObserverEndOnce sync.Once
+
+	// inFlight and frameSize are reported to streamObserverContext.
+	inFlight  int
+	frameSize int
+	// writeQueueTime is accessed atomically as the response might be received
+	// before exec records it.
+	writeQueueTime int64
+	// enqueued is the time in nanoseconds the request was queued for writing,
+	// recorded only when a FrameObserver is set.
+	enqueued int64
+}
+
+// observedStream returns the ObservedStream reported to the stream observer of call.
+func (call *callReq) observedStream(host *HostInfo) ObservedStream {
+	return ObservedStream{
+		Host:           host,
+		InFlight:       call.inFlight,
+		FrameSize:      call.frameSize,
+		WriteQueueTime: time.Duration(atomic.LoadInt64(&call.writeQueueTime)),
+	}
 }
 
 type callResp struct {
@@ -823,6 +1047,9 @@ type deadlineWriter interface {
 type deadlineContextWriter struct {
 	w       deadlineWriter
 	timeout time.Duration
+	// deadline reports whether a write deadline is set, it is protected by
+	// semaphore.
+	deadline bool
 	// semaphore protects critical section for SetWriteDeadline/Write.
 	// It is a channel with capacity 1.
 	semaphore chan struct{}
@@ -847,15 +1074,31 @@ func (c *deadlineContextWriter) writeContext(ctx context.Context, p []byte) (int
 		<-c.semaphore
 	}()
 
-	if c.timeout > 0 {
-		err := c.w.SetWriteDeadline(time.Now().Add(c.timeout))
-		if err != nil {
-			return 0, err
-		}
+	timeout := c.timeout
+	if d, ok := WriteTimeoutFromContext(ctx); ok {
+		timeout = d
+	}
+	if err := setWriteTimeout(c.w, timeout, &c.deadline); err != nil {
+		return 0, err
 	}
 	return c.w.Write(p)
 }
 
+// setWriteTimeout sets the write deadline of w to timeout from now, or clears
+// the deadline set by a previous write, which is tracked by deadline, if
+// timeout is not positive.
+func setWriteTimeout(w deadlineWriter, timeout time.Duration, deadline *bool) error {
+	if timeout > 0 {
+		*deadline = true
+		return w.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	if *deadline {
+		*deadline = false
+		return w.SetWriteDeadline(time.Time{})
+	}
+	return nil
+}
+
 func newWriteCoalescer(conn deadlineWriter, writeTimeout, coalesceDuration time.Duration,
 	quit <-chan struct{}) *writeCoalescer {
 	wc := &writeCoalescer{
@@ -877,6 +1120,13 @@ type writeCoalescer struct {
 	writeCh chan writeRequest
 
 	timeout time.Duration
+	// deadline reports whether a write deadline is set, it is only used by
+	// the flusher.
+	deadline bool
+
+	// fairnessThreshold is the size above which frames are written after the
+	// smaller frames of the same flush, 0 disables reordering.
+	fairnessThreshold int
 
 	testEnqueuedHook func()
 	testFlushedHook  func()
@@ -887,6 +1137,8 @@ type writeRequest struct {
 	resultChan chan<- writeResult
 	// data to write.
 	data []byte
+	// timeout overrides the timeout of the writer if it is not negative.
+	timeout time.Duration
 }
 
 type writeResult struct {
@@ -900,6 +1152,10 @@ func (w *writeCoalescer) writeContext(ctx context.Context, p []byte) (int, error
 	wr := writeRequest{
 		resultChan: resultChan,
 		data:       p,
+		timeout:    -1,
+	}
+	if d, ok := WriteTimeoutFromContext(ctx); ok {
+		wr.timeout = d
 	}
 
 	select {
@@ -935,10 +1191,20 @@ func (w *writeCoalescer) writeFlusherImpl(timerC <-chan time.Time, resetTimer fu
 
 	var buffers net.Buffers
 	var resultChans []chan<- writeResult
+	var timeout time.Duration
 
 	for {
 		select {
 		case req := <-w.writeCh:
+			reqTimeout := w.timeout
+			if req.timeout >= 0 {
+				reqTimeout = req.timeout
+			}
+			if len(buffers) == 0 {
+				timeout = reqTimeout
+			} else {
+				timeout = shorterTimeout(timeout, reqTimeout)
+			}
 			buffers = append(buffers, req.data)
 			resultChans = append(resultChans, req.resultChan)
 			if !running {
@@ -959,7 +1225,7 @@ func (w *writeCoalescer) writeFlusherImpl(timerC <-chan time.Time, resetTimer fu
 			return
 		case <-timerC:
 			running = false
-			w.flush(resultChans, buffers)
+			w.flush(resultChans, buffers, timeout)
 			buffers = nil
 			resultChans = nil
 			if w.testFlushedHook != nil {
@@ -969,19 +1235,29 @@ func (w *writeCoalescer) writeFlusherImpl(timerC <-chan time.Time, resetTimer fu
 	}
 }
 
-func (w *writeCoalescer) flush(resultChans []chan<- writeResult, buffers net.Buffers) {
+// shorterTimeout returns the shorter of the timeouts a and b, which are
+// unlimited if they are not positive.
+func shorterTimeout(a, b time.Duration) time.Duration {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+func (w *writeCoalescer) flush(resultChans []chan<- writeResult, buffers net.Buffers, timeout time.Duration) {
+	if w.fairnessThreshold > 0 {
+		resultChans, buffers = largeWritesLast(resultChans, buffers, w.fairnessThreshold)
+	}
+
 	// Flush everything we have so far.
-	if w.timeout > 0 {
-		err := w.c.SetWriteDeadline(time.Now().Add(w.timeout))
-		if err != nil {
-			for i := range resultChans {
-				resultChans[i] <- writeResult{
-					n:   0,
-					err: err,
-				}
+	if err := setWriteTimeout(w.c, timeout, &w.deadline); err != nil {
+		for i := range resultChans {
+			resultChans[i] <- writeResult{
+				n:   0,
+				err: err,
 			}
-			return
 		}
+		return
 	}
 	// Copy buffers because WriteTo modifies buffers in-place.
 	buffers2 := make(net.Buffers, len(buffers))
@@ -1008,6 +1284,29 @@ func (w *writeCoalescer) flush(resultChans []chan<- writeResult, buffers net.Buf
 	}
 }
 
+// largeWritesLast moves the buffers larger than threshold after the other
+// buffers, preserving the order of the writes otherwise.
+func largeWritesLast(resultChans []chan<- writeResult, buffers net.Buffers, threshold int) ([]chan<- writeResult, net.Buffers) {
+	ordered := make(net.Buffers, 0, len(buffers))
+	orderedChans := make([]chan<- writeResult, 0, len(resultChans))
+	for i := range buffers {
+		if len(buffers[i]) <= threshold {
+			ordered = append(ordered, buffers[i])
+			orderedChans = append(orderedChans, resultChans[i])
+		}
+	}
+	if len(ordered) == len(buffers) {
+		return resultChans, buffers
+	}
+	for i := range buffers {
+		if len(buffers[i]) > threshold {
+			ordered = append(ordered, buffers[i])
+			orderedChans = append(orderedChans, resultChans[i])
+		}
+	}
+	return orderedChans, ordered
+}
+
 // addCall attempts to add a call to c.calls.
 // It fails with error if the connection already started closing or if a call for the given stream
 // already exists.
@@ -1038,7 +1337,10 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 	}
 
 	// resp is basically a waiting semaphore protecting the framer
-	framer := newFramer(c.compressor, c.version)
+	framer := c.newFramer()
+	framer.minCompressSize = c.cfg.MinCompressSize
+	framer.customTypesAsBytes = c.cfg.CustomTypesAsBytes
+	framer.codecs = c.cfg.Codecs
 
 	call := &callReq{
 		timeout:  make(chan struct{}),
@@ -1062,13 +1364,11 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 		framer.trace()
 	}
 
-	if call.streamObserverContext != nil {
-		call.streamObserverContext.StreamStarted(ObservedStream{
-			Host: c.host,
-		})
-	}
-
 	err := req.buildFrame(framer, stream)
+	var wire []byte
+	if err == nil {
+		wire, err = c.segments(framer.buf)
+	}
 	if err != nil {
 		// closeWithError will block waiting for this stream to either receive a response
 		// or for us to timeout.
@@ -1080,13 +1380,29 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 			delete(c.calls, call.streamID)
 		}
 		c.mu.Unlock()
+		// The stream observer was not told the stream started, so it must not
+		// be told it finished either.
+		call.streamObserverContext = nil
 		// We need to release the stream after we remove the call from c.calls, otherwise the existingCall != nil
 		// check above could fail.
 		c.releaseStream(call)
 		return nil, err
 	}
 
-	n, err := c.w.writeContext(ctx, framer.buf)
+	if call.streamObserverContext != nil {
+		call.inFlight = c.inFlightStreams()
+		call.frameSize = len(framer.buf)
+		call.streamObserverContext.StreamStarted(call.observedStream(c.host))
+	}
+
+	enqueued := time.Now()
+	if c.wireObserver != nil {
+		atomic.StoreInt64(&call.enqueued, enqueued.UnixNano())
+	}
+	n, err := c.w.writeContext(ctx, wire)
+	if call.streamObserverContext != nil {
+		atomic.StoreInt64(&call.writeQueueTime, int64(time.Since(enqueued)))
+	}
 	if err != nil {
 		// closeWithError will block waiting for this stream to either receive a response
 		// or for us to timeout, close the timeout chan here. Im not entirely sure
@@ -1114,21 +1430,20 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 		return nil, err
 	}
 
-	var timeoutCh <-chan time.Time
-	if c.timeout > 0 {
-		if call.timer == nil {
-			call.timer = time.NewTimer(0)
-			<-call.timer.C
-		} else {
-			if !call.timer.Stop() {
-				select {
-				case <-call.timer.C:
-				default:
-				}
-			}
+	if c.wireObserver != nil {
+		c.observeFrame(framer.requestHeader(stream), true, 0)
+	}
+
+	timeout := c.timeout
+	if ctx != nil {
+		if d, ok := TimeoutFromContext(ctx); ok {
+			timeout = d
 		}
+	}
 
-		call.timer.Reset(c.timeout)
+	var timeoutCh <-chan struct{}
+	if timeout > 0 {
+		c.timers.schedule(&call.timer, timeout)
 		timeoutCh = call.timer.C
 	}
 
@@ -1180,6 +1495,18 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 type ObservedStream struct {
 	// Host of the connection used to send the stream.
 	Host *HostInfo
+
+	// InFlight is the number of streams in flight on the connection,
+	// including this one, when the stream was started.
+	InFlight int
+
+	// FrameSize is the size in bytes of the request frame.
+	FrameSize int
+
+	// WriteQueueTime is the time from enqueuing the request frame on the
+	// connection until it was written, including the time spent waiting
+	// for frames of other streams to be written. It is zero in StreamStarted.
+	WriteQueueTime time.Duration
 }
 
 // StreamObserver is notified about request/response pairs.
@@ -1232,70 +1559,41 @@ type inflightPrepare struct {
 	done chan struct{}
 	err  error
 
+	// keyspace and stmt are the keyspace the statement is prepared in and
+	// the statement.
+	keyspace string
+	stmt     string
+	// lastUsed is the last time the statement was used, when the prepared
+	// statement cache has a ttl.
+	lastUsed time.Time
+
 	preparedStatment *preparedStatment
 }
 
 func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer) (*preparedStatment, error) {
-	stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, stmt)
-	flight, ok := c.session.stmtsLRU.execIfMissing(stmtCacheKey, func(lru *lru.Cache) *inflightPrepare {
-		flight := &inflightPrepare{
-			done: make(chan struct{}),
+	return c.prepareStatementIn(ctx, c.currentKeyspace, stmt, tracer)
+}
+
+// prepareStatementIn prepares stmt in keyspace, which must be the current
+// keyspace of the connection before protocol version 5.
+func (c *Conn) prepareStatementIn(ctx context.Context, keyspace, stmt string, tracer Tracer) (*preparedStatment, error) {
+	stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), keyspace, stmt)
+	flight, ok := c.session.stmtsLRU.execIfMissing(stmtCacheKey, func() *inflightPrepare {
+		return &inflightPrepare{
+			done:     make(chan struct{}),
+			keyspace: keyspace,
+			stmt:     stmt,
 		}
-		lru.Add(stmtCacheKey, flight)
-		return flight
 	})
 
 	if !ok {
 		go func() {
 			defer close(flight.done)
 
-			prep := &writePrepareFrame{
-				statement: stmt,
-			}
-			if c.version > protoVersion4 {
-				prep.keyspace = c.currentKeyspace
-			}
-
 			// we won the race to do the load, if our context is canceled we shouldnt
 			// stop the load as other callers are waiting for it but this caller should get
 			// their context cancelled error.
-			framer, err := c.exec(c.ctx, prep, tracer)
-			if err != nil {
-				flight.err = err
-				c.session.stmtsLRU.remove(stmtCacheKey)
-				return
-			}
-
-			frame, err := framer.parseFrame()
-			if err != nil {
-				flight.err = err
-				c.session.stmtsLRU.remove(stmtCacheKey)
-				return
-			}
-
-			// TODO(zariel): tidy this up, simplify handling of frame parsing so its not duplicated
-			// everytime we need to parse a frame.
-			if len(framer.traceID) > 0 && tracer != nil {
-				tracer.Trace(framer.traceID)
-			}
-
-			switch x := frame.(type) {
-			case *resultPreparedFrame:
-				flight.preparedStatment = &preparedStatment{
-					// defensively copy as we will recycle the underlying buffer after we
-					// return.
-					id: copyBytes(x.preparedID),
-					// the type info's should _not_ have a reference to the framers read buffer,
-					// therefore we can just copy them directly.
-					request:  x.reqMeta,
-					response: x.respMeta,
-				}
-			case error:
-				flight.err = x
-			default:
-				flight.err = NewErrProtocol("Unknown type in response to prepare frame: %s", x)
-			}
-
+			flight.preparedStatment, flight.err = c.prepare(c.ctx, keyspace, stmt, tracer)
 			if flight.err != nil {
 				c.session.stmtsLRU.remove(stmtCacheKey)
 			}
@@ -1310,19 +1608,79 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 	}
 }
 
-func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues) error {
+// observeUnprepared reports to the UnpreparedObserver of the session that the
+// host replied that the statement with the given id is not prepared.
+func (c *Conn) observeUnprepared(ctx context.Context, keyspace, stmt string, id []byte) {
+	if c.session == nil || c.session.unpreparedObserver == nil {
+		return
+	}
+	c.session.unpreparedObserver.ObserveUnprepared(ctx, ObservedUnprepared{
+		Host:        c.host,
+		Keyspace:    keyspace,
+		Statement:   stmt,
+		StatementID: copyBytes(id),
+	})
+}
+
+// prepare sends a PREPARE request for stmt in keyspace, without using the
+// prepared statement cache.
+func (c *Conn) prepare(ctx context.Context, keyspace, stmt string, tracer Tracer) (*preparedStatment, error) {
+	prep := &writePrepareFrame{
+		statement: stmt,
+	}
+	if c.version > protoVersion4 {
+		prep.keyspace = keyspace
+	}
+
+	framer, err := c.exec(ctx, prep, tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := framer.parseFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO(zariel): tidy this up, simplify handling of frame parsing so its not duplicated
+	// everytime we need to parse a frame.
+	if len(framer.traceID) > 0 && tracer != nil {
+		tracer.Trace(framer.traceID)
+	}
+
+	switch x := frame.(type) {
+	case *resultPreparedFrame:
+		return &preparedStatment{
+			// defensively copy as we will recycle the underlying buffer after we
+			// return.
+			id: copyBytes(x.preparedID),
+			// the type info's should _not_ have a reference to the framers read buffer,
+			// therefore we can just copy them directly.
+			request:  x.reqMeta,
+			response: x.respMeta,
+		}, nil
+	case error:
+		return nil, x
+	default:
+		return nil, NewErrProtocol("Unknown type in response to prepare frame: %s", x)
+	}
+}
+
+func marshalQueryValue(codecs *TypeCodecs, typ TypeInfo, value interface{}, dst *queryValues) error {
 	if named, ok := value.(*namedValue); ok {
 		dst.name = named.name
 		value = named.value
 	}
 
 	if _, ok := value.(unsetColumn); !ok {
-		val, err := Marshal(typ, value)
+		val, err := codecs.Marshal(typ, value)
 		if err != nil {
 			return err
 		}
 
 		dst.value = val
+	} else if typ.Version() < protoVersion4 {
+		return ErrUnsetValueUnsupported
 	} else {
 		dst.isUnset = true
 	}
@@ -1330,7 +1688,9 @@ func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues) error
 	return nil
 }
 
-func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
+func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
+	c.markUsed()
+
 	params := queryParams{
 		consistency: qry.cons,
 	}
@@ -1343,11 +1703,27 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 	if len(qry.pageState) > 0 {
 		params.pagingState = qry.pageState
 	}
-	if qry.pageSize > 0 {
-		params.pageSize = qry.pageSize
+	pageSize := qry.pageSize
+	if qry.adaptivePageSize && pageSize > 0 {
+		pageSize = c.session.pageSizes.pageSize(qry.stmt, pageSize)
+	}
+	if pageSize > 0 {
+		params.pageSize = pageSize
+	}
+
+	stmt, keyspace := qry.stmt, c.currentKeyspace
+	if qry.keyspace != "" {
+		if c.version > protoVersion4 {
+			keyspace = qry.keyspace
+		} else {
+			var err error
+			if stmt, err = qualifyStatement(qry.stmt, qry.keyspace); err != nil {
+				return &Iter{err: err}
+			}
+		}
 	}
 	if c.version > protoVersion4 {
-		params.keyspace = c.currentKeyspace
+		params.keyspace = keyspace
 	}
 
 	var (
@@ -1358,7 +1734,7 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 	if !qry.skipPrepare && qry.shouldPrepare() {
 		// Prepare all DML queries. Other queries can not be prepared.
 		var err error
-		info, err = c.prepareStatement(ctx, qry.stmt, qry.trace)
+		info, err = c.prepareStatementIn(ctx, keyspace, stmt, qry.trace)
 		if err != nil {
 			return &Iter{err: err}
 		}
@@ -1386,17 +1762,27 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 			v := &params.values[i]
 			value := values[i]
 			typ := info.request.columns[i].TypeInfo
-			if err := marshalQueryValue(typ, value, v); err != nil {
+			if err := marshalQueryValue(c.cfg.Codecs, typ, value, v); err != nil {
 				return &Iter{err: err}
 			}
 		}
+		if c.session != nil && c.session.slowQueries != nil {
+			sizes := make([]int, len(params.values))
+			for i, v := range params.values {
+				sizes[i] = len(v.value)
+			}
+			defer func() {
+				iter.valueSizes = sizes
+			}()
+		}
 
 		params.skipMeta = !(c.session.cfg.DisableSkipMetadata || qry.disableSkipMetadata)
 
 		frame = &writeExecuteFrame{
 			preparedID:    info.id,
 			params:        params,
-			customPayload: qry.customPayload,
+			customPayload: qry.payload(),
+			noCompress:    qry.disableCompression,
 		}
 
 		// Set "keyspace" and "table" property in the query if it is present in preparedMetadata
@@ -1406,16 +1792,19 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 		qry.routingInfo.mu.Unlock()
 	} else {
 		frame = &writeQueryFrame{
-			statement:     qry.stmt,
+			statement:     stmt,
 			params:        params,
-			customPayload: qry.customPayload,
+			customPayload: qry.payload(),
+			noCompress:    qry.disableCompression,
 		}
 	}
 
-	framer, err := c.exec(ctx, frame, qry.trace)
+	start := time.Now()
+	framer, err := c.exec(ctx, frame, sampleTracer(qry.trace, qry.traceProbability))
 	if err != nil {
 		return &Iter{err: err}
 	}
+	latency, bodySize := time.Since(start), len(framer.buf)
 
 	resp, err := framer.parseFrame()
 	if err != nil {
@@ -1431,9 +1820,10 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 		return &Iter{framer: framer}
 	case *resultRowsFrame:
 		iter := &Iter{
-			meta:    x.meta,
-			framer:  framer,
-			numRows: x.numRows,
+			meta:           x.meta,
+			framer:         framer,
+			numRows:        x.numRows,
+			rowErrorPolicy: qry.rowErrorPolicy,
 		}
 
 		if params.skipMeta {
@@ -1447,11 +1837,20 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 			iter.meta = x.meta
 		}
 
+		if qry.adaptivePageSize && pageSize > 0 {
+			if x.numRows < pageSize {
+				latency = 0
+			}
+			c.session.pageSizes.observe(qry.stmt, x.numRows, bodySize, latency)
+		}
+
 		if x.meta.morePages() && !qry.disableAutoPage {
 			newQry := new(Query)
 			*newQry = *qry
 			newQry.pageState = copyBytes(x.meta.pagingState)
+			newQry.page = qry.page + 1
 			newQry.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
+			newQry.failedHosts = nil
 
 			iter.next = &nextIter{
 				qry: newQry,
@@ -1477,8 +1876,9 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 		// is not consistent with regards to its schema.
 		return iter
 	case *RequestErrUnprepared:
-		stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, qry.stmt)
+		stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), keyspace, stmt)
 		c.session.stmtsLRU.evictPreparedID(stmtCacheKey, x.StatementId)
+		c.observeUnprepared(ctx, keyspace, stmt, x.StatementId)
 		return c.executeQuery(ctx, qry)
 	case error:
 		return &Iter{err: x, framer: framer}
@@ -1511,8 +1911,54 @@ func (c *Conn) AvailableStreams() int {
 	return c.streams.Available()
 }
 
+// inFlightStreams returns the number of streams in use on the connection.
+func (c *Conn) inFlightStreams() int {
+	// stream 0 is reserved and not counted as available.
+	return c.streams.NumStreams - c.streams.Available() - 1
+}
+
+// markUsed records that the connection executes a query or batch.
+func (c *Conn) markUsed() {
+	atomic.StoreInt64(&c.used, time.Now().UnixNano())
+}
+
+// lastUsed returns when the connection last executed a query or batch, or when
+// it was established if it never did.
+func (c *Conn) lastUsed() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.used))
+}
+
+// lastResponse returns when the connection last received a frame from the
+// server, or when it was established if it never did.
+func (c *Conn) lastResponse() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.responded))
+}
+
+// ping sends an OPTIONS request to verify that the server still answers on
+// the connection.
+func (c *Conn) ping(ctx context.Context) error {
+	framer, err := c.exec(ctx, &writeOptionsFrame{}, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := framer.parseFrame()
+	if err != nil {
+		return err
+	}
+
+	switch v := resp.(type) {
+	case *supportedFrame:
+		return nil
+	case error:
+		return v
+	default:
+		return NewErrProtocol("unknown frame in response to options: %T", resp)
+	}
+}
+
 func (c *Conn) UseKeyspace(keyspace string) error {
-	q := &writeQueryFrame{statement: `USE "` + keyspace + `"`}
+	q := &writeQueryFrame{statement: "USE " + QuoteIdentifier(keyspace)}
 	q.params.consistency = c.session.cons
 
 	framer, err := c.exec(c.ctx, q, nil)
@@ -1538,7 +1984,9 @@ func (c *Conn) UseKeyspace(keyspace string) error {
 	return nil
 }
 
-func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
+func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
+	c.markUsed()
+
 	if c.version == protoVersion1 {
 		return &Iter{err: ErrUnsupported}
 	}
@@ -1551,11 +1999,22 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
 		serialConsistency:     batch.serialCons,
 		defaultTimestamp:      batch.defaultTimestamp,
 		defaultTimestampValue: batch.defaultTimestampValue,
-		customPayload:         batch.CustomPayload,
+		customPayload:         proxyExecutePayload(batch.CustomPayload, batch.executeAs),
+		noCompress:            batch.disableCompression,
 	}
 
 	stmts := make(map[string]string, len(batch.Entries))
 
+	var valueSizes [][]int
+	if batch.observer != nil {
+		valueSizes = make([][]int, n)
+		defer func() {
+			if iter.batchValueSizes == nil {
+				iter.batchValueSizes = valueSizes
+			}
+		}()
+	}
+
 	for i := 0; i < n; i++ {
 		entry := &batch.Entries[i]
 		b := &req.statements[i]
@@ -1594,16 +2053,23 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
 				v := &b.values[j]
 				value := values[j]
 				typ := info.request.columns[j].TypeInfo
-				if err := marshalQueryValue(typ, value, v); err != nil {
+				if err := marshalQueryValue(c.cfg.Codecs, typ, value, v); err != nil {
 					return &Iter{err: err}
 				}
 			}
+			if valueSizes != nil {
+				sizes := make([]int, len(b.values))
+				for j, v := range b.values {
+					sizes[j] = len(v.value)
+				}
+				valueSizes[i] = sizes
+			}
 		} else {
 			b.statement = entry.Stmt
 		}
 	}
 
-	framer, err := c.exec(batch.Context(), req, batch.trace)
+	framer, err := c.exec(batch.Context(), req, sampleTracer(batch.trace, batch.traceProbability))
 	if err != nil {
 		return &Iter{err: err}
 	}
@@ -1625,6 +2091,7 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
 		if found {
 			key := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, stmt)
 			c.session.stmtsLRU.evictPreparedID(key, x.StatementId)
+			c.observeUnprepared(ctx, c.currentKeyspace, stmt, x.StatementId)
 		}
 		return c.executeBatch(ctx, batch)
 	case *resultRowsFrame:
@@ -1692,6 +2159,22 @@ func (c *Conn) awaitSchemaAgreement(ctx context.Context) (err error) {
 	var versions map[string]struct{}
 	var schemaVersion string
 
+	if observer := c.session.metadataObserver; observer != nil {
+		start := time.Now()
+		defer func() {
+			observed := ObservedSchemaAgreement{
+				Host:  c.host,
+				Start: start,
+				End:   time.Now(),
+				Err:   err,
+			}
+			for version := range versions {
+				observed.Versions = append(observed.Versions, version)
+			}
+			observer.ObserveSchemaAgreement(ctx, observed)
+		}()
+	}
+
 	endDeadline := time.Now().Add(c.session.cfg.MaxWaitSchemaAgreement)
 
 	for time.Now().Before(endDeadline) {
@@ -1762,4 +2245,10 @@ var (
 	ErrTooManyTimeouts   = errors.New("gocql: too many query timeouts on the connection")
 	ErrConnectionClosed  = errors.New("gocql: connection closed waiting for response")
 	ErrNoStreams         = errors.New("gocql: no streams available on connection")
+	// ErrConnStalled closes the connections which received nothing for
+	// ClusterConfig.ConnStallTimeout while requests were in flight.
+	ErrConnStalled = errors.New("gocql: connection stalled with requests in flight")
+	// ErrUnsetValueUnsupported is returned when UnsetValue is bound with a
+	// protocol version lower than 4.
+	ErrUnsetValueUnsupported = errors.New("gocql: UnsetValue requires protocol version 4 or later")
 )
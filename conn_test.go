@@ -40,6 +40,7 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -75,6 +76,36 @@ func TestApprove(t *testing.T) {
 	}
 }
 
+func TestPasswordAuthenticatorCredentialsProvider(t *testing.T) {
+	const class = "org.apache.cassandra.auth.PasswordAuthenticator"
+	rotation := 0
+	auth := PasswordAuthenticator{
+		Username: "static",
+		Password: "static",
+		CredentialsProvider: CredentialsProviderFunc(func() (string, string, error) {
+			rotation++
+			return "cassandra", fmt.Sprintf("secret%d", rotation), nil
+		}),
+	}
+
+	for _, expected := range []string{"\x00cassandra\x00secret1", "\x00cassandra\x00secret2"} {
+		resp, _, err := auth.Challenge([]byte(class))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp) != expected {
+			t.Errorf("expected response %q, got %q", expected, resp)
+		}
+	}
+
+	auth.CredentialsProvider = CredentialsProviderFunc(func() (string, string, error) {
+		return "", "", errors.New("secret store unavailable")
+	})
+	if _, _, err := auth.Challenge([]byte(class)); err == nil {
+		t.Error("expected the error of the credentials provider")
+	}
+}
+
 func TestJoinHostPort(t *testing.T) {
 	tests := map[string]string{
 		"127.0.0.1:0": JoinHostPort("127.0.0.1", 0),
@@ -111,6 +142,88 @@ func TestSimple(t *testing.T) {
 	}
 }
 
+func TestSimpleSegments(t *testing.T) {
+	srv := NewTestServer(t, protoVersion5, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(protoVersion5, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := db.Query("void").Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a statement larger than a segment is split across several
+	if err := db.Query("void " + strings.Repeat("x", maxSegmentPayloadSize)).Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSegmentsAuthenticate(t *testing.T) {
+	srv := NewTestServer(t, protoVersion5, context.Background())
+	defer srv.Stop()
+	srv.mu.Lock()
+	srv.authenticator = "org.apache.cassandra.auth.PasswordAuthenticator"
+	srv.mu.Unlock()
+
+	// the authentication exchange follows the AUTHENTICATE response in
+	// segments
+	cluster := testCluster(protoVersion5, srv.Address)
+	cluster.Authenticator = PasswordAuthenticator{Username: "user", Password: "pass"}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingAuthenticator fails the authentication once the node accepted it,
+// counting the challengers closed.
+type failingAuthenticator struct {
+	closed *int32
+}
+
+func (a failingAuthenticator) Challenge(req []byte) ([]byte, Authenticator, error) {
+	return nil, a, nil
+}
+
+func (a failingAuthenticator) Success(data []byte) error {
+	return errors.New("unexpected success")
+}
+
+func (a failingAuthenticator) Close() error {
+	atomic.AddInt32(a.closed, 1)
+	return nil
+}
+
+func TestAuthenticatorClosed(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+	srv.mu.Lock()
+	srv.authenticator = "org.apache.cassandra.auth.PasswordAuthenticator"
+	srv.mu.Unlock()
+
+	var closed int32
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Authenticator = failingAuthenticator{closed: &closed}
+	if db, err := cluster.CreateSession(); err == nil {
+		db.Close()
+		t.Fatal("expected the authentication to fail")
+	}
+	if atomic.LoadInt32(&closed) == 0 {
+		t.Fatal("expected the challenger to be closed once the authentication failed")
+	}
+}
+
 func TestSSLSimple(t *testing.T) {
 	srv := NewSSLTestServer(t, defaultProto, context.Background())
 	defer srv.Stop()
@@ -139,6 +252,147 @@ func TestSSLSimpleNoClientCert(t *testing.T) {
 	}
 }
 
+type recordingConnectObserver struct {
+	mu       sync.Mutex
+	observed []ObservedConnect
+}
+
+func (r *recordingConnectObserver) ObserveConnect(o ObservedConnect) {
+	r.mu.Lock()
+	r.observed = append(r.observed, o)
+	r.mu.Unlock()
+}
+
+func TestSSLConnectionState(t *testing.T) {
+	srv := NewSSLTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	observer := &recordingConnectObserver{}
+	cluster := createTestSslCluster(srv.Address, defaultProto, true)
+	cluster.ConnectObserver = observer
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("0x%x: NewCluster: %v", defaultProto, err)
+	}
+	defer db.Close()
+
+	state := db.GetHosts()[0].TLSConnectionState()
+	if state == nil {
+		t.Fatal("expected the host to report the TLS connection state")
+	}
+	if !state.HandshakeComplete || state.Version == 0 || len(state.PeerCertificates) == 0 {
+		t.Errorf("unexpected TLS connection state: %+v", state)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.observed) == 0 {
+		t.Fatal("expected connections to be observed")
+	}
+	for _, o := range observer.observed {
+		if o.Err == nil && o.TLS == nil {
+			t.Errorf("expected the TLS connection state to be observed for %v", o.Host)
+		}
+	}
+}
+
+func TestUnixSocketContactPoint(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	dir, err := ioutil.TempDir("", "gocql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// forward the connections to the socket to the test server, like a
+	// sidecar proxy would.
+	path := dir + "/cassandra.sock"
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", srv.Address)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	db, err := testCluster(defaultProto, "unix://"+path).CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	hosts := db.GetHosts()
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %v", hosts)
+	}
+	if got := hosts[0].SocketPath(); got != path {
+		t.Errorf("expected socket path %q, got %q", path, got)
+	}
+	if ip := hosts[0].ConnectAddress(); ip != nil {
+		t.Errorf("expected no connect address, got %v", ip)
+	}
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSSLGetConfig(t *testing.T) {
+	srv := NewSSLTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	var calls int32
+	cluster := createTestSslCluster(srv.Address, defaultProto, true)
+	sslOpts := cluster.SslOpts
+	cluster.SslOpts = &SslOptions{
+		GetConfig: func(ctx context.Context, host *HostInfo) (*tls.Config, error) {
+			atomic.AddInt32(&calls, 1)
+			// re-read the certificates like a rotation would
+			return setupTLSConfig(sslOpts)
+		},
+	}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("0x%x: NewCluster: %v", defaultProto, err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n == 0 {
+		t.Error("expected GetConfig to be called for the new connections")
+	}
+
+	cluster.SslOpts = &SslOptions{
+		GetConfig: func(ctx context.Context, host *HostInfo) (*tls.Config, error) {
+			return nil, errors.New("certificate not yet rotated")
+		},
+	}
+	if db, err := cluster.CreateSession(); err == nil {
+		db.Close()
+		t.Fatal("expected the session creation to fail when GetConfig fails")
+	}
+}
+
 func createTestSslCluster(addr string, proto protoVersion, useClientCert bool) *ClusterConfig {
 	cluster := testCluster(proto, addr)
 	sslOpts := &SslOptions{
@@ -402,6 +656,90 @@ func TestQueryRetry(t *testing.T) {
 	}
 }
 
+// fixedLatencySpeculation never executes speculatively and expects every
+// attempt to take latency.
+type fixedLatencySpeculation struct {
+	NonSpeculativeExecution
+	latency time.Duration
+}
+
+func (sp fixedLatencySpeculation) DelayFor(ExecutableQuery, *HostInfo) time.Duration {
+	return 0
+}
+
+func (sp fixedLatencySpeculation) ExpectedLatency(ExecutableQuery, *HostInfo) (time.Duration, bool) {
+	return sp.latency, true
+}
+
+func TestQueryRetryDeadlineTooShort(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// an attempt expected to take an hour is not retried before the deadline
+	qry := db.Query("kill").RetryPolicy(&testRetryPolicy{NumRetries: 5}).
+		SetSpeculativeExecutionPolicy(fixedLatencySpeculation{latency: time.Hour}).WithContext(ctx)
+	err = qry.Exec()
+	var tooShort *DeadlineTooShortError
+	if !errors.As(err, &tooShort) || !errors.Is(err, ErrDeadlineTooShort) {
+		t.Fatalf("expected %v, got %v", ErrDeadlineTooShort, err)
+	}
+	if tooShort.Expected != time.Hour || tooShort.Remaining > time.Minute {
+		t.Fatalf("expected an hour expected with less than a minute left, got %v", tooShort)
+	}
+	var reqErr RequestError
+	if !errors.As(err, &reqErr) || reqErr.Code() != ErrCodeOverloaded {
+		t.Fatalf("expected the error of the last attempt to be wrapped, got %v", err)
+	}
+	if attempts := qry.Attempts(); attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+
+	// attempts expected to take a millisecond are all retried with a minute left
+	qry = db.Query("kill").RetryPolicy(&testRetryPolicy{NumRetries: 2}).
+		SetSpeculativeExecutionPolicy(fixedLatencySpeculation{latency: time.Millisecond}).WithContext(ctx)
+	err = qry.Exec()
+	if err == nil || errors.Is(err, ErrDeadlineTooShort) {
+		t.Fatalf("expected the error of the last attempt, got %v", err)
+	}
+	if attempts := qry.Attempts(); attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestQueryRetryBudget(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.RetryBudget = &RetryBudgetConfig{MaxTokens: 1}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	qry := db.Query("kill").RetryPolicy(&testRetryPolicy{NumRetries: 5})
+	err = qry.Exec()
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("expected %v, got %v", ErrRetryBudgetExhausted, err)
+	}
+	if attempts := qry.Attempts(); attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+	if stats := db.RetryBudgetStats(); stats.Retries != 1 || stats.Shed != 1 {
+		t.Fatalf("expected 1 retry allowed and 1 shed, got %+v", stats)
+	}
+}
+
 func TestQueryMultinodeWithMetrics(t *testing.T) {
 	log := &testLogger{}
 	defer func() {
@@ -466,6 +804,212 @@ func TestQueryMultinodeWithMetrics(t *testing.T) {
 
 }
 
+// testTransport only implements Transport so that it is wrapped by the driver.
+type testTransport struct {
+	conn net.Conn
+}
+
+func (t *testTransport) Read(b []byte) (int, error)         { return t.conn.Read(b) }
+func (t *testTransport) Write(b []byte) (int, error)        { return t.conn.Write(b) }
+func (t *testTransport) Close() error                       { return t.conn.Close() }
+func (t *testTransport) SetReadDeadline(d time.Time) error  { return t.conn.SetReadDeadline(d) }
+func (t *testTransport) SetWriteDeadline(d time.Time) error { return t.conn.SetWriteDeadline(d) }
+
+type testTransportFactory struct {
+	addr    string
+	created int32
+}
+
+func (f *testTransportFactory) NewTransport(ctx context.Context, host *HostInfo) (Transport, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", f.addr)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&f.created, 1)
+	return &testTransport{conn: conn}, nil
+}
+
+func TestTransportFactory(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	factory := &testTransportFactory{addr: srv.Address}
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.TransportFactory = factory
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if atomic.LoadInt32(&factory.created) == 0 {
+		t.Fatal("expected connections to use transports of the factory")
+	}
+}
+
+func TestMaxRequestsPerHost(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.MaxRequestsPerHost = 1
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	pool, ok := db.pool.getPool(db.GetHosts()[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+
+	// occupy the only request slot of the host with a query that never completes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go db.Query("timeout").WithContext(ctx).Exec()
+	for len(pool.requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := db.Query("void").Exec(); !errors.Is(err, ErrHostOverloaded) {
+		t.Fatalf("expected ErrHostOverloaded, got %v", err)
+	}
+
+	// with a queue timeout the query waits for the slot to be released
+	db.cfg.MaxRequestsPerHostQueueTimeout = 5 * time.Second
+	errs := make(chan error, 1)
+	go func() {
+		errs <- db.Query("void").Exec()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-errs; err != nil {
+		t.Fatalf("expected queued query to succeed, got %v", err)
+	}
+}
+
+func TestQuerySetHost(t *testing.T) {
+	var nodes []*TestServer
+	var addresses = []string{
+		"127.0.0.1",
+		"127.0.0.2",
+		"127.0.0.3",
+	}
+	ctx := context.Background()
+	for _, ip := range addresses {
+		srv := NewTestServerWithAddress(ip+":0", t, defaultProto, ctx)
+		defer srv.Stop()
+		nodes = append(nodes, srv)
+	}
+
+	db, err := newTestSession(defaultProto, nodes[0].Address, nodes[1].Address, nodes[2].Address)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	var target *HostInfo
+	for _, host := range db.GetHosts() {
+		if host.ConnectAddress().Equal(net.ParseIP(addresses[1])) {
+			target = host
+		}
+	}
+	if target == nil {
+		t.Fatalf("host %s not found in session hosts", addresses[1])
+	}
+
+	rt := &SimpleRetryPolicy{NumRetries: 3}
+	qry := db.Query("kill").RetryPolicy(rt).SetHost(target)
+	for i := 0; i < 5; i++ {
+		if err := qry.Exec(); err == nil {
+			t.Fatalf("expected error")
+		}
+	}
+
+	for i, node := range nodes {
+		requests := atomic.LoadInt64(&node.nKillReq)
+		if i == 1 && requests != 5 {
+			// RetryNextHost ends the retries, there is no other host to try
+			t.Fatalf("expected pinned host %v to receive 5 requests, got %d", addresses[i], requests)
+		} else if i != 1 && requests != 0 {
+			t.Fatalf("expected host %v to receive no requests, got %d", addresses[i], requests)
+		}
+	}
+
+	// the retries on the same host are sent to the pinned host
+	if err := db.Query("kill").RetryPolicy(&testRetryPolicy{NumRetries: 3}).SetHost(target).Exec(); err == nil {
+		t.Fatalf("expected error")
+	}
+	if requests := atomic.LoadInt64(&nodes[1].nKillReq); requests != 9 {
+		t.Fatalf("expected pinned host %v to receive 9 requests, got %d", addresses[1], requests)
+	}
+}
+
+func TestQuerySetConn(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 4
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	iter := db.Query("void").Iter()
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	conn := iter.Conn()
+	if conn == nil {
+		t.Fatal("expected the iter to have the connection of the query")
+	}
+
+	for i := 0; i < 10; i++ {
+		iter := db.Query("void").SetConn(conn).Iter()
+		if err := iter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if iter.Conn() != conn {
+			t.Fatalf("expected the query to be executed on the pinned connection %v, got %v", conn, iter.Conn())
+		}
+	}
+
+	// the following pages are read on the pinned connection too
+	qry := db.Query("pages").PageSize(3).SetConn(conn)
+	if qry.GetConn() != conn || qry.GetHost() == nil {
+		t.Fatal("expected the query to be pinned to the connection and its host")
+	}
+	iter = qry.Iter()
+	var rows, v int
+	for iter.Scan(&v) {
+		rows++
+		if iter.Conn() != conn {
+			t.Fatalf("expected the page to be read on the pinned connection, got %v", iter.Conn())
+		}
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 10 {
+		t.Fatalf("expected 10 rows, got %d", rows)
+	}
+
+	// the query is not executed on another connection of the host
+	conn.Close()
+	if err := db.Query("void").SetConn(conn).Exec(); err != ErrConnectionClosed {
+		t.Fatalf("expected %v, got %v", ErrConnectionClosed, err)
+	}
+	if qry := db.Query("void").SetConn(conn).SetHost(nil); qry.GetConn() != nil || qry.GetHost() != nil {
+		t.Fatal("expected SetHost to unpin the connection")
+	}
+}
+
 type testRetryPolicy struct {
 	NumRetries int
 }
@@ -659,88 +1203,444 @@ func TestQueryTimeoutClose(t *testing.T) {
 	srv := NewTestServer(t, defaultProto, context.Background())
 	defer srv.Stop()
 
-	cluster := testCluster(defaultProto, srv.Address)
-	// Set the timeout arbitrarily low so that the query hits the timeout in a
-	// timely manner.
-	cluster.Timeout = 1000 * time.Millisecond
-	cluster.NumConns = 1
-
+	cluster := testCluster(defaultProto, srv.Address)
+	// Set the timeout arbitrarily low so that the query hits the timeout in a
+	// timely manner.
+	cluster.Timeout = 1000 * time.Millisecond
+	cluster.NumConns = 1
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+
+	ch := make(chan error)
+	go func() {
+		err := db.Query("timeout").Exec()
+		ch <- err
+	}()
+	// ensure that the above goroutine gets sheduled
+	time.Sleep(50 * time.Millisecond)
+
+	db.Close()
+	select {
+	case err = <-ch:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timedout waiting to get a response once cluster is closed")
+	}
+
+	if err != ErrConnectionClosed {
+		t.Fatalf("expected to get %v got %v", ErrConnectionClosed, err)
+	}
+}
+
+func TestConnStallWatchdog(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.ConnStallTimeout = 100 * time.Millisecond
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pool, ok := db.pool.getPool(db.GetHosts()[0])
+	if !ok {
+		t.Fatal("no pool")
+	}
+	conn := pool.Pick()
+
+	// an idle connection is not stalled
+	time.Sleep(3 * cluster.ConnStallTimeout)
+	if conn.Closed() {
+		t.Fatal("expected the idle connection to remain open")
+	}
+
+	// the server never replies, so the stream of the abandoned request stays in flight
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := db.Query("timeout").WithContext(ctx).Exec(); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !conn.Closed() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the stalled connection to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStream0(t *testing.T) {
+	// TODO: replace this with type check
+	const expErr = "gocql: received unexpected frame on stream 0"
+
+	var buf bytes.Buffer
+	f := newFramer(nil, protoVersion4)
+	f.writeHeader(0, opResult, 0)
+	f.writeInt(resultKindVoid)
+	f.buf[0] |= 0x80
+	if err := f.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &Conn{
+		r:       bufio.NewReader(&buf),
+		streams: streams.New(protoVersion4),
+		logger:  &defaultLogger{},
+	}
+
+	err := conn.recv(context.Background())
+	if err == nil {
+		t.Fatal("expected to get an error on stream 0")
+	} else if !strings.HasPrefix(err.Error(), expErr) {
+		t.Fatalf("expected to get error prefix %q got %q", expErr, err.Error())
+	}
+}
+
+func TestContext_Timeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Timeout = 5 * time.Second
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel = context.WithCancel(ctx)
+	cancel()
+
+	err = db.Query("timeout").WithContext(ctx).Exec()
+	if err != context.Canceled {
+		t.Fatalf("expected to get context cancel error: %v got %v", context.Canceled, err)
+	}
+}
+
+func TestContext_Overrides(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Timeout = 5 * time.Second
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := WithConsistency(context.Background(), LocalQuorum)
+	qry := db.Query("void").Consistency(One).WithContext(ctx)
+	if err := qry.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := qry.WithContext(context.Background()).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	consistencies := srv.consistencies
+	srv.mu.Unlock()
+	if !reflect.DeepEqual(consistencies, []Consistency{LocalQuorum, One}) {
+		t.Fatalf("expected the override to apply to the first execution only, got %v", consistencies)
+	}
+	if cons := qry.GetConsistency(); cons != One {
+		t.Fatalf("expected the consistency of the query to be left at %v, got %v", One, cons)
+	}
+
+	batch := db.NewBatch(UnloggedBatch).WithContext(ctx)
+	batch.SetConsistency(One)
+	batch.Query("void")
+	if err := db.ExecuteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if cons := batch.GetConsistency(); cons != One {
+		t.Fatalf("expected the consistency of the batch to be left at %v, got %v", One, cons)
+	}
+
+	ctx = WithTimeout(context.Background(), 10*time.Millisecond)
+	start := time.Now()
+	err = db.Query("timeout").RetryPolicy(nil).WithContext(ctx).Exec()
+	if err != ErrTimeoutNoResponse {
+		t.Fatalf("expected %v, got %v", ErrTimeoutNoResponse, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the timeout of the context to be used, took %v", elapsed)
+	}
+}
+
+// testTraceID is the trace id the test server answers traced queries with.
+var testTraceID = []byte{0: 1, 15: 2}
+
+type traceIDObserver struct {
+	mu       sync.Mutex
+	traceIDs [][]byte
+}
+
+func (o *traceIDObserver) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	o.mu.Lock()
+	o.traceIDs = append(o.traceIDs, q.TraceID)
+	o.mu.Unlock()
+}
+
+func TestSessionEffectiveConfig(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c := db.EffectiveConfig()
+	if got, want := c.Settings["ProtoVersion"], fmt.Sprint(defaultProto); got != want {
+		t.Errorf("ProtoVersion: got %q, want %q", got, want)
+	}
+	if got, want := c.Settings["PoolConfig.HostSelectionPolicy"], "*gocql.roundRobinHostPolicy"; got != want {
+		t.Errorf("PoolConfig.HostSelectionPolicy: got %q, want %q", got, want)
+	}
+}
+
+func TestQueryTraceProbability(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	observer := &traceIDObserver{}
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.TraceProbability = 1
+	cluster.QueryObserver = observer
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, qry := range []*Query{
+		db.Query("traced"),
+		db.Query("traced").TraceProbability(0),
+	} {
+		if err := qry.Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if expected := [][]byte{testTraceID, nil}; !reflect.DeepEqual(observer.traceIDs, expected) {
+		t.Fatalf("expected trace ids %v, got %v", expected, observer.traceIDs)
+	}
+}
+
+func TestQuerySetKeyspace(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		stmts []string
+	)
+	srv := newTestServerOpts{
+		addr:     "127.0.0.1:0",
+		protocol: defaultProto,
+		recvHook: func(f *framer) {
+			if f.header.op != opQuery {
+				return
+			}
+			// read from a copy, the server reads the statement afterwards
+			peek := *f
+			stmt := peek.readLongString()
+			mu.Lock()
+			stmts = append(stmts, stmt)
+			mu.Unlock()
+		},
+	}.newServer(t, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	qry := db.Query("SELECT * FROM t").SetKeyspace("ks")
+	qry.skipPrepare = true
+	if err := qry.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if ks := qry.Keyspace(); ks != "ks" {
+		t.Errorf("expected query keyspace ks, got %q", ks)
+	}
+
+	// statements which can not be qualified require protocol version 5
+	if err := db.Query("void").SetKeyspace("ks").Exec(); err == nil {
+		t.Error("expected unqualifiable statement to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{`SELECT * FROM "ks".t`}; !reflect.DeepEqual(stmts, expected) {
+		t.Fatalf("expected statements %q, got %q", expected, stmts)
+	}
+}
+
+func TestQueryExecuteAs(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		users []string
+	)
+	srv := newTestServerOpts{
+		addr:     "127.0.0.1:0",
+		protocol: protoVersion4,
+		recvHook: func(f *framer) {
+			if f.header.op != opQuery {
+				return
+			}
+			var user string
+			if f.header.flags&flagCustomPayload == flagCustomPayload {
+				user = string(f.readBytesMap()[proxyExecuteKey])
+			}
+			mu.Lock()
+			users = append(users, user)
+			mu.Unlock()
+		},
+	}.newServer(t, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(protoVersion4, srv.Address)
+	cluster.ExecuteAs = "alice"
 	db, err := cluster.CreateSession()
 	if err != nil {
-		t.Fatalf("NewCluster: %v", err)
+		t.Fatal(err)
 	}
+	defer db.Close()
 
-	ch := make(chan error)
-	go func() {
-		err := db.Query("timeout").Exec()
-		ch <- err
-	}()
-	// ensure that the above goroutine gets sheduled
-	time.Sleep(50 * time.Millisecond)
+	payload := map[string][]byte{"other": []byte("value")}
+	for _, qry := range []*Query{
+		db.Query("void"),
+		db.Query("void").CustomPayload(payload).ExecuteAs("bob"),
+		db.Query("void").ExecuteAs(""),
+	} {
+		if err := qry.Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := payload[proxyExecuteKey]; ok {
+		t.Error("expected the custom payload of the query not to be modified")
+	}
 
-	db.Close()
-	select {
-	case err = <-ch:
-	case <-time.After(1 * time.Second):
-		t.Fatal("timedout waiting to get a response once cluster is closed")
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"alice", "bob", ""}; !reflect.DeepEqual(users, expected) {
+		t.Fatalf("expected the queries to be executed as %q, got %q", expected, users)
 	}
 
-	if err != ErrConnectionClosed {
-		t.Fatalf("expected to get %v got %v", ErrConnectionClosed, err)
+	if batch := db.NewBatch(LoggedBatch); batch.executeAs != "alice" {
+		t.Errorf("expected the batch to be executed as alice, got %q", batch.executeAs)
 	}
 }
 
-func TestStream0(t *testing.T) {
-	// TODO: replace this with type check
-	const expErr = "gocql: received unexpected frame on stream 0"
+func TestStartupOptions(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		opts map[string]string
+	)
+	srv := newTestServerOpts{
+		addr:     "127.0.0.1:0",
+		protocol: defaultProto,
+		recvHook: func(f *framer) {
+			if f.header.op != opStartup {
+				return
+			}
+			m := make(map[string]string)
+			for n := f.readShort(); n > 0; n-- {
+				k := f.readString()
+				m[k] = f.readString()
+			}
+			mu.Lock()
+			opts = m
+			mu.Unlock()
+		},
+	}.newServer(t, context.Background())
+	defer srv.Stop()
 
-	var buf bytes.Buffer
-	f := newFramer(nil, protoVersion4)
-	f.writeHeader(0, opResult, 0)
-	f.writeInt(resultKindVoid)
-	f.buf[0] |= 0x80
-	if err := f.finish(); err != nil {
-		t.Fatal(err)
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.StartupOptions = map[string]string{
+		"DRIVER_NAME":       "custom",
+		"THROW_ON_OVERLOAD": "1",
+		"CQL_VERSION":       "1.0.0",
 	}
-	if err := f.writeTo(&buf); err != nil {
+	cluster.ApplicationName = "app"
+	cluster.ClientID = MustRandomUUID()
+	db, err := cluster.CreateSession()
+	if err != nil {
 		t.Fatal(err)
 	}
+	defer db.Close()
 
-	conn := &Conn{
-		r:       bufio.NewReader(&buf),
-		streams: streams.New(protoVersion4),
-		logger:  &defaultLogger{},
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]string{
+		"APPLICATION_NAME":  "app",
+		"CLIENT_ID":         cluster.ClientID.String(),
+		"CQL_VERSION":       cluster.CQLVersion,
+		"DRIVER_NAME":       "custom",
+		"DRIVER_VERSION":    driverVersion,
+		"THROW_ON_OVERLOAD": "1",
 	}
-
-	err := conn.recv(context.Background())
-	if err == nil {
-		t.Fatal("expected to get an error on stream 0")
-	} else if !strings.HasPrefix(err.Error(), expErr) {
-		t.Fatalf("expected to get error prefix %q got %q", expErr, err.Error())
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("expected startup options %v, got %v", expected, opts)
 	}
 }
 
-func TestContext_Timeout(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	srv := NewTestServer(t, defaultProto, ctx)
+func TestQueryExecutorCheckStale(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
 	defer srv.Stop()
 
 	cluster := testCluster(defaultProto, srv.Address)
-	cluster.Timeout = 5 * time.Second
+	cluster.NumConns = 1
+	cluster.ConnStaleTimeout = time.Minute
 	db, err := cluster.CreateSession()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer db.Close()
 
-	ctx, cancel = context.WithCancel(ctx)
-	cancel()
+	pool, ok := db.pool.getPool(db.GetHosts()[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	conn := pool.Pick()
+	if conn == nil {
+		t.Fatal("no connection in pool")
+	}
 
-	err = db.Query("timeout").WithContext(ctx).Exec()
-	if err != context.Canceled {
-		t.Fatalf("expected to get context cancel error: %v got %v", context.Canceled, err)
+	stale := time.Now().Add(-2 * time.Minute)
+	atomic.StoreInt64(&conn.responded, stale.UnixNano())
+	if err := db.executor.checkStale(context.Background(), conn); err != nil {
+		t.Fatalf("expected stale connection to answer the ping, got %v", err)
+	}
+	if !conn.lastResponse().After(stale) {
+		t.Fatal("expected the ping to refresh the last response time")
+	}
+
+	// a dead connection fails the check and is closed
+	atomic.StoreInt64(&conn.responded, stale.UnixNano())
+	conn.conn.Close()
+	if err := db.executor.checkStale(context.Background(), conn); err == nil {
+		t.Fatal("expected dead connection to fail the check")
+	}
+	if !conn.Closed() {
+		t.Fatal("expected dead connection to be closed")
 	}
 }
 
@@ -908,6 +1808,202 @@ func TestWriteCoalescing(t *testing.T) {
 	}
 }
 
+func TestWriteCoalescing_Fairness(t *testing.T) {
+	var buf bytes.Buffer
+	results := make([]chan writeResult, 3)
+	resultChans := make([]chan<- writeResult, 3)
+	for i := range results {
+		results[i] = make(chan writeResult, 1)
+		resultChans[i] = results[i]
+	}
+
+	w := &writeCoalescer{c: nopDeadlineWriter{&buf}, fairnessThreshold: 4}
+	w.flush(resultChans, net.Buffers{[]byte("large"), []byte("one"), []byte("two")}, w.timeout)
+
+	if got := buf.String(); got != "onetwolarge" {
+		t.Fatalf("expected large frame to be written last, got %q", got)
+	}
+	for i, want := range []int{5, 3, 3} {
+		if res := <-results[i]; res.err != nil || res.n != want {
+			t.Fatalf("write %d: expected %d bytes written, got %d (%v)", i, want, res.n, res.err)
+		}
+	}
+}
+
+type nopDeadlineWriter struct {
+	io.Writer
+}
+
+func (nopDeadlineWriter) SetWriteDeadline(time.Time) error { return nil }
+
+// deadlineRecorder records the write deadlines set on it.
+type deadlineRecorder struct {
+	nopDeadlineWriter
+	mu        sync.Mutex
+	deadlines []time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(t time.Time) error {
+	d.mu.Lock()
+	d.deadlines = append(d.deadlines, t)
+	d.mu.Unlock()
+	return nil
+}
+
+func TestWriteTimeoutFromContext(t *testing.T) {
+	ctx := WithWriteTimeout(context.Background(), time.Second)
+
+	rec := &deadlineRecorder{nopDeadlineWriter: nopDeadlineWriter{ioutil.Discard}}
+	w := &deadlineContextWriter{w: rec, timeout: time.Minute, semaphore: make(chan struct{}, 1)}
+	for _, ctx := range []context.Context{ctx, context.Background(), WithWriteTimeout(ctx, 0)} {
+		if _, err := w.writeContext(ctx, []byte("frame")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rec.deadlines) != 3 {
+		t.Fatalf("expected 3 deadlines to be set, got %v", rec.deadlines)
+	}
+	if d := time.Until(rec.deadlines[0]); d > time.Second {
+		t.Errorf("expected the write deadline of the context, got %v", d)
+	}
+	if d := time.Until(rec.deadlines[1]); d <= time.Second {
+		t.Errorf("expected the write deadline of the writer, got %v", d)
+	}
+	if !rec.deadlines[2].IsZero() {
+		t.Errorf("expected the write deadline to be cleared, got %v", rec.deadlines[2])
+	}
+
+	rec = &deadlineRecorder{nopDeadlineWriter: nopDeadlineWriter{ioutil.Discard}}
+	quit := make(chan struct{})
+	defer close(quit)
+	coalescer := &writeCoalescer{
+		c:       rec,
+		writeCh: make(chan writeRequest),
+		quit:    quit,
+		timeout: time.Minute,
+	}
+	enqueued := make(chan struct{})
+	coalescer.testEnqueuedHook = func() { enqueued <- struct{}{} }
+	timerC := make(chan time.Time, 1)
+	go coalescer.writeFlusherImpl(timerC, func() {})
+
+	results := make(chan error, 2)
+	for _, ctx := range []context.Context{context.Background(), ctx} {
+		go func(ctx context.Context) {
+			_, err := coalescer.writeContext(ctx, []byte("frame"))
+			results <- err
+		}(ctx)
+		<-enqueued
+	}
+	timerC <- time.Now()
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.deadlines) != 1 {
+		t.Fatalf("expected 1 deadline to be set for the coalesced writes, got %v", rec.deadlines)
+	}
+	if d := time.Until(rec.deadlines[0]); d > time.Second {
+		t.Errorf("expected the shortest write deadline of the coalesced writes, got %v", d)
+	}
+}
+
+type recordingStreamObserver struct {
+	mu       sync.Mutex
+	started  int
+	finished []ObservedStream
+}
+
+func (r *recordingStreamObserver) StreamContext(ctx context.Context) StreamObserverContext {
+	return r
+}
+
+func (r *recordingStreamObserver) StreamStarted(observedStream ObservedStream) {
+	r.mu.Lock()
+	r.started++
+	r.mu.Unlock()
+}
+
+func (r *recordingStreamObserver) StreamAbandoned(observedStream ObservedStream) {}
+
+func (r *recordingStreamObserver) StreamFinished(observedStream ObservedStream) {
+	r.mu.Lock()
+	r.finished = append(r.finished, observedStream)
+	r.mu.Unlock()
+}
+
+func TestStreamObserver_QueueMetrics(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	observer := &recordingStreamObserver{}
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.StreamObserver = observer
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.finished) == 0 {
+		t.Fatal("expected finished streams to be observed")
+	}
+	for _, stream := range observer.finished {
+		if stream.InFlight < 1 || stream.FrameSize <= 0 || stream.WriteQueueTime <= 0 {
+			t.Fatalf("expected queueing metrics to be set, got %+v", stream)
+		}
+	}
+}
+
+type failingFrameBuilder struct{}
+
+func (failingFrameBuilder) buildFrame(f *framer, streamID int) error {
+	return errors.New("build failed")
+}
+
+func TestStreamObserver_BuildFrameError(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	observer := &recordingStreamObserver{}
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.StreamObserver = observer
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	conn := db.getConn()
+	if conn == nil {
+		t.Fatal("expected a connection")
+	}
+	observer.mu.Lock()
+	started, finished := observer.started, len(observer.finished)
+	observer.mu.Unlock()
+
+	if _, err := conn.exec(context.Background(), failingFrameBuilder{}, nil); err == nil {
+		t.Fatal("expected the frame to fail to build")
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if observer.started != started || len(observer.finished) != finished {
+		t.Fatalf("expected the stream not to be observed, got %d started and %d finished streams",
+			observer.started-started, len(observer.finished)-finished)
+	}
+}
+
 func TestWriteCoalescing_WriteAfterClose(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -1002,6 +2098,99 @@ func TestFrameHeaderObserver(t *testing.T) {
 	}
 }
 
+type recordingFrameObserver struct {
+	mu     sync.Mutex
+	frames []ObservedFrame
+}
+
+func (r *recordingFrameObserver) ObserveFrame(ctx context.Context, frm ObservedFrame) {
+	r.mu.Lock()
+	r.frames = append(r.frames, frm)
+	r.mu.Unlock()
+}
+
+func (r *recordingFrameObserver) getFrames() []ObservedFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames
+}
+
+func TestFrameObserver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	observer := &recordingFrameObserver{}
+	cluster.FrameObserver = observer
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := observer.getFrames()
+	expFrames := []struct {
+		op      frameOp
+		request bool
+	}{
+		{opOptions, true},
+		{opSupported, false},
+		{opStartup, true},
+		{opReady, false},
+		{opQuery, true},
+		{opResult, false},
+	}
+	if len(frames) != len(expFrames) {
+		t.Fatalf("expected to observe %d frames, instead observed %v", len(expFrames), frames)
+	}
+	for i, exp := range expFrames {
+		if frames[i].Opcode != exp.op || frames[i].Request != exp.request {
+			t.Fatalf("expected frame %d to be %v (request=%v) got %v", i, exp.op, exp.request, frames[i])
+		}
+		if frames[i].Host == nil {
+			t.Fatalf("expected frame %d to have a host", i)
+		}
+	}
+
+	query, result := frames[4], frames[5]
+	if query.Version != protoVersion(defaultProto) || result.Version != protoVersion(defaultProto)|protoDirectionMask {
+		t.Fatalf("unexpected versions: request %v, response %v", query.Version, result.Version)
+	}
+	if query.Stream != result.Stream {
+		t.Fatalf("expected response on stream %d, got %d", query.Stream, result.Stream)
+	}
+	if query.Length == 0 || query.Latency != 0 {
+		t.Fatalf("unexpected request frame %+v", query)
+	}
+	if result.Length != 4 || result.Latency <= 0 || result.Compressed {
+		t.Fatalf("unexpected response frame %+v", result)
+	}
+}
+
+func TestMarshalQueryValueUnset(t *testing.T) {
+	for _, value := range []interface{}{UnsetValue, NamedValue("v", UnsetValue)} {
+		var dst queryValues
+		if err := marshalQueryValue(nil, NativeType{proto: protoVersion4, typ: TypeInt}, value, &dst); err != nil {
+			t.Fatal(err)
+		}
+		if !dst.isUnset || dst.value != nil {
+			t.Errorf("expected %v to be unset, got %+v", value, dst)
+		}
+
+		dst = queryValues{}
+		err := marshalQueryValue(nil, NativeType{proto: protoVersion3, typ: TypeInt}, value, &dst)
+		if err != ErrUnsetValueUnsupported {
+			t.Errorf("expected %v with protocol 3, got %v", ErrUnsetValueUnsupported, err)
+		}
+	}
+}
+
 func NewTestServerWithAddress(addr string, t testing.TB, protocol uint8, ctx context.Context) *TestServer {
 	return newTestServerOpts{
 		addr:     addr,
@@ -1100,6 +2289,8 @@ type TestServer struct {
 	t                testing.TB
 	listen           net.Listener
 	nKillReq         int64
+	nPrepareReq      int64
+	nPageReq         int64
 
 	protocol   byte
 	headerSize int
@@ -1108,9 +2299,16 @@ type TestServer struct {
 
 	mu     sync.Mutex
 	closed bool
+	// batches are the numbers of statements of the batches received.
+	batches []int
+	// consistencies are the consistency levels of the void queries received.
+	consistencies []Consistency
 
 	// onRecv is a hook point for tests, called in receive loop.
 	onRecv func(*framer)
+	// authenticator, if not empty, is the class of the authenticator the
+	// server requires the connections to authenticate with.
+	authenticator string
 }
 
 func (srv *TestServer) closeWatch() {
@@ -1132,8 +2330,12 @@ func (srv *TestServer) serve() {
 
 		go func(conn net.Conn) {
 			defer conn.Close()
+			var (
+				r         io.Reader = conn
+				segmented bool
+			)
 			for !srv.isClosed() {
-				framer, err := srv.readFrame(conn)
+				framer, err := srv.readFrame(r)
 				if err != nil {
 					if err == io.EOF {
 						return
@@ -1146,7 +2348,13 @@ func (srv *TestServer) serve() {
 					srv.onRecv(framer)
 				}
 
-				go srv.process(conn, framer)
+				go srv.process(conn, framer, segmented)
+
+				// protocol v5 wraps the frames following the startup in segments
+				if srv.protocol == protoVersion5 && framer.header.op == opStartup && !segmented {
+					r = &segmentReader{r: conn}
+					segmented = true
+				}
 			}
 		}(conn)
 	}
@@ -1184,7 +2392,7 @@ func (srv *TestServer) errorLocked(err interface{}) {
 	srv.t.Error(err)
 }
 
-func (srv *TestServer) process(conn net.Conn, reqFrame *framer) {
+func (srv *TestServer) process(conn net.Conn, reqFrame *framer, segmented bool) {
 	head := reqFrame.header
 	if head == nil {
 		srv.errorLocked("process frame with a nil header")
@@ -1202,7 +2410,18 @@ func (srv *TestServer) process(conn net.Conn, reqFrame *framer) {
 				return
 			}
 		}
+		srv.mu.Lock()
+		authenticator := srv.authenticator
+		srv.mu.Unlock()
+		if authenticator != "" {
+			respFrame.writeHeader(0, opAuthenticate, head.stream)
+			respFrame.writeString(authenticator)
+			break
+		}
 		respFrame.writeHeader(0, opReady, head.stream)
+	case opAuthResponse:
+		respFrame.writeHeader(0, opAuthSuccess, head.stream)
+		respFrame.writeBytes(nil)
 	case opOptions:
 		respFrame.writeHeader(0, opSupported, head.stream)
 		respFrame.writeShort(0)
@@ -1222,8 +2441,61 @@ func (srv *TestServer) process(conn net.Conn, reqFrame *framer) {
 			respFrame.writeInt(resultKindKeyspace)
 			respFrame.writeString(strings.TrimSpace(query[3:]))
 		case "void":
+			cons := reqFrame.readConsistency()
+			srv.mu.Lock()
+			srv.consistencies = append(srv.consistencies, cons)
+			srv.mu.Unlock()
 			respFrame.writeHeader(0, opResult, head.stream)
 			respFrame.writeInt(resultKindVoid)
+		case "traced":
+			// answers with a trace id when tracing is requested
+			if head.flags&flagTracing == flagTracing {
+				respFrame.writeHeader(flagTracing, opResult, head.stream)
+				respFrame.buf = append(respFrame.buf, testTraceID...)
+			} else {
+				respFrame.writeHeader(0, opResult, head.stream)
+			}
+			respFrame.writeInt(resultKindVoid)
+		case "warn":
+			// answers with a warning, from protocol version 4
+			respFrame.writeHeader(flagWarning, opResult, head.stream)
+			respFrame.writeStringList([]string{"testing warning"})
+			respFrame.writeInt(resultKindVoid)
+		case "pages":
+			// answers with the page of the rows 0 to 9 of an int column
+			// starting at the row in the paging state
+			atomic.AddInt64(&srv.nPageReq, 1)
+			reqFrame.readConsistency()
+			flags := reqFrame.readByte()
+			pageSize, start := 10, 0
+			if flags&flagPageSize != 0 {
+				pageSize = reqFrame.readInt()
+			}
+			if flags&flagWithPagingState != 0 {
+				start = int(readInt(reqFrame.readBytes()))
+			}
+			end := start + pageSize
+			if end > 10 {
+				end = 10
+			}
+			respFrame.writeHeader(0, opResult, head.stream)
+			respFrame.writeInt(resultKindRows)
+			if end < 10 {
+				respFrame.writeInt(int32(flagGlobalTableSpec | flagHasMorePages))
+				respFrame.writeInt(1)
+				respFrame.writeBytes(encInt(int32(end)))
+			} else {
+				respFrame.writeInt(int32(flagGlobalTableSpec))
+				respFrame.writeInt(1)
+			}
+			respFrame.writeString("ks")
+			respFrame.writeString("pages")
+			respFrame.writeString("v")
+			respFrame.writeShort(uint16(TypeInt))
+			respFrame.writeInt(int32(end - start))
+			for i := start; i < end; i++ {
+				respFrame.writeBytes(encInt(int32(i)))
+			}
 		case "timeout":
 			<-srv.ctx.Done()
 			return
@@ -1258,6 +2530,49 @@ func (srv *TestServer) process(conn net.Conn, reqFrame *framer) {
 			respFrame.writeHeader(0, opResult, head.stream)
 			respFrame.writeInt(resultKindVoid)
 		}
+	case opPrepare:
+		// prepares the statements without bind markers, except for kill, and
+		// the statements with a bind marker with one int column
+		query := reqFrame.readLongString()
+		atomic.AddInt64(&srv.nPrepareReq, 1)
+		if strings.ToLower(query) == "kill" {
+			respFrame.writeHeader(0, opError, head.stream)
+			respFrame.writeInt(ErrCodeInvalid)
+			respFrame.writeString("prepare killed")
+			break
+		}
+		respFrame.writeHeader(0, opResult, head.stream)
+		respFrame.writeInt(resultKindPrepared)
+		respFrame.writeShortBytes([]byte(query))
+		if strings.Contains(query, "?") {
+			respFrame.writeInt(int32(flagGlobalTableSpec))
+			respFrame.writeInt(1)
+			if reqFrame.proto >= protoVersion4 {
+				respFrame.writeInt(1)
+				respFrame.writeShort(0)
+			}
+			respFrame.writeString("ks")
+			respFrame.writeString("t")
+			respFrame.writeString("v")
+			respFrame.writeShort(uint16(TypeInt))
+		} else {
+			respFrame.writeInt(0)
+			respFrame.writeInt(0)
+			if reqFrame.proto >= protoVersion4 {
+				respFrame.writeInt(0)
+			}
+		}
+		respFrame.writeInt(int32(flagNoMetaData))
+		respFrame.writeInt(0)
+	case opBatch:
+		// applies every batch, only recording its number of statements
+		reqFrame.readByte()
+		n := reqFrame.readShort()
+		srv.mu.Lock()
+		srv.batches = append(srv.batches, int(n))
+		srv.mu.Unlock()
+		respFrame.writeHeader(0, opResult, head.stream)
+		respFrame.writeInt(resultKindVoid)
 	case opError:
 		respFrame.writeHeader(0, opError, head.stream)
 		respFrame.buf = append(respFrame.buf, reqFrame.buf...)
@@ -1273,20 +2588,28 @@ func (srv *TestServer) process(conn net.Conn, reqFrame *framer) {
 		srv.errorLocked(err)
 	}
 
+	if segmented {
+		buf, err := appendFrameSegments(nil, respFrame.buf, nil, 0)
+		if err != nil {
+			srv.errorLocked(err)
+		}
+		respFrame.buf = buf
+	}
+
 	if err := respFrame.writeTo(conn); err != nil {
 		srv.errorLocked(err)
 	}
 }
 
-func (srv *TestServer) readFrame(conn net.Conn) (*framer, error) {
+func (srv *TestServer) readFrame(r io.Reader) (*framer, error) {
 	buf := make([]byte, srv.headerSize)
-	head, err := readHeader(conn, buf)
+	head, err := readHeader(r, buf)
 	if err != nil {
 		return nil, err
 	}
 	framer := newFramer(nil, srv.protocol)
 
-	err = framer.readFrame(conn, &head)
+	err = framer.readFrame(r, &head)
 	if err != nil {
 		return nil, err
 	}
@@ -25,6 +25,7 @@
 package gocql
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -114,11 +115,19 @@ func connConfig(cfg *ClusterConfig) (*ConnConfig, error) {
 	)
 
 	hostDialer = cfg.HostDialer
+	if hostDialer == nil && cfg.TransportFactory != nil {
+		hostDialer = &transportHostDialer{factory: cfg.TransportFactory}
+	}
 	if hostDialer == nil {
-		var tlsConfig *tls.Config
+		var (
+			tlsConfig    *tls.Config
+			getTLSConfig func(context.Context, *HostInfo) (*tls.Config, error)
+		)
 
 		// TODO(zariel): move tls config setup into session init.
-		if cfg.SslOpts != nil {
+		if cfg.SslOpts != nil && cfg.SslOpts.GetConfig != nil {
+			getTLSConfig = cfg.SslOpts.GetConfig
+		} else if cfg.SslOpts != nil {
 			tlsConfig, err = setupTLSConfig(cfg.SslOpts)
 			if err != nil {
 				return nil, err
@@ -130,6 +139,9 @@ func connConfig(cfg *ClusterConfig) (*ConnConfig, error) {
 			d := &net.Dialer{
 				Timeout: cfg.ConnectTimeout,
 			}
+			if cfg.DialTimeout > 0 {
+				d.Timeout = cfg.DialTimeout
+			}
 			if cfg.SocketKeepalive > 0 {
 				d.KeepAlive = cfg.SocketKeepalive
 			}
@@ -137,27 +149,55 @@ func connConfig(cfg *ClusterConfig) (*ConnConfig, error) {
 		}
 
 		hostDialer = &defaultHostDialer{
-			dialer:    dialer,
-			tlsConfig: tlsConfig,
+			dialer:       dialer,
+			tlsConfig:    tlsConfig,
+			getTLSConfig: getTLSConfig,
 		}
 	}
 
 	return &ConnConfig{
-		ProtoVersion:   cfg.ProtoVersion,
-		CQLVersion:     cfg.CQLVersion,
-		Timeout:        cfg.Timeout,
-		WriteTimeout:   cfg.WriteTimeout,
-		ConnectTimeout: cfg.ConnectTimeout,
-		Dialer:         cfg.Dialer,
-		HostDialer:     hostDialer,
-		Compressor:     cfg.Compressor,
-		Authenticator:  cfg.Authenticator,
-		AuthProvider:   cfg.AuthProvider,
-		Keepalive:      cfg.SocketKeepalive,
-		Logger:         cfg.logger(),
+		ProtoVersion:       cfg.ProtoVersion,
+		CQLVersion:         cfg.CQLVersion,
+		Timeout:            cfg.Timeout,
+		WriteTimeout:       cfg.WriteTimeout,
+		ConnectTimeout:     cfg.ConnectTimeout,
+		DialTimeout:        cfg.DialTimeout,
+		HandshakeTimeout:   cfg.HandshakeTimeout,
+		Dialer:             cfg.Dialer,
+		HostDialer:         hostDialer,
+		Compressor:         cfg.Compressor,
+		Compressors:        cfg.Compressors,
+		MinCompressSize:    cfg.MinCompressSize,
+		CustomTypesAsBytes: cfg.CustomTypesAsBytes,
+		Codecs:             cfg.Codecs,
+		StartupOptions:     startupOptions(cfg),
+		Authenticator:      cfg.Authenticator,
+		AuthProvider:       cfg.AuthProvider,
+		Keepalive:          cfg.SocketKeepalive,
+		Logger:             cfg.logger(),
 	}, nil
 }
 
+// startupOptions returns the options added to the STARTUP message of the
+// connections, the options identifying the application overridden by
+// ClusterConfig.StartupOptions.
+func startupOptions(cfg *ClusterConfig) map[string]string {
+	opts := make(map[string]string, len(cfg.StartupOptions)+3)
+	if cfg.ApplicationName != "" {
+		opts["APPLICATION_NAME"] = cfg.ApplicationName
+	}
+	if cfg.ApplicationVersion != "" {
+		opts["APPLICATION_VERSION"] = cfg.ApplicationVersion
+	}
+	if cfg.ClientID != (UUID{}) {
+		opts["CLIENT_ID"] = cfg.ClientID.String()
+	}
+	for k, v := range cfg.StartupOptions {
+		opts[k] = v
+	}
+	return opts
+}
+
 func newPolicyConnPool(session *Session) *policyConnPool {
 	// create the pool
 	pool := &policyConnPool{
@@ -214,12 +254,14 @@ func (p *policyConnPool) SetHosts(hosts []*HostInfo) {
 		if pool.Size() > 0 {
 			// add pool only if there a connections available
 			p.hostConnPools[pool.host.HostID()] = pool
+			pool.observe(PoolHostAdded, pool.Size(), nil)
 		}
 	}
 
 	for addr := range toRemove {
 		pool := p.hostConnPools[addr]
 		delete(p.hostConnPools, addr)
+		pool.observe(PoolHostRemoved, 0, nil)
 		go pool.Close()
 	}
 }
@@ -271,6 +313,9 @@ func (p *policyConnPool) addHost(host *HostInfo) {
 	}
 	p.mu.Unlock()
 
+	if !ok {
+		pool.observe(PoolHostAdded, 0, nil)
+	}
 	pool.fill()
 }
 
@@ -285,6 +330,7 @@ func (p *policyConnPool) removeHost(hostID string) {
 	delete(p.hostConnPools, hostID)
 	p.mu.Unlock()
 
+	pool.observe(PoolHostRemoved, 0, nil)
 	go pool.Close()
 }
 
@@ -304,6 +350,20 @@ type hostConnPool struct {
 
 	pos    uint32
 	logger StdLogger
+
+	// requests limits the number of requests in flight to the host, it is nil
+	// if there is no limit.
+	requests chan struct{}
+
+	// minSize and maxSize bound size when the pool is sized adaptively.
+	minSize int
+	maxSize int
+	// quit is closed when the pool is closed to stop reaping idle connections.
+	quit chan struct{}
+
+	// lastErr is the last error connecting to the host or closing one of the
+	// connections, protected by mu.
+	lastErr error
 }
 
 func (h *hostConnPool) String() string {
@@ -326,12 +386,65 @@ func newHostConnPool(session *Session, host *HostInfo, port, size int,
 		filling:  false,
 		closed:   false,
 		logger:   session.logger,
+		minSize:  size,
+		maxSize:  size,
+		quit:     make(chan struct{}),
+	}
+	if max := session.cfg.MaxRequestsPerHost; max > 0 {
+		pool.requests = make(chan struct{}, max)
+	}
+	if session.cfg.MaxConns > size {
+		pool.maxSize = session.cfg.MaxConns
+	}
+	if interval := pool.maintenanceInterval(); interval > 0 {
+		go pool.maintainConns(interval)
 	}
 
 	// the pool is not filled or connected
 	return pool
 }
 
+// acquireRequest reserves a request to the host, waiting up to
+// MaxRequestsPerHostQueueTimeout if the limit of requests in flight is reached.
+// It returns ErrHostOverloaded if no request completed in time.
+// releaseRequest must be called once the request completes.
+func (pool *hostConnPool) acquireRequest(ctx context.Context) error {
+	if pool.requests == nil {
+		return nil
+	}
+
+	select {
+	case pool.requests <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timeout := pool.session.cfg.MaxRequestsPerHostQueueTimeout
+	if timeout <= 0 {
+		pool.observe(PoolExhausted, pool.Size(), nil)
+		return ErrHostOverloaded
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case pool.requests <- struct{}{}:
+		return nil
+	case <-timer.C:
+		pool.observe(PoolExhausted, pool.Size(), nil)
+		return ErrHostOverloaded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseRequest releases a request reserved by acquireRequest.
+func (pool *hostConnPool) releaseRequest() {
+	if pool.requests != nil {
+		<-pool.requests
+	}
+}
+
 // Pick a connection from this connection pool for the given query.
 func (pool *hostConnPool) Pick() *Conn {
 	pool.mu.RLock()
@@ -353,23 +466,227 @@ func (pool *hostConnPool) Pick() *Conn {
 
 	pos := int(atomic.AddUint32(&pool.pos, 1) - 1)
 
-	var (
-		leastBusyConn    *Conn
-		streamsAvailable int
-	)
-
-	// find the conn which has the most available streams, this is racy
-	for i := 0; i < size; i++ {
-		conn := pool.conns[(pos+i)%size]
+	// pick the less busy of two connections chosen at random, the power of two
+	// choices, which keeps the requests in flight balanced across connections
+	// without every request racing for the least busy one, this is racy
+	leastBusyConn := pool.conns[pos%size]
+	streamsAvailable := leastBusyConn.AvailableStreams()
+	if size > 1 {
+		conn := pool.conns[(pos+1+rand.Intn(size-1))%size]
 		if streams := conn.AvailableStreams(); streams > streamsAvailable {
 			leastBusyConn = conn
 			streamsAvailable = streams
 		}
 	}
 
+	if streamsAvailable <= 0 {
+		// both connections are saturated, fall back to any with streams left
+		leastBusyConn = nil
+		for i := 0; i < size; i++ {
+			conn := pool.conns[(pos+i)%size]
+			if streams := conn.AvailableStreams(); streams > streamsAvailable {
+				leastBusyConn = conn
+				streamsAvailable = streams
+			}
+		}
+		if leastBusyConn == nil {
+			pool.observe(PoolExhausted, size, nil)
+		}
+	}
+
+	if leastBusyConn != nil && size == pool.size && pool.size < pool.maxSize && !pool.filling &&
+		leastBusyConn.inFlightStreams() >= pool.session.cfg.NewConnThreshold {
+		go pool.grow()
+	}
+
 	return leastBusyConn
 }
 
+// grow adds a connection to the pool if it is not at its maximum size.
+func (pool *hostConnPool) grow() {
+	pool.mu.Lock()
+	if pool.closed || pool.filling || pool.size >= pool.maxSize || len(pool.conns) < pool.size {
+		pool.mu.Unlock()
+		return
+	}
+	pool.size++
+	pool.mu.Unlock()
+
+	pool.fill()
+}
+
+// maintenanceInterval returns how often the connections of the pool are checked
+// for being idle or too old, 0 if they need not be checked.
+func (pool *hostConnPool) maintenanceInterval() time.Duration {
+	var interval time.Duration
+	if idleTimeout := pool.session.cfg.ConnIdleTimeout; pool.maxSize > pool.minSize && idleTimeout > 0 {
+		interval = idleTimeout / 2
+	}
+	if maxLifetime := pool.session.cfg.ConnMaxLifetime; maxLifetime > 0 {
+		if interval == 0 || maxLifetime/10 < interval {
+			interval = maxLifetime / 10
+		}
+	}
+	return interval
+}
+
+// maintainConns periodically closes idle connections and recycles connections
+// older than ConnMaxLifetime until the pool is closed.
+func (pool *hostConnPool) maintainConns(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.quit:
+			return
+		case now := <-ticker.C:
+			if idleTimeout := pool.session.cfg.ConnIdleTimeout; pool.maxSize > pool.minSize && idleTimeout > 0 {
+				pool.closeIdleConns(now, idleTimeout)
+			}
+			if pool.session.cfg.ConnMaxLifetime > 0 {
+				pool.recycleOldConns(now)
+			}
+		}
+	}
+}
+
+// recycleOldConns replaces the connections established more than their
+// lifetime ago. Each connection is replaced by a new one before it is removed
+// from the pool, and it is closed once its requests in flight are completed.
+func (pool *hostConnPool) recycleOldConns(now time.Time) {
+	var old []*Conn
+
+	pool.mu.Lock()
+	if pool.closed || pool.filling {
+		pool.mu.Unlock()
+		return
+	}
+	for _, conn := range pool.conns {
+		if conn.lifetime > 0 && now.Sub(conn.created) >= conn.lifetime {
+			old = append(old, conn)
+		}
+	}
+	pool.mu.Unlock()
+
+	for _, conn := range old {
+		if !pool.replaceConn(conn) {
+			// keep the remaining connections until the next attempt
+			return
+		}
+		go pool.drainConn(conn)
+	}
+}
+
+// replaceConn connects a new connection and swaps it for old in the pool,
+// returning false if the pool is closed, filling, or the new connection failed.
+func (pool *hostConnPool) replaceConn(old *Conn) bool {
+	pool.mu.Lock()
+	if pool.closed || pool.filling {
+		pool.mu.Unlock()
+		return false
+	}
+	// prevent concurrent filling while the replacement is connected.
+	pool.filling = true
+	pool.mu.Unlock()
+
+	err := pool.connect()
+	pool.logConnectErr(err)
+
+	pool.mu.Lock()
+	pool.filling = false
+	if err != nil {
+		pool.mu.Unlock()
+		return false
+	}
+	for i, conn := range pool.conns {
+		if conn == old {
+			pool.conns[i], pool.conns = pool.conns[len(pool.conns)-1], pool.conns[:len(pool.conns)-1]
+			break
+		}
+	}
+	conns := len(pool.conns)
+	pool.mu.Unlock()
+
+	pool.observe(PoolConnClosed, conns, nil)
+	return true
+}
+
+// connLifetime returns the lifetime of a new connection: maxLifetime shortened
+// by a random jitter of up to a fifth, so that the connections established
+// together are not all recycled by the same maintenance of the pool. There is
+// no jitter when built with the gocql_upstream_defaults tag.
+func connLifetime(maxLifetime time.Duration) time.Duration {
+	if upstreamDefaults {
+		return maxLifetime
+	}
+	mutRandr.Lock()
+	jitter := randr.Int63n(int64(maxLifetime)/5 + 1)
+	mutRandr.Unlock()
+	return maxLifetime - time.Duration(jitter)
+}
+
+// connDrainTimeout is how long a connection removed from the pool is drained
+// when requests have no timeout.
+const connDrainTimeout = 10 * time.Second
+
+// drainConn closes a connection removed from the pool once its requests in
+// flight are completed, or after the request timeout, or connDrainTimeout if
+// requests have no timeout.
+func (pool *hostConnPool) drainConn(conn *Conn) {
+	defer conn.Close()
+
+	drainTimeout := pool.session.cfg.Timeout
+	if drainTimeout <= 0 {
+		drainTimeout = connDrainTimeout
+	}
+	timeout := time.NewTimer(drainTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for conn.inFlightStreams() > 0 {
+		select {
+		case <-pool.quit:
+			return
+		case <-timeout.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns shrinks the pool down to its minimum size by closing the
+// connections without requests in flight which were not used since idleTimeout.
+func (pool *hostConnPool) closeIdleConns(now time.Time, idleTimeout time.Duration) {
+	var idle []*Conn
+
+	pool.mu.Lock()
+	if pool.closed || pool.filling {
+		pool.mu.Unlock()
+		return
+	}
+	for i := 0; i < len(pool.conns) && pool.size > pool.minSize; {
+		conn := pool.conns[i]
+		if conn.inFlightStreams() == 0 && now.Sub(conn.lastUsed()) >= idleTimeout {
+			// remove the connection before closing it so that HandleError
+			// does not refill the pool.
+			pool.conns[i], pool.conns = pool.conns[len(pool.conns)-1], pool.conns[:len(pool.conns)-1]
+			pool.size--
+			idle = append(idle, conn)
+			continue
+		}
+		i++
+	}
+	conns := len(pool.conns)
+	pool.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.Close()
+		pool.observe(PoolConnClosed, conns, nil)
+	}
+}
+
 // Size returns the number of connections currently active in the pool
 func (pool *hostConnPool) Size() int {
 	pool.mu.RLock()
@@ -378,6 +695,24 @@ func (pool *hostConnPool) Size() int {
 	return len(pool.conns)
 }
 
+// stats returns the number of connections of the pool, the number of requests
+// in flight on them and the last connection error.
+func (pool *hostConnPool) stats() (conns, inFlight int, lastErr error) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	for _, conn := range pool.conns {
+		inFlight += conn.inFlightStreams()
+	}
+	return len(pool.conns), inFlight, pool.lastErr
+}
+
+func (pool *hostConnPool) setLastErr(err error) {
+	pool.mu.Lock()
+	pool.lastErr = err
+	pool.mu.Unlock()
+}
+
 // Close the connection pool
 func (pool *hostConnPool) Close() {
 	pool.mu.Lock()
@@ -387,6 +722,7 @@ func (pool *hostConnPool) Close() {
 		return
 	}
 	pool.closed = true
+	close(pool.quit)
 
 	// ensure we dont try to reacquire the lock in handleError
 	// TODO: improve this as the following can happen
@@ -406,6 +742,20 @@ func (pool *hostConnPool) Close() {
 	// close the connections
 	for _, conn := range conns {
 		conn.Close()
+		pool.observe(PoolConnClosed, 0, nil)
+	}
+}
+
+// observe reports an event of the pool to the pool observer of the session.
+func (pool *hostConnPool) observe(event PoolEvent, conns int, err error) {
+	if obs := pool.session.poolObserver; obs != nil {
+		obs.ObservePool(ObservedPool{
+			Event: event,
+			Host:  pool.host,
+			Conns: conns,
+			Err:   err,
+			Time:  time.Now(),
+		})
 	}
 }
 
@@ -486,9 +836,7 @@ func (pool *hostConnPool) logConnectErr(err error) {
 	if opErr, ok := err.(*net.OpError); ok && (opErr.Op == "dial" || opErr.Op == "read") {
 		// connection refused
 		// these are typical during a node outage so avoid log spam.
-		if gocqlDebug {
-			pool.logger.Printf("gocql: unable to dial %q: %v\n", pool.host, err)
-		}
+		pool.session.debugf("gocql: unable to dial %q: %v\n", pool.host, err)
 	} else if err != nil {
 		// unexpected error
 		pool.logger.Printf("error: failed to connect to %q due to error: %v", pool.host, err)
@@ -498,9 +846,7 @@ func (pool *hostConnPool) logConnectErr(err error) {
 // transition back to a not-filling state.
 func (pool *hostConnPool) fillingStopped(err error) {
 	if err != nil {
-		if gocqlDebug {
-			pool.logger.Printf("gocql: filling stopped %q: %v\n", pool.host.ConnectAddress(), err)
-		}
+		pool.session.debugf("gocql: filling stopped %q: %v\n", pool.host.ConnectAddress(), err)
 		// wait for some time to avoid back-to-back filling
 		// this provides some time between failed attempts
 		// to fill the pool for the host to recover
@@ -516,9 +862,7 @@ func (pool *hostConnPool) fillingStopped(err error) {
 
 	// if we errored and the size is now zero, make sure the host is marked as down
 	// see https://github.com/apache/cassandra-gocql-driver/issues/1614
-	if gocqlDebug {
-		pool.logger.Printf("gocql: conns of pool after stopped %q: %v\n", host.ConnectAddress(), count)
-	}
+	pool.session.debugf("gocql: conns of pool after stopped %q: %v\n", host.ConnectAddress(), count)
 	if err != nil && count == 0 {
 		if pool.session.cfg.ConvictionPolicy.AddFailure(err, host) {
 			pool.session.handleNodeDown(host.ConnectAddress(), port)
@@ -543,6 +887,7 @@ func (pool *hostConnPool) connectMany(count int) error {
 			err := pool.connect()
 			pool.logConnectErr(err)
 			if err != nil {
+				pool.setLastErr(err)
 				mu.Lock()
 				connectErr = err
 				mu.Unlock()
@@ -574,14 +919,13 @@ func (pool *hostConnPool) connect() (err error) {
 				break
 			}
 		}
-		if gocqlDebug {
-			pool.logger.Printf("gocql: connection failed %q: %v, reconnecting with %T\n",
-				pool.host.ConnectAddress(), err, reconnectionPolicy)
-		}
+		pool.session.debugf("gocql: connection failed %q: %v, reconnecting with %T\n",
+			pool.host.ConnectAddress(), err, reconnectionPolicy)
 		time.Sleep(reconnectionPolicy.GetInterval(i))
 	}
 
 	if err != nil {
+		pool.observe(PoolConnFailed, pool.Size(), err)
 		return err
 	}
 
@@ -589,21 +933,27 @@ func (pool *hostConnPool) connect() (err error) {
 		// set the keyspace
 		if err = conn.UseKeyspace(pool.keyspace); err != nil {
 			conn.Close()
+			pool.observe(PoolConnFailed, pool.Size(), err)
 			return err
 		}
 	}
 
 	// add the Conn to the pool
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
-
 	if pool.closed {
+		pool.mu.Unlock()
 		conn.Close()
 		return nil
 	}
 
+	if maxLifetime := pool.session.cfg.ConnMaxLifetime; maxLifetime > 0 {
+		conn.lifetime = connLifetime(maxLifetime)
+	}
 	pool.conns = append(pool.conns, conn)
+	conns := len(pool.conns)
+	pool.mu.Unlock()
 
+	pool.observe(PoolConnOpened, conns, nil)
 	return nil
 }
 
@@ -617,26 +967,35 @@ func (pool *hostConnPool) HandleError(conn *Conn, err error, closed bool) {
 	// TODO: track the number of errors per host and detect when a host is dead,
 	// then also have something which can detect when a host comes back.
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
 
 	if pool.closed {
 		// pool closed
+		pool.mu.Unlock()
 		return
 	}
 
-	if gocqlDebug {
-		pool.logger.Printf("gocql: pool connection error %q: %v\n", conn.addr, err)
+	pool.session.debugf("gocql: pool connection error %q: %v\n", conn.addr, err)
+	if err != nil {
+		pool.lastErr = err
 	}
 
 	// find the connection index
+	removed := false
 	for i, candidate := range pool.conns {
 		if candidate == conn {
 			// remove the connection, not preserving order
 			pool.conns[i], pool.conns = pool.conns[len(pool.conns)-1], pool.conns[:len(pool.conns)-1]
+			removed = true
 
 			// lost a connection, so fill the pool
 			go pool.fill()
 			break
 		}
 	}
+	conns := len(pool.conns)
+	pool.mu.Unlock()
+
+	if removed {
+		pool.observe(PoolConnClosed, conns, err)
+	}
 }
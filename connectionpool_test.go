@@ -28,8 +28,10 @@
 package gocql
 
 import (
+	"context"
 	"crypto/tls"
 	"testing"
+	"time"
 )
 
 func TestSetupTLSConfig(t *testing.T) {
@@ -107,3 +109,188 @@ func TestSetupTLSConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestHostConnPoolAdaptiveSize(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.MaxConns = 2
+	cluster.NewConnThreshold = 1
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	pool, ok := db.pool.getPool(db.GetHosts()[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	if size := pool.Size(); size != 1 {
+		t.Fatalf("expected pool to start with 1 connection, got %d", size)
+	}
+
+	// keep a request in flight so that the connection reaches the threshold
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go db.Query("timeout").WithContext(ctx).Exec()
+	busy := pool.Pick()
+	for busy.inFlightStreams() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Size() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected pool to grow to 2 connections, got %d", pool.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the pool does not grow beyond MaxConns
+	for i := 0; i < 5; i++ {
+		pool.Pick()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if size := pool.Size(); size != 2 {
+		t.Fatalf("expected pool to stay at 2 connections, got %d", size)
+	}
+
+	// only the idle connection is closed
+	pool.closeIdleConns(time.Now().Add(time.Hour), time.Minute)
+	if size := pool.Size(); size != 1 {
+		t.Fatalf("expected pool to shrink to 1 connection, got %d", size)
+	}
+	if conn := pool.Pick(); conn != busy {
+		t.Fatal("expected the busy connection to be kept")
+	}
+	pool.closeIdleConns(time.Now().Add(time.Hour), time.Minute)
+	if size := pool.Size(); size != 1 {
+		t.Fatalf("expected pool not to shrink below NumConns, got %d", size)
+	}
+}
+
+func TestHostConnPoolPickLeastBusy(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 3
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	pool, ok := db.pool.getPool(db.GetHosts()[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Size() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected pool to fill to 3 connections, got %d", pool.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// keep a request in flight on one connection
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	busy := pool.Pick()
+	go busy.executeQuery(ctx, db.Query("timeout").WithContext(ctx))
+	for busy.inFlightStreams() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// of any two connections one is idle, so the busy one is never picked
+	for i := 0; i < 100; i++ {
+		if conn := pool.Pick(); conn == busy {
+			t.Fatal("expected the busy connection not to be picked")
+		}
+	}
+}
+
+func TestHostConnPoolMaxLifetime(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.ConnMaxLifetime = time.Hour
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	pool, ok := db.pool.getPool(db.GetHosts()[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	old := pool.Pick()
+	if old.lifetime < 48*time.Minute || old.lifetime > time.Hour {
+		t.Fatalf("expected a lifetime between 48m and 1h, got %v", old.lifetime)
+	}
+
+	pool.recycleOldConns(time.Now().Add(old.lifetime - time.Minute))
+	if conn := pool.Pick(); conn != old {
+		t.Fatal("expected the connection not to be recycled before its lifetime")
+	}
+
+	// keep a request in flight on the old connection
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go db.Query("slow").WithContext(ctx).Exec()
+	for old.inFlightStreams() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	pool.recycleOldConns(time.Now().Add(time.Hour))
+	if size := pool.Size(); size != 1 {
+		t.Fatalf("expected the pool to keep 1 connection, got %d", size)
+	}
+	if conn := pool.Pick(); conn == old {
+		t.Fatal("expected the old connection to be replaced")
+	}
+	if old.Closed() {
+		t.Fatal("expected the old connection to be drained before being closed")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !old.Closed() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the old connection to be closed once drained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnLifetime(t *testing.T) {
+	if upstreamDefaults {
+		if lifetime := connLifetime(time.Hour); lifetime != time.Hour {
+			t.Fatalf("expected a lifetime of 1h without jitter, got %v", lifetime)
+		}
+		return
+	}
+
+	lifetimes := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		lifetime := connLifetime(time.Hour)
+		if lifetime < 48*time.Minute || lifetime > time.Hour {
+			t.Fatalf("expected a lifetime between 48m and 1h, got %v", lifetime)
+		}
+		lifetimes[lifetime] = true
+	}
+	if len(lifetimes) < 2 {
+		t.Fatal("expected the lifetimes to be jittered")
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -71,6 +72,11 @@ type controlConn struct {
 	retry RetryPolicy
 
 	quit chan struct{}
+
+	// standby is the connection the control connection fails over to if
+	// ClusterConfig.ControlConnection.Standby is set.
+	standbyMu sync.Mutex
+	standby   *Conn
 }
 
 func createControlConn(session *Session) *controlConn {
@@ -112,6 +118,7 @@ func (c *controlConn) heartBeat() {
 		case *supportedFrame:
 			// Everything ok
 			sleepTime = 5 * time.Second
+			c.connectStandby()
 			continue
 		case error:
 			goto reconn
@@ -129,7 +136,24 @@ func (c *controlConn) heartBeat() {
 
 var hostLookupPreferV4 = os.Getenv("GOCQL_HOST_LOOKUP_PREFER_V4") == "true"
 
+// unixScheme is the prefix of the contact points connected to through a Unix
+// domain socket, such as unix:///var/run/cassandra.sock.
+const unixScheme = "unix://"
+
 func hostInfo(addr string, defaultPort int) ([]*HostInfo, error) {
+	if strings.HasPrefix(addr, unixScheme) {
+		path := strings.TrimPrefix(addr, unixScheme)
+		if path == "" {
+			return nil, fmt.Errorf("missing socket path in %q", addr)
+		}
+		host := &HostInfo{
+			hostname:   "localhost",
+			port:       defaultPort,
+			socketPath: path,
+		}
+		return []*HostInfo{host}, nil
+	}
+
 	var port int
 	host, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -294,10 +318,17 @@ type connHost struct {
 func (c *controlConn) setupConn(conn *Conn) error {
 	// we need up-to-date host info for the filterHost call below
 	iter := conn.querySystemLocal(context.TODO())
-	host, err := c.session.hostInfoFromIter(iter, conn.host.connectAddress, conn.conn.RemoteAddr().(*net.TCPAddr).Port)
+	port := conn.host.Port()
+	if addr, ok := conn.conn.RemoteAddr().(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+	host, err := c.session.hostInfoFromIter(iter, conn.host.connectAddress, port)
 	if err != nil {
 		return err
 	}
+	if host.socketPath == "" {
+		host.socketPath = conn.host.SocketPath()
+	}
 
 	host = c.session.ring.addOrUpdate(host)
 
@@ -385,22 +416,32 @@ func (c *controlConn) reconnect() {
 }
 
 func (c *controlConn) attemptReconnect() (*Conn, error) {
-	hosts := c.session.ring.allHosts()
-	hosts = shuffleHosts(hosts)
-
-	// keep the old behavior of connecting to the old host first by moving it to
-	// the front of the slice
+	var current *HostInfo
 	ch := c.getConn()
 	if ch != nil {
-		for i := range hosts {
-			if hosts[i].Equal(ch.host) {
-				hosts[0], hosts[i] = hosts[i], hosts[0]
-				break
-			}
-		}
+		current = ch.host
 		ch.conn.Close()
 	}
 
+	if conn := c.takeStandby(); conn != nil {
+		err := c.setupConn(conn)
+		if err == nil {
+			return conn, nil
+		}
+		c.session.logger.Printf("gocql: unable setup standby control conn %v:%v: %v\n", conn.host.ConnectAddress(), conn.host.Port(), err)
+		conn.Close()
+	}
+
+	var preferred []*HostInfo
+	if addrs := c.session.cfg.ControlConnection.PreferredHosts; len(addrs) > 0 {
+		var err error
+		preferred, err = addrsToHosts(addrs, c.session.cfg.Port, c.session.logger)
+		if err != nil {
+			c.session.logger.Printf("gocql: unable to resolve preferred control hosts: %v\n", err)
+		}
+	}
+
+	hosts := controlReconnectHosts(shuffleHosts(c.session.ring.allHosts()), preferred, current)
 	conn, err := c.attemptReconnectToAnyOfHosts(hosts)
 
 	if conn != nil {
@@ -411,7 +452,7 @@ func (c *controlConn) attemptReconnect() (*Conn, error) {
 	c.session.logger.Printf("gocql: control falling back to initial contact points.\n")
 	// Fallback to initial contact points, as it may be the case that all known initialHosts
 	// changed their IPs while keeping the same hostname(s).
-	initialHosts, resolvErr := addrsToHosts(c.session.cfg.Hosts, c.session.cfg.Port, c.session.logger)
+	initialHosts, resolvErr := c.session.contactPoints()
 	if resolvErr != nil {
 		return nil, fmt.Errorf("resolve contact points' hostnames: %v", resolvErr)
 	}
@@ -419,6 +460,87 @@ func (c *controlConn) attemptReconnect() (*Conn, error) {
 	return c.attemptReconnectToAnyOfHosts(initialHosts)
 }
 
+// controlReconnectHosts orders the hosts of the ring to reconnect the control
+// connection to: the preferred hosts first, then the current host, to keep the
+// old behavior of reconnecting to it first, and then the other hosts.
+func controlReconnectHosts(hosts, preferred []*HostInfo, current *HostInfo) []*HostInfo {
+	ordered := make([]*HostInfo, 0, len(hosts)+len(preferred))
+	used := make(map[*HostInfo]bool, len(hosts))
+	for _, p := range preferred {
+		host := p
+		for _, h := range hosts {
+			if h.sameAddress(p) {
+				host = h
+				break
+			}
+		}
+		if !used[host] {
+			used[host] = true
+			ordered = append(ordered, host)
+		}
+	}
+	if current != nil {
+		for _, h := range hosts {
+			if h.Equal(current) && !used[h] {
+				used[h] = true
+				ordered = append(ordered, h)
+			}
+		}
+	}
+	for _, h := range hosts {
+		if !used[h] {
+			ordered = append(ordered, h)
+		}
+	}
+	return ordered
+}
+
+// connectStandby opens the standby connection to a host other than the host of
+// the control connection, if it is enabled and not open yet.
+func (c *controlConn) connectStandby() {
+	if !c.session.cfg.ControlConnection.Standby {
+		return
+	}
+	c.standbyMu.Lock()
+	open := c.standby != nil
+	c.standbyMu.Unlock()
+	if open {
+		return
+	}
+
+	ch := c.getConn()
+	for _, host := range shuffleHosts(c.session.ring.allHosts()) {
+		if (ch != nil && host.Equal(ch.host)) || !host.IsUp() || c.session.cfg.filterHost(host) {
+			continue
+		}
+
+		conn, err := c.session.connect(c.session.ctx, host, c)
+		if err != nil {
+			c.session.debugf("gocql: unable to dial standby control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+			continue
+		}
+
+		c.standbyMu.Lock()
+		if c.standby == nil && atomic.LoadInt32(&c.state) != controlConnClosing {
+			c.standby, conn = conn, nil
+		}
+		c.standbyMu.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+		return
+	}
+}
+
+// takeStandby removes and returns the standby connection, nil if there is none.
+func (c *controlConn) takeStandby() *Conn {
+	c.standbyMu.Lock()
+	defer c.standbyMu.Unlock()
+	conn := c.standby
+	c.standby = nil
+	return conn
+}
+
 func (c *controlConn) attemptReconnectToAnyOfHosts(hosts []*HostInfo) (*Conn, error) {
 	var conn *Conn
 	var err error
@@ -444,6 +566,14 @@ func (c *controlConn) HandleError(conn *Conn, err error, closed bool) {
 		return
 	}
 
+	c.standbyMu.Lock()
+	if c.standby == conn {
+		c.standby = nil
+		c.standbyMu.Unlock()
+		return
+	}
+	c.standbyMu.Unlock()
+
 	oldConn := c.getConn()
 
 	// If connection has long gone, and not been attempted for awhile,
@@ -513,8 +643,8 @@ func (c *controlConn) query(statement string, values ...interface{}) (iter *Iter
 			return conn.executeQuery(context.TODO(), q)
 		})
 
-		if gocqlDebug && iter.err != nil {
-			c.session.logger.Printf("control: error executing %q: %v\n", statement, iter.err)
+		if iter.err != nil {
+			c.session.debugf("control: error executing %q: %v\n", statement, iter.err)
 		}
 
 		q.AddAttempts(1, c.getConn().host)
@@ -541,6 +671,9 @@ func (c *controlConn) close() {
 	if ch != nil {
 		ch.conn.Close()
 	}
+	if conn := c.takeStandby(); conn != nil {
+		conn.Close()
+	}
 }
 
 var errNoControl = errors.New("gocql: no control connection available")
@@ -199,3 +199,67 @@ func TestControlConn_ReconnectRefreshesRing(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestControlConn_StandbyFailover(t *testing.T) {
+	if err := ccm.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	allCcmHosts, err := ccm.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(allCcmHosts) < 2 {
+		t.Skip("this test requires at least 2 nodes")
+	}
+
+	session := createSession(t, func(config *ClusterConfig) {
+		config.ControlConnection.Standby = true
+	})
+	defer session.Close()
+
+	hasStandby := func() bool {
+		session.control.standbyMu.Lock()
+		defer session.control.standbyMu.Unlock()
+		return session.control.standby != nil
+	}
+	for i := 0; i < 10 && !hasStandby(); i++ {
+		time.Sleep(1 * time.Second)
+	}
+	if !hasStandby() {
+		t.Fatal("expected a standby control connection")
+	}
+
+	ccHost := session.control.getConn().host
+	var ccHostName string
+	for _, node := range allCcmHosts {
+		if node.Addr == ccHost.ConnectAddress().String() {
+			ccHostName = node.Name
+			break
+		}
+	}
+	if ccHostName == "" {
+		t.Fatal("could not find name of control host")
+	}
+
+	if err := ccm.NodeDown(ccHostName); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ccm.NodeUp(ccHostName); err != nil {
+			t.Logf("could not bring node %v back up after test: %v", ccHostName, err)
+		}
+	}()
+
+	failedOver := func() bool {
+		ch := session.control.getConn()
+		return ch != nil && !ch.host.Equal(ccHost)
+	}
+	for i := 0; i < 10 && !failedOver(); i++ {
+		time.Sleep(500 * time.Millisecond)
+	}
+	if !failedOver() {
+		t.Fatal("expected the control connection to fail over to the standby host")
+	}
+}
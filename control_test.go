@@ -55,6 +55,66 @@ func TestHostInfo_Lookup(t *testing.T) {
 	}
 }
 
+func TestHostInfo_UnixSocket(t *testing.T) {
+	hosts, err := hostInfo("unix:///var/run/cassandra.sock", 9042)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %v", hosts)
+	}
+
+	host := hosts[0]
+	if path := host.SocketPath(); path != "/var/run/cassandra.sock" {
+		t.Errorf("expected socket path /var/run/cassandra.sock, got %q", path)
+	}
+	if ip := host.ConnectAddress(); ip != nil {
+		t.Errorf("expected no connect address until the node reports it, got %v", ip)
+	}
+	if port := host.Port(); port != 9042 {
+		t.Errorf("expected port 9042, got %d", port)
+	}
+
+	other, err := hostInfo("unix:///var/run/other.sock", 9042)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other[0].Equal(host) || other[0].sameAddress(host) {
+		t.Errorf("expected distinct hosts for distinct sockets, got %v and %v", host, other[0])
+	}
+
+	// the hosts are identified by their socket, even once they have the
+	// address of a node connected to over TCP.
+	loopback := &HostInfo{connectAddress: net.IPv4(127, 0, 0, 1), port: 9042}
+	host.SetConnectAddress(net.IPv4(127, 0, 0, 1))
+	if loopback.Equal(host) || host.Equal(loopback) || host.sameAddress(loopback) {
+		t.Errorf("expected %v and %v to be distinct hosts", host, loopback)
+	}
+	if host.addressKey() == loopback.addressKey() {
+		t.Errorf("expected distinct address keys, got %q", host.addressKey())
+	}
+
+	same, err := hostInfo("unix:///var/run/cassandra.sock", 9042)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same[0].Equal(host) || !same[0].sameAddress(host) {
+		t.Errorf("expected the hosts of the same socket to be equal, got %v and %v", host, same[0])
+	}
+
+	list := &cowHostList{}
+	list.add(host)
+	list.add(loopback)
+	list.add(other[0])
+	if !list.remove(other[0]) || len(list.get()) != 2 || !list.get()[0].Equal(host) {
+		t.Errorf("expected to remove only the host of the other socket, got %v", list.get())
+	}
+
+	if _, err := hostInfo("unix://", 9042); err == nil {
+		t.Error("expected an error for a missing socket path")
+	}
+}
+
 func TestParseProtocol(t *testing.T) {
 	tests := [...]struct {
 		err   error
@@ -89,3 +149,31 @@ func TestParseProtocol(t *testing.T) {
 		}
 	}
 }
+
+func TestControlReconnectHosts(t *testing.T) {
+	hosts := []*HostInfo{
+		{connectAddress: net.IPv4(10, 0, 0, 1), port: 9042},
+		{connectAddress: net.IPv4(10, 0, 0, 2), port: 9042},
+		{connectAddress: net.IPv4(10, 0, 0, 3), port: 9042},
+		{connectAddress: net.IPv4(10, 0, 0, 4), port: 9042},
+	}
+	preferred := []*HostInfo{
+		{connectAddress: net.IPv4(10, 0, 0, 3), port: 9042},
+		{connectAddress: net.IPv4(10, 0, 0, 5), port: 9042},
+	}
+
+	ordered := controlReconnectHosts(hosts, preferred, hosts[1])
+
+	expected := []string{"10.0.0.3", "10.0.0.5", "10.0.0.2", "10.0.0.1", "10.0.0.4"}
+	if len(ordered) != len(expected) {
+		t.Fatalf("expected %d hosts, got %v", len(expected), ordered)
+	}
+	for i, host := range ordered {
+		if got := host.ConnectAddress().String(); got != expected[i] {
+			t.Errorf("expected host %d to be %s, got %s", i, expected[i], got)
+		}
+	}
+	if ordered[0] != hosts[2] {
+		t.Error("expected the preferred host of the ring to be used")
+	}
+}
@@ -24,8 +24,112 @@
 
 package gocql
 
+import "time"
+
 type Duration struct {
 	Months      int32
 	Days        int32
 	Nanoseconds int64
 }
+
+// TimestampMillis is a point in time expressed as the number of milliseconds
+// since the Unix epoch, which is the precision of the CQL timestamp type.
+//
+// Unlike a plain int64 it carries its precision, so it is converted when it is
+// bound to or scanned from a bigint column such as the result of WRITETIME,
+// whose values are interpreted as microseconds since the Unix epoch.
+type TimestampMillis int64
+
+// TimestampMillisFromTime returns t truncated to millisecond precision.
+func TimestampMillisFromTime(t time.Time) TimestampMillis {
+	return TimestampMillis(floorDiv(t.Unix()*1e6+int64(t.Nanosecond()/1e3), 1e3))
+}
+
+// Time returns the timestamp as a time.Time in UTC.
+func (t TimestampMillis) Time() time.Time {
+	return TimestampMicros(int64(t) * 1e3).Time()
+}
+
+// Micros returns the timestamp with microsecond precision.
+func (t TimestampMillis) Micros() TimestampMicros {
+	return TimestampMicros(int64(t) * 1e3)
+}
+
+func (t TimestampMillis) MarshalCQL(info TypeInfo) ([]byte, error) {
+	switch info.Type() {
+	case TypeTimestamp:
+		return encBigInt(int64(t)), nil
+	case TypeBigInt, TypeCounter:
+		return encBigInt(int64(t.Micros())), nil
+	}
+	return nil, marshalErrorf("can not marshal %T into %s", t, info)
+}
+
+func (t *TimestampMillis) UnmarshalCQL(info TypeInfo, data []byte) error {
+	switch info.Type() {
+	case TypeTimestamp:
+		*t = TimestampMillis(decBigInt(data))
+		return nil
+	case TypeBigInt, TypeCounter:
+		*t = TimestampMicros(decBigInt(data)).Millis()
+		return nil
+	}
+	return unmarshalErrorf("can not unmarshal %s into %T", info, t)
+}
+
+// TimestampMicros is a point in time expressed as the number of microseconds
+// since the Unix epoch, which is the precision used by WRITETIME and
+// USING TIMESTAMP.
+//
+// When bound to or scanned from a timestamp column it is converted from or to
+// milliseconds, the precision of the CQL timestamp type; binding truncates
+// sub-millisecond precision. bigint columns are read and written as is.
+type TimestampMicros int64
+
+// TimestampMicrosFromTime returns t truncated to microsecond precision.
+func TimestampMicrosFromTime(t time.Time) TimestampMicros {
+	return TimestampMicros(t.Unix()*1e6 + int64(t.Nanosecond()/1e3))
+}
+
+// Time returns the timestamp as a time.Time in UTC.
+func (t TimestampMicros) Time() time.Time {
+	sec := floorDiv(int64(t), 1e6)
+	return time.Unix(sec, (int64(t)-sec*1e6)*1e3).In(time.UTC)
+}
+
+// Millis returns the timestamp truncated to millisecond precision.
+func (t TimestampMicros) Millis() TimestampMillis {
+	return TimestampMillis(floorDiv(int64(t), 1e3))
+}
+
+func (t TimestampMicros) MarshalCQL(info TypeInfo) ([]byte, error) {
+	switch info.Type() {
+	case TypeTimestamp:
+		return encBigInt(int64(t.Millis())), nil
+	case TypeBigInt, TypeCounter:
+		return encBigInt(int64(t)), nil
+	}
+	return nil, marshalErrorf("can not marshal %T into %s", t, info)
+}
+
+func (t *TimestampMicros) UnmarshalCQL(info TypeInfo, data []byte) error {
+	switch info.Type() {
+	case TypeTimestamp:
+		*t = TimestampMillis(decBigInt(data)).Micros()
+		return nil
+	case TypeBigInt, TypeCounter:
+		*t = TimestampMicros(decBigInt(data))
+		return nil
+	}
+	return unmarshalErrorf("can not unmarshal %s into %T", info, t)
+}
+
+// floorDiv returns a / b rounded towards negative infinity, so that instants
+// before the Unix epoch are truncated the same way as later ones.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
@@ -57,25 +57,39 @@ type DialedHost struct {
 type defaultHostDialer struct {
 	dialer    Dialer
 	tlsConfig *tls.Config
+	// getTLSConfig, if not nil, returns the TLS config of each connection
+	// instead of tlsConfig.
+	getTLSConfig func(ctx context.Context, host *HostInfo) (*tls.Config, error)
 }
 
 func (hd *defaultHostDialer) DialHost(ctx context.Context, host *HostInfo) (*DialedHost, error) {
 	ip := host.ConnectAddress()
 	port := host.Port()
 
-	if !validIpAddr(ip) {
+	if !validIpAddr(ip) && host.SocketPath() == "" {
 		return nil, fmt.Errorf("host missing connect ip address: %v", ip)
 	} else if port == 0 {
 		return nil, fmt.Errorf("host missing port: %v", port)
 	}
 
-	connAddr := host.ConnectAddressAndPort()
-	conn, err := hd.dialer.DialContext(ctx, "tcp", connAddr)
+	tlsConfig := hd.tlsConfig
+	if hd.getTLSConfig != nil {
+		var err error
+		if tlsConfig, err = hd.getTLSConfig(ctx, host); err != nil {
+			return nil, fmt.Errorf("unable to get TLS config: %v", err)
+		}
+	}
+
+	network, connAddr := "tcp", host.ConnectAddressAndPort()
+	if path := host.SocketPath(); path != "" {
+		network, connAddr = "unix", path
+	}
+	conn, err := hd.dialer.DialContext(ctx, network, connAddr)
 	if err != nil {
 		return nil, err
 	}
 	addr := host.HostnameAndPort()
-	return WrapTLS(ctx, conn, addr, hd.tlsConfig)
+	return WrapTLS(ctx, conn, addr, tlsConfig)
 }
 
 func tlsConfigForAddr(tlsConfig *tls.Config, addr string) *tls.Config {
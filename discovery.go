@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"net"
+)
+
+// HostDiscovery selects the hosts of the cluster a session connects to, see
+// ClusterConfig.HostDiscovery.
+type HostDiscovery int
+
+const (
+	// DiscoverAllHosts connects to all the hosts of the cluster, which are
+	// discovered from the system.local and system.peers tables and refreshed
+	// as hosts join and leave the cluster.
+	DiscoverAllHosts HostDiscovery = iota
+	// DiscoverContactPoints connects to the contact points only, Hosts and
+	// StaticHosts, without reading the system.peers table, for topologies
+	// where the addresses of the peers can not be reached, such as when the
+	// hosts are behind proxies. The data center, rack and tokens of the hosts
+	// are only known if set by StaticHosts, so token aware routing requires
+	// them.
+	DiscoverContactPoints
+	// DiscoverLocalDC connects to the contact points and to the discovered
+	// hosts of the local data center, see ClusterConfig.LocalDC, for
+	// topologies where the hosts of the other data centers can not be
+	// reached.
+	DiscoverLocalDC
+)
+
+func (d HostDiscovery) String() string {
+	switch d {
+	case DiscoverAllHosts:
+		return "all hosts"
+	case DiscoverContactPoints:
+		return "contact points"
+	case DiscoverLocalDC:
+		return "local dc"
+	default:
+		return "unknown"
+	}
+}
+
+// StaticHost is a contact point whose data center, rack and tokens are
+// known, see ClusterConfig.StaticHosts.
+type StaticHost struct {
+	// Address is the address of the host, with an optional port which
+	// defaults to ClusterConfig.Port. Hostnames are resolved like the ones of
+	// ClusterConfig.Hosts.
+	Address string
+	// DataCenter and Rack are the data center and rack of the host.
+	DataCenter string
+	Rack       string
+	// Tokens are the tokens owned by the host, formatted like in the tokens
+	// column of the system.local table.
+	Tokens []string
+	// Partitioner is the partitioner of the cluster, like in the partitioner
+	// column of the system.local table.
+	// Default: org.apache.cassandra.dht.Murmur3Partitioner
+	Partitioner string
+}
+
+// staticHosts returns the hosts the addresses of static resolve to.
+func staticHosts(static []StaticHost, defaultPort int, logger StdLogger) ([]*HostInfo, error) {
+	var hosts []*HostInfo
+	for _, sh := range static {
+		resolved, err := hostInfo(sh.Address, defaultPort)
+		if err != nil {
+			// Try other hosts if unable to resolve DNS name
+			if _, ok := err.(*net.DNSError); ok {
+				logger.Printf("gocql: dns error: %v\n", err)
+				continue
+			}
+			return nil, err
+		}
+
+		partitioner := sh.Partitioner
+		if partitioner == "" {
+			partitioner = "org.apache.cassandra.dht.Murmur3Partitioner"
+		}
+		for _, h := range resolved {
+			h.dataCenter = sh.DataCenter
+			h.rack = sh.Rack
+			h.tokens = sh.Tokens
+			h.partitioner = partitioner
+		}
+		hosts = append(hosts, resolved...)
+	}
+	return hosts, nil
+}
+
+// staticPartitioner returns the partitioner of the first of hosts with
+// tokens, which are the contact points when the ring is not discovered.
+func staticPartitioner(hosts []*HostInfo) string {
+	for _, h := range hosts {
+		if len(h.Tokens()) > 0 {
+			return h.Partitioner()
+		}
+	}
+	return ""
+}
+
+// isContactPoint reports whether host has the address of one of the contact
+// points resolved last.
+func (s *Session) isContactPoint(host *HostInfo) bool {
+	s.ring.endpointsMu.Lock()
+	defer s.ring.endpointsMu.Unlock()
+	for _, h := range s.ring.endpoints {
+		if h.sameAddress(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// discoveredHosts returns the hosts of the local data center, and the
+// contact points, of the hosts discovered from the system tables, whose first
+// host is the one of the control connection.
+//
+// The local data center is ClusterConfig.LocalDC, or else the data center of
+// the host of the control connection the first time the hosts are
+// discovered, it is kept once known so that it does not change when the
+// control connection reconnects to a contact point of another data center.
+func (r *ringDescriber) discoveredHosts(hosts []*HostInfo) []*HostInfo {
+	if r.session.cfg.HostDiscovery != DiscoverLocalDC || len(hosts) == 0 {
+		return hosts
+	}
+	if r.localDC == "" {
+		r.localDC = r.session.cfg.LocalDC
+		if r.localDC == "" {
+			r.localDC = hosts[0].DataCenter()
+		}
+	}
+
+	local := make([]*HostInfo, 0, len(hosts))
+	for _, h := range hosts {
+		if h.DataCenter() == r.localDC || r.session.isContactPoint(h) {
+			local = append(local, h)
+		}
+	}
+	return local
+}
@@ -112,6 +112,9 @@
 //	}
 //	defer session.Close()
 //
+// To pick up rotated certificates without recreating the session, set SslOptions.GetConfig to return the TLS
+// configuration of each new connection, for example built from the certificates currently on disk.
+//
 // # Data-center awareness and query routing
 //
 // To route queries to local DC first, use DCAwareRoundRobinPolicy. For example, if the datacenter you
@@ -190,10 +193,20 @@
 // of prepared statements.
 // CQL protocol does not support preparing other query types.
 //
+// When the connections to a host are established again, for example after it restarted, the statements used most
+// recently are prepared again on it in the background, see ClusterConfig.ReprepareStatements.
+//
+// The cache holds up to ClusterConfig.MaxPreparedStmts statements, which can be bounded for each keyspace with
+// ClusterConfig.MaxPreparedStmtsPerKeyspace and expired when unused with ClusterConfig.PreparedStmtTTL.
+// Session.PreparedCacheStats returns its hits, misses and evictions, Session.InvalidatePrepared removes statements
+// from it and ClusterConfig.UnpreparedObserver is notified when a host does not know a cached statement.
+//
 // When using CQL protocol >= 4, it is possible to use gocql.UnsetValue as the bound value of a column.
 // This will cause the database to ignore writing the column.
 // The main advantage is the ability to keep the same prepared statement even when you don't
 // want to update some fields, where before you needed to make another prepared statement.
+// UnsetValue can also be bound by name with NamedValue and in batches, queries binding it fail
+// with ErrUnsetValueUnsupported when using older protocol versions.
 //
 // # Executing multiple queries concurrently
 //
@@ -316,6 +329,10 @@
 // With single-partition batches you can send the batch directly to the node for the partition without incurring the
 // additional network hop.
 //
+// Large batches can be split into several batches with Batch.Split, by number of statements, by size of their bound
+// values and keeping the statements of each partition together. Session.ExecuteBatchSplit reports the result of each
+// batch. Each batch is applied on its own, so the batches applied before a failure are not rolled back.
+//
 // It is also possible to pass entire BEGIN BATCH .. APPLY BATCH statement to Query.Exec.
 // There are differences how those are executed.
 // BEGIN BATCH statement passed to Query.Exec is prepared as a whole in a single statement.
@@ -342,12 +359,27 @@
 //
 // Idempotent queries are retried in case of errors based on the configured RetryPolicy.
 //
+// Batches are idempotent when marked with Batch.Idempotent or, when not marked, when all their statements are
+// idempotent, and are then retried and speculatively executed like queries, with the policies set on the batch.
+//
 // Queries can be retried even before they fail by setting a SpeculativeExecutionPolicy. The policy can
 // cause the driver to retry on a different node if the query is taking longer than a specified delay even before the
 // driver receives an error or timeout from the server. When a query is speculatively executed, the original execution
 // is still executing. The two parallel executions of the query race to return a result, the first received result will
 // be returned.
 //
+// SimpleSpeculativeExecution uses a fixed delay. PercentileSpeculativeExecution instead derives the delay from a
+// percentile of the latencies recently observed for the statement, so that it follows changes of the cluster load.
+//
+// When the context of a query has a deadline, retries and speculative executions are skipped if the time left is
+// shorter than the expected latency of the attempt: the average latency of the previous attempts of the query, or the
+// median latency of its statement measured by PercentileSpeculativeExecution. Skipped retries return a
+// DeadlineTooShortError, which matches ErrDeadlineTooShort and wraps the error of the last attempt.
+//
+// ClusterConfig.RetryBudget bounds the retries of all the queries of a session to a ratio of its successful attempts,
+// so that retries do not multiply the load of a cluster which is already failing. Retries shed by the budget return a
+// RetryBudgetExhaustedError, and are counted by Session.RetryBudgetStats.
+//
 // # User-defined types
 //
 // UDTs can be mapped (un)marshaled from/to map[string]interface{} a Go struct (or a type implementing
@@ -360,6 +392,10 @@
 //		FieldB string `cql:"b"`
 //	}
 //
+// Fields without tag are mapped by their name converted to snake case, so that FieldC is mapped to field_c, or by
+// their name. SetNameMapper changes the conversion and SetFieldNames sets the CQL field names of the fields of
+// structs which can not be tagged.
+//
 // See Example_userDefinedTypesMap, Example_userDefinedTypesStruct, ExampleUDTMarshaler, ExampleUDTUnmarshaler.
 //
 // # Metrics and tracing
@@ -369,7 +405,9 @@
 //   - QueryObserver for monitoring individual queries.
 //   - BatchObserver for monitoring batch queries.
 //   - ConnectObserver for monitoring new connections from the driver to the database.
+//   - PoolObserver for monitoring the connections of the pool of each host.
 //   - FrameHeaderObserver for monitoring individual protocol frames.
+//   - FrameObserver for debugging the request and response frames.
 //
 // CQL protocol also supports tracing of queries. When enabled, the database will write information about
 // internal events that happened during execution of the query. You can use Query.Trace to request tracing and receive
@@ -27,6 +27,7 @@ package gocql
 import (
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,19 +37,38 @@ type eventDebouncer struct {
 	mu     sync.Mutex
 	events []frame
 
+	debounceTime time.Duration
+	bufferSize   int
+	onDropped    func(name string)
+
 	callback func([]frame)
 	quit     chan struct{}
 
 	logger StdLogger
 }
 
-func newEventDebouncer(name string, eventHandler func([]frame), logger StdLogger) *eventDebouncer {
+// newEventDebouncer returns a debouncer calling eventHandler with the events
+// received until none is received for debounceTime, buffering up to bufferSize
+// events. Zero values use the default debounce time and buffer size. onDropped,
+// if not nil, is called with the name of the debouncer for each dropped event.
+func newEventDebouncer(name string, eventHandler func([]frame), logger StdLogger,
+	debounceTime time.Duration, bufferSize int, onDropped func(name string)) *eventDebouncer {
+	if debounceTime <= 0 {
+		debounceTime = eventDebounceTime
+	}
+	if bufferSize <= 0 {
+		bufferSize = eventBufferSize
+	}
+
 	e := &eventDebouncer{
-		name:     name,
-		quit:     make(chan struct{}),
-		timer:    time.NewTimer(eventDebounceTime),
-		callback: eventHandler,
-		logger:   logger,
+		name:         name,
+		quit:         make(chan struct{}),
+		timer:        time.NewTimer(debounceTime),
+		debounceTime: debounceTime,
+		bufferSize:   bufferSize,
+		onDropped:    onDropped,
+		callback:     eventHandler,
+		logger:       logger,
 	}
 	e.timer.Stop()
 	go e.flusher()
@@ -89,18 +109,20 @@ func (e *eventDebouncer) flush() {
 	// the callback multiple times, probably a bad idea. In this case we could drop
 	// frames?
 	go e.callback(e.events)
-	e.events = make([]frame, 0, eventBufferSize)
+	e.events = make([]frame, 0, e.bufferSize)
 }
 
 func (e *eventDebouncer) debounce(frame frame) {
 	e.mu.Lock()
-	e.timer.Reset(eventDebounceTime)
+	e.timer.Reset(e.debounceTime)
 
-	// TODO: probably need a warning to track if this threshold is too low
-	if len(e.events) < eventBufferSize {
+	if len(e.events) < e.bufferSize {
 		e.events = append(e.events, frame)
 	} else {
 		e.logger.Printf("%s: buffer full, dropping event frame: %s", e.name, frame)
+		if e.onDropped != nil {
+			e.onDropped(e.name)
+		}
 	}
 
 	e.mu.Unlock()
@@ -113,9 +135,7 @@ func (s *Session) handleEvent(framer *framer) {
 		return
 	}
 
-	if gocqlDebug {
-		s.logger.Printf("gocql: handling frame: %v\n", frame)
-	}
+	s.debugf("gocql: handling frame: %v\n", frame)
 
 	switch f := frame.(type) {
 	case *schemaChangeKeyspace, *schemaChangeFunction,
@@ -132,22 +152,84 @@ func (s *Session) handleEvent(framer *framer) {
 func (s *Session) handleSchemaEvent(frames []frame) {
 	// TODO: debounce events
 	for _, frame := range frames {
+		var event SchemaChangeEvent
 		switch f := frame.(type) {
 		case *schemaChangeKeyspace:
 			s.schemaDescriber.clearSchema(f.keyspace)
 			s.handleKeyspaceChange(f.keyspace, f.change)
+			event = SchemaChangeEvent{Change: f.change, Target: "KEYSPACE", Keyspace: f.keyspace}
 		case *schemaChangeTable:
 			s.schemaDescriber.clearSchema(f.keyspace)
+			event = SchemaChangeEvent{Change: f.change, Target: "TABLE", Keyspace: f.keyspace, Name: f.object}
 		case *schemaChangeAggregate:
 			s.schemaDescriber.clearSchema(f.keyspace)
+			event = SchemaChangeEvent{Change: f.change, Target: "AGGREGATE", Keyspace: f.keyspace, Name: f.name, Args: f.args}
 		case *schemaChangeFunction:
 			s.schemaDescriber.clearSchema(f.keyspace)
+			event = SchemaChangeEvent{Change: f.change, Target: "FUNCTION", Keyspace: f.keyspace, Name: f.name, Args: f.args}
 		case *schemaChangeType:
 			s.schemaDescriber.clearSchema(f.keyspace)
+			event = SchemaChangeEvent{Change: f.change, Target: "TYPE", Keyspace: f.keyspace, Name: f.object}
+		default:
+			continue
+		}
+		for _, l := range s.schemaListeners.get() {
+			l.OnSchemaChange(event)
 		}
 	}
 }
 
+// SchemaChangeEvent is a schema change pushed by the cluster.
+type SchemaChangeEvent struct {
+	// Change is CREATED, UPDATED or DROPPED.
+	Change string
+	// Target is KEYSPACE, TABLE, TYPE, FUNCTION or AGGREGATE.
+	Target   string
+	Keyspace string
+	// Name is the name of the table, type, function or aggregate, empty for
+	// keyspaces.
+	Name string
+	// Args are the argument types of the function or aggregate.
+	Args []string
+}
+
+// SchemaChangeListener is notified of the schema changes pushed by the
+// cluster, see Session.RegisterSchemaChangeListener.
+type SchemaChangeListener interface {
+	// OnSchemaChange is called after the cached metadata of the keyspace has
+	// been cleared, so the metadata read by the listener reflects the change.
+	// It is called from the goroutine handling the events and must not block.
+	OnSchemaChange(event SchemaChangeEvent)
+}
+
+// schemaListenerList is a copy on write list of schema change listeners.
+type schemaListenerList struct {
+	mu        sync.Mutex
+	listeners atomic.Value // []SchemaChangeListener
+}
+
+func (t *schemaListenerList) add(l SchemaChangeListener) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev := t.get()
+	listeners := make([]SchemaChangeListener, len(prev), len(prev)+1)
+	copy(listeners, prev)
+	t.listeners.Store(append(listeners, l))
+}
+
+func (t *schemaListenerList) get() []SchemaChangeListener {
+	listeners, _ := t.listeners.Load().([]SchemaChangeListener)
+	return listeners
+}
+
+// RegisterSchemaChangeListener registers l to be notified of the schema
+// changes from then on, for example to invalidate caches built on the schema.
+// Schema changes are not received if ClusterConfig.Events.DisableSchemaEvents
+// is set.
+func (s *Session) RegisterSchemaChangeListener(l SchemaChangeListener) {
+	s.schemaListeners.add(l)
+}
+
 func (s *Session) handleKeyspaceChange(keyspace, change string) {
 	s.control.awaitSchemaAgreement()
 	s.policy.KeyspaceChanged(KeyspaceUpdateEvent{Keyspace: keyspace, Change: change})
@@ -193,9 +275,7 @@ func (s *Session) handleNodeEvent(frames []frame) {
 	}
 
 	for _, f := range sEvents {
-		if gocqlDebug {
-			s.logger.Printf("gocql: dispatching status change event: %+v\n", f)
-		}
+		s.debugf("gocql: dispatching status change event: %+v\n", f)
 
 		// ignore events we received if they were disabled
 		// see https://github.com/apache/cassandra-gocql-driver/issues/1591
@@ -212,10 +292,62 @@ func (s *Session) handleNodeEvent(frames []frame) {
 	}
 }
 
-func (s *Session) handleNodeUp(eventIp net.IP, eventPort int) {
-	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeUp: %s:%d\n", eventIp.String(), eventPort)
+// TopologyListener is notified of the changes of the cluster topology seen by
+// a session, see Session.RegisterTopologyListener. The methods are called from
+// the goroutines handling the events and must not block. A listener may be
+// notified more than once that a host is up or down.
+type TopologyListener interface {
+	// OnHostAdded is called when a host joins the cluster, or when its
+	// address changes, after OnHostRemoved for its previous address.
+	OnHostAdded(host *HostInfo)
+	// OnHostRemoved is called when a host leaves the cluster.
+	OnHostRemoved(host *HostInfo)
+	// OnHostUp is called when the session connects to a host.
+	OnHostUp(host *HostInfo)
+	// OnHostDown is called when a host is reported down.
+	OnHostDown(host *HostInfo)
+}
+
+// topologyListenerList is a copy on write list of topology listeners.
+type topologyListenerList struct {
+	mu        sync.Mutex
+	listeners atomic.Value // []TopologyListener
+}
+
+func (t *topologyListenerList) add(l TopologyListener) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev := t.get()
+	listeners := make([]TopologyListener, len(prev), len(prev)+1)
+	copy(listeners, prev)
+	t.listeners.Store(append(listeners, l))
+}
+
+func (t *topologyListenerList) get() []TopologyListener {
+	listeners, _ := t.listeners.Load().([]TopologyListener)
+	return listeners
+}
+
+// RegisterTopologyListener registers l to be notified of the hosts added to or
+// removed from the cluster, and of the hosts going up or down, from then on.
+func (s *Session) RegisterTopologyListener(l TopologyListener) {
+	s.topologyListeners.add(l)
+}
+
+func (s *Session) notifyHostAdded(host *HostInfo) {
+	for _, l := range s.topologyListeners.get() {
+		l.OnHostAdded(host)
+	}
+}
+
+func (s *Session) notifyHostRemoved(host *HostInfo) {
+	for _, l := range s.topologyListeners.get() {
+		l.OnHostRemoved(host)
 	}
+}
+
+func (s *Session) handleNodeUp(eventIp net.IP, eventPort int) {
+	s.debugf("gocql: Session.handleNodeUp: %s:%d\n", eventIp.String(), eventPort)
 
 	host, ok := s.ring.getHostByIP(eventIp.String())
 	if !ok {
@@ -240,31 +372,40 @@ func (s *Session) startPoolFill(host *HostInfo) {
 }
 
 func (s *Session) handleNodeConnected(host *HostInfo) {
-	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeConnected: %s:%d\n", host.ConnectAddress(), host.Port())
-	}
+	s.debugf("gocql: Session.handleNodeConnected: %s:%d\n", host.ConnectAddress(), host.Port())
 
 	host.setState(NodeUp)
 
 	if !s.cfg.filterHost(host) {
 		s.policy.HostUp(host)
+		for _, l := range s.topologyListeners.get() {
+			l.OnHostUp(host)
+		}
+		s.reprepare(host)
 	}
 }
 
 func (s *Session) handleNodeDown(ip net.IP, port int) {
-	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeDown: %s:%d\n", ip.String(), port)
-	}
+	s.debugf("gocql: Session.handleNodeDown: %s:%d\n", ip.String(), port)
 
 	host, ok := s.ring.getHostByIP(ip.String())
 	if ok {
-		host.setState(NodeDown)
-		if s.cfg.filterHost(host) {
-			return
-		}
+		s.hostDown(host)
+	}
+}
+
+// hostDown marks host down, notifying the policy and the topology listeners,
+// and removes its connection pool.
+func (s *Session) hostDown(host *HostInfo) {
+	host.setState(NodeDown)
+	if s.cfg.filterHost(host) {
+		return
+	}
 
-		s.policy.HostDown(host)
-		hostID := host.HostID()
-		s.pool.removeHost(hostID)
+	s.policy.HostDown(host)
+	for _, l := range s.topologyListeners.get() {
+		l.OnHostDown(host)
 	}
+	hostID := host.HostID()
+	s.pool.removeHost(hostID)
 }
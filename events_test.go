@@ -28,6 +28,7 @@ import (
 	"net"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestEventDebounce(t *testing.T) {
@@ -39,7 +40,7 @@ func TestEventDebounce(t *testing.T) {
 	debouncer := newEventDebouncer("testDebouncer", func(events []frame) {
 		defer wg.Done()
 		eventsSeen += len(events)
-	}, &defaultLogger{})
+	}, &defaultLogger{}, 0, 0, nil)
 	defer debouncer.stop()
 
 	for i := 0; i < eventCount; i++ {
@@ -55,3 +56,38 @@ func TestEventDebounce(t *testing.T) {
 		t.Fatalf("expected to see %d events but got %d", eventCount, eventsSeen)
 	}
 }
+
+func TestEventDebounceDropped(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		dropped []string
+		seen    = make(chan int, 1)
+	)
+	debouncer := newEventDebouncer("testDebouncer", func(events []frame) {
+		seen <- len(events)
+	}, nopLogger{}, 10*time.Millisecond, 2, func(name string) {
+		mu.Lock()
+		dropped = append(dropped, name)
+		mu.Unlock()
+	})
+	defer debouncer.stop()
+
+	for i := 0; i < 3; i++ {
+		debouncer.debounce(&statusChangeEventFrame{change: "UP", host: net.IPv4(127, 0, 0, 1), port: 9042})
+	}
+
+	select {
+	case n := <-seen:
+		if n != 2 {
+			t.Fatalf("expected 2 buffered events, got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the events to be flushed after the debounce time")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dropped) != 1 || dropped[0] != "testDebouncer" {
+		t.Fatalf("expected one dropped event, got %v", dropped)
+	}
+}
@@ -72,10 +72,10 @@ func WhiteListHostFilter(hosts ...string) HostFilter {
 
 	m := make(map[string]bool, len(hostInfos))
 	for _, host := range hostInfos {
-		m[host.ConnectAddress().String()] = true
+		m[host.addressKey()] = true
 	}
 
 	return HostFilterFunc(func(host *HostInfo) bool {
-		return m[host.ConnectAddress().String()]
+		return m[host.addressKey()]
 	})
 }
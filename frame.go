@@ -44,7 +44,13 @@ type unsetColumn struct{}
 // The main advantage is the ability to keep the same prepared statement even when you don't
 // want to update some fields, where before you needed to make another prepared statement.
 //
-// UnsetValue is only available when using the version 4 of the protocol.
+// UnsetValue can be bound positionally, with NamedValue, by the functions of
+// Query.Bind and Batch.Bind, and in the statements of batches. It cannot be
+// used within collections, tuples or user-defined types.
+//
+// UnsetValue is only available with the version 4 of the protocol and later,
+// the execution of queries binding it fails with ErrUnsetValueUnsupported
+// with earlier versions.
 var UnsetValue = unsetColumn{}
 
 type namedValue struct {
@@ -304,6 +310,16 @@ func (s SerialConsistency) String() string {
 	}
 }
 
+// validateSerialConsistency returns an error wrapping ErrSerialConsistency if
+// cons is set and is neither Serial nor LocalSerial.
+func validateSerialConsistency(cons SerialConsistency) error {
+	switch cons {
+	case 0, Serial, LocalSerial:
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrSerialConsistency, cons)
+}
+
 func (s SerialConsistency) MarshalText() (text []byte, err error) {
 	return []byte(s.String()), nil
 }
@@ -382,6 +398,49 @@ type FrameHeaderObserver interface {
 	ObserveFrameHeader(context.Context, ObservedFrameHeader)
 }
 
+// ObservedFrame describes a whole frame written to or read from a connection.
+type ObservedFrame struct {
+	// Host is the host of the connection the frame was written to or read from.
+	Host *HostInfo
+	// Request is true for frames written to the host and false for frames read from it.
+	Request bool
+
+	Version protoVersion
+	Flags   byte
+	Stream  int16
+	Opcode  frameOp
+	// Length is the size of the frame body on the wire, after compression.
+	Length int32
+	// Compressed reports whether the frame body was compressed.
+	Compressed bool
+
+	// Time is when the frame was written or when its body was read.
+	Time time.Time
+	// Latency is, for responses, the time elapsed since the request on the same
+	// stream was queued for writing. It is zero for requests and server events.
+	Latency time.Duration
+}
+
+func (f ObservedFrame) String() string {
+	dir := "response"
+	if f.Request {
+		dir = "request"
+	}
+	return fmt.Sprintf("[observed %s version=%s flags=0x%x stream=%d op=%s length=%d latency=%v]",
+		dir, f.Version, f.Flags, f.Stream, f.Opcode, f.Length, f.Latency)
+}
+
+// FrameObserver is the interface implemented by wire level frame observers.
+// Unlike FrameHeaderObserver it sees both request and response frames, which
+// makes it suitable for debugging protocol issues. Observers are called on the
+// connection's read and write paths, so they should return quickly.
+//
+// Experimental, this interface and use may change
+type FrameObserver interface {
+	// ObserveFrame gets called on every frame written or fully read.
+	ObserveFrame(context.Context, ObservedFrame)
+}
+
 // a framer is responsible for reading, writing and parsing frames on a single stream
 type framer struct {
 	proto byte
@@ -402,6 +461,16 @@ type framer struct {
 	buf []byte
 
 	customPayload map[string][]byte
+
+	// minCompressSize is the body size below which outgoing frames are sent
+	// uncompressed.
+	minCompressSize int
+
+	// customTypesAsBytes marks the custom types read to be read as []byte.
+	customTypesAsBytes bool
+
+	// codecs unmarshals the columns of the rows read.
+	codecs *TypeCodecs
 }
 
 func newFramer(compressor Compressor, version byte) *framer {
@@ -493,6 +562,12 @@ func (f *framer) trace() {
 	f.flags |= flagTracing
 }
 
+// noCompress disables compression of the outgoing frame, the compressor is
+// still used to decompress the response.
+func (f *framer) noCompress() {
+	f.flags &^= flagCompress
+}
+
 // explicitly enables the custom payload flag
 func (f *framer) payload() {
 	f.flags |= flagCustomPayload
@@ -768,12 +843,15 @@ func (f *framer) finish() error {
 		return ErrFrameTooBig
 	}
 
+	if f.buf[1]&flagCompress == flagCompress && len(f.buf)-f.headSize < f.minCompressSize {
+		f.buf[1] &^= flagCompress
+	}
+
 	if f.buf[1]&flagCompress == flagCompress {
 		if f.compres == nil {
 			panic("compress flag set with no compressor")
 		}
 
-		// TODO: only compress frames which are big enough
 		compressed, err := f.compres.Encode(f.buf[f.headSize:])
 		if err != nil {
 			return err
@@ -787,6 +865,17 @@ func (f *framer) finish() error {
 	return nil
 }
 
+// requestHeader returns the header of the finished outgoing frame in f.buf.
+func (f *framer) requestHeader(stream int) frameHeader {
+	return frameHeader{
+		version: protoVersion(f.buf[0]),
+		flags:   f.buf[1],
+		stream:  stream,
+		op:      frameOp(f.buf[f.headSize-5]),
+		length:  len(f.buf) - f.headSize,
+	}
+}
+
 func (f *framer) writeTo(w io.Writer) error {
 	_, err := w.Write(f.buf)
 	return err
@@ -883,6 +972,8 @@ func (f *framer) readTypeInfo() TypeInfo {
 		simple.custom = f.readString()
 		if cassType := getApacheCassandraType(simple.custom); cassType != TypeCustom {
 			simple.typ = cassType
+		} else {
+			simple.asBytes = f.customTypesAsBytes
 		}
 	}
 
@@ -1566,6 +1657,9 @@ type writeQueryFrame struct {
 
 	// v4+
 	customPayload map[string][]byte
+
+	// noCompress disables compression of the frame.
+	noCompress bool
 }
 
 func (w *writeQueryFrame) String() string {
@@ -1573,6 +1667,9 @@ func (w *writeQueryFrame) String() string {
 }
 
 func (w *writeQueryFrame) buildFrame(framer *framer, streamID int) error {
+	if w.noCompress {
+		framer.noCompress()
+	}
 	return framer.writeQueryFrame(streamID, w.statement, &w.params, w.customPayload)
 }
 
@@ -1604,6 +1701,9 @@ type writeExecuteFrame struct {
 
 	// v4+
 	customPayload map[string][]byte
+
+	// noCompress disables compression of the frame.
+	noCompress bool
 }
 
 func (e *writeExecuteFrame) String() string {
@@ -1611,6 +1711,9 @@ func (e *writeExecuteFrame) String() string {
 }
 
 func (e *writeExecuteFrame) buildFrame(fr *framer, streamID int) error {
+	if e.noCompress {
+		fr.noCompress()
+	}
 	return fr.writeExecuteFrame(streamID, e.preparedID, &e.params, &e.customPayload)
 }
 
@@ -1659,9 +1762,15 @@ type writeBatchFrame struct {
 
 	//v4+
 	customPayload map[string][]byte
+
+	// noCompress disables compression of the frame.
+	noCompress bool
 }
 
 func (w *writeBatchFrame) buildFrame(framer *framer, streamID int) error {
+	if w.noCompress {
+		framer.noCompress()
+	}
 	return framer.writeBatchFrame(streamID, w, w.customPayload)
 }
 
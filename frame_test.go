@@ -27,6 +27,7 @@ package gocql
 import (
 	"bytes"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -127,3 +128,63 @@ func TestFrameReadTooLong(t *testing.T) {
 		t.Fatalf("expected to get header %v got %v", opReady, head.op)
 	}
 }
+
+func TestFrameNoCompress(t *testing.T) {
+	frames := []struct {
+		name  string
+		frame frameBuilder
+	}{
+		{"query", &writeQueryFrame{statement: "SELECT * FROM t", noCompress: true}},
+		{"execute", &writeExecuteFrame{preparedID: []byte{1, 2, 3}, noCompress: true}},
+		{"batch", &writeBatchFrame{statements: []batchStatment{{statement: "INSERT INTO t (a) VALUES (1)"}}, noCompress: true}},
+	}
+
+	for _, test := range frames {
+		t.Run(test.name, func(t *testing.T) {
+			framer := newFramer(SnappyCompressor{}, protoVersion4)
+			if err := test.frame.buildFrame(framer, 1); err != nil {
+				t.Fatal(err)
+			}
+			if framer.buf[1]&flagCompress != 0 {
+				t.Fatal("expected the compress flag to be cleared")
+			}
+			if framer.compres == nil {
+				t.Fatal("expected the compressor to be kept to read the response")
+			}
+		})
+	}
+
+	framer := newFramer(SnappyCompressor{}, protoVersion4)
+	if err := (&writeQueryFrame{statement: "SELECT * FROM t"}).buildFrame(framer, 1); err != nil {
+		t.Fatal(err)
+	}
+	if framer.buf[1]&flagCompress == 0 {
+		t.Fatal("expected the frame to be compressed by default")
+	}
+}
+
+func TestFrameMinCompressSize(t *testing.T) {
+	small := &writeQueryFrame{statement: "SELECT * FROM t"}
+	large := &writeQueryFrame{statement: "SELECT * FROM t WHERE " + strings.Repeat("a = 1 AND ", 100) + "a = 1"}
+
+	framer := newFramer(SnappyCompressor{}, protoVersion4)
+	framer.minCompressSize = 256
+	if err := small.buildFrame(framer, 1); err != nil {
+		t.Fatal(err)
+	}
+	if framer.buf[1]&flagCompress != 0 {
+		t.Fatal("expected the small frame to be sent uncompressed")
+	}
+	if framer.compres == nil {
+		t.Fatal("expected the compressor to be kept to read the response")
+	}
+
+	framer = newFramer(SnappyCompressor{}, protoVersion4)
+	framer.minCompressSize = 256
+	if err := large.buildFrame(framer, 1); err != nil {
+		t.Fatal(err)
+	}
+	if framer.buf[1]&flagCompress == 0 {
+		t.Fatal("expected the large frame to be compressed")
+	}
+}
@@ -0,0 +1,232 @@
+//go:build ccm
+// +build ccm
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package gocqltest starts Cassandra or Scylla clusters for integration tests,
+// using ccm (https://github.com/riptano/ccm), which must be in the PATH. Like
+// the rest of the ccm based tooling of gocql, it is only built with the ccm
+// build tag.
+//
+//	func TestMain(m *testing.M) {
+//		cluster, err := gocqltest.StartCluster(context.Background(), gocqltest.Options{Nodes: 3})
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		code := m.Run()
+//		cluster.Remove()
+//		os.Exit(code)
+//	}
+//
+// Tests then create sessions from cluster.ClusterConfig().
+package gocqltest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/internal/ccm"
+)
+
+// Options describe the cluster to start.
+type Options struct {
+	// Name of the ccm cluster, replacing any existing cluster of the same name.
+	// Default: gocqltest
+	Name string
+
+	// Version of Cassandra or Scylla to install.
+	// Default: 4.1.3
+	Version string
+
+	// Nodes is the number of nodes of the cluster.
+	// Default: 1
+	Nodes int
+
+	// Scylla starts a Scylla cluster rather than a Cassandra one.
+	Scylla bool
+
+	// Config holds "key: value" options applied to the configuration of every
+	// node before starting the cluster.
+	Config []string
+
+	// ReadyTimeout is how long to wait for every node to accept CQL queries
+	// once the cluster is started.
+	// Default: 2 minutes
+	ReadyTimeout time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if o.Name == "" {
+		o.Name = "gocqltest"
+	}
+	if o.Version == "" {
+		o.Version = "4.1.3"
+	}
+	if o.Nodes <= 0 {
+		o.Nodes = 1
+	}
+	if o.ReadyTimeout == 0 {
+		o.ReadyTimeout = 2 * time.Minute
+	}
+}
+
+// nativePort is the native protocol port ccm configures the nodes with, each
+// node listening on its own address.
+const nativePort = 9042
+
+// Cluster is a cluster started by StartCluster.
+type Cluster struct {
+	name string
+
+	// Hosts are the addresses of the nodes, without port.
+	Hosts []string
+}
+
+// StartCluster creates and starts a cluster, then waits until the native
+// protocol port of every node is open and accepts CQL queries. The cluster is
+// removed if it fails to become ready.
+func StartCluster(ctx context.Context, opts Options) (*Cluster, error) {
+	opts.setDefaults()
+
+	var args []string
+	if opts.Scylla {
+		args = append(args, "--scylla")
+	}
+
+	ccm.Remove(opts.Name)
+	if err := ccm.Create(opts.Name, opts.Version, opts.Nodes, args...); err != nil {
+		return nil, fmt.Errorf("gocqltest: unable to create cluster: %v", err)
+	}
+
+	c := &Cluster{name: opts.Name}
+	if err := c.start(ctx, opts); err != nil {
+		c.Remove()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Start starts a cluster like StartCluster, failing tb if the cluster does
+// not become ready. Callers are responsible for removing the cluster.
+func Start(tb testing.TB, opts Options) *Cluster {
+	tb.Helper()
+	c, err := StartCluster(context.Background(), opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return c
+}
+
+func (c *Cluster) start(ctx context.Context, opts Options) error {
+	if len(opts.Config) > 0 {
+		if err := ccm.UpdateConf(opts.Config...); err != nil {
+			return fmt.Errorf("gocqltest: unable to update configuration: %v", err)
+		}
+	}
+	if err := ccm.Start(); err != nil {
+		return fmt.Errorf("gocqltest: unable to start cluster: %v", err)
+	}
+
+	status, err := ccm.Status()
+	if err != nil {
+		return fmt.Errorf("gocqltest: unable to get cluster status: %v", err)
+	}
+	for _, host := range status {
+		c.Hosts = append(c.Hosts, host.Addr)
+	}
+	sort.Strings(c.Hosts)
+
+	ctx, cancel := context.WithTimeout(ctx, opts.ReadyTimeout)
+	defer cancel()
+	for _, host := range c.Hosts {
+		if err := c.waitReady(ctx, host); err != nil {
+			return fmt.Errorf("gocqltest: host %s is not ready: %v", host, err)
+		}
+	}
+	return nil
+}
+
+// waitReady waits until the native protocol port of host is open, then until
+// host answers a CQL query.
+func (c *Cluster) waitReady(ctx context.Context, host string) error {
+	addr := net.JoinHostPort(host, strconv.Itoa(nativePort))
+	var dialer net.Dialer
+	err := retry(ctx, func() error {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+	if err != nil {
+		return err
+	}
+
+	return retry(ctx, func() error {
+		cfg := c.ClusterConfig()
+		cfg.Hosts = []string{host}
+		cfg.DisableInitialHostLookup = true
+		session, err := cfg.CreateSession()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		var version string
+		return session.Query("SELECT release_version FROM system.local").WithContext(ctx).Scan(&version)
+	})
+}
+
+// retry calls fn every second until it succeeds or ctx is done, returning the
+// last error of fn in the latter case.
+func retry(ctx context.Context, fn func() error) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// ClusterConfig returns a configuration connecting to every node of the
+// cluster, with timeouts suited to freshly started clusters.
+func (c *Cluster) ClusterConfig() *gocql.ClusterConfig {
+	cfg := gocql.NewCluster(c.Hosts...)
+	cfg.Port = nativePort
+	cfg.Timeout = 30 * time.Second
+	cfg.ConnectTimeout = 30 * time.Second
+	return cfg
+}
+
+// Remove stops and removes the cluster.
+func (c *Cluster) Remove() error {
+	return ccm.Remove(c.name)
+}
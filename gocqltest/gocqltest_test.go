@@ -0,0 +1,45 @@
+//go:build ccm
+// +build ccm
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocqltest
+
+import (
+	"testing"
+)
+
+func TestStartCluster(t *testing.T) {
+	c := Start(t, Options{Name: "gocqltest", Nodes: 2})
+	defer c.Remove()
+
+	if len(c.Hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %v", c.Hosts)
+	}
+
+	session, err := c.ClusterConfig().CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	if hosts := session.GetHosts(); len(hosts) != 2 {
+		t.Fatalf("expected the session to discover 2 hosts, got %d", len(hosts))
+	}
+}
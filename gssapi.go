@@ -0,0 +1,206 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// GSSAPIClient is the client side of a GSSAPI security context, for example
+// implemented with github.com/jcmturner/gokrb5 by the
+// github.com/gocql/gocql/krb5 package, or with a binding of the system GSSAPI
+// library. It provides the Kerberos credentials of the application.
+type GSSAPIClient interface {
+	// InitSecContext initiates, or continues, establishing the security
+	// context with the service principal target, given the last token
+	// received from the node, nil for the first call. It returns the token
+	// to send to the node and whether the context is established.
+	InitSecContext(target string, token []byte) (out []byte, established bool, err error)
+
+	// Wrap wraps msg to send it to the node with the established context.
+	Wrap(msg []byte) ([]byte, error)
+
+	// Unwrap unwraps a token received from the node with the established
+	// context.
+	Unwrap(token []byte) ([]byte, error)
+}
+
+// GSSAPIAuthenticator authenticates with Kerberos, using the SASL GSSAPI
+// mechanism of RFC 4752, to the DSE authenticator and the Kerberos
+// authenticators of Cassandra.
+//
+// A new GSSAPIClient is created for each connection, so that the connections
+// created after the credentials of the application were renewed use them.
+// If the client implements io.Closer, it is closed once the connection is
+// authenticated or its authentication failed.
+type GSSAPIAuthenticator struct {
+	// NewClient returns the GSSAPI client authenticating a connection.
+	NewClient func() (GSSAPIClient, error)
+
+	// Target is the service principal of the node, for example
+	// dse/node1.example.com@EXAMPLE.COM. See GSSAPIAuthProvider to derive
+	// it from the hostname of each node.
+	Target string
+
+	// AuthorizationID, if set, is the role to be authorized as instead of the
+	// authenticated principal, if it is allowed to by the cluster.
+	AuthorizationID string
+
+	// AllowedAuthenticators are the server authenticators to authenticate
+	// with, the ones supporting Kerberos that are known to gocql if empty.
+	AllowedAuthenticators []string
+}
+
+var defaultGSSAPIAuthenticators = []string{
+	"com.datastax.bdp.cassandra.auth.DseAuthenticator",
+	"com.datastax.bdp.cassandra.auth.KerberosAuthenticator",
+	"com.instaclustr.cassandra.auth.KerberosAuthenticator",
+}
+
+const dseAuthenticator = "com.datastax.bdp.cassandra.auth.DseAuthenticator"
+
+var (
+	gssapiMechanism    = []byte("GSSAPI")
+	gssapiInitialToken = []byte("GSSAPI-START")
+)
+
+// GSSAPIAuthProvider returns a ClusterConfig.AuthProvider authenticating with
+// Kerberos to the service principal service/hostname of each node, where the
+// hostname is looked up in the DNS if the node is only known by its address.
+func GSSAPIAuthProvider(service string, newClient func() (GSSAPIClient, error)) func(h *HostInfo) (Authenticator, error) {
+	return func(h *HostInfo) (Authenticator, error) {
+		hostname, _, err := net.SplitHostPort(h.HostnameAndPort())
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(hostname) != nil {
+			names, err := net.LookupAddr(hostname)
+			if err != nil {
+				return nil, fmt.Errorf("unable to look up the hostname of %s: %v", hostname, err)
+			} else if len(names) == 0 {
+				return nil, fmt.Errorf("no hostname found for %s", hostname)
+			}
+			hostname = strings.TrimSuffix(names[0], ".")
+		}
+
+		return GSSAPIAuthenticator{
+			NewClient: newClient,
+			Target:    service + "/" + hostname,
+		}, nil
+	}
+}
+
+func (g GSSAPIAuthenticator) Challenge(req []byte) ([]byte, Authenticator, error) {
+	allowed := g.AllowedAuthenticators
+	if len(allowed) == 0 {
+		allowed = defaultGSSAPIAuthenticators
+	}
+	if !approve(string(req), allowed) {
+		return nil, nil, fmt.Errorf("unexpected authenticator %q", req)
+	}
+
+	client, err := g.NewClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create GSSAPI client: %v", err)
+	}
+	exchange := &gssapiExchange{GSSAPIAuthenticator: g, client: client}
+
+	// the DSE authenticator supports several mechanisms, it starts the
+	// exchange once told which one.
+	if string(req) == dseAuthenticator {
+		return gssapiMechanism, exchange, nil
+	}
+	resp, err := exchange.next(nil)
+	if err != nil {
+		exchange.Close()
+		return nil, nil, err
+	}
+	return resp, exchange, nil
+}
+
+func (g GSSAPIAuthenticator) Success(data []byte) error {
+	return nil
+}
+
+// gssapiExchange is the state of the authentication of a connection.
+type gssapiExchange struct {
+	GSSAPIAuthenticator
+	client      GSSAPIClient
+	established bool
+	closed      bool
+}
+
+func (e *gssapiExchange) Challenge(req []byte) ([]byte, Authenticator, error) {
+	if bytes.Equal(req, gssapiInitialToken) {
+		req = nil
+	}
+	resp, err := e.next(req)
+	if err != nil {
+		e.Close()
+		return nil, nil, err
+	}
+	return resp, e, nil
+}
+
+func (e *gssapiExchange) next(token []byte) ([]byte, error) {
+	if !e.established {
+		out, established, err := e.client.InitSecContext(e.Target, token)
+		if err != nil {
+			return nil, fmt.Errorf("unable to establish GSSAPI context: %v", err)
+		}
+		e.established = established
+		return out, nil
+	}
+
+	// negotiate the security layer, see RFC 4752 section 3.1. The
+	// connection is already protected by TLS if needed, so no security
+	// layer is used.
+	msg, err := e.client.Unwrap(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap GSSAPI security layer offer: %v", err)
+	} else if len(msg) != 4 {
+		return nil, fmt.Errorf("unexpected GSSAPI security layer offer of %d bytes", len(msg))
+	} else if msg[0]&1 == 0 {
+		return nil, errors.New("node requires a GSSAPI security layer")
+	}
+	resp := append([]byte{1, 0, 0, 0}, e.AuthorizationID...)
+	return e.client.Wrap(resp)
+}
+
+func (e *gssapiExchange) Success(data []byte) error {
+	return e.Close()
+}
+
+// Close closes the client once the authentication is over, it is called by
+// the connection if the authentication failed.
+func (e *gssapiExchange) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if c, ok := e.client.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
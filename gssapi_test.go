@@ -0,0 +1,180 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fakeGSSAPIClient establishes its context after two tokens and wraps the
+// messages by prefixing them with "wrapped:". It fails the calls of the
+// method named by fail.
+type fakeGSSAPIClient struct {
+	targets []string
+	tokens  [][]byte
+	closed  bool
+	fail    string
+}
+
+func (c *fakeGSSAPIClient) InitSecContext(target string, token []byte) ([]byte, bool, error) {
+	if c.fail == "InitSecContext" {
+		return nil, false, errors.New("no credentials")
+	}
+	c.targets = append(c.targets, target)
+	c.tokens = append(c.tokens, token)
+	if len(c.tokens) == 1 {
+		return []byte("ap-req"), false, nil
+	}
+	return nil, true, nil
+}
+
+func (c *fakeGSSAPIClient) Wrap(msg []byte) ([]byte, error) {
+	return append([]byte("wrapped:"), msg...), nil
+}
+
+func (c *fakeGSSAPIClient) Unwrap(token []byte) ([]byte, error) {
+	if c.fail == "Unwrap" {
+		return nil, errors.New("bad checksum")
+	}
+	return bytes.TrimPrefix(token, []byte("wrapped:")), nil
+}
+
+func (c *fakeGSSAPIClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestGSSAPIAuthenticator(t *testing.T) {
+	tests := []struct {
+		class string
+		// challenges are the challenges sent by the node, the first one is
+		// the response to the initial response of the authenticator.
+		challenges []string
+		responses  []string
+	}{
+		{
+			class:      "com.datastax.bdp.cassandra.auth.DseAuthenticator",
+			challenges: []string{"GSSAPI-START", "ap-rep", "wrapped:\x07\x00\x10\x00"},
+			responses:  []string{"GSSAPI", "ap-req", "", "wrapped:\x01\x00\x00\x00app"},
+		},
+		{
+			class:      "com.instaclustr.cassandra.auth.KerberosAuthenticator",
+			challenges: []string{"ap-rep", "wrapped:\x01\x00\x10\x00"},
+			responses:  []string{"ap-req", "", "wrapped:\x01\x00\x00\x00app"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.class, func(t *testing.T) {
+			client := &fakeGSSAPIClient{}
+			var auth Authenticator = GSSAPIAuthenticator{
+				NewClient:       func() (GSSAPIClient, error) { return client, nil },
+				Target:          "dse/node1.example.com",
+				AuthorizationID: "app",
+			}
+
+			resp, auth, err := auth.Challenge([]byte(test.class))
+			if err != nil {
+				t.Fatal(err)
+			}
+			responses := []string{string(resp)}
+			for _, challenge := range test.challenges {
+				resp, auth, err = auth.Challenge([]byte(challenge))
+				if err != nil {
+					t.Fatal(err)
+				}
+				responses = append(responses, string(resp))
+			}
+			if err := auth.Success(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(responses) != len(test.responses) {
+				t.Fatalf("expected responses %q, got %q", test.responses, responses)
+			}
+			for i := range responses {
+				if responses[i] != test.responses[i] {
+					t.Errorf("expected responses %q, got %q", test.responses, responses)
+					break
+				}
+			}
+			if client.tokens[0] != nil || string(client.tokens[1]) != "ap-rep" {
+				t.Errorf("unexpected tokens passed to the client %q", client.tokens)
+			}
+			for _, target := range client.targets {
+				if target != "dse/node1.example.com" {
+					t.Errorf("unexpected target %q", target)
+				}
+			}
+			if !client.closed {
+				t.Error("expected the client to be closed once authenticated")
+			}
+		})
+	}
+}
+
+func TestGSSAPIAuthenticatorErrors(t *testing.T) {
+	client := &fakeGSSAPIClient{}
+	auth := GSSAPIAuthenticator{
+		NewClient: func() (GSSAPIClient, error) { return client, nil },
+	}
+	if _, _, err := auth.Challenge([]byte("org.apache.cassandra.auth.PasswordAuthenticator")); err == nil {
+		t.Error("expected an error for an authenticator not supporting Kerberos")
+	}
+
+	_, next, err := auth.Challenge([]byte("com.instaclustr.cassandra.auth.KerberosAuthenticator"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, next, err = next.Challenge([]byte("ap-rep")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := next.Challenge([]byte("wrapped:\x04\x00\x10\x00")); err == nil {
+		t.Error("expected an error when the node requires a security layer")
+	}
+	if !client.closed {
+		t.Error("expected the client to be closed once the authentication failed")
+	}
+}
+
+func TestGSSAPIAuthenticatorClientErrors(t *testing.T) {
+	for _, fail := range []string{"InitSecContext", "Unwrap"} {
+		t.Run(fail, func(t *testing.T) {
+			client := &fakeGSSAPIClient{fail: fail}
+			var auth Authenticator = GSSAPIAuthenticator{
+				NewClient: func() (GSSAPIClient, error) { return client, nil },
+			}
+
+			var err error
+			for _, challenge := range []string{"com.instaclustr.cassandra.auth.KerberosAuthenticator", "ap-rep", "wrapped:\x01\x00\x10\x00"} {
+				if _, auth, err = auth.Challenge([]byte(challenge)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				t.Fatal("expected the authentication to fail")
+			}
+			if !client.closed {
+				t.Error("expected the client to be closed once the authentication failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HealthCheckConfig configures the active probing of the hosts of the
+// connection pool, see ClusterConfig.HealthCheck. Probes detect hosts which
+// stopped responding without closing their connections faster than the
+// timeouts of queries do.
+type HealthCheckConfig struct {
+	// Interval between the probes of each host.
+	// Default: 5s
+	Interval time.Duration
+
+	// Timeout of each probe.
+	// Default: 2s
+	Timeout time.Duration
+
+	// Query probes the hosts with SELECT key FROM system.local, which also
+	// checks the host can serve reads, instead of an OPTIONS request.
+	// Default: false
+	Query bool
+
+	// FailureThreshold is the number of consecutive failed probes after which
+	// a host is marked down, as if the cluster reported it down: the host
+	// selection policy and the topology listeners are notified and the
+	// connections to the host are closed until it is reconnected.
+	// Default: 3
+	FailureThreshold int
+}
+
+// healthChecker probes the hosts of the connection pool of a session.
+type healthChecker struct {
+	session *Session
+	cfg     HealthCheckConfig
+	// probe probes a host with one of its connections, it is replaced in tests.
+	probe func(ctx context.Context, conn *Conn) error
+
+	// failures are the numbers of consecutive failed probes of the hosts by
+	// their host ID.
+	failures map[string]int
+}
+
+func newHealthChecker(s *Session, cfg HealthCheckConfig) *healthChecker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 3
+	}
+	h := &healthChecker{session: s, cfg: cfg, failures: make(map[string]int)}
+	h.probe = h.probeOptions
+	if cfg.Query {
+		h.probe = h.probeQuery
+	}
+	return h
+}
+
+// run probes the hosts at every interval until the session is closed.
+func (h *healthChecker) run() {
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.check()
+		case <-h.session.ctx.Done():
+			return
+		}
+	}
+}
+
+// check probes every host of the pool concurrently and marks down the hosts
+// whose probes failed FailureThreshold times in a row.
+func (h *healthChecker) check() {
+	pool := h.session.pool
+	pool.mu.RLock()
+	pools := make([]*hostConnPool, 0, len(pool.hostConnPools))
+	for _, hostPool := range pool.hostConnPools {
+		pools = append(pools, hostPool)
+	}
+	pool.mu.RUnlock()
+
+	errs := make([]error, len(pools))
+	var wg sync.WaitGroup
+	for i, hostPool := range pools {
+		conn := hostPool.Pick()
+		if conn == nil {
+			// the pool is being filled or its connections are busy, which
+			// the pool handles itself.
+			continue
+		}
+		wg.Add(1)
+		go func(i int, conn *Conn) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(h.session.ctx, h.cfg.Timeout)
+			defer cancel()
+			errs[i] = h.probe(ctx, conn)
+		}(i, conn)
+	}
+	wg.Wait()
+
+	for i, hostPool := range pools {
+		host := hostPool.host
+		hostID := host.HostID()
+		if errs[i] == nil {
+			delete(h.failures, hostID)
+			continue
+		}
+
+		h.failures[hostID]++
+		if h.failures[hostID] < h.cfg.FailureThreshold {
+			continue
+		}
+		delete(h.failures, hostID)
+		h.session.logger.Printf("gocql: marking host %s down after %d failed health checks: %v\n",
+			host.ConnectAddressAndPort(), h.cfg.FailureThreshold, errs[i])
+		h.session.hostDown(host)
+	}
+}
+
+func (h *healthChecker) probeOptions(ctx context.Context, conn *Conn) error {
+	framer, err := conn.exec(ctx, &writeOptionsFrame{}, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := framer.parseFrame()
+	if err != nil {
+		return err
+	}
+	switch v := resp.(type) {
+	case *supportedFrame:
+		return nil
+	case error:
+		return v
+	default:
+		return fmt.Errorf("gocql: unexpected response to health check: %v", resp)
+	}
+}
+
+func (h *healthChecker) probeQuery(ctx context.Context, conn *Conn) error {
+	return conn.query(ctx, "SELECT key FROM system.local").Close()
+}
@@ -35,9 +35,54 @@ import (
 	"gopkg.in/inf.v0"
 )
 
+// RowData holds the names of the columns of the rows of an Iter and pointers to
+// values of their Go types, see Iter.RowData.
 type RowData struct {
 	Columns []string
 	Values  []interface{}
+	// Types are the types of the columns.
+	Types []TypeInfo
+}
+
+// CQLTypeName returns the name of t in CQL syntax, as used in schema
+// statements: collections and tuples are named with their element types,
+// user-defined types by their keyspace and name, and custom types by their
+// quoted class name. Collections, tuples and user-defined types nested in other
+// types are frozen.
+func CQLTypeName(t TypeInfo) string {
+	return cqlTypeName(t, false)
+}
+
+func cqlTypeName(t TypeInfo, nested bool) string {
+	frozen := func(name string) string {
+		if nested {
+			return "frozen<" + name + ">"
+		}
+		return name
+	}
+
+	switch t := t.(type) {
+	case CollectionType:
+		switch t.typ {
+		case TypeMap:
+			return frozen(fmt.Sprintf("map<%s, %s>", cqlTypeName(t.Key, true), cqlTypeName(t.Elem, true)))
+		case TypeList, TypeSet:
+			return frozen(fmt.Sprintf("%s<%s>", t.typ, cqlTypeName(t.Elem, true)))
+		}
+	case TupleTypeInfo:
+		elems := make([]string, len(t.Elems))
+		for i, elem := range t.Elems {
+			elems[i] = cqlTypeName(elem, true)
+		}
+		return frozen("tuple<" + strings.Join(elems, ", ") + ">")
+	case UDTTypeInfo:
+		return frozen(t.KeySpace + "." + t.Name)
+	}
+
+	if t.Type() == TypeCustom {
+		return QuoteString(t.Custom())
+	}
+	return t.Type().String()
 }
 
 func goType(t TypeInfo) (reflect.Type, error) {
@@ -96,6 +141,11 @@ func goType(t TypeInfo) (reflect.Type, error) {
 		return reflect.TypeOf(*new(time.Time)), nil
 	case TypeDuration:
 		return reflect.TypeOf(*new(Duration)), nil
+	case TypeCustom:
+		if native, ok := t.(NativeType); ok && native.asBytes {
+			return reflect.TypeOf(*new([]byte)), nil
+		}
+		return nil, UnknownTypeError{Class: t.Custom()}
 	default:
 		return nil, fmt.Errorf("cannot create Go type for unknown CQL type %s", t)
 	}
@@ -329,6 +379,7 @@ func (iter *Iter) RowData() (RowData, error) {
 
 	columns := make([]string, 0, len(iter.Columns()))
 	values := make([]interface{}, 0, len(iter.Columns()))
+	types := make([]TypeInfo, 0, len(iter.Columns()))
 
 	for _, column := range iter.Columns() {
 		if c, ok := column.TypeInfo.(TupleTypeInfo); !ok {
@@ -338,6 +389,7 @@ func (iter *Iter) RowData() (RowData, error) {
 			}
 			columns = append(columns, column.Name)
 			values = append(values, val)
+			types = append(types, column.TypeInfo)
 		} else {
 			for i, elem := range c.Elems {
 				columns = append(columns, TupleColumnName(column.Name, i))
@@ -346,6 +398,7 @@ func (iter *Iter) RowData() (RowData, error) {
 					return RowData{}, err
 				}
 				values = append(values, val)
+				types = append(types, elem)
 			}
 		}
 	}
@@ -353,6 +406,7 @@ func (iter *Iter) RowData() (RowData, error) {
 	rowData := RowData{
 		Columns: columns,
 		Values:  values,
+		Types:   types,
 	}
 
 	return rowData, nil
@@ -236,3 +236,57 @@ func TestGetCassandraType(t *testing.T) {
 		})
 	}
 }
+
+func TestCQLTypeName(t *testing.T) {
+	native := func(typ Type) NativeType {
+		return NativeType{proto: protoVersion4, typ: typ}
+	}
+	udt := UDTTypeInfo{NativeType: native(TypeUDT), KeySpace: "ks", Name: "address"}
+
+	tests := []struct {
+		typ  TypeInfo
+		name string
+	}{
+		{native(TypeInt), "int"},
+		{NativeType{proto: protoVersion4, typ: TypeCustom, custom: "com.example.It's"}, "'com.example.It''s'"},
+		{CollectionType{NativeType: native(TypeList), Elem: native(TypeText)}, "list<text>"},
+		{CollectionType{NativeType: native(TypeMap), Key: native(TypeText), Elem: CollectionType{NativeType: native(TypeSet), Elem: native(TypeInt)}},
+			"map<text, frozen<set<int>>>"},
+		{TupleTypeInfo{NativeType: native(TypeTuple), Elems: []TypeInfo{native(TypeInt), udt}}, "tuple<int, frozen<ks.address>>"},
+		{udt, "ks.address"},
+	}
+	for _, test := range tests {
+		if name := CQLTypeName(test.typ); name != test.name {
+			t.Errorf("expected %s for %v, got %s", test.name, test.typ, name)
+		}
+	}
+}
+
+func TestIterRowData(t *testing.T) {
+	intType := NativeType{proto: protoVersion4, typ: TypeInt}
+	textType := NativeType{proto: protoVersion4, typ: TypeText}
+	iter := &Iter{meta: resultMetadata{columns: []ColumnInfo{
+		{Keyspace: "ks", Table: "tbl", Name: "id", TypeInfo: intType},
+		{Keyspace: "ks", Table: "tbl", Name: "pair", TypeInfo: TupleTypeInfo{
+			NativeType: NativeType{proto: protoVersion4, typ: TypeTuple},
+			Elems:      []TypeInfo{intType, textType},
+		}},
+	}}}
+
+	rd, err := iter.RowData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"id", "pair[0]", "pair[1]"}; !reflect.DeepEqual(rd.Columns, expected) {
+		t.Errorf("expected columns %v, got %v", expected, rd.Columns)
+	}
+	if expected := []TypeInfo{intType, intType, textType}; !reflect.DeepEqual(rd.Types, expected) {
+		t.Errorf("expected types %v, got %v", expected, rd.Types)
+	}
+	if _, ok := rd.Values[2].(*string); !ok {
+		t.Errorf("expected *string value for pair[1], got %T", rd.Values[2])
+	}
+	if typ := iter.Columns()[1].CQLType(); typ != "tuple<int, text>" {
+		t.Errorf("expected tuple<int, text>, got %s", typ)
+	}
+}
@@ -26,18 +26,23 @@ package gocql
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var ErrCannotFindHost = errors.New("cannot find host")
 var ErrHostAlreadyExists = errors.New("host already exists")
 
+// ErrRingRefreshVetoed is returned by ring refreshes skipped by a RingRefreshHook.
+var ErrRingRefreshVetoed = errors.New("gocql: ring refresh vetoed")
+
 type nodeState int32
 
 func (n nodeState) String() string {
@@ -157,6 +162,9 @@ type HostInfo struct {
 	state            nodeState
 	schemaVersion    string
 	tokens           []string
+	tlsState         *tls.ConnectionState
+	socketPath       string
+	severity         float64
 }
 
 func (h *HostInfo) Equal(host *HostInfo) bool {
@@ -165,9 +173,28 @@ func (h *HostInfo) Equal(host *HostInfo) bool {
 		return true
 	}
 
+	if path := h.SocketPath(); path != "" || host.SocketPath() != "" {
+		return path == host.SocketPath()
+	}
 	return h.ConnectAddress().Equal(host.ConnectAddress())
 }
 
+// addressKey returns the key of the address of the host: its socket path for
+// the hosts connected to through a Unix domain socket, else its connect
+// address.
+func (h *HostInfo) addressKey() string {
+	if path := h.SocketPath(); path != "" {
+		return "unix://" + path
+	}
+	return h.ConnectAddress().String()
+}
+
+// sameAddress reports whether h and host are connected to at the same address
+// and port, or through the same Unix domain socket.
+func (h *HostInfo) sameAddress(host *HostInfo) bool {
+	return h.addressKey() == host.addressKey() && h.Port() == host.Port()
+}
+
 func (h *HostInfo) Peer() net.IP {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -178,7 +205,7 @@ func (h *HostInfo) invalidConnectAddr() bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	addr, _ := h.connectAddressLocked()
-	return !validIpAddr(addr)
+	return !validIpAddr(addr) && h.socketPath == ""
 }
 
 func validIpAddr(addr net.IP) bool {
@@ -220,12 +247,17 @@ func (h *HostInfo) nodeToNodeAddress() net.IP {
 // Returns the address that should be used to connect to the host.
 // If you wish to override this, use an AddressTranslator or
 // use a HostFilter to SetConnectAddress()
+//
+// The hosts connected to through a Unix domain socket have the address the
+// node reports, or a nil address until it is known, see SocketPath.
 func (h *HostInfo) ConnectAddress() net.IP {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if addr, _ := h.connectAddressLocked(); validIpAddr(addr) {
 		return addr
+	} else if h.socketPath != "" {
+		return nil
 	}
 	panic(fmt.Sprintf("no valid connect address for host: %v. Is your cluster configured correctly?", h))
 }
@@ -337,6 +369,20 @@ func (h *HostInfo) setState(state nodeState) *HostInfo {
 	return h
 }
 
+// TLSConnectionState returns the TLS state negotiated by the latest connection
+// to the host, or nil if the connections to the host do not use TLS.
+func (h *HostInfo) TLSConnectionState() *tls.ConnectionState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.tlsState
+}
+
+func (h *HostInfo) setTLSConnectionState(state *tls.ConnectionState) {
+	h.mu.Lock()
+	h.tlsState = state
+	h.mu.Unlock()
+}
+
 func (h *HostInfo) Tokens() []string {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -349,6 +395,34 @@ func (h *HostInfo) Port() int {
 	return h.port
 }
 
+// SocketPath returns the path of the Unix domain socket to connect to the host
+// through, or an empty string if the host is connected to over TCP.
+//
+// The hosts connected to through a Unix domain socket are identified by the
+// path, rather than by their connect address, in the ring, the host selection
+// policies and the filters.
+func (h *HostInfo) SocketPath() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.socketPath
+}
+
+// Severity returns the severity the host reports in gossip, which increases
+// with its load from compactions, repairs and other background activity. It is
+// 0 unless ClusterConfig.SeverityRefreshInterval is set and the cluster exposes
+// it, see SeverityAwareHostPolicy.
+func (h *HostInfo) Severity() float64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.severity
+}
+
+func (h *HostInfo) setSeverity(severity float64) {
+	h.mu.Lock()
+	h.severity = severity
+	h.mu.Unlock()
+}
+
 func (h *HostInfo) update(from *HostInfo) {
 	if h == from {
 		return
@@ -409,6 +483,9 @@ func (h *HostInfo) update(from *HostInfo) {
 	if h.tokens == nil {
 		h.tokens = from.tokens
 	}
+	if h.socketPath == "" {
+		h.socketPath = from.socketPath
+	}
 }
 
 func (h *HostInfo) IsUp() bool {
@@ -439,10 +516,10 @@ func (h *HostInfo) String() string {
 	connectAddr, source := h.connectAddressLocked()
 	return fmt.Sprintf("[HostInfo hostname=%q connectAddress=%q peer=%q rpc_address=%q broadcast_address=%q "+
 		"preferred_ip=%q connect_addr=%q connect_addr_source=%q "+
-		"port=%d data_centre=%q rack=%q host_id=%q version=%q state=%s num_tokens=%d]",
+		"port=%d socket_path=%q data_centre=%q rack=%q host_id=%q version=%q state=%s num_tokens=%d]",
 		h.hostname, h.connectAddress, h.peer, h.rpcAddress, h.broadcastAddress, h.preferredIP,
 		connectAddr, source,
-		h.port, h.dataCenter, h.rack, h.hostId, h.version, h.state, len(h.tokens))
+		h.port, h.socketPath, h.dataCenter, h.rack, h.hostId, h.version, h.state, len(h.tokens))
 }
 
 // Polls system.peers at a specific interval to find new hosts
@@ -451,6 +528,9 @@ type ringDescriber struct {
 	mu              sync.Mutex
 	prevHosts       []*HostInfo
 	prevPartitioner string
+	// localDC is the data center of the hosts discovered with
+	// DiscoverLocalDC, once known.
+	localDC string
 }
 
 // Returns true if we are using system_schema.keyspaces instead of system.schema_keyspaces
@@ -584,8 +664,15 @@ func (s *Session) hostInfoFromMap(row map[string]interface{}, host *HostInfo) (*
 	}
 
 	ip, port := s.cfg.translateAddressPort(host.ConnectAddress(), host.port)
+	if s.cfg.AddressTranslator != nil && len(ip) > 0 {
+		s.debugf("gocql: translating address '%v:%d' to '%v:%d'\n", host.ConnectAddress(), host.port, ip, port)
+	}
 	host.connectAddress = ip
 	host.port = port
+	if path := s.cfg.translateSocket(ip, port); path != "" {
+		s.debugf("gocql: translating address '%v:%d' to 'unix://%s'\n", ip, port, path)
+		host.socketPath = path
+	}
 
 	return host, nil
 }
@@ -697,10 +784,31 @@ func (r *ringDescriber) GetHosts() ([]*HostInfo, string, error) {
 	if len(hosts) > 0 {
 		partitioner = hosts[0].Partitioner()
 	}
+	hosts = r.discoveredHosts(hosts)
 
 	return hosts, partitioner, nil
 }
 
+// allPeers returns the hosts found via queries to system.local and
+// system.peers, including the hosts of the datacenters which are not
+// discovered and the hosts rejected by the HostFilter.
+func (r *ringDescriber) allPeers() ([]*HostInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	localHost, err := r.getLocalHostInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	peerHosts, err := r.getClusterPeerInfo(localHost)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*HostInfo{localHost}, peerHosts...), nil
+}
+
 // debounceRingRefresh submits a ring refresh request to the ring refresh debouncer.
 func (s *Session) debounceRingRefresh() {
 	s.ringRefresher.debounce()
@@ -716,7 +824,24 @@ func (s *Session) refreshRing() error {
 	return err
 }
 
-func refreshRing(r *ringDescriber) error {
+func refreshRing(r *ringDescriber) (err error) {
+	if r.session.cfg.HostDiscovery == DiscoverContactPoints {
+		// the ring is made of the contact points
+		return nil
+	}
+
+	if observer := r.session.metadataObserver; observer != nil {
+		start := time.Now()
+		defer func() {
+			observer.ObserveRingRefresh(r.session.ctx, ObservedRingRefresh{
+				Start: start,
+				End:   time.Now(),
+				Hosts: len(r.session.ring.allHosts()),
+				Err:   err,
+			})
+		}()
+	}
+
 	hosts, partitioner, err := r.GetHosts()
 	if err != nil {
 		return err
@@ -729,7 +854,17 @@ func refreshRing(r *ringDescriber) error {
 			continue
 		}
 
+		if replaced := r.session.ring.replacedHost(h); replaced != nil {
+			// the node was replaced by a new one with the same IP, remove the
+			// old node before adding the new one so that none of its state,
+			// such as its pool or prepared statements, is kept.
+			r.session.removeHost(replaced)
+			r.session.stmtsLRU.removeHost(replaced.HostID())
+			delete(prevHosts, replaced.HostID())
+		}
+
 		if host, ok := r.session.ring.addHostIfMissing(h); !ok {
+			r.session.notifyHostAdded(h)
 			r.session.startPoolFill(h)
 		} else {
 			// host (by hostID) already exists; determine if IP has changed
@@ -749,6 +884,7 @@ func refreshRing(r *ringDescriber) error {
 					return fmt.Errorf("add new host=%s after removal: %w", h, ErrHostAlreadyExists)
 				}
 				// add new HostInfo (same hostID, new IP)
+				r.session.notifyHostAdded(h)
 				r.session.startPoolFill(h)
 			}
 		}
@@ -764,6 +900,113 @@ func refreshRing(r *ringDescriber) error {
 	return nil
 }
 
+// RingRefreshHook is called around the refreshes of the ring of a session,
+// which follow topology events and reconnections of the control connection,
+// see Session.RegisterRingRefreshHook. It lets maintenance tooling hold the
+// reconciliation of the topology until a deploy window, and see its result.
+type RingRefreshHook interface {
+	// BeforeRingRefresh is called before the ring is refreshed. A positive
+	// delay postpones the refresh, the hooks are called again once it passed,
+	// and veto skips the refresh until another one is requested. The refreshes
+	// requested while one is postponed are merged with it.
+	BeforeRingRefresh() (delay time.Duration, veto bool)
+	// AfterRingRefresh is called after each refresh which was not vetoed.
+	AfterRingRefresh(RingRefreshResult)
+}
+
+// ringRefreshHookList is a copy on write list of ring refresh hooks.
+type ringRefreshHookList struct {
+	mu    sync.Mutex
+	hooks atomic.Value // []RingRefreshHook
+}
+
+func (t *ringRefreshHookList) add(h RingRefreshHook) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev := t.get()
+	hooks := make([]RingRefreshHook, len(prev), len(prev)+1)
+	copy(hooks, prev)
+	t.hooks.Store(append(hooks, h))
+}
+
+func (t *ringRefreshHookList) get() []RingRefreshHook {
+	hooks, _ := t.hooks.Load().([]RingRefreshHook)
+	return hooks
+}
+
+// RingRefreshResult describes the changes of the ring made by a refresh.
+type RingRefreshResult struct {
+	// Added are the hosts which joined the ring, and Removed the hosts which
+	// left it. A host whose address changed is in both.
+	Added   []*HostInfo
+	Removed []*HostInfo
+	// Err is the error of the refresh, if any.
+	Err error
+}
+
+// RegisterRingRefreshHook registers h to be called around the ring refreshes
+// from then on. With several hooks, a refresh is postponed by the longest of
+// their delays and skipped if any of them vetoes it.
+func (s *Session) RegisterRingRefreshHook(h RingRefreshHook) {
+	s.ringRefreshHooks.add(h)
+}
+
+// hookedRingRefresh refreshes the ring once the ring refresh hooks let it.
+func (s *Session) hookedRingRefresh() error {
+	return s.runRingRefreshHooks(func() error { return refreshRing(s.hostSource) })
+}
+
+// runRingRefreshHooks calls refresh around the ring refresh hooks.
+func (s *Session) runRingRefreshHooks(refresh func() error) error {
+	for {
+		var (
+			delay time.Duration
+			veto  bool
+		)
+		for _, h := range s.ringRefreshHooks.get() {
+			d, v := h.BeforeRingRefresh()
+			if d > delay {
+				delay = d
+			}
+			veto = veto || v
+		}
+		if veto {
+			s.debugf("gocql: ring refresh vetoed\n")
+			return ErrRingRefreshVetoed
+		}
+		if delay <= 0 {
+			break
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return ErrSessionClosed
+		}
+	}
+
+	prevHosts := s.ring.currentHosts()
+	err := refresh()
+	result := RingRefreshResult{Err: err}
+	hosts := s.ring.currentHosts()
+	for id, host := range hosts {
+		if prev, ok := prevHosts[id]; !ok || prev != host {
+			result.Added = append(result.Added, host)
+		}
+	}
+	for id, prev := range prevHosts {
+		if host, ok := hosts[id]; !ok || host != prev {
+			result.Removed = append(result.Removed, prev)
+		}
+	}
+	for _, h := range s.ringRefreshHooks.get() {
+		h.AfterRingRefresh(result)
+	}
+	return err
+}
+
 const (
 	ringRefreshDebounceTime = 1 * time.Second
 )
@@ -28,8 +28,10 @@
 package gocql
 
 import (
+	"context"
 	"errors"
 	"net"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -369,3 +371,99 @@ func TestErrorBroadcaster_StopWithoutBroadcast(t *testing.T) {
 		t.Errorf(loadedVal.(error).Error())
 	}
 }
+
+type testRingRefreshHook struct {
+	delays  []time.Duration
+	veto    bool
+	calls   int
+	results []RingRefreshResult
+}
+
+func (h *testRingRefreshHook) BeforeRingRefresh() (time.Duration, bool) {
+	h.calls++
+	if len(h.delays) > 0 {
+		delay := h.delays[0]
+		h.delays = h.delays[1:]
+		return delay, false
+	}
+	return 0, h.veto
+}
+
+func (h *testRingRefreshHook) AfterRingRefresh(result RingRefreshResult) {
+	h.results = append(h.results, result)
+}
+
+func TestRingRefreshHooks(t *testing.T) {
+	s := &Session{ctx: context.Background(), logger: &defaultLogger{}}
+	kept := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(1, 1, 1, 1)}
+	removed := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(2, 2, 2, 2)}
+	added := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(3, 3, 3, 3)}
+	s.ring.addHostIfMissing(kept)
+	s.ring.addHostIfMissing(removed)
+
+	hook := &testRingRefreshHook{delays: []time.Duration{10 * time.Millisecond}}
+	s.RegisterRingRefreshHook(hook)
+
+	refreshes := 0
+	refreshErr := errors.New("refresh failed")
+	start := time.Now()
+	err := s.runRingRefreshHooks(func() error {
+		refreshes++
+		s.ring.removeHost(removed.HostID())
+		s.ring.addHostIfMissing(added)
+		return refreshErr
+	})
+	if err != refreshErr {
+		t.Fatalf("expected the error of the refresh, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Fatalf("expected the refresh to be delayed, took %v", elapsed)
+	}
+	if refreshes != 1 || hook.calls != 2 {
+		t.Fatalf("expected 1 refresh after 2 hook calls, got %d refreshes and %d calls", refreshes, hook.calls)
+	}
+	if len(hook.results) != 1 {
+		t.Fatalf("expected 1 result, got %v", hook.results)
+	}
+	result := hook.results[0]
+	if len(result.Added) != 1 || result.Added[0] != added || len(result.Removed) != 1 || result.Removed[0] != removed || result.Err != refreshErr {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	hook.veto = true
+	err = s.runRingRefreshHooks(func() error {
+		refreshes++
+		return nil
+	})
+	if err != ErrRingRefreshVetoed {
+		t.Fatalf("expected %v, got %v", ErrRingRefreshVetoed, err)
+	}
+	if refreshes != 1 || len(hook.results) != 1 {
+		t.Fatal("expected the vetoed refresh to be skipped")
+	}
+}
+
+func TestDiscoveredHostsLocalDC(t *testing.T) {
+	s := &Session{cfg: ClusterConfig{HostDiscovery: DiscoverLocalDC}}
+	s.ring.endpoints = []*HostInfo{{connectAddress: net.IPv4(10, 0, 1, 1), port: 9042}}
+	r := &ringDescriber{session: s}
+
+	local := &HostInfo{connectAddress: net.IPv4(10, 0, 0, 1), port: 9042, dataCenter: "dc1"}
+	peer := &HostInfo{connectAddress: net.IPv4(10, 0, 0, 2), port: 9042, dataCenter: "dc1"}
+	remote := &HostInfo{connectAddress: net.IPv4(10, 0, 1, 2), port: 9042, dataCenter: "dc2"}
+	contact := &HostInfo{connectAddress: net.IPv4(10, 0, 1, 1), port: 9042, dataCenter: "dc2"}
+
+	if hosts := r.discoveredHosts([]*HostInfo{local, peer, remote, contact}); !reflect.DeepEqual(hosts, []*HostInfo{local, peer, contact}) {
+		t.Fatalf("expected the hosts of dc1 and the contact point, got %v", hosts)
+	}
+	// the control connection moved to the contact point of dc2
+	if hosts := r.discoveredHosts([]*HostInfo{contact, local, peer, remote}); !reflect.DeepEqual(hosts, []*HostInfo{contact, local, peer}) {
+		t.Fatalf("expected the local data center to be kept, got %v", hosts)
+	}
+
+	s.cfg.LocalDC = "dc2"
+	r = &ringDescriber{session: s}
+	if hosts := r.discoveredHosts([]*HostInfo{local, peer, remote, contact}); !reflect.DeepEqual(hosts, []*HostInfo{remote, contact}) {
+		t.Fatalf("expected the hosts of the configured data center, got %v", hosts)
+	}
+}
@@ -31,6 +31,7 @@ package gocql
 import (
 	"context"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -62,6 +63,45 @@ func TestAuthentication(t *testing.T) {
 	session.Close()
 }
 
+func TestRoleMetadata(t *testing.T) {
+	if !*flagRunAuthTest {
+		t.Skip("Authentication is not configured in the target cluster")
+	}
+
+	cluster := createCluster()
+	cluster.Authenticator = PasswordAuthenticator{
+		Username: "cassandra",
+		Password: "cassandra",
+	}
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("Authentication error: %s", err)
+	}
+	defer session.Close()
+
+	ctx := context.Background()
+	roles, err := session.Roles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, role := range roles {
+		if role.Name == "cassandra" {
+			found = true
+			if !role.IsSuperuser || !role.CanLogin {
+				t.Errorf("expected cassandra to be a superuser which can login, got %+v", role)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected the cassandra role, got %+v", roles)
+	}
+
+	if _, err := session.RolePermissions(ctx, "cassandra"); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestGetHosts(t *testing.T) {
 	clusterHosts := getClusterHosts()
 	cluster := createCluster()
@@ -256,6 +296,58 @@ func TestSessionAwaitSchemaAgreement(t *testing.T) {
 	}
 }
 
+type recordingMetadataObserver struct {
+	mu               sync.Mutex
+	ringRefreshes    []ObservedRingRefresh
+	schemaAgreements []ObservedSchemaAgreement
+}
+
+func (r *recordingMetadataObserver) ObserveRingRefresh(ctx context.Context, o ObservedRingRefresh) {
+	r.mu.Lock()
+	r.ringRefreshes = append(r.ringRefreshes, o)
+	r.mu.Unlock()
+}
+
+func (r *recordingMetadataObserver) ObserveSchemaAgreement(ctx context.Context, o ObservedSchemaAgreement) {
+	r.mu.Lock()
+	r.schemaAgreements = append(r.schemaAgreements, o)
+	r.mu.Unlock()
+}
+
+func TestMetadataObserver(t *testing.T) {
+	observer := &recordingMetadataObserver{}
+	cluster := createCluster()
+	cluster.MetadataObserver = observer
+	session := createSessionFromCluster(cluster, t)
+	defer session.Close()
+
+	if err := session.AwaitSchemaAgreement(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.refreshRing(); err != nil {
+		t.Fatal(err)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+
+	if len(observer.schemaAgreements) == 0 {
+		t.Fatal("expected the schema agreement wait to be observed")
+	}
+	agreement := observer.schemaAgreements[len(observer.schemaAgreements)-1]
+	if agreement.Err != nil || len(agreement.Versions) != 1 || agreement.Host == nil || agreement.End.Before(agreement.Start) {
+		t.Errorf("unexpected schema agreement observed: %+v", agreement)
+	}
+
+	if len(observer.ringRefreshes) == 0 {
+		t.Fatal("expected the ring refresh to be observed")
+	}
+	refresh := observer.ringRefreshes[len(observer.ringRefreshes)-1]
+	if refresh.Err != nil || refresh.Hosts != len(session.GetHosts()) || refresh.End.Before(refresh.Start) {
+		t.Errorf("unexpected ring refresh observed: %+v", refresh)
+	}
+}
+
 func TestUDF(t *testing.T) {
 	session := createSession(t)
 	defer session.Close()
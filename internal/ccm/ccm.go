@@ -54,6 +54,37 @@ func execCmd(args ...string) (*bytes.Buffer, error) {
 	return stdout, nil
 }
 
+// Create creates and switches to a new cluster of the given number of nodes,
+// passing args to ccm create, for example "--scylla".
+func Create(name, version string, nodes int, args ...string) error {
+	args = append([]string{"create", name, "-v", version, "-n", fmt.Sprint(nodes)}, args...)
+	_, err := execCmd(args...)
+	return err
+}
+
+// UpdateConf updates the configuration of every node of the current cluster
+// with the given "key: value" options.
+func UpdateConf(options ...string) error {
+	_, err := execCmd(append([]string{"updateconf"}, options...)...)
+	return err
+}
+
+// Start starts every node of the current cluster.
+func Start() error {
+	args := []string{"start", "--wait-for-binary-proto"}
+	if runtime.GOOS == "windows" {
+		args = append(args, "--quiet-windows")
+	}
+	_, err := execCmd(args...)
+	return err
+}
+
+// Remove stops and removes the cluster name.
+func Remove(name string) error {
+	_, err := execCmd("remove", name)
+	return err
+}
+
 func AllUp() error {
 	status, err := Status()
 	if err != nil {
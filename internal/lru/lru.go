@@ -122,6 +122,57 @@ func (c *Cache) Remove(key string) bool {
 	return false
 }
 
+// RemoveFunc removes the items whose key satisfies f from the cache and
+// returns the number of removed items.
+func (c *Cache) RemoveFunc(f func(key string) bool) int {
+	if c.cache == nil {
+		return 0
+	}
+
+	var removed int
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		if f(e.Value.(*entry).key) {
+			c.removeElement(e)
+			removed++
+		}
+		e = next
+	}
+	return removed
+}
+
+// Each calls f with the items of the cache, from the most recently used,
+// until f returns false. It does not change the recency of the items.
+func (c *Cache) Each(f func(key string, value interface{}) bool) {
+	if c.cache == nil {
+		return
+	}
+
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		kv := e.Value.(*entry)
+		if !f(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// RemoveOldestFunc removes the least recently used item whose key and value
+// satisfy f from the cache and reports whether an item was removed.
+func (c *Cache) RemoveOldestFunc(f func(key string, value interface{}) bool) bool {
+	if c.cache == nil {
+		return false
+	}
+
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		kv := e.Value.(*entry)
+		if f(kv.key, kv.value) {
+			c.removeElement(e)
+			return true
+		}
+	}
+	return false
+}
+
 // RemoveOldest removes the oldest item from the cache.
 func (c *Cache) RemoveOldest() {
 	if c.cache == nil {
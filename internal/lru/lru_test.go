@@ -84,3 +84,48 @@ func TestRemove(t *testing.T) {
 		t.Fatal("TestRemove returned a removed entry")
 	}
 }
+
+func TestRemoveFunc(t *testing.T) {
+	lru := New(0)
+	lru.Add("a1", 1)
+	lru.Add("b1", 2)
+	lru.Add("a2", 3)
+
+	removed := lru.RemoveFunc(func(key string) bool {
+		return key[0] == 'a'
+	})
+	if removed != 2 {
+		t.Fatalf("TestRemoveFunc expected 2 removed entries, got %d", removed)
+	}
+	if _, ok := lru.Get("a1"); ok {
+		t.Fatal("TestRemoveFunc returned a removed entry")
+	}
+	if _, ok := lru.Get("b1"); !ok {
+		t.Fatal("TestRemoveFunc removed a non matching entry")
+	}
+	if lru.Len() != 1 {
+		t.Fatalf("TestRemoveFunc expected 1 entry, got %d", lru.Len())
+	}
+}
+
+func TestRemoveOldestFunc(t *testing.T) {
+	lru := New(0)
+	lru.Add("a1", 1)
+	lru.Add("b1", 2)
+	lru.Add("a2", 3)
+
+	if !lru.RemoveOldestFunc(func(key string, value interface{}) bool {
+		return value.(int) > 1
+	}) {
+		t.Fatal("TestRemoveOldestFunc expected an entry to be removed")
+	}
+	if _, ok := lru.Get("b1"); ok {
+		t.Fatal("TestRemoveOldestFunc returned a removed entry")
+	}
+	if lru.Len() != 2 {
+		t.Fatalf("TestRemoveOldestFunc expected 2 entries, got %d", lru.Len())
+	}
+	if lru.RemoveOldestFunc(func(key string, value interface{}) bool { return false }) {
+		t.Fatal("TestRemoveOldestFunc removed a non matching entry")
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package krb5 implements the gocql.GSSAPIClient interface with the Kerberos
+// client of github.com/jcmturner/gokrb5, to authenticate with Kerberos using
+// gocql.GSSAPIAuthenticator without the system GSSAPI library:
+//
+//	kt, err := keytab.Load("/etc/app.keytab")
+//	...
+//	conf, err := config.Load("/etc/krb5.conf")
+//	...
+//	cl := client.NewWithKeytab("app", "EXAMPLE.COM", kt, conf)
+//	cluster.AuthProvider = gocql.GSSAPIAuthProvider("dse", func() (gocql.GSSAPIClient, error) {
+//		return krb5.NewClient(cl), nil
+//	})
+package krb5
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Client is the client side of the GSSAPI security context of a connection,
+// established with the credentials of a gokrb5 client. The Kerberos V5
+// mechanism tokens are sent without mutual authentication, the node being
+// authenticated by the wrap token of its security layer offer.
+type Client struct {
+	client *client.Client
+	key    types.EncryptionKey
+}
+
+// NewClient returns the client of a connection authenticating with the
+// credentials of cl. cl can be shared by all the connections: it logs in on
+// the first connection, and caches the service tickets and renews them until
+// it is destroyed.
+func NewClient(cl *client.Client) *Client {
+	return &Client{client: cl}
+}
+
+// InitSecContext returns the AP-REQ token of a service ticket for target, the
+// security context being established once it is sent.
+func (c *Client) InitSecContext(target string, token []byte) ([]byte, bool, error) {
+	if len(token) > 0 {
+		return nil, false, errors.New("krb5: unexpected token with an established security context")
+	}
+	if err := c.client.AffirmLogin(); err != nil {
+		return nil, false, fmt.Errorf("krb5: unable to log in: %v", err)
+	}
+
+	ticket, key, err := c.client.GetServiceTicket(servicePrincipal(target))
+	if err != nil {
+		return nil, false, fmt.Errorf("krb5: unable to get a service ticket for %s: %v", target, err)
+	}
+	req, err := spnego.NewKRB5TokenAPREQ(c.client, ticket, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	out, err := req.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	c.key = key
+	return out, true, nil
+}
+
+// Wrap returns the wrap token of msg, signed with the session key.
+func (c *Client) Wrap(msg []byte) ([]byte, error) {
+	wt, err := gssapi.NewInitiatorWrapToken(msg, c.key)
+	if err != nil {
+		return nil, err
+	}
+	return wt.Marshal()
+}
+
+// Unwrap returns the payload of a wrap token sent by the node, once its
+// signature is verified with the session key.
+func (c *Client) Unwrap(token []byte) ([]byte, error) {
+	var wt gssapi.WrapToken
+	if err := wt.Unmarshal(token, true); err != nil {
+		return nil, err
+	}
+	if ok, err := wt.Verify(c.key, keyusage.GSSAPI_ACCEPTOR_SEAL); !ok {
+		return nil, fmt.Errorf("krb5: invalid wrap token: %v", err)
+	}
+	return wt.Payload, nil
+}
+
+// Close forgets the session key of the connection. It does not destroy the
+// shared gokrb5 client.
+func (c *Client) Close() error {
+	c.key = types.EncryptionKey{}
+	return nil
+}
+
+// servicePrincipal returns the service principal name of target without its
+// realm, which gokrb5 resolves from the domain_realm section of its
+// configuration.
+func servicePrincipal(target string) string {
+	if i := strings.LastIndexByte(target, '@'); i >= 0 {
+		return target[:i]
+	}
+	return target
+}
@@ -0,0 +1,35 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package krb5
+
+import "testing"
+
+func TestServicePrincipal(t *testing.T) {
+	tests := []struct {
+		target, spn string
+	}{
+		{"dse/node1.example.com", "dse/node1.example.com"},
+		{"dse/node1.example.com@EXAMPLE.COM", "dse/node1.example.com"},
+	}
+	for _, test := range tests {
+		if spn := servicePrincipal(test.target); spn != test.spn {
+			t.Errorf("expected the service principal of %q to be %q, got %q", test.target, test.spn, spn)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/inf.v0"
+)
+
+// The functions in this file format identifiers and values for the few cases
+// where a statement can not use bind markers, such as schema statements built
+// at runtime. Statements with values should be executed with bind markers
+// whenever possible.
+
+// QuoteIdentifier returns name as a quoted CQL identifier, such as a keyspace,
+// table or column name. The quoted identifier is case sensitive and may be a
+// reserved keyword.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// QuoteString returns s as a CQL string literal.
+func QuoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// FormatLiteral returns value, marshaled as the CQL type info, as a CQL
+// literal. value is converted as it would be if it was bound to a column of
+// type info, so any value accepted by Marshal can be formatted. A nil value is
+// formatted as null.
+//
+// Collections, tuples and user defined types are formatted with their elements
+// formatted recursively, the entries of maps are sorted by their keys and the
+// fields of user defined types are quoted with QuoteIdentifier.
+func FormatLiteral(info TypeInfo, value interface{}) (string, error) {
+	data, err := Marshal(info, value)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := formatLiteral(buf, info, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// FormatStatement replaces the positional bind markers of stmt with values
+// formatted by FormatLiteral as literals of the corresponding types. Question
+// marks in string literals, quoted identifiers and comments are left as is.
+// Named bind markers are not supported.
+func FormatStatement(stmt string, types []TypeInfo, values ...interface{}) (string, error) {
+	if len(types) != len(values) {
+		return "", fmt.Errorf("gocql: %d types for %d values", len(types), len(values))
+	}
+
+	buf := &bytes.Buffer{}
+	n := 0
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		var end string
+		switch {
+		case c == '?':
+			if n == len(values) {
+				return "", fmt.Errorf("gocql: statement has more bind markers than the %d values", len(values))
+			}
+			literal, err := FormatLiteral(types[n], values[n])
+			if err != nil {
+				return "", fmt.Errorf("gocql: value %d: %v", n, err)
+			}
+			buf.WriteString(literal)
+			n++
+			continue
+		case c == '\'' || c == '"':
+			end = string(c)
+		case strings.HasPrefix(stmt[i:], "$$"):
+			end = "$$"
+		case strings.HasPrefix(stmt[i:], "--") || strings.HasPrefix(stmt[i:], "//"):
+			end = "\n"
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end = "*/"
+		default:
+			buf.WriteByte(c)
+			continue
+		}
+
+		// copy the quoted text or comment up to and including its end, quotes
+		// are escaped by doubling them which this handles as two quoted texts.
+		start := i
+		j := strings.Index(stmt[i+len(end):], end)
+		if j < 0 {
+			i = len(stmt)
+		} else {
+			i += len(end) + j + len(end)
+		}
+		buf.WriteString(stmt[start:i])
+		i--
+	}
+	if n != len(values) {
+		return "", fmt.Errorf("gocql: statement has %d bind markers for %d values", n, len(values))
+	}
+	return buf.String(), nil
+}
+
+// formatLiteral writes the value marshaled in data as a literal of type info.
+func formatLiteral(buf *bytes.Buffer, info TypeInfo, data []byte) error {
+	if data == nil {
+		buf.WriteString("null")
+		return nil
+	}
+
+	switch info.Type() {
+	case TypeAscii, TypeVarchar, TypeText:
+		buf.WriteString(QuoteString(string(data)))
+		return nil
+	case TypeBlob, TypeCustom:
+		buf.WriteString("0x")
+		buf.WriteString(hex.EncodeToString(data))
+		return nil
+	case TypeTimestamp, TypeTime:
+		if len(data) != 8 {
+			return unmarshalErrorf("can not format %s: expected 8 bytes, got %d", info, len(data))
+		}
+		buf.WriteString(strconv.FormatInt(decBigInt(data), 10))
+		return nil
+	case TypeList, TypeSet, TypeMap:
+		return formatCollection(buf, info.(CollectionType), data)
+	case TypeTuple:
+		return formatTuple(buf, info.(TupleTypeInfo), data)
+	case TypeUDT:
+		return formatUDT(buf, info.(UDTTypeInfo), data)
+	}
+
+	value, err := info.NewWithError()
+	if err != nil {
+		return err
+	}
+	if err := Unmarshal(info, data, value); err != nil {
+		return err
+	}
+
+	switch v := dereference(value).(type) {
+	case string:
+		// inet
+		buf.WriteString(QuoteString(v))
+	case float32:
+		buf.WriteString(formatFloat(float64(v), 32))
+	case float64:
+		buf.WriteString(formatFloat(v, 64))
+	case time.Time:
+		// date
+		buf.WriteString(QuoteString(v.Format("2006-01-02")))
+	case *inf.Dec:
+		buf.WriteString(v.String())
+	case *big.Int:
+		buf.WriteString(v.String())
+	case UUID:
+		buf.WriteString(v.String())
+	case Duration:
+		buf.WriteString(formatDuration(v))
+	default:
+		// booleans and integers
+		fmt.Fprint(buf, v)
+	}
+	return nil
+}
+
+func formatFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
+
+// formatDuration formats d with the units of the duration literals, the sign
+// of all its components is the same.
+func formatDuration(d Duration) string {
+	buf := &bytes.Buffer{}
+	months, days, nanos := int64(d.Months), int64(d.Days), d.Nanoseconds
+	if months < 0 || days < 0 || nanos < 0 {
+		buf.WriteByte('-')
+		months, days, nanos = -months, -days, -nanos
+	}
+	if months != 0 {
+		fmt.Fprintf(buf, "%dmo", months)
+	}
+	if days != 0 {
+		fmt.Fprintf(buf, "%dd", days)
+	}
+	if nanos != 0 {
+		fmt.Fprintf(buf, "%dns", uint64(nanos))
+	}
+	if months == 0 && days == 0 && nanos == 0 {
+		buf.WriteString("0d")
+	}
+	return buf.String()
+}
+
+// readCollectionElem reads an element of a collection of type info from data.
+func readCollectionElem(info CollectionType, data []byte) (elem, rest []byte, err error) {
+	n, p, err := readCollectionSize(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	data = data[p:]
+	if n < 0 {
+		return nil, data, nil
+	}
+	if len(data) < n {
+		return nil, nil, unmarshalErrorf("can not format %s: unexpected eof", info)
+	}
+	return data[:n], data[n:], nil
+}
+
+func formatCollection(buf *bytes.Buffer, info CollectionType, data []byte) error {
+	n, p, err := readCollectionSize(info, data)
+	if err != nil {
+		return err
+	}
+	data = data[p:]
+
+	elems := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var key, elem []byte
+		if info.Type() == TypeMap {
+			if key, data, err = readCollectionElem(info, data); err != nil {
+				return err
+			}
+		}
+		if elem, data, err = readCollectionElem(info, data); err != nil {
+			return err
+		}
+
+		elemBuf := &bytes.Buffer{}
+		if info.Type() == TypeMap {
+			if err := formatLiteral(elemBuf, info.Key, key); err != nil {
+				return err
+			}
+			elemBuf.WriteString(": ")
+		}
+		if err := formatLiteral(elemBuf, info.Elem, elem); err != nil {
+			return err
+		}
+		elems = append(elems, elemBuf.String())
+	}
+
+	switch info.Type() {
+	case TypeList:
+		buf.WriteString("[" + strings.Join(elems, ", ") + "]")
+	case TypeSet:
+		buf.WriteString("{" + strings.Join(elems, ", ") + "}")
+	case TypeMap:
+		sort.Strings(elems)
+		buf.WriteString("{" + strings.Join(elems, ", ") + "}")
+	}
+	return nil
+}
+
+// readFieldBytes reads a tuple element or a UDT field from data.
+func readFieldBytes(info TypeInfo, data []byte) (field, rest []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, unmarshalErrorf("can not format %s: unexpected eof", info)
+	}
+	n := int(readInt(data))
+	data = data[4:]
+	if n < 0 {
+		return nil, data, nil
+	}
+	if len(data) < n {
+		return nil, nil, unmarshalErrorf("can not format %s: unexpected eof", info)
+	}
+	return data[:n], data[n:], nil
+}
+
+func formatTuple(buf *bytes.Buffer, info TupleTypeInfo, data []byte) error {
+	buf.WriteByte('(')
+	for i, elem := range info.Elems {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		var field []byte
+		var err error
+		if len(data) > 0 {
+			if field, data, err = readFieldBytes(info, data); err != nil {
+				return err
+			}
+		}
+		if err := formatLiteral(buf, elem, field); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(')')
+	return nil
+}
+
+func formatUDT(buf *bytes.Buffer, info UDTTypeInfo, data []byte) error {
+	buf.WriteByte('{')
+	// fields missing from the end of data were added after the value was
+	// written and are null, so they are left out.
+	for i, e := range info.Elements {
+		if len(data) == 0 {
+			break
+		}
+		var field []byte
+		var err error
+		if field, data, err = readFieldBytes(info, data); err != nil {
+			return err
+		}
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(QuoteIdentifier(e.Name) + ": ")
+		if err := formatLiteral(buf, e.Type, field); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/*
+ * Content before git sha 34fdeebefcbf183ed7f916f931aa0586fdaa1b40
+ * Copyright (c) 2016, The Gocql authors,
+ * provided under the BSD-3-Clause License.
+ * See the NOTICE file distributed with this work for additional information.
+ */
+
+package gocql
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"gopkg.in/inf.v0"
+)
+
+func TestQuote(t *testing.T) {
+	if got := QuoteIdentifier(`My"Table`); got != `"My""Table"` {
+		t.Errorf("QuoteIdentifier: got %s", got)
+	}
+	if got := QuoteString("it's"); got != `'it''s'` {
+		t.Errorf("QuoteString: got %s", got)
+	}
+}
+
+func TestFormatLiteral(t *testing.T) {
+	native := func(typ Type) NativeType {
+		return NativeType{proto: protoVersion4, typ: typ}
+	}
+	collection := func(typ Type, key, elem TypeInfo) CollectionType {
+		return CollectionType{NativeType: native(typ), Key: key, Elem: elem}
+	}
+	uuid := TimeUUID()
+
+	tests := []struct {
+		info  TypeInfo
+		value interface{}
+		want  string
+	}{
+		{native(TypeText), "it's", `'it''s'`},
+		{native(TypeText), nil, "null"},
+		{native(TypeAscii), "'; DROP TABLE t; --", `'''; DROP TABLE t; --'`},
+		{native(TypeBlob), []byte{0xca, 0xfe}, "0xcafe"},
+		{native(TypeBoolean), true, "true"},
+		{native(TypeInt), 42, "42"},
+		{native(TypeBigInt), int64(-7), "-7"},
+		{native(TypeSmallInt), int16(3), "3"},
+		{native(TypeTinyInt), int8(-1), "-1"},
+		{native(TypeVarint), big.NewInt(123456789), "123456789"},
+		{native(TypeDecimal), inf.NewDec(12345, 2), "123.45"},
+		{native(TypeFloat), float32(1.5), "1.5"},
+		{native(TypeDouble), math.Inf(-1), "-Infinity"},
+		{native(TypeDouble), math.NaN(), "NaN"},
+		{native(TypeTimestamp), time.Unix(1, 5e6), "1005"},
+		{native(TypeDate), time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), "'2020-01-02'"},
+		{native(TypeTime), 90 * time.Second, "90000000000"},
+		{native(TypeDuration), Duration{Months: 1, Days: 2, Nanoseconds: 3}, "1mo2d3ns"},
+		{native(TypeDuration), Duration{Days: -2}, "-2d"},
+		{native(TypeDuration), Duration{}, "0d"},
+		{native(TypeUUID), uuid, uuid.String()},
+		{native(TypeInet), "127.0.0.1", "'127.0.0.1'"},
+		{collection(TypeList, nil, native(TypeText)), []string{"a", "b'"}, `['a', 'b''']`},
+		{collection(TypeSet, nil, native(TypeInt)), []int{1, 2}, "{1, 2}"},
+		{collection(TypeMap, native(TypeText), native(TypeInt)), map[string]int{"b": 2, "a": 1}, "{'a': 1, 'b': 2}"},
+		{collection(TypeList, nil, native(TypeInt)), []int{}, "[]"},
+		{TupleTypeInfo{NativeType: native(TypeTuple), Elems: []TypeInfo{native(TypeInt), native(TypeText)}}, []interface{}{1, nil}, "(1, null)"},
+		{UDTTypeInfo{
+			NativeType: native(TypeUDT),
+			Name:       "address",
+			Elements: []UDTField{
+				{Name: "street", Type: native(TypeText)},
+				{Name: "Zip", Type: native(TypeInt)},
+			},
+		}, map[string]interface{}{"street": "Main", "Zip": 1000}, `{"street": 'Main', "Zip": 1000}`},
+	}
+
+	for _, test := range tests {
+		got, err := FormatLiteral(test.info, test.value)
+		if err != nil {
+			t.Errorf("%s %v: %v", test.info, test.value, err)
+		} else if got != test.want {
+			t.Errorf("%s %v: expected %s, got %s", test.info, test.value, test.want, got)
+		}
+	}
+
+	if _, err := FormatLiteral(native(TypeInt), "nan"); err == nil {
+		t.Error("expected an error formatting a string as an int")
+	}
+}
+
+func TestFormatStatement(t *testing.T) {
+	text := NativeType{proto: protoVersion4, typ: TypeText}
+	integer := NativeType{proto: protoVersion4, typ: TypeInt}
+
+	stmt, err := FormatStatement(`INSERT INTO "t?" (a, b) VALUES (?, ?) -- why?
+		/* or? */ USING TTL ? AND TIMESTAMP 1 // 'done?'`,
+		[]TypeInfo{text, integer, integer}, "it's ?", 2, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO "t?" (a, b) VALUES ('it''s ?', 2) -- why?
+		/* or? */ USING TTL 60 AND TIMESTAMP 1 // 'done?'`
+	if stmt != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, stmt)
+	}
+
+	if stmt, err := FormatStatement("SELECT 'a''?' FROM t WHERE k = $$?$$ AND v = ?", []TypeInfo{integer}, 1); err != nil {
+		t.Fatal(err)
+	} else if want := "SELECT 'a''?' FROM t WHERE k = $$?$$ AND v = 1"; stmt != want {
+		t.Fatalf("expected %s, got %s", want, stmt)
+	}
+
+	if _, err := FormatStatement("SELECT * FROM t WHERE k = ?", nil); err == nil {
+		t.Error("expected an error for a missing value")
+	}
+	if _, err := FormatStatement("SELECT * FROM t", []TypeInfo{integer}, 1); err == nil {
+		t.Error("expected an error for an extra value")
+	}
+}
@@ -0,0 +1,229 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lock implements distributed locks held with lightweight
+// transactions, to serialize work such as schema migrations or singleton jobs
+// across the instances of a service with nothing but the cluster.
+//
+//	locker, err := lock.New(session, lock.Config{Keyspace: "app"})
+//	if err != nil {
+//		return err
+//	}
+//	if err := locker.CreateTable(ctx); err != nil {
+//		return err
+//	}
+//	l, err := locker.Acquire(ctx, "reindex")
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Release(context.Background())
+//
+// Locks expire after Config.TTL unless they are renewed, so that a process
+// dying while it holds a lock does not block the others forever. A process can
+// therefore lose a lock without noticing, for example while paused by the
+// garbage collector. Each acquisition of a lock is numbered by a fencing
+// token, which increases every time the lock is acquired: writes guarded by a
+// lock should carry its token, so that the systems receiving them can reject
+// the writes of processes holding an older token.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	// ErrLockHeld is returned by TryAcquire when the lock is held by another
+	// owner.
+	ErrLockHeld = errors.New("lock: lock held by another owner")
+
+	// ErrLockLost is returned when renewing or releasing a lock which expired,
+	// and may since have been acquired by another owner.
+	ErrLockLost = errors.New("lock: lock lost")
+)
+
+// Config configures the table holding the locks.
+type Config struct {
+	// Keyspace of the table holding the locks, it must exist.
+	Keyspace string
+
+	// Table holding the locks, created by CreateTable.
+	// Default: locks
+	Table string
+
+	// TTL is the time after which a lock expires unless it is renewed.
+	// Default: 1 minute
+	TTL time.Duration
+
+	// RetryInterval is the interval between attempts of Acquire to acquire a
+	// lock held by another owner.
+	// Default: 1 second
+	RetryInterval time.Duration
+}
+
+// Locker acquires the locks of a table.
+type Locker struct {
+	session *gocql.Session
+	cfg     Config
+	table   string
+}
+
+// New returns a locker of the locks held in the table configured by cfg.
+func New(session *gocql.Session, cfg Config) (*Locker, error) {
+	if cfg.Keyspace == "" {
+		return nil, errors.New("lock: no keyspace provided")
+	}
+	if cfg.Table == "" {
+		cfg.Table = "locks"
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+	if cfg.TTL < time.Second {
+		return nil, fmt.Errorf("lock: TTL %v is below the resolution of 1 second", cfg.TTL)
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = time.Second
+	}
+	return &Locker{
+		session: session,
+		cfg:     cfg,
+		table:   gocql.QuoteIdentifier(cfg.Keyspace) + "." + gocql.QuoteIdentifier(cfg.Table),
+	}, nil
+}
+
+// CreateTable creates the table holding the locks if it does not exist, and
+// waits for the schema agreement of the cluster.
+func (l *Locker) CreateTable(ctx context.Context) error {
+	// the owner is written with the TTL of the lock, but not the token which
+	// must outlive the owners to keep increasing.
+	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (name text PRIMARY KEY, owner timeuuid, token bigint)`, l.table)
+	if err := l.session.Query(stmt).WithContext(ctx).Exec(); err != nil {
+		return fmt.Errorf("lock: unable to create table: %v", err)
+	}
+	return l.session.AwaitSchemaAgreement(ctx)
+}
+
+// Acquire acquires the lock name, waiting while it is held by another owner
+// until ctx is done.
+func (l *Locker) Acquire(ctx context.Context, name string) (*Lock, error) {
+	for {
+		lock, err := l.TryAcquire(ctx, name)
+		if err != ErrLockHeld {
+			return lock, err
+		}
+
+		select {
+		case <-time.After(l.cfg.RetryInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryAcquire acquires the lock name, or returns ErrLockHeld if it is held by
+// another owner.
+func (l *Locker) TryAcquire(ctx context.Context, name string) (*Lock, error) {
+	var (
+		owner gocql.UUID
+		token int64
+	)
+	// a serial read completes the lightweight transactions in progress.
+	err := l.session.Query(fmt.Sprintf(`SELECT owner, token FROM %s WHERE name = ?`, l.table), name).
+		WithContext(ctx).Consistency(gocql.Consistency(gocql.Serial)).Scan(&owner, &token)
+	if err != nil && err != gocql.ErrNotFound {
+		return nil, fmt.Errorf("lock: unable to read lock %q: %v", name, err)
+	}
+	if owner != (gocql.UUID{}) {
+		return nil, ErrLockHeld
+	}
+
+	lock := &Lock{locker: l, Name: name, Token: token + 1, owner: gocql.TimeUUID()}
+	batch := l.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	if err == gocql.ErrNotFound {
+		batch.Query(fmt.Sprintf(`INSERT INTO %s (name, token) VALUES (?, ?) IF NOT EXISTS`, l.table),
+			name, lock.Token)
+	} else {
+		batch.Query(fmt.Sprintf(`UPDATE %s SET token = ? WHERE name = ? IF owner = null AND token = ?`, l.table),
+			lock.Token, name, token)
+	}
+	batch.Query(fmt.Sprintf(`UPDATE %s USING TTL ? SET owner = ? WHERE name = ?`, l.table),
+		l.ttl(), lock.owner, name)
+
+	applied, iter, err := l.session.MapExecuteBatchCAS(batch, map[string]interface{}{})
+	if iter != nil {
+		iter.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock: unable to acquire lock %q: %v", name, err)
+	}
+	if !applied {
+		// acquired by another owner since it was read
+		return nil, ErrLockHeld
+	}
+	return lock, nil
+}
+
+func (l *Locker) ttl() int {
+	return int(l.cfg.TTL / time.Second)
+}
+
+// Lock is a lock acquired by a Locker.
+type Lock struct {
+	locker *Locker
+	owner  gocql.UUID
+
+	// Name of the lock.
+	Name string
+	// Token is the fencing token of this acquisition of the lock, greater than
+	// the tokens of the previous acquisitions.
+	Token int64
+}
+
+// Renew extends the lock by the TTL of the locker. It returns ErrLockLost if
+// the lock expired.
+func (lk *Lock) Renew(ctx context.Context) error {
+	l := lk.locker
+	applied, err := l.session.Query(fmt.Sprintf(`UPDATE %s USING TTL ? SET owner = ? WHERE name = ? IF owner = ? AND token = ?`, l.table),
+		l.ttl(), lk.owner, lk.Name, lk.owner, lk.Token).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("lock: unable to renew lock %q: %v", lk.Name, err)
+	}
+	if !applied {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release releases the lock. It returns ErrLockLost if the lock expired.
+func (lk *Lock) Release(ctx context.Context) error {
+	l := lk.locker
+	applied, err := l.session.Query(fmt.Sprintf(`DELETE owner FROM %s WHERE name = ? IF owner = ? AND token = ?`, l.table),
+		lk.Name, lk.owner, lk.Token).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("lock: unable to release lock %q: %v", lk.Name, err)
+	}
+	if !applied {
+		return ErrLockLost
+	}
+	return nil
+}
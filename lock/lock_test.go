@@ -0,0 +1,44 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, Config{}); err == nil {
+		t.Error("expected an error without keyspace")
+	}
+	if _, err := New(nil, Config{Keyspace: "app", TTL: 500 * time.Millisecond}); err == nil {
+		t.Error("expected an error for a TTL below a second")
+	}
+
+	l, err := New(nil, Config{Keyspace: "App"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.table != `"App"."locks"` {
+		t.Errorf("expected quoted table, got %s", l.table)
+	}
+	if l.ttl() != 60 || l.cfg.RetryInterval != time.Second {
+		t.Errorf("unexpected defaults %+v", l.cfg)
+	}
+}
@@ -26,8 +26,13 @@ package gocql
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type StdLogger interface {
@@ -36,6 +41,15 @@ type StdLogger interface {
 	Println(v ...interface{})
 }
 
+// LeveledLogger is a StdLogger which is told the level of the messages a
+// session logs, LogLevelDebug or LogLevelWarning, so that they can be logged
+// at the matching levels of structured loggers, see NewSlogLogger. Sessions
+// log with PrintLevel instead of the Print methods of such loggers.
+type LeveledLogger interface {
+	StdLogger
+	PrintLevel(level LogLevel, msg string)
+}
+
 type nopLogger struct{}
 
 func (n nopLogger) Print(_ ...interface{}) {}
@@ -62,3 +76,269 @@ func (l *defaultLogger) Println(v ...interface{})               { log.Println(v.
 // Logger for logging messages.
 // Deprecated: Use ClusterConfig.Logger instead.
 var Logger StdLogger = &defaultLogger{}
+
+// LogLevel controls which messages a Session logs, see Session.SetLogLevel.
+type LogLevel int32
+
+const (
+	// LogLevelDebug logs debug messages about connections, topology and
+	// events in addition to warnings. It is the default when built with the
+	// gocql_debug tag.
+	LogLevelDebug LogLevel = iota
+	// LogLevelWarning logs warnings and errors. It is the default.
+	LogLevelWarning
+	// LogLevelNone disables logging.
+	LogLevelNone
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelWarning:
+		return "warning"
+	case LogLevelNone:
+		return "none"
+	default:
+		return fmt.Sprintf("unknown_log_level_%d", int32(l))
+	}
+}
+
+// levelLogger logs to a StdLogger the messages of a level which can be changed
+// at runtime. Its Print methods log at LogLevelWarning.
+type levelLogger struct {
+	logger  StdLogger
+	leveled LeveledLogger
+	level   int32
+	sampler *logSampler
+}
+
+func newLevelLogger(logger StdLogger, sampleInterval time.Duration) *levelLogger {
+	level := LogLevelWarning
+	if gocqlDebug {
+		level = LogLevelDebug
+	}
+	l := &levelLogger{logger: logger, level: int32(level)}
+	l.leveled, _ = logger.(LeveledLogger)
+	if sampleInterval > 0 {
+		l.sampler = newLogSampler(sampleInterval)
+	}
+	return l
+}
+
+func (l *levelLogger) setLevel(level LogLevel) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *levelLogger) getLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(&l.level))
+}
+
+// debug reports whether debug messages are logged.
+func (l *levelLogger) debug() bool {
+	return l.getLevel() <= LogLevelDebug
+}
+
+// output logs msg at level unless it is suppressed by the sampler.
+func (l *levelLogger) output(level LogLevel, msg string) {
+	if l.sampler != nil {
+		suppressed, ok := l.sampler.allow(level, msg)
+		if !ok {
+			return
+		}
+		if suppressed > 0 {
+			msg = l.sampler.repeated(msg, suppressed)
+		}
+	}
+	l.write(level, msg)
+}
+
+// flushSampled logs the number of suppressed occurrences of the messages which
+// did not recur within the interval of the sampler.
+func (l *levelLogger) flushSampled() {
+	for _, m := range l.sampler.flush() {
+		if l.getLevel() <= m.level {
+			l.write(m.level, l.sampler.repeated(m.msg, m.suppressed))
+		}
+	}
+}
+
+// flushSampledLoop calls flushSampled every interval of the sampler until ctx
+// is done.
+func (l *levelLogger) flushSampledLoop(ctx context.Context) {
+	ticker := time.NewTicker(l.sampler.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.flushSampled()
+		case <-ctx.Done():
+			l.flushSampled()
+			return
+		}
+	}
+}
+
+func (l *levelLogger) write(level LogLevel, msg string) {
+	if l.leveled != nil {
+		l.leveled.PrintLevel(level, msg)
+		return
+	}
+	l.logger.Print(msg)
+}
+
+// debugf logs a message at LogLevelDebug.
+func (l *levelLogger) debugf(format string, v ...interface{}) {
+	if !l.debug() {
+		return
+	}
+	if l.sampler != nil || l.leveled != nil {
+		l.output(LogLevelDebug, fmt.Sprintf(format, v...))
+		return
+	}
+	l.logger.Printf(format, v...)
+}
+
+func (l *levelLogger) Print(v ...interface{}) {
+	if l.getLevel() > LogLevelWarning {
+		return
+	}
+	if l.sampler != nil || l.leveled != nil {
+		l.output(LogLevelWarning, fmt.Sprint(v...))
+		return
+	}
+	l.logger.Print(v...)
+}
+
+func (l *levelLogger) Printf(format string, v ...interface{}) {
+	if l.getLevel() > LogLevelWarning {
+		return
+	}
+	if l.sampler != nil || l.leveled != nil {
+		l.output(LogLevelWarning, fmt.Sprintf(format, v...))
+		return
+	}
+	l.logger.Printf(format, v...)
+}
+
+func (l *levelLogger) Println(v ...interface{}) {
+	if l.getLevel() > LogLevelWarning {
+		return
+	}
+	if l.sampler != nil || l.leveled != nil {
+		l.output(LogLevelWarning, fmt.Sprintln(v...))
+		return
+	}
+	l.logger.Println(v...)
+}
+
+// maxSampledMessages bounds the number of distinct messages tracked by a
+// logSampler, the oldest ones are forgotten beyond it.
+const maxSampledMessages = 1000
+
+// logSampler collapses identical messages logged within an interval: the first
+// occurrence is logged, the following ones are counted and the count is
+// reported along with the first occurrence after the interval, or by flush if
+// the message does not recur.
+type logSampler struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	messages map[string]*sampledMessage
+	// forgotten are the messages with suppressed occurrences dropped to
+	// bound the number of messages, until they are flushed.
+	forgotten []sampledMessage
+}
+
+type sampledMessage struct {
+	msg        string
+	level      LogLevel
+	logged     time.Time
+	suppressed int
+}
+
+func newLogSampler(interval time.Duration) *logSampler {
+	return &logSampler{
+		interval: interval,
+		now:      time.Now,
+		messages: make(map[string]*sampledMessage),
+	}
+}
+
+// repeated returns msg annotated with its number of suppressed occurrences.
+func (s *logSampler) repeated(msg string, suppressed int) string {
+	return fmt.Sprintf("%s (repeated %d more times in the last %v)", strings.TrimSuffix(msg, "\n"), suppressed, s.interval)
+}
+
+// allow reports whether msg should be logged at level, and how many
+// occurrences of it were suppressed since it was last logged.
+func (s *logSampler) allow(level LogLevel, msg string) (suppressed int, ok bool) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, seen := s.messages[msg]
+	if !seen {
+		if len(s.messages) >= maxSampledMessages {
+			s.forget(now)
+		}
+		s.messages[msg] = &sampledMessage{msg: msg, level: level, logged: now}
+		return 0, true
+	}
+	if now.Sub(m.logged) < s.interval {
+		m.suppressed++
+		return 0, false
+	}
+
+	suppressed = m.suppressed
+	m.logged = now
+	m.suppressed = 0
+	return suppressed, true
+}
+
+// forget drops the messages last logged more than an interval ago, or all of
+// them if none is that old, keeping the ones with suppressed occurrences to be
+// flushed.
+func (s *logSampler) forget(now time.Time) {
+	for msg, m := range s.messages {
+		if now.Sub(m.logged) >= s.interval {
+			s.drop(m)
+			delete(s.messages, msg)
+		}
+	}
+	if len(s.messages) >= maxSampledMessages {
+		for _, m := range s.messages {
+			s.drop(m)
+		}
+		s.messages = make(map[string]*sampledMessage)
+	}
+}
+
+func (s *logSampler) drop(m *sampledMessage) {
+	if m.suppressed > 0 && len(s.forgotten) < maxSampledMessages {
+		s.forgotten = append(s.forgotten, *m)
+	}
+}
+
+// flush returns the messages with suppressed occurrences which were not logged
+// again within the interval, and forgets them along with the other messages
+// last logged more than an interval ago.
+func (s *logSampler) flush() []sampledMessage {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for msg, m := range s.messages {
+		if now.Sub(m.logged) >= s.interval {
+			s.drop(m)
+			delete(s.messages, msg)
+		}
+	}
+	flushed := s.forgotten
+	s.forgotten = nil
+	return flushed
+}
@@ -0,0 +1,57 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a LeveledLogger writing the messages of sessions to
+// logger, the debug messages at slog.LevelDebug and the others at
+// slog.LevelWarn, so that the driver logs can be set as ClusterConfig.Logger
+// alongside the structured logs of the application. Adapters for other
+// structured loggers, such as zap or logrus, can be written the same way by
+// implementing LeveledLogger.
+func NewSlogLogger(logger *slog.Logger) LeveledLogger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) PrintLevel(level LogLevel, msg string) {
+	lvl := slog.LevelWarn
+	if level <= LogLevelDebug {
+		lvl = slog.LevelDebug
+	}
+	l.logger.Log(context.Background(), lvl, strings.TrimSuffix(msg, "\n"))
+}
+
+func (l *slogLogger) Print(v ...interface{}) { l.PrintLevel(LogLevelWarning, fmt.Sprint(v...)) }
+func (l *slogLogger) Printf(format string, v ...interface{}) {
+	l.PrintLevel(LogLevelWarning, fmt.Sprintf(format, v...))
+}
+func (l *slogLogger) Println(v ...interface{}) { l.PrintLevel(LogLevelWarning, fmt.Sprintln(v...)) }
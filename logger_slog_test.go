@@ -0,0 +1,65 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	logger := newLevelLogger(NewSlogLogger(slog.New(handler)), 0)
+	logger.setLevel(LogLevelWarning)
+
+	logger.Printf("gocql: unable to dial %q: %v", "10.0.0.1", "timeout")
+	logger.Println("gocql:", "no hosts available")
+	logger.debugf("gocql: handling frame: %v\n", "frame")
+	logger.setLevel(LogLevelDebug)
+	logger.debugf("gocql: handling frame: %v\n", "frame")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		`level=WARN msg="gocql: unable to dial \"10.0.0.1\": timeout"`,
+		`level=WARN msg="gocql: no hosts available"`,
+		`level=DEBUG msg="gocql: handling frame: frame"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], lines[i])
+		}
+	}
+}
@@ -73,3 +73,29 @@ func (s LZ4Compressor) Decode(data []byte) ([]byte, error) {
 	n, err := lz4.UncompressBlock(data[4:], buf)
 	return buf[:n], err
 }
+
+// EncodeBlock compresses data without the length prefix, as used by the
+// segments of protocol v5.
+func (s LZ4Compressor) EncodeBlock(data []byte) ([]byte, error) {
+	buf := make([]byte, lz4.CompressBlockBound(len(data)))
+	var compressor lz4.Compressor
+	n, err := compressor.CompressBlock(data, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// DecodeBlock decompresses a block without the length prefix, as used by the
+// segments of protocol v5.
+func (s LZ4Compressor) DecodeBlock(data []byte, uncompressedLength int) ([]byte, error) {
+	buf := make([]byte, uncompressedLength)
+	n, err := lz4.UncompressBlock(data, buf)
+	if err != nil {
+		return nil, err
+	}
+	if n != uncompressedLength {
+		return nil, fmt.Errorf("cassandra lz4 block decompressed to %d bytes, expected %d", n, uncompressedLength)
+	}
+	return buf, nil
+}
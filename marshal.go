@@ -36,14 +36,14 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/inf.v0"
 )
 
 var (
-	bigOne     = big.NewInt(1)
-	emptyValue reflect.Value
+	bigOne = big.NewInt(1)
 )
 
 var (
@@ -51,7 +51,8 @@ var (
 )
 
 // Marshaler is the interface implemented by objects that can marshal
-// themselves into values understood by Cassandra.
+// themselves into values understood by Cassandra. Implementations can be
+// tested against the golden fixtures of the marshaltest package.
 type Marshaler interface {
 	MarshalCQL(info TypeInfo) ([]byte, error)
 }
@@ -86,6 +87,8 @@ type Unmarshaler interface {
 //	time                        | time.Duration      | duration since start of day
 //	timestamp                   | int64              | milliseconds since Unix epoch
 //	timestamp                   | time.Time          |
+//	timestamp, bigint           | gocql.TimestampMillis  | bigint is stored as microseconds since Unix epoch
+//	timestamp, bigint           | gocql.TimestampMicros  | timestamp is stored as milliseconds since Unix epoch
 //	list, set                   | slice, array       |
 //	list, set                   | map[X]struct{}     |
 //	map                         | map[X]Y            |
@@ -102,7 +105,7 @@ type Unmarshaler interface {
 //	tuple                       | struct             | fields are marshaled in order of declaration
 //	user-defined type           | gocql.UDTMarshaler | MarshalUDT is called
 //	user-defined type           | map[string]interface{} |
-//	user-defined type           | struct             | struct fields' cql tags are used for column names
+//	user-defined type           | struct             | see below
 //	date                        | int64              | milliseconds since Unix epoch to start of day (in UTC)
 //	date                        | time.Time          | start of day (in UTC)
 //	date                        | string             | parsed using "2006-01-02" format
@@ -110,6 +113,14 @@ type Unmarshaler interface {
 //	duration                    | time.Duration      |
 //	duration                    | gocql.Duration     |
 //	duration                    | string             | parsed with time.ParseDuration
+//
+// The fields of user-defined types are marshaled from the struct fields named
+// by their cql tag or, without tag, by the name mapped by the NameMapper, snake
+// case by default, or by their name, compared case insensitively if no name
+// matches exactly. SetFieldNames overrides the names of the fields of structs
+// which can not be tagged. Fields named "-" and unexported fields are ignored,
+// and the fields of embedded structs are promoted. The fields of the
+// user-defined type without struct field are marshaled as null.
 func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 	if info.Version() < protoVersion1 {
 		panic("protocol version not set")
@@ -177,6 +188,13 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 		return nil, ErrorUDTUnavailable
 	}
 
+	if info.Type() == TypeCustom {
+		if b, ok := value.([]byte); ok {
+			return b, nil
+		}
+		return nil, UnknownTypeError{Class: info.Custom()}
+	}
+
 	// TODO(tux21b): add the remaining types
 	return nil, fmt.Errorf("can not marshal %T into %s", value, info)
 }
@@ -206,6 +224,8 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 //	time                                    | *time.Duration          |
 //	timestamp                               | *int64                  | milliseconds since Unix epoch
 //	timestamp                               | *time.Time              |
+//	timestamp, bigint                       | *gocql.TimestampMillis  | bigint is read as microseconds since Unix epoch
+//	timestamp, bigint                       | *gocql.TimestampMicros  | timestamp is read as milliseconds since Unix epoch
 //	list, set                               | *slice, *array          |
 //	map                                     | *map[X]Y                |
 //	uuid, timeuuid                          | *string                 | see UUID.String
@@ -218,7 +238,7 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 //	tuple                                   | *struct                 | struct fields are set in order of declaration
 //	user-defined types                      | gocql.UDTUnmarshaler    | UnmarshalUDT is called
 //	user-defined types                      | *map[string]interface{} |
-//	user-defined types                      | *struct                 | cql tag is used to determine field name
+//	user-defined types                      | *struct                 | struct fields are matched as in Marshal
 //	date                                    | *time.Time              | time of beginning of the day (in UTC)
 //	date                                    | *string                 | formatted with 2006-01-02 format
 //	duration                                | *gocql.Duration         |
@@ -281,6 +301,13 @@ func Unmarshal(info TypeInfo, data []byte, value interface{}) error {
 		return ErrorUDTUnavailable
 	}
 
+	if info.Type() == TypeCustom {
+		if _, ok := value.(*[]byte); ok {
+			return unmarshalVarchar(info, data, value)
+		}
+		return UnknownTypeError{Class: info.Custom()}
+	}
+
 	// TODO(tux21b): add the remaining types
 	return fmt.Errorf("can not unmarshal %s into %T", info, value)
 }
@@ -2283,27 +2310,13 @@ func marshalUDT(info TypeInfo, value interface{}) ([]byte, error) {
 		return nil, marshalErrorf("cannot marshal %T into %s", value, info)
 	}
 
-	fields := make(map[string]reflect.Value)
-	t := reflect.TypeOf(value)
-	for i := 0; i < t.NumField(); i++ {
-		sf := t.Field(i)
-
-		if tag := sf.Tag.Get("cql"); tag != "" {
-			fields[tag] = k.Field(i)
-		}
-	}
-
+	fields := structUDTFields(k.Type())
 	var buf []byte
 	for _, e := range udt.Elements {
-		f, ok := fields[e.Name]
-		if !ok {
-			f = k.FieldByName(e.Name)
-		}
-
 		var data []byte
-		if f.IsValid() && f.CanInterface() {
+		if index, ok := fields.lookup(e.Name); ok {
 			var err error
-			data, err = Marshal(e.Type, f.Interface())
+			data, err = Marshal(e.Type, k.FieldByIndex(index).Interface())
 			if err != nil {
 				return nil, err
 			}
@@ -2315,6 +2328,95 @@ func marshalUDT(info TypeInfo, value interface{}) ([]byte, error) {
 	return buf, nil
 }
 
+// udtFields maps the names of the fields of user defined types to the indexes
+// of the fields of a struct they are marshaled from and unmarshaled into.
+type udtFields struct {
+	byName map[string][]int
+	// byLower maps the lower case names, to match fields which differ only
+	// by their case, like the Street field and the street UDT field.
+	byLower map[string][]int
+}
+
+var udtFieldsCache sync.Map // map[reflect.Type]*udtFields
+
+// structUDTFields returns the fields of the struct type t, named by their
+// override set with SetFieldNames, their cql tag or else by the name mapped by
+// the NameMapper and by their name. Names of "-" skip fields, and the fields of
+// embedded structs are promoted, the fields of the outer structs taking
+// precedence, then the explicitly named ones.
+func structUDTFields(t reflect.Type) *udtFields {
+	if f, ok := udtFieldsCache.Load(t); ok {
+		return f.(*udtFields)
+	}
+
+	// the fields are cached while the name mapping can not change, so that
+	// changing it clears the cache after the fields are stored.
+	nameMappingMu.RLock()
+	defer nameMappingMu.RUnlock()
+	fields := &udtFields{byName: make(map[string][]int), byLower: make(map[string][]int)}
+	fields.add(t, nil)
+	f, _ := udtFieldsCache.LoadOrStore(t, fields)
+	return f.(*udtFields)
+}
+
+func (f *udtFields) add(t reflect.Type, index []int) {
+	var embedded []int
+	overrides := fieldNameOverrides[t]
+	// explicitly named fields are added first to take precedence over the other ones
+	for _, explicit := range []bool{true, false} {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, ok := overrides[sf.Name]
+			if !ok {
+				name = sf.Tag.Get("cql")
+			}
+			if name == "-" || (name != "") != explicit {
+				continue
+			}
+			if name == "" && sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				embedded = append(embedded, i)
+				continue
+			}
+			if sf.PkgPath != "" {
+				// unexported
+				continue
+			}
+
+			fieldIndex := append(append([]int(nil), index...), i)
+			if name != "" {
+				f.set(name, fieldIndex)
+				continue
+			}
+			if nameMapper != nil {
+				f.set(nameMapper.MapName(sf.Name), fieldIndex)
+			}
+			f.set(sf.Name, fieldIndex)
+		}
+	}
+
+	for _, i := range embedded {
+		f.add(t.Field(i).Type, append(append([]int(nil), index...), i))
+	}
+}
+
+// set names the field at index name, unless a field already has the name.
+func (f *udtFields) set(name string, index []int) {
+	if _, ok := f.byName[name]; !ok {
+		f.byName[name] = index
+	}
+	if _, ok := f.byLower[strings.ToLower(name)]; !ok {
+		f.byLower[strings.ToLower(name)] = index
+	}
+}
+
+func (f *udtFields) lookup(name string) ([]int, bool) {
+	if index, ok := f.byName[name]; ok {
+		return index, true
+	}
+	index, ok := f.byLower[strings.ToLower(name)]
+	return index, ok
+}
+
 func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 	switch v := value.(type) {
 	case Unmarshaler:
@@ -2403,16 +2505,7 @@ func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 		return nil
 	}
 
-	t := k.Type()
-	fields := make(map[string]reflect.Value, t.NumField())
-	for i := 0; i < t.NumField(); i++ {
-		sf := t.Field(i)
-
-		if tag := sf.Tag.Get("cql"); tag != "" {
-			fields[tag] = k.Field(i)
-		}
-	}
-
+	fields := structUDTFields(k.Type())
 	udt := info.(UDTTypeInfo)
 	for id, e := range udt.Elements {
 		if len(data) == 0 {
@@ -2426,16 +2519,14 @@ func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 		var p []byte
 		p, data = readBytes(data)
 
-		f, ok := fields[e.Name]
+		index, ok := fields.lookup(e.Name)
 		if !ok {
-			f = k.FieldByName(e.Name)
-			if f == emptyValue {
-				// skip fields which exist in the UDT but not in
-				// the struct passed in
-				continue
-			}
+			// skip fields which exist in the UDT but not in
+			// the struct passed in
+			continue
 		}
 
+		f := k.FieldByIndex(index)
 		if !f.IsValid() || !f.CanAddr() {
 			return unmarshalErrorf("cannot unmarshal %s into %T: field %v is not valid", info, value, e.Name)
 		}
@@ -2474,10 +2565,12 @@ type NativeType struct {
 	proto  byte
 	typ    Type
 	custom string // only used for TypeCustom
+	// asBytes reads TypeCustom values as []byte, see ClusterConfig.CustomTypesAsBytes.
+	asBytes bool
 }
 
 func NewNativeType(proto byte, typ Type, custom string) NativeType {
-	return NativeType{proto, typ, custom}
+	return NativeType{proto: proto, typ: typ, custom: custom}
 }
 
 func (t NativeType) NewWithError() (interface{}, error) {
@@ -2736,6 +2829,18 @@ func marshalErrorf(format string, args ...interface{}) MarshalError {
 	return MarshalError(fmt.Sprintf(format, args...))
 }
 
+// UnknownTypeError is returned when reading or writing values of a custom
+// server type, identified by its class name, for which the driver has no Go
+// type. Such values can be read into and written from []byte, see also
+// ClusterConfig.CustomTypesAsBytes.
+type UnknownTypeError struct {
+	Class string
+}
+
+func (e UnknownTypeError) Error() string {
+	return fmt.Sprintf("gocql: no Go type for custom CQL type %s, use []byte to read or write its raw values", e.Class)
+}
+
 type UnmarshalError string
 
 func (m UnmarshalError) Error() string {
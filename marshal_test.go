@@ -2175,6 +2175,68 @@ func TestMarshalUDTStruct(t *testing.T) {
 	})
 }
 
+func TestUDTStructMapping(t *testing.T) {
+	text := NativeType{proto: 4, typ: TypeVarchar}
+	addressInfo := UDTTypeInfo{NativeType{proto: 4, typ: TypeUDT}, "ks", "address", []UDTField{
+		{Name: "street", Type: text},
+		{Name: "city", Type: text},
+	}}
+	userInfo := UDTTypeInfo{NativeType{proto: 4, typ: TypeUDT}, "ks", "user", []UDTField{
+		{Name: "name", Type: text},
+		{Name: "home", Type: addressInfo},
+		{Name: "previous", Type: CollectionType{NativeType: NativeType{proto: 4, typ: TypeList}, Elem: addressInfo}},
+		{Name: "by_label", Type: CollectionType{NativeType: NativeType{proto: 4, typ: TypeMap}, Key: text, Elem: addressInfo}},
+		{Name: "secret", Type: text},
+	}}
+
+	type address struct {
+		Street string
+		Town   string `cql:"city"`
+	}
+	type person struct {
+		Name string
+	}
+	type user struct {
+		person
+		Home     *address
+		Previous []address
+		Labels   map[string]address `cql:"by_label"`
+		Secret   string             `cql:"-"`
+		secret   string
+	}
+
+	value := &user{
+		person:   person{Name: "Ada"},
+		Home:     &address{Street: "1 Main St", Town: "Springfield"},
+		Previous: []address{{Street: "2 Side St", Town: "Shelbyville"}},
+		Labels:   map[string]address{"work": {Street: "3 Office Rd", Town: "Capital City"}},
+		Secret:   "exported",
+		secret:   "unexported",
+	}
+	data, err := Marshal(userInfo, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got user
+	if err := Unmarshal(userInfo, data, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := *value
+	expected.Secret, expected.secret = "", ""
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %+v, expected %+v", got, expected)
+	}
+
+	var m map[string]interface{}
+	if err := Unmarshal(userInfo, data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["secret"] != "" {
+		t.Errorf("got secret %q, expected the field to be marshaled as null", m["secret"])
+	}
+}
+
 func TestMarshalNil(t *testing.T) {
 	types := []Type{
 		TypeAscii,
@@ -2543,3 +2605,112 @@ func bytesWithLength(data ...[]byte) []byte {
 	}
 	return ret
 }
+
+func TestTimestampPrecision(t *testing.T) {
+	timestampType := NativeType{proto: 4, typ: TypeTimestamp}
+	bigintType := NativeType{proto: 4, typ: TypeBigInt}
+	instant := time.Date(2023, 5, 17, 10, 11, 12, 345678900, time.UTC)
+
+	millis := TimestampMillisFromTime(instant)
+	if want := TimestampMillis(instant.UnixNano() / 1e6); millis != want {
+		t.Fatalf("TimestampMillisFromTime: expected %d got %d", want, millis)
+	}
+	micros := TimestampMicrosFromTime(instant)
+	if want := TimestampMicros(instant.UnixNano() / 1e3); micros != want {
+		t.Fatalf("TimestampMicrosFromTime: expected %d got %d", want, micros)
+	}
+
+	tests := []struct {
+		info  TypeInfo
+		value interface{}
+		data  []byte
+	}{
+		{timestampType, millis, encBigInt(int64(millis))},
+		{timestampType, micros, encBigInt(int64(millis))},
+		{bigintType, millis, encBigInt(int64(millis) * 1e3)},
+		{bigintType, micros, encBigInt(int64(micros))},
+	}
+	for i, test := range tests {
+		data, err := Marshal(test.info, test.value)
+		if err != nil {
+			t.Errorf("#%d: marshal %T into %s: %v", i, test.value, test.info, err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("#%d: marshal %T into %s: expected %x got %x", i, test.value, test.info, test.data, data)
+		}
+	}
+
+	var gotMillis TimestampMillis
+	if err := Unmarshal(bigintType, encBigInt(int64(micros)), &gotMillis); err != nil {
+		t.Fatal(err)
+	} else if gotMillis != millis {
+		t.Errorf("unmarshal bigint into TimestampMillis: expected %d got %d", millis, gotMillis)
+	}
+
+	var gotMicros TimestampMicros
+	if err := Unmarshal(timestampType, encBigInt(int64(millis)), &gotMicros); err != nil {
+		t.Fatal(err)
+	} else if gotMicros != millis.Micros() {
+		t.Errorf("unmarshal timestamp into TimestampMicros: expected %d got %d", millis.Micros(), gotMicros)
+	}
+
+	if got := micros.Time(); !got.Equal(instant.Truncate(time.Microsecond)) {
+		t.Errorf("TimestampMicros.Time: expected %v got %v", instant.Truncate(time.Microsecond), got)
+	}
+
+	beforeEpoch := TimestampMicros(-1500)
+	if got := beforeEpoch.Millis(); got != -2 {
+		t.Errorf("TimestampMicros.Millis before epoch: expected -2 got %d", got)
+	}
+	if got, want := beforeEpoch.Time(), time.Unix(0, -1500*1e3).UTC(); !got.Equal(want) {
+		t.Errorf("TimestampMicros.Time before epoch: expected %v got %v", want, got)
+	}
+
+	if _, err := Marshal(NativeType{proto: 4, typ: TypeInt}, millis); err == nil {
+		t.Error("expected error marshaling TimestampMillis into int")
+	}
+}
+
+func TestCustomTypes(t *testing.T) {
+	const class = "com.example.CustomType"
+
+	f := newFramer(nil, protoVersion4)
+	f.writeShort(uint16(TypeCustom))
+	f.writeString(class)
+	f.writeShort(uint16(TypeCustom))
+	f.writeString(class)
+	strict := f.readTypeInfo()
+	f.customTypesAsBytes = true
+	asBytes := f.readTypeInfo()
+
+	expectedErr := UnknownTypeError{Class: class}
+	if _, err := strict.NewWithError(); err != expectedErr {
+		t.Errorf("got error %v creating value, expected %v", err, expectedErr)
+	}
+	if v, err := asBytes.NewWithError(); err != nil {
+		t.Errorf("creating value: %v", err)
+	} else if _, ok := v.(*[]byte); !ok {
+		t.Errorf("got value %T, expected *[]byte", v)
+	}
+
+	var s string
+	if err := Unmarshal(strict, []byte("raw"), &s); err != expectedErr {
+		t.Errorf("got error %v unmarshaling into string, expected %v", err, expectedErr)
+	}
+	var b []byte
+	if err := Unmarshal(strict, []byte("raw"), &b); err != nil {
+		t.Errorf("unmarshaling into []byte: %v", err)
+	} else if string(b) != "raw" {
+		t.Errorf("got %q, expected raw", b)
+	}
+
+	if _, err := Marshal(strict, "raw"); err != expectedErr {
+		t.Errorf("got error %v marshaling string, expected %v", err, expectedErr)
+	}
+	if data, err := Marshal(strict, []byte("raw")); err != nil {
+		t.Errorf("marshaling []byte: %v", err)
+	} else if string(data) != "raw" {
+		t.Errorf("got %q, expected raw", data)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package marshaltest
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/inf.v0"
+)
+
+// Case is a golden fixture: the bytes a value of a CQL type is encoded to with
+// a protocol version.
+type Case struct {
+	// Name describes the value.
+	Name string
+	// Proto is the protocol version.
+	Proto byte
+	// Type is the CQL type, of the protocol version.
+	Type gocql.TypeInfo
+	// Value is the Go value, which is unmarshaled from Data into a value of
+	// its own type.
+	Value interface{}
+	// Data is the encoding of the value.
+	Data []byte
+}
+
+func (c Case) String() string {
+	return fmt.Sprintf("v%d/%s/%s", c.Proto, c.Type, c.Name)
+}
+
+// fixture is a case for the protocol versions from minProto, data returns its
+// bytes for a protocol version.
+type fixture struct {
+	name     string
+	minProto byte
+	typ      func(proto byte) gocql.TypeInfo
+	value    interface{}
+	data     func(proto byte) []byte
+}
+
+const (
+	minProto = 1
+	maxProto = 5
+)
+
+// Cases returns the golden fixtures of every CQL type, for every protocol
+// version from 1 to 5 the type exists in.
+func Cases() []Case {
+	var cases []Case
+	for proto := byte(minProto); proto <= maxProto; proto++ {
+		for _, f := range fixtures {
+			if proto < f.minProto {
+				continue
+			}
+			cases = append(cases, Case{
+				Name:  f.name,
+				Proto: proto,
+				Type:  f.typ(proto),
+				Value: f.value,
+				Data:  f.data(proto),
+			})
+		}
+	}
+	return cases
+}
+
+func native(typ gocql.Type) func(proto byte) gocql.TypeInfo {
+	return func(proto byte) gocql.TypeInfo {
+		return gocql.NewNativeType(proto, typ, "")
+	}
+}
+
+func collection(typ, key, elem gocql.Type) func(proto byte) gocql.TypeInfo {
+	return func(proto byte) gocql.TypeInfo {
+		info := gocql.CollectionType{
+			NativeType: gocql.NewNativeType(proto, typ, ""),
+			Elem:       gocql.NewNativeType(proto, elem, ""),
+		}
+		if typ == gocql.TypeMap {
+			info.Key = gocql.NewNativeType(proto, key, "")
+		}
+		return info
+	}
+}
+
+func bytesOf(data ...byte) func(proto byte) []byte {
+	return func(byte) []byte {
+		return data
+	}
+}
+
+// collectionBytes returns the encoding of a collection of n elements, whose
+// sizes and values are sizedValues, with the sizes of the protocol version.
+func collectionBytes(n int, sizedValues ...[]byte) func(proto byte) []byte {
+	return func(proto byte) []byte {
+		var data []byte
+		size := func(n int) {
+			if proto > 2 {
+				data = append(data, byte(n>>24), byte(n>>16))
+			}
+			data = append(data, byte(n>>8), byte(n))
+		}
+		size(n)
+		for _, v := range sizedValues {
+			size(len(v))
+			data = append(data, v...)
+		}
+		return data
+	}
+}
+
+var fixtures = []fixture{
+	{name: "hello", typ: native(gocql.TypeAscii), value: "hello",
+		data: bytesOf('h', 'e', 'l', 'l', 'o')},
+	{name: "-2", typ: native(gocql.TypeBigInt), value: int64(-2),
+		data: bytesOf(0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe)},
+	{name: "1<<40", typ: native(gocql.TypeBigInt), value: int64(1 << 40),
+		data: bytesOf(0, 0, 0x01, 0, 0, 0, 0, 0)},
+	{name: "bytes", typ: native(gocql.TypeBlob), value: []byte{1, 2, 3},
+		data: bytesOf(1, 2, 3)},
+	{name: "true", typ: native(gocql.TypeBoolean), value: true,
+		data: bytesOf(1)},
+	{name: "false", typ: native(gocql.TypeBoolean), value: false,
+		data: bytesOf(0)},
+	{name: "42", typ: native(gocql.TypeCounter), value: int64(42),
+		data: bytesOf(0, 0, 0, 0, 0, 0, 0, 42)},
+	{name: "123.45", typ: native(gocql.TypeDecimal), value: inf.NewDec(12345, 2),
+		data: bytesOf(0, 0, 0, 2, 0x30, 0x39)},
+	{name: "-0.5", typ: native(gocql.TypeDecimal), value: inf.NewDec(-5, 1),
+		data: bytesOf(0, 0, 0, 1, 0xfb)},
+	{name: "1.5", typ: native(gocql.TypeDouble), value: 1.5,
+		data: bytesOf(0x3f, 0xf8, 0, 0, 0, 0, 0, 0)},
+	{name: "1.5", typ: native(gocql.TypeFloat), value: float32(1.5),
+		data: bytesOf(0x3f, 0xc0, 0, 0)},
+	{name: "-1", typ: native(gocql.TypeInt), value: int32(-1),
+		data: bytesOf(0xff, 0xff, 0xff, 0xff)},
+	{name: "258", typ: native(gocql.TypeInt), value: int32(258),
+		data: bytesOf(0, 0, 0x01, 0x02)},
+	{name: "utf-8", typ: native(gocql.TypeText), value: "héllo",
+		data: bytesOf('h', 0xc3, 0xa9, 'l', 'l', 'o')},
+	{name: "1970-01-01T00:00:01.005Z", typ: native(gocql.TypeTimestamp), value: time.Unix(1, 5e6).UTC(),
+		data: bytesOf(0, 0, 0, 0, 0, 0, 0x03, 0xed)},
+	{name: "1969-12-31T23:59:59Z", typ: native(gocql.TypeTimestamp), value: time.Unix(-1, 0).UTC(),
+		data: bytesOf(0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfc, 0x18)},
+	{name: "v4", typ: native(gocql.TypeUUID), value: gocql.UUID{0x3f, 0x2a, 0x5c, 0x1e, 0x8d, 0x4b, 0x4e, 0x1a, 0x9c, 0x7f, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab},
+		data: bytesOf(0x3f, 0x2a, 0x5c, 0x1e, 0x8d, 0x4b, 0x4e, 0x1a, 0x9c, 0x7f, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab)},
+	{name: "utf-8", typ: native(gocql.TypeVarchar), value: "héllo",
+		data: bytesOf('h', 0xc3, 0xa9, 'l', 'l', 'o')},
+	{name: "-129", typ: native(gocql.TypeVarint), value: int64(-129),
+		data: bytesOf(0xff, 0x7f)},
+	{name: "128", typ: native(gocql.TypeVarint), value: int64(128),
+		data: bytesOf(0x00, 0x80)},
+	{name: "2^64", typ: native(gocql.TypeVarint), value: new(big.Int).Lsh(big.NewInt(1), 64),
+		data: bytesOf(0x01, 0, 0, 0, 0, 0, 0, 0, 0)},
+	{name: "v1", typ: native(gocql.TypeTimeUUID), value: gocql.UUID{0x58, 0x8b, 0x3c, 0x20, 0x0f, 0x4d, 0x11, 0xe1, 0x80, 0x80, 0x02, 0x42, 0xac, 0x11, 0x00, 0x02},
+		data: bytesOf(0x58, 0x8b, 0x3c, 0x20, 0x0f, 0x4d, 0x11, 0xe1, 0x80, 0x80, 0x02, 0x42, 0xac, 0x11, 0x00, 0x02)},
+	{name: "ipv4", typ: native(gocql.TypeInet), value: net.IP{127, 0, 0, 1},
+		data: bytesOf(127, 0, 0, 1)},
+	{name: "ipv6", typ: native(gocql.TypeInet), value: net.IPv6loopback,
+		data: bytesOf(0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1)},
+	{name: "1970-01-02", minProto: 4, typ: native(gocql.TypeDate), value: time.Date(1970, 1, 2, 0, 0, 0, 0, time.UTC),
+		data: bytesOf(0x80, 0, 0, 0x01)},
+	{name: "1969-12-31", minProto: 4, typ: native(gocql.TypeDate), value: time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC),
+		data: bytesOf(0x7f, 0xff, 0xff, 0xff)},
+	{name: "00:00:01.000000123", minProto: 4, typ: native(gocql.TypeTime), value: time.Second + 123,
+		data: bytesOf(0, 0, 0, 0, 0x3b, 0x9a, 0xca, 0x7b)},
+	{name: "-2", minProto: 4, typ: native(gocql.TypeSmallInt), value: int16(-2),
+		data: bytesOf(0xff, 0xfe)},
+	{name: "-2", minProto: 4, typ: native(gocql.TypeTinyInt), value: int8(-2),
+		data: bytesOf(0xfe)},
+	{name: "1mo2d3ns", minProto: 4, typ: native(gocql.TypeDuration), value: gocql.Duration{Months: 1, Days: 2, Nanoseconds: 3},
+		data: bytesOf(0x02, 0x04, 0x06)},
+	{name: "-1mo", minProto: 4, typ: native(gocql.TypeDuration), value: gocql.Duration{Months: -1},
+		data: bytesOf(0x01, 0x00, 0x00)},
+	{name: "[1,2]", typ: collection(gocql.TypeList, 0, gocql.TypeInt), value: []int32{1, 2},
+		data: collectionBytes(2, []byte{0, 0, 0, 1}, []byte{0, 0, 0, 2})},
+	{name: "[]", typ: collection(gocql.TypeList, 0, gocql.TypeInt), value: []int32{},
+		data: collectionBytes(0)},
+	{name: "{a}", typ: collection(gocql.TypeSet, 0, gocql.TypeText), value: []string{"a"},
+		data: collectionBytes(1, []byte("a"))},
+	{name: "{a:1}", typ: collection(gocql.TypeMap, gocql.TypeText, gocql.TypeInt), value: map[string]int32{"a": 1},
+		data: collectionBytes(1, []byte("a"), []byte{0, 0, 0, 1})},
+	{name: "(1,a)", minProto: 3, typ: tupleType, value: []interface{}{1, "a"},
+		data: bytesOf(0, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 1, 'a')},
+	{name: "{a:1,b:x}", minProto: 3, typ: udtType, value: map[string]interface{}{"a": 1, "b": "x"},
+		data: bytesOf(0, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 1, 'x')},
+	{name: "bytes", typ: customType, value: []byte{0xca, 0xfe},
+		data: bytesOf(0xca, 0xfe)},
+}
+
+func tupleType(proto byte) gocql.TypeInfo {
+	return gocql.TupleTypeInfo{
+		NativeType: gocql.NewNativeType(proto, gocql.TypeTuple, ""),
+		Elems:      []gocql.TypeInfo{gocql.NewNativeType(proto, gocql.TypeInt, ""), gocql.NewNativeType(proto, gocql.TypeText, "")},
+	}
+}
+
+func udtType(proto byte) gocql.TypeInfo {
+	return gocql.UDTTypeInfo{
+		NativeType: gocql.NewNativeType(proto, gocql.TypeUDT, ""),
+		KeySpace:   "ks",
+		Name:       "pair",
+		Elements: []gocql.UDTField{
+			{Name: "a", Type: gocql.NewNativeType(proto, gocql.TypeInt, "")},
+			{Name: "b", Type: gocql.NewNativeType(proto, gocql.TypeText, "")},
+		},
+	}
+}
+
+func customType(proto byte) gocql.TypeInfo {
+	return gocql.NewNativeType(proto, gocql.TypeCustom, "org.example.CustomType")
+}
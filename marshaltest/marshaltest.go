@@ -0,0 +1,157 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package marshaltest checks implementations of the marshaling of CQL values
+// against golden fixtures of the bytes of every CQL type, for every protocol
+// version the type exists in. It lets codecs registered in a
+// gocql.TypeCodecs, and the types implementing gocql.Marshaler and
+// gocql.Unmarshaler, be tested for conformance with the protocol and
+// benchmarked:
+//
+//	func TestCodecs(t *testing.T) {
+//		marshaltest.Run(t, codecs)
+//	}
+//
+//	func BenchmarkCodecs(b *testing.B) {
+//		marshaltest.Benchmark(b, codecs)
+//	}
+package marshaltest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Codec marshals and unmarshals CQL values, *gocql.TypeCodecs is a Codec.
+type Codec interface {
+	Marshal(info gocql.TypeInfo, value interface{}) ([]byte, error)
+	Unmarshal(info gocql.TypeInfo, data []byte, value interface{}) error
+}
+
+// Default is the marshaling of the driver, gocql.Marshal and gocql.Unmarshal.
+var Default Codec = defaultCodec{}
+
+type defaultCodec struct{}
+
+func (defaultCodec) Marshal(info gocql.TypeInfo, value interface{}) ([]byte, error) {
+	return gocql.Marshal(info, value)
+}
+
+func (defaultCodec) Unmarshal(info gocql.TypeInfo, data []byte, value interface{}) error {
+	return gocql.Unmarshal(info, data, value)
+}
+
+// Run runs a subtest for each case of Cases, checking that codec marshals its
+// value to its bytes and unmarshals its bytes, into a value of the type of
+// its value, to its value.
+func Run(t *testing.T, codec Codec) {
+	for _, c := range Cases() {
+		c := c
+		t.Run(c.String(), func(t *testing.T) {
+			check(t, codec, c.Type, c.Value, c.Data)
+		})
+	}
+}
+
+// RunMarshaler runs a subtest for each case of Cases of the type typ,
+// checking that the value convert returns for its value, of a type
+// implementing gocql.Marshaler and gocql.Unmarshaler through a pointer,
+// marshals to its bytes and is unmarshaled from them. The cases for which
+// convert returns nil are skipped.
+func RunMarshaler(t *testing.T, typ gocql.Type, convert func(value interface{}) interface{}) {
+	RunType(t, Default, typ, convert)
+}
+
+// RunType is like RunMarshaler, marshaling the values convert returns with
+// codec, such as a gocql.TypeCodecs with codecs registered for their type.
+func RunType(t *testing.T, codec Codec, typ gocql.Type, convert func(value interface{}) interface{}) {
+	for _, c := range Cases() {
+		if c.Type.Type() != typ {
+			continue
+		}
+		c := c
+		t.Run(c.String(), func(t *testing.T) {
+			value := convert(c.Value)
+			if value == nil {
+				t.Skip("no value for the case")
+			}
+			check(t, codec, c.Type, value, c.Data)
+		})
+	}
+}
+
+func check(t *testing.T, codec Codec, info gocql.TypeInfo, value interface{}, data []byte) {
+	t.Helper()
+
+	got, err := codec.Marshal(info, value)
+	if err != nil {
+		t.Fatalf("marshal %#v: %v", value, err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("marshal %#v: expected %x, got %x", value, data, got)
+	}
+
+	ptr := reflect.New(reflect.TypeOf(value))
+	if err := codec.Unmarshal(info, data, ptr.Interface()); err != nil {
+		t.Fatalf("unmarshal %x: %v", data, err)
+	}
+	if !equal(ptr.Elem().Interface(), value) {
+		t.Errorf("unmarshal %x: expected %#v, got %#v", data, value, ptr.Elem().Interface())
+	}
+}
+
+// equal reports whether the values a and b are deeply equal, comparing the
+// instants of times rather than their locations.
+func equal(a, b interface{}) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	if da, ok := a.(fmt.Stringer); ok && reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.TypeOf(a).Kind() == reflect.Ptr {
+		// pointers to numbers such as *big.Int and *inf.Dec
+		return da.String() == b.(fmt.Stringer).String()
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Benchmark runs a sub-benchmark marshaling and unmarshaling the value of
+// each case of Cases with codec.
+func Benchmark(b *testing.B, codec Codec) {
+	for _, c := range Cases() {
+		c := c
+		b.Run(c.String(), func(b *testing.B) {
+			ptr := reflect.New(reflect.TypeOf(c.Value)).Interface()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				data, err := codec.Marshal(c.Type, c.Value)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := codec.Unmarshal(c.Type, data, ptr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
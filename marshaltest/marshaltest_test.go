@@ -0,0 +1,75 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package marshaltest
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+func TestDefault(t *testing.T) {
+	Run(t, Default)
+}
+
+func TestTypeCodecs(t *testing.T) {
+	Run(t, gocql.NewTypeCodecs())
+}
+
+// counter is an int marshaled by the Marshaler and Unmarshaler interfaces.
+type counter struct {
+	n int32
+}
+
+func (c counter) MarshalCQL(info gocql.TypeInfo) ([]byte, error) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(c.n))
+	return data, nil
+}
+
+func (c *counter) UnmarshalCQL(info gocql.TypeInfo, data []byte) error {
+	c.n = int32(binary.BigEndian.Uint32(data))
+	return nil
+}
+
+func TestRunMarshaler(t *testing.T) {
+	RunMarshaler(t, gocql.TypeInt, func(value interface{}) interface{} {
+		return counter{n: value.(int32)}
+	})
+}
+
+func TestRunType(t *testing.T) {
+	codecs := gocql.NewTypeCodecs()
+	codecs.RegisterGoType(counter{}, gocql.TypeCodec{
+		Marshal: func(info gocql.TypeInfo, value interface{}) ([]byte, error) {
+			return gocql.Marshal(info, value.(counter).n)
+		},
+		Unmarshal: func(info gocql.TypeInfo, data []byte, value interface{}) error {
+			return gocql.Unmarshal(info, data, &value.(*counter).n)
+		},
+	})
+	RunType(t, codecs, gocql.TypeInt, func(value interface{}) interface{} {
+		return counter{n: value.(int32)}
+	})
+}
+
+func BenchmarkDefault(b *testing.B) {
+	Benchmark(b, Default)
+}
@@ -0,0 +1,401 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package migrate applies ordered schema migrations to a cluster and records
+// the versions applied in a table of the cluster, so that each migration is
+// applied once.
+//
+// Concurrent runs, for example by several instances of a service starting at
+// once, are serialized by a lock held with lightweight transactions, and the
+// driver waits for schema agreement after each statement so that statements
+// can depend on the tables and types created by the previous ones.
+//
+//	migrations, err := migrate.ReadDir("migrations")
+//	if err != nil {
+//		return err
+//	}
+//	m, err := migrate.New(session, migrate.Config{Keyspace: "app"})
+//	if err != nil {
+//		return err
+//	}
+//	err = m.Migrate(ctx, migrations)
+//
+// Migrations are not transactional: if a statement fails, the statements of the
+// migration applied before it are not reverted and the migration is not
+// recorded, so statements should be idempotent, like CREATE TABLE IF NOT EXISTS,
+// for the migration to be applied again once fixed.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// ErrLockLost is returned when the lock expired while migrations were applied,
+// because a migration took longer than Config.LockTTL.
+var ErrLockLost = errors.New("migrate: lock lost")
+
+// Migration is a versioned list of CQL statements.
+type Migration struct {
+	// Version orders the migrations, it must be unique and positive.
+	Version int64
+	// Name describes the migration, it is recorded with its version.
+	Name string
+	// Statements are applied in order.
+	Statements []string
+}
+
+// Parse returns the migration applying the statements of cql, separated by
+// semicolons. Comments are removed.
+func Parse(version int64, name, cql string) (Migration, error) {
+	stmts, err := splitStatements(cql)
+	if err != nil {
+		return Migration{}, fmt.Errorf("migrate: migration %d: %v", version, err)
+	}
+	return Migration{Version: version, Name: name, Statements: stmts}, nil
+}
+
+// ReadDir returns the migrations of the files of dir named <version>_<name>.cql,
+// like 0001_create_users.cql, sorted by version.
+func ReadDir(dir string) ([]Migration, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.cql"))
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, file := range files {
+		base := strings.TrimSuffix(filepath.Base(file), ".cql")
+		i := strings.IndexByte(base, '_')
+		if i < 0 {
+			return nil, fmt.Errorf("migrate: file %q is not named <version>_<name>.cql", file)
+		}
+		version, err := strconv.ParseInt(base[:i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: file %q is not named <version>_<name>.cql", file)
+		}
+		cql, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m, err := Parse(version, base[i+1:], string(cql))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// splitStatements splits cql on the semicolons outside of string literals,
+// quoted identifiers and comments, and removes the comments.
+func splitStatements(cql string) ([]string, error) {
+	var (
+		stmts []string
+		stmt  strings.Builder
+	)
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		stmt.Reset()
+	}
+
+	for i := 0; i < len(cql); i++ {
+		switch {
+		case cql[i] == ';':
+			flush()
+		case strings.HasPrefix(cql[i:], "--"), strings.HasPrefix(cql[i:], "//"):
+			end := strings.IndexByte(cql[i:], '\n')
+			if end < 0 {
+				i = len(cql)
+			} else {
+				i += end
+				stmt.WriteByte('\n')
+			}
+		case strings.HasPrefix(cql[i:], "/*"):
+			end := strings.Index(cql[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 3
+			stmt.WriteByte(' ')
+		case strings.HasPrefix(cql[i:], "$$"):
+			end := strings.Index(cql[i+2:], "$$")
+			if end < 0 {
+				return nil, errors.New("unterminated string literal")
+			}
+			stmt.WriteString(cql[i : i+end+4])
+			i += end + 3
+		case cql[i] == '\'' || cql[i] == '"':
+			// quotes are escaped by doubling them, which reads as two literals
+			end := strings.IndexByte(cql[i+1:], cql[i])
+			if end < 0 {
+				return nil, errors.New("unterminated string literal")
+			}
+			stmt.WriteString(cql[i : i+end+2])
+			i += end + 1
+		default:
+			stmt.WriteByte(cql[i])
+		}
+	}
+	flush()
+	return stmts, nil
+}
+
+// Config configures the tables recording the migrations.
+type Config struct {
+	// Keyspace of the tables recording the migrations, it must exist.
+	Keyspace string
+
+	// Table recording the versions applied, created if missing. The lock is held
+	// in the table of the same name suffixed with _lock.
+	// Default: schema_migrations
+	Table string
+
+	// LockTTL is the time after which the lock expires unless it is renewed, so
+	// that migrations are not blocked forever when a process dies while holding
+	// the lock. The lock is renewed after each migration, LockTTL must exceed the
+	// time taken by any migration.
+	// Default: 5 minutes
+	LockTTL time.Duration
+
+	// LockRetryInterval is the interval between attempts to acquire the lock
+	// while it is held by another process.
+	// Default: 1 second
+	LockRetryInterval time.Duration
+
+	// Logger logs the migrations applied.
+	// Default: no logging
+	Logger gocql.StdLogger
+}
+
+// AppliedMigration is a migration recorded as applied.
+type AppliedMigration struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations with a session.
+type Migrator struct {
+	session *gocql.Session
+	cfg     Config
+	table   string
+	lock    string
+}
+
+// New returns a migrator recording the migrations as configured by cfg.
+func New(session *gocql.Session, cfg Config) (*Migrator, error) {
+	if cfg.Keyspace == "" {
+		return nil, errors.New("migrate: no keyspace provided")
+	}
+	if cfg.Table == "" {
+		cfg.Table = "schema_migrations"
+	}
+	if cfg.LockTTL <= 0 {
+		cfg.LockTTL = 5 * time.Minute
+	}
+	if cfg.LockRetryInterval <= 0 {
+		cfg.LockRetryInterval = time.Second
+	}
+	return &Migrator{
+		session: session,
+		cfg:     cfg,
+		table:   cfg.Keyspace + "." + cfg.Table,
+		lock:    cfg.Keyspace + "." + cfg.Table + "_lock",
+	}, nil
+}
+
+// Migrate applies the migrations which are not recorded as applied, in the
+// order of their versions. It blocks while another process applies migrations
+// to the same tables, until ctx is done.
+func (m *Migrator) Migrate(ctx context.Context, migrations []Migration) error {
+	migrations, err := sortMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	if err := m.createTables(ctx); err != nil {
+		return err
+	}
+
+	owner := gocql.TimeUUID()
+	if err := m.acquireLock(ctx, owner); err != nil {
+		return err
+	}
+	defer m.releaseLock(owner)
+
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(applied))
+	for _, a := range applied {
+		names[a.Version] = a.Name
+	}
+
+	for _, migration := range migrations {
+		if name, ok := names[migration.Version]; ok {
+			if name != migration.Name {
+				return fmt.Errorf("migrate: migration %d applied as %q, not %q", migration.Version, name, migration.Name)
+			}
+			continue
+		}
+		if err := m.apply(ctx, migration); err != nil {
+			return err
+		}
+		if err := m.renewLock(ctx, owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortMigrations returns a copy of migrations sorted by version, checking that
+// versions are positive and unique.
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i, migration := range sorted {
+		if migration.Version <= 0 {
+			return nil, fmt.Errorf("migrate: invalid migration version %d", migration.Version)
+		}
+		if i > 0 && sorted[i-1].Version == migration.Version {
+			return nil, fmt.Errorf("migrate: duplicate migration version %d", migration.Version)
+		}
+	}
+	return sorted, nil
+}
+
+func (m *Migrator) createTables(ctx context.Context) error {
+	for _, stmt := range []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (version bigint PRIMARY KEY, name text, applied_at timestamp)`, m.table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id text PRIMARY KEY, owner timeuuid)`, m.lock),
+	} {
+		if err := m.exec(ctx, stmt); err != nil {
+			return fmt.Errorf("migrate: unable to create table: %v", err)
+		}
+	}
+	return nil
+}
+
+// exec executes the statement and waits for the schema agreement of the
+// cluster, in case it changed the schema.
+func (m *Migrator) exec(ctx context.Context, stmt string) error {
+	if err := m.session.Query(stmt).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	return m.session.AwaitSchemaAgreement(ctx)
+}
+
+func (m *Migrator) acquireLock(ctx context.Context, owner gocql.UUID) error {
+	stmt := fmt.Sprintf(`INSERT INTO %s (id, owner) VALUES ('lock', ?) IF NOT EXISTS USING TTL ?`, m.lock)
+	for {
+		applied, err := m.session.Query(stmt, owner, int(m.cfg.LockTTL/time.Second)).
+			WithContext(ctx).MapScanCAS(map[string]interface{}{})
+		if err != nil {
+			return fmt.Errorf("migrate: unable to acquire lock: %v", err)
+		}
+		if applied {
+			return nil
+		}
+
+		select {
+		case <-time.After(m.cfg.LockRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *Migrator) renewLock(ctx context.Context, owner gocql.UUID) error {
+	applied, err := m.session.Query(fmt.Sprintf(`UPDATE %s USING TTL ? SET owner = ? WHERE id = 'lock' IF owner = ?`, m.lock),
+		int(m.cfg.LockTTL/time.Second), owner, owner).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("migrate: unable to renew lock: %v", err)
+	}
+	if !applied {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// releaseLock releases the lock if it is still held by owner, it is not bound
+// to the context of the migrations so that the lock is released when they are
+// canceled.
+func (m *Migrator) releaseLock(owner gocql.UUID) {
+	_, err := m.session.Query(fmt.Sprintf(`DELETE FROM %s WHERE id = 'lock' IF owner = ?`, m.lock), owner).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil && m.cfg.Logger != nil {
+		m.cfg.Logger.Printf("migrate: unable to release lock, it expires in %v: %v\n", m.cfg.LockTTL, err)
+	}
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	for i, stmt := range migration.Statements {
+		if err := m.exec(ctx, stmt); err != nil {
+			return fmt.Errorf("migrate: migration %d (%s) statement %d: %v", migration.Version, migration.Name, i+1, err)
+		}
+	}
+
+	err := m.session.Query(fmt.Sprintf(`INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)`, m.table),
+		migration.Version, migration.Name, time.Now()).WithContext(ctx).Consistency(gocql.Quorum).Exec()
+	if err != nil {
+		return fmt.Errorf("migrate: unable to record migration %d (%s): %v", migration.Version, migration.Name, err)
+	}
+	if m.cfg.Logger != nil {
+		m.cfg.Logger.Printf("migrate: applied migration %d (%s)\n", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// Applied returns the migrations recorded as applied, sorted by version.
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	iter := m.session.Query(fmt.Sprintf(`SELECT version, name, applied_at FROM %s`, m.table)).
+		WithContext(ctx).Consistency(gocql.Quorum).Iter()
+
+	var (
+		applied []AppliedMigration
+		a       AppliedMigration
+	)
+	for iter.Scan(&a.Version, &a.Name, &a.AppliedAt) {
+		applied = append(applied, a)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("migrate: unable to read applied migrations: %v", err)
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Version < applied[j].Version
+	})
+	return applied, nil
+}
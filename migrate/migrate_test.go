@@ -0,0 +1,99 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse(1, "init", `
+		-- comment; with a semicolon
+		CREATE TABLE t (k int PRIMARY KEY, v text); // trailing comment
+		INSERT INTO t (k, v) VALUES (1, 'a;''b');
+		/* block; comment */ CREATE FUNCTION f(x int) RETURNS NULL ON NULL INPUT
+			RETURNS int LANGUAGE java AS $$ return x; $$;
+		UPDATE "Quoted;Table" SET v = 'c' WHERE k = 1
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"CREATE TABLE t (k int PRIMARY KEY, v text)",
+		"INSERT INTO t (k, v) VALUES (1, 'a;''b')",
+		"CREATE FUNCTION f(x int) RETURNS NULL ON NULL INPUT\n\t\t\tRETURNS int LANGUAGE java AS $$ return x; $$",
+		`UPDATE "Quoted;Table" SET v = 'c' WHERE k = 1`,
+	}
+	if !reflect.DeepEqual(m.Statements, expected) {
+		t.Fatalf("got statements %q, expected %q", m.Statements, expected)
+	}
+
+	for _, cql := range []string{"SELECT 'a", "SELECT 1 /* a", "SELECT $$ a"} {
+		if _, err := Parse(1, "invalid", cql); err == nil {
+			t.Errorf("expected error parsing %q", cql)
+		}
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	migrations, err := ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Migration{
+		{Version: 1, Name: "create_users", Statements: []string{
+			"CREATE TABLE IF NOT EXISTS users (\n    id uuid PRIMARY KEY,\n    name text\n)",
+		}},
+		{Version: 2, Name: "add_email", Statements: []string{
+			"ALTER TABLE users ADD email text",
+			"CREATE INDEX IF NOT EXISTS ON users (email)",
+		}},
+	}
+	if !reflect.DeepEqual(migrations, expected) {
+		t.Fatalf("got migrations %q, expected %q", migrations, expected)
+	}
+}
+
+func TestSortMigrations(t *testing.T) {
+	sorted, err := sortMigrations([]Migration{{Version: 3}, {Version: 1}, {Version: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range sorted {
+		if m.Version != int64(i+1) {
+			t.Fatalf("migration %d has version %d", i, m.Version)
+		}
+	}
+
+	for _, test := range []struct {
+		migrations []Migration
+		err        string
+	}{
+		{[]Migration{{Version: 1}, {Version: 1}}, "duplicate migration version 1"},
+		{[]Migration{{Version: 0}}, "invalid migration version 0"},
+	} {
+		if _, err := sortMigrations(test.migrations); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("got error %v, expected %q", err, test.err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"reflect"
+	"sync"
+	"unicode"
+)
+
+// NameMapper maps the names of struct fields without cql tag to the names of
+// the fields of the user-defined types they are marshaled to and unmarshaled
+// from.
+type NameMapper interface {
+	MapName(field string) string
+}
+
+// NameMapperFunc is a function implementing NameMapper.
+type NameMapperFunc func(field string) string
+
+func (f NameMapperFunc) MapName(field string) string {
+	return f(field)
+}
+
+// SnakeCaseNameMapper maps the names of struct fields to snake case, the
+// convention of CQL names, for example StreetName to street_name and UserID to
+// user_id.
+var SnakeCaseNameMapper NameMapper = NameMapperFunc(snakeCase)
+
+var (
+	// nameMappingMu protects nameMapper and fieldNameOverrides, which are read
+	// when the fields of struct types are cached.
+	nameMappingMu      sync.RWMutex
+	nameMapper         = SnakeCaseNameMapper
+	fieldNameOverrides = make(map[reflect.Type]map[string]string)
+)
+
+// SetNameMapper sets the NameMapper of the struct fields without cql tag,
+// SnakeCaseNameMapper by default. Struct fields are still matched by their name
+// when the mapped name does not match, a nil mapper matches them by their name
+// only.
+//
+// The mapper applies to all sessions, it should be set before structs are
+// marshaled, for example in an init function.
+func SetNameMapper(mapper NameMapper) {
+	nameMappingMu.Lock()
+	defer nameMappingMu.Unlock()
+	nameMapper = mapper
+	clearUDTFieldsCache()
+}
+
+// SetFieldNames overrides the names of the fields of the struct type of value,
+// for structs whose fields can not be tagged such as the structs of other
+// packages. names maps struct field names to the names of the fields of
+// user-defined types, a name of "-" ignores the field. Overrides take
+// precedence over cql tags, and replace the ones previously set for the type.
+func SetFieldNames(value interface{}, names map[string]string) {
+	t := reflect.TypeOf(value)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		panic("gocql: SetFieldNames called with non struct value")
+	}
+
+	overrides := make(map[string]string, len(names))
+	for field, name := range names {
+		overrides[field] = name
+	}
+
+	nameMappingMu.Lock()
+	defer nameMappingMu.Unlock()
+	fieldNameOverrides[t] = overrides
+	// the structs embedding t are cached with its fields too
+	clearUDTFieldsCache()
+}
+
+func clearUDTFieldsCache() {
+	udtFieldsCache.Range(func(key, _ interface{}) bool {
+		udtFieldsCache.Delete(key)
+		return true
+	})
+}
+
+// snakeCase converts name from camel case to snake case, keeping acronyms
+// together, so HTTPServer becomes http_server.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' &&
+				(unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+					(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				out = append(out, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
@@ -0,0 +1,112 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/*
+ * Content before git sha 34fdeebefcbf183ed7f916f931aa0586fdaa1b40
+ * Copyright (c) 2016, The Gocql authors,
+ * provided under the BSD-3-Clause License.
+ * See the NOTICE file distributed with this work for additional information.
+ */
+
+package gocql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":         "name",
+		"StreetName":   "street_name",
+		"ID":           "id",
+		"UserID":       "user_id",
+		"HTTPServer":   "http_server",
+		"Address2":     "address2",
+		"Zip2Code":     "zip2_code",
+		"already_done": "already_done",
+		"Snake_Case":   "snake_case",
+	}
+	for name, want := range tests {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q): expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+type nameMapperAddress struct {
+	StreetName string
+	ZipCode    int
+	City       string `cql:"town"`
+}
+
+type nameMapperOverridden struct {
+	StreetName string `cql:"street"`
+	ZipCode    int
+}
+
+func TestNameMapper(t *testing.T) {
+	udt := UDTTypeInfo{
+		NativeType: NativeType{proto: protoVersion4, typ: TypeUDT},
+		Name:       "address",
+		Elements: []UDTField{
+			{Name: "street_name", Type: NativeType{proto: protoVersion4, typ: TypeText}},
+			{Name: "zip", Type: NativeType{proto: protoVersion4, typ: TypeInt}},
+			{Name: "town", Type: NativeType{proto: protoVersion4, typ: TypeText}},
+		},
+	}
+	roundTrip := func(value, out interface{}) {
+		t.Helper()
+		data, err := Marshal(udt, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Unmarshal(udt, data, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got nameMapperAddress
+	roundTrip(nameMapperAddress{StreetName: "Main", ZipCode: 1000, City: "Lisbon"}, &got)
+	if want := (nameMapperAddress{StreetName: "Main", City: "Lisbon"}); got != want {
+		t.Fatalf("snake case: expected %+v, got %+v", want, got)
+	}
+
+	SetNameMapper(NameMapperFunc(func(field string) string {
+		return strings.TrimSuffix(strings.ToLower(field), "code")
+	}))
+	defer SetNameMapper(SnakeCaseNameMapper)
+	got = nameMapperAddress{}
+	roundTrip(nameMapperAddress{StreetName: "Main", ZipCode: 1000, City: "Lisbon"}, &got)
+	if want := (nameMapperAddress{ZipCode: 1000, City: "Lisbon"}); got != want {
+		t.Fatalf("custom mapper: expected %+v, got %+v", want, got)
+	}
+
+	SetFieldNames(&nameMapperOverridden{}, map[string]string{"StreetName": "street_name", "ZipCode": "-"})
+	defer func() {
+		nameMappingMu.Lock()
+		delete(fieldNameOverrides, reflect.TypeOf(nameMapperOverridden{}))
+		nameMappingMu.Unlock()
+		clearUDTFieldsCache()
+	}()
+	var overridden nameMapperOverridden
+	roundTrip(map[string]interface{}{"street_name": "Main", "zip": 1000}, &overridden)
+	if want := (nameMapperOverridden{StreetName: "Main"}); overridden != want {
+		t.Fatalf("overrides: expected %+v, got %+v", want, overridden)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/gocql/gocql/internal/lru"
+)
+
+// PageCursorStore stores the paging states reaching the pages of queries, see
+// OffsetPager. It must be safe for concurrent use.
+type PageCursorStore interface {
+	// GetPageCursor returns the paging state of page n of the query with the
+	// fingerprint key.
+	GetPageCursor(key string, n int) (state []byte, ok bool)
+	// PutPageCursor stores the paging state of page n of the query with the
+	// fingerprint key.
+	PutPageCursor(key string, n int, state []byte)
+}
+
+// pageCursorCache is an in-memory PageCursorStore keeping the cursors of the
+// queries used most recently.
+type pageCursorCache struct {
+	mu  sync.Mutex
+	lru *lru.Cache // map[key]map[int][]byte
+}
+
+// NewPageCursorCache returns an in-memory PageCursorStore keeping the paging
+// states of the size queries used most recently.
+func NewPageCursorCache(size int) PageCursorStore {
+	return &pageCursorCache{lru: lru.New(size)}
+}
+
+func (c *pageCursorCache) GetPageCursor(key string, n int) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursors, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	state, ok := cursors.(map[int][]byte)[n]
+	return state, ok
+}
+
+func (c *pageCursorCache) PutPageCursor(key string, n int, state []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursors, ok := c.lru.Get(key)
+	if !ok {
+		cursors = make(map[int][]byte)
+		c.lru.Add(key, cursors)
+	}
+	cursors.(map[int][]byte)[n] = state
+}
+
+// OffsetPager emulates offset pagination, such as the numbered pages of user
+// interfaces, over the paging of queries. CQL has no OFFSET: reaching page n
+// requires reading the n pages before it. The pager stores the paging state
+// reaching each page it reads, so that the next requests for the page, or for
+// the pages after it, start from the closest cursor instead of from the first
+// page.
+//
+// Pages are located by the paging states found when they were first reached,
+// rows inserted or deleted before a page later shift the rows of the following
+// pages, like they would with OFFSET.
+type OffsetPager struct {
+	store PageCursorStore
+}
+
+// NewOffsetPager returns a pager storing the paging states in store, or in a
+// cache of the 1000 queries used most recently if store is nil.
+func NewOffsetPager(store PageCursorStore) *OffsetPager {
+	if store == nil {
+		store = NewPageCursorCache(1000)
+	}
+	return &OffsetPager{store: store}
+}
+
+// Page returns the iterator of page n, counted from 0, of qry, which must have
+// a page size. The iterator reads the rows of the page only, it has no rows if
+// qry has fewer pages, and its PageState is the paging state of the next page.
+// The pages are read with copies of qry, which is left unchanged.
+//
+// The cursors of qry are stored by the fingerprint of its keyspace, statement,
+// page size and values, which are formatted with the fmt package, so values
+// which are pointers are not matched by the values they point to.
+func (p *OffsetPager) Page(qry *Query, n int) *Iter {
+	if qry.pageSize <= 0 {
+		return &Iter{err: fmt.Errorf("gocql: offset paging requires a page size")}
+	}
+	if n < 0 {
+		return &Iter{err: fmt.Errorf("gocql: invalid page %d", n)}
+	}
+	key := pageCursorKey(qry)
+
+	// start from the closest page whose cursor is known
+	start, state := 0, []byte(nil)
+	for k := n; k > 0; k-- {
+		if s, ok := p.store.GetPageCursor(key, k); ok {
+			start, state = k, s
+			break
+		}
+	}
+
+	for page := start; page < n; page++ {
+		iter := pageQuery(qry, state).Iter()
+		next := iter.PageState()
+		if err := iter.Close(); err != nil {
+			return &Iter{err: err}
+		}
+		if len(next) == 0 {
+			// qry has fewer than n pages
+			return &Iter{}
+		}
+		state = next
+		p.store.PutPageCursor(key, page+1, state)
+	}
+
+	iter := pageQuery(qry, state).Iter()
+	if next := iter.PageState(); len(next) > 0 {
+		p.store.PutPageCursor(key, n+1, next)
+	}
+	return iter
+}
+
+// pageQuery returns a copy of qry reading the page reached by state only.
+func pageQuery(qry *Query, state []byte) *Query {
+	pageQry := new(Query)
+	*pageQry = *qry
+	pageQry.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
+	pageQry.failedHosts = nil
+	pageQry.refCount = 1
+	return pageQry.PageState(state)
+}
+
+// pageCursorKey returns the fingerprint of the pages of qry.
+func pageCursorKey(qry *Query) string {
+	return scanFingerprint(qry.Keyspace() + "\x00" + qry.stmt + "\x00" +
+		strconv.Itoa(qry.pageSize) + "\x00" + fmt.Sprintf("%#v", qry.values))
+}
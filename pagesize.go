@@ -0,0 +1,146 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package gocql
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql/internal/lru"
+)
+
+// AdaptivePageSizeConfig configures the adaptation of the page size of each
+// statement to the size of its rows and the latency of its pages, see
+// ClusterConfig.AdaptivePageSize.
+type AdaptivePageSizeConfig struct {
+	// TargetBytes is the size of the pages aimed for.
+	// Default: 1 MiB
+	TargetBytes int
+
+	// TargetLatency, if greater than 0, is the time to fetch a page aimed for.
+	// Pages are made smaller than TargetBytes when they take longer to fetch.
+	// Default: 0 (only the size of the rows is considered)
+	TargetLatency time.Duration
+
+	// MinPageSize and MaxPageSize bound the page sizes.
+	// Default: 100 and 10000
+	MinPageSize int
+	MaxPageSize int
+
+	// MaxStatements is the number of statements whose page size is adapted,
+	// the least recently executed ones are forgotten and start again from the
+	// page size of the session.
+	// Default: 1000
+	MaxStatements int
+}
+
+// pageSizeEWMAWeight is the weight of the last page in the average row size
+// and row latency of a statement.
+const pageSizeEWMAWeight = 0.2
+
+// pageSizeController adapts the page size of the statements to the pages they
+// returned.
+type pageSizeController struct {
+	cfg AdaptivePageSizeConfig
+
+	mu    sync.Mutex
+	stmts *lru.Cache
+}
+
+type pageSizeStats struct {
+	pageSize int
+	// rowBytes and rowLatency are averages of the size of the rows and the
+	// latency of the pages per row, 0 until known.
+	rowBytes   float64
+	rowLatency float64
+}
+
+func newPageSizeController(cfg AdaptivePageSizeConfig) *pageSizeController {
+	if cfg.TargetBytes <= 0 {
+		cfg.TargetBytes = 1 << 20
+	}
+	if cfg.MinPageSize <= 0 {
+		cfg.MinPageSize = 100
+	}
+	if cfg.MaxPageSize <= 0 {
+		cfg.MaxPageSize = 10000
+	}
+	if cfg.MaxStatements <= 0 {
+		cfg.MaxStatements = 1000
+	}
+	return &pageSizeController{cfg: cfg, stmts: lru.New(cfg.MaxStatements)}
+}
+
+// pageSize returns the page size of stmt, defaultSize if it was not adapted.
+func (c *pageSizeController) pageSize(stmt string, defaultSize int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.stmts.Get(stmt); ok {
+		return v.(*pageSizeStats).pageSize
+	}
+	return defaultSize
+}
+
+// observe adapts the page size of stmt to a page of rows taking bytes in the
+// response. latency is the time taken to fetch the page, it is only known
+// when the page is full, 0 otherwise, as the latency of pages with fewer rows
+// than requested does not tell the latency of full pages.
+func (c *pageSizeController) observe(stmt string, rows, bytes int, latency time.Duration) {
+	if rows <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var s *pageSizeStats
+	if v, ok := c.stmts.Get(stmt); ok {
+		s = v.(*pageSizeStats)
+	} else {
+		s = &pageSizeStats{}
+		c.stmts.Add(stmt, s)
+	}
+
+	s.rowBytes = ewma(s.rowBytes, float64(bytes)/float64(rows))
+	size := float64(c.cfg.TargetBytes) / s.rowBytes
+	if c.cfg.TargetLatency > 0 {
+		if latency > 0 {
+			s.rowLatency = ewma(s.rowLatency, float64(latency)/float64(rows))
+		}
+		if s.rowLatency > 0 {
+			if bySpeed := float64(c.cfg.TargetLatency) / s.rowLatency; bySpeed < size {
+				size = bySpeed
+			}
+		}
+	}
+
+	switch {
+	case size < float64(c.cfg.MinPageSize):
+		s.pageSize = c.cfg.MinPageSize
+	case size > float64(c.cfg.MaxPageSize):
+		s.pageSize = c.cfg.MaxPageSize
+	default:
+		s.pageSize = int(size)
+	}
+}
+
+func ewma(avg, v float64) float64 {
+	if avg == 0 {
+		return v
+	}
+	return avg + pageSizeEWMAWeight*(v-avg)
+}
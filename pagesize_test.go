@@ -0,0 +1,66 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package gocql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPageSizeController(t *testing.T) {
+	c := newPageSizeController(AdaptivePageSizeConfig{
+		TargetBytes:   100000,
+		TargetLatency: 50 * time.Millisecond,
+		MinPageSize:   10,
+		MaxPageSize:   5000,
+	})
+
+	const narrow, wide, slow = "SELECT narrow", "SELECT wide", "SELECT slow"
+	if size := c.pageSize(narrow, 1000); size != 1000 {
+		t.Fatalf("got page size %d before any page, expected the default 1000", size)
+	}
+
+	// 10 bytes rows would make pages of 10000 rows, bounded by MaxPageSize
+	c.observe(narrow, 1000, 10000, 0)
+	if size := c.pageSize(narrow, 1000); size != 5000 {
+		t.Errorf("got page size %d for narrow rows, expected 5000", size)
+	}
+
+	// 1000 bytes rows make pages of 100 rows, then the average row size moves
+	// towards 500 bytes
+	c.observe(wide, 1000, 1000000, 0)
+	if size := c.pageSize(wide, 1000); size != 100 {
+		t.Errorf("got page size %d for wide rows, expected 100", size)
+	}
+	c.observe(wide, 100, 50000, 0)
+	if size := c.pageSize(wide, 1000); size != 111 {
+		t.Errorf("got page size %d after smaller rows, expected 111", size)
+	}
+
+	// 1ms per row makes pages of 50 rows to fetch them in 50ms
+	c.observe(slow, 1000, 10000, time.Second)
+	if size := c.pageSize(slow, 1000); size != 50 {
+		t.Errorf("got page size %d for slow rows, expected 50", size)
+	}
+
+	// pages without rows are ignored
+	c.observe(slow, 0, 10, time.Second)
+	if size := c.pageSize(slow, 1000); size != 50 {
+		t.Errorf("got page size %d after empty page, expected 50", size)
+	}
+}
@@ -30,9 +30,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"math/rand"
-	"net"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -84,7 +84,7 @@ func (c *cowHostList) add(host *HostInfo) bool {
 	return true
 }
 
-func (c *cowHostList) remove(ip net.IP) bool {
+func (c *cowHostList) remove(host *HostInfo) bool {
 	c.mu.Lock()
 	l := c.get()
 	size := len(l)
@@ -96,7 +96,7 @@ func (c *cowHostList) remove(ip net.IP) bool {
 	found := false
 	newL := make([]*HostInfo, 0, size)
 	for i := 0; i < len(l); i++ {
-		if !l[i].ConnectAddress().Equal(ip) {
+		if !l[i].Equal(host) {
 			newL = append(newL, l[i])
 		} else {
 			found = true
@@ -208,6 +208,31 @@ func (e *ExponentialBackoffRetryPolicy) GetRetryType(err error) RetryType {
 	return RetryNextHost
 }
 
+// IdempotentRetryPolicy returns a retry policy retrying with policy only the
+// queries and batches marked as idempotent, as the other ones may be applied
+// more than once when retried after a timeout. See also
+// ClusterConfig.DefaultIdempotence.
+func IdempotentRetryPolicy(policy RetryPolicy) RetryPolicy {
+	return &idempotentRetryPolicy{RetryPolicy: policy}
+}
+
+type idempotentRetryPolicy struct {
+	RetryPolicy
+}
+
+func (p *idempotentRetryPolicy) Attempt(q RetryableQuery) bool {
+	if iq, ok := q.(interface{ IsIdempotent() bool }); ok && !iq.IsIdempotent() {
+		return false
+	}
+	return p.RetryPolicy.Attempt(q)
+}
+
+func (p *idempotentRetryPolicy) downgrade(q RetryableQuery, err error) {
+	if d, ok := p.RetryPolicy.(consistencyDowngrader); ok {
+		d.downgrade(q, err)
+	}
+}
+
 // DowngradingConsistencyRetryPolicy: Next retry will be with the next consistency level
 // provided in the slice
 //
@@ -222,18 +247,43 @@ func (e *ExponentialBackoffRetryPolicy) GetRetryType(err error) RetryType {
 //
 // On an unavailable exception: if at least one replica is alive, the
 // operation is retried with the next provided consistency level.
-
+//
+// If ConsistencyLevelsToTry is empty, the operation is instead retried once with
+// the highest consistency level which is likely to succeed given the number of
+// replicas reported by the error: THREE, TWO or ONE for respectively three or
+// more, two or one alive or responding replicas. The LOCAL_QUORUM and LOCAL_ONE
+// levels are downgraded to LOCAL_ONE instead, so that the operation is still
+// only acknowledged by the replicas of the local datacenter. A read timeout
+// where enough replicas responded is retried with the same consistency level.
+// If no replica is alive or responded the error is returned.
+//
+// The errors of the SERIAL and LOCAL_SERIAL phase of lightweight transactions
+// are returned, as lowering the consistency does not help them succeed.
+//
+// When built with the gocql_upstream_defaults tag, the operation is not retried
+// if ConsistencyLevelsToTry is empty.
 type DowngradingConsistencyRetryPolicy struct {
 	ConsistencyLevelsToTry []Consistency
+
+	// OnDowngrade, if not nil, is called whenever the policy lowers the
+	// consistency of a query before retrying it, for example to log or count
+	// downgrades. err is the error of the failed attempt, it is nil when the
+	// consistency is taken from ConsistencyLevelsToTry.
+	OnDowngrade func(q RetryableQuery, from, to Consistency, err error)
 }
 
 func (d *DowngradingConsistencyRetryPolicy) Attempt(q RetryableQuery) bool {
 	currentAttempt := q.Attempts()
 
+	if len(d.ConsistencyLevelsToTry) == 0 && !upstreamDefaults {
+		// the consistency is downgraded based on the error, see downgrade
+		return currentAttempt <= 1
+	}
+
 	if currentAttempt > len(d.ConsistencyLevelsToTry) {
 		return false
 	} else if currentAttempt > 0 {
-		q.SetConsistency(d.ConsistencyLevelsToTry[currentAttempt-1])
+		d.setConsistency(q, d.ConsistencyLevelsToTry[currentAttempt-1], nil)
 	}
 	return true
 }
@@ -241,7 +291,7 @@ func (d *DowngradingConsistencyRetryPolicy) Attempt(q RetryableQuery) bool {
 func (d *DowngradingConsistencyRetryPolicy) GetRetryType(err error) RetryType {
 	switch t := err.(type) {
 	case *RequestErrUnavailable:
-		if t.Alive > 0 {
+		if t.Alive > 0 && !isSerialConsistency(t.Consistency) {
 			return Retry
 		}
 		return Rethrow
@@ -253,16 +303,103 @@ func (d *DowngradingConsistencyRetryPolicy) GetRetryType(err error) RetryType {
 			return Rethrow
 		}
 		if t.WriteType == "UNLOGGED_BATCH" {
+			if len(d.ConsistencyLevelsToTry) == 0 && t.Received == 0 {
+				return Rethrow
+			}
 			return Retry
 		}
 		return Rethrow
 	case *RequestErrReadTimeout:
+		if len(d.ConsistencyLevelsToTry) == 0 {
+			if _, ok := achievableConsistency(err); !ok {
+				return Rethrow
+			}
+		}
 		return Retry
 	default:
 		return RetryNextHost
 	}
 }
 
+// downgrade lowers the consistency of q to the highest consistency achievable
+// according to err before q is retried.
+func (d *DowngradingConsistencyRetryPolicy) downgrade(q RetryableQuery, err error) {
+	if len(d.ConsistencyLevelsToTry) > 0 || upstreamDefaults {
+		return
+	}
+	if cons, ok := achievableConsistency(err); ok {
+		d.setConsistency(q, cons, err)
+	}
+}
+
+func (d *DowngradingConsistencyRetryPolicy) setConsistency(q RetryableQuery, cons Consistency, err error) {
+	from := q.GetConsistency()
+	if from == cons {
+		return
+	}
+	q.SetConsistency(cons)
+	if d.OnDowngrade != nil {
+		d.OnDowngrade(q, from, cons, err)
+	}
+}
+
+// consistencyDowngrader is implemented by retry policies which adjust the
+// consistency of a query based on the error of the failed attempt. downgrade is
+// called before a query is retried.
+type consistencyDowngrader interface {
+	downgrade(q RetryableQuery, err error)
+}
+
+// achievableConsistency returns the highest consistency level which is likely
+// to succeed given the number of replicas reported by err, keeping the local
+// consistency levels local. The serial consistency levels are not downgraded.
+func achievableConsistency(err error) (Consistency, bool) {
+	var (
+		cons     Consistency
+		replicas int
+	)
+	switch t := err.(type) {
+	case *RequestErrUnavailable:
+		cons, replicas = t.Consistency, t.Alive
+	case *RequestErrWriteTimeout:
+		cons, replicas = t.Consistency, t.Received
+	case *RequestErrReadTimeout:
+		cons, replicas = t.Consistency, t.Received
+		if t.Received >= t.BlockFor && !isSerialConsistency(cons) {
+			// enough replicas responded but the data was not retrieved
+			return t.Consistency, true
+		}
+	default:
+		return 0, false
+	}
+
+	switch {
+	case isSerialConsistency(cons):
+		return 0, false
+	case cons == LocalQuorum || cons == LocalOne:
+		if replicas > 0 {
+			return LocalOne, true
+		}
+		return 0, false
+	}
+
+	switch {
+	case replicas >= 3:
+		return Three, true
+	case replicas == 2:
+		return Two, true
+	case replicas == 1:
+		return One, true
+	}
+	return 0, false
+}
+
+// isSerialConsistency reports whether cons is the SERIAL or LOCAL_SERIAL
+// consistency of the Paxos phase of lightweight transactions.
+func isSerialConsistency(cons Consistency) bool {
+	return cons == Consistency(Serial) || cons == Consistency(LocalSerial)
+}
+
 func (e *ExponentialBackoffRetryPolicy) napTime(attempts int) time.Duration {
 	return getExponentialTime(e.Min, e.Max, attempts)
 }
@@ -293,6 +430,159 @@ type HostTierer interface {
 	MaxHostTier() uint
 }
 
+// hostPlanner is implemented by host selection policies which can tell the
+// hosts Pick would return for a query without side effects, such as advancing
+// round robin counters or using up the probe of a circuit breaker. Policies
+// wrapping another policy forward it, see Query.Explain.
+type hostPlanner interface {
+	plan(qry ExecutableQuery) hostPlan
+}
+
+// hostPlan is the query plan of a host selection policy.
+type hostPlan struct {
+	// hosts are the hosts Pick would return, in order.
+	hosts []*HostInfo
+	// deferred are the hosts of hosts which are only tried after the others.
+	deferred []*HostInfo
+	// skipped are the hosts known to the policy which Pick would not return,
+	// because they are down or their circuit is open.
+	skipped []*HostInfo
+	// partitioner is set if the first hosts are the replicas of the token of
+	// the routing key of the query.
+	partitioner partitioner
+}
+
+// planHosts returns the query plan of policy for qry. Policies which do not
+// implement hostPlanner are asked to Pick the hosts.
+func planHosts(policy HostSelectionPolicy, qry ExecutableQuery) hostPlan {
+	if planner, ok := policy.(hostPlanner); ok {
+		return planner.plan(qry)
+	}
+
+	// stop on the first repeated host as some policies never end iterating
+	var plan hostPlan
+	seen := make(map[*HostInfo]bool)
+	next := policy.Pick(qry)
+	for selected := next(); selected != nil; selected = next() {
+		host := selected.Info()
+		if host == nil || seen[host] {
+			break
+		}
+		seen[host] = true
+		plan.hosts = append(plan.hosts, host)
+	}
+	return plan
+}
+
+// deferHosts returns a NextHost which yields the hosts of hostIter for which
+// deferred returns false, and then the ones for which it returns true, in the
+// order hostIter returned them.
+func deferHosts(hostIter NextHost, deferred func(*HostInfo) bool) NextHost {
+	var later []SelectedHost
+	return func() SelectedHost {
+		if hostIter != nil {
+			for host := hostIter(); host != nil; host = hostIter() {
+				if host.Info() != nil && deferred(host.Info()) {
+					later = append(later, host)
+					continue
+				}
+				return host
+			}
+			hostIter = nil
+		}
+
+		if len(later) == 0 {
+			return nil
+		}
+		host := later[0]
+		later = later[1:]
+		return host
+	}
+}
+
+// deferHosts returns plan with the hosts for which deferred returns true
+// moved to the end of its hosts, as deferHosts does for the hosts picked.
+func (plan hostPlan) deferHosts(deferred func(*HostInfo) bool) hostPlan {
+	hosts := make([]*HostInfo, 0, len(plan.hosts))
+	var last []*HostInfo
+	for _, host := range plan.hosts {
+		if deferred(host) {
+			last = append(last, host)
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	plan.hosts = append(hosts, last...)
+	plan.deferred = append(plan.deferred, last...)
+	return plan
+}
+
+// skipHosts returns plan with the hosts for which skip returns true moved to
+// its skipped hosts, as wrapping policies do in Pick.
+func (plan hostPlan) skipHosts(skip func(*HostInfo) bool) hostPlan {
+	var hosts, deferred []*HostInfo
+	skipped := append([]*HostInfo(nil), plan.skipped...)
+	for _, host := range plan.hosts {
+		if skip(host) {
+			skipped = append(skipped, host)
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	for _, host := range plan.deferred {
+		if !skip(host) {
+			deferred = append(deferred, host)
+		}
+	}
+	plan.hosts, plan.deferred, plan.skipped = hosts, deferred, skipped
+	return plan
+}
+
+// hostOrder is an iteration function over the hosts a policy tries for a
+// query, in order, whether they are up or not. It returns nil after the last
+// host. Policies derive both Pick and plan from it so that Query.Explain
+// reports the hosts Pick returns.
+type hostOrder func() *HostInfo
+
+// orderHosts returns a hostOrder over hosts.
+func orderHosts(hosts []*HostInfo) hostOrder {
+	return func() *HostInfo {
+		if len(hosts) == 0 {
+			return nil
+		}
+		h := hosts[0]
+		hosts = hosts[1:]
+		return h
+	}
+}
+
+// pick returns a NextHost over the hosts of order which are up when they are
+// reached.
+func (order hostOrder) pick() NextHost {
+	return func() SelectedHost {
+		for h := order(); h != nil; h = order() {
+			if h.IsUp() {
+				return (*selectedHost)(h)
+			}
+		}
+		return nil
+	}
+}
+
+// plan returns the query plan of the hosts of order, skipping the ones which
+// are down.
+func (order hostOrder) plan() hostPlan {
+	var plan hostPlan
+	for h := order(); h != nil; h = order() {
+		if h.IsUp() {
+			plan.hosts = append(plan.hosts, h)
+		} else {
+			plan.skipped = append(plan.skipped, h)
+		}
+	}
+	return plan
+}
+
 // HostSelectionPolicy is an interface for selecting
 // the most appropriate host to execute a given query.
 // HostSelectionPolicy instances cannot be shared between sessions.
@@ -344,8 +634,11 @@ func (r *roundRobinHostPolicy) SetPartitioner(partitioner string)   {}
 func (r *roundRobinHostPolicy) Init(*Session)                       {}
 
 func (r *roundRobinHostPolicy) Pick(qry ExecutableQuery) NextHost {
-	nextStartOffset := atomic.AddUint64(&r.lastUsedHostIdx, 1)
-	return roundRobbin(int(nextStartOffset), r.hosts.get())
+	return roundRobbin(startOffset(qry, &r.lastUsedHostIdx), r.hosts.get())
+}
+
+func (r *roundRobinHostPolicy) plan(qry ExecutableQuery) hostPlan {
+	return planRoundRobbin(nextOffset(qry, &r.lastUsedHostIdx), r.hosts.get())
 }
 
 func (r *roundRobinHostPolicy) AddHost(host *HostInfo) {
@@ -353,7 +646,7 @@ func (r *roundRobinHostPolicy) AddHost(host *HostInfo) {
 }
 
 func (r *roundRobinHostPolicy) RemoveHost(host *HostInfo) {
-	r.hosts.remove(host.ConnectAddress())
+	r.hosts.remove(host)
 }
 
 func (r *roundRobinHostPolicy) HostUp(host *HostInfo) {
@@ -519,7 +812,7 @@ func (t *tokenAwareHostPolicy) AddHosts(hosts []*HostInfo) {
 
 func (t *tokenAwareHostPolicy) RemoveHost(host *HostInfo) {
 	t.mu.Lock()
-	if t.hosts.remove(host.ConnectAddress()) {
+	if t.hosts.remove(host) {
 		meta := t.getMetadataForUpdate()
 		meta.resetTokenRing(t.partitioner, t.hosts.get(), t.logger)
 		t.updateReplicas(meta, t.getKeyspaceName())
@@ -578,21 +871,24 @@ func (m *clusterMeta) resetTokenRing(partitioner string, hosts []*HostInfo, logg
 	m.tokenRing = tokenRing
 }
 
-func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
+// replicas returns the replicas of the token of the routing key of qry, in
+// the order they are tried, and the partitioner of the token. It returns a nil
+// partitioner if the query can not be routed token aware.
+func (t *tokenAwareHostPolicy) replicas(qry ExecutableQuery) ([]*HostInfo, partitioner) {
 	if qry == nil {
-		return t.fallback.Pick(qry)
+		return nil, nil
 	}
 
 	routingKey, err := qry.GetRoutingKey()
 	if err != nil {
-		return t.fallback.Pick(qry)
+		return nil, nil
 	} else if routingKey == nil {
-		return t.fallback.Pick(qry)
+		return nil, nil
 	}
 
 	meta := t.getMetadataReadOnly()
 	if meta == nil || meta.tokenRing == nil {
-		return t.fallback.Pick(qry)
+		return nil, nil
 	}
 
 	token := meta.tokenRing.partitioner.Hash(routingKey)
@@ -604,73 +900,110 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 		replicas = []*HostInfo{host}
 	} else {
 		replicas = ht.hosts
-		if t.shuffleReplicas {
+		if offset, ok := affinityOffset(qry); ok {
+			replicas = rotateHosts(replicas, offset)
+		} else if t.shuffleReplicas {
 			replicas = shuffleHosts(replicas)
 		}
 	}
+	return replicas, meta.tokenRing.partitioner
+}
 
-	var (
-		fallbackIter NextHost
-		i, j, k      int
-		remote       [][]*HostInfo
-		tierer       HostTierer
-		tiererOk     bool
-		maxTier      uint
-	)
-
-	if tierer, tiererOk = t.fallback.(HostTierer); tiererOk {
-		maxTier = tierer.MaxHostTier()
-	} else {
-		maxTier = 1
+// tierer returns the tier of hosts and the maximum tier of the fallback policy.
+func (t *tokenAwareHostPolicy) tierer() (func(*HostInfo) uint, uint) {
+	if tierer, ok := t.fallback.(HostTierer); ok {
+		return tierer.HostTier, tierer.MaxHostTier()
 	}
+	return func(h *HostInfo) uint {
+		if t.fallback.IsLocal(h) {
+			return 0
+		}
+		return 1
+	}, 1
+}
 
+// orderReplicas returns the order the replicas are tried in: the local
+// replicas first, followed by the replicas of the other tiers of the fallback
+// policy, tier by tier, if nonLocalReplicasFallback is set.
+func (t *tokenAwareHostPolicy) orderReplicas(replicas []*HostInfo) hostOrder {
+	hostTier, maxTier := t.tierer()
+
+	ordered := make([]*HostInfo, 0, len(replicas))
+	for _, h := range replicas {
+		if hostTier(h) == 0 {
+			ordered = append(ordered, h)
+		}
+	}
 	if t.nonLocalReplicasFallback {
-		remote = make([][]*HostInfo, maxTier)
+		for tier := uint(1); tier <= maxTier; tier++ {
+			for _, h := range replicas {
+				if hostTier(h) == tier {
+					ordered = append(ordered, h)
+				}
+			}
+		}
 	}
+	return orderHosts(ordered)
+}
 
-	used := make(map[*HostInfo]bool, len(replicas))
-	return func() SelectedHost {
-		for i < len(replicas) {
-			h := replicas[i]
-			i++
-
-			var tier uint
-			if tiererOk {
-				tier = tierer.HostTier(h)
-			} else if t.fallback.IsLocal(h) {
-				tier = 0
-			} else {
-				tier = 1
-			}
+func (t *tokenAwareHostPolicy) plan(qry ExecutableQuery) hostPlan {
+	replicas, p := t.replicas(qry)
+	if p == nil {
+		return planHosts(t.fallback, qry)
+	}
 
-			if tier != 0 {
-				if t.nonLocalReplicasFallback {
-					remote[tier-1] = append(remote[tier-1], h)
-				}
-				continue
-			}
+	plan := hostPlan{partitioner: p, hosts: t.orderReplicas(replicas).plan().hosts}
+	used := make(map[*HostInfo]bool, len(replicas))
+	for _, h := range plan.hosts {
+		used[h] = true
+	}
 
-			if h.IsUp() {
-				used[h] = true
-				return (*selectedHost)(h)
-			}
+	// the hosts the fallback defers are only deferred if they are not replicas
+	fallback := planHosts(t.fallback, qry)
+	for _, h := range fallback.deferred {
+		if !used[h] {
+			plan.deferred = append(plan.deferred, h)
 		}
+	}
+	for _, h := range fallback.hosts {
+		if !used[h] {
+			used[h] = true
+			plan.hosts = append(plan.hosts, h)
+		}
+	}
+	for _, h := range replicas {
+		if !used[h] {
+			used[h] = true
+			plan.skipped = append(plan.skipped, h)
+		}
+	}
+	for _, h := range fallback.skipped {
+		if !used[h] {
+			used[h] = true
+			plan.skipped = append(plan.skipped, h)
+		}
+	}
+	return plan
+}
 
-		if t.nonLocalReplicasFallback {
-			for j < len(remote) && k < len(remote[j]) {
-				h := remote[j][k]
-				k++
-
-				if k >= len(remote[j]) {
-					j++
-					k = 0
-				}
+func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
+	replicas, p := t.replicas(qry)
+	if p == nil {
+		return t.fallback.Pick(qry)
+	}
 
-				if h.IsUp() {
-					used[h] = true
-					return (*selectedHost)(h)
-				}
+	var (
+		replicaIter  = t.orderReplicas(replicas).pick()
+		fallbackIter NextHost
+	)
+	used := make(map[*HostInfo]bool, len(replicas))
+	return func() SelectedHost {
+		if replicaIter != nil {
+			if h := replicaIter(); h != nil {
+				used[h.Info()] = true
+				return h
 			}
+			replicaIter = nil
 		}
 
 		if fallbackIter == nil {
@@ -723,7 +1056,7 @@ func (r *hostPoolHostPolicy) SetHosts(hosts []*HostInfo) {
 	hostMap := make(map[string]*HostInfo, len(hosts))
 
 	for i, host := range hosts {
-		ip := host.ConnectAddress().String()
+		ip := host.addressKey()
 		peers[i] = ip
 		hostMap[ip] = host
 	}
@@ -735,7 +1068,7 @@ func (r *hostPoolHostPolicy) SetHosts(hosts []*HostInfo) {
 }
 
 func (r *hostPoolHostPolicy) AddHost(host *HostInfo) {
-	ip := host.ConnectAddress().String()
+	ip := host.addressKey()
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -756,7 +1089,7 @@ func (r *hostPoolHostPolicy) AddHost(host *HostInfo) {
 }
 
 func (r *hostPoolHostPolicy) RemoveHost(host *HostInfo) {
-	ip := host.ConnectAddress().String()
+	ip := host.addressKey()
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -768,7 +1101,7 @@ func (r *hostPoolHostPolicy) RemoveHost(host *HostInfo) {
 	delete(r.hostMap, ip)
 	hosts := make([]string, 0, len(r.hostMap))
 	for _, host := range r.hostMap {
-		hosts = append(hosts, host.ConnectAddress().String())
+		hosts = append(hosts, host.addressKey())
 	}
 
 	r.hp.SetHosts(hosts)
@@ -818,7 +1151,7 @@ func (host selectedHostPoolHost) Info() *HostInfo {
 }
 
 func (host selectedHostPoolHost) Mark(err error) {
-	ip := host.info.ConnectAddress().String()
+	ip := host.info.addressKey()
 
 	host.policy.mu.RLock()
 	defer host.policy.mu.RUnlock()
@@ -863,9 +1196,9 @@ func (d *dcAwareRR) AddHost(host *HostInfo) {
 
 func (d *dcAwareRR) RemoveHost(host *HostInfo) {
 	if d.IsLocal(host) {
-		d.localHosts.remove(host.ConnectAddress())
+		d.localHosts.remove(host)
 	} else {
-		d.remoteHosts.remove(host.ConnectAddress())
+		d.remoteHosts.remove(host)
 	}
 }
 
@@ -881,42 +1214,93 @@ func (d *dcAwareRR) HostDown(host *HostInfo) { d.RemoveHost(host) }
 // For tiered and DC-aware strategy:
 // roundRobbin(offset, localHosts, remoteHosts)
 func roundRobbin(shift int, hosts ...[]*HostInfo) NextHost {
+	return orderRoundRobbin(shift, hosts...).pick()
+}
+
+// planRoundRobbin returns the hosts roundRobbin would return, in order.
+func planRoundRobbin(shift int, hosts ...[]*HostInfo) hostPlan {
+	return orderRoundRobbin(shift, hosts...).plan()
+}
+
+// orderRoundRobbin returns the hosts of each layer of hosts in turn, starting
+// each layer at the host following shift.
+func orderRoundRobbin(shift int, hosts ...[]*HostInfo) hostOrder {
 	currentLayer := 0
 	currentlyObserved := 0
 
-	return func() SelectedHost {
-
+	return func() *HostInfo {
 		// iterate over layers
-		for {
-			if currentLayer == len(hosts) {
-				return nil
+		for currentLayer < len(hosts) {
+			currentLayerSize := len(hosts[currentLayer])
+
+			currentlyObserved++
+			if currentlyObserved > currentLayerSize {
+				currentLayer++
+				currentlyObserved = 0
+				continue
 			}
 
-			currentLayerSize := len(hosts[currentLayer])
+			return hosts[currentLayer][(shift+currentlyObserved)%currentLayerSize]
+		}
+		return nil
+	}
+}
 
-			// iterate over hosts within a layer
-			for {
-				currentlyObserved++
-				if currentlyObserved > currentLayerSize {
-					currentLayer++
-					currentlyObserved = 0
-					break
-				}
+// startOffset returns the offset of the first host round robin policies try
+// for qry, derived from its affinity key if any, or the next value of
+// lastUsedHostIdx otherwise.
+func startOffset(qry ExecutableQuery, lastUsedHostIdx *uint64) int {
+	if offset, ok := affinityOffset(qry); ok {
+		return offset
+	}
+	return int(atomic.AddUint64(lastUsedHostIdx, 1))
+}
 
-				h := hosts[currentLayer][(shift+currentlyObserved)%currentLayerSize]
+// nextOffset returns the offset startOffset would return for qry, without
+// advancing lastUsedHostIdx.
+func nextOffset(qry ExecutableQuery, lastUsedHostIdx *uint64) int {
+	if offset, ok := affinityOffset(qry); ok {
+		return offset
+	}
+	return int(atomic.LoadUint64(lastUsedHostIdx) + 1)
+}
 
-				if h.IsUp() {
-					return (*selectedHost)(h)
-				}
+// affinityOffset returns a non-negative hash of the affinity key set with
+// WithAffinity on the context of qry.
+func affinityOffset(qry ExecutableQuery) (int, bool) {
+	if qry == nil {
+		return 0, false
+	}
+	ctx := qry.Context()
+	if ctx == nil {
+		return 0, false
+	}
+	key, ok := AffinityFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() >> 1), true
+}
 
-			}
-		}
+// rotateHosts returns a copy of hosts starting at offset.
+func rotateHosts(hosts []*HostInfo, offset int) []*HostInfo {
+	if len(hosts) == 0 {
+		return hosts
 	}
+	offset %= len(hosts)
+	rotated := make([]*HostInfo, 0, len(hosts))
+	rotated = append(rotated, hosts[offset:]...)
+	return append(rotated, hosts[:offset]...)
 }
 
 func (d *dcAwareRR) Pick(q ExecutableQuery) NextHost {
-	nextStartOffset := atomic.AddUint64(&d.lastUsedHostIdx, 1)
-	return roundRobbin(int(nextStartOffset), d.localHosts.get(), d.remoteHosts.get())
+	return roundRobbin(startOffset(q, &d.lastUsedHostIdx), d.localHosts.get(), d.remoteHosts.get())
+}
+
+func (d *dcAwareRR) plan(q ExecutableQuery) hostPlan {
+	return planRoundRobbin(nextOffset(q, &d.lastUsedHostIdx), d.localHosts.get(), d.remoteHosts.get())
 }
 
 // RackAwareRoundRobinPolicy is a host selection policies which will prioritize and
@@ -970,15 +1354,18 @@ func (d *rackAwareRR) AddHost(host *HostInfo) {
 
 func (d *rackAwareRR) RemoveHost(host *HostInfo) {
 	dist := d.HostTier(host)
-	d.hosts[dist].remove(host.ConnectAddress())
+	d.hosts[dist].remove(host)
 }
 
 func (d *rackAwareRR) HostUp(host *HostInfo)   { d.AddHost(host) }
 func (d *rackAwareRR) HostDown(host *HostInfo) { d.RemoveHost(host) }
 
 func (d *rackAwareRR) Pick(q ExecutableQuery) NextHost {
-	nextStartOffset := atomic.AddUint64(&d.lastUsedHostIdx, 1)
-	return roundRobbin(int(nextStartOffset), d.hosts[0].get(), d.hosts[1].get(), d.hosts[2].get())
+	return roundRobbin(startOffset(q, &d.lastUsedHostIdx), d.hosts[0].get(), d.hosts[1].get(), d.hosts[2].get())
+}
+
+func (d *rackAwareRR) plan(q ExecutableQuery) hostPlan {
+	return planRoundRobbin(nextOffset(q, &d.lastUsedHostIdx), d.hosts[0].get(), d.hosts[1].get(), d.hosts[2].get())
 }
 
 // ReadyPolicy defines a policy for when a HostSelectionPolicy can be used. After
@@ -1003,6 +1390,10 @@ type singleHostReadyPolicy struct {
 	readyMux sync.Mutex
 }
 
+func (s *singleHostReadyPolicy) plan(qry ExecutableQuery) hostPlan {
+	return planHosts(s.HostSelectionPolicy, qry)
+}
+
 func (s *singleHostReadyPolicy) HostUp(host *HostInfo) {
 	s.HostSelectionPolicy.HostUp(host)
 
@@ -1096,6 +1487,22 @@ type SpeculativeExecutionPolicy interface {
 	Delay() time.Duration
 }
 
+// QuerySpeculativeExecutionPolicy is a SpeculativeExecutionPolicy whose delay
+// depends on the query and on the host of its first execution, such as
+// PercentileSpeculativeExecution. Policies wrapping one should implement it
+// too, so that the delay of the wrapped policy is used.
+type QuerySpeculativeExecutionPolicy interface {
+	SpeculativeExecutionPolicy
+	// DelayFor returns the delay after which qry, first sent to host, is
+	// executed speculatively, or a non-positive delay to use Delay. host is
+	// nil if it is not known.
+	DelayFor(qry ExecutableQuery, host *HostInfo) time.Duration
+	// ExpectedLatency returns the latency expected from an attempt of qry
+	// after one sent to host, or false if it is not known. Attempts are not
+	// started when the deadline of the query is closer, see ErrDeadlineTooShort.
+	ExpectedLatency(qry ExecutableQuery, host *HostInfo) (time.Duration, bool)
+}
+
 type NonSpeculativeExecution struct{}
 
 func (sp NonSpeculativeExecution) Attempts() int        { return 0 } // No additional attempts
@@ -1108,3 +1515,830 @@ type SimpleSpeculativeExecution struct {
 
 func (sp *SimpleSpeculativeExecution) Attempts() int        { return sp.NumAttempts }
 func (sp *SimpleSpeculativeExecution) Delay() time.Duration { return sp.TimeoutDelay }
+
+// PercentileSpeculativeFallbackDelay sets the delay used by
+// PercentileSpeculativeExecution for statements without enough measurements.
+// Default: 100 milliseconds.
+func PercentileSpeculativeFallbackDelay(delay time.Duration) func(*percentileSpeculativeExecution) {
+	return func(sp *percentileSpeculativeExecution) {
+		sp.fallbackDelay = delay
+	}
+}
+
+// PercentileSpeculativeMinMeasurements sets the number of measurements of a
+// statement on a host needed before its latency percentile is used as the
+// delay.
+// Default: 100.
+func PercentileSpeculativeMinMeasurements(n int) func(*percentileSpeculativeExecution) {
+	return func(sp *percentileSpeculativeExecution) {
+		sp.minMeasurements = n
+	}
+}
+
+// PercentileSpeculativeWindow sets how long latencies are taken into account.
+// Latencies are collected in a histogram which is rotated every window, the
+// percentile is computed over the current and the previous histogram so that
+// the delay follows changes of the cluster load. Default: 1 minute.
+func PercentileSpeculativeWindow(window time.Duration) func(*percentileSpeculativeExecution) {
+	return func(sp *percentileSpeculativeExecution) {
+		sp.window = window
+	}
+}
+
+// PercentileSpeculativeExecution is a SpeculativeExecutionPolicy which starts
+// up to attempts speculative executions of a statement once the execution took
+// longer than the given percentile (for example 99) of the recently observed
+// latencies of the statement, instead of after a fixed delay.
+//
+// Latencies are tracked per host and statement from the query and batch
+// attempts observed by the policy, so the returned policy must also be
+// registered as the QueryObserver and BatchObserver of the cluster:
+//
+//	sp := gocql.PercentileSpeculativeExecution(2, 99)
+//	cluster.QueryObserver = sp
+//	cluster.BatchObserver = sp
+//	session.Query(stmt).Idempotent(true).SetSpeculativeExecutionPolicy(sp)
+//
+// The delay is the percentile of the latencies of the host the first execution
+// is sent to. Failed attempts are not measured.
+func PercentileSpeculativeExecution(attempts int, percentile float64, opts ...func(*percentileSpeculativeExecution)) *percentileSpeculativeExecution {
+	sp := &percentileSpeculativeExecution{
+		attempts:        attempts,
+		percentile:      percentile,
+		fallbackDelay:   100 * time.Millisecond,
+		minMeasurements: 100,
+		window:          time.Minute,
+		now:             time.Now,
+		histograms:      make(map[speculativeKey]*latencyHistograms),
+	}
+	for _, opt := range opts {
+		opt(sp)
+	}
+	return sp
+}
+
+// maxSpeculativeStatements bounds the number of statements and hosts tracked
+// by percentileSpeculativeExecution, statements exceeding it use the fallback
+// delay.
+const maxSpeculativeStatements = 1000
+
+// speculativeKey identifies the latencies of a statement on a host. Batches
+// are identified by a hash of their statements, so that they do not have to
+// be joined on every execution.
+type speculativeKey struct {
+	host  string
+	stmt  string
+	batch uint64
+}
+
+type percentileSpeculativeExecution struct {
+	attempts        int
+	percentile      float64
+	fallbackDelay   time.Duration
+	minMeasurements int
+	window          time.Duration
+
+	// now is a field so that it can be overridden in tests
+	now func() time.Time
+
+	mu         sync.Mutex
+	histograms map[speculativeKey]*latencyHistograms
+}
+
+func (sp *percentileSpeculativeExecution) Attempts() int        { return sp.attempts }
+func (sp *percentileSpeculativeExecution) Delay() time.Duration { return sp.fallbackDelay }
+
+// DelayFor returns the percentile of the latencies of the statement of qry on
+// host, or the fallback delay if it was not measured enough.
+func (sp *percentileSpeculativeExecution) DelayFor(qry ExecutableQuery, host *HostInfo) time.Duration {
+	if delay, ok := sp.latencyFor(qry, host, sp.percentile); ok {
+		return delay
+	}
+	return sp.fallbackDelay
+}
+
+// ExpectedLatency returns the median of the latencies of the statement of qry
+// on host, or false if it was not measured enough.
+func (sp *percentileSpeculativeExecution) ExpectedLatency(qry ExecutableQuery, host *HostInfo) (time.Duration, bool) {
+	return sp.latencyFor(qry, host, 50)
+}
+
+// latencyFor returns the p-th percentile of the latencies of the statement of
+// qry on host, or false if it was not measured enough.
+func (sp *percentileSpeculativeExecution) latencyFor(qry ExecutableQuery, host *HostInfo, p float64) (time.Duration, bool) {
+	if host == nil {
+		return 0, false
+	}
+	key, ok := speculativeQueryKey(qry)
+	if !ok {
+		return 0, false
+	}
+	key.host = host.HostID()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	h, ok := sp.histograms[key]
+	if !ok {
+		return 0, false
+	}
+	h.rotate(sp.now(), sp.window)
+	if h.count() < sp.minMeasurements {
+		return 0, false
+	}
+	return h.percentile(p), true
+}
+
+func (sp *percentileSpeculativeExecution) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	if q.Err != nil || q.Host == nil {
+		return
+	}
+	sp.observe(speculativeKey{host: q.Host.HostID(), stmt: q.Statement}, q.End.Sub(q.Start))
+}
+
+func (sp *percentileSpeculativeExecution) ObserveBatch(ctx context.Context, b ObservedBatch) {
+	if b.Err != nil || b.Host == nil {
+		return
+	}
+	batch := hashStatements(len(b.Statements), func(i int) string { return b.Statements[i] })
+	sp.observe(speculativeKey{host: b.Host.HostID(), batch: batch}, b.End.Sub(b.Start))
+}
+
+func (sp *percentileSpeculativeExecution) observe(key speculativeKey, latency time.Duration) {
+	now := sp.now()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	h, ok := sp.histograms[key]
+	if !ok {
+		if len(sp.histograms) >= maxSpeculativeStatements {
+			sp.evictIdle(now)
+			if len(sp.histograms) >= maxSpeculativeStatements {
+				return
+			}
+		}
+		h = &latencyHistograms{started: now}
+		sp.histograms[key] = h
+	}
+	h.rotate(now, sp.window)
+	h.current.add(latency)
+}
+
+// evictIdle removes the statements which were not observed during the last
+// two windows.
+func (sp *percentileSpeculativeExecution) evictIdle(now time.Time) {
+	for key, h := range sp.histograms {
+		h.rotate(now, sp.window)
+		if h.count() == 0 {
+			delete(sp.histograms, key)
+		}
+	}
+}
+
+// speculativeQueryKey returns the key, without the host, used to track the
+// latencies of qry.
+func speculativeQueryKey(qry ExecutableQuery) (speculativeKey, bool) {
+	switch q := qry.(type) {
+	case *Query:
+		return speculativeKey{stmt: q.stmt}, true
+	case *Batch:
+		return speculativeKey{batch: hashStatements(len(q.Entries), func(i int) string { return q.Entries[i].Stmt })}, true
+	}
+	return speculativeKey{}, false
+}
+
+// hashStatements returns the FNV-1a hash of n statements separated by new
+// lines, without allocating.
+func hashStatements(n int, stmt func(i int) string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < n; i++ {
+		s := stmt(i)
+		for j := 0; j < len(s); j++ {
+			h ^= uint64(s[j])
+			h *= prime64
+		}
+		h ^= '\n'
+		h *= prime64
+	}
+	return h
+}
+
+// speculativeDelay returns the delay after which qry, first sent to host, is
+// executed speculatively.
+func speculativeDelay(sp SpeculativeExecutionPolicy, qry ExecutableQuery, host *HostInfo) time.Duration {
+	if p, ok := sp.(QuerySpeculativeExecutionPolicy); ok {
+		if delay := p.DelayFor(qry, host); delay > 0 {
+			return delay
+		}
+	}
+	return sp.Delay()
+}
+
+const (
+	// latencyHistogramMin is the upper bound of the first bucket.
+	latencyHistogramMin = 100 * time.Microsecond
+	// latencyHistogramSubBuckets is the number of buckets per doubling of the
+	// latency, the bounds of the buckets are about 9% apart.
+	latencyHistogramSubBuckets = 8
+	// latencyHistogramBuckets covers latencies up to about 100 seconds.
+	latencyHistogramBuckets = 20*latencyHistogramSubBuckets + 1
+)
+
+// latencyHistogram counts latencies in logarithmic buckets.
+type latencyHistogram struct {
+	buckets [latencyHistogramBuckets]int
+	total   int
+}
+
+func (h *latencyHistogram) add(latency time.Duration) {
+	i := 0
+	if latency > latencyHistogramMin {
+		i = int(math.Ceil(math.Log2(float64(latency)/float64(latencyHistogramMin)) * latencyHistogramSubBuckets))
+		if i >= latencyHistogramBuckets {
+			i = latencyHistogramBuckets - 1
+		}
+	}
+	h.buckets[i]++
+	h.total++
+}
+
+// latencyHistogramBound returns the upper bound of the i-th bucket.
+func latencyHistogramBound(i int) time.Duration {
+	return time.Duration(float64(latencyHistogramMin) * math.Exp2(float64(i)/latencyHistogramSubBuckets))
+}
+
+// latencyHistograms holds the histogram of the current window and the one of
+// the previous window.
+type latencyHistograms struct {
+	current  latencyHistogram
+	previous latencyHistogram
+	started  time.Time
+}
+
+// rotate starts a new window if the current one has ended.
+func (h *latencyHistograms) rotate(now time.Time, window time.Duration) {
+	elapsed := now.Sub(h.started)
+	if elapsed < window {
+		return
+	}
+	if elapsed < 2*window {
+		h.previous = h.current
+	} else {
+		h.previous = latencyHistogram{}
+	}
+	h.current = latencyHistogram{}
+	h.started = now
+}
+
+func (h *latencyHistograms) count() int {
+	return h.current.total + h.previous.total
+}
+
+// percentile returns the upper bound of the bucket containing the p-th
+// percentile of the latencies.
+func (h *latencyHistograms) percentile(p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(h.count())))
+	seen := 0
+	for i := 0; i < latencyHistogramBuckets; i++ {
+		seen += h.current.buckets[i] + h.previous.buckets[i]
+		if seen >= rank {
+			return latencyHistogramBound(i)
+		}
+	}
+	return latencyHistogramBound(latencyHistogramBuckets - 1)
+}
+
+// LatencyExclusionThreshold sets how much slower than the fastest host a host
+// may be before it is deprioritized by LatencyAwareHostPolicy.
+// For example with a threshold of 2 (the default) hosts whose average latency is
+// more than twice the best average latency are only tried after all other hosts.
+func LatencyExclusionThreshold(threshold float64) func(*latencyAwareHostPolicy) {
+	return func(p *latencyAwareHostPolicy) {
+		p.exclusionThreshold = threshold
+	}
+}
+
+// LatencyScale sets the time scale of the exponentially weighted moving average
+// of host latencies. Older measurements lose weight faster with a smaller scale.
+// Default: 100 milliseconds.
+func LatencyScale(scale time.Duration) func(*latencyAwareHostPolicy) {
+	return func(p *latencyAwareHostPolicy) {
+		p.scale = scale
+	}
+}
+
+// LatencyRetryPeriod sets how long a deprioritized host is kept at the end of the
+// query plan without new measurements. Once the period elapses the host is
+// ordered normally again so that a query can probe whether it has recovered.
+// Default: 10 seconds.
+func LatencyRetryPeriod(period time.Duration) func(*latencyAwareHostPolicy) {
+	return func(p *latencyAwareHostPolicy) {
+		p.retryPeriod = period
+	}
+}
+
+// LatencyUpdateRate sets how often the best host latency used as reference by
+// LatencyAwareHostPolicy is recomputed. Default: 100 milliseconds.
+func LatencyUpdateRate(rate time.Duration) func(*latencyAwareHostPolicy) {
+	return func(p *latencyAwareHostPolicy) {
+		p.updateRate = rate
+	}
+}
+
+// LatencyMinMeasurements sets the number of measurements needed before the
+// latency of a host is taken into account. Default: 50.
+func LatencyMinMeasurements(n int) func(*latencyAwareHostPolicy) {
+	return func(p *latencyAwareHostPolicy) {
+		p.minMeasurements = n
+	}
+}
+
+// LatencyAwareHostPolicy wraps a HostSelectionPolicy and moves hosts which are
+// significantly slower than the fastest host to the end of the query plan
+// returned by the wrapped policy.
+//
+// Latencies are tracked per host as an exponentially weighted moving average of
+// the query and batch attempts observed by the policy, so the returned policy
+// must also be registered as the QueryObserver and BatchObserver of the cluster:
+//
+//	policy := gocql.LatencyAwareHostPolicy(gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()))
+//	cluster.PoolConfig.HostSelectionPolicy = policy
+//	cluster.QueryObserver = policy
+//	cluster.BatchObserver = policy
+//
+// Errors returned by Cassandra are not measured as they are usually answered
+// faster than successful requests and would favor failing hosts.
+func LatencyAwareHostPolicy(fallback HostSelectionPolicy, opts ...func(*latencyAwareHostPolicy)) *latencyAwareHostPolicy {
+	p := &latencyAwareHostPolicy{
+		HostSelectionPolicy: fallback,
+		exclusionThreshold:  2,
+		scale:               100 * time.Millisecond,
+		retryPeriod:         10 * time.Second,
+		updateRate:          100 * time.Millisecond,
+		minMeasurements:     50,
+		now:                 time.Now,
+		latencies:           make(map[string]*hostLatency),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+type latencyAwareHostPolicy struct {
+	HostSelectionPolicy
+
+	exclusionThreshold float64
+	scale              time.Duration
+	retryPeriod        time.Duration
+	updateRate         time.Duration
+	minMeasurements    int
+
+	// now is a field so that it can be overridden in tests
+	now func() time.Time
+
+	// mu protects latencies, best and bestUpdated.
+	mu          sync.RWMutex
+	latencies   map[string]*hostLatency
+	best        float64
+	bestUpdated time.Time
+}
+
+// hostLatency is the exponentially weighted moving average of a host latency.
+type hostLatency struct {
+	average      float64 // nanoseconds
+	measurements int
+	updated      time.Time
+}
+
+func (p *latencyAwareHostPolicy) RemoveHost(host *HostInfo) {
+	p.mu.Lock()
+	delete(p.latencies, host.HostID())
+	p.mu.Unlock()
+
+	p.HostSelectionPolicy.RemoveHost(host)
+}
+
+func (p *latencyAwareHostPolicy) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	p.observe(q.Host, q.End.Sub(q.Start), q.Err)
+}
+
+func (p *latencyAwareHostPolicy) ObserveBatch(ctx context.Context, b ObservedBatch) {
+	p.observe(b.Host, b.End.Sub(b.Start), b.Err)
+}
+
+func (p *latencyAwareHostPolicy) observe(host *HostInfo, latency time.Duration, err error) {
+	if host == nil {
+		return
+	}
+	if _, ok := err.(RequestError); ok {
+		return
+	}
+
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l, ok := p.latencies[host.HostID()]
+	if !ok {
+		p.latencies[host.HostID()] = &hostLatency{average: float64(latency), measurements: 1, updated: now}
+		return
+	}
+
+	// the weight of the previous average decreases with the time elapsed since
+	// it was last updated, see
+	// https://docs.datastax.com/en/drivers/java/3.11/com/datastax/driver/core/policies/LatencyAwarePolicy.html
+	if delay := now.Sub(l.updated); delay > 0 {
+		scaledDelay := float64(delay) / float64(p.scale)
+		prevWeight := math.Log(scaledDelay+1) / scaledDelay
+		l.average = (1-prevWeight)*float64(latency) + prevWeight*l.average
+	}
+	l.measurements++
+	l.updated = now
+}
+
+// bestLatency returns the lowest average latency of the hosts with enough
+// measurements, recomputing it at most once per update rate.
+func (p *latencyAwareHostPolicy) bestLatency(now time.Time) float64 {
+	p.mu.RLock()
+	best, updated := p.best, p.bestUpdated
+	p.mu.RUnlock()
+	if now.Sub(updated) < p.updateRate {
+		return best
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.best = 0
+	for _, l := range p.latencies {
+		if l.measurements < p.minMeasurements {
+			continue
+		}
+		if p.best == 0 || l.average < p.best {
+			p.best = l.average
+		}
+	}
+	p.bestUpdated = now
+	return p.best
+}
+
+// isExcluded returns true if the host should be moved to the end of query plans.
+func (p *latencyAwareHostPolicy) isExcluded(host *HostInfo, best float64, now time.Time) bool {
+	if best == 0 {
+		return false
+	}
+
+	// copy the latency of the host as observe updates it in place
+	var l hostLatency
+	p.mu.RLock()
+	latency, ok := p.latencies[host.HostID()]
+	if ok {
+		l = *latency
+	}
+	p.mu.RUnlock()
+	if !ok || l.measurements < p.minMeasurements {
+		return false
+	}
+	if now.Sub(l.updated) > p.retryPeriod {
+		// give the host a chance to prove it has recovered
+		return false
+	}
+	return l.average > best*p.exclusionThreshold
+}
+
+func (p *latencyAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
+	now := p.now()
+	best := p.bestLatency(now)
+	return deferHosts(p.HostSelectionPolicy.Pick(qry), func(host *HostInfo) bool {
+		return p.isExcluded(host, best, now)
+	})
+}
+
+func (p *latencyAwareHostPolicy) plan(qry ExecutableQuery) hostPlan {
+	now := p.now()
+	best := p.bestLatency(now)
+	return planHosts(p.HostSelectionPolicy, qry).deferHosts(func(host *HostInfo) bool {
+		return p.isExcluded(host, best, now)
+	})
+}
+
+// SeverityAwareHostPolicy wraps a HostSelectionPolicy and moves hosts whose
+// severity is at least threshold to the end of the query plan returned by the
+// wrapped policy, so that hosts under heavy compaction or repair are only used
+// when the other hosts fail. The severity of the hosts is only known when
+// ClusterConfig.SeverityRefreshInterval is set, see HostInfo.Severity.
+func SeverityAwareHostPolicy(fallback HostSelectionPolicy, threshold float64) HostSelectionPolicy {
+	return &severityAwareHostPolicy{HostSelectionPolicy: fallback, threshold: threshold}
+}
+
+type severityAwareHostPolicy struct {
+	HostSelectionPolicy
+
+	threshold float64
+}
+
+func (p *severityAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
+	return deferHosts(p.HostSelectionPolicy.Pick(qry), p.deprioritized)
+}
+
+func (p *severityAwareHostPolicy) plan(qry ExecutableQuery) hostPlan {
+	return planHosts(p.HostSelectionPolicy, qry).deferHosts(p.deprioritized)
+}
+
+// deprioritized reports whether host is tried after the other hosts.
+func (p *severityAwareHostPolicy) deprioritized(host *HostInfo) bool {
+	return host.Severity() >= p.threshold
+}
+
+// CircuitState is the state of the circuit breaker of a host.
+type CircuitState int
+
+const (
+	// CircuitClosed means that queries are sent to the host.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means that the host failed repeatedly and no queries are sent to it.
+	CircuitOpen
+	// CircuitHalfOpen means that single probe queries are sent to the host to
+	// find out whether it recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown circuit state %d", int(s))
+}
+
+// ObservedCircuitBreaker describes a state change of the circuit breaker of a host.
+type ObservedCircuitBreaker struct {
+	Host *HostInfo
+	From CircuitState
+	To   CircuitState
+	// Err is the error which caused the state change, if any.
+	Err error
+}
+
+// CircuitBreakerObserver is notified when the circuit breaker of a host changes state.
+type CircuitBreakerObserver interface {
+	// ObserveCircuitBreaker gets called synchronously on every state change, so
+	// it must not block.
+	ObserveCircuitBreaker(ObservedCircuitBreaker)
+}
+
+// CircuitBreakerFailureThreshold sets the number of consecutive failures after
+// which the circuit of a host is opened. Default: 5.
+func CircuitBreakerFailureThreshold(n int) func(*circuitBreakerHostPolicy) {
+	return func(p *circuitBreakerHostPolicy) {
+		p.failureThreshold = n
+	}
+}
+
+// CircuitBreakerWindow sets the time within which the consecutive failures
+// must happen for the circuit of a host to be opened. Default: 10 seconds.
+func CircuitBreakerWindow(window time.Duration) func(*circuitBreakerHostPolicy) {
+	return func(p *circuitBreakerHostPolicy) {
+		p.window = window
+	}
+}
+
+// CircuitBreakerOpenDuration sets how long the circuit of a host stays open
+// before probe queries are sent to the host. Default: 30 seconds.
+func CircuitBreakerOpenDuration(d time.Duration) func(*circuitBreakerHostPolicy) {
+	return func(p *circuitBreakerHostPolicy) {
+		p.openDuration = d
+	}
+}
+
+// CircuitBreakerStateObserver sets the observer notified about state changes.
+func CircuitBreakerStateObserver(observer CircuitBreakerObserver) func(*circuitBreakerHostPolicy) {
+	return func(p *circuitBreakerHostPolicy) {
+		p.observer = observer
+	}
+}
+
+// CircuitBreakerHostPolicy wraps a HostSelectionPolicy and stops sending queries
+// to a host after a number of consecutive failures within a time window, without
+// waiting for the host to be marked down.
+//
+// Once the circuit of a host has been open for the open duration, it becomes
+// half-open: a single query at a time is sent to the host as a probe. The circuit
+// is closed again if the probe succeeds and reopened if it fails.
+//
+// Failures are errors which indicate that the host itself is unhealthy, such as
+// connection errors, timeouts and overloaded or bootstrapping errors. Other
+// errors returned by Cassandra do not count as failures.
+func CircuitBreakerHostPolicy(fallback HostSelectionPolicy, opts ...func(*circuitBreakerHostPolicy)) *circuitBreakerHostPolicy {
+	p := &circuitBreakerHostPolicy{
+		HostSelectionPolicy: fallback,
+		failureThreshold:    5,
+		window:              10 * time.Second,
+		openDuration:        30 * time.Second,
+		now:                 time.Now,
+		circuits:            make(map[string]*hostCircuit),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+type circuitBreakerHostPolicy struct {
+	HostSelectionPolicy
+
+	failureThreshold int
+	window           time.Duration
+	openDuration     time.Duration
+	observer         CircuitBreakerObserver
+
+	// now is a field so that it can be overridden in tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*hostCircuit
+}
+
+type hostCircuit struct {
+	state        CircuitState
+	failures     int
+	firstFailure time.Time
+	// opened is when the circuit was opened.
+	opened time.Time
+	// probing is when the probe in flight was sent, zero if there is none.
+	probing time.Time
+}
+
+// State returns the circuit state of the host.
+func (p *circuitBreakerHostPolicy) State(host *HostInfo) CircuitState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.circuits[host.HostID()]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+func (p *circuitBreakerHostPolicy) RemoveHost(host *HostInfo) {
+	p.mu.Lock()
+	delete(p.circuits, host.HostID())
+	p.mu.Unlock()
+
+	p.HostSelectionPolicy.RemoveHost(host)
+}
+
+// allow returns true if a query may be sent to the host.
+func (p *circuitBreakerHostPolicy) allow(host *HostInfo) bool {
+	now := p.now()
+
+	p.mu.Lock()
+	c, ok := p.circuits[host.HostID()]
+	if !ok || c.state == CircuitClosed {
+		p.mu.Unlock()
+		return true
+	}
+
+	var change *ObservedCircuitBreaker
+	state, allowed := p.admit(c, now)
+	if state != c.state {
+		change = &ObservedCircuitBreaker{Host: host, From: c.state, To: state}
+		c.state = state
+	}
+	if allowed {
+		c.probing = now
+	}
+	p.mu.Unlock()
+
+	if change != nil {
+		p.notify(*change)
+	}
+	return allowed
+}
+
+// admit returns the state of circuit c at now, and whether a query may be sent
+// to its host. It must be called with p.mu locked.
+func (p *circuitBreakerHostPolicy) admit(c *hostCircuit, now time.Time) (CircuitState, bool) {
+	state := c.state
+	if state == CircuitOpen && now.Sub(c.opened) >= p.openDuration {
+		state = CircuitHalfOpen
+	}
+
+	// the probe is given up on if it was never marked, for example because
+	// the host had no connection.
+	allowed := state == CircuitHalfOpen && (c.probing.IsZero() || now.Sub(c.probing) >= p.openDuration)
+	return state, allowed
+}
+
+func (p *circuitBreakerHostPolicy) mark(host *HostInfo, err error) {
+	failure := isCircuitBreakerFailure(err)
+	now := p.now()
+
+	p.mu.Lock()
+	c, ok := p.circuits[host.HostID()]
+	if !ok {
+		if !failure {
+			p.mu.Unlock()
+			return
+		}
+		c = &hostCircuit{}
+		p.circuits[host.HostID()] = c
+	}
+
+	from := c.state
+	switch {
+	case !failure:
+		c.state = CircuitClosed
+		c.failures = 0
+	case c.state == CircuitHalfOpen:
+		c.state = CircuitOpen
+		c.opened = now
+	case c.state == CircuitClosed:
+		if c.failures == 0 || now.Sub(c.firstFailure) > p.window {
+			c.failures = 0
+			c.firstFailure = now
+		}
+		c.failures++
+		if c.failures >= p.failureThreshold {
+			c.state = CircuitOpen
+			c.opened = now
+		}
+	}
+	c.probing = time.Time{}
+	to := c.state
+	p.mu.Unlock()
+
+	if from != to {
+		p.notify(ObservedCircuitBreaker{Host: host, From: from, To: to, Err: err})
+	}
+}
+
+func (p *circuitBreakerHostPolicy) notify(change ObservedCircuitBreaker) {
+	if p.observer != nil {
+		p.observer.ObserveCircuitBreaker(change)
+	}
+}
+
+// isCircuitBreakerFailure returns true if err indicates that the host is unhealthy.
+func isCircuitBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if reqErr, ok := err.(RequestError); ok {
+		switch reqErr.Code() {
+		case ErrCodeOverloaded, ErrCodeBootstrapping:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (p *circuitBreakerHostPolicy) Pick(qry ExecutableQuery) NextHost {
+	fallbackIter := p.HostSelectionPolicy.Pick(qry)
+	return func() SelectedHost {
+		for host := fallbackIter(); host != nil; host = fallbackIter() {
+			if host.Info() == nil {
+				return host
+			}
+			if p.allow(host.Info()) {
+				return &circuitSelectedHost{SelectedHost: host, policy: p}
+			}
+		}
+		return nil
+	}
+}
+
+func (p *circuitBreakerHostPolicy) plan(qry ExecutableQuery) hostPlan {
+	plan := planHosts(p.HostSelectionPolicy, qry)
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return plan.skipHosts(func(host *HostInfo) bool {
+		c, ok := p.circuits[host.HostID()]
+		if !ok || c.state == CircuitClosed {
+			return false
+		}
+		_, allowed := p.admit(c, now)
+		return !allowed
+	})
+}
+
+// circuitSelectedHost records the outcome of queries sent to a host.
+type circuitSelectedHost struct {
+	SelectedHost
+	policy *circuitBreakerHostPolicy
+}
+
+func (host *circuitSelectedHost) Mark(err error) {
+	host.policy.mark(host.Info(), err)
+	host.SelectedHost.Mark(err)
+}
@@ -29,9 +29,11 @@
 package gocql
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -140,6 +142,291 @@ func TestHostPolicy_TokenAware_SimpleStrategy(t *testing.T) {
 	expectNoMoreHosts(t, iter)
 }
 
+func TestQueryExplain(t *testing.T) {
+	const keyspace = "myKeyspace"
+	policy := TokenAwareHostPolicy(RoundRobinHostPolicy())
+	policyInternal := policy.(*tokenAwareHostPolicy)
+	policyInternal.getKeyspaceName = func() string { return keyspace }
+	policyInternal.getKeyspaceMetadata = func(keyspaceName string) (*KeyspaceMetadata, error) {
+		return &KeyspaceMetadata{
+			Name:          keyspace,
+			StrategyClass: "SimpleStrategy",
+			StrategyOptions: map[string]interface{}{
+				"class":              "SimpleStrategy",
+				"replication_factor": 2,
+			},
+		}, nil
+	}
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00"}},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), tokens: []string{"25"}},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3), tokens: []string{"50"}},
+		{hostId: "3", connectAddress: net.IPv4(10, 0, 0, 4), tokens: []string{"75"}},
+	}
+	for _, host := range &hosts {
+		policy.AddHost(host)
+	}
+	policy.SetPartitioner("OrderedPartitioner")
+	policy.KeyspaceChanged(KeyspaceUpdateEvent{Keyspace: keyspace})
+
+	// the token aware policy is found through the policies wrapping it
+	wrapped := SeverityAwareHostPolicy(SingleHostReadyPolicy(policy), 1)
+	query := &Query{session: &Session{policy: wrapped}, routingInfo: &queryRoutingInfo{}}
+	query.getKeyspace = func() string { return keyspace }
+	query.Consistency(One).RoutingKey([]byte("20"))
+
+	plan, err := query.Explain(WithConsistency(context.Background(), Quorum))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.TokenAware {
+		t.Error("expected the query to be routed token aware")
+	}
+	if plan.Token != "20" {
+		t.Errorf("expected token 20, got %q", plan.Token)
+	}
+	if plan.Consistency != Quorum {
+		t.Errorf("expected consistency %v, got %v", Quorum, plan.Consistency)
+	}
+	if len(plan.Hosts) != len(hosts) {
+		t.Fatalf("expected %d hosts, got %v", len(hosts), plan.Hosts)
+	}
+	if plan.Hosts[0] != hosts[1] || plan.Hosts[1] != hosts[2] {
+		t.Errorf("expected the replicas to be planned first, got %v", plan.Hosts)
+	}
+
+	query.SetHost(hosts[3])
+	plan, err = query.Explain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.TokenAware || len(plan.Hosts) != 1 || plan.Hosts[0] != hosts[3] {
+		t.Errorf("expected the query to be pinned to hosts[3], got %+v", plan)
+	}
+	if plan.Consistency != One {
+		t.Errorf("expected consistency %v, got %v", One, plan.Consistency)
+	}
+}
+
+func TestQueryExplainMatchesPick(t *testing.T) {
+	const keyspace = "myKeyspace"
+	policy := TokenAwareHostPolicy(RackAwareRoundRobinPolicy("local", "b"), NonLocalReplicasFallback())
+	policyInternal := policy.(*tokenAwareHostPolicy)
+	policyInternal.getKeyspaceName = func() string { return keyspace }
+	policyInternal.getKeyspaceMetadata = func(keyspaceName string) (*KeyspaceMetadata, error) {
+		return &KeyspaceMetadata{
+			Name:          keyspace,
+			StrategyClass: "SimpleStrategy",
+			StrategyOptions: map[string]interface{}{
+				"class":              "SimpleStrategy",
+				"replication_factor": 2,
+			},
+		}, nil
+	}
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00"}, dataCenter: "local", rack: "b"},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), tokens: []string{"25"}, dataCenter: "remote", rack: "a"},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3), tokens: []string{"50"}, dataCenter: "local", rack: "a"},
+		{hostId: "3", connectAddress: net.IPv4(10, 0, 0, 4), tokens: []string{"75"}, dataCenter: "remote", rack: "a"},
+	}
+	for _, host := range &hosts {
+		policy.AddHost(host)
+	}
+	policy.SetPartitioner("OrderedPartitioner")
+	policy.KeyspaceChanged(KeyspaceUpdateEvent{Keyspace: keyspace})
+
+	// the replicas of the token are in the local rack and in the remote
+	// datacenter, none are in the tier in between
+	query := &Query{session: &Session{policy: policy}, routingInfo: &queryRoutingInfo{}}
+	query.getKeyspace = func() string { return keyspace }
+	query.RoutingKey([]byte("60"))
+
+	plan, err := query.Explain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := policy.Pick(query)
+	var picked []*HostInfo
+	for selected := iter(); selected != nil; selected = iter() {
+		picked = append(picked, selected.Info())
+	}
+	if !reflect.DeepEqual(picked, plan.Hosts) {
+		t.Fatalf("expected Pick to return the planned hosts %v, got %v", plan.Hosts, picked)
+	}
+	expected := []*HostInfo{hosts[0], hosts[3], hosts[2], hosts[1]}
+	if !reflect.DeepEqual(picked, expected) {
+		t.Fatalf("expected the remote replica before the other hosts %v, got %v", expected, picked)
+	}
+
+	// the hosts which failed to fetch a page are tried last
+	query.failedHosts = []*HostInfo{hosts[0]}
+	plan, err = query.Explain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := plan.Hosts[len(plan.Hosts)-1]; last != hosts[0] {
+		t.Errorf("expected hosts[0] to be planned last, got %v", plan.Hosts)
+	}
+	if len(plan.Deferred) != 1 || plan.Deferred[0] != hosts[0] {
+		t.Errorf("expected hosts[0] to be deferred, got %v", plan.Deferred)
+	}
+}
+
+func TestQueryExplainNoSideEffects(t *testing.T) {
+	now := time.Unix(1000, 0)
+	breaker := CircuitBreakerHostPolicy(RoundRobinHostPolicy(),
+		CircuitBreakerFailureThreshold(1),
+		CircuitBreakerOpenDuration(10*time.Second))
+	breaker.now = func() time.Time { return now }
+	policy := SeverityAwareHostPolicy(breaker, 0.5)
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2)},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3)},
+		{hostId: "3", connectAddress: net.IPv4(10, 0, 0, 4)},
+	}
+	for _, host := range &hosts {
+		policy.AddHost(host)
+	}
+	hosts[2].setState(NodeDown)
+	hosts[3].setSeverity(1)
+
+	// open the circuit of hosts[0] and let it become half open
+	iter := policy.Pick(nil)
+	for selected := iter(); selected != nil; selected = iter() {
+		if selected.Info() == hosts[0] {
+			selected.Mark(ErrTimeoutNoResponse)
+			break
+		}
+	}
+	now = now.Add(time.Minute)
+
+	query := &Query{session: &Session{policy: policy}, routingInfo: &queryRoutingInfo{}}
+	query.RoutingKey([]byte("key"))
+	first, err := query.Explain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := query.Explain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same plan twice, got %v and %v", first.Hosts, second.Hosts)
+	}
+	if state := breaker.State(hosts[0]); state != CircuitOpen {
+		t.Errorf("expected the circuit to stay open, got %v", state)
+	}
+	if got := first.Hosts[len(first.Hosts)-1]; got != hosts[3] {
+		t.Errorf("expected hosts[3] to be tried last, got %v", first.Hosts)
+	}
+	if len(first.Deferred) != 1 || first.Deferred[0] != hosts[3] {
+		t.Errorf("expected hosts[3] to be deferred, got %v", first.Deferred)
+	}
+	if len(first.Skipped) != 1 || first.Skipped[0] != hosts[2] {
+		t.Errorf("expected hosts[2] to be skipped, got %v", first.Skipped)
+	}
+
+	// the half open circuit lets the probe through
+	iter = policy.Pick(nil)
+	var picked []*HostInfo
+	for selected := iter(); selected != nil; selected = iter() {
+		picked = append(picked, selected.Info())
+	}
+	if !reflect.DeepEqual(picked, first.Hosts) {
+		t.Errorf("expected Pick to return %v, got %v", first.Hosts, picked)
+	}
+
+	// the probe is in flight, so the circuit lets no query through
+	plan, err := query.Explain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range plan.Hosts {
+		if host == hosts[0] {
+			t.Errorf("expected hosts[0] to be skipped while probing, got %v", plan.Hosts)
+		}
+	}
+}
+
+func TestHostPolicy_Affinity(t *testing.T) {
+	const keyspace = "myKeyspace"
+	policy := TokenAwareHostPolicy(RoundRobinHostPolicy(), ShuffleReplicas())
+	policyInternal := policy.(*tokenAwareHostPolicy)
+	policyInternal.getKeyspaceName = func() string { return keyspace }
+	policyInternal.getKeyspaceMetadata = func(keyspaceName string) (*KeyspaceMetadata, error) {
+		return &KeyspaceMetadata{
+			Name:          keyspace,
+			StrategyClass: "SimpleStrategy",
+			StrategyOptions: map[string]interface{}{
+				"class":              "SimpleStrategy",
+				"replication_factor": 2,
+			},
+		}, nil
+	}
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00"}},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), tokens: []string{"25"}},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3), tokens: []string{"50"}},
+		{hostId: "3", connectAddress: net.IPv4(10, 0, 0, 4), tokens: []string{"75"}},
+	}
+	for _, host := range &hosts {
+		policy.AddHost(host)
+	}
+	policy.SetPartitioner("OrderedPartitioner")
+	policy.KeyspaceChanged(KeyspaceUpdateEvent{Keyspace: keyspace})
+
+	query := &Query{routingInfo: &queryRoutingInfo{}}
+	query.getKeyspace = func() string { return keyspace }
+
+	roundRobin := RoundRobinHostPolicy()
+	for _, host := range &hosts {
+		roundRobin.AddHost(host)
+	}
+
+	// round robin starts from the same host
+	first := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		qry := query.WithContext(WithAffinity(context.Background(), key))
+		host := roundRobin.Pick(qry)().Info().HostID()
+		for j := 0; j < 5; j++ {
+			if got := roundRobin.Pick(qry)().Info().HostID(); got != host {
+				t.Fatalf("expected %s to be picked first for %s, got %s", host, key, got)
+			}
+		}
+		first[host] = true
+	}
+	if len(first) < 2 {
+		t.Errorf("expected affinity keys to be spread over the hosts, got %v", first)
+	}
+
+	// token aware picks the same replica first, despite ShuffleReplicas
+	query.RoutingKey([]byte("20"))
+	first = make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		qry := query.WithContext(WithAffinity(context.Background(), key))
+		host := policy.Pick(qry)().Info().HostID()
+		if host != "1" && host != "2" {
+			t.Fatalf("expected a replica to be picked first for %s, got %s", key, host)
+		}
+		for j := 0; j < 5; j++ {
+			if got := policy.Pick(qry)().Info().HostID(); got != host {
+				t.Fatalf("expected %s to be picked first for %s, got %s", host, key, got)
+			}
+		}
+		first[host] = true
+	}
+	if len(first) != 2 {
+		t.Errorf("expected affinity keys to be spread over the replicas, got %v", first)
+	}
+}
+
 // Tests of the host pool host selection policy implementation
 func TestHostPolicy_HostPool(t *testing.T) {
 	policy := HostPoolHostPolicy(hostpool.New(nil))
@@ -311,6 +598,28 @@ func TestSimpleRetryPolicy(t *testing.T) {
 	}
 }
 
+func TestIdempotentRetryPolicy(t *testing.T) {
+	rt := IdempotentRetryPolicy(&SimpleRetryPolicy{NumRetries: 1})
+
+	q := &Query{routingInfo: &queryRoutingInfo{}}
+	q.metrics = preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: 1}})
+	if rt.Attempt(q) {
+		t.Fatal("should not retry non idempotent query")
+	}
+	q.Idempotent(true)
+	if !rt.Attempt(q) {
+		t.Fatal("should retry idempotent query")
+	}
+	q.metrics = preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: 2}})
+	if rt.Attempt(q) {
+		t.Fatal("should not retry idempotent query after NumRetries")
+	}
+
+	if _, ok := IdempotentRetryPolicy(&DowngradingConsistencyRetryPolicy{}).(consistencyDowngrader); !ok {
+		t.Fatal("should downgrade consistency with wrapped policy")
+	}
+}
+
 func TestExponentialBackoffPolicy(t *testing.T) {
 	// test with defaults
 	sut := &ExponentialBackoffRetryPolicy{NumRetries: 2}
@@ -847,3 +1156,412 @@ func TestHostPolicy_TokenAware_RackAware(t *testing.T) {
 	expectHosts(t, "non-local DC", iter, "0", "1", "4", "5", "8", "9")
 	expectNoMoreHosts(t, iter)
 }
+
+func TestHostPolicy_SeverityAware(t *testing.T) {
+	policy := SeverityAwareHostPolicy(RoundRobinHostPolicy(), 5)
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), severity: 4.5},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3)},
+	}
+	for _, host := range hosts {
+		policy.AddHost(host)
+	}
+
+	hosts[2].setSeverity(12)
+	for i := 0; i < len(hosts); i++ {
+		iter := policy.Pick(nil)
+		if first, second := iter(), iter(); first.Info() == hosts[2] || second.Info() == hosts[2] {
+			t.Fatalf("expected busy host to be tried last, got %v and %v first", first.Info(), second.Info())
+		}
+		expectHosts(t, "busy host", iter, "2")
+		expectNoMoreHosts(t, iter)
+	}
+
+	// once its severity drops the host is ordered normally again
+	hosts[2].setSeverity(0)
+	var picked int
+	for i := 0; i < len(hosts); i++ {
+		if policy.Pick(nil)().Info() == hosts[2] {
+			picked++
+		}
+	}
+	if picked != 1 {
+		t.Fatalf("expected recovered host to be picked first once, got %d", picked)
+	}
+}
+
+func TestHostPolicy_LatencyAware(t *testing.T) {
+	now := time.Unix(1000, 0)
+	policy := LatencyAwareHostPolicy(RoundRobinHostPolicy(), LatencyMinMeasurements(5))
+	policy.now = func() time.Time { return now }
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2)},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3)},
+	}
+	for _, host := range hosts {
+		policy.AddHost(host)
+	}
+
+	observe := func(host *HostInfo, latency time.Duration, err error) {
+		start := now
+		policy.ObserveQuery(context.Background(), ObservedQuery{Host: host, Start: start, End: start.Add(latency), Err: err})
+	}
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(10 * time.Millisecond)
+		observe(hosts[0], 10*time.Millisecond, nil)
+		observe(hosts[1], 12*time.Millisecond, nil)
+		observe(hosts[2], 50*time.Millisecond, nil)
+		// server errors are answered quickly and must not make a host look faster
+		observe(hosts[2], time.Millisecond, &RequestErrUnavailable{})
+	}
+	now = now.Add(time.Second)
+
+	for i := 0; i < len(hosts); i++ {
+		iter := policy.Pick(nil)
+		first, second := iter(), iter()
+		if first.Info() == hosts[2] || second.Info() == hosts[2] {
+			t.Fatalf("expected slow host to be tried last, got %v and %v first", first.Info(), second.Info())
+		}
+		expectHosts(t, "slow host", iter, "2")
+		expectNoMoreHosts(t, iter)
+	}
+
+	// once the retry period elapses the slow host is probed again
+	now = now.Add(11 * time.Second)
+	seenFirst := false
+	for i := 0; i < len(hosts); i++ {
+		if policy.Pick(nil)().Info() == hosts[2] {
+			seenFirst = true
+		}
+	}
+	if !seenFirst {
+		t.Fatal("expected slow host to be re-admitted after the retry period")
+	}
+
+	policy.RemoveHost(hosts[2])
+	if _, ok := policy.latencies[hosts[2].HostID()]; ok {
+		t.Fatal("expected latency of removed host to be discarded")
+	}
+}
+
+func TestHostPolicy_LatencyAwareConcurrent(t *testing.T) {
+	policy := LatencyAwareHostPolicy(RoundRobinHostPolicy(), LatencyMinMeasurements(1))
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2)},
+	}
+	for i, host := range hosts {
+		policy.AddHost(host)
+		start := time.Now()
+		policy.ObserveQuery(context.Background(), ObservedQuery{Host: host, Start: start, End: start.Add(time.Duration(i+1) * time.Millisecond)})
+	}
+
+	// run with -race: hosts are picked while their latencies are updated
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			start := time.Now()
+			policy.ObserveQuery(context.Background(), ObservedQuery{Host: hosts[i%2], Start: start, End: start.Add(time.Duration(i%2+1) * time.Millisecond)})
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		iter := policy.Pick(nil)
+		for host := iter(); host != nil; host = iter() {
+		}
+	}
+	<-done
+}
+
+func TestPercentileSpeculativeExecution(t *testing.T) {
+	now := time.Unix(1000, 0)
+	sp := PercentileSpeculativeExecution(2, 90, PercentileSpeculativeMinMeasurements(10), PercentileSpeculativeWindow(time.Minute))
+	sp.now = func() time.Time { return now }
+
+	if sp.Attempts() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", sp.Attempts())
+	}
+
+	qry := &Query{stmt: "SELECT * FROM t WHERE id = ?"}
+	other := &Query{stmt: "SELECT * FROM other"}
+	host := &HostInfo{hostId: "0"}
+	slowHost := &HostInfo{hostId: "1"}
+	observe := func(latency time.Duration, err error) {
+		sp.ObserveQuery(context.Background(), ObservedQuery{Statement: qry.stmt, Host: host, Start: now, End: now.Add(latency), Err: err})
+		sp.ObserveQuery(context.Background(), ObservedQuery{Statement: qry.stmt, Host: slowHost, Start: now, End: now.Add(10 * latency), Err: err})
+	}
+
+	if d := speculativeDelay(sp, qry, host); d != 100*time.Millisecond {
+		t.Fatalf("expected fallback delay without measurements, got %v", d)
+	}
+
+	for i := 0; i < 90; i++ {
+		observe(time.Millisecond, nil)
+	}
+	for i := 0; i < 10; i++ {
+		observe(20*time.Millisecond, nil)
+		// failures must not be measured
+		observe(time.Second, errors.New("failed"))
+	}
+
+	d := speculativeDelay(sp, qry, host)
+	if d < time.Millisecond || d > 1100*time.Microsecond {
+		t.Fatalf("expected p90 delay of about 1ms, got %v", d)
+	}
+	d = speculativeDelay(sp, qry, slowHost)
+	if d < 10*time.Millisecond || d > 11*time.Millisecond {
+		t.Fatalf("expected p90 delay of about 10ms on the slow host, got %v", d)
+	}
+	if d := speculativeDelay(sp, other, host); d != 100*time.Millisecond {
+		t.Fatalf("expected fallback delay for other statement, got %v", d)
+	}
+	if d := speculativeDelay(sp, qry, nil); d != 100*time.Millisecond {
+		t.Fatalf("expected fallback delay without a host, got %v", d)
+	}
+
+	// the previous window is still taken into account
+	now = now.Add(time.Minute)
+	for i := 0; i < 100; i++ {
+		observe(20*time.Millisecond, nil)
+	}
+	d = speculativeDelay(sp, qry, host)
+	if d < 20*time.Millisecond || d > 22*time.Millisecond {
+		t.Fatalf("expected p90 delay of about 20ms, got %v", d)
+	}
+
+	// latencies older than two windows are forgotten
+	now = now.Add(2 * time.Minute)
+	if d := speculativeDelay(sp, qry, host); d != 100*time.Millisecond {
+		t.Fatalf("expected fallback delay after measurements expired, got %v", d)
+	}
+
+	// batches are tracked by their statements
+	batch := &Batch{Entries: []BatchEntry{{Stmt: "INSERT a"}, {Stmt: "INSERT b"}}}
+	for i := 0; i < 10; i++ {
+		sp.ObserveBatch(context.Background(), ObservedBatch{Statements: []string{"INSERT a", "INSERT b"}, Host: host, Start: now, End: now.Add(5 * time.Millisecond)})
+	}
+	d = speculativeDelay(sp, batch, host)
+	if d < 5*time.Millisecond || d > 6*time.Millisecond {
+		t.Fatalf("expected p90 delay of about 5ms for the batch, got %v", d)
+	}
+	batch.Entries[1].Stmt = "INSERT c"
+	if d := speculativeDelay(sp, batch, host); d != 100*time.Millisecond {
+		t.Fatalf("expected fallback delay for other batch, got %v", d)
+	}
+}
+
+// wrappedSpeculativeExecution is a custom policy forwarding the delay of the
+// policy it wraps.
+type wrappedSpeculativeExecution struct {
+	QuerySpeculativeExecutionPolicy
+}
+
+func TestQuerySpeculativeExecutionPolicy(t *testing.T) {
+	sp := PercentileSpeculativeExecution(1, 50, PercentileSpeculativeMinMeasurements(1), PercentileSpeculativeFallbackDelay(time.Second))
+	host := &HostInfo{hostId: "0"}
+	qry := &Query{stmt: "SELECT * FROM t", metrics: &queryMetrics{m: make(map[string]*hostMetrics)}}
+	now := time.Now()
+	sp.ObserveQuery(context.Background(), ObservedQuery{Statement: qry.stmt, Host: host, Start: now, End: now.Add(time.Millisecond)})
+
+	d := speculativeDelay(wrappedSpeculativeExecution{sp}, qry, host)
+	if d < time.Millisecond || d > 1100*time.Microsecond {
+		t.Fatalf("expected the delay of the wrapped policy, got %v", d)
+	}
+
+	expected, ok := expectedLatency(qry, wrappedSpeculativeExecution{sp}, host)
+	if !ok || expected < time.Millisecond || expected > 1100*time.Microsecond {
+		t.Fatalf("expected the latency of the wrapped policy, got %v", expected)
+	}
+	if _, ok := expectedLatency(qry, wrappedSpeculativeExecution{sp}, &HostInfo{hostId: "1"}); ok {
+		t.Fatal("expected no latency for a host without measurements")
+	}
+}
+
+func TestDowngradingConsistencyRetryPolicy_FromError(t *testing.T) {
+	if upstreamDefaults {
+		t.Skip("the consistency is not downgraded from the error with the upstream defaults")
+	}
+
+	type downgrade struct {
+		from, to Consistency
+		err      error
+	}
+	var downgrades []downgrade
+	rt := &DowngradingConsistencyRetryPolicy{
+		OnDowngrade: func(q RetryableQuery, from, to Consistency, err error) {
+			downgrades = append(downgrades, downgrade{from, to, err})
+		},
+	}
+
+	cases := []struct {
+		err       error
+		retryType RetryType
+		cons      Consistency
+		// from is the consistency of the query, Quorum if 0.
+		from Consistency
+	}{
+		{&RequestErrUnavailable{Consistency: All, Required: 5, Alive: 4}, Retry, Three, 0},
+		{&RequestErrUnavailable{Consistency: Quorum, Required: 3, Alive: 2}, Retry, Two, 0},
+		{&RequestErrUnavailable{Consistency: Quorum, Required: 2, Alive: 1}, Retry, One, 0},
+		{&RequestErrUnavailable{Consistency: Quorum, Required: 2, Alive: 0}, Rethrow, Quorum, 0},
+		{&RequestErrWriteTimeout{Consistency: Quorum, Received: 1, BlockFor: 2, WriteType: "UNLOGGED_BATCH"}, Retry, One, 0},
+		{&RequestErrWriteTimeout{Consistency: Quorum, Received: 0, BlockFor: 2, WriteType: "UNLOGGED_BATCH"}, Rethrow, Quorum, 0},
+		{&RequestErrReadTimeout{Consistency: Quorum, Received: 1, BlockFor: 2}, Retry, One, 0},
+		{&RequestErrReadTimeout{Consistency: Quorum, Received: 2, BlockFor: 2}, Retry, Quorum, 0},
+		{&RequestErrReadTimeout{Consistency: Quorum, Received: 0, BlockFor: 2}, Rethrow, Quorum, 0},
+		// the local consistency levels stay local
+		{&RequestErrUnavailable{Consistency: LocalQuorum, Required: 3, Alive: 2}, Retry, LocalOne, LocalQuorum},
+		{&RequestErrWriteTimeout{Consistency: LocalQuorum, Received: 1, BlockFor: 2, WriteType: "UNLOGGED_BATCH"}, Retry, LocalOne, LocalQuorum},
+		{&RequestErrReadTimeout{Consistency: LocalQuorum, Received: 1, BlockFor: 2}, Retry, LocalOne, LocalQuorum},
+		{&RequestErrUnavailable{Consistency: LocalQuorum, Required: 2, Alive: 0}, Rethrow, LocalQuorum, LocalQuorum},
+		// the serial phase of lightweight transactions is not downgraded
+		{&RequestErrUnavailable{Consistency: Consistency(Serial), Required: 3, Alive: 2}, Rethrow, Quorum, 0},
+		{&RequestErrUnavailable{Consistency: Consistency(LocalSerial), Required: 3, Alive: 2}, Rethrow, LocalQuorum, LocalQuorum},
+		{&RequestErrReadTimeout{Consistency: Consistency(Serial), Received: 1, BlockFor: 2}, Rethrow, Quorum, 0},
+	}
+
+	for _, c := range cases {
+		from := c.from
+		if from == 0 {
+			from = Quorum
+		}
+		downgrades = nil
+		q := &Query{cons: from, routingInfo: &queryRoutingInfo{}}
+		q.metrics = preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: 1}})
+
+		if !rt.Attempt(q) {
+			t.Fatalf("%v: should allow retry after 1 attempt", c.err)
+		}
+		retryType := rt.GetRetryType(c.err)
+		if retryType != c.retryType {
+			t.Fatalf("%v: retry type should be %v, got %v", c.err, c.retryType, retryType)
+		}
+		if retryType == Retry {
+			rt.downgrade(q, c.err)
+		}
+		if q.GetConsistency() != c.cons {
+			t.Fatalf("%v: consistency should be %v, got %v", c.err, c.cons, q.GetConsistency())
+		}
+
+		if c.cons == from {
+			if len(downgrades) != 0 {
+				t.Fatalf("%v: unexpected downgrades %v", c.err, downgrades)
+			}
+		} else if len(downgrades) != 1 || downgrades[0] != (downgrade{from, c.cons, c.err}) {
+			t.Fatalf("%v: expected downgrade from %v to %v, got %v", c.err, from, c.cons, downgrades)
+		}
+
+		q.metrics = preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: 2}})
+		if rt.Attempt(q) {
+			t.Fatalf("%v: should only retry once", c.err)
+		}
+	}
+}
+
+type recordingCircuitBreakerObserver struct {
+	changes []ObservedCircuitBreaker
+}
+
+func (o *recordingCircuitBreakerObserver) ObserveCircuitBreaker(change ObservedCircuitBreaker) {
+	o.changes = append(o.changes, change)
+}
+
+func TestHostPolicy_CircuitBreaker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	observer := &recordingCircuitBreakerObserver{}
+	policy := CircuitBreakerHostPolicy(RoundRobinHostPolicy(),
+		CircuitBreakerFailureThreshold(3),
+		CircuitBreakerWindow(time.Second),
+		CircuitBreakerOpenDuration(10*time.Second),
+		CircuitBreakerStateObserver(observer))
+	policy.now = func() time.Time { return now }
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2)},
+	}
+	for _, host := range hosts {
+		policy.AddHost(host)
+	}
+
+	// markHost picks hosts until host is returned and marks it with err.
+	markHost := func(host *HostInfo, err error) bool {
+		iter := policy.Pick(nil)
+		for selected := iter(); selected != nil; selected = iter() {
+			if selected.Info() == host {
+				selected.Mark(err)
+				return true
+			}
+		}
+		return false
+	}
+
+	// errors returned by Cassandra do not open the circuit
+	for i := 0; i < 5; i++ {
+		markHost(hosts[1], &RequestErrUnavailable{})
+	}
+	// failures spread over more than the window do not open the circuit
+	for i := 0; i < 5; i++ {
+		now = now.Add(600 * time.Millisecond)
+		markHost(hosts[1], ErrTimeoutNoResponse)
+	}
+	if state := policy.State(hosts[1]); state != CircuitClosed {
+		t.Fatalf("expected circuit to be closed, got %v", state)
+	}
+
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		markHost(hosts[1], ErrTimeoutNoResponse)
+	}
+	if state := policy.State(hosts[1]); state != CircuitOpen {
+		t.Fatalf("expected circuit to be open, got %v", state)
+	}
+	for i := 0; i < 4; i++ {
+		iter := policy.Pick(nil)
+		expectHosts(t, "open circuit", iter, "0")
+		expectNoMoreHosts(t, iter)
+	}
+
+	// after the open duration a single probe is allowed, a failed probe reopens the circuit
+	now = now.Add(10 * time.Second)
+	if !markHost(hosts[1], ErrConnectionClosed) {
+		t.Fatal("expected a probe to be sent to the host")
+	}
+	if state := policy.State(hosts[1]); state != CircuitOpen {
+		t.Fatalf("expected circuit to be reopened, got %v", state)
+	}
+
+	now = now.Add(10 * time.Second)
+	iter := policy.Pick(nil)
+	var probe SelectedHost
+	for selected := iter(); selected != nil; selected = iter() {
+		if selected.Info() == hosts[1] {
+			probe = selected
+		}
+	}
+	if probe == nil {
+		t.Fatal("expected a probe to be sent to the host")
+	}
+	if markHost(hosts[1], nil) {
+		t.Fatal("expected a single probe at a time")
+	}
+	probe.Mark(nil)
+	if state := policy.State(hosts[1]); state != CircuitClosed {
+		t.Fatalf("expected circuit to be closed after a successful probe, got %v", state)
+	}
+
+	expected := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(observer.changes) != len(expected) {
+		t.Fatalf("expected %d state changes, got %v", len(expected), observer.changes)
+	}
+	for i, change := range observer.changes {
+		if change.Host != hosts[1] || change.To != expected[i] {
+			t.Fatalf("state change %d: expected host 1 to become %v, got %+v", i, expected[i], change)
+		}
+	}
+}
@@ -26,17 +26,91 @@ package gocql
 
 import (
 	"bytes"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gocql/gocql/internal/lru"
 )
 
 const defaultMaxPreparedStmts = 1000
 
+// defaultReprepareStatements is the default of
+// ClusterConfig.ReprepareStatements.
+const defaultReprepareStatements = 100
+
+// PreparedCacheStats are the counters of the prepared statement cache of a
+// session.
+type PreparedCacheStats struct {
+	// Entries is the number of statements cached for all the hosts.
+	Entries int
+	// Hits is the number of statements found in the cache.
+	Hits int64
+	// Misses is the number of statements which were not cached, or expired,
+	// and were prepared.
+	Misses int64
+	// Evictions is the number of statements evicted from the cache because
+	// the cache, or their keyspace, had too many statements.
+	Evictions int64
+	// Expirations is the number of statements removed from the cache because
+	// they were not used for ClusterConfig.PreparedStmtTTL.
+	Expirations int64
+}
+
+// PreparedCacheStats returns the counters of the prepared statement cache of
+// the session.
+func (s *Session) PreparedCacheStats() PreparedCacheStats {
+	return s.stmtsLRU.stats()
+}
+
+// InvalidatePrepared removes the statement prepared in keyspace from the
+// prepared statement cache of all the hosts, or all the statements prepared in
+// keyspace if stmt is empty, so that they are prepared again on their next
+// use, for example after the schema of their tables changed. It returns the
+// number of statements removed.
+func (s *Session) InvalidatePrepared(keyspace, stmt string) int {
+	return s.stmtsLRU.invalidate(func(flight *inflightPrepare) bool {
+		return flight.keyspace == keyspace && (stmt == "" || flight.stmt == stmt)
+	})
+}
+
 // preparedLRU is the prepared statement cache
 type preparedLRU struct {
 	mu  sync.Mutex
 	lru *lru.Cache
+	// repreparing holds the host IDs of the hosts whose statements are being
+	// prepared again.
+	repreparing map[string]struct{}
+
+	// ttl is the time after which an unused statement expires, 0 if
+	// statements do not expire.
+	ttl time.Duration
+	// maxPerKeyspace is the maximum number of statements cached for each
+	// keyspace, 0 if unbounded.
+	maxPerKeyspace int
+	// keyspaces is the number of statements cached for each keyspace.
+	keyspaces map[string]int
+
+	hits        int64
+	misses      int64
+	evictions   int64
+	expirations int64
+}
+
+func newPreparedLRU(cfg *ClusterConfig) *preparedLRU {
+	p := &preparedLRU{
+		lru:            lru.New(cfg.MaxPreparedStmts),
+		ttl:            cfg.PreparedStmtTTL,
+		maxPerKeyspace: cfg.MaxPreparedStmtsPerKeyspace,
+		keyspaces:      make(map[string]int),
+	}
+	p.lru.OnEvicted = func(key string, value interface{}) {
+		keyspace := value.(*inflightPrepare).keyspace
+		if p.keyspaces[keyspace]--; p.keyspaces[keyspace] <= 0 {
+			delete(p.keyspaces, keyspace)
+		}
+	}
+	return p
 }
 
 func (p *preparedLRU) clear() {
@@ -48,9 +122,47 @@ func (p *preparedLRU) clear() {
 	}
 }
 
+// removeHost removes the statements prepared on the host with the given
+// host_id.
+func (p *preparedLRU) removeHost(hostID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lru.RemoveFunc(func(key string) bool {
+		return strings.HasPrefix(key, hostID)
+	})
+}
+
 func (p *preparedLRU) add(key string, val *inflightPrepare) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.addLocked(key, val)
+}
+
+// addLocked adds val to the cache, evicting the least recently used statement
+// of its keyspace or of the cache when either is full. p.mu must be held.
+func (p *preparedLRU) addLocked(key string, val *inflightPrepare) {
+	if p.ttl > 0 {
+		val.lastUsed = time.Now()
+	}
+	if old, ok := p.lru.Get(key); ok {
+		// the value replaced is not evicted
+		p.keyspaces[old.(*inflightPrepare).keyspace]--
+		p.keyspaces[val.keyspace]++
+		p.lru.Add(key, val)
+		return
+	}
+
+	if p.maxPerKeyspace > 0 && p.keyspaces[val.keyspace] >= p.maxPerKeyspace {
+		p.lru.RemoveOldestFunc(func(_ string, value interface{}) bool {
+			return value.(*inflightPrepare).keyspace == val.keyspace
+		})
+		p.evictions++
+	} else if p.lru.MaxEntries > 0 && p.lru.Len() >= p.lru.MaxEntries {
+		p.lru.RemoveOldest()
+		p.evictions++
+	}
+	p.keyspaces[val.keyspace]++
 	p.lru.Add(key, val)
 }
 
@@ -60,16 +172,74 @@ func (p *preparedLRU) remove(key string) bool {
 	return p.lru.Remove(key)
 }
 
-func (p *preparedLRU) execIfMissing(key string, fn func(lru *lru.Cache) *inflightPrepare) (*inflightPrepare, bool) {
+// execIfMissing returns the statement cached with key, or caches and returns
+// the statement returned by fn if it is not cached or expired.
+func (p *preparedLRU) execIfMissing(key string, fn func() *inflightPrepare) (*inflightPrepare, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	val, ok := p.lru.Get(key)
-	if ok {
-		return val.(*inflightPrepare), true
+	if val, ok := p.lru.Get(key); ok {
+		flight := val.(*inflightPrepare)
+		if !p.expired(flight) {
+			if p.ttl > 0 {
+				flight.lastUsed = time.Now()
+			}
+			p.hits++
+			return flight, true
+		}
+		p.lru.Remove(key)
+		p.expirations++
+	}
+
+	p.misses++
+	flight := fn()
+	p.addLocked(key, flight)
+	return flight, false
+}
+
+// expired reports whether flight was prepared and not used for the ttl of the
+// cache. p.mu must be held.
+func (p *preparedLRU) expired(flight *inflightPrepare) bool {
+	if p.ttl <= 0 {
+		return false
 	}
+	select {
+	case <-flight.done:
+		return time.Since(flight.lastUsed) > p.ttl
+	default:
+		return false
+	}
+}
 
-	return fn(p.lru), false
+// invalidate removes the statements satisfying f from the cache and returns
+// the number of statements removed.
+func (p *preparedLRU) invalidate(f func(flight *inflightPrepare) bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var keys []string
+	p.lru.Each(func(key string, value interface{}) bool {
+		if f(value.(*inflightPrepare)) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		p.lru.Remove(key)
+	}
+	return len(keys)
+}
+
+func (p *preparedLRU) stats() PreparedCacheStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PreparedCacheStats{
+		Entries:     p.lru.Len(),
+		Hits:        p.hits,
+		Misses:      p.misses,
+		Evictions:   p.evictions,
+		Expirations: p.expirations,
+	}
 }
 
 func (p *preparedLRU) keyFor(hostID, keyspace, statement string) string {
@@ -100,3 +270,132 @@ func (p *preparedLRU) evictPreparedID(key string, id []byte) {
 	}
 
 }
+
+// preparedStmt is a statement prepared in a keyspace.
+type preparedStmt struct {
+	keyspace string
+	stmt     string
+}
+
+// hot returns the n statements prepared successfully which were used most
+// recently on any host.
+func (p *preparedLRU) hot(n int) []preparedStmt {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := make(map[preparedStmt]struct{})
+	var stmts []preparedStmt
+	p.lru.Each(func(key string, value interface{}) bool {
+		flight := value.(*inflightPrepare)
+		select {
+		case <-flight.done:
+			if flight.err != nil || p.expired(flight) {
+				return true
+			}
+		default:
+			return true
+		}
+		stmt := preparedStmt{keyspace: flight.keyspace, stmt: flight.stmt}
+		if _, ok := seen[stmt]; !ok {
+			seen[stmt] = struct{}{}
+			stmts = append(stmts, stmt)
+		}
+		return len(stmts) < n
+	})
+	return stmts
+}
+
+// refresh caches the statement prepared again with key, unless the statement
+// is being prepared by a request.
+func (p *preparedLRU) refresh(key string, stmt preparedStmt, prepared *preparedStatment) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if val, ok := p.lru.Get(key); ok {
+		select {
+		case <-val.(*inflightPrepare).done:
+		default:
+			return
+		}
+	}
+
+	flight := &inflightPrepare{
+		done:             make(chan struct{}),
+		keyspace:         stmt.keyspace,
+		stmt:             stmt.stmt,
+		preparedStatment: prepared,
+	}
+	close(flight.done)
+	p.addLocked(key, flight)
+}
+
+// startReprepare reports whether the statements of the host can be prepared
+// again, false if they are already being prepared again.
+func (p *preparedLRU) startReprepare(hostID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.repreparing[hostID]; ok {
+		return false
+	}
+	if p.repreparing == nil {
+		p.repreparing = make(map[string]struct{})
+	}
+	p.repreparing[hostID] = struct{}{}
+	return true
+}
+
+func (p *preparedLRU) endReprepare(hostID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.repreparing, hostID)
+}
+
+// reprepare prepares again on host, in the background, the
+// ClusterConfig.ReprepareStatements statements used most recently on any
+// host, when its pool is established again, so that the first requests sent
+// to it after it restarted do not wait for the statements to be prepared.
+// The statements cached for the host stay usable while they are prepared
+// again and are replaced once prepared.
+func (s *Session) reprepare(host *HostInfo) {
+	n := s.cfg.ReprepareStatements
+	hostID := host.HostID()
+	if n <= 0 || !s.stmtsLRU.startReprepare(hostID) {
+		return
+	}
+
+	go func() {
+		defer s.stmtsLRU.endReprepare(hostID)
+
+		stmts := s.stmtsLRU.hot(n)
+		if len(stmts) == 0 {
+			return
+		}
+		pool, ok := s.pool.getPool(host)
+		if !ok {
+			return
+		}
+		conn := pool.Pick()
+		if conn == nil {
+			return
+		}
+
+		s.debugf("gocql: preparing %d statements again on %s\n", len(stmts), host.ConnectAddressAndPort())
+		for _, stmt := range stmts {
+			if conn.version < protoVersion5 && stmt.keyspace != conn.currentKeyspace {
+				// the statement can only be prepared in the keyspace of the
+				// connection
+				continue
+			}
+			prepared, err := conn.prepare(s.ctx, stmt.keyspace, stmt.stmt, nil)
+			if err != nil {
+				if s.ctx.Err() != nil || conn.Closed() {
+					return
+				}
+				s.logger.Printf("gocql: unable to prepare statement again on %s: %v\n", host.ConnectAddressAndPort(), err)
+				continue
+			}
+			s.stmtsLRU.refresh(s.stmtsLRU.keyFor(hostID, stmt.keyspace, stmt.stmt), stmt, prepared)
+		}
+	}()
+}
@@ -0,0 +1,133 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/*
+ * Content before git sha 34fdeebefcbf183ed7f916f931aa0586fdaa1b40
+ * Copyright (c) 2016, The Gocql authors,
+ * provided under the BSD-3-Clause License.
+ * See the NOTICE file distributed with this work for additional information.
+ */
+
+package gocql
+
+import (
+	"testing"
+	"time"
+)
+
+func preparedFlight(keyspace, stmt string) *inflightPrepare {
+	flight := &inflightPrepare{
+		done:     make(chan struct{}),
+		keyspace: keyspace,
+		stmt:     stmt,
+	}
+	close(flight.done)
+	return flight
+}
+
+func TestPreparedLRUStats(t *testing.T) {
+	p := newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 2})
+
+	for _, stmt := range []string{"a", "b", "a", "c"} {
+		p.execIfMissing(p.keyFor("host", "ks", stmt), func() *inflightPrepare {
+			return preparedFlight("ks", stmt)
+		})
+	}
+
+	want := PreparedCacheStats{Entries: 2, Hits: 1, Misses: 3, Evictions: 1}
+	if stats := p.stats(); stats != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+	if _, ok := p.lru.Get(p.keyFor("host", "ks", "b")); ok {
+		t.Fatal("expected the least recently used statement to be evicted")
+	}
+}
+
+func TestPreparedLRUMaxPerKeyspace(t *testing.T) {
+	p := newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 10, MaxPreparedStmtsPerKeyspace: 2})
+
+	p.add(p.keyFor("host", "ks1", "a"), preparedFlight("ks1", "a"))
+	p.add(p.keyFor("host", "ks2", "a"), preparedFlight("ks2", "a"))
+	p.add(p.keyFor("host", "ks1", "b"), preparedFlight("ks1", "b"))
+	p.add(p.keyFor("host", "ks1", "c"), preparedFlight("ks1", "c"))
+
+	if _, ok := p.lru.Get(p.keyFor("host", "ks1", "a")); ok {
+		t.Fatal("expected the least recently used statement of the keyspace to be evicted")
+	}
+	if _, ok := p.lru.Get(p.keyFor("host", "ks2", "a")); !ok {
+		t.Fatal("expected the statement of the other keyspace to be cached")
+	}
+	if n := p.keyspaces["ks1"]; n != 2 {
+		t.Fatalf("expected 2 statements cached for the keyspace, got %d", n)
+	}
+	if stats := p.stats(); stats.Entries != 3 || stats.Evictions != 1 {
+		t.Fatalf("expected 3 statements and 1 eviction, got %+v", stats)
+	}
+}
+
+func TestPreparedLRUTTL(t *testing.T) {
+	p := newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 10, PreparedStmtTTL: time.Minute})
+
+	key := p.keyFor("host", "ks", "a")
+	first, _ := p.execIfMissing(key, func() *inflightPrepare {
+		return preparedFlight("ks", "a")
+	})
+	if _, cached := p.execIfMissing(key, func() *inflightPrepare {
+		return preparedFlight("ks", "a")
+	}); !cached {
+		t.Fatal("expected the statement to be cached")
+	}
+
+	first.lastUsed = time.Now().Add(-2 * time.Minute)
+	if len(p.hot(10)) != 0 {
+		t.Fatal("expected the expired statement not to be prepared again")
+	}
+	second, cached := p.execIfMissing(key, func() *inflightPrepare {
+		return preparedFlight("ks", "a")
+	})
+	if cached || second == first {
+		t.Fatal("expected the expired statement to be prepared again")
+	}
+	want := PreparedCacheStats{Entries: 1, Hits: 1, Misses: 2, Expirations: 1}
+	if stats := p.stats(); stats != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestPreparedLRUInvalidate(t *testing.T) {
+	s := &Session{stmtsLRU: newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 10})}
+	p := s.stmtsLRU
+
+	for _, host := range []string{"host1", "host2"} {
+		p.add(p.keyFor(host, "ks1", "a"), preparedFlight("ks1", "a"))
+		p.add(p.keyFor(host, "ks1", "b"), preparedFlight("ks1", "b"))
+		p.add(p.keyFor(host, "ks2", "a"), preparedFlight("ks2", "a"))
+	}
+
+	if n := s.InvalidatePrepared("ks1", "a"); n != 2 {
+		t.Fatalf("expected the statement to be removed for 2 hosts, got %d", n)
+	}
+	if n := s.InvalidatePrepared("ks1", ""); n != 2 {
+		t.Fatalf("expected the other statement of the keyspace to be removed for 2 hosts, got %d", n)
+	}
+	if stats := s.PreparedCacheStats(); stats.Entries != 2 || stats.Evictions != 0 {
+		t.Fatalf("expected the statements of the other keyspace to be cached, got %+v", stats)
+	}
+	if _, ok := p.keyspaces["ks1"]; ok {
+		t.Fatal("expected the keyspace not to be counted anymore")
+	}
+}
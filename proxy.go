@@ -0,0 +1,277 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProxyHostDialer is a HostDialer tunneling the connections to the hosts,
+// including the control connection, through SOCKS5 or HTTP CONNECT proxies.
+type ProxyHostDialer struct {
+	// Proxy returns the URL of the proxy to connect to host through, or nil
+	// to connect to the host directly. It is not called for the hosts
+	// connected to through a Unix domain socket. The scheme of the URL is socks5 or
+	// http, and its user info, if any, is used to authenticate to the proxy.
+	Proxy func(host *HostInfo) (*url.URL, error)
+
+	// Dialer dials the proxies, and the hosts connected to directly. A
+	// net.Dialer is used if nil.
+	Dialer Dialer
+
+	// TLSConfig, if not nil, is used to set up a TLS session with the host
+	// through the tunnel, see WrapTLS.
+	TLSConfig *tls.Config
+}
+
+// ProxyURL returns a ProxyHostDialer.Proxy function connecting to every host
+// through the proxy u.
+func ProxyURL(u *url.URL) func(*HostInfo) (*url.URL, error) {
+	return func(*HostInfo) (*url.URL, error) {
+		return u, nil
+	}
+}
+
+func (d *ProxyHostDialer) DialHost(ctx context.Context, host *HostInfo) (*DialedHost, error) {
+	ip := host.ConnectAddress()
+	port := host.Port()
+
+	if !validIpAddr(ip) && host.SocketPath() == "" {
+		return nil, fmt.Errorf("host missing connect ip address: %v", ip)
+	} else if port == 0 {
+		return nil, fmt.Errorf("host missing port: %v", port)
+	}
+
+	var proxy *url.URL
+	if d.Proxy != nil && host.SocketPath() == "" {
+		var err error
+		if proxy, err = d.Proxy(host); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	target := host.ConnectAddressAndPort()
+	if proxy == nil {
+		network, addr := "tcp", target
+		if path := host.SocketPath(); path != "" {
+			network, addr = "unix", path
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return WrapTLS(ctx, conn, host.HostnameAndPort(), d.TLSConfig)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	var r io.Reader = conn
+	switch proxy.Scheme {
+	case "socks5":
+		err = socks5Connect(conn, proxy.User, ip, port)
+	case "http":
+		r, err = httpConnect(conn, proxy, target)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("gocql: unable to connect to %s through proxy %s: %v", target, proxy.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	// report the address of the host rather than the proxy, it is used to
+	// identify the host the connection is established to.
+	tunnel := &proxyConn{Conn: conn, r: r, remoteAddr: &net.TCPAddr{IP: ip, Port: port}}
+	dialed, err := WrapTLS(ctx, tunnel, host.HostnameAndPort(), d.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	// write coalescing can only use writev on TCP connections.
+	dialed.DisableCoalesce = true
+	return dialed, nil
+}
+
+// proxyConn is a connection tunneled through a proxy.
+type proxyConn struct {
+	net.Conn
+	r          io.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+const (
+	socks5Version          = 5
+	socks5NoAuth           = 0
+	socks5UserPassAuth     = 2
+	socks5NoAcceptable     = 0xff
+	socks5CmdConnect       = 1
+	socks5AddrIPv4         = 1
+	socks5AddrDomain       = 3
+	socks5AddrIPv6         = 4
+	socks5UserPassVersion  = 1
+	socks5UserPassSuccess  = 0
+	socks5ReplySucceeded   = 0
+	socks5MaxCredentialLen = 255
+)
+
+// socks5Connect asks the SOCKS5 proxy at the other end of conn to connect to
+// ip and port, authenticating with user if not nil, as described in RFC 1928
+// and RFC 1929.
+func socks5Connect(conn net.Conn, user *url.Userinfo, ip net.IP, port int) error {
+	method := byte(socks5NoAuth)
+	if user != nil {
+		method = socks5UserPassAuth
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return err
+	}
+	if resp[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", resp[0])
+	} else if resp[1] == socks5NoAcceptable {
+		return errors.New("no acceptable SOCKS authentication method")
+	} else if resp[1] != method {
+		return fmt.Errorf("unexpected SOCKS authentication method %d", resp[1])
+	}
+
+	if method == socks5UserPassAuth {
+		username := user.Username()
+		password, _ := user.Password()
+		if len(username) > socks5MaxCredentialLen || len(password) > socks5MaxCredentialLen {
+			return errors.New("SOCKS username or password too long")
+		}
+		req := []byte{socks5UserPassVersion, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, resp[:]); err != nil {
+			return err
+		}
+		if resp[1] != socks5UserPassSuccess {
+			return errors.New("SOCKS authentication failed")
+		}
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socks5AddrIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socks5AddrIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return err
+	}
+	if head[1] != socks5ReplySucceeded {
+		return fmt.Errorf("SOCKS connect failed with reply %d", head[1])
+	}
+
+	// skip the address the proxy bound
+	var addrLen int
+	switch head[3] {
+	case socks5AddrIPv4:
+		addrLen = net.IPv4len
+	case socks5AddrIPv6:
+		addrLen = net.IPv6len
+	case socks5AddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		addrLen = int(n[0])
+	default:
+		return fmt.Errorf("unexpected SOCKS address type %d", head[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
+
+// httpConnect asks the HTTP proxy at the other end of conn to connect to target
+// with the CONNECT method. It returns the reader to read from the tunnel, which
+// holds the data sent by the host that was read with the response.
+func httpConnect(conn net.Conn, proxy *url.URL, target string) (io.Reader, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy responded %s", resp.Status)
+	}
+	return br, nil
+}
@@ -0,0 +1,229 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serveFakeProxy accepts a single connection on the returned listener, hands it to
+// handshake, which returns the requested target, and then echoes the data
+// sent through the tunnel.
+func serveFakeProxy(t *testing.T, handshake func(conn net.Conn, r *bufio.Reader) (string, error)) (net.Listener, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		target, err := handshake(conn, r)
+		if err != nil {
+			t.Errorf("proxy handshake: %v", err)
+			return
+		}
+		targets <- target
+		io.Copy(conn, r)
+	}()
+
+	return ln, targets
+}
+
+func socks5Handshake(user, password string) func(net.Conn, *bufio.Reader) (string, error) {
+	return func(conn net.Conn, r *bufio.Reader) (string, error) {
+		var head [2]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return "", err
+		}
+		methods := make([]byte, head[1])
+		if _, err := io.ReadFull(r, methods); err != nil {
+			return "", err
+		}
+
+		if user == "" {
+			if _, err := conn.Write([]byte{5, 0}); err != nil {
+				return "", err
+			}
+		} else {
+			if _, err := conn.Write([]byte{5, 2}); err != nil {
+				return "", err
+			}
+			var ver, n [1]byte
+			io.ReadFull(r, ver[:])
+			io.ReadFull(r, n[:])
+			u := make([]byte, n[0])
+			io.ReadFull(r, u)
+			io.ReadFull(r, n[:])
+			p := make([]byte, n[0])
+			if _, err := io.ReadFull(r, p); err != nil {
+				return "", err
+			}
+			status := byte(0)
+			if string(u) != user || string(p) != password {
+				status = 1
+			}
+			if _, err := conn.Write([]byte{1, status}); err != nil {
+				return "", err
+			} else if status != 0 {
+				return "", nil
+			}
+		}
+
+		var req [4]byte
+		if _, err := io.ReadFull(r, req[:]); err != nil {
+			return "", err
+		}
+		addr := make([]byte, net.IPv4len)
+		if req[3] == 4 {
+			addr = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return "", err
+		}
+		var port [2]byte
+		if _, err := io.ReadFull(r, port[:]); err != nil {
+			return "", err
+		}
+
+		if _, err := conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0}); err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(net.IP(addr).String(), strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+	}
+}
+
+func httpConnectHandshake(auth string) func(net.Conn, *bufio.Reader) (string, error) {
+	return func(conn net.Conn, r *bufio.Reader) (string, error) {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return "", err
+		}
+		if req.Method != http.MethodConnect {
+			conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+			return req.Method, nil
+		}
+		if req.Header.Get("Proxy-Authorization") != auth {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return req.Host, nil
+		}
+		if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+			return "", err
+		}
+		return req.Host, nil
+	}
+}
+
+func TestProxyHostDialer(t *testing.T) {
+	tests := []struct {
+		name      string
+		scheme    string
+		user      *url.Userinfo
+		handshake func(net.Conn, *bufio.Reader) (string, error)
+	}{
+		{"socks5", "socks5", nil, socks5Handshake("", "")},
+		{"socks5 auth", "socks5", url.UserPassword("cassandra", "secret"), socks5Handshake("cassandra", "secret")},
+		{"http", "http", nil, httpConnectHandshake("")},
+		{"http auth", "http", url.UserPassword("cassandra", "secret"), httpConnectHandshake("Basic Y2Fzc2FuZHJhOnNlY3JldA==")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ln, targets := serveFakeProxy(t, test.handshake)
+			defer ln.Close()
+			proxy := &url.URL{Scheme: test.scheme, Host: ln.Addr().String(), User: test.user}
+			dialer := &ProxyHostDialer{Proxy: ProxyURL(proxy)}
+
+			host := &HostInfo{connectAddress: net.IPv4(10, 0, 0, 1), port: 9042}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			dialed, err := dialer.DialHost(ctx, host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialed.Conn.Close()
+
+			if target := <-targets; target != "10.0.0.1:9042" {
+				t.Errorf("expected proxy to connect to 10.0.0.1:9042, got %q", target)
+			}
+			if remote := dialed.Conn.RemoteAddr().String(); remote != "10.0.0.1:9042" {
+				t.Errorf("expected remote address 10.0.0.1:9042, got %q", remote)
+			}
+			if !dialed.DisableCoalesce {
+				t.Error("expected write coalescing to be disabled")
+			}
+
+			if _, err := dialed.Conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(dialed.Conn, buf); err != nil {
+				t.Fatal(err)
+			} else if string(buf) != "ping" {
+				t.Errorf("expected to read back ping, got %q", buf)
+			}
+		})
+	}
+}
+
+func TestProxyHostDialerAuthFailure(t *testing.T) {
+	tests := []struct {
+		scheme    string
+		handshake func(net.Conn, *bufio.Reader) (string, error)
+	}{
+		{"socks5", socks5Handshake("cassandra", "secret")},
+		{"http", httpConnectHandshake("Basic Y2Fzc2FuZHJhOnNlY3JldA==")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scheme, func(t *testing.T) {
+			ln, _ := serveFakeProxy(t, test.handshake)
+			defer ln.Close()
+			proxy := &url.URL{Scheme: test.scheme, Host: ln.Addr().String(), User: url.UserPassword("cassandra", "wrong")}
+			dialer := &ProxyHostDialer{Proxy: ProxyURL(proxy)}
+
+			host := &HostInfo{connectAddress: net.IPv4(10, 0, 0, 1), port: 9042}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if dialed, err := dialer.DialHost(ctx, host); err == nil {
+				dialed.Conn.Close()
+				t.Fatal("expected dial through proxy to fail with wrong credentials")
+			}
+		})
+	}
+}
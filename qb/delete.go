@@ -0,0 +1,106 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package qb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// DeleteBuilder builds DELETE statements.
+type DeleteBuilder struct {
+	table    string
+	columns  []string
+	where    []Cmp
+	ifs      []Cmp
+	existing bool
+	using    using
+}
+
+// Delete returns a builder of DELETE statements deleting from table, which may
+// be qualified by its keyspace.
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+// Columns adds the columns to delete, the rows are deleted if none is added.
+func (b *DeleteBuilder) Columns(columns ...string) *DeleteBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Where adds comparisons to the WHERE clause.
+func (b *DeleteBuilder) Where(w ...Cmp) *DeleteBuilder {
+	b.where = append(b.where, w...)
+	return b
+}
+
+// If adds conditions to the IF clause, making the statement a lightweight
+// transaction.
+func (b *DeleteBuilder) If(w ...Cmp) *DeleteBuilder {
+	b.ifs = append(b.ifs, w...)
+	return b
+}
+
+// Existing only deletes the row if it exists, with IF EXISTS.
+func (b *DeleteBuilder) Existing() *DeleteBuilder {
+	b.existing = true
+	return b
+}
+
+// Timestamp sets the timestamp of the deletion.
+func (b *DeleteBuilder) Timestamp(t time.Time) *DeleteBuilder {
+	b.using.setTimestamp(t)
+	return b
+}
+
+// TimestampBind sets the timestamp of the deletion, in microseconds, with a
+// bind marker named _ts.
+func (b *DeleteBuilder) TimestampBind() *DeleteBuilder {
+	b.using.timestamp, b.using.hasTS = param("_ts"), true
+	return b
+}
+
+// ToCql implements Builder.
+func (b *DeleteBuilder) ToCql() (stmt string, names []string) {
+	var cql strings.Builder
+	cql.WriteString("DELETE ")
+	if len(b.columns) > 0 {
+		cql.WriteString(strings.Join(b.columns, ","))
+		cql.WriteByte(' ')
+	}
+	cql.WriteString("FROM ")
+	cql.WriteString(b.table)
+	names = b.using.writeCql(&cql)
+
+	names = append(names, writeCmps(&cql, " WHERE ", b.where)...)
+	if b.existing {
+		cql.WriteString(" IF EXISTS")
+	} else {
+		names = append(names, writeCmps(&cql, " IF ", b.ifs)...)
+	}
+	return cql.String(), names
+}
+
+// Query returns the query executing the statement with the values bound.
+func (b *DeleteBuilder) Query(s *gocql.Session, values ...interface{}) *gocql.Query {
+	return query(b, s, values)
+}
@@ -0,0 +1,124 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package qb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// InsertBuilder builds INSERT statements.
+type InsertBuilder struct {
+	table   string
+	columns []string
+	values  []value
+	unique  bool
+	using   using
+}
+
+// Insert returns a builder of INSERT statements writing table, which may be
+// qualified by its keyspace.
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+// Columns adds columns written with positional bind markers named after them.
+func (b *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	for _, column := range columns {
+		b.columns = append(b.columns, column)
+		b.values = append(b.values, param(column))
+	}
+	return b
+}
+
+// NamedColumn adds a column written with the named bind marker :name.
+func (b *InsertBuilder) NamedColumn(column, name string) *InsertBuilder {
+	b.columns = append(b.columns, column)
+	b.values = append(b.values, value{name: name, named: true})
+	return b
+}
+
+// LitColumn adds a column written with the CQL literal lit.
+func (b *InsertBuilder) LitColumn(column, lit string) *InsertBuilder {
+	b.columns = append(b.columns, column)
+	b.values = append(b.values, value{lit: lit})
+	return b
+}
+
+// Unique only inserts the row if it does not exist, with IF NOT EXISTS.
+func (b *InsertBuilder) Unique() *InsertBuilder {
+	b.unique = true
+	return b
+}
+
+// TTL sets the time to live of the values written.
+func (b *InsertBuilder) TTL(ttl time.Duration) *InsertBuilder {
+	b.using.setTTL(ttl)
+	return b
+}
+
+// TTLBind sets the time to live of the values written, in seconds, with a bind
+// marker named _ttl.
+func (b *InsertBuilder) TTLBind() *InsertBuilder {
+	b.using.ttl, b.using.hasTTL = param("_ttl"), true
+	return b
+}
+
+// Timestamp sets the timestamp of the values written.
+func (b *InsertBuilder) Timestamp(t time.Time) *InsertBuilder {
+	b.using.setTimestamp(t)
+	return b
+}
+
+// TimestampBind sets the timestamp of the values written, in microseconds,
+// with a bind marker named _ts.
+func (b *InsertBuilder) TimestampBind() *InsertBuilder {
+	b.using.timestamp, b.using.hasTS = param("_ts"), true
+	return b
+}
+
+// ToCql implements Builder.
+func (b *InsertBuilder) ToCql() (stmt string, names []string) {
+	var cql strings.Builder
+	cql.WriteString("INSERT INTO ")
+	cql.WriteString(b.table)
+	cql.WriteString(" (")
+	cql.WriteString(strings.Join(b.columns, ","))
+	cql.WriteString(") VALUES (")
+	for i, v := range b.values {
+		if i > 0 {
+			cql.WriteByte(',')
+		}
+		names = append(names, v.writeCql(&cql)...)
+	}
+	cql.WriteByte(')')
+
+	if b.unique {
+		cql.WriteString(" IF NOT EXISTS")
+	}
+	names = append(names, b.using.writeCql(&cql)...)
+	return cql.String(), names
+}
+
+// Query returns the query executing the statement with the values bound.
+func (b *InsertBuilder) Query(s *gocql.Session, values ...interface{}) *gocql.Query {
+	return query(b, s, values)
+}
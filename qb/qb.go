@@ -0,0 +1,203 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package qb builds CQL statements and the gocql queries executing them.
+//
+//	stmt, names := qb.Select("ks.users").
+//		Columns("id", "name").
+//		Where(qb.Eq("id")).
+//		ToCql()
+//	// stmt: SELECT id,name FROM ks.users WHERE id=?
+//	// names: [id]
+//
+// Bind markers are positional and named after the column they are compared to
+// or assigned by default. They can be given another name, or be named markers
+// bound with gocql.NamedValue, but positional and named markers cannot be mixed
+// in a statement:
+//
+//	q := qb.Update("ks.users").
+//		Set("name").
+//		Where(qb.Eq("id")).
+//		If(qb.Eq("name").Bind("old_name")).
+//		Query(session, "new", id, "old")
+//
+// Comparisons with literals replace the bind marker by a CQL literal, which is
+// not escaped:
+//
+//	qb.Select("ks.events").Where(qb.Eq("day").Lit("'2024-01-01'"))
+package qb
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Builder builds a CQL statement.
+type Builder interface {
+	// ToCql returns the statement and the names of its bind markers.
+	ToCql() (stmt string, names []string)
+}
+
+func query(b Builder, s *gocql.Session, values []interface{}) *gocql.Query {
+	stmt, _ := b.ToCql()
+	return s.Query(stmt, values...)
+}
+
+// value is a bind marker or a literal.
+type value struct {
+	name  string
+	named bool
+	lit   string
+}
+
+func param(name string) value {
+	return value{name: name}
+}
+
+func (v value) writeCql(cql *strings.Builder) []string {
+	switch {
+	case v.lit != "":
+		cql.WriteString(v.lit)
+		return nil
+	case v.named:
+		cql.WriteByte(':')
+		cql.WriteString(v.name)
+	default:
+		cql.WriteByte('?')
+	}
+	return []string{v.name}
+}
+
+// Cmp is a comparison of a column in a WHERE or IF clause.
+type Cmp struct {
+	column string
+	op     string
+	value  value
+}
+
+func cmp(column, op string) Cmp {
+	return Cmp{column: column, op: op, value: param(column)}
+}
+
+// Eq compares column = value.
+func Eq(column string) Cmp { return cmp(column, "=") }
+
+// Ne compares column != value, only valid in IF clauses.
+func Ne(column string) Cmp { return cmp(column, "!=") }
+
+// Lt compares column < value.
+func Lt(column string) Cmp { return cmp(column, "<") }
+
+// LtOrEq compares column <= value.
+func LtOrEq(column string) Cmp { return cmp(column, "<=") }
+
+// Gt compares column > value.
+func Gt(column string) Cmp { return cmp(column, ">") }
+
+// GtOrEq compares column >= value.
+func GtOrEq(column string) Cmp { return cmp(column, ">=") }
+
+// In compares column IN value, the value bound being a slice.
+func In(column string) Cmp { return cmp(column, " IN ") }
+
+// Contains compares column CONTAINS value.
+func Contains(column string) Cmp { return cmp(column, " CONTAINS ") }
+
+// ContainsKey compares column CONTAINS KEY value.
+func ContainsKey(column string) Cmp { return cmp(column, " CONTAINS KEY ") }
+
+// Like compares column LIKE value.
+func Like(column string) Cmp { return cmp(column, " LIKE ") }
+
+// Bind returns the comparison with a positional bind marker named name,
+// for example to compare a column to two values.
+func (c Cmp) Bind(name string) Cmp {
+	c.value = value{name: name}
+	return c
+}
+
+// Named returns the comparison with the named bind marker :name.
+func (c Cmp) Named(name string) Cmp {
+	c.value = value{name: name, named: true}
+	return c
+}
+
+// Lit returns the comparison with the CQL literal lit instead of a bind marker.
+func (c Cmp) Lit(lit string) Cmp {
+	c.value = value{lit: lit}
+	return c
+}
+
+func (c Cmp) writeCql(cql *strings.Builder) []string {
+	cql.WriteString(c.column)
+	cql.WriteString(c.op)
+	return c.value.writeCql(cql)
+}
+
+func writeCmps(cql *strings.Builder, clause string, cmps []Cmp) []string {
+	if len(cmps) == 0 {
+		return nil
+	}
+	var names []string
+	cql.WriteString(clause)
+	for i, c := range cmps {
+		if i > 0 {
+			cql.WriteString(" AND ")
+		}
+		names = append(names, c.writeCql(cql)...)
+	}
+	return names
+}
+
+// using is the USING clause of INSERT, UPDATE and DELETE statements.
+type using struct {
+	ttl       value
+	hasTTL    bool
+	timestamp value
+	hasTS     bool
+}
+
+func (u *using) setTTL(ttl time.Duration) {
+	u.ttl = value{lit: strconv.FormatInt(int64(ttl/time.Second), 10)}
+	u.hasTTL = true
+}
+
+func (u *using) setTimestamp(t time.Time) {
+	u.timestamp = value{lit: strconv.FormatInt(t.UnixNano()/1000, 10)}
+	u.hasTS = true
+}
+
+func (u *using) writeCql(cql *strings.Builder) []string {
+	var names []string
+	if u.hasTTL {
+		cql.WriteString(" USING TTL ")
+		names = append(names, u.ttl.writeCql(cql)...)
+	}
+	if u.hasTS {
+		if u.hasTTL {
+			cql.WriteString(" AND TIMESTAMP ")
+		} else {
+			cql.WriteString(" USING TIMESTAMP ")
+		}
+		names = append(names, u.timestamp.writeCql(cql)...)
+	}
+	return names
+}
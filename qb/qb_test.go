@@ -0,0 +1,106 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package qb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuilders(t *testing.T) {
+	ts := time.Unix(1, 0)
+	tests := []struct {
+		name  string
+		b     Builder
+		stmt  string
+		names []string
+	}{
+		{
+			name: "select all",
+			b:    Select("ks.t"),
+			stmt: "SELECT * FROM ks.t",
+		},
+		{
+			name: "select",
+			b: Select("ks.t").Columns("a", "b").
+				Where(Eq("k"), Gt("c").Bind("c_min"), LtOrEq("c").Bind("c_max"), In("d")).
+				OrderBy("c", DESC).
+				PerPartitionLimit(2).
+				Limit(10).
+				AllowFiltering(),
+			stmt:  "SELECT a,b FROM ks.t WHERE k=? AND c>? AND c<=? AND d IN ? ORDER BY c DESC PER PARTITION LIMIT 2 LIMIT 10 ALLOW FILTERING",
+			names: []string{"k", "c_min", "c_max", "d"},
+		},
+		{
+			name:  "select distinct",
+			b:     Select("t").Distinct().Columns("k").Where(Contains("tags").Lit("'a'"), ContainsKey("m").Named("key")),
+			stmt:  "SELECT DISTINCT k FROM t WHERE tags CONTAINS 'a' AND m CONTAINS KEY :key",
+			names: []string{"key"},
+		},
+		{
+			name:  "insert",
+			b:     Insert("ks.t").Columns("k", "v").LitColumn("at", "toTimestamp(now())").Unique().TTLBind().TimestampBind(),
+			stmt:  "INSERT INTO ks.t (k,v,at) VALUES (?,?,toTimestamp(now())) IF NOT EXISTS USING TTL ? AND TIMESTAMP ?",
+			names: []string{"k", "v", "_ttl", "_ts"},
+		},
+		{
+			name:  "insert named",
+			b:     Insert("t").NamedColumn("k", "id").Timestamp(ts),
+			stmt:  "INSERT INTO t (k) VALUES (:id) USING TIMESTAMP 1000000",
+			names: []string{"id"},
+		},
+		{
+			name:  "update",
+			b:     Update("ks.t").TTL(time.Minute).Set("v").Add("n").Remove("s").SetLit("w", "null").Where(Eq("k")).If(Eq("v").Bind("old_v"), Ne("w")),
+			stmt:  "UPDATE ks.t USING TTL 60 SET v=?,n=n+?,s=s-?,w=null WHERE k=? IF v=? AND w!=?",
+			names: []string{"v", "n", "s", "k", "old_v", "w"},
+		},
+		{
+			name:  "update existing",
+			b:     Update("t").SetNamed("v", "value").Where(Eq("k").Named("key")).Existing(),
+			stmt:  "UPDATE t SET v=:value WHERE k=:key IF EXISTS",
+			names: []string{"value", "key"},
+		},
+		{
+			name:  "delete",
+			b:     Delete("ks.t").Where(Eq("k")).TimestampBind().Existing(),
+			stmt:  "DELETE FROM ks.t USING TIMESTAMP ? WHERE k=? IF EXISTS",
+			names: []string{"_ts", "k"},
+		},
+		{
+			name:  "delete columns",
+			b:     Delete("t").Columns("a", "b").Where(Eq("k"), Like("c")).If(Lt("n")),
+			stmt:  "DELETE a,b FROM t WHERE k=? AND c LIKE ? IF n<?",
+			names: []string{"k", "c", "n"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stmt, names := test.b.ToCql()
+			if stmt != test.stmt {
+				t.Errorf("got statement %q, expected %q", stmt, test.stmt)
+			}
+			if !reflect.DeepEqual(names, test.names) {
+				t.Errorf("got names %q, expected %q", names, test.names)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package qb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// Order is the order of the rows returned by a SELECT statement.
+type Order bool
+
+const (
+	// ASC orders the rows by ascending values.
+	ASC Order = true
+	// DESC orders the rows by descending values.
+	DESC Order = false
+)
+
+func (o Order) String() string {
+	if o {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// SelectBuilder builds SELECT statements.
+type SelectBuilder struct {
+	table             string
+	columns           []string
+	distinct          bool
+	where             []Cmp
+	orderBy           []string
+	limit             uint
+	perPartitionLimit uint
+	allowFiltering    bool
+}
+
+// Select returns a builder of SELECT statements reading table, which may be
+// qualified by its keyspace.
+func Select(table string) *SelectBuilder {
+	return &SelectBuilder{table: table}
+}
+
+// Columns adds the columns to read, all columns are read if none is added.
+// Columns may be selectors like COUNT(*) or WRITETIME(name).
+func (b *SelectBuilder) Columns(columns ...string) *SelectBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Distinct reads the distinct partition keys.
+func (b *SelectBuilder) Distinct() *SelectBuilder {
+	b.distinct = true
+	return b
+}
+
+// Where adds comparisons to the WHERE clause.
+func (b *SelectBuilder) Where(w ...Cmp) *SelectBuilder {
+	b.where = append(b.where, w...)
+	return b
+}
+
+// OrderBy orders the rows by the clustering column.
+func (b *SelectBuilder) OrderBy(column string, o Order) *SelectBuilder {
+	b.orderBy = append(b.orderBy, column+" "+o.String())
+	return b
+}
+
+// Limit limits the number of rows read.
+func (b *SelectBuilder) Limit(n uint) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+// PerPartitionLimit limits the number of rows read in each partition.
+func (b *SelectBuilder) PerPartitionLimit(n uint) *SelectBuilder {
+	b.perPartitionLimit = n
+	return b
+}
+
+// AllowFiltering allows comparisons requiring to filter the rows read.
+func (b *SelectBuilder) AllowFiltering() *SelectBuilder {
+	b.allowFiltering = true
+	return b
+}
+
+// ToCql implements Builder.
+func (b *SelectBuilder) ToCql() (stmt string, names []string) {
+	var cql strings.Builder
+	cql.WriteString("SELECT ")
+	if b.distinct {
+		cql.WriteString("DISTINCT ")
+	}
+	if len(b.columns) == 0 {
+		cql.WriteByte('*')
+	} else {
+		cql.WriteString(strings.Join(b.columns, ","))
+	}
+	cql.WriteString(" FROM ")
+	cql.WriteString(b.table)
+
+	names = writeCmps(&cql, " WHERE ", b.where)
+
+	if len(b.orderBy) > 0 {
+		cql.WriteString(" ORDER BY ")
+		cql.WriteString(strings.Join(b.orderBy, ","))
+	}
+	if b.perPartitionLimit > 0 {
+		cql.WriteString(" PER PARTITION LIMIT ")
+		cql.WriteString(strconv.FormatUint(uint64(b.perPartitionLimit), 10))
+	}
+	if b.limit > 0 {
+		cql.WriteString(" LIMIT ")
+		cql.WriteString(strconv.FormatUint(uint64(b.limit), 10))
+	}
+	if b.allowFiltering {
+		cql.WriteString(" ALLOW FILTERING")
+	}
+	return cql.String(), names
+}
+
+// Query returns the query executing the statement with the values bound.
+func (b *SelectBuilder) Query(s *gocql.Session, values ...interface{}) *gocql.Query {
+	return query(b, s, values).Idempotent(true)
+}
@@ -0,0 +1,160 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package qb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// assignment is an assignment of the SET clause of UPDATE statements.
+type assignment struct {
+	column string
+	op     string
+	value  value
+}
+
+// UpdateBuilder builds UPDATE statements.
+type UpdateBuilder struct {
+	table    string
+	set      []assignment
+	where    []Cmp
+	ifs      []Cmp
+	existing bool
+	using    using
+}
+
+// Update returns a builder of UPDATE statements writing table, which may be
+// qualified by its keyspace.
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set adds the assignments column = value with positional bind markers named
+// after the columns.
+func (b *UpdateBuilder) Set(columns ...string) *UpdateBuilder {
+	for _, column := range columns {
+		b.set = append(b.set, assignment{column: column, op: "=", value: param(column)})
+	}
+	return b
+}
+
+// SetNamed adds the assignment column = :name.
+func (b *UpdateBuilder) SetNamed(column, name string) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, op: "=", value: value{name: name, named: true}})
+	return b
+}
+
+// SetLit adds the assignment column = lit, lit being a CQL literal.
+func (b *UpdateBuilder) SetLit(column, lit string) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, op: "=", value: value{lit: lit}})
+	return b
+}
+
+// Add adds the assignment column = column + value, to increment counters or
+// add elements to collections.
+func (b *UpdateBuilder) Add(column string) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, op: "=" + column + "+", value: param(column)})
+	return b
+}
+
+// Remove adds the assignment column = column - value, to decrement counters or
+// remove elements from collections.
+func (b *UpdateBuilder) Remove(column string) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, op: "=" + column + "-", value: param(column)})
+	return b
+}
+
+// Where adds comparisons to the WHERE clause.
+func (b *UpdateBuilder) Where(w ...Cmp) *UpdateBuilder {
+	b.where = append(b.where, w...)
+	return b
+}
+
+// If adds conditions to the IF clause, making the statement a lightweight
+// transaction.
+func (b *UpdateBuilder) If(w ...Cmp) *UpdateBuilder {
+	b.ifs = append(b.ifs, w...)
+	return b
+}
+
+// Existing only updates the row if it exists, with IF EXISTS.
+func (b *UpdateBuilder) Existing() *UpdateBuilder {
+	b.existing = true
+	return b
+}
+
+// TTL sets the time to live of the values written.
+func (b *UpdateBuilder) TTL(ttl time.Duration) *UpdateBuilder {
+	b.using.setTTL(ttl)
+	return b
+}
+
+// TTLBind sets the time to live of the values written, in seconds, with a bind
+// marker named _ttl.
+func (b *UpdateBuilder) TTLBind() *UpdateBuilder {
+	b.using.ttl, b.using.hasTTL = param("_ttl"), true
+	return b
+}
+
+// Timestamp sets the timestamp of the values written.
+func (b *UpdateBuilder) Timestamp(t time.Time) *UpdateBuilder {
+	b.using.setTimestamp(t)
+	return b
+}
+
+// TimestampBind sets the timestamp of the values written, in microseconds,
+// with a bind marker named _ts.
+func (b *UpdateBuilder) TimestampBind() *UpdateBuilder {
+	b.using.timestamp, b.using.hasTS = param("_ts"), true
+	return b
+}
+
+// ToCql implements Builder.
+func (b *UpdateBuilder) ToCql() (stmt string, names []string) {
+	var cql strings.Builder
+	cql.WriteString("UPDATE ")
+	cql.WriteString(b.table)
+	names = b.using.writeCql(&cql)
+
+	cql.WriteString(" SET ")
+	for i, a := range b.set {
+		if i > 0 {
+			cql.WriteByte(',')
+		}
+		cql.WriteString(a.column)
+		cql.WriteString(a.op)
+		names = append(names, a.value.writeCql(&cql)...)
+	}
+
+	names = append(names, writeCmps(&cql, " WHERE ", b.where)...)
+	if b.existing {
+		cql.WriteString(" IF EXISTS")
+	} else {
+		names = append(names, writeCmps(&cql, " IF ", b.ifs)...)
+	}
+	return cql.String(), names
+}
+
+// Query returns the query executing the statement with the values bound.
+func (b *UpdateBuilder) Query(s *gocql.Session, values ...interface{}) *gocql.Query {
+	return query(b, s, values)
+}
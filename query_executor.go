@@ -26,10 +26,78 @@ package gocql
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
 
+// ErrDeadlineTooShort is matched by the DeadlineTooShortError returned when the
+// deadline of the context of a query or batch leaves too little time for
+// another attempt.
+var ErrDeadlineTooShort = errors.New("gocql: context deadline too short for another attempt")
+
+// DeadlineTooShortError is returned instead of retrying a query or batch when
+// the time left before the deadline of its context is shorter than the
+// expected latency of the attempt, which would most likely be cancelled. It
+// matches ErrDeadlineTooShort and unwraps to the error of the last attempt.
+type DeadlineTooShortError struct {
+	// Remaining is the time which was left before the deadline.
+	Remaining time.Duration
+	// Expected is the expected latency of the attempt.
+	Expected time.Duration
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *DeadlineTooShortError) Error() string {
+	return fmt.Sprintf("gocql: context deadline too short for another attempt (%v left, %v expected): %v",
+		e.Remaining, e.Expected, e.Err)
+}
+
+func (e *DeadlineTooShortError) Is(target error) bool {
+	return target == ErrDeadlineTooShort
+}
+
+func (e *DeadlineTooShortError) Unwrap() error {
+	return e.Err
+}
+
+// expectedLatency returns the latency expected from another attempt of qry
+// after one sent to host: the one expected by sp if it is a
+// QuerySpeculativeExecutionPolicy which knows it, measured over many more
+// attempts than qry made, or else the average latency of the previous attempts
+// of qry.
+func expectedLatency(qry ExecutableQuery, sp SpeculativeExecutionPolicy, host *HostInfo) (time.Duration, bool) {
+	if p, ok := sp.(QuerySpeculativeExecutionPolicy); ok {
+		if latency, ok := p.ExpectedLatency(qry, host); ok {
+			return latency, true
+		}
+	}
+	if q, ok := qry.(interface{ Latency() int64 }); ok {
+		if latency := q.Latency(); latency > 0 {
+			return time.Duration(latency), true
+		}
+	}
+	return 0, false
+}
+
+// deadlineTooShort returns the time left before the deadline of ctx if it is
+// shorter than the expected latency of another attempt of qry after one sent
+// to host.
+func deadlineTooShort(ctx context.Context, qry ExecutableQuery, sp SpeculativeExecutionPolicy, host *HostInfo) (remaining, expected time.Duration, tooShort bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, 0, false
+	}
+	expected, ok = expectedLatency(qry, sp, host)
+	if !ok {
+		return 0, 0, false
+	}
+	remaining = time.Until(deadline)
+	return remaining, expected, remaining < expected
+}
+
 type ExecutableQuery interface {
 	borrowForExecution()    // Used to ensure that the query stays alive for lifetime of a particular execution goroutine.
 	releaseAfterExecution() // Used when a goroutine finishes its execution attempts, either with ok result or an error.
@@ -38,6 +106,7 @@ type ExecutableQuery interface {
 	retryPolicy() RetryPolicy
 	speculativeExecutionPolicy() SpeculativeExecutionPolicy
 	GetRoutingKey() ([]byte, error)
+	GetHost() *HostInfo
 	Keyspace() string
 	Table() string
 	IsIdempotent() bool
@@ -50,6 +119,31 @@ type ExecutableQuery interface {
 type queryExecutor struct {
 	pool   *policyConnPool
 	policy HostSelectionPolicy
+	// throttler paces the attempts by the overload hints of the servers, nil
+	// if not configured.
+	throttler *backpressureThrottler
+	// retryBudget bounds the retries to a ratio of the successful attempts,
+	// nil if not configured.
+	retryBudget *retryBudget
+	// warnings handles the warnings of the responses, nil if not configured.
+	warnings WarningHandler
+}
+
+// checkStale pings conn when it did not receive a response for longer than
+// ConnStaleTimeout, closing it if the ping fails.
+func (q *queryExecutor) checkStale(ctx context.Context, conn *Conn) error {
+	staleTimeout := q.pool.session.cfg.ConnStaleTimeout
+	if staleTimeout <= 0 || time.Since(conn.lastResponse()) < staleTimeout {
+		return nil
+	}
+
+	if err := conn.ping(ctx); err != nil {
+		if ctx.Err() == nil {
+			conn.closeWithError(err)
+		}
+		return err
+	}
+	return nil
 }
 
 func (q *queryExecutor) attemptQuery(ctx context.Context, qry ExecutableQuery, conn *Conn) *Iter {
@@ -63,13 +157,18 @@ func (q *queryExecutor) attemptQuery(ctx context.Context, qry ExecutableQuery, c
 }
 
 func (q *queryExecutor) speculate(ctx context.Context, qry ExecutableQuery, sp SpeculativeExecutionPolicy,
-	hostIter NextHost, results chan *Iter) *Iter {
-	ticker := time.NewTicker(sp.Delay())
+	firstHost *HostInfo, hostIter NextHost, results chan *Iter) *Iter {
+	ticker := time.NewTicker(speculativeDelay(sp, qry, firstHost))
 	defer ticker.Stop()
 
 	for i := 0; i < sp.Attempts(); i++ {
 		select {
 		case <-ticker.C:
+			if _, _, tooShort := deadlineTooShort(ctx, qry, sp, firstHost); tooShort {
+				// the attempt would not complete before the deadline, wait
+				// for the ones already running.
+				return nil
+			}
 			qry.borrowForExecution() // ensure liveness in case of executing Query to prevent races with Query.Release().
 			go q.run(ctx, qry, hostIter, results)
 		case <-ctx.Done():
@@ -83,15 +182,40 @@ func (q *queryExecutor) speculate(ctx context.Context, qry ExecutableQuery, sp S
 }
 
 func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
-	hostIter := q.policy.Pick(qry)
+	// a query pinned to a host bypasses the host selection policy, it is
+	// only ever sent to that host and is never executed speculatively as
+	// there is no other host to speculate on.
+	pinnedHost := qry.GetHost()
+
+	var hostIter NextHost
+	if pinnedHost != nil {
+		hostIter = q.pinnedHostIter(pinnedHost)
+	} else {
+		hostIter = q.policy.Pick(qry)
+		if qry, ok := qry.(*Query); ok && len(qry.failedHosts) > 0 {
+			hostIter = deferHosts(hostIter, func(host *HostInfo) bool {
+				return containsHost(qry.failedHosts, host)
+			})
+		}
+	}
 
 	// check if the query is not marked as idempotent, if
 	// it is, we force the policy to NonSpeculative
 	sp := qry.speculativeExecutionPolicy()
-	if !qry.IsIdempotent() || sp.Attempts() == 0 {
+	if !qry.IsIdempotent() || sp.Attempts() == 0 || pinnedHost != nil {
 		return q.do(qry.Context(), qry, hostIter), nil
 	}
 
+	// the host of the main execution is picked here so that the delay of the
+	// speculative executions can depend on it.
+	var firstHost *HostInfo
+	if _, ok := sp.(QuerySpeculativeExecutionPolicy); ok {
+		if first := hostIter(); first != nil {
+			firstHost = first.Info()
+			hostIter = prependHost(first, hostIter)
+		}
+	}
+
 	// When speculative execution is enabled, we could be accessing the host iterator from multiple goroutines below.
 	// To ensure we don't call it concurrently, we wrap the returned NextHost function here to synchronize access to it.
 	var mu sync.Mutex
@@ -114,7 +238,7 @@ func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
 	// The speculative executions are launched _in addition_ to the main
 	// execution, on a timer. So Speculation{2} would make 3 executions running
 	// in total.
-	if iter := q.speculate(ctx, qry, sp, hostIter, results); iter != nil {
+	if iter := q.speculate(ctx, qry, sp, firstHost, hostIter, results); iter != nil {
 		return iter, nil
 	}
 
@@ -126,6 +250,64 @@ func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
 	}
 }
 
+// prependHost returns a NextHost which yields host and then the hosts of
+// hostIter.
+func prependHost(host SelectedHost, hostIter NextHost) NextHost {
+	return func() SelectedHost {
+		if host != nil {
+			first := host
+			host = nil
+			return first
+		}
+		return hostIter()
+	}
+}
+
+// containsHost reports whether host is one of hosts, comparing their host IDs
+// if known and otherwise their addresses and ports.
+func containsHost(hosts []*HostInfo, host *HostInfo) bool {
+	if host == nil {
+		return false
+	}
+	for _, h := range hosts {
+		if id := h.HostID(); id != "" {
+			if id == host.HostID() {
+				return true
+			}
+		} else if h.Equal(host) && h.Port() == host.Port() {
+			return true
+		}
+	}
+	return false
+}
+
+// pinnedConn returns the connection qry is pinned to, nil if it is not pinned
+// to a connection.
+func pinnedConn(qry ExecutableQuery) *Conn {
+	if qry, ok := qry.(*Query); ok {
+		return qry.pinnedConn
+	}
+	return nil
+}
+
+// pinnedHostIter returns a NextHost which yields the given host exactly once.
+// The host known to the session ring is preferred over the supplied one so that
+// the current host state is used.
+func (q *queryExecutor) pinnedHostIter(host *HostInfo) NextHost {
+	if ringHost := q.pool.session.ring.getHost(host.HostID()); ringHost != nil {
+		host = ringHost
+	}
+
+	returned := false
+	return func() SelectedHost {
+		if returned {
+			return nil
+		}
+		returned = true
+		return (*selectedHost)(host)
+	}
+}
+
 func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter NextHost) *Iter {
 	selectedHost := hostIter()
 	rt := qry.retryPolicy()
@@ -145,14 +327,50 @@ func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter Ne
 			continue
 		}
 
-		conn := pool.Pick()
+		conn := pinnedConn(qry)
+		if conn == nil {
+			conn = pool.Pick()
+		} else if conn.Closed() {
+			lastErr = ErrConnectionClosed
+			selectedHost = hostIter()
+			continue
+		}
 		if conn == nil {
 			selectedHost = hostIter()
 			continue
 		}
 
+		if err := q.checkStale(ctx, conn); err != nil {
+			if ctx.Err() != nil {
+				return &Iter{err: ctx.Err()}
+			}
+			// the connection is dead, the query was not sent.
+			lastErr = err
+			selectedHost = hostIter()
+			continue
+		}
+
+		if err := q.throttler.wait(ctx); err != nil {
+			return &Iter{err: err}
+		}
+
+		if err := pool.acquireRequest(ctx); err == ErrHostOverloaded {
+			// the query was not sent, try the next host without involving
+			// the retry policy.
+			lastErr = err
+			selectedHost = hostIter()
+			continue
+		} else if err != nil {
+			return &Iter{err: err}
+		}
 		iter = q.attemptQuery(ctx, qry, conn)
+		pool.releaseRequest()
+		q.throttler.observe(iter)
 		iter.host = selectedHost.Info()
+		iter.conn = conn
+		if warnings := iter.Warnings(); len(warnings) > 0 && q.warnings != nil {
+			q.warnings.HandleWarnings(qry, iter.host, warnings)
+		}
 		// Update host
 		switch iter.err {
 		case context.Canceled, context.DeadlineExceeded, ErrNotFound:
@@ -164,6 +382,10 @@ func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter Ne
 			selectedHost.Mark(iter.err)
 		}
 
+		if iter.err == nil {
+			q.retryBudget.deposit()
+		}
+
 		// Exit if the query was successful
 		// or no retry policy defined or retry attempts were reached
 		if iter.err == nil || rt == nil || !rt.Attempt(qry) {
@@ -172,7 +394,19 @@ func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter Ne
 		lastErr = iter.err
 
 		// If query is unsuccessful, check the error with RetryPolicy to retry
-		switch rt.GetRetryType(iter.err) {
+		retryType := rt.GetRetryType(iter.err)
+		if retryType == Retry || retryType == RetryNextHost {
+			if remaining, expected, tooShort := deadlineTooShort(ctx, qry, qry.speculativeExecutionPolicy(), host); tooShort {
+				return &Iter{err: &DeadlineTooShortError{Remaining: remaining, Expected: expected, Err: iter.err}, host: iter.host}
+			}
+			if !q.retryBudget.withdraw() {
+				return &Iter{err: &RetryBudgetExhaustedError{Err: iter.err}, host: iter.host}
+			}
+			if d, ok := rt.(consistencyDowngrader); ok {
+				d.downgrade(qry, iter.err)
+			}
+		}
+		switch retryType {
 		case Retry:
 			// retry on the same host
 			continue
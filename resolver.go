@@ -0,0 +1,64 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// ContactPointResolver resolves the contact points of a cluster, see
+// ClusterConfig.ContactPointResolver.
+type ContactPointResolver interface {
+	// ResolveContactPoints returns the addresses of the contact points, in the
+	// format of ClusterConfig.Hosts.
+	ResolveContactPoints(ctx context.Context) ([]string, error)
+}
+
+// SRVResolver is a ContactPointResolver looking up the contact points in the
+// DNS SRV records of Service, Proto and Name, as net.LookupSRV. For example
+// SRVResolver{Service: "cql", Proto: "tcp", Name: "example.com"} looks up
+// _cql._tcp.example.com.
+type SRVResolver struct {
+	Service string
+	Proto   string
+	Name    string
+
+	// Resolver is used to look up the records, net.DefaultResolver if nil.
+	Resolver *net.Resolver
+}
+
+func (r SRVResolver) ResolveContactPoints(ctx context.Context) ([]string, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, r.Service, r.Proto, r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(records))
+	for _, record := range records {
+		addrs = append(addrs, JoinHostPort(strings.TrimSuffix(record.Target, "."), int(record.Port)))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,144 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// RetryBudgetConfig configures the retry budget of a session, see
+// ClusterConfig.RetryBudget.
+//
+// The budget is a token bucket: every successful attempt deposits Ratio tokens
+// and every retry withdraws one, so that retries are bounded to about Ratio
+// times the successful requests, plus a burst of MaxTokens.
+type RetryBudgetConfig struct {
+	// Ratio is the number of retries allowed per successful attempt.
+	// Default: 0.1
+	Ratio float64
+
+	// MaxTokens is the size of the bucket, the number of retries allowed in
+	// a burst. The bucket starts full.
+	// Default: 100
+	MaxTokens float64
+}
+
+// ErrRetryBudgetExhausted is matched by the RetryBudgetExhaustedError
+// returned when a retry is shed by the retry budget of the session.
+var ErrRetryBudgetExhausted = errors.New("gocql: retry budget exhausted")
+
+// RetryBudgetExhaustedError is returned instead of retrying a query or batch
+// when the retry budget of the session is exhausted. It matches
+// ErrRetryBudgetExhausted and unwraps to the error of the last attempt.
+type RetryBudgetExhaustedError struct {
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *RetryBudgetExhaustedError) Error() string {
+	return fmt.Sprintf("gocql: retry budget exhausted: %v", e.Err)
+}
+
+func (e *RetryBudgetExhaustedError) Is(target error) bool {
+	return target == ErrRetryBudgetExhausted
+}
+
+func (e *RetryBudgetExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// RetryBudgetStats are the counters of the retry budget of a session.
+type RetryBudgetStats struct {
+	// Tokens is the number of retries currently allowed.
+	Tokens float64
+	// Retries is the number of retries allowed by the budget.
+	Retries int64
+	// Shed is the number of retries shed by the budget.
+	Shed int64
+}
+
+// RetryBudgetStats returns the counters of the retry budget of the session,
+// which are zero if ClusterConfig.RetryBudget is not set.
+func (s *Session) RetryBudgetStats() RetryBudgetStats {
+	return s.executor.retryBudget.stats()
+}
+
+// retryBudget bounds the retries of a session to a ratio of its successful
+// attempts.
+type retryBudget struct {
+	cfg RetryBudgetConfig
+
+	mu      sync.Mutex
+	tokens  float64
+	retries int64
+	shed    int64
+}
+
+func newRetryBudget(cfg RetryBudgetConfig) *retryBudget {
+	if cfg.Ratio <= 0 {
+		cfg.Ratio = 0.1
+	}
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = 100
+	}
+	return &retryBudget{cfg: cfg, tokens: cfg.MaxTokens}
+}
+
+// deposit adds the tokens of a successful attempt.
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.tokens += b.cfg.Ratio
+	if b.tokens > b.cfg.MaxTokens {
+		b.tokens = b.cfg.MaxTokens
+	}
+	b.mu.Unlock()
+}
+
+// withdraw reports whether a retry is allowed, withdrawing its token.
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		b.shed++
+		return false
+	}
+	b.tokens--
+	b.retries++
+	return true
+}
+
+func (b *retryBudget) stats() RetryBudgetStats {
+	if b == nil {
+		return RetryBudgetStats{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return RetryBudgetStats{Tokens: b.tokens, Retries: b.retries, Shed: b.shed}
+}
@@ -0,0 +1,70 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+/*
+ * Content before git sha 34fdeebefcbf183ed7f916f931aa0586fdaa1b40
+ * Copyright (c) 2016, The Gocql authors,
+ * provided under the BSD-3-Clause License.
+ * See the NOTICE file distributed with this work for additional information.
+ */
+
+package gocql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(RetryBudgetConfig{Ratio: 0.5, MaxTokens: 2})
+
+	for i := 0; i < 2; i++ {
+		if !b.withdraw() {
+			t.Fatalf("retry %d: expected the burst to be allowed", i)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("expected the retry to be shed once the bucket is empty")
+	}
+
+	// two successful attempts earn a retry
+	b.deposit()
+	if b.withdraw() {
+		t.Fatal("expected half a token not to allow a retry")
+	}
+	b.deposit()
+	if !b.withdraw() {
+		t.Fatal("expected the retry earned by successful attempts to be allowed")
+	}
+
+	for i := 0; i < 10; i++ {
+		b.deposit()
+	}
+	if stats := b.stats(); stats != (RetryBudgetStats{Tokens: 2, Retries: 3, Shed: 2}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	var nilBudget *retryBudget
+	if !nilBudget.withdraw() || nilBudget.stats() != (RetryBudgetStats{}) {
+		t.Fatal("expected a nil budget to allow every retry")
+	}
+
+	err := &RetryBudgetExhaustedError{Err: ErrTimeoutNoResponse}
+	if !errors.Is(err, ErrRetryBudgetExhausted) || !errors.Is(err, ErrTimeoutNoResponse) {
+		t.Fatalf("expected %v to match the budget and last attempt errors", err)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type ring struct {
@@ -35,6 +36,10 @@ type ring struct {
 	// to in the case it can not reach any of its hosts. They are also used to boot
 	// strap the initial connection.
 	endpoints []*HostInfo
+	// endpointsResolved is when endpoints were resolved, protected by
+	// endpointsMu with endpoints.
+	endpointsResolved time.Time
+	endpointsMu       sync.Mutex
 
 	mu sync.RWMutex
 	// hosts are the set of all hosts in the cassandra ring that we know of.
@@ -67,6 +72,23 @@ func (r *ring) getHostByIP(ip string) (*HostInfo, bool) {
 	return r.hosts[hi], ok
 }
 
+// replacedHost returns the host with the same address as host but a different
+// host_id, which happens when a node is replaced by a new one, or nil.
+func (r *ring) replacedHost(host *HostInfo) *HostInfo {
+	addr := host.nodeToNodeAddress()
+	if !validIpAddr(addr) {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	hostID, ok := r.hostIPToUUID[addr.String()]
+	if !ok || hostID == host.HostID() {
+		return nil
+	}
+	return r.hosts[hostID]
+}
+
 func (r *ring) getHost(hostID string) *HostInfo {
 	r.mu.RLock()
 	host := r.hosts[hostID]
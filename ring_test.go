@@ -60,3 +60,31 @@ func TestRing_AddHostIfMissing_Existing(t *testing.T) {
 		t.Fatalf("returned host same pointer: %p != %p", h1, host)
 	}
 }
+
+func TestRing_ReplacedHost(t *testing.T) {
+	ring := &ring{}
+
+	host := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(1, 1, 1, 1), peer: net.IPv4(1, 1, 1, 1)}
+	ring.addHostIfMissing(host)
+
+	if replaced := ring.replacedHost(host); replaced != nil {
+		t.Fatalf("expected no replaced host for the same host_id, got %v", replaced)
+	}
+
+	other := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(2, 2, 2, 2), peer: net.IPv4(2, 2, 2, 2)}
+	if replaced := ring.replacedHost(other); replaced != nil {
+		t.Fatalf("expected no replaced host for a new address, got %v", replaced)
+	}
+
+	replacement := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(1, 1, 1, 1), peer: net.IPv4(1, 1, 1, 1)}
+	if replaced := ring.replacedHost(replacement); replaced != host {
+		t.Fatalf("expected replaced host %v, got %v", host, replaced)
+	}
+
+	// hosts without a known address are never considered replaced
+	unknown := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(3, 3, 3, 3)}
+	ring.addHostIfMissing(unknown)
+	if replaced := ring.replacedHost(&HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(4, 4, 4, 4)}); replaced != nil {
+		t.Fatalf("expected no replaced host without address, got %v", replaced)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"sort"
+)
+
+// RoleMetadata describes a role of system_auth.
+type RoleMetadata struct {
+	Name        string
+	CanLogin    bool
+	IsSuperuser bool
+	// MemberOf lists the roles granted to the role.
+	MemberOf []string
+}
+
+// PermissionMetadata describes the permissions of a role on a resource, such
+// as "data/keyspace/table".
+type PermissionMetadata struct {
+	Role        string
+	Resource    string
+	Permissions []string
+}
+
+// rolesSupported reports whether the cluster uses roles, introduced by
+// Cassandra 2.2, rather than users.
+func (s *Session) rolesSupported() bool {
+	host := s.ring.rrHost()
+	return host == nil || host.Version().AtLeast(2, 2, 0)
+}
+
+// Roles lists the roles of the cluster, sorted by name. On clusters older
+// than Cassandra 2.2, users are returned as roles which can login. The session
+// must be authenticated as a role allowed to read system_auth.
+func (s *Session) Roles(ctx context.Context) ([]RoleMetadata, error) {
+	var roles []RoleMetadata
+	if s.rolesSupported() {
+		iter := s.Query(`SELECT role, can_login, is_superuser, member_of FROM system_auth.roles`).WithContext(ctx).Iter()
+		var role RoleMetadata
+		for iter.Scan(&role.Name, &role.CanLogin, &role.IsSuperuser, &role.MemberOf) {
+			sort.Strings(role.MemberOf)
+			roles = append(roles, role)
+			role = RoleMetadata{}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	} else {
+		iter := s.Query(`SELECT name, super FROM system_auth.users`).WithContext(ctx).Iter()
+		var role RoleMetadata
+		for iter.Scan(&role.Name, &role.IsSuperuser) {
+			role.CanLogin = true
+			roles = append(roles, role)
+			role = RoleMetadata{}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+// RolePermissions lists the permissions granted to role, or to every role if
+// role is empty, sorted by role and resource.
+func (s *Session) RolePermissions(ctx context.Context, role string) ([]PermissionMetadata, error) {
+	stmt := `SELECT role, resource, permissions FROM system_auth.role_permissions`
+	if !s.rolesSupported() {
+		stmt = `SELECT username, resource, permissions FROM system_auth.permissions`
+	}
+	var values []interface{}
+	if role != "" {
+		if s.rolesSupported() {
+			stmt += ` WHERE role = ?`
+		} else {
+			stmt += ` WHERE username = ?`
+		}
+		values = append(values, role)
+	}
+
+	var permissions []PermissionMetadata
+	iter := s.Query(stmt, values...).WithContext(ctx).Iter()
+	var perm PermissionMetadata
+	for iter.Scan(&perm.Role, &perm.Resource, &perm.Permissions) {
+		sort.Strings(perm.Permissions)
+		permissions = append(permissions, perm)
+		perm = PermissionMetadata{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(permissions, func(i, j int) bool {
+		if permissions[i].Role != permissions[j].Role {
+			return permissions[i].Role < permissions[j].Role
+		}
+		return permissions[i].Resource < permissions[j].Resource
+	})
+	return permissions, nil
+}
+
+// RoleMembers lists the roles which were granted role, sorted by name. It
+// returns ErrUnsupported on clusters older than Cassandra 2.2, which do not
+// support granting roles.
+func (s *Session) RoleMembers(ctx context.Context, role string) ([]string, error) {
+	if !s.rolesSupported() {
+		return nil, ErrUnsupported
+	}
+
+	iter := s.Query(`SELECT member FROM system_auth.role_members WHERE role = ?`, role).WithContext(ctx).Iter()
+	var (
+		members []string
+		member  string
+	)
+	for iter.Scan(&member) {
+		members = append(members, member)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(members)
+	return members, nil
+}
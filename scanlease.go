@@ -0,0 +1,269 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrScanLeaseMismatch is returned when resuming a ScanLease whose fingerprint
+// does not match the statement scanning its table anymore, for instance
+// because the partition key of the table changed.
+var ErrScanLeaseMismatch = errors.New("gocql: scan lease does not match the table")
+
+// scanLeaseVersion is the version of the encoding of ScanLease.
+const scanLeaseVersion = 1
+
+// ScanLease is a resumable part of a table scan: a sub-range of the token ring
+// and the paging state of the scan within it. Leases are meant to distribute
+// a scan across workers, which persist the lease of their last page so that
+// another worker can resume exactly where a failed one left off.
+//
+// Leases are encoded with MarshalBinary and decoded with UnmarshalBinary.
+type ScanLease struct {
+	Keyspace string
+	Table    string
+	// Columns are the columns read, all the columns of the table if empty.
+	Columns []string
+
+	// Range is the part of the sub-range which remains to be scanned.
+	Range TokenRange
+	// PageState is the paging state of the scan within Range, empty when the
+	// scan of Range did not start.
+	PageState []byte
+
+	Consistency Consistency
+	PageSize    int
+
+	// Fingerprint identifies the statement scanning the table, so that a
+	// lease is not resumed with a statement its paging state is not valid for.
+	Fingerprint string
+
+	// Done is set once all the rows of the lease were read.
+	Done bool
+}
+
+type scanLeaseJSON struct {
+	Version     int         `json:"v"`
+	Keyspace    string      `json:"ks"`
+	Table       string      `json:"table"`
+	Columns     []string    `json:"columns,omitempty"`
+	Start       string      `json:"start"`
+	End         string      `json:"end"`
+	PageState   []byte      `json:"page_state,omitempty"`
+	Consistency Consistency `json:"consistency,omitempty"`
+	PageSize    int         `json:"page_size,omitempty"`
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done,omitempty"`
+}
+
+// MarshalBinary encodes the lease.
+func (l ScanLease) MarshalBinary() ([]byte, error) {
+	return json.Marshal(scanLeaseJSON{
+		Version:     scanLeaseVersion,
+		Keyspace:    l.Keyspace,
+		Table:       l.Table,
+		Columns:     l.Columns,
+		Start:       l.Range.Start,
+		End:         l.Range.End,
+		PageState:   l.PageState,
+		Consistency: l.Consistency,
+		PageSize:    l.PageSize,
+		Fingerprint: l.Fingerprint,
+		Done:        l.Done,
+	})
+}
+
+// UnmarshalBinary decodes a lease encoded with MarshalBinary.
+func (l *ScanLease) UnmarshalBinary(data []byte) error {
+	var v scanLeaseJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("gocql: unable to decode scan lease: %v", err)
+	}
+	if v.Version != scanLeaseVersion {
+		return fmt.Errorf("gocql: unsupported scan lease version %d", v.Version)
+	}
+	if _, err := strconv.ParseInt(v.Start, 10, 64); err != nil {
+		return fmt.Errorf("gocql: invalid scan lease start token %q", v.Start)
+	}
+	if _, err := strconv.ParseInt(v.End, 10, 64); err != nil {
+		return fmt.Errorf("gocql: invalid scan lease end token %q", v.End)
+	}
+
+	*l = ScanLease{
+		Keyspace:    v.Keyspace,
+		Table:       v.Table,
+		Columns:     v.Columns,
+		Range:       TokenRange{Start: v.Start, End: v.End},
+		PageState:   v.PageState,
+		Consistency: v.Consistency,
+		PageSize:    v.PageSize,
+		Fingerprint: v.Fingerprint,
+		Done:        v.Done,
+	}
+	return nil
+}
+
+// scanFingerprint returns the fingerprint of a scan statement.
+func scanFingerprint(stmt string) string {
+	sum := sha256.Sum256([]byte(stmt))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ScanLeases splits the scan of keyspace.table into leases, one per sub-range
+// of the token ring, to be handed to workers which read them with
+// Session.ScanLease. The Columns, Splits, PageSize and Consistency options are
+// used, the others are ignored.
+func (s *Session) ScanLeases(keyspace, table string, opts ScanOptions) ([]ScanLease, error) {
+	meta, tbl, err := s.scanTableMetadata(keyspace, table)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Splits <= 0 {
+		opts.Splits = 1
+	}
+
+	fingerprint := scanFingerprint(scanStatement(tbl, opts.Columns))
+	var leases []ScanLease
+	for _, tr := range meta.TokenRanges() {
+		start, _ := strconv.ParseInt(tr.Start, 10, 64)
+		end, _ := strconv.ParseInt(tr.End, 10, 64)
+		for _, b := range splitTokenRange(start, end, opts.Splits) {
+			leases = append(leases, ScanLease{
+				Keyspace:    keyspace,
+				Table:       table,
+				Columns:     opts.Columns,
+				Range:       TokenRange{Start: strconv.FormatInt(b[0], 10), End: strconv.FormatInt(b[1], 10)},
+				Consistency: opts.Consistency,
+				PageSize:    opts.PageSize,
+				Fingerprint: fingerprint,
+			})
+		}
+	}
+	return leases, nil
+}
+
+// ScanLease reads the rows of a lease page by page, calling fn with the rows
+// of each page and the lease resuming the scan after them, which is Done after
+// the last page. The scan stops at the first error returned by fn.
+//
+// The lease passed to fn is typically persisted once the rows are processed,
+// so that the scan can be resumed from it by another worker:
+//
+//	err := session.ScanLease(ctx, lease, func(rows []map[string]interface{}, next gocql.ScanLease) error {
+//		if err := process(rows); err != nil {
+//			return err
+//		}
+//		return store(next)
+//	})
+func (s *Session) ScanLease(ctx context.Context, lease ScanLease, fn func(rows []map[string]interface{}, next ScanLease) error) error {
+	if lease.Done {
+		return nil
+	}
+	_, tbl, err := s.scanTableMetadata(lease.Keyspace, lease.Table)
+	if err != nil {
+		return err
+	}
+	stmt := scanStatement(tbl, lease.Columns)
+	if scanFingerprint(stmt) != lease.Fingerprint {
+		return ErrScanLeaseMismatch
+	}
+
+	return scanLease(lease, func(bound [2]int64, pageState []byte) ([]map[string]interface{}, []byte, error) {
+		qry := s.Query(stmt, bound[0], bound[1]).WithContext(ctx)
+		if lease.PageSize > 0 {
+			qry.PageSize(lease.PageSize)
+		}
+		if lease.Consistency != 0 {
+			qry.Consistency(lease.Consistency)
+		}
+		return scanLeasePage(qry, pageState)
+	}, fn)
+}
+
+// scanLeasePage reads the single page of qry at pageState, returning its rows
+// and the paging state of the next page, empty after the last page. Automatic
+// paging is disabled so that the following pages are not fetched.
+func scanLeasePage(qry *Query, pageState []byte) ([]map[string]interface{}, []byte, error) {
+	qry.PageState(pageState)
+	qry.disableAutoPage = true
+
+	iter := qry.Iter()
+	rows, err := iter.SliceMap()
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, iter.PageState(), nil
+}
+
+// scanLease reads the pages of lease with fetch, which returns the rows of the
+// page of the given token bounds and paging state along with the paging state
+// of the next page.
+func scanLease(lease ScanLease, fetch func(bound [2]int64, pageState []byte) ([]map[string]interface{}, []byte, error),
+	fn func(rows []map[string]interface{}, next ScanLease) error) error {
+	for !lease.Done {
+		start, err := strconv.ParseInt(lease.Range.Start, 10, 64)
+		if err != nil {
+			return fmt.Errorf("gocql: invalid scan lease start token %q", lease.Range.Start)
+		}
+		end, err := strconv.ParseInt(lease.Range.End, 10, 64)
+		if err != nil {
+			return fmt.Errorf("gocql: invalid scan lease end token %q", lease.Range.End)
+		}
+
+		bounds := scanRange{start: start, end: end}.bounds()
+		if len(bounds) == 0 {
+			lease.PageState = nil
+			lease.Done = true
+			if err := fn(nil, lease); err != nil {
+				return err
+			}
+			break
+		}
+
+		rows, pageState, err := fetch(bounds[0], lease.PageState)
+		if err != nil {
+			return err
+		}
+
+		next := lease
+		next.PageState = pageState
+		if len(pageState) == 0 {
+			// the first bound is done, the remainder of a range wrapping around
+			// the ring starts after the minimum token
+			if len(bounds) > 1 {
+				next.Range.Start = strconv.FormatInt(math.MinInt64, 10)
+			} else {
+				next.Done = true
+			}
+		}
+		if err := fn(rows, next); err != nil {
+			return err
+		}
+		lease = next
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestScanLeaseEncoding(t *testing.T) {
+	lease := ScanLease{
+		Keyspace:    "ks",
+		Table:       "tbl",
+		Columns:     []string{"a", "b"},
+		Range:       TokenRange{Start: "-10", End: "20"},
+		PageState:   []byte{1, 2, 3},
+		Consistency: LocalQuorum,
+		PageSize:    500,
+		Fingerprint: scanFingerprint("SELECT"),
+	}
+	data, err := lease.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded ScanLease
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, lease) {
+		t.Fatalf("expected %+v, got %+v", lease, decoded)
+	}
+
+	for _, data := range []string{
+		`not json`,
+		`{"v":2,"start":"1","end":"2"}`,
+		`{"v":1,"start":"a","end":"2"}`,
+		`{"v":1,"start":"1","end":""}`,
+	} {
+		if err := decoded.UnmarshalBinary([]byte(data)); err == nil {
+			t.Errorf("expected error decoding %s", data)
+		}
+	}
+}
+
+// testScanPages returns a fetch function for scanLease returning pages of
+// pages rows for each bound, recording the bounds and paging states.
+func testScanPages(pages int, calls *[]string) func(bound [2]int64, pageState []byte) ([]map[string]interface{}, []byte, error) {
+	return func(bound [2]int64, pageState []byte) ([]map[string]interface{}, []byte, error) {
+		page := 0
+		if len(pageState) > 0 {
+			page = int(pageState[0])
+		}
+		*calls = append(*calls, strconv.FormatInt(bound[0], 10)+":"+strconv.Itoa(page))
+
+		rows := []map[string]interface{}{{"page": page}}
+		if page+1 == pages {
+			return rows, nil, nil
+		}
+		return rows, []byte{byte(page + 1)}, nil
+	}
+}
+
+func TestScanLeasePages(t *testing.T) {
+	min := strconv.FormatInt(math.MinInt64, 10)
+	lease := ScanLease{Range: TokenRange{Start: "100", End: "-100"}}
+
+	var calls []string
+	var leases []ScanLease
+	err := scanLease(lease, testScanPages(2, &calls), func(rows []map[string]interface{}, next ScanLease) error {
+		if len(rows) != 1 {
+			t.Errorf("expected 1 row, got %d", len(rows))
+		}
+		leases = append(leases, next)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCalls := []string{"100:0", "100:1", min + ":0", min + ":1"}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatalf("expected calls %v, got %v", expectedCalls, calls)
+	}
+	expected := []ScanLease{
+		{Range: TokenRange{Start: "100", End: "-100"}, PageState: []byte{1}},
+		{Range: TokenRange{Start: min, End: "-100"}},
+		{Range: TokenRange{Start: min, End: "-100"}, PageState: []byte{1}},
+		{Range: TokenRange{Start: min, End: "-100"}, Done: true},
+	}
+	if !reflect.DeepEqual(leases, expected) {
+		t.Fatalf("expected leases %+v, got %+v", expected, leases)
+	}
+
+	// resuming from the lease of any page reads the remaining pages
+	calls = nil
+	err = scanLease(leases[1], testScanPages(2, &calls), func(rows []map[string]interface{}, next ScanLease) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(calls, expectedCalls[2:]) {
+		t.Fatalf("expected calls %v, got %v", expectedCalls[2:], calls)
+	}
+}
+
+func TestScanLeaseStop(t *testing.T) {
+	stop := errors.New("stop")
+	lease := ScanLease{Range: TokenRange{Start: "-100", End: "100"}}
+
+	var calls []string
+	err := scanLease(lease, testScanPages(3, &calls), func(rows []map[string]interface{}, next ScanLease) error {
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("expected %v, got %v", stop, err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 page, got %d", len(calls))
+	}
+
+	calls = nil
+	lease.Done = true
+	if err := scanLease(lease, testScanPages(3, &calls), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("expected no page read for a done lease, got %d", len(calls))
+	}
+}
@@ -0,0 +1,386 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ScanOptions configures Session.ScanTable.
+type ScanOptions struct {
+	// Columns are the columns read, all the columns of the table if empty.
+	Columns []string
+
+	// Splits is the number of sub-ranges each token range of the ring is
+	// split into. Default: 1
+	Splits int
+
+	// Concurrency is the maximum number of sub-ranges scanned at the same
+	// time. Default: 16
+	Concurrency int
+
+	// PageSize is the page size of the queries, the default page size of the
+	// session if 0.
+	PageSize int
+
+	// Consistency is the consistency of the queries, the default consistency
+	// of the session if 0.
+	Consistency Consistency
+
+	// Completed are the sub-ranges completed by a previous scan, which are
+	// skipped to resume it. The scan must be split the same way.
+	Completed []TokenRange
+
+	// Checkpoint, if not nil, is called with each sub-range once all its rows
+	// were delivered to TableScanner.Rows, so that the scan can be resumed with
+	// Completed. It is not called concurrently.
+	Checkpoint func(r TokenRange)
+}
+
+// ScanRow is a row read by a TableScanner.
+type ScanRow struct {
+	// Range is the sub-range of the token ring the row was read from.
+	Range TokenRange
+	Row   map[string]interface{}
+}
+
+// scanRange is a sub-range of the token ring scanned by a TableScanner.
+type scanRange struct {
+	TokenRange
+	start, end int64
+	// replicas are the replicas of the token range the sub-range is part of.
+	replicas []*HostInfo
+}
+
+// bounds returns the bounds of the token restrictions which select the
+// sub-range, which is split in two when it wraps around the ring.
+func (r scanRange) bounds() [][2]int64 {
+	if r.start < r.end {
+		return [][2]int64{{r.start, r.end}}
+	}
+
+	var bounds [][2]int64
+	if r.start != math.MaxInt64 {
+		bounds = append(bounds, [2]int64{r.start, math.MaxInt64})
+	}
+	if r.end != math.MinInt64 {
+		// Murmur3Partitioner never assigns the minimum token to a key
+		bounds = append(bounds, [2]int64{math.MinInt64, r.end})
+	}
+	return bounds
+}
+
+// splitTokenRange splits the range starting after start and ending with end
+// into n sub-ranges of the same size. The range is the whole ring when start
+// and end are equal.
+func splitTokenRange(start, end int64, n int) [][2]int64 {
+	width := uint64(end) - uint64(start)
+	if width == 0 {
+		width = math.MaxUint64
+	}
+	if uint64(n) > width {
+		n = int(width)
+	}
+	step := width / uint64(n)
+
+	ranges := make([][2]int64, n)
+	for i := range ranges {
+		next := int64(uint64(start) + step)
+		if i == n-1 {
+			next = end
+		}
+		ranges[i] = [2]int64{start, next}
+		start = next
+	}
+	return ranges
+}
+
+// TableScanner reads all the rows of a table by token ranges in parallel, see
+// Session.ScanTable.
+type TableScanner struct {
+	session *Session
+	opts    ScanOptions
+	stmt    string
+	ranges  []scanRange
+	// scanRange reads the rows of a sub-range, it is replaced in tests.
+	scanRange func(ctx context.Context, r scanRange, i int, emit func(map[string]interface{}) error) error
+
+	rows   chan ScanRow
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// ScanTable scans all the rows of keyspace.table in parallel: the token ring
+// is split into sub-ranges which are read with token restrictions on the
+// partition key by the replicas of each range. It is meant for ETL and
+// analytics jobs reading whole tables, and requires Murmur3Partitioner.
+//
+// The rows of the sub-ranges are merged into TableScanner.Rows in no
+// particular order. The scan stops at the first error, which is returned by
+// TableScanner.Err.
+//
+//	scanner, err := session.ScanTable(ctx, "ks", "table", gocql.ScanOptions{Splits: 4})
+//	if err != nil {
+//		return err
+//	}
+//	for row := range scanner.Rows() {
+//		process(row.Row)
+//	}
+//	if err := scanner.Err(); err != nil {
+//		return err
+//	}
+func (s *Session) ScanTable(ctx context.Context, keyspace, table string, opts ScanOptions) (*TableScanner, error) {
+	meta, tbl, err := s.scanTableMetadata(keyspace, table)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := newTableScanner(opts)
+	sc.session = s
+	sc.stmt = scanStatement(tbl, opts.Columns)
+	sc.scanRange = sc.queryRange
+
+	completed := make(map[TokenRange]bool, len(opts.Completed))
+	for _, r := range opts.Completed {
+		completed[r] = true
+	}
+	for _, tr := range meta.TokenRanges() {
+		replicas, err := meta.RangeReplicas(keyspace, tr)
+		if err != nil {
+			return nil, err
+		}
+		start, _ := strconv.ParseInt(tr.Start, 10, 64)
+		end, _ := strconv.ParseInt(tr.End, 10, 64)
+		for _, b := range splitTokenRange(start, end, sc.opts.Splits) {
+			r := scanRange{
+				TokenRange: TokenRange{Start: strconv.FormatInt(b[0], 10), End: strconv.FormatInt(b[1], 10)},
+				start:      b[0],
+				end:        b[1],
+				replicas:   replicas,
+			}
+			if !completed[r.TokenRange] {
+				sc.ranges = append(sc.ranges, r)
+			}
+		}
+	}
+
+	sc.start(ctx)
+	return sc, nil
+}
+
+// scanTableMetadata returns the token metadata and the metadata of a table to
+// scan, checking that the cluster uses Murmur3Partitioner.
+func (s *Session) scanTableMetadata(keyspace, table string) (*TokenMetadata, *TableMetadata, error) {
+	meta, err := s.TokenMetadata()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p := meta.Partitioner(); p != "Murmur3Partitioner" {
+		return nil, nil, fmt.Errorf("gocql: scanning tables is not supported by %s", p)
+	}
+
+	ks, err := s.KeyspaceMetadata(keyspace)
+	if err != nil {
+		return nil, nil, err
+	}
+	tbl, ok := ks.Tables[table]
+	if !ok {
+		return nil, nil, fmt.Errorf("gocql: table %s.%s does not exist", keyspace, table)
+	}
+	return meta, tbl, nil
+}
+
+func newTableScanner(opts ScanOptions) *TableScanner {
+	if opts.Splits <= 0 {
+		opts.Splits = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 16
+	}
+	return &TableScanner{opts: opts, rows: make(chan ScanRow)}
+}
+
+// scanStatement returns the statement reading columns from the rows of tbl
+// in a range of tokens.
+func scanStatement(tbl *TableMetadata, columns []string) string {
+	selected := "*"
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, c := range columns {
+			quoted[i] = QuoteIdentifier(c)
+		}
+		selected = strings.Join(quoted, ", ")
+	}
+
+	pk := make([]string, len(tbl.PartitionKey))
+	for i, c := range tbl.PartitionKey {
+		pk[i] = QuoteIdentifier(c.Name)
+	}
+	token := "token(" + strings.Join(pk, ", ") + ")"
+
+	return fmt.Sprintf("SELECT %s FROM %s.%s WHERE %s > ? AND %s <= ?",
+		selected, QuoteIdentifier(tbl.Keyspace), QuoteIdentifier(tbl.Name), token, token)
+}
+
+// start scans the sub-ranges with opts.Concurrency workers.
+func (sc *TableScanner) start(ctx context.Context) {
+	scanCtx, cancel := context.WithCancel(ctx)
+	sc.cancel = cancel
+
+	ranges := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < sc.opts.Concurrency && i < len(sc.ranges); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ranges {
+				if err := sc.scan(scanCtx, i); err != nil {
+					sc.fail(ctx, err)
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+	feed:
+		for i := range sc.ranges {
+			select {
+			case ranges <- i:
+			case <-scanCtx.Done():
+				break feed
+			}
+		}
+		close(ranges)
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			sc.fail(ctx, err)
+		}
+		cancel()
+		close(sc.rows)
+	}()
+}
+
+// scan reads the rows of the i-th sub-range and records its completion.
+func (sc *TableScanner) scan(ctx context.Context, i int) error {
+	r := sc.ranges[i]
+	err := sc.scanRange(ctx, r, i, func(row map[string]interface{}) error {
+		select {
+		case sc.rows <- ScanRow{Range: r.TokenRange, Row: row}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if sc.opts.Checkpoint != nil {
+		sc.mu.Lock()
+		sc.opts.Checkpoint(r.TokenRange)
+		sc.mu.Unlock()
+	}
+	return nil
+}
+
+// fail records the first error of the scan and stops it. The errors caused by
+// stopping the scan are ignored unless ctx is done.
+func (sc *TableScanner) fail(ctx context.Context, err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.err != nil {
+		return
+	}
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		// stopped by Close or by the failure of another sub-range
+		return
+	}
+	sc.err = err
+	sc.cancel()
+}
+
+// queryRange reads the rows of a sub-range from one of its replicas, picked in
+// turn so that the sub-ranges of a token range are spread over its replicas.
+func (sc *TableScanner) queryRange(ctx context.Context, r scanRange, i int, emit func(map[string]interface{}) error) error {
+	var host *HostInfo
+	for j := range r.replicas {
+		if replica := r.replicas[(i+j)%len(r.replicas)]; replica.IsUp() {
+			host = replica
+			break
+		}
+	}
+
+	for _, b := range r.bounds() {
+		qry := sc.session.Query(sc.stmt, b[0], b[1]).WithContext(ctx).SetHost(host)
+		if sc.opts.PageSize > 0 {
+			qry.PageSize(sc.opts.PageSize)
+		}
+		if sc.opts.Consistency != 0 {
+			qry.Consistency(sc.opts.Consistency)
+		}
+
+		iter := qry.Iter()
+		for {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			if err := emit(row); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rows returns the rows read by the scan, which is closed once all the
+// sub-ranges were read or the scan stopped.
+func (sc *TableScanner) Rows() <-chan ScanRow {
+	return sc.rows
+}
+
+// Err returns the error which stopped the scan, if any. It must be called once
+// Rows is closed.
+func (sc *TableScanner) Err() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.err
+}
+
+// Close stops the scan and waits for it to end, returning the error which
+// stopped it before, if any.
+func (sc *TableScanner) Close() error {
+	sc.cancel()
+	for range sc.rows {
+	}
+	return sc.Err()
+}
@@ -0,0 +1,188 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSplitTokenRange(t *testing.T) {
+	ranges := splitTokenRange(-100, 200, 3)
+	if expected := [][2]int64{{-100, 0}, {0, 100}, {100, 200}}; !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("expected %v, got %v", expected, ranges)
+	}
+
+	// a range wrapping around the ring
+	ranges = splitTokenRange(math.MaxInt64-9, math.MinInt64+10, 2)
+	if expected := [][2]int64{{math.MaxInt64 - 9, math.MinInt64}, {math.MinInt64, math.MinInt64 + 10}}; !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("expected %v, got %v", expected, ranges)
+	}
+
+	// the whole ring
+	ranges = splitTokenRange(0, 0, 2)
+	if len(ranges) != 2 || ranges[0][0] != 0 || ranges[1][1] != 0 || ranges[0][1] != ranges[1][0] {
+		t.Fatalf("expected the ring to be split in two, got %v", ranges)
+	}
+
+	if ranges := splitTokenRange(0, 2, 5); len(ranges) != 2 {
+		t.Fatalf("expected a range of 2 tokens to be split in 2, got %v", ranges)
+	}
+}
+
+func TestScanRangeBounds(t *testing.T) {
+	tests := []struct {
+		start, end int64
+		expected   [][2]int64
+	}{
+		{-10, 10, [][2]int64{{-10, 10}}},
+		{10, -10, [][2]int64{{10, math.MaxInt64}, {math.MinInt64, -10}}},
+		{5, 5, [][2]int64{{5, math.MaxInt64}, {math.MinInt64, 5}}},
+		{10, math.MinInt64, [][2]int64{{10, math.MaxInt64}}},
+	}
+	for _, test := range tests {
+		bounds := scanRange{start: test.start, end: test.end}.bounds()
+		if !reflect.DeepEqual(bounds, test.expected) {
+			t.Errorf("bounds of (%d, %d]: expected %v, got %v", test.start, test.end, test.expected, bounds)
+		}
+	}
+}
+
+func TestScanStatement(t *testing.T) {
+	tbl := &TableMetadata{
+		Keyspace:     "ks",
+		Name:         "tbl",
+		PartitionKey: []*ColumnMetadata{{Name: "a"}, {Name: "B"}},
+	}
+	expected := `SELECT * FROM "ks"."tbl" WHERE token("a", "B") > ? AND token("a", "B") <= ?`
+	if stmt := scanStatement(tbl, nil); stmt != expected {
+		t.Errorf("expected %q, got %q", expected, stmt)
+	}
+	expected = `SELECT "a", "v" FROM "ks"."tbl" WHERE token("a", "B") > ? AND token("a", "B") <= ?`
+	if stmt := scanStatement(tbl, []string{"a", "v"}); stmt != expected {
+		t.Errorf("expected %q, got %q", expected, stmt)
+	}
+}
+
+func newTestTableScanner(opts ScanOptions, n int, scan func(r scanRange, emit func(map[string]interface{}) error) error) *TableScanner {
+	sc := newTableScanner(opts)
+	for _, b := range splitTokenRange(0, 0, n) {
+		sc.ranges = append(sc.ranges, scanRange{
+			TokenRange: TokenRange{Start: murmur3Token(b[0]).String(), End: murmur3Token(b[1]).String()},
+			start:      b[0],
+			end:        b[1],
+		})
+	}
+	sc.scanRange = func(ctx context.Context, r scanRange, i int, emit func(map[string]interface{}) error) error {
+		return scan(r, emit)
+	}
+	return sc
+}
+
+func TestTableScanner(t *testing.T) {
+	var checkpoints []string
+	opts := ScanOptions{
+		Concurrency: 3,
+		Checkpoint: func(r TokenRange) {
+			checkpoints = append(checkpoints, r.End)
+		},
+	}
+	sc := newTestTableScanner(opts, 8, func(r scanRange, emit func(map[string]interface{}) error) error {
+		for i := 0; i < 2; i++ {
+			if err := emit(map[string]interface{}{"i": i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	sc.start(context.Background())
+
+	rows := make(map[TokenRange]int)
+	for row := range sc.Rows() {
+		rows[row.Range]++
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 8 {
+		t.Fatalf("expected rows from 8 ranges, got %d", len(rows))
+	}
+	for r, n := range rows {
+		if n != 2 {
+			t.Errorf("expected 2 rows from range %v, got %d", r, n)
+		}
+	}
+
+	var expected []string
+	for _, r := range sc.ranges {
+		expected = append(expected, r.End)
+	}
+	sort.Strings(expected)
+	sort.Strings(checkpoints)
+	if !reflect.DeepEqual(checkpoints, expected) {
+		t.Fatalf("expected checkpoints %v, got %v", expected, checkpoints)
+	}
+}
+
+func TestTableScannerError(t *testing.T) {
+	errScan := errors.New("scan failed")
+	var checkpoints int
+	opts := ScanOptions{
+		Concurrency: 2,
+		Checkpoint: func(r TokenRange) {
+			checkpoints++
+		},
+	}
+	sc := newTestTableScanner(opts, 4, func(r scanRange, emit func(map[string]interface{}) error) error {
+		if r.start == 0 {
+			return errScan
+		}
+		return emit(map[string]interface{}{})
+	})
+	sc.start(context.Background())
+
+	for range sc.Rows() {
+	}
+	if err := sc.Err(); err != errScan {
+		t.Fatalf("expected %v, got %v", errScan, err)
+	}
+	if checkpoints == 4 {
+		t.Fatal("expected the failed range not to be checkpointed")
+	}
+}
+
+func TestTableScannerClose(t *testing.T) {
+	sc := newTestTableScanner(ScanOptions{}, 4, func(r scanRange, emit func(map[string]interface{}) error) error {
+		for {
+			if err := emit(map[string]interface{}{}); err != nil {
+				return err
+			}
+		}
+	})
+	sc.start(context.Background())
+
+	<-sc.Rows()
+	if err := sc.Close(); err != nil {
+		t.Fatalf("expected no error after closing the scanner, got %v", err)
+	}
+}
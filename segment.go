@@ -0,0 +1,226 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Protocol v5 wraps frames in segments, whose header and payload are each
+// protected by a checksum. The payload of a segment may be compressed as a
+// whole, rather than frame by frame as in earlier protocol versions.
+const (
+	maxSegmentPayloadSize = 1<<17 - 1
+
+	uncompressedSegmentHeaderSize = 3
+	compressedSegmentHeaderSize   = 5
+	segmentHeaderCRCSize          = 3
+	segmentPayloadCRCSize         = 4
+
+	crc24Init = 0x875060
+	crc24Poly = 0x1974F0B
+)
+
+var (
+	errSegmentHeaderCRC  = errors.New("gocql: segment header checksum mismatch")
+	errSegmentPayloadCRC = errors.New("gocql: segment payload checksum mismatch")
+
+	// segment payload checksums are seeded with these bytes
+	segmentCRC32Init = crc32.ChecksumIEEE([]byte{0xfa, 0x2d, 0x55, 0xca})
+)
+
+// crc24 computes the checksum of a segment header of n bytes stored in little
+// endian order in header.
+func crc24(header uint64, n int) uint32 {
+	crc := uint32(crc24Init)
+	for ; n > 0; n-- {
+		crc ^= uint32(header&0xff) << 16
+		header >>= 8
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+func segmentCRC32(payload []byte) uint32 {
+	return crc32.Update(segmentCRC32Init, crc32.IEEETable, payload)
+}
+
+func putUintLE(p []byte, v uint64) {
+	for i := range p {
+		p[i] = byte(v >> (8 * uint(i)))
+	}
+}
+
+func uintLE(p []byte) uint64 {
+	var v uint64
+	for i := range p {
+		v |= uint64(p[i]) << (8 * uint(i))
+	}
+	return v
+}
+
+// appendSegment appends to dst a segment holding payload, compressing it with
+// compressor if not nil. A compressed segment stores its payload uncompressed
+// when it is smaller than minCompressSize or compression does not reduce its
+// size.
+func appendSegment(dst, payload []byte, selfContained bool, compressor SegmentCompressor, minCompressSize int) ([]byte, error) {
+	if len(payload) > maxSegmentPayloadSize {
+		return nil, fmt.Errorf("gocql: segment payload of %d bytes exceeds the maximum of %d bytes", len(payload), maxSegmentPayloadSize)
+	}
+
+	var flag uint64
+	if selfContained {
+		flag = 1
+	}
+
+	var header uint64
+	headerSize := uncompressedSegmentHeaderSize
+	if compressor == nil {
+		header = uint64(len(payload)) | flag<<17
+	} else {
+		headerSize = compressedSegmentHeaderSize
+		compressed := payload
+		if len(payload) >= minCompressSize {
+			var err error
+			compressed, err = compressor.EncodeBlock(payload)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(compressed) < len(payload) {
+			header = uint64(len(compressed)) | uint64(len(payload))<<17 | flag<<34
+			payload = compressed
+		} else {
+			// an uncompressed length of 0 means the payload is not compressed
+			header = uint64(len(payload)) | flag<<34
+		}
+	}
+
+	var buf [compressedSegmentHeaderSize + segmentHeaderCRCSize]byte
+	putUintLE(buf[:headerSize], header)
+	putUintLE(buf[headerSize:headerSize+segmentHeaderCRCSize], uint64(crc24(header, headerSize)))
+	dst = append(dst, buf[:headerSize+segmentHeaderCRCSize]...)
+
+	dst = append(dst, payload...)
+	var crc [segmentPayloadCRCSize]byte
+	binary.LittleEndian.PutUint32(crc[:], segmentCRC32(payload))
+	return append(dst, crc[:]...), nil
+}
+
+// readSegment reads a segment from r, decompressing its payload with
+// compressor if not nil, and reports whether the segment holds only complete
+// frames.
+func readSegment(r io.Reader, compressor SegmentCompressor) (payload []byte, selfContained bool, err error) {
+	headerSize := uncompressedSegmentHeaderSize
+	if compressor != nil {
+		headerSize = compressedSegmentHeaderSize
+	}
+
+	var buf [compressedSegmentHeaderSize + segmentHeaderCRCSize]byte
+	if _, err := io.ReadFull(r, buf[:headerSize+segmentHeaderCRCSize]); err != nil {
+		return nil, false, err
+	}
+	header := uintLE(buf[:headerSize])
+	if uint32(uintLE(buf[headerSize:headerSize+segmentHeaderCRCSize])) != crc24(header, headerSize) {
+		return nil, false, errSegmentHeaderCRC
+	}
+
+	const lengthMask = 1<<17 - 1
+	length := int(header & lengthMask)
+	var uncompressedLength int
+	if compressor == nil {
+		selfContained = header&(1<<17) != 0
+	} else {
+		uncompressedLength = int(header >> 17 & lengthMask)
+		selfContained = header&(1<<34) != 0
+	}
+
+	payload = make([]byte, length+segmentPayloadCRCSize)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, false, err
+	}
+	payload, crc := payload[:length], payload[length:]
+	if binary.LittleEndian.Uint32(crc) != segmentCRC32(payload) {
+		return nil, false, errSegmentPayloadCRC
+	}
+
+	if uncompressedLength > 0 {
+		payload, err = compressor.DecodeBlock(payload, uncompressedLength)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return payload, selfContained, nil
+}
+
+// appendFrameSegments appends to dst the segments carrying frame: a single self
+// contained segment if the frame fits in one, or else as many segments as
+// needed, none of them self contained.
+func appendFrameSegments(dst, frame []byte, compressor SegmentCompressor, minCompressSize int) ([]byte, error) {
+	selfContained := len(frame) <= maxSegmentPayloadSize
+	for {
+		payload := frame
+		if len(payload) > maxSegmentPayloadSize {
+			payload = payload[:maxSegmentPayloadSize]
+		}
+		frame = frame[len(payload):]
+
+		var err error
+		dst, err = appendSegment(dst, payload, selfContained, compressor, minCompressSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) == 0 {
+			return dst, nil
+		}
+	}
+}
+
+// segmentReader reads the frames carried by the segments read from r. Frames
+// may span several segments, so it only passes on the payloads of segments.
+// Once reading a segment failed the stream can not be resynchronized, so the
+// error is returned by every following read.
+type segmentReader struct {
+	r          io.Reader
+	compressor SegmentCompressor
+
+	payload []byte
+	err     error
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	for len(s.payload) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.payload, _, s.err = readSegment(s.r, s.compressor)
+	}
+	n := copy(p, s.payload)
+	s.payload = s.payload[n:]
+	return n, nil
+}
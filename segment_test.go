@@ -0,0 +1,148 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+type snappySegmentCompressor struct {
+	SnappyCompressor
+}
+
+func (s snappySegmentCompressor) EncodeBlock(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (s snappySegmentCompressor) DecodeBlock(data []byte, uncompressedLength int) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+func TestSegmentRoundTrip(t *testing.T) {
+	compressible := bytes.Repeat([]byte("segment"), 100)
+	tests := []struct {
+		name       string
+		payload    []byte
+		compressor SegmentCompressor
+	}{
+		{"uncompressed", compressible, nil},
+		{"compressed", compressible, snappySegmentCompressor{}},
+		{"incompressible", []byte{1}, snappySegmentCompressor{}},
+		{"empty", nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf, err := appendSegment(nil, test.payload, true, test.compressor, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.compressor != nil && len(test.payload) > 100 && len(buf) >= len(test.payload) {
+				t.Fatalf("expected the payload to be compressed, got %d bytes", len(buf))
+			}
+
+			payload, selfContained, err := readSegment(bytes.NewReader(buf), test.compressor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !selfContained {
+				t.Fatal("expected a self contained segment")
+			}
+			if !bytes.Equal(payload, test.payload) {
+				t.Fatalf("expected payload %q, got %q", test.payload, payload)
+			}
+		})
+	}
+}
+
+func TestSegmentChecksums(t *testing.T) {
+	buf, err := appendSegment(nil, []byte("payload"), false, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := append([]byte(nil), buf...)
+	corrupted[0] ^= 1
+	if _, _, err := readSegment(bytes.NewReader(corrupted), nil); err != errSegmentHeaderCRC {
+		t.Fatalf("expected %v, got %v", errSegmentHeaderCRC, err)
+	}
+
+	corrupted = append([]byte(nil), buf...)
+	corrupted[len(corrupted)-5] ^= 1
+	if _, _, err := readSegment(bytes.NewReader(corrupted), nil); err != errSegmentPayloadCRC {
+		t.Fatalf("expected %v, got %v", errSegmentPayloadCRC, err)
+	}
+
+	if _, err := appendSegment(nil, make([]byte, maxSegmentPayloadSize+1), false, nil, 0); err == nil {
+		t.Fatal("expected an error for an oversized payload")
+	}
+}
+
+func TestSegmentFrames(t *testing.T) {
+	statements := []string{
+		"SELECT * FROM t",
+		"SELECT * FROM t WHERE " + strings.Repeat("a = 1 AND ", maxSegmentPayloadSize/5) + "a = 1",
+	}
+
+	for _, compressor := range []SegmentCompressor{nil, snappySegmentCompressor{}} {
+		var (
+			wire   []byte
+			frames [][]byte
+		)
+		for i, stmt := range statements {
+			framer := newFramer(nil, protoVersion5)
+			if err := (&writeQueryFrame{statement: stmt}).buildFrame(framer, i+1); err != nil {
+				t.Fatal(err)
+			}
+			frames = append(frames, framer.buf)
+
+			var err error
+			wire, err = appendFrameSegments(wire, framer.buf, compressor, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if compressor != nil && len(wire) >= len(frames[1]) {
+			t.Errorf("expected the segments to be compressed, got %d bytes", len(wire))
+		}
+
+		r := &segmentReader{r: bytes.NewReader(wire), compressor: compressor}
+		for i, expected := range frames {
+			head, err := readHeader(r, make([]byte, maxFrameHeaderSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if head.stream != i+1 || head.op != opQuery {
+				t.Fatalf("expected a query on stream %d, got %v", i+1, head)
+			}
+
+			framer := newFramer(nil, protoVersion5)
+			if err := framer.readFrame(r, &head); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(framer.buf, expected[framer.headSize:]) {
+				t.Fatalf("frame %d does not match the written one", i)
+			}
+		}
+	}
+}
@@ -27,11 +27,17 @@ package gocql
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -55,13 +61,19 @@ type Session struct {
 	pageSize            int
 	prefetch            float64
 	routingKeyInfoCache routingKeyInfoLRU
+	pageSizes           *pageSizeController
+	slowQueries         *slowQueryReporter
 	schemaDescriber     *schemaDescriber
 	trace               Tracer
 	queryObserver       QueryObserver
 	batchObserver       BatchObserver
 	connectObserver     ConnectObserver
+	poolObserver        PoolObserver
 	frameObserver       FrameHeaderObserver
+	wireObserver        FrameObserver
 	streamObserver      StreamObserver
+	metadataObserver    MetadataObserver
+	unpreparedObserver  UnpreparedObserver
 	hostSource          *ringDescriber
 	ringRefresher       *refreshDebouncer
 	stmtsLRU            *preparedLRU
@@ -103,6 +115,10 @@ type Session struct {
 	isInitialized bool
 
 	logger StdLogger
+
+	topologyListeners topologyListenerList
+	schemaListeners   schemaListenerList
+	ringRefreshHooks  ringRefreshHookList
 }
 
 var queryPool = &sync.Pool{
@@ -135,7 +151,7 @@ func addrsToHosts(addrs []string, defaultPort int, logger StdLogger) ([]*HostInf
 // NewSession wraps an existing Node.
 func NewSession(cfg ClusterConfig) (*Session, error) {
 	// Check that hosts in the ClusterConfig is not empty
-	if len(cfg.Hosts) < 1 {
+	if len(cfg.Hosts) < 1 && len(cfg.StaticHosts) < 1 && cfg.ContactPointResolver == nil {
 		return nil, ErrNoHosts
 	}
 
@@ -144,6 +160,10 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		return nil, errors.New("Can't use both Authenticator and AuthProvider in cluster config.")
 	}
 
+	if err := cfg.applyAnalytics(); err != nil {
+		return nil, err
+	}
+
 	// TODO: we should take a context in here at some point
 	ctx, cancel := context.WithCancel(context.TODO())
 
@@ -152,22 +172,34 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		prefetch:        0.25,
 		cfg:             cfg,
 		pageSize:        cfg.PageSize,
-		stmtsLRU:        &preparedLRU{lru: lru.New(cfg.MaxPreparedStmts)},
+		stmtsLRU:        newPreparedLRU(&cfg),
 		connectObserver: cfg.ConnectObserver,
 		ctx:             ctx,
 		cancel:          cancel,
-		logger:          cfg.logger(),
+		logger:          newLevelLogger(cfg.logger(), cfg.LogSampleInterval),
 	}
 
 	s.schemaDescriber = newSchemaDescriber(s)
 
-	s.nodeEvents = newEventDebouncer("NodeEvents", s.handleNodeEvent, s.logger)
-	s.schemaEvents = newEventDebouncer("SchemaEvents", s.handleSchemaEvent, s.logger)
+	s.nodeEvents = newEventDebouncer("NodeEvents", s.handleNodeEvent, s.logger,
+		cfg.Events.DebounceTime, cfg.Events.BufferSize, cfg.Events.OnDropped)
+	s.schemaEvents = newEventDebouncer("SchemaEvents", s.handleSchemaEvent, s.logger,
+		cfg.Events.DebounceTime, cfg.Events.BufferSize, cfg.Events.OnDropped)
 
 	s.routingKeyInfoCache.lru = lru.New(cfg.MaxRoutingKeyInfo)
+	if cfg.AdaptivePageSize != nil {
+		s.pageSizes = newPageSizeController(*cfg.AdaptivePageSize)
+	}
+	if cfg.SlowQuery != nil {
+		s.slowQueries = newSlowQueryReporter(*cfg.SlowQuery, s.logger)
+	}
 
 	s.hostSource = &ringDescriber{session: s}
-	s.ringRefresher = newRefreshDebouncer(ringRefreshDebounceTime, func() error { return refreshRing(s.hostSource) })
+	ringRefreshInterval := cfg.Events.RingRefreshDebounceTime
+	if ringRefreshInterval <= 0 {
+		ringRefreshInterval = ringRefreshDebounceTime
+	}
+	s.ringRefresher = newRefreshDebouncer(ringRefreshInterval, s.hookedRingRefresh)
 
 	if cfg.PoolConfig.HostSelectionPolicy == nil {
 		cfg.PoolConfig.HostSelectionPolicy = RoundRobinHostPolicy()
@@ -181,12 +213,23 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		pool:   s.pool,
 		policy: cfg.PoolConfig.HostSelectionPolicy,
 	}
+	if cfg.Backpressure != nil {
+		s.executor.throttler = newBackpressureThrottler(*cfg.Backpressure)
+	}
+	if cfg.RetryBudget != nil {
+		s.executor.retryBudget = newRetryBudget(*cfg.RetryBudget)
+	}
+	s.executor.warnings = cfg.WarningHandler
 
 	s.queryObserver = cfg.QueryObserver
 	s.batchObserver = cfg.BatchObserver
 	s.connectObserver = cfg.ConnectObserver
+	s.poolObserver = cfg.PoolObserver
 	s.frameObserver = cfg.FrameHeaderObserver
+	s.wireObserver = cfg.FrameObserver
 	s.streamObserver = cfg.StreamObserver
+	s.metadataObserver = cfg.MetadataObserver
+	s.unpreparedObserver = cfg.UnpreparedObserver
 
 	//Check the TLS Config before trying to connect to anything external
 	connCfg, err := connConfig(&s.cfg)
@@ -194,6 +237,7 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		//TODO: Return a typed error
 		return nil, fmt.Errorf("gocql: unable to create session: %v", err)
 	}
+	connCfg.Logger = s.logger
 	s.connCfg = connCfg
 
 	if err := s.init(); err != nil {
@@ -208,15 +252,22 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		}
 	}
 
+	if cfg.LogEffectiveConfig {
+		s.logger.Printf("gocql: effective configuration: %v\n", s.EffectiveConfig())
+	}
+
 	return s, nil
 }
 
 func (s *Session) init() error {
-	hosts, err := addrsToHosts(s.cfg.Hosts, s.cfg.Port, s.logger)
+	hosts, err := s.contactPoints()
 	if err != nil {
 		return err
 	}
-	s.ring.endpoints = hosts
+
+	if partitioner := staticPartitioner(hosts); partitioner != "" {
+		s.policy.SetPartitioner(partitioner)
+	}
 
 	if !s.cfg.disableControlConn {
 		s.control = createControlConn(s)
@@ -237,7 +288,7 @@ func (s *Session) init() error {
 			return err
 		}
 
-		if !s.cfg.DisableInitialHostLookup {
+		if !s.cfg.DisableInitialHostLookup && s.cfg.HostDiscovery != DiscoverContactPoints {
 			var partitioner string
 			newHosts, partitioner, err := s.hostSource.GetHosts()
 			if err != nil {
@@ -336,11 +387,23 @@ func (s *Session) init() error {
 		go s.reconnectDownedHosts(s.cfg.ReconnectInterval)
 	}
 
+	if s.cfg.SeverityRefreshInterval > 0 && s.control != nil {
+		go s.refreshSeverityLoop(s.cfg.SeverityRefreshInterval)
+	}
+
+	if s.cfg.HealthCheck != nil {
+		go newHealthChecker(s, *s.cfg.HealthCheck).run()
+	}
+
+	if l, ok := s.logger.(*levelLogger); ok && l.sampler != nil {
+		go l.flushSampledLoop(s.ctx)
+	}
+
 	// If we disable the initial host lookup, we need to still check if the
 	// cluster is using the newer system schema or not... however, if control
 	// connection is disable, we really have no choice, so we just make our
 	// best guess...
-	if !s.cfg.disableControlConn && s.cfg.DisableInitialHostLookup {
+	if !s.cfg.disableControlConn && (s.cfg.DisableInitialHostLookup || s.cfg.HostDiscovery == DiscoverContactPoints) {
 		newer, _ := checkSystemSchema(s.control)
 		s.useSystemSchema = newer
 	} else {
@@ -381,6 +444,57 @@ func (s *Session) AwaitSchemaAgreement(ctx context.Context) error {
 	}).err
 }
 
+// refreshSeverityLoop refreshes the severity of the hosts every intv, until the
+// session is closed or the cluster turns out not to expose it.
+func (s *Session) refreshSeverityLoop(intv time.Duration) {
+	ticker := time.NewTicker(intv)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := s.refreshSeverity()
+			if errFrame, ok := err.(errorFrame); ok && errFrame.code == ErrCodeInvalid {
+				// system_views.gossip_info does not exist before Cassandra 4.1
+				s.logger.Printf("gocql: unable to read the severity of hosts: %v\n", err)
+				return
+			} else if err != nil {
+				s.debugf("gocql: unable to refresh the severity of hosts: %v\n", err)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshSeverity reads the severity of the hosts from the gossip state known
+// by the control connection.
+func (s *Session) refreshSeverity() error {
+	iter := s.control.query("SELECT address, severity FROM system_views.gossip_info")
+
+	var (
+		addr     net.IP
+		severity string
+	)
+	for iter.Scan(&addr, &severity) {
+		host, ok := s.ring.getHostByIP(addr.String())
+		if !ok || host == nil {
+			continue
+		}
+		// the severity is absent from the gossip state of idle hosts
+		var value float64
+		if severity != "" {
+			v, err := strconv.ParseFloat(severity, 64)
+			if err != nil {
+				continue
+			}
+			value = v
+		}
+		host.setSeverity(value)
+	}
+	return iter.Close()
+}
+
 func (s *Session) reconnectDownedHosts(intv time.Duration) {
 	reconnectTicker := time.NewTicker(intv)
 	defer reconnectTicker.Stop()
@@ -388,15 +502,19 @@ func (s *Session) reconnectDownedHosts(intv time.Duration) {
 	for {
 		select {
 		case <-reconnectTicker.C:
+			if s.control == nil || s.cfg.HostDiscovery == DiscoverContactPoints {
+				s.refreshContactPoints()
+			}
+
 			hosts := s.ring.allHosts()
 
 			// Print session.ring for debug.
-			if gocqlDebug {
+			if s.debugLogging() {
 				buf := bytes.NewBufferString("Session.ring:")
 				for _, h := range hosts {
-					buf.WriteString("[" + h.ConnectAddress().String() + ":" + h.State().String() + "]")
+					buf.WriteString("[" + h.addressKey() + ":" + h.State().String() + "]")
 				}
-				s.logger.Println(buf.String())
+				s.debugf("%s\n", buf.String())
 			}
 
 			for _, h := range hosts {
@@ -412,6 +530,99 @@ func (s *Session) reconnectDownedHosts(intv time.Duration) {
 	}
 }
 
+// contactPoints returns the hosts the contact points in ClusterConfig.Hosts and
+// from ClusterConfig.ContactPointResolver resolve to, resolving them again if
+// ClusterConfig.ContactPointsTTL has passed since they were last resolved.
+func (s *Session) contactPoints() ([]*HostInfo, error) {
+	s.ring.endpointsMu.Lock()
+	defer s.ring.endpointsMu.Unlock()
+
+	if s.ring.endpoints == nil || time.Since(s.ring.endpointsResolved) >= s.cfg.ContactPointsTTL {
+		addrs := s.cfg.Hosts
+		if s.cfg.ContactPointResolver != nil {
+			resolved, err := s.cfg.ContactPointResolver.ResolveContactPoints(s.ctx)
+			if err != nil {
+				return nil, fmt.Errorf("resolve contact points: %v", err)
+			}
+			addrs = append(addrs[:len(addrs):len(addrs)], resolved...)
+		}
+
+		var hosts []*HostInfo
+		if len(addrs) > 0 {
+			var err error
+			hosts, err = addrsToHosts(addrs, s.cfg.Port, s.logger)
+			if err != nil {
+				return nil, err
+			}
+		}
+		static, err := staticHosts(s.cfg.StaticHosts, s.cfg.Port, s.logger)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, static...)
+		if len(hosts) == 0 {
+			return nil, errors.New("failed to resolve any of the provided hostnames")
+		}
+		s.ring.endpoints = hosts
+		s.ring.endpointsResolved = time.Now()
+	}
+
+	// the hosts are added to the ring and updated, so return copies
+	hosts := make([]*HostInfo, len(s.ring.endpoints))
+	for i, h := range s.ring.endpoints {
+		hosts[i] = &HostInfo{hostname: h.hostname, connectAddress: h.connectAddress, port: h.port, socketPath: h.socketPath,
+			dataCenter: h.dataCenter, rack: h.rack, tokens: h.tokens, partitioner: h.partitioner}
+	}
+	return hosts, nil
+}
+
+// refreshContactPoints replaces the hosts of the ring by the hosts the contact
+// points resolve to if all of them are down, for when the ring is made of the
+// contact points and they changed addresses. It is called every
+// ReconnectInterval when the ring is not discovered; a discovered ring falls
+// back to the contact points when the control connection can not reconnect to
+// any of its hosts instead.
+func (s *Session) refreshContactPoints() {
+	hosts := s.ring.allHosts()
+	for _, h := range hosts {
+		if h.IsUp() {
+			return
+		}
+	}
+
+	resolved, err := s.contactPoints()
+	if err != nil {
+		s.logger.Printf("gocql: unable to resolve contact points: %v\n", err)
+		return
+	}
+
+	stale := make(map[string]*HostInfo, len(hosts))
+	for _, h := range hosts {
+		stale[JoinHostPort(h.addressKey(), h.Port())] = h
+	}
+
+	for _, h := range resolved {
+		addr := JoinHostPort(h.addressKey(), h.Port())
+		if _, ok := stale[addr]; ok {
+			delete(stale, addr)
+			continue
+		}
+		if s.cfg.filterHost(h) {
+			continue
+		}
+
+		s.debugf("gocql: adding resolved contact point %s\n", addr)
+		h.SetHostID(MustRandomUUID().String())
+		host := s.ring.addOrUpdate(h)
+		s.notifyHostAdded(host)
+		s.startPoolFill(host)
+	}
+
+	for _, h := range stale {
+		s.removeHost(h)
+	}
+}
+
 // SetConsistency sets the default consistency level for this session. This
 // setting can also be changed on a per-query basis and the default value
 // is Quorum.
@@ -510,14 +721,16 @@ func (s *Session) Close() {
 		s.schemaEvents.stop()
 	}
 
-	if s.ringRefresher != nil {
-		s.ringRefresher.stop()
-	}
-
+	// cancel before stopping the ring refresher, which waits for a refresh
+	// postponed by a RingRefreshHook.
 	if s.cancel != nil {
 		s.cancel()
 	}
 
+	if s.ringRefresher != nil {
+		s.ringRefresher.stop()
+	}
+
 	s.sessionStateMu.Lock()
 	s.isClosed = true
 	s.sessionStateMu.Unlock()
@@ -537,11 +750,83 @@ func (s *Session) initialized() bool {
 	return initialized
 }
 
+type contextKey int
+
+const (
+	consistencyContextKey contextKey = iota
+	timeoutContextKey
+	writeTimeoutContextKey
+	affinityContextKey
+)
+
+// WithConsistency returns a copy of ctx overriding the consistency level of the
+// queries and batches executed with it, which lets middleware tune execution
+// without access to the Query or Batch. The override applies to the executions
+// with ctx only, the consistency of the Query or Batch is left unchanged.
+func WithConsistency(ctx context.Context, cons Consistency) context.Context {
+	return context.WithValue(ctx, consistencyContextKey, cons)
+}
+
+// ConsistencyFromContext returns the consistency level set by WithConsistency.
+func ConsistencyFromContext(ctx context.Context) (Consistency, bool) {
+	cons, ok := ctx.Value(consistencyContextKey).(Consistency)
+	return cons, ok
+}
+
+// WithTimeout returns a copy of ctx overriding ClusterConfig.Timeout, the time
+// each attempt of the queries and batches executed with it waits for a
+// response. Unlike context.WithTimeout, it bounds every attempt, rather than
+// the whole execution including retries.
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutContextKey, timeout)
+}
+
+// TimeoutFromContext returns the timeout set by WithTimeout.
+func TimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(timeoutContextKey).(time.Duration)
+	return timeout, ok
+}
+
+// WithWriteTimeout returns a copy of ctx overriding ClusterConfig.WriteTimeout,
+// the time each attempt of the queries and batches executed with it waits to
+// write its request to the connection. When write coalescing is enabled, the
+// requests written together share the shortest of their write timeouts.
+func WithWriteTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, writeTimeoutContextKey, timeout)
+}
+
+// WriteTimeoutFromContext returns the write timeout set by WithWriteTimeout.
+func WriteTimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(writeTimeoutContextKey).(time.Duration)
+	return timeout, ok
+}
+
+// WithAffinity returns a copy of ctx making the queries and batches executed
+// with it with the same key prefer the same hosts. The round robin policies
+// start from the same host and TokenAwareHostPolicy picks the same replica
+// first, which improves cache locality and lets a logical session read its
+// own writes at consistency levels such as ONE, as long as the host stays up.
+func WithAffinity(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, affinityContextKey, key)
+}
+
+// AffinityFromContext returns the affinity key set by WithAffinity.
+func AffinityFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(affinityContextKey).(string)
+	return key, ok
+}
+
 func (s *Session) executeQuery(qry *Query) (it *Iter) {
 	// fail fast
 	if s.Closed() {
 		return &Iter{err: ErrSessionClosed}
 	}
+	if cons, ok := ConsistencyFromContext(qry.Context()); ok && cons != qry.cons {
+		// the override applies to this execution only, qry is left unchanged
+		q := *qry
+		q.cons = cons
+		qry = &q
+	}
 
 	iter, err := s.executor.executeQuery(qry)
 	if err != nil {
@@ -558,7 +843,52 @@ func (s *Session) removeHost(h *HostInfo) {
 	s.policy.RemoveHost(h)
 	hostID := h.HostID()
 	s.pool.removeHost(hostID)
-	s.ring.removeHost(hostID)
+	if s.ring.removeHost(hostID) {
+		s.notifyHostRemoved(h)
+	}
+}
+
+// GetHosts returns the hosts known to the session, including hosts which are
+// currently down. The returned hosts can be used with Query.SetHost.
+func (s *Session) GetHosts() []*HostInfo {
+	return s.ring.allHosts()
+}
+
+// HostState is a snapshot of the state of a host and of its connection pool,
+// see Session.State.
+type HostState struct {
+	Host       *HostInfo
+	Up         bool
+	DataCenter string
+	Rack       string
+
+	// Connections is the number of open connections to the host.
+	Connections int
+	// InFlight is the number of requests in flight on the connections.
+	InFlight int
+	// LastError is the last error connecting to the host or closing one of
+	// its connections, nil if there was none.
+	LastError error
+}
+
+// State returns a snapshot of the state of the hosts known to the session and
+// of their connection pools, for example to report the health of the session.
+func (s *Session) State() []HostState {
+	hosts := s.ring.allHosts()
+	states := make([]HostState, 0, len(hosts))
+	for _, host := range hosts {
+		state := HostState{
+			Host:       host,
+			Up:         host.IsUp(),
+			DataCenter: host.DataCenter(),
+			Rack:       host.Rack(),
+		}
+		if pool, ok := s.pool.getPool(host); ok {
+			state.Connections, state.InFlight, state.LastError = pool.stats()
+		}
+		states = append(states, state)
+	}
+	return states
 }
 
 // KeyspaceMetadata returns the schema metadata for the keyspace specified. Returns an error if the keyspace does not exist.
@@ -573,6 +903,225 @@ func (s *Session) KeyspaceMetadata(keyspace string) (*KeyspaceMetadata, error) {
 	return s.schemaDescriber.getSchema(keyspace)
 }
 
+// SetLogLevel changes which messages the session logs, so that debug messages
+// about connections, topology and events can be enabled on a running session.
+func (s *Session) SetLogLevel(level LogLevel) {
+	if l, ok := s.logger.(*levelLogger); ok {
+		l.setLevel(level)
+	}
+}
+
+// LogLevel returns the level of the messages logged by the session.
+func (s *Session) LogLevel() LogLevel {
+	if l, ok := s.logger.(*levelLogger); ok {
+		return l.getLevel()
+	}
+	if gocqlDebug {
+		return LogLevelDebug
+	}
+	return LogLevelWarning
+}
+
+// debugLogging reports whether debug messages are logged.
+func (s *Session) debugLogging() bool {
+	return s.LogLevel() <= LogLevelDebug
+}
+
+// debugf logs a debug message, see LogLevelDebug.
+func (s *Session) debugf(format string, v ...interface{}) {
+	if l, ok := s.logger.(*levelLogger); ok {
+		l.debugf(format, v...)
+	} else if gocqlDebug {
+		s.logger.Printf(format, v...)
+	}
+}
+
+// EnsureKeyspace creates the keyspace name with the given replication options
+// unless it already exists, then waits for schema agreement. The options are
+// those of the replication map of CREATE KEYSPACE, for example:
+//
+//	session.EnsureKeyspace(ctx, "example", map[string]interface{}{
+//		"class": "NetworkTopologyStrategy",
+//		"dc1":   3,
+//	})
+//
+// The name must start with an ASCII letter and may only contain ASCII letters,
+// digits and underscores, and is case-insensitive like the unquoted names of
+// CQL: the keyspace is created lower-cased.
+//
+// The replication factors are validated against the datacenters of all the
+// peers in system.local and system.peers, including the hosts rejected by the
+// HostFilter or not discovered: an error is returned for a datacenter without
+// any peer, and a warning is logged when a replication factor exceeds the
+// number of peers. Without a control connection they are validated against
+// the known hosts, and only warnings are logged.
+func (s *Session) EnsureKeyspace(ctx context.Context, name string, replication map[string]interface{}) error {
+	if name == "" {
+		return ErrNoKeyspace
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		letter := ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+		if !letter && (i == 0 || (c != '_' && !('0' <= c && c <= '9'))) {
+			return fmt.Errorf("gocql: invalid keyspace name %q", name)
+		}
+	}
+	name = strings.ToLower(name)
+
+	// the ring lacks the hosts rejected by the HostFilter or not discovered,
+	// so the datacenters are looked up in the system tables when possible.
+	hosts, allPeers := s.ring.allHosts(), false
+	if peers, err := s.hostSource.allPeers(); err == nil {
+		hosts, allPeers = peers, true
+	}
+	warnings, err := validateKeyspaceReplication(replication, hosts, allPeers)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		s.logger.Printf("gocql: keyspace %q: %s", name, warning)
+	}
+
+	_, err = s.KeyspaceMetadata(name)
+	if err == nil {
+		return nil
+	} else if err != ErrKeyspaceDoesNotExist {
+		return err
+	}
+
+	stmt := fmt.Sprintf("CREATE KEYSPACE IF NOT EXISTS %s WITH replication = %s", name, replicationLiteral(replication))
+	if err := s.Query(stmt).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	if s.cfg.disableControlConn {
+		return nil
+	}
+	return s.AwaitSchemaAgreement(ctx)
+}
+
+// validateKeyspaceReplication checks the replication options of a keyspace
+// against hosts, returning warnings for replication factors greater than the
+// number of hosts which would hold the replicas. A datacenter without hosts is
+// an error if hosts are all the peers of the cluster, else a warning.
+func validateKeyspaceReplication(replication map[string]interface{}, hosts []*HostInfo, allPeers bool) ([]string, error) {
+	class, _ := replication["class"].(string)
+	if class == "" {
+		return nil, errors.New("gocql: replication class is missing")
+	}
+
+	dcHosts := make(map[string]int)
+	for _, host := range hosts {
+		dcHosts[host.DataCenter()]++
+	}
+
+	var warnings []string
+	switch {
+	case strings.HasSuffix(class, "SimpleStrategy"):
+		rf, err := getReplicationFactorFromOpts(replication["replication_factor"])
+		if err != nil {
+			return nil, fmt.Errorf("gocql: %v", err)
+		}
+		if rf > len(hosts) {
+			warnings = append(warnings, fmt.Sprintf("replication factor %d is greater than the %d hosts of the cluster", rf, len(hosts)))
+		}
+	case strings.HasSuffix(class, "NetworkTopologyStrategy"):
+		// replication_factor is the default of the datacenters which are
+		// not listed, since Cassandra 4.0.
+		dcs := make([]string, 0, len(replication))
+		for dc := range replication {
+			if dc != "class" && dc != "replication_factor" {
+				dcs = append(dcs, dc)
+			}
+		}
+		sort.Strings(dcs)
+		for _, dc := range dcs {
+			rf, err := getReplicationFactorFromOpts(replication[dc])
+			if err != nil {
+				return nil, fmt.Errorf("gocql: datacenter %q: %v", dc, err)
+			}
+			n, ok := dcHosts[dc]
+			if !ok && allPeers {
+				return nil, fmt.Errorf("gocql: datacenter %q has no hosts", dc)
+			} else if !ok {
+				warnings = append(warnings, fmt.Sprintf("datacenter %q has no known hosts", dc))
+			} else if rf > n {
+				warnings = append(warnings, fmt.Sprintf("replication factor %d is greater than the %d hosts of datacenter %q", rf, n, dc))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// replicationLiteral formats replication options as a CQL map literal.
+func replicationLiteral(replication map[string]interface{}) string {
+	keys := make([]string, 0, len(replication))
+	for key := range replication {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(QuoteString(key) + ": " + QuoteString(fmt.Sprint(replication[key])))
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// EffectiveConfig returns the configuration in effect for the session, with
+// the protocol version negotiated with the cluster and the host selection
+// policy used when none was configured.
+func (s *Session) EffectiveConfig() EffectiveConfig {
+	c := newEffectiveConfig(&s.cfg)
+	c.Settings["PoolConfig.HostSelectionPolicy"] = fmt.Sprintf("%T", s.policy)
+	return c
+}
+
+// TokenMetadata returns a snapshot of the token ring of the cluster, to compute
+// the token and the replicas of partitions or to list the token ranges, for
+// example to scan tables by token range on the replicas of each range.
+func (s *Session) TokenMetadata() (*TokenMetadata, error) {
+	s.metadata.mu.RLock()
+	partitioner := s.metadata.partitioner
+	s.metadata.mu.RUnlock()
+	if partitioner == "" {
+		return nil, errors.New("gocql: partitioner is not known")
+	}
+
+	tokenRing, err := newTokenRing(partitioner, s.ring.allHosts())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenMetadata{
+		ring:             tokenRing,
+		keyspaceMetadata: s.KeyspaceMetadata,
+		logger:           s.logger,
+		replicas:         make(map[string]tokenRingReplicas),
+	}, nil
+}
+
+// TokenOwnership reports the fraction of the token ring each known host owns
+// for keyspace, according to the replication strategy of the keyspace. Uneven
+// ownership skews the routing of token aware queries; use
+// TokenOwnership.Imbalanced to detect it.
+func (s *Session) TokenOwnership(keyspace string) (*TokenOwnership, error) {
+	m, err := s.TokenMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	replicas, err := m.keyspaceReplicas(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	return tokenOwnership(keyspace, m.ring, replicas)
+}
+
 func (s *Session) getConn() *Conn {
 	hosts := s.ring.allHosts()
 	for _, host := range hosts {
@@ -665,6 +1214,7 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 			types:    types,
 			keyspace: keyspace,
 			table:    table,
+			codecs:   s.cfg.Codecs,
 		}
 
 		inflight.value = routingKeyInfo
@@ -698,6 +1248,7 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 		types:    make([]TypeInfo, size),
 		keyspace: keyspace,
 		table:    table,
+		codecs:   s.cfg.Codecs,
 	}
 
 	for keyIndex, keyColumn := range partitionKey {
@@ -743,6 +1294,15 @@ func (s *Session) executeBatch(batch *Batch) *Iter {
 	if batch.Size() > BatchSizeMaximum {
 		return &Iter{err: ErrTooManyStmts}
 	}
+	if err := validateSerialConsistency(batch.serialCons); err != nil {
+		return &Iter{err: err}
+	}
+	if cons, ok := ConsistencyFromContext(batch.Context()); ok && cons != batch.Cons {
+		// the override applies to this execution only, batch is left unchanged
+		b := *batch
+		b.Cons = cons
+		batch = &b
+	}
 
 	iter, err := s.executor.executeQuery(batch)
 	if err != nil {
@@ -754,17 +1314,125 @@ func (s *Session) executeBatch(batch *Batch) *Iter {
 
 // ExecuteBatch executes a batch operation and returns nil if successful
 // otherwise an error is returned describing the failure.
+//
+// A batch with a BatchSplit is executed with Session.ExecuteBatchSplit.
 func (s *Session) ExecuteBatch(batch *Batch) error {
+	if batch.split != nil {
+		_, err := s.ExecuteBatchSplit(batch)
+		return err
+	}
 	iter := s.executeBatch(batch)
 	return iter.Close()
 }
 
+// ConcurrentOptions configures Session.ExecuteConcurrent.
+type ConcurrentOptions struct {
+	// Concurrency is the maximum number of queries executed at the same
+	// time, 16 if 0.
+	Concurrency int
+
+	// FailFast stops executing the queries after the first failure: the
+	// queries which are not started yet are skipped and the context of the
+	// running ones is canceled.
+	FailFast bool
+
+	// Handle, if not nil, is called with the iterator of each query, for
+	// example to scan the rows read by the query, and returns the error of
+	// the query, usually iter.Close(). The queries are executed with Exec
+	// otherwise. It is called concurrently for different queries.
+	Handle func(i int, iter *Iter) error
+}
+
+// ConcurrentError is returned by Session.ExecuteConcurrent when queries fail.
+type ConcurrentError struct {
+	// Errors are the errors of the failed queries, by index of the query.
+	Errors map[int]error
+	// Skipped is the number of queries which were not executed because
+	// FailFast was set.
+	Skipped int
+}
+
+func (e *ConcurrentError) Error() string {
+	first := -1
+	for i := range e.Errors {
+		if first == -1 || i < first {
+			first = i
+		}
+	}
+	return fmt.Sprintf("gocql: %d queries failed, %d skipped, query %d: %v", len(e.Errors), e.Skipped, first, e.Errors[first])
+}
+
+// ExecuteConcurrent executes the independent queries, at most
+// opts.Concurrency at the same time, for example to read a list of
+// partitions. It returns nil if all the queries succeeded, or a
+// *ConcurrentError otherwise. The queries are executed with ctx.
+func (s *Session) ExecuteConcurrent(ctx context.Context, queries []*Query, opts ConcurrentOptions) error {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 16
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    = make(map[int]error)
+		skipped int
+		sem     = make(chan struct{}, concurrency)
+	)
+	for i, qry := range queries {
+		sem <- struct{}{}
+		if opts.FailFast && ctx.Err() != nil {
+			<-sem
+			skipped = len(queries) - i
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, qry *Query) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			var err error
+			qry = qry.WithContext(ctx)
+			if opts.Handle != nil {
+				err = opts.Handle(i, qry.Iter())
+			} else {
+				err = qry.Exec()
+			}
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			errs[i] = err
+			mu.Unlock()
+			if opts.FailFast {
+				cancel()
+			}
+		}(i, qry)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ConcurrentError{Errors: errs, Skipped: skipped}
+}
+
 // ExecuteBatchCAS executes a batch operation and returns true if successful and
 // an iterator (to scan additional rows if more than one conditional statement)
 // was sent.
 // Further scans on the interator must also remember to include
 // the applied boolean as the first argument to *Iter.Scan
 func (s *Session) ExecuteBatchCAS(batch *Batch, dest ...interface{}) (applied bool, iter *Iter, err error) {
+	if batch.split != nil {
+		return false, nil, ErrBatchSplitCAS
+	}
 	iter = s.executeBatch(batch)
 	if err := iter.checkErrAndNotFound(); err != nil {
 		iter.Close()
@@ -785,6 +1453,9 @@ func (s *Session) ExecuteBatchCAS(batch *Batch, dest ...interface{}) (applied bo
 // however it accepts a map rather than a list of arguments for the initial
 // scan.
 func (s *Session) MapExecuteBatchCAS(batch *Batch, dest map[string]interface{}) (applied bool, iter *Iter, err error) {
+	if batch.split != nil {
+		return false, nil, ErrBatchSplitCAS
+	}
 	iter = s.executeBatch(batch)
 	if err := iter.checkErrAndNotFound(); err != nil {
 		iter.Close()
@@ -800,6 +1471,16 @@ func (s *Session) MapExecuteBatchCAS(batch *Batch, dest map[string]interface{})
 	return applied, iter, iter.err
 }
 
+// ExecuteBatchCASResult executes a batch lightweight transaction and returns
+// its outcome along with the existing values of every row whose condition was
+// not met.
+func (s *Session) ExecuteBatchCASResult(batch *Batch) (*CASResult, error) {
+	if batch.split != nil {
+		return nil, ErrBatchSplitCAS
+	}
+	return scanCASResult(s.executeBatch(batch))
+}
+
 type hostMetrics struct {
 	// Attempts is count of how many times this query has been attempted for this host.
 	// An attempt is either a retry or fetching next page of results.
@@ -840,11 +1521,11 @@ func (qm *queryMetrics) hostMetrics(host *HostInfo) *hostMetrics {
 // hostMetricsLocked gets or creates host metrics for given host.
 // It must be called only while holding qm.l lock.
 func (qm *queryMetrics) hostMetricsLocked(host *HostInfo) *hostMetrics {
-	metrics, exists := qm.m[host.ConnectAddress().String()]
+	metrics, exists := qm.m[host.addressKey()]
 	if !exists {
 		// if the host is not in the map, it means it's been accessed for the first time
 		metrics = &hostMetrics{}
-		qm.m[host.ConnectAddress().String()] = metrics
+		qm.m[host.addressKey()] = metrics
 	}
 
 	return metrics
@@ -900,11 +1581,18 @@ func (qm *queryMetrics) attempt(addAttempts int, addLatency time.Duration,
 }
 
 // Query represents a CQL statement that can be executed.
+//
+// A Query must not be modified or executed by several goroutines at the same
+// time, including its pages when iterating. Queries sharing a statement and
+// options are created with a QueryTemplate.
 type Query struct {
-	stmt                  string
-	values                []interface{}
-	cons                  Consistency
-	pageSize              int
+	stmt     string
+	values   []interface{}
+	cons     Consistency
+	pageSize int
+	// adaptivePageSize is true when the page size is adapted by the session,
+	// see ClusterConfig.AdaptivePageSize.
+	adaptivePageSize      bool
 	routingKey            []byte
 	pageState             []byte
 	prefetch              float64
@@ -919,14 +1607,37 @@ type Query struct {
 	defaultTimestamp      bool
 	defaultTimestampValue int64
 	disableSkipMetadata   bool
+	disableCompression    bool
+	rowErrorPolicy        RowErrorPolicy
 	context               context.Context
 	idempotent            bool
 	customPayload         map[string][]byte
+	executeAs             string
+	keyspace              string
+	traceProbability      float64
 	metrics               *queryMetrics
 	refCount              uint32
+	host                  *HostInfo
+	// pinnedConn is the connection the query is pinned to, see SetConn.
+	pinnedConn *Conn
 
 	disableAutoPage bool
 
+	// beforePage is called before fetching each page after the first, page
+	// is the number of the page the query fetches.
+	beforePage func(q *Query, page int)
+	page       int
+
+	// pageRetries is the number of times a failed page after the first is
+	// fetched again, see PageRetries. failedHosts are the hosts a fetch of
+	// the page failed on, which are tried last when it is fetched again.
+	pageRetries int
+	failedHosts []*HostInfo
+
+	// expandIn is the number of the queries per key of the IN clause that
+	// are executed at the same time, 0 if the IN clause is not expanded.
+	expandIn int
+
 	// getKeyspace is field so that it can be overriden in tests
 	getKeyspace func() string
 
@@ -953,13 +1664,16 @@ func (q *Query) defaultsFromSession() {
 	s.mu.RLock()
 	q.cons = s.cons
 	q.pageSize = s.pageSize
+	q.adaptivePageSize = s.pageSizes != nil
 	q.trace = s.trace
+	q.traceProbability = s.cfg.TraceProbability
 	q.observer = s.queryObserver
 	q.prefetch = s.prefetch
 	q.rt = s.cfg.RetryPolicy
 	q.serialCons = s.cfg.SerialConsistency
 	q.defaultTimestamp = s.cfg.DefaultTimestamp
 	q.idempotent = s.cfg.DefaultIdempotence
+	q.executeAs = s.cfg.ExecuteAs
 	q.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
 
 	q.spec = &NonSpeculativeExecution{}
@@ -1025,6 +1739,81 @@ func (q *Query) CustomPayload(customPayload map[string][]byte) *Query {
 	return q
 }
 
+// ExecuteAs executes the query on behalf of user with the proxy execution of
+// DSE, so that services authenticated once can execute queries with the
+// permissions of their end users. The role of the session must be granted
+// PROXY.EXECUTE on the role of user. An empty user executes the query as the
+// role of the session, overriding ClusterConfig.ExecuteAs. The user is sent in
+// the custom payload, which requires protocol version 4 or later.
+func (q *Query) ExecuteAs(user string) *Query {
+	q.executeAs = user
+	return q
+}
+
+// SetKeyspace sets the keyspace in which the tables of the query which are not
+// qualified with a keyspace are resolved, instead of the keyspace of the
+// session. This allows a single session to execute queries in many keyspaces.
+// With protocol version 5 or later the keyspace is sent with the query.
+// Otherwise the table of SELECT, INSERT, UPDATE and DELETE statements is
+// qualified with the keyspace, and executing other statements fails.
+func (q *Query) SetKeyspace(keyspace string) *Query {
+	q.keyspace = keyspace
+	return q
+}
+
+// qualifiedTableRe matches the table of SELECT, INSERT, UPDATE and DELETE
+// statements, followed by a dot if it is qualified with a keyspace.
+var qualifiedTableRe = regexp.MustCompile(`(?is)^\s*(?:select\s.*?\sfrom|insert\s+into|update|delete(?:\s.*?)?\sfrom)\s+("(?:[^"]|"")+"|\w+)(\s*\.)?`)
+
+// qualifyStatement qualifies the table of stmt with keyspace, unless it is
+// already qualified.
+func qualifyStatement(stmt, keyspace string) (string, error) {
+	m := qualifiedTableRe.FindStringSubmatchIndex(stmt)
+	if m == nil {
+		return "", fmt.Errorf("gocql: unable to qualify statement with keyspace %q, protocol version 5 or later is required", keyspace)
+	}
+	if m[4] >= 0 {
+		// already qualified
+		return stmt, nil
+	}
+	return stmt[:m[2]] + QuoteIdentifier(keyspace) + "." + stmt[m[2]:], nil
+}
+
+// routingStatement returns the statement prepared to determine the routing key
+// of the query, which is qualified with the keyspace set with SetKeyspace.
+func (q *Query) routingStatement() string {
+	if q.keyspace == "" {
+		return q.stmt
+	}
+	if stmt, err := qualifyStatement(q.stmt, q.keyspace); err == nil {
+		return stmt
+	}
+	return q.stmt
+}
+
+// payload returns the custom payload of the request frames of the query.
+func (q *Query) payload() map[string][]byte {
+	return proxyExecutePayload(q.customPayload, q.executeAs)
+}
+
+// proxyExecuteKey is the custom payload key of the user a request is executed
+// on behalf of by DSE.
+const proxyExecuteKey = "ProxyExecute"
+
+// proxyExecutePayload returns a copy of payload with the user to execute a
+// request on behalf of, payload itself if user is empty.
+func proxyExecutePayload(payload map[string][]byte, user string) map[string][]byte {
+	if user == "" {
+		return payload
+	}
+	withUser := make(map[string][]byte, len(payload)+1)
+	for k, v := range payload {
+		withUser[k] = v
+	}
+	withUser[proxyExecuteKey] = []byte(user)
+	return withUser
+}
+
 func (q *Query) Context() context.Context {
 	if q.context == nil {
 		return context.Background()
@@ -1039,6 +1828,14 @@ func (q *Query) Trace(trace Tracer) *Query {
 	return q
 }
 
+// TraceProbability sets the probability, between 0 and 1, with which the
+// attempts of the query are traced when it has no Tracer, overriding
+// ClusterConfig.TraceProbability.
+func (q *Query) TraceProbability(p float64) *Query {
+	q.traceProbability = p
+	return q
+}
+
 // Observer enables query-level observer on this query.
 // The provided observer will be called every time this query is executed.
 func (q *Query) Observer(observer QueryObserver) *Query {
@@ -1050,8 +1847,12 @@ func (q *Query) Observer(observer QueryObserver) *Query {
 // This is useful for iterating over large result sets, but setting the
 // page size too low might decrease the performance. This feature is only
 // available in Cassandra 2 and onwards.
+//
+// The page size of the query is not adapted by ClusterConfig.AdaptivePageSize
+// once set.
 func (q *Query) PageSize(n int) *Query {
 	q.pageSize = n
+	q.adaptivePageSize = false
 	return q
 }
 
@@ -1115,6 +1916,10 @@ func (q *Query) attempt(keyspace string, end, start time.Time, iter *Iter, host
 	latency := end.Sub(start)
 	attempt, metricsForHost := q.metrics.attempt(1, latency, host, q.observer != nil)
 
+	if q.session != nil {
+		q.session.slowQueries.report(q, keyspace, start, latency, iter, host, attempt)
+	}
+
 	if q.observer != nil {
 		q.observer.ObserveQuery(q.Context(), ObservedQuery{
 			Keyspace:  keyspace,
@@ -1127,6 +1932,8 @@ func (q *Query) attempt(keyspace string, end, start time.Time, iter *Iter, host
 			Metrics:   metricsForHost,
 			Err:       iter.err,
 			Attempt:   attempt,
+			TraceID:   iter.traceID(),
+			Warnings:  iter.Warnings(),
 		})
 	}
 }
@@ -1143,6 +1950,9 @@ func (q *Query) Keyspace() string {
 	if q.routingInfo.keyspace != "" {
 		return q.routingInfo.keyspace
 	}
+	if q.keyspace != "" {
+		return q.keyspace
+	}
 
 	if q.session == nil {
 		return ""
@@ -1164,6 +1974,10 @@ func (q *Query) Table() string {
 // then nil will be returned with no error. On any error condition,
 // an error description will be returned.
 func (q *Query) GetRoutingKey() ([]byte, error) {
+	return q.getRoutingKey(q.Context())
+}
+
+func (q *Query) getRoutingKey(ctx context.Context) ([]byte, error) {
 	if q.routingKey != nil {
 		return q.routingKey, nil
 	} else if q.binding != nil && len(q.values) == 0 {
@@ -1173,19 +1987,95 @@ func (q *Query) GetRoutingKey() ([]byte, error) {
 		return nil, nil
 	}
 
-	// try to determine the routing key
-	routingKeyInfo, err := q.session.routingKeyInfo(q.Context(), q.stmt)
+	// try to determine the routing key
+	routingKeyInfo, err := q.session.routingKeyInfo(ctx, q.routingStatement())
+	if err != nil {
+		return nil, err
+	}
+
+	if routingKeyInfo != nil {
+		q.routingInfo.mu.Lock()
+		q.routingInfo.keyspace = routingKeyInfo.keyspace
+		q.routingInfo.table = routingKeyInfo.table
+		q.routingInfo.mu.Unlock()
+	}
+	return createRoutingKey(routingKeyInfo, q.values)
+}
+
+// QueryPlan describes how a query would be routed, see Query.Explain.
+type QueryPlan struct {
+	// RoutingKey is the partition key of the query, nil if it could not be
+	// determined.
+	RoutingKey []byte
+	// Token is the token of RoutingKey, empty if the routing key or the
+	// partitioner is not known.
+	Token string
+	// Hosts are the hosts the query would be sent to, in the order they would
+	// be tried.
+	Hosts []*HostInfo
+	// Deferred are the hosts of Hosts which are only tried after the others,
+	// for example because of their latency or severity.
+	Deferred []*HostInfo
+	// Skipped are the hosts the query would not be sent to, because they are
+	// down or their circuit is open.
+	Skipped []*HostInfo
+	// Consistency is the consistency level the query would be executed with.
+	Consistency Consistency
+	// TokenAware is true if the hosts were chosen from the replicas of Token.
+	TokenAware bool
+}
+
+// Explain returns how the query would be routed without executing it. To
+// compute the routing key the statement may be prepared, using ctx.
+//
+// The hosts are those the HostSelectionPolicy would pick at the time of the
+// call, so policies which shuffle hosts may return a different order every
+// time. The policies of this package tell their hosts without changing their
+// state; other policies are asked to Pick the hosts.
+func (q *Query) Explain(ctx context.Context) (*QueryPlan, error) {
+	s := q.session
+
+	plan := &QueryPlan{Consistency: q.cons}
+	if cons, ok := ConsistencyFromContext(ctx); ok {
+		plan.Consistency = cons
+	}
+
+	if q.host != nil {
+		plan.Hosts = []*HostInfo{q.host}
+		return plan, nil
+	}
+
+	routingKey, err := q.getRoutingKey(ctx)
 	if err != nil {
 		return nil, err
 	}
+	plan.RoutingKey = routingKey
 
-	if routingKeyInfo != nil {
-		q.routingInfo.mu.Lock()
-		q.routingInfo.keyspace = routingKeyInfo.keyspace
-		q.routingInfo.table = routingKeyInfo.table
-		q.routingInfo.mu.Unlock()
+	hosts := planHosts(s.policy, q)
+	if len(q.failedHosts) > 0 {
+		// the hosts which failed to fetch the page are tried last, as when
+		// the query is executed
+		hosts = hosts.deferHosts(func(host *HostInfo) bool {
+			return containsHost(q.failedHosts, host)
+		})
 	}
-	return createRoutingKey(routingKeyInfo, q.values)
+	plan.Hosts, plan.Deferred, plan.Skipped = hosts.hosts, hosts.deferred, hosts.skipped
+
+	if routingKey != nil {
+		p := hosts.partitioner
+		plan.TokenAware = p != nil
+		if p == nil {
+			s.metadata.mu.RLock()
+			name := s.metadata.partitioner
+			s.metadata.mu.RUnlock()
+			p, _ = newPartitioner(name)
+		}
+		if p != nil {
+			plan.Token = p.Hash(routingKey).String()
+		}
+	}
+
+	return plan, nil
 }
 
 func (q *Query) shouldPrepare() bool {
@@ -1210,6 +2100,54 @@ func (q *Query) shouldPrepare() bool {
 	return false
 }
 
+// SetHost pins the query to the given host. The query, its retries and any
+// following pages are sent only to this host and the HostSelectionPolicy is
+// bypassed, which is useful for admin operations such as querying system.local
+// on every node. If the host is down or has no connections the query fails
+// with ErrNoConnections. Speculative execution is disabled for pinned queries.
+//
+// The retries stop at the pinned host: the RetryPolicy may retry the query on
+// it, but a RetryNextHost decision ends the retries with the last error, as
+// there is no other host to try. The connection of the query is picked from
+// the pool of the host, see SetConn to pin the query to a connection.
+//
+// Passing nil restores the default behavior of using the HostSelectionPolicy.
+// Hosts can be obtained with Session.GetHosts or Iter.Host.
+func (q *Query) SetHost(host *HostInfo) *Query {
+	q.host = host
+	q.pinnedConn = nil
+	return q
+}
+
+// SetConn pins the query to the given connection, and so to its host, like
+// SetHost. The query, its retries and any following pages are sent only on
+// this connection, which is useful for the statements whose effect is bound to
+// a connection. If the connection is closed the query fails with
+// ErrConnectionClosed.
+//
+// Passing nil restores the default behavior of using the HostSelectionPolicy.
+// Connections can be obtained with Iter.Conn.
+func (q *Query) SetConn(conn *Conn) *Query {
+	q.pinnedConn = conn
+	q.host = nil
+	if conn != nil {
+		q.host = conn.host
+	}
+	return q
+}
+
+// GetConn returns the connection the query is pinned to, or nil if it is not
+// pinned to a connection.
+func (q *Query) GetConn() *Conn {
+	return q.pinnedConn
+}
+
+// GetHost returns the host the query is pinned to, or nil if the query is
+// routed by the HostSelectionPolicy.
+func (q *Query) GetHost() *HostInfo {
+	return q.host
+}
+
 // SetPrefetch sets the default threshold for pre-fetching new pages. If
 // there are only p*pageSize rows remaining, the next page will be requested
 // automatically.
@@ -1252,7 +2190,7 @@ func (q *Query) Idempotent(value bool) *Query {
 }
 
 // Bind sets query arguments of query. This can also be used to rebind new query arguments
-// to an existing query instance.
+// to an existing query instance. Arguments can be UnsetValue to leave columns unset.
 func (q *Query) Bind(v ...interface{}) *Query {
 	q.values = v
 	q.pageState = nil
@@ -1291,6 +2229,68 @@ func (q *Query) NoSkipMetadata() *Query {
 	return q
 }
 
+// SetRowErrorPolicy sets what happens when a row of the result of the query fails
+// to unmarshal into the values passed to Iter.Scan. The default AbortOnRowError
+// stops the iteration with the error.
+func (q *Query) SetRowErrorPolicy(policy RowErrorPolicy) *Query {
+	q.rowErrorPolicy = policy
+	return q
+}
+
+// BeforePage sets a function called before each page of the result after the
+// first is fetched, with the query fetching the page and the number of the
+// page, 1 for the second page. The function can change the query of the page,
+// for example to lower its consistency when the cluster becomes unhealthy
+// during a long iteration, instead of failing it, or to pin it to a host with
+// SetHost. The changes apply to the following pages too.
+//
+// With Prefetch the function is called from another goroutine than the one
+// iterating.
+func (q *Query) BeforePage(fn func(q *Query, page int)) *Query {
+	q.beforePage = fn
+	return q
+}
+
+// PageRetries sets the number of times a page of the result after the first is
+// fetched again when its fetch fails, once the retry policy of the query gave
+// up, so that a long iteration is not interrupted by the failure of a replica.
+// The page is fetched again with the paging state of the failed fetch, from
+// the other hosts of the query plan before the ones it failed on. Only the
+// pages of idempotent queries are fetched again.
+//
+// Default: 0
+func (q *Query) PageRetries(n int) *Query {
+	q.pageRetries = n
+	return q
+}
+
+// ExpandIn makes Iter execute a SELECT restricting the partition key with an
+// IN clause as one query per key of the clause, at most concurrency at the
+// same time, so that each is routed to the replicas of its key instead of a
+// single coordinator fetching them all. The rows of the queries are returned
+// in the order of the keys, and their pages are fetched as usual.
+//
+// The IN clause must be the only one of the statement and use bind markers,
+// either IN ? bound to a slice or IN (?, ?, ...), and there must be no other
+// question mark before it in the statement. Its column must be a column of the
+// partition key, and the statement must not have a LIMIT, ORDER BY or GROUP BY
+// clause or select an aggregate, whose results would be computed per key
+// rather than over all the keys. The statement is executed as is otherwise.
+// Set concurrency to 0 to disable the expansion.
+func (q *Query) ExpandIn(concurrency int) *Query {
+	q.expandIn = concurrency
+	return q
+}
+
+// NoCompression disables compression of the request frames of the query even if
+// a Compressor is configured for the session. This saves CPU when the values bound
+// to the query are incompressible, for example already compressed blobs.
+// Responses may still be compressed by the server.
+func (q *Query) NoCompression() *Query {
+	q.disableCompression = true
+	return q
+}
+
 // Exec executes the query without returning any rows.
 func (q *Query) Exec() error {
 	return q.Iter().Close()
@@ -1315,9 +2315,127 @@ func (q *Query) Iter() *Iter {
 	if q.conn != nil {
 		return q.conn.executeQuery(q.Context(), q)
 	}
+	if q.expandIn > 0 {
+		if queries := q.expandInClause(); queries != nil {
+			return iterExpanded(queries, q.expandIn)
+		}
+	}
 	return q.session.executeQuery(q)
 }
 
+// inClauseRe matches the IN clauses with bind markers.
+var inClauseRe = regexp.MustCompile(`(?i)\bIN\s*(\?|\(\s*\?(?:\s*,\s*\?)*\s*\))`)
+
+// perKeyClauseRe matches the clauses of SELECT statements whose results are
+// computed over all the keys of an IN clause: limits, orderings, groupings and
+// aggregates. PER PARTITION LIMIT applies to each key and is removed before
+// matching.
+var (
+	perKeyClauseRe      = regexp.MustCompile(`(?i)\b(LIMIT|ORDER\s+BY|GROUP\s+BY)\b|\b(count|min|max|sum|avg)\s*\(`)
+	perPartitionLimitRe = regexp.MustCompile(`(?i)\bPER\s+PARTITION\s+LIMIT\b`)
+)
+
+// expandInClause returns the queries per key of the IN clause of q, or nil if
+// q can not be expanded.
+func (q *Query) expandInClause() []*Query {
+	if stmt := strings.TrimSpace(q.stmt); q.binding != nil || len(stmt) < 6 || !strings.EqualFold(stmt[:6], "select") {
+		return nil
+	}
+	if perKeyClauseRe.MatchString(perPartitionLimitRe.ReplaceAllString(q.stmt, "")) {
+		return nil
+	}
+	matches := inClauseRe.FindAllStringSubmatchIndex(q.stmt, -1)
+	if len(matches) != 1 {
+		return nil
+	}
+	start, end := matches[0][0], matches[0][1]
+	argIndex := strings.Count(q.stmt[:start], "?")
+	markers := strings.Count(q.stmt[start:end], "?")
+	if len(q.values) < argIndex+markers {
+		return nil
+	}
+
+	var keys []interface{}
+	if q.stmt[matches[0][2]] == '?' {
+		v := reflect.ValueOf(q.values[argIndex])
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array || v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			keys = append(keys, v.Index(i).Interface())
+		}
+	} else {
+		keys = q.values[argIndex : argIndex+markers]
+	}
+
+	stmt := q.stmt[:start] + "= ?" + q.stmt[end:]
+	queries := make([]*Query, len(keys))
+	for i, key := range keys {
+		values := make([]interface{}, 0, len(q.values)-markers+1)
+		values = append(values, q.values[:argIndex]...)
+		values = append(values, key)
+		values = append(values, q.values[argIndex+markers:]...)
+
+		qry := new(Query)
+		*qry = *q
+		qry.stmt = stmt
+		qry.values = values
+		qry.routingKey = nil
+		qry.routingInfo = &queryRoutingInfo{}
+		qry.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
+		qry.refCount = 1
+		qry.expandIn = 0
+		qry.beforePage = nil
+		queries[i] = qry
+	}
+
+	// the IN clause of a clustering column selects rows of the same partition
+	if len(queries) > 0 && !q.session.isPartitionKeyMarker(q.Context(), queries[0].routingStatement(), argIndex) {
+		return nil
+	}
+	return queries
+}
+
+// isPartitionKeyMarker reports whether the bind marker at index of stmt binds a
+// column of the partition key.
+func (s *Session) isPartitionKeyMarker(ctx context.Context, stmt string, index int) bool {
+	info, err := s.routingKeyInfo(ctx, stmt)
+	if err != nil || info == nil {
+		return false
+	}
+	for _, i := range info.indexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// iterExpanded returns the iterator over the rows of queries, in order, which
+// fetches the first page of at most concurrency queries ahead.
+func iterExpanded(queries []*Query, concurrency int) *Iter {
+	if len(queries) == 0 {
+		return &Iter{}
+	}
+
+	iters := make([]*nextIter, len(queries))
+	for i, qry := range queries {
+		iters[i] = &nextIter{qry: qry}
+	}
+	for i, n := range iters {
+		if i+1 < len(iters) {
+			n.then = iters[i+1]
+		}
+		if i+concurrency < len(iters) {
+			n.ahead = iters[i+concurrency]
+		}
+	}
+	for i := 1; i < concurrency && i < len(iters); i++ {
+		iters[i].fetchAsync()
+	}
+	return iters[0].fetch()
+}
+
 // MapScan executes the query, copies the columns of the first selected
 // row into the map pointed at by m and discards the rest. If no rows
 // were selected, ErrNotFound is returned.
@@ -1386,6 +2504,113 @@ func (q *Query) MapScanCAS(dest map[string]interface{}) (applied bool, err error
 	return applied, iter.Close()
 }
 
+// CASResult executes a lightweight transaction (i.e. an UPDATE or INSERT
+// statement containing an IF clause) and returns its outcome. Unlike ScanCAS
+// and MapScanCAS, the existing values are returned along with the metadata of
+// their columns, so they do not have to be known beforehand.
+func (q *Query) CASResult() (*CASResult, error) {
+	q.disableSkipMetadata = true
+	return scanCASResult(q.Iter())
+}
+
+// CASResult is the outcome of a lightweight transaction.
+type CASResult struct {
+	// Applied reports whether the conditions of the transaction were met.
+	Applied bool
+
+	// Columns describes the existing values returned when the transaction was
+	// not applied, excluding the [applied] column.
+	Columns []ColumnInfo
+
+	// Rows holds the existing values of the rows whose condition was not met,
+	// keyed by column name. A batch returns one row for each row targeted by
+	// a conditional statement. The values are nil for rows which do not exist.
+	Rows []map[string]interface{}
+}
+
+// Existing returns the existing value of column in the first row returned by
+// a transaction which was not applied.
+func (r *CASResult) Existing(column string) (interface{}, bool) {
+	if len(r.Rows) == 0 {
+		return nil, false
+	}
+	val, ok := r.Rows[0][column]
+	return val, ok
+}
+
+// Conflicts returns the columns whose existing value in the first row differs
+// from the expected one. Expected values are compared after being marshalled
+// with the type of their column, and columns missing from the result are
+// reported as conflicting.
+func (r *CASResult) Conflicts(expected map[string]interface{}) ([]string, error) {
+	if r.Applied {
+		return nil, nil
+	}
+
+	var conflicts []string
+	for name, want := range expected {
+		col, ok := r.column(name)
+		if !ok || len(r.Rows) == 0 {
+			conflicts = append(conflicts, name)
+			continue
+		}
+		wantData, err := Marshal(col.TypeInfo, want)
+		if err != nil {
+			return nil, fmt.Errorf("gocql: unable to marshal expected value of column %q: %v", name, err)
+		}
+		gotData, err := Marshal(col.TypeInfo, r.Rows[0][name])
+		if err != nil {
+			return nil, fmt.Errorf("gocql: unable to marshal existing value of column %q: %v", name, err)
+		}
+		if !bytes.Equal(wantData, gotData) {
+			conflicts = append(conflicts, name)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts, nil
+}
+
+func (r *CASResult) column(name string) (ColumnInfo, bool) {
+	for _, col := range r.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return ColumnInfo{}, false
+}
+
+func scanCASResult(iter *Iter) (*CASResult, error) {
+	if err := iter.checkErrAndNotFound(); err != nil {
+		iter.Close()
+		return nil, err
+	}
+
+	res := &CASResult{}
+	for _, col := range iter.Columns() {
+		if col.Name != "[applied]" {
+			res.Columns = append(res.Columns, col)
+		}
+	}
+
+	rows, err := iter.SliceMap()
+	if err != nil {
+		iter.Close()
+		return nil, err
+	}
+	for i, row := range rows {
+		applied, _ := row["[applied]"].(bool)
+		delete(row, "[applied]")
+		if i == 0 {
+			res.Applied = applied
+		}
+		if !applied && len(row) > 0 {
+			res.Rows = append(res.Rows, row)
+		}
+	}
+
+	return res, iter.Close()
+}
+
 // Release releases a query back into a pool of queries. Released Queries
 // cannot be reused.
 //
@@ -1433,9 +2658,57 @@ type Iter struct {
 	numRows int
 	next    *nextIter
 	host    *HostInfo
+	conn    *Conn
 
 	framer *framer
 	closed int32
+
+	rowErrorPolicy RowErrorPolicy
+	rowErrors      []RowError
+	// rowOffset is the number of rows of the previous pages.
+	rowOffset int
+	// valueSizes are the sizes of the bound values of the query, only set
+	// when slow queries are reported.
+	valueSizes []int
+	// batchValueSizes are the sizes of the bound values of each statement of
+	// a batch, only set when the batch is observed.
+	batchValueSizes [][]int
+}
+
+// RowErrorPolicy decides what happens when a row fails to unmarshal while
+// iterating the results of a query.
+type RowErrorPolicy int
+
+const (
+	// AbortOnRowError stops the iteration at the first row which fails to
+	// unmarshal, the error is returned by Iter.Close.
+	AbortOnRowError RowErrorPolicy = iota
+	// SkipRowOnError skips the rows which fail to unmarshal and continues the
+	// iteration with the next row. The errors are returned by Iter.RowErrors.
+	// Errors reading the response itself still stop the iteration.
+	SkipRowOnError
+)
+
+// RowError is the error of a row skipped because it failed to unmarshal.
+type RowError struct {
+	// Row is the index of the row in the results of the query, counting the
+	// rows of all pages.
+	Row int
+	Err error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("gocql: row %d: %v", e.Row, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// RowErrors returns the errors of the rows skipped so far because they failed to
+// unmarshal, see SkipRowOnError.
+func (iter *Iter) RowErrors() []RowError {
+	return iter.rowErrors
 }
 
 // Host returns the host which the query was sent to.
@@ -1443,7 +2716,28 @@ func (iter *Iter) Host() *HostInfo {
 	return iter.host
 }
 
-// Columns returns the name and type of the selected columns.
+// Conn returns the connection the last page was read from, nil if the query
+// failed before being sent. It may be passed to Query.SetConn to execute other
+// queries on the same connection.
+func (iter *Iter) Conn() *Conn {
+	return iter.conn
+}
+
+// traceID returns a copy of the id of the server side trace of the query, nil
+// if it was not traced.
+func (iter *Iter) traceID() []byte {
+	if iter.framer == nil || len(iter.framer.traceID) == 0 {
+		return nil
+	}
+	return copyBytes(iter.framer.traceID)
+}
+
+// Columns returns the name and type of the selected columns, along with the
+// keyspace and table they belong to. The TypeInfo of collections, tuples and
+// user-defined types is a CollectionType, TupleTypeInfo and UDTTypeInfo
+// describing the types of their elements. The columns are available before the
+// rows are scanned, including when the result has no rows, and must not be
+// modified.
 func (iter *Iter) Columns() []ColumnInfo {
 	return iter.meta.columns
 }
@@ -1501,7 +2795,7 @@ func (is *iterScanner) Next() bool {
 	return true
 }
 
-func scanColumn(p []byte, col ColumnInfo, dest []interface{}) (int, error) {
+func scanColumn(codecs *TypeCodecs, p []byte, col ColumnInfo, dest []interface{}) (int, error) {
 	if dest[0] == nil {
 		return 1, nil
 	}
@@ -1513,12 +2807,12 @@ func scanColumn(p []byte, col ColumnInfo, dest []interface{}) (int, error) {
 		count := len(tuple.Elems)
 		// here we pass in a slice of the struct which has the number number of
 		// values as elements in the tuple
-		if err := Unmarshal(col.TypeInfo, p, dest[:count]); err != nil {
+		if err := codecs.Unmarshal(col.TypeInfo, p, dest[:count]); err != nil {
 			return 0, err
 		}
 		return count, nil
 	} else {
-		if err := Unmarshal(col.TypeInfo, p, dest[0]); err != nil {
+		if err := codecs.Unmarshal(col.TypeInfo, p, dest[0]); err != nil {
 			return 0, err
 		}
 		return 1, nil
@@ -1543,7 +2837,7 @@ func (is *iterScanner) Scan(dest ...interface{}) error {
 	var err error
 	for _, col := range iter.meta.columns {
 		var n int
-		n, err = scanColumn(is.cols[i], col, dest[i:])
+		n, err = scanColumn(iter.framer.codecs, is.cols[i], col, dest[i:])
 		if err != nil {
 			break
 		}
@@ -1585,16 +2879,29 @@ func (iter *Iter) readColumn() ([]byte, error) {
 // end of the result set was reached or if an error occurred. Close should
 // be called afterwards to retrieve any potential errors.
 func (iter *Iter) Scan(dest ...interface{}) bool {
+	for {
+		scanned, skipped := iter.scan(dest)
+		if !skipped {
+			return scanned
+		}
+	}
+}
+
+// scan scans the next row into dest. skipped is true if the row failed to
+// unmarshal and was skipped according to the row error policy.
+func (iter *Iter) scan(dest []interface{}) (scanned, skipped bool) {
 	if iter.err != nil {
-		return false
+		return false, false
 	}
 
 	if iter.pos >= iter.numRows {
 		if iter.next != nil {
+			rowErrors, rowOffset := iter.rowErrors, iter.rowOffset+iter.numRows
 			*iter = *iter.next.fetch()
-			return iter.Scan(dest...)
+			iter.rowErrors, iter.rowOffset = rowErrors, rowOffset
+			return iter.Scan(dest...), false
 		}
-		return false
+		return false, false
 	}
 
 	if iter.next != nil && iter.pos >= iter.next.pos {
@@ -1605,29 +2912,42 @@ func (iter *Iter) Scan(dest ...interface{}) bool {
 	// as scanning in more values from a single column
 	if len(dest) != iter.meta.actualColCount {
 		iter.err = fmt.Errorf("gocql: not enough columns to scan into: have %d want %d", len(dest), iter.meta.actualColCount)
-		return false
+		return false, false
 	}
 
 	// i is the current position in dest, could posible replace it and just use
 	// slices of dest
 	i := 0
+	var rowErr error
 	for _, col := range iter.meta.columns {
 		colBytes, err := iter.readColumn()
 		if err != nil {
 			iter.err = err
-			return false
+			return false, false
+		}
+		if rowErr != nil {
+			// the remaining columns of a skipped row are only read
+			continue
 		}
 
-		n, err := scanColumn(colBytes, col, dest[i:])
+		n, err := scanColumn(iter.framer.codecs, colBytes, col, dest[i:])
 		if err != nil {
-			iter.err = err
-			return false
+			if iter.rowErrorPolicy != SkipRowOnError {
+				iter.err = err
+				return false, false
+			}
+			rowErr = err
+			continue
 		}
 		i += n
 	}
 
 	iter.pos++
-	return true
+	if rowErr != nil {
+		iter.rowErrors = append(iter.rowErrors, RowError{Row: iter.rowOffset + iter.pos - 1, Err: rowErr})
+		return false, true
+	}
+	return true, false
 }
 
 // GetCustomPayload returns any parsed custom payload results if given in the
@@ -1645,6 +2965,8 @@ func (iter *Iter) GetCustomPayload() map[string][]byte {
 }
 
 // Warnings returns any warnings generated if given in the response from Cassandra.
+// The warnings of the responses of queries executed with Exec are only
+// available to the ClusterConfig.WarningHandler and the query observers.
 //
 // This is only available starting with CQL Protocol v4.
 func (iter *Iter) Warnings() []string {
@@ -1703,6 +3025,11 @@ type nextIter struct {
 	oncea sync.Once
 	once  sync.Once
 	next  *Iter
+
+	// then is fetched after the last page of qry, and ahead is fetched in
+	// the background once qry is, see Query.ExpandIn.
+	then  *nextIter
+	ahead *nextIter
 }
 
 func (n *nextIter) fetchAsync() {
@@ -1713,17 +3040,43 @@ func (n *nextIter) fetchAsync() {
 
 func (n *nextIter) fetch() *Iter {
 	n.once.Do(func() {
+		if n.qry.beforePage != nil {
+			n.qry.beforePage(n.qry, n.qry.page)
+		}
+
 		// if the query was specifically run on a connection then re-use that
 		// connection when fetching the next results
 		if n.qry.conn != nil {
 			n.next = n.qry.conn.executeQuery(n.qry.Context(), n.qry)
 		} else {
 			n.next = n.qry.session.executeQuery(n.qry)
+			for i := 0; i < n.qry.pageRetries && n.retryable(n.next); i++ {
+				if n.next.host != nil {
+					n.qry.failedHosts = append(n.qry.failedHosts, n.next.host)
+				}
+				n.next = n.qry.session.executeQuery(n.qry)
+			}
+		}
+
+		if n.then != nil {
+			if n.next.next == nil {
+				n.next.next = n.then
+			} else {
+				n.next.next.then = n.then
+			}
+		}
+		if n.ahead != nil {
+			n.ahead.fetchAsync()
 		}
 	})
 	return n.next
 }
 
+// retryable reports whether the page can be fetched again after iter failed.
+func (n *nextIter) retryable(iter *Iter) bool {
+	return iter.err != nil && n.qry.IsIdempotent() && n.qry.Context().Err() == nil
+}
+
 type Batch struct {
 	Type                  BatchType
 	Entries               []BatchEntry
@@ -1738,10 +3091,18 @@ type Batch struct {
 	serialCons            SerialConsistency
 	defaultTimestamp      bool
 	defaultTimestampValue int64
+	disableCompression    bool
 	context               context.Context
 	cancelBatch           func()
 	keyspace              string
+	executeAs             string
+	traceProbability      float64
 	metrics               *queryMetrics
+	split                 *BatchSplit
+
+	// idempotent is set by Idempotent, nil if the idempotence of the batch
+	// is the one of its statements.
+	idempotent *bool
 
 	// routingInfo is a pointer because Query can be copied and copyable struct can't hold a mutex.
 	routingInfo *queryRoutingInfo
@@ -1772,6 +3133,8 @@ func (s *Session) NewBatch(typ BatchType) *Batch {
 		Cons:             s.cons,
 		defaultTimestamp: s.cfg.DefaultTimestamp,
 		keyspace:         s.cfg.Keyspace,
+		executeAs:        s.cfg.ExecuteAs,
+		traceProbability: s.cfg.TraceProbability,
 		metrics:          &queryMetrics{m: make(map[string]*hostMetrics)},
 		spec:             &NonSpeculativeExecution{},
 		routingInfo:      &queryRoutingInfo{},
@@ -1788,6 +3151,14 @@ func (b *Batch) Trace(trace Tracer) *Batch {
 	return b
 }
 
+// TraceProbability sets the probability, between 0 and 1, with which the
+// attempts of the batch are traced when it has no Tracer, overriding
+// ClusterConfig.TraceProbability.
+func (b *Batch) TraceProbability(p float64) *Batch {
+	b.traceProbability = p
+	return b
+}
+
 // Observer enables batch-level observer on this batch.
 // The provided observer will be called every time this batched query is executed.
 func (b *Batch) Observer(observer BatchObserver) *Batch {
@@ -1834,6 +3205,12 @@ func (b *Batch) SetConsistency(c Consistency) {
 	b.Cons = c
 }
 
+// ExecuteAs executes the batch on behalf of user, see Query.ExecuteAs.
+func (b *Batch) ExecuteAs(user string) *Batch {
+	b.executeAs = user
+	return b
+}
+
 func (b *Batch) Context() context.Context {
 	if b.context == nil {
 		return context.Background()
@@ -1841,7 +3218,13 @@ func (b *Batch) Context() context.Context {
 	return b.context
 }
 
+// IsIdempotent reports whether the batch was marked as idempotent with
+// Idempotent or, if it was not marked, whether all its statements are
+// idempotent.
 func (b *Batch) IsIdempotent() bool {
+	if b.idempotent != nil {
+		return *b.idempotent
+	}
 	for _, entry := range b.Entries {
 		if !entry.Idempotent {
 			return false
@@ -1850,15 +3233,33 @@ func (b *Batch) IsIdempotent() bool {
 	return true
 }
 
+// Idempotent marks the batch as being idempotent or not depending on the
+// value, regardless of the idempotence of its statements.
+// Non-idempotent batches won't be retried nor speculatively executed.
+// See "Retries and speculative execution" in package docs for more details.
+func (b *Batch) Idempotent(value bool) *Batch {
+	b.idempotent = &value
+	return b
+}
+
 func (b *Batch) speculativeExecutionPolicy() SpeculativeExecutionPolicy {
 	return b.spec
 }
 
+// SpeculativeExecutionPolicy sets the speculative execution policy of the
+// batch, which is only used if the batch is idempotent.
 func (b *Batch) SpeculativeExecutionPolicy(sp SpeculativeExecutionPolicy) *Batch {
 	b.spec = sp
 	return b
 }
 
+// SetCustomPayload sets the custom payload of the batch, like
+// Query.CustomPayload.
+func (b *Batch) SetCustomPayload(customPayload map[string][]byte) *Batch {
+	b.CustomPayload = customPayload
+	return b
+}
+
 // Query adds the query to the batch operation
 func (b *Batch) Query(stmt string, args ...interface{}) {
 	b.Entries = append(b.Entries, BatchEntry{Stmt: stmt, Args: args})
@@ -1913,7 +3314,8 @@ func (b *Batch) Size() int {
 // SERIAL. This option will be ignored for anything else that a
 // conditional update/insert.
 //
-// Only available for protocol 3 and above
+// Only available for protocol 3 and above. Executing the batch fails with
+// ErrSerialConsistency if cons is neither SERIAL nor LOCAL_SERIAL.
 func (b *Batch) SerialConsistency(cons SerialConsistency) *Batch {
 	b.serialCons = cons
 	return b
@@ -1930,6 +3332,13 @@ func (b *Batch) DefaultTimestamp(enable bool) *Batch {
 	return b
 }
 
+// NoCompression disables compression of the request frame of the batch even if
+// a Compressor is configured for the session. See Query.NoCompression.
+func (b *Batch) NoCompression() *Batch {
+	b.disableCompression = true
+	return b
+}
+
 // WithTimestamp will enable the with default timestamp flag on the query
 // like DefaultTimestamp does. But also allows to define value for timestamp.
 // It works the same way as USING TIMESTAMP in the query itself, but
@@ -1962,16 +3371,24 @@ func (b *Batch) attempt(keyspace string, end, start time.Time, iter *Iter, host
 		Keyspace:   keyspace,
 		Statements: statements,
 		Values:     values,
+		ValueSizes: iter.batchValueSizes,
 		Start:      start,
 		End:        end,
 		// Rows not used in batch observations // TODO - might be able to support it when using BatchCAS
-		Host:    host,
-		Metrics: metricsForHost,
-		Err:     iter.err,
-		Attempt: attempt,
+		Host:     host,
+		Metrics:  metricsForHost,
+		Err:      iter.err,
+		Attempt:  attempt,
+		TraceID:  iter.traceID(),
+		Warnings: iter.Warnings(),
 	})
 }
 
+// GetHost returns nil as batches are always routed by the HostSelectionPolicy.
+func (b *Batch) GetHost() *HostInfo {
+	return nil
+}
+
 func (b *Batch) GetRoutingKey() ([]byte, error) {
 	if b.routingKey != nil {
 		return b.routingKey, nil
@@ -2002,7 +3419,7 @@ func createRoutingKey(routingKeyInfo *routingKeyInfo, values []interface{}) ([]b
 
 	if len(routingKeyInfo.indexes) == 1 {
 		// single column routing key
-		routingKey, err := Marshal(
+		routingKey, err := routingKeyInfo.codecs.Marshal(
 			routingKeyInfo.types[0],
 			values[routingKeyInfo.indexes[0]],
 		)
@@ -2015,7 +3432,7 @@ func createRoutingKey(routingKeyInfo *routingKeyInfo, values []interface{}) ([]b
 	// composite routing key
 	buf := bytes.NewBuffer(make([]byte, 0, 256))
 	for i := range routingKeyInfo.indexes {
-		encoded, err := Marshal(
+		encoded, err := routingKeyInfo.codecs.Marshal(
 			routingKeyInfo.types[i],
 			values[routingKeyInfo.indexes[i]],
 		)
@@ -2064,6 +3481,12 @@ type ColumnInfo struct {
 	TypeInfo TypeInfo
 }
 
+// CQLType returns the type of the column in CQL syntax, for instance
+// map<text, frozen<list<int>>>, see CQLTypeName.
+func (c ColumnInfo) CQLType() string {
+	return CQLTypeName(c.TypeInfo)
+}
+
 func (c ColumnInfo) String() string {
 	return fmt.Sprintf("[column keyspace=%s table=%s name=%s type=%v]", c.Keyspace, c.Table, c.Name, c.TypeInfo)
 }
@@ -2079,6 +3502,8 @@ type routingKeyInfo struct {
 	types    []TypeInfo
 	keyspace string
 	table    string
+	// codecs marshals the partition key values.
+	codecs *TypeCodecs
 }
 
 func (r *routingKeyInfo) String() string {
@@ -2117,6 +3542,21 @@ type Tracer interface {
 	Trace(traceId []byte)
 }
 
+// sampledTracer enables the tracing of the attempts sampled with the trace
+// probability, whose trace ids are only reported to the observers.
+type sampledTracer struct{}
+
+func (sampledTracer) Trace(traceId []byte) {}
+
+// sampleTracer returns the tracer of an attempt: trace if not nil, otherwise a
+// sampledTracer with the given probability.
+func sampleTracer(trace Tracer, probability float64) Tracer {
+	if trace == nil && probability > 0 && rand.Float64() < probability {
+		return sampledTracer{}
+	}
+	return trace
+}
+
 type traceWriter struct {
 	session *Session
 	w       io.Writer
@@ -2203,6 +3643,32 @@ type ObservedQuery struct {
 	// Attempt is the index of attempt at executing this query.
 	// The first attempt is number zero and any retries have non-zero attempt number.
 	Attempt int
+
+	// TraceID is the id of the server side trace of the attempt, nil if it
+	// was not traced.
+	TraceID []byte
+
+	// Warnings are the warnings returned by the server with the response of
+	// the attempt.
+	Warnings []string
+}
+
+// WarningHandler handles the warnings the server returns with the responses
+// of queries and batches, such as the warnings for batches exceeding
+// batch_size_warn_threshold or aggregations without partition key restriction,
+// see ClusterConfig.WarningHandler.
+type WarningHandler interface {
+	// HandleWarnings is called with the warnings of the response of each
+	// attempt of qry returning warnings, and the host the attempt was sent to.
+	// It is called concurrently and must not block.
+	HandleWarnings(qry ExecutableQuery, host *HostInfo, warnings []string)
+}
+
+// WarningHandlerFunc is a function implementing WarningHandler.
+type WarningHandlerFunc func(qry ExecutableQuery, host *HostInfo, warnings []string)
+
+func (fn WarningHandlerFunc) HandleWarnings(qry ExecutableQuery, host *HostInfo, warnings []string) {
+	fn(qry, host, warnings)
 }
 
 // QueryObserver is the interface implemented by query observers / stat collectors.
@@ -2224,6 +3690,12 @@ type ObservedBatch struct {
 	// Do not modify the values here, they are shared with multiple goroutines.
 	Values [][]interface{}
 
+	// ValueSizes holds the sizes in bytes of the bound values of each
+	// statement, 0 for null and unset values, like SlowQuery.ValueSizes.
+	// ValueSizes[i] is nil for the statements without values and when the
+	// attempt failed before the values were marshaled.
+	ValueSizes [][]int
+
 	Start time.Time // time immediately before the batch query was called
 	End   time.Time // time immediately after the batch query returned
 
@@ -2240,6 +3712,14 @@ type ObservedBatch struct {
 	// Attempt is the index of attempt at executing this query.
 	// The first attempt is number zero and any retries have non-zero attempt number.
 	Attempt int
+
+	// TraceID is the id of the server side trace of the attempt, nil if it
+	// was not traced.
+	TraceID []byte
+
+	// Warnings are the warnings returned by the server with the response of
+	// the attempt.
+	Warnings []string
 }
 
 // BatchObserver is the interface implemented by batch observers / stat collectors.
@@ -2261,6 +3741,10 @@ type ObservedConnect struct {
 
 	// Err is the connection error (if any)
 	Err error
+
+	// TLS is the TLS state negotiated by the connection, nil if the connection
+	// failed or does not use TLS.
+	TLS *tls.ConnectionState
 }
 
 // ConnectObserver is the interface implemented by connect observers / stat collectors.
@@ -2269,6 +3753,130 @@ type ConnectObserver interface {
 	ObserveConnect(ObservedConnect)
 }
 
+// PoolEvent is the kind of connection pool event reported to a PoolObserver.
+type PoolEvent int
+
+const (
+	// PoolHostAdded is reported when a connection pool is created for a host.
+	PoolHostAdded PoolEvent = iota + 1
+	// PoolHostRemoved is reported when the connection pool of a host is
+	// removed, its connections are closed.
+	PoolHostRemoved
+	// PoolConnOpened is reported when a connection is added to a pool.
+	PoolConnOpened
+	// PoolConnClosed is reported when a connection is removed from a pool,
+	// because it failed, was idle or was recycled.
+	PoolConnClosed
+	// PoolConnFailed is reported when a pool fails to open a connection.
+	PoolConnFailed
+	// PoolExhausted is reported when a request can not be sent to a host
+	// because all the streams of its connections are in use or the limit of
+	// requests in flight to the host is reached.
+	PoolExhausted
+)
+
+func (e PoolEvent) String() string {
+	switch e {
+	case PoolHostAdded:
+		return "HostAdded"
+	case PoolHostRemoved:
+		return "HostRemoved"
+	case PoolConnOpened:
+		return "ConnOpened"
+	case PoolConnClosed:
+		return "ConnClosed"
+	case PoolConnFailed:
+		return "ConnFailed"
+	case PoolExhausted:
+		return "Exhausted"
+	}
+	return fmt.Sprintf("PoolEvent(%d)", int(e))
+}
+
+type ObservedPool struct {
+	Event PoolEvent
+
+	// Host is the host of the connection pool.
+	Host *HostInfo
+
+	// Conns is the number of connections of the pool after the event.
+	Conns int
+
+	// Err is the connection error of PoolConnFailed events and the error which
+	// closed the connection of PoolConnClosed events, if any.
+	Err error
+
+	Time time.Time
+}
+
+// PoolObserver is the interface implemented by connection pool observers / stat collectors,
+// for example to track the connection churn of each host.
+type PoolObserver interface {
+	// ObservePool gets called on every connection pool event. It must not block
+	// as it is called while connecting and picking connections.
+	ObservePool(ObservedPool)
+}
+
+type ObservedRingRefresh struct {
+	Start time.Time // time immediately before the peers were queried
+	End   time.Time // time immediately after the ring was updated
+
+	// Hosts is the number of hosts in the ring after the refresh.
+	Hosts int
+
+	// Err is the refresh error (if any)
+	Err error
+}
+
+type ObservedSchemaAgreement struct {
+	// Host is the host the schema versions were queried from
+	Host *HostInfo
+
+	Start time.Time // time immediately before waiting for schema agreement
+	End   time.Time // time immediately after schema agreement was reached or the wait gave up
+
+	// Versions are the schema versions seen by the last check, more than one
+	// if the schema did not agree.
+	Versions []string
+
+	// Err is the error (if any), which is also returned when schema agreement
+	// was not reached within ClusterConfig.MaxWaitSchemaAgreement.
+	Err error
+}
+
+// MetadataObserver is the interface implemented by cluster metadata observers / stat collectors.
+type MetadataObserver interface {
+	// ObserveRingRefresh gets called after every refresh of the hosts in the
+	// ring. The ring is not refreshed when ClusterConfig.HostDiscovery is
+	// DiscoverContactPoints. The context is the context of the session, which
+	// is cancelled when the session is closed.
+	ObserveRingRefresh(context.Context, ObservedRingRefresh)
+	// ObserveSchemaAgreement gets called after every wait for schema agreement,
+	// both after schema changes and on calls to Session.AwaitSchemaAgreement.
+	ObserveSchemaAgreement(context.Context, ObservedSchemaAgreement)
+}
+
+type ObservedUnprepared struct {
+	// Host is the host which replied that the statement is not prepared.
+	Host *HostInfo
+
+	// Keyspace and Statement are the keyspace the statement was prepared in
+	// and the statement.
+	Keyspace  string
+	Statement string
+
+	// StatementID is the id of the statement the host does not know.
+	StatementID []byte
+}
+
+// UnpreparedObserver is the interface implemented by observers of the
+// UNPREPARED responses of the hosts.
+type UnpreparedObserver interface {
+	// ObserveUnprepared gets called on every UNPREPARED response, before the
+	// statement is prepared again and the request is retried.
+	ObserveUnprepared(context.Context, ObservedUnprepared)
+}
+
 type Error struct {
 	Code    int
 	Message string
@@ -2283,9 +3891,11 @@ var (
 	ErrUnavailable          = errors.New("unavailable")
 	ErrUnsupported          = errors.New("feature not supported")
 	ErrTooManyStmts         = errors.New("too many statements")
+	ErrSerialConsistency    = errors.New("gocql: serial consistency must be SERIAL or LOCAL_SERIAL")
 	ErrUseStmt              = errors.New("use statements aren't supported. Please see https://github.com/apache/cassandra-gocql-driver for explanation.")
 	ErrSessionClosed        = errors.New("session has been closed")
 	ErrNoConnections        = errors.New("gocql: no hosts available in the pool")
+	ErrHostOverloaded       = errors.New("gocql: too many requests in flight to host")
 	ErrNoKeyspace           = errors.New("no keyspace provided")
 	ErrKeyspaceDoesNotExist = errors.New("keyspace does not exist")
 	ErrNoMetadata           = errors.New("no metadata available")
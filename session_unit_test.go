@@ -29,7 +29,18 @@ package gocql
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gocql/gocql/internal/lru"
 )
 
 func TestAsyncSessionInit(t *testing.T) {
@@ -58,3 +69,1384 @@ func TestAsyncSessionInit(t *testing.T) {
 		t.Fatalf("unexpected error from void")
 	}
 }
+
+func newTestRowsIter(policy RowErrorPolicy, rows [][][]byte) *Iter {
+	framer := newFramer(nil, protoVersion4)
+	for _, row := range rows {
+		for _, col := range row {
+			framer.writeBytes(col)
+		}
+	}
+
+	return &Iter{
+		meta: resultMetadata{
+			columns: []ColumnInfo{
+				{Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+				{Name: "name", TypeInfo: NativeType{proto: protoVersion4, typ: TypeVarchar}},
+			},
+			colCount:       2,
+			actualColCount: 2,
+		},
+		framer:         framer,
+		numRows:        len(rows),
+		rowErrorPolicy: policy,
+	}
+}
+
+func TestIterRowErrorPolicy(t *testing.T) {
+	rows := [][][]byte{
+		{{0, 0, 0, 1}, []byte("one")},
+		{{0, 0, 3, 232}, []byte("two")}, // 1000 overflows int8
+		{{0, 0, 0, 3}, []byte("three")},
+	}
+
+	var (
+		id   int8
+		name string
+	)
+
+	iter := newTestRowsIter(AbortOnRowError, rows)
+	if !iter.Scan(&id, &name) || id != 1 || name != "one" {
+		t.Fatalf("expected first row, got %d %q", id, name)
+	}
+	if iter.Scan(&id, &name) {
+		t.Fatal("expected iteration to stop at the invalid row")
+	}
+	if err := iter.Close(); err == nil {
+		t.Fatal("expected the unmarshal error to be returned")
+	}
+
+	iter = newTestRowsIter(SkipRowOnError, rows)
+	var names []string
+	for iter.Scan(&id, &name) {
+		names = append(names, name)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(names) != 2 || names[0] != "one" || names[1] != "three" {
+		t.Fatalf("expected the invalid row to be skipped, got %v", names)
+	}
+	rowErrors := iter.RowErrors()
+	if len(rowErrors) != 1 || rowErrors[0].Row != 1 || rowErrors[0].Err == nil {
+		t.Fatalf("expected an error for row 1, got %v", rowErrors)
+	}
+}
+
+func TestScanCASResult(t *testing.T) {
+	framer := newFramer(nil, protoVersion4)
+	framer.writeBytes([]byte{0})
+	framer.writeBytes([]byte{0, 0, 0, 1})
+	framer.writeBytes([]byte("existing"))
+
+	iter := &Iter{
+		meta: resultMetadata{
+			columns: []ColumnInfo{
+				{Name: "[applied]", TypeInfo: NativeType{proto: protoVersion4, typ: TypeBoolean}},
+				{Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+				{Name: "name", TypeInfo: NativeType{proto: protoVersion4, typ: TypeVarchar}},
+			},
+			colCount:       3,
+			actualColCount: 3,
+		},
+		framer:  framer,
+		numRows: 1,
+	}
+
+	res, err := scanCASResult(iter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Applied {
+		t.Fatal("expected the transaction not to be applied")
+	}
+	if len(res.Columns) != 2 || res.Columns[0].Name != "id" || res.Columns[1].Name != "name" {
+		t.Fatalf("expected the columns without [applied], got %v", res.Columns)
+	}
+	if name, ok := res.Existing("name"); !ok || name != "existing" {
+		t.Fatalf("expected existing name, got %v", name)
+	}
+
+	conflicts, err := res.Conflicts(map[string]interface{}{"id": 1, "name": "expected"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0] != "name" {
+		t.Fatalf("expected name to conflict, got %v", conflicts)
+	}
+}
+
+func TestValidateKeyspaceReplication(t *testing.T) {
+	hosts := []*HostInfo{
+		{hostId: "a", dataCenter: "dc1"},
+		{hostId: "b", dataCenter: "dc1"},
+		{hostId: "c", dataCenter: "dc2"},
+	}
+
+	warnings, err := validateKeyspaceReplication(map[string]interface{}{
+		"class": "NetworkTopologyStrategy",
+		"dc1":   2,
+		"dc2":   "3",
+	}, hosts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"dc2"`) {
+		t.Fatalf("expected a warning for dc2, got %v", warnings)
+	}
+
+	if _, err := validateKeyspaceReplication(map[string]interface{}{
+		"class": "NetworkTopologyStrategy",
+		"dc3":   1,
+	}, hosts, true); err == nil {
+		t.Fatal("expected an error for an unknown datacenter")
+	}
+
+	// without all the peers, the datacenter may only be unknown to the ring
+	warnings, err = validateKeyspaceReplication(map[string]interface{}{
+		"class": "NetworkTopologyStrategy",
+		"dc3":   1,
+	}, hosts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"dc3"`) {
+		t.Fatalf("expected a warning for dc3, got %v", warnings)
+	}
+
+	warnings, err = validateKeyspaceReplication(map[string]interface{}{
+		"class":              "SimpleStrategy",
+		"replication_factor": 4,
+	}, hosts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected a warning for the replication factor, got %v", warnings)
+	}
+
+	if _, err := validateKeyspaceReplication(map[string]interface{}{"dc1": 1}, hosts, true); err == nil {
+		t.Fatal("expected an error for a missing class")
+	}
+
+	warnings, err = validateKeyspaceReplication(map[string]interface{}{
+		"class":              "NetworkTopologyStrategy",
+		"replication_factor": 1,
+		"dc1":                2,
+	}, hosts, true)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("expected replication_factor to be accepted as the default of the datacenters, got %v, %v", warnings, err)
+	}
+
+	for _, name := range []string{"bad-name", "kéyspace", "ks;", "1ks", "_ks"} {
+		if err := (&Session{}).EnsureKeyspace(context.Background(), name, nil); err == nil || !strings.Contains(err.Error(), "invalid keyspace name") {
+			t.Errorf("expected keyspace name %q to be invalid, got %v", name, err)
+		}
+	}
+
+	literal := replicationLiteral(map[string]interface{}{"class": "SimpleStrategy", "replication_factor": 1})
+	if literal != "{'class': 'SimpleStrategy', 'replication_factor': '1'}" {
+		t.Fatalf("unexpected replication literal %s", literal)
+	}
+}
+
+func TestSessionSetLogLevel(t *testing.T) {
+	logger := &testLogger{}
+	s := &Session{logger: newLevelLogger(logger, 0)}
+
+	s.cfg.AddressTranslator = AddressTranslatorFunc(func(addr net.IP, port int) (net.IP, int) {
+		return net.IPv4(10, 0, 0, 2), port
+	})
+	translate := func() {
+		row := map[string]interface{}{"rpc_address": "10.0.0.1"}
+		if _, err := s.hostInfoFromMap(row, &HostInfo{port: 9042}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.SetLogLevel(LogLevelDebug)
+	if !s.debugLogging() {
+		t.Fatal("expected debug logging to be enabled")
+	}
+	s.debugf("debug ")
+	translate()
+	if got := logger.String(); got != "debug gocql: translating address '10.0.0.1:9042' to '10.0.0.2:9042'\n" {
+		t.Fatalf("expected the debug messages to be logged, got %q", got)
+	}
+	logger.capture.Reset()
+
+	s.SetLogLevel(LogLevelWarning)
+	if s.debugLogging() {
+		t.Fatal("expected debug logging to be disabled")
+	}
+	s.debugf("dropped")
+	translate()
+	s.logger.Printf("warning")
+
+	s.SetLogLevel(LogLevelNone)
+	s.logger.Printf("dropped")
+
+	if got := logger.String(); got != "warning" {
+		t.Fatalf("expected only the warning to be logged, got %q", got)
+	}
+}
+
+func TestLogSampler(t *testing.T) {
+	logger := &testLogger{}
+	l := newLevelLogger(logger, time.Minute)
+	now := time.Now()
+	l.sampler.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		l.Printf("gocql: node %s is DOWN", "10.0.0.1")
+	}
+	l.Printf("gocql: node %s is DOWN", "10.0.0.2")
+
+	now = now.Add(time.Minute)
+	l.Printf("gocql: node %s is DOWN", "10.0.0.1")
+
+	expected := "gocql: node 10.0.0.1 is DOWN" +
+		"gocql: node 10.0.0.2 is DOWN" +
+		"gocql: node 10.0.0.1 is DOWN (repeated 2 more times in the last 1m0s)"
+	if got := logger.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	logger.capture.Reset()
+
+	// the count of a message which does not recur is flushed after the interval
+	l.Printf("gocql: node %s is DOWN", "10.0.0.1")
+	l.flushSampled()
+	if got := logger.String(); got != "" {
+		t.Fatalf("expected nothing to be flushed within the interval, got %q", got)
+	}
+	now = now.Add(time.Minute)
+	l.flushSampled()
+	l.flushSampled()
+	expected = "gocql: node 10.0.0.1 is DOWN (repeated 1 more times in the last 1m0s)"
+	if got := logger.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+type recordingTopologyListener struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *recordingTopologyListener) record(event string, host *HostInfo) {
+	l.mu.Lock()
+	l.events = append(l.events, event+" "+host.ConnectAddress().String())
+	l.mu.Unlock()
+}
+
+func (l *recordingTopologyListener) OnHostAdded(host *HostInfo)   { l.record("added", host) }
+func (l *recordingTopologyListener) OnHostRemoved(host *HostInfo) { l.record("removed", host) }
+func (l *recordingTopologyListener) OnHostUp(host *HostInfo)      { l.record("up", host) }
+func (l *recordingTopologyListener) OnHostDown(host *HostInfo)    { l.record("down", host) }
+
+func TestTopologyListener(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	listener := &recordingTopologyListener{}
+	db.RegisterTopologyListener(listener)
+
+	host := db.GetHosts()[0]
+	db.handleNodeDown(host.nodeToNodeAddress(), host.Port())
+	db.handleNodeConnected(host)
+	db.removeHost(host)
+	db.removeHost(host)
+
+	addr := host.ConnectAddress().String()
+	expected := []string{"down " + addr, "up " + addr, "removed " + addr}
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	if !reflect.DeepEqual(listener.events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, listener.events)
+	}
+}
+
+type recordingSchemaChangeListener struct {
+	events []SchemaChangeEvent
+}
+
+func (l *recordingSchemaChangeListener) OnSchemaChange(event SchemaChangeEvent) {
+	l.events = append(l.events, event)
+}
+
+func TestSchemaChangeListener(t *testing.T) {
+	s := &Session{}
+	s.schemaDescriber = newSchemaDescriber(s)
+
+	listener := &recordingSchemaChangeListener{}
+	s.RegisterSchemaChangeListener(listener)
+
+	s.handleSchemaEvent([]frame{
+		&schemaChangeTable{change: "CREATED", keyspace: "ks", object: "tbl"},
+		&schemaChangeType{change: "UPDATED", keyspace: "ks", object: "typ"},
+		&schemaChangeFunction{change: "DROPPED", keyspace: "ks", name: "fn", args: []string{"int"}},
+	})
+
+	expected := []SchemaChangeEvent{
+		{Change: "CREATED", Target: "TABLE", Keyspace: "ks", Name: "tbl"},
+		{Change: "UPDATED", Target: "TYPE", Keyspace: "ks", Name: "typ"},
+		{Change: "DROPPED", Target: "FUNCTION", Keyspace: "ks", Name: "fn", Args: []string{"int"}},
+	}
+	if !reflect.DeepEqual(listener.events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, listener.events)
+	}
+}
+
+func TestSessionState(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	states := db.State()
+	if len(states) != 1 {
+		t.Fatalf("expected the state of 1 host, got %d", len(states))
+	}
+	state := states[0]
+	if state.Host != db.GetHosts()[0] || !state.Up {
+		t.Errorf("expected the host to be up, got %+v", state)
+	}
+	if state.Connections == 0 || state.InFlight != 0 || state.LastError != nil {
+		t.Errorf("unexpected pool state %+v", state)
+	}
+}
+
+func TestSessionExecuteConcurrent(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	queries := make([]*Query, 10)
+	for i := range queries {
+		stmt := "void"
+		if i == 3 || i == 7 {
+			stmt = "kill"
+		}
+		queries[i] = db.Query(stmt)
+	}
+
+	var inFlight, maxInFlight, handled int32
+	err = db.ExecuteConcurrent(context.Background(), queries, ConcurrentOptions{
+		Concurrency: 2,
+		Handle: func(i int, iter *Iter) error {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&handled, 1)
+			time.Sleep(5 * time.Millisecond)
+			return iter.Close()
+		},
+	})
+	cerr, ok := err.(*ConcurrentError)
+	if !ok {
+		t.Fatalf("expected a *ConcurrentError, got %v", err)
+	}
+	if len(cerr.Errors) != 2 || cerr.Errors[3] == nil || cerr.Errors[7] == nil || cerr.Skipped != 0 {
+		t.Errorf("expected queries 3 and 7 to fail, got %v", cerr)
+	}
+	if n := atomic.LoadInt32(&handled); n != int32(len(queries)) {
+		t.Errorf("expected %d queries to be handled, got %d", len(queries), n)
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 2 {
+		t.Errorf("expected at most 2 queries in flight, got %d", max)
+	}
+
+	queries[0] = db.Query("kill")
+	err = db.ExecuteConcurrent(context.Background(), queries, ConcurrentOptions{Concurrency: 1, FailFast: true})
+	cerr, ok = err.(*ConcurrentError)
+	if !ok {
+		t.Fatalf("expected a *ConcurrentError, got %v", err)
+	}
+	if len(cerr.Errors) != 1 || cerr.Errors[0] == nil || cerr.Skipped != len(queries)-1 {
+		t.Errorf("expected the queries after query 0 to be skipped, got %v", cerr)
+	}
+
+	if err := db.ExecuteConcurrent(context.Background(), queries[1:3], ConcurrentOptions{}); err != nil {
+		t.Errorf("expected the queries to succeed, got %v", err)
+	}
+}
+
+func TestQualifyStatement(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		expected string
+	}{
+		{"SELECT * FROM t WHERE a = ?", `SELECT * FROM "ks".t WHERE a = ?`},
+		{"select a, b\nfrom \"T\" where a = ?", "select a, b\nfrom \"ks\".\"T\" where a = ?"},
+		{"INSERT INTO t (a) VALUES (?)", `INSERT INTO "ks".t (a) VALUES (?)`},
+		{"UPDATE t SET b = ? WHERE a = ?", `UPDATE "ks".t SET b = ? WHERE a = ?`},
+		{"DELETE FROM t WHERE a = ?", `DELETE FROM "ks".t WHERE a = ?`},
+		{"DELETE b FROM t WHERE a = ?", `DELETE b FROM "ks".t WHERE a = ?`},
+		{"SELECT * FROM other.t", "SELECT * FROM other.t"},
+		{`SELECT * FROM "other" . t`, `SELECT * FROM "other" . t`},
+	}
+	for _, test := range tests {
+		stmt, err := qualifyStatement(test.stmt, "ks")
+		if err != nil {
+			t.Errorf("qualify %q: %v", test.stmt, err)
+		} else if stmt != test.expected {
+			t.Errorf("qualify %q: expected %q, got %q", test.stmt, test.expected, stmt)
+		}
+	}
+
+	for _, stmt := range []string{"TRUNCATE t", "CREATE TABLE t (a int PRIMARY KEY)", "BEGIN BATCH APPLY BATCH"} {
+		if _, err := qualifyStatement(stmt, "ks"); err == nil {
+			t.Errorf("expected qualifying %q to fail", stmt)
+		}
+	}
+}
+
+// routingKeySession returns a session knowing the indexes of the partition
+// key bind markers of the statements of partitionKeys.
+func routingKeySession(partitionKeys map[string][]int) *Session {
+	s := &Session{}
+	s.routingKeyInfoCache.lru = lru.New(len(partitionKeys) + 1)
+	for stmt, indexes := range partitionKeys {
+		s.routingKeyInfoCache.lru.Add(stmt, &inflightCachedEntry{value: &routingKeyInfo{indexes: indexes}})
+	}
+	return s
+}
+
+func TestQueryExpandInClause(t *testing.T) {
+	session := routingKeySession(map[string][]int{
+		"SELECT * FROM t WHERE a = ? AND b = ? AND c > ?":                         {0, 1},
+		"select * from t where b = ?":                                             {0},
+		"SELECT * FROM t WHERE b = ? PER PARTITION LIMIT 1":                       {0},
+		"SELECT * FROM t WHERE a = ? AND c = ?":                                   {0},
+		"SELECT * FROM t WHERE b = ? LIMIT 10":                                    {0},
+		"SELECT * FROM t WHERE b = ? ORDER BY c":                                  {0},
+		"SELECT b, count(*) FROM t WHERE b = ?":                                   {0},
+		"SELECT max(c) FROM t WHERE b = ?":                                        {0},
+		"SELECT b, c FROM t WHERE b = ? GROUP BY b":                               {0},
+		"SELECT * FROM t WHERE a = ? AND b = ? AND c > ? LIMIT 5 ALLOW FILTERING": {0, 1},
+	})
+
+	qry := &Query{
+		session: session,
+		stmt:    "SELECT * FROM t WHERE a = ? AND b IN ? AND c > ?",
+		values:  []interface{}{"a", []int{1, 2, 3}, 4},
+	}
+	queries := qry.expandInClause()
+	if len(queries) != 3 {
+		t.Fatalf("expected 3 queries, got %d", len(queries))
+	}
+	for i, q := range queries {
+		if q.stmt != "SELECT * FROM t WHERE a = ? AND b = ? AND c > ?" {
+			t.Errorf("unexpected statement %q", q.stmt)
+		}
+		if expected := []interface{}{"a", i + 1, 4}; !reflect.DeepEqual(q.values, expected) {
+			t.Errorf("expected values %v, got %v", expected, q.values)
+		}
+	}
+
+	qry = &Query{session: session, stmt: "select * from t where b in (?, ?)", values: []interface{}{1, 2}}
+	queries = qry.expandInClause()
+	if len(queries) != 2 || queries[0].stmt != "select * from t where b = ?" || !reflect.DeepEqual(queries[1].values, []interface{}{2}) {
+		t.Errorf("unexpected expansion of %q: %v", qry.stmt, queries)
+	}
+
+	// the limit of each partition is the same per key
+	qry = &Query{session: session, stmt: "SELECT * FROM t WHERE b IN ? PER PARTITION LIMIT 1", values: []interface{}{[]int{1, 2}}}
+	if queries := qry.expandInClause(); len(queries) != 2 {
+		t.Errorf("expected %q to be expanded, got %v", qry.stmt, queries)
+	}
+
+	for _, qry := range []*Query{
+		{stmt: "SELECT * FROM t WHERE b IN (1, 2)"},
+		{stmt: "SELECT * FROM t WHERE b IN ? AND c IN ?", values: []interface{}{[]int{1}, []int{2}}},
+		{stmt: "SELECT * FROM t WHERE b IN ?", values: []interface{}{[]byte{1, 2}}},
+		{stmt: "SELECT * FROM t WHERE b IN ?", values: []interface{}{1}},
+		{stmt: "DELETE FROM t WHERE b IN ?", values: []interface{}{[]int{1, 2}}},
+		// the results would be limited, ordered, grouped or aggregated per key
+		{stmt: "SELECT * FROM t WHERE b IN ? LIMIT 10", values: []interface{}{[]int{1, 2}}},
+		{stmt: "SELECT * FROM t WHERE a = ? AND b IN ? AND c > ? LIMIT 5 ALLOW FILTERING", values: []interface{}{1, []int{1, 2}, 3}},
+		{stmt: "SELECT * FROM t WHERE b IN ? ORDER BY c", values: []interface{}{[]int{1, 2}}},
+		{stmt: "SELECT b, count(*) FROM t WHERE b IN ?", values: []interface{}{[]int{1, 2}}},
+		{stmt: "SELECT max(c) FROM t WHERE b IN ?", values: []interface{}{[]int{1, 2}}},
+		{stmt: "SELECT b, c FROM t WHERE b IN ? GROUP BY b", values: []interface{}{[]int{1, 2}}},
+		// c is a clustering column
+		{stmt: "SELECT * FROM t WHERE a = ? AND c IN ?", values: []interface{}{1, []int{1, 2}}},
+	} {
+		qry.session = session
+		if queries := qry.expandInClause(); queries != nil {
+			t.Errorf("expected %q not to be expanded, got %v", qry.stmt, queries)
+		}
+	}
+}
+
+type statementRecorder struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (r *statementRecorder) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	r.mu.Lock()
+	r.statements = append(r.statements, q.Statement)
+	r.mu.Unlock()
+}
+
+func TestQueryIterExpanded(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	recorder := &statementRecorder{}
+	queries := make([]*Query, 5)
+	for i := range queries {
+		queries[i] = db.Query(fmt.Sprintf("void %d", i)).Observer(recorder)
+	}
+
+	iter := iterExpanded(queries, 2)
+	for iter.Scan() {
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.mu.Lock()
+	statements := recorder.statements
+	recorder.mu.Unlock()
+	sort.Strings(statements)
+	if expected := []string{"void 0", "void 1", "void 2", "void 3", "void 4"}; !reflect.DeepEqual(statements, expected) {
+		t.Fatalf("expected the queries %v to be executed, got %v", expected, statements)
+	}
+
+	queries[1] = db.Query("kill")
+	iter = iterExpanded(queries, 1)
+	for iter.Scan() {
+	}
+	if err := iter.Close(); err == nil {
+		t.Fatal("expected the error of the failed query")
+	}
+}
+
+func TestQueryBeforePage(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var pages []int
+	qry := db.Query("void").Consistency(Quorum).BeforePage(func(q *Query, page int) {
+		pages = append(pages, page)
+		q.Consistency(One)
+	})
+	qry.page = 1
+
+	next := &nextIter{qry: qry}
+	if err := next.fetch().Close(); err != nil {
+		t.Fatal(err)
+	}
+	next.fetch()
+
+	if !reflect.DeepEqual(pages, []int{1}) {
+		t.Fatalf("expected the callback to be called once for page 1, got %v", pages)
+	}
+	if qry.GetConsistency() != One {
+		t.Fatalf("expected the page to be fetched with consistency %v, got %v", One, qry.GetConsistency())
+	}
+}
+
+func TestQueryPageRetries(t *testing.T) {
+	srv1 := NewTestServerWithAddress("127.0.0.1:0", t, defaultProto, context.Background())
+	defer srv1.Stop()
+	srv2 := NewTestServerWithAddress("127.0.0.2:0", t, defaultProto, context.Background())
+	defer srv2.Stop()
+
+	db, err := testCluster(defaultProto, srv1.Address, srv2.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	requests := func() (int64, int64) {
+		return atomic.LoadInt64(&srv1.nKillReq), atomic.LoadInt64(&srv2.nKillReq)
+	}
+
+	qry := db.Query("kill").PageRetries(2)
+	qry.page = 1
+	if err := (&nextIter{qry: qry}).fetch().Close(); err == nil {
+		t.Fatal("expected the error of the failed page")
+	}
+	if n1, n2 := requests(); n1+n2 != 1 {
+		t.Fatalf("expected the page of a non idempotent query to be fetched once, got %d fetches", n1+n2)
+	}
+
+	qry = db.Query("kill").Idempotent(true).PageRetries(2)
+	qry.page = 1
+	if err := (&nextIter{qry: qry}).fetch().Close(); err == nil {
+		t.Fatal("expected the error of the failed page")
+	}
+	n1, n2 := requests()
+	if n1+n2 != 4 {
+		t.Fatalf("expected the page to be fetched 3 more times, got %d fetches", n1+n2-1)
+	}
+	if n1 != 2 || n2 != 2 {
+		t.Fatalf("expected the page to be fetched from both hosts in turn, got %d and %d fetches", n1, n2)
+	}
+}
+
+type testWarningsObserver struct {
+	warnings []string
+}
+
+func (o *testWarningsObserver) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	o.warnings = append(o.warnings, q.Warnings...)
+}
+
+func TestSessionWarningHandler(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+
+	var handled []string
+	cluster := testCluster(protoVersion4, srv.Address)
+	cluster.WarningHandler = WarningHandlerFunc(func(qry ExecutableQuery, host *HostInfo, warnings []string) {
+		if host == nil {
+			t.Error("expected the host of the warnings")
+		}
+		handled = append(handled, qry.(*Query).Statement()+": "+strings.Join(warnings, ", "))
+	})
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	observer := &testWarningsObserver{}
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("warn").Observer(observer).Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"warn: testing warning"}; !reflect.DeepEqual(handled, expected) {
+		t.Fatalf("expected handled warnings %v, got %v", expected, handled)
+	}
+	if expected := []string{"testing warning"}; !reflect.DeepEqual(observer.warnings, expected) {
+		t.Fatalf("expected observed warnings %v, got %v", expected, observer.warnings)
+	}
+}
+
+func TestSessionWarmUp(t *testing.T) {
+	srv1 := NewTestServerWithAddress("127.0.0.1:0", t, defaultProto, context.Background())
+	defer srv1.Stop()
+	srv2 := NewTestServerWithAddress("127.0.0.2:0", t, defaultProto, context.Background())
+	defer srv2.Stop()
+
+	db, err := testCluster(defaultProto, srv1.Address, srv2.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.WarmUp(context.Background(), "void", "select"); err != nil {
+		t.Fatal(err)
+	}
+	if n1, n2 := atomic.LoadInt64(&srv1.nPrepareReq), atomic.LoadInt64(&srv2.nPrepareReq); n1 != 2 || n2 != 2 {
+		t.Fatalf("expected the statements to be prepared on both hosts, got %d and %d prepares", n1, n2)
+	}
+	if _, cached := db.routingKeyInfoCache.lru.Get("select"); !cached {
+		t.Fatal("expected the routing information of the statement to be cached")
+	}
+
+	// the statements prepared already are not prepared again
+	err = db.WarmUp(context.Background(), "void", "kill")
+	warmUpErr, ok := err.(*WarmUpError)
+	if !ok {
+		t.Fatalf("expected a *WarmUpError, got %v", err)
+	}
+	if _, ok := warmUpErr.Errors["kill"]; !ok || len(warmUpErr.Errors) != 1 {
+		t.Fatalf("expected the error of kill, got %v", warmUpErr.Errors)
+	}
+	if n1, n2 := atomic.LoadInt64(&srv1.nPrepareReq), atomic.LoadInt64(&srv2.nPrepareReq); n1+n2 < 6 || n1+n2 > 7 {
+		t.Fatalf("expected only kill to be prepared again, got %d and %d prepares", n1, n2)
+	}
+}
+
+func TestSessionSlowQuery(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	var mu sync.Mutex
+	var reported []SlowQuery
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.SlowQuery = &SlowQueryConfig{
+		Threshold: 30 * time.Millisecond,
+		Observer: SlowQueryObserverFunc(func(ctx context.Context, q SlowQuery) {
+			mu.Lock()
+			reported = append(reported, q)
+			mu.Unlock()
+		}),
+	}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("slow").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || reported[0].Statement != "slow" || reported[0].Host == nil {
+		t.Fatalf("expected the slow query to be reported, got %+v", reported)
+	}
+}
+
+func TestQueryTemplate(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tmpl := db.QueryTemplate("void", func(q *Query) {
+		q.Consistency(LocalQuorum).Idempotent(true)
+	})
+	if tmpl.Statement() != "void" {
+		t.Fatalf("expected statement void, got %q", tmpl.Statement())
+	}
+
+	q1, q2 := tmpl.Bind(1), tmpl.Bind(2)
+	q1.Consistency(One)
+	if q2.GetConsistency() != LocalQuorum || !q2.IsIdempotent() {
+		t.Fatalf("expected the options of the template, got %v", q2)
+	}
+	if !reflect.DeepEqual(q1.Values(), []interface{}{1}) || !reflect.DeepEqual(q2.Values(), []interface{}{2}) {
+		t.Fatalf("expected the values of each query, got %v and %v", q1.Values(), q2.Values())
+	}
+	if q1.routingInfo == q2.routingInfo || q1.metrics == q2.metrics {
+		t.Fatal("expected the queries not to share their state")
+	}
+	if tmpl.Bind().GetConsistency() != LocalQuorum {
+		t.Fatal("expected the template not to be changed by its queries")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tmpl.Exec(context.Background()); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if err := tmpl.Iter(context.Background()).Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeferHosts(t *testing.T) {
+	hosts := []*HostInfo{
+		{connectAddress: net.IPv4(10, 0, 0, 1)},
+		{connectAddress: net.IPv4(10, 0, 0, 2)},
+		{connectAddress: net.IPv4(10, 0, 0, 3)},
+	}
+	i := 0
+	hostIter := func() SelectedHost {
+		if i == len(hosts) {
+			return nil
+		}
+		i++
+		return (*selectedHost)(hosts[i-1])
+	}
+
+	failed := []*HostInfo{{connectAddress: net.IPv4(10, 0, 0, 1)}}
+	next := deferHosts(hostIter, func(host *HostInfo) bool {
+		return containsHost(failed, host)
+	})
+	var got []*HostInfo
+	for host := next(); host != nil; host = next() {
+		got = append(got, host.Info())
+	}
+	if expected := []*HostInfo{hosts[1], hosts[2], hosts[0]}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected hosts %v, got %v", expected, got)
+	}
+}
+
+func TestSessionRefreshContactPoints(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+	moved := NewTestServer(t, defaultProto, context.Background())
+	defer moved.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.ReconnectInterval = 0
+	cluster.ContactPointsTTL = 30 * time.Second
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.refreshContactPoints()
+	if hosts := db.GetHosts(); len(hosts) != 1 || JoinHostPort(hosts[0].ConnectAddress().String(), hosts[0].Port()) != srv.Address {
+		t.Fatalf("expected the hosts to be kept while up, got %v", hosts)
+	}
+
+	// the contact point now resolves to the address of the other server
+	db.GetHosts()[0].setState(NodeDown)
+	db.cfg.Hosts = []string{moved.Address}
+	db.refreshContactPoints()
+	if hosts := db.GetHosts(); len(hosts) != 1 || JoinHostPort(hosts[0].ConnectAddress().String(), hosts[0].Port()) != srv.Address {
+		t.Fatalf("expected the contact points to be cached for ContactPointsTTL, got %v", hosts)
+	}
+
+	db.ring.endpointsMu.Lock()
+	db.ring.endpointsResolved = time.Now().Add(-db.cfg.ContactPointsTTL)
+	db.ring.endpointsMu.Unlock()
+	db.refreshContactPoints()
+
+	hosts := db.GetHosts()
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %v", hosts)
+	}
+	if addr := JoinHostPort(hosts[0].ConnectAddress().String(), hosts[0].Port()); addr != moved.Address {
+		t.Fatalf("expected the host to be %s, got %s", moved.Address, addr)
+	}
+	if !hosts[0].IsUp() {
+		t.Fatal("expected the resolved host to be connected")
+	}
+}
+
+type staticContactPointResolver []string
+
+func (r staticContactPointResolver) ResolveContactPoints(ctx context.Context) ([]string, error) {
+	return r, nil
+}
+
+func TestSessionContactPointResolver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto)
+	cluster.ContactPointResolver = staticContactPointResolver{srv.Address}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hosts := db.GetHosts()
+	if len(hosts) != 1 || JoinHostPort(hosts[0].ConnectAddress().String(), hosts[0].Port()) != srv.Address {
+		t.Fatalf("expected the host to be resolved to %s, got %v", srv.Address, hosts)
+	}
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type recordingPoolObserver struct {
+	mu     sync.Mutex
+	events []ObservedPool
+}
+
+func (r *recordingPoolObserver) ObservePool(e ObservedPool) {
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+func (r *recordingPoolObserver) count(event PoolEvent) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, e := range r.events {
+		if e.Event == event {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSessionPoolObserver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	observer := &recordingPoolObserver{}
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 2
+	cluster.PoolObserver = observer
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(event PoolEvent, n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for observer.count(event) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d %v events, got %v", n, event, observer.events)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(PoolHostAdded, 1)
+	waitFor(PoolConnOpened, 2)
+
+	observer.mu.Lock()
+	for _, e := range observer.events {
+		if e.Host == nil || e.Host.ConnectAddressAndPort() != srv.Address {
+			t.Errorf("expected event of host %s, got %+v", srv.Address, e)
+		}
+	}
+	observer.mu.Unlock()
+
+	db.Close()
+	waitFor(PoolConnClosed, 2)
+	if n := observer.count(PoolConnFailed); n != 0 {
+		t.Fatalf("expected no failed connections, got %d", n)
+	}
+}
+
+func TestHostConnPoolObserveExhausted(t *testing.T) {
+	observer := &recordingPoolObserver{}
+	pool := &hostConnPool{
+		session:  &Session{poolObserver: observer},
+		host:     &HostInfo{},
+		requests: make(chan struct{}, 1),
+	}
+
+	if err := pool.acquireRequest(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.acquireRequest(context.Background()); err != ErrHostOverloaded {
+		t.Fatalf("expected %v, got %v", ErrHostOverloaded, err)
+	}
+	if len(observer.events) != 1 || observer.events[0].Event != PoolExhausted || observer.events[0].Host != pool.host {
+		t.Fatalf("expected an exhausted event, got %+v", observer.events)
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	srv1 := NewTestServerWithAddress("127.0.0.1:0", t, defaultProto, context.Background())
+	defer srv1.Stop()
+	srv2 := NewTestServerWithAddress("127.0.0.2:0", t, defaultProto, context.Background())
+	defer srv2.Stop()
+
+	db, err := testCluster(defaultProto, srv1.Address, srv2.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	h := newHealthChecker(db, HealthCheckConfig{FailureThreshold: 2})
+	// the OPTIONS probes of healthy hosts succeed
+	h.check()
+	if len(h.failures) != 0 {
+		t.Fatalf("expected no failed probes, got %v", h.failures)
+	}
+
+	probeOptions := h.probe
+	h.probe = func(ctx context.Context, conn *Conn) error {
+		if conn.host.ConnectAddressAndPort() == srv2.Address {
+			return errors.New("unresponsive")
+		}
+		return probeOptions(ctx, conn)
+	}
+
+	hostOf := func(addr string) *HostInfo {
+		for _, host := range db.ring.allHosts() {
+			if host.ConnectAddressAndPort() == addr {
+				return host
+			}
+		}
+		t.Fatalf("no host %s", addr)
+		return nil
+	}
+	h.check()
+	if host := hostOf(srv2.Address); !host.IsUp() {
+		t.Fatal("expected the host to be up after one failed probe")
+	}
+	h.check()
+	if host := hostOf(srv2.Address); host.IsUp() {
+		t.Fatal("expected the host to be down after two failed probes")
+	} else if _, ok := db.pool.getPool(host); ok {
+		t.Fatal("expected the pool of the host to be removed")
+	}
+	if host := hostOf(srv1.Address); !host.IsUp() {
+		t.Fatal("expected the healthy host to be up")
+	} else if _, ok := db.pool.getPool(host); !ok {
+		t.Fatal("expected the pool of the healthy host to remain")
+	}
+}
+
+func TestOffsetPager(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pager := NewOffsetPager(nil)
+	page := func(n int) ([]int, int64) {
+		before := atomic.LoadInt64(&srv.nPageReq)
+		qry := db.Query("pages").PageSize(2)
+		iter := pager.Page(qry, n)
+		if qry.pageState != nil || qry.disableAutoPage {
+			t.Errorf("page %d: expected the query to be left unchanged", n)
+		}
+		var rows []int
+		var v int
+		for iter.Scan(&v) {
+			rows = append(rows, v)
+		}
+		if err := iter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return rows, atomic.LoadInt64(&srv.nPageReq) - before
+	}
+
+	tests := []struct {
+		page     int
+		rows     []int
+		requests int64
+	}{
+		{3, []int{6, 7}, 4},
+		{3, []int{6, 7}, 1},
+		{4, []int{8, 9}, 1},
+		{1, []int{2, 3}, 1},
+		{6, nil, 1},
+	}
+	for _, test := range tests {
+		rows, requests := page(test.page)
+		if !reflect.DeepEqual(rows, test.rows) {
+			t.Errorf("page %d: expected rows %v, got %v", test.page, test.rows, rows)
+		}
+		if requests != test.requests {
+			t.Errorf("page %d: expected %d requests, got %d", test.page, test.requests, requests)
+		}
+	}
+
+	if err := pager.Page(db.Query("pages").PageSize(0), 1).Close(); err == nil {
+		t.Error("expected an error paging a query without a page size")
+	}
+}
+
+func TestScanLeasePageState(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the bound is read one page of the server at a time
+	fetch := func(bound [2]int64, pageState []byte) ([]map[string]interface{}, []byte, error) {
+		return scanLeasePage(db.Query("pages").PageSize(4), pageState)
+	}
+	scan := func(lease ScanLease) ([][]int, []ScanLease, int64) {
+		before := atomic.LoadInt64(&srv.nPageReq)
+		var pages [][]int
+		var leases []ScanLease
+		err := scanLease(lease, fetch, func(rows []map[string]interface{}, next ScanLease) error {
+			var page []int
+			for _, row := range rows {
+				page = append(page, row["v"].(int))
+			}
+			pages = append(pages, page)
+			leases = append(leases, next)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pages, leases, atomic.LoadInt64(&srv.nPageReq) - before
+	}
+
+	pages, leases, requests := scan(ScanLease{Range: TokenRange{Start: "-100", End: "100"}})
+	if expected := [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}, {8, 9}}; !reflect.DeepEqual(pages, expected) {
+		t.Fatalf("expected pages %v, got %v", expected, pages)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+	if len(leases[0].PageState) == 0 || leases[0].Done || !leases[2].Done {
+		t.Fatalf("expected the leases to resume mid-range until the last page, got %+v", leases)
+	}
+
+	// resuming from the lease of the first page reads the remaining pages
+	pages, _, requests = scan(leases[0])
+	if expected := [][]int{{4, 5, 6, 7}, {8, 9}}; !reflect.DeepEqual(pages, expected) || requests != 2 {
+		t.Fatalf("expected pages %v in 2 requests, got %v in %d", expected, pages, requests)
+	}
+}
+
+func TestSessionStaticHosts(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto)
+	cluster.StaticHosts = []StaticHost{{Address: srv.Address, DataCenter: "dc1", Rack: "rack1", Tokens: []string{"-100", "100"}}}
+	cluster.PoolConfig.HostSelectionPolicy = TokenAwareHostPolicy(RoundRobinHostPolicy())
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hosts := db.GetHosts()
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %v", hosts)
+	}
+	host := hosts[0]
+	if host.DataCenter() != "dc1" || host.Rack() != "rack1" || !reflect.DeepEqual(host.Tokens(), []string{"-100", "100"}) {
+		t.Fatalf("expected the static host to be described, got dc=%q rack=%q tokens=%v", host.DataCenter(), host.Rack(), host.Tokens())
+	}
+	if p := db.policy.(*tokenAwareHostPolicy).partitioner; p != "org.apache.cassandra.dht.Murmur3Partitioner" {
+		t.Fatalf("expected the default partitioner, got %q", p)
+	}
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionReprepare(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.ReprepareStatements = 1
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.WarmUp(context.Background(), "void", "select"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&srv.nPrepareReq); n != 2 {
+		t.Fatalf("expected 2 prepares, got %d", n)
+	}
+
+	hosts := db.ring.allHosts()
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %d", len(hosts))
+	}
+	// statements are prepared again when the pool of a host reconnects, not
+	// on UNPREPARED responses
+	db.handleNodeConnected(hosts[0])
+
+	// only the statement used most recently is prepared again, without
+	// removing it from the cache meanwhile
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&srv.nPrepareReq) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&srv.nPrepareReq); n != 3 {
+		t.Fatalf("expected 1 statement to be prepared again, got %d prepares", n-2)
+	}
+
+	if stats := db.PreparedCacheStats(); stats.Entries != 2 || stats.Evictions != 0 {
+		t.Fatalf("expected the 2 statements to stay cached, got %+v", stats)
+	}
+
+	// the statement prepared again is cached
+	if err := db.WarmUp(context.Background(), "void", "select"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&srv.nPrepareReq); n != 3 {
+		t.Fatalf("expected the statements to be cached, got %d prepares", n)
+	}
+}
+
+func TestSessionExecuteBatchSplit(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	batch := db.NewBatch(UnloggedBatch).Split(&BatchSplit{MaxStatements: 2})
+	for i := 0; i < 5; i++ {
+		batch.Query("void")
+	}
+
+	result, err := db.ExecuteBatchSplit(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Batches) != 3 || result.Statements() != 5 || len(result.Skipped) != 0 {
+		t.Fatalf("expected 3 batches applying 5 statements, got %+v", result)
+	}
+	if want := []int{4}; !reflect.DeepEqual(result.Batches[2].Entries, want) {
+		t.Fatalf("expected the last batch to have the entries %v, got %v", want, result.Batches[2].Entries)
+	}
+	if result.Batches[0].Attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", result.Batches[0].Attempts)
+	}
+
+	if err := db.ExecuteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	batches := srv.batches
+	srv.mu.Unlock()
+	if want := []int{2, 2, 1, 2, 2, 1}; !reflect.DeepEqual(batches, want) {
+		t.Fatalf("expected batches of %v statements, got %v", want, batches)
+	}
+
+	if _, _, err := db.ExecuteBatchCAS(batch); err != ErrBatchSplitCAS {
+		t.Fatalf("expected ErrBatchSplitCAS, got %v", err)
+	}
+}
+
+type recordingBatchObserver struct {
+	mu       sync.Mutex
+	observed []ObservedBatch
+}
+
+func (o *recordingBatchObserver) ObserveBatch(ctx context.Context, b ObservedBatch) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.observed = append(o.observed, b)
+}
+
+func TestBatchObserverValueSizes(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	observer := &recordingBatchObserver{}
+	batch := db.NewBatch(UnloggedBatch).Observer(observer)
+	batch.Query("insert ?", 1)
+	batch.Query("void")
+	batch.Query("insert ?", nil)
+	if err := db.ExecuteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.observed) != 1 {
+		t.Fatalf("expected 1 observed batch, got %d", len(observer.observed))
+	}
+	if want := [][]int{{4}, nil, {0}}; !reflect.DeepEqual(observer.observed[0].ValueSizes, want) {
+		t.Fatalf("expected value sizes %v, got %v", want, observer.observed[0].ValueSizes)
+	}
+}
+
+func TestBatchSerialConsistency(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	batch := db.NewBatch(LoggedBatch).SerialConsistency(SerialConsistency(Quorum))
+	batch.Query("void")
+	if err := db.ExecuteBatch(batch); !errors.Is(err, ErrSerialConsistency) {
+		t.Fatalf("expected ErrSerialConsistency, got %v", err)
+	}
+
+	srv.mu.Lock()
+	n := len(srv.batches)
+	srv.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected the batch not to be sent, got %d batches", n)
+	}
+
+	if err := db.ExecuteBatch(batch.SerialConsistency(LocalSerial)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchIdempotent(t *testing.T) {
+	cluster := NewCluster()
+	cluster.DefaultIdempotence = true
+	s := &Session{cfg: *cluster}
+
+	// DefaultIdempotence only applies to queries
+	batch := s.NewBatch(LoggedBatch)
+	batch.Query("void")
+	if batch.IsIdempotent() {
+		t.Fatal("expected the batch of a non idempotent statement not to be idempotent")
+	}
+	batch.Entries[0].Idempotent = true
+	if !batch.IsIdempotent() {
+		t.Fatal("expected the batch of idempotent statements to be idempotent")
+	}
+
+	// the idempotence set on the batch overrides the one of its statements
+	if batch.Idempotent(false).IsIdempotent() {
+		t.Fatal("expected the batch marked as non idempotent not to be idempotent")
+	}
+	batch.Entries[0].Idempotent = false
+	if !batch.Idempotent(true).IsIdempotent() {
+		t.Fatal("expected the batch marked as idempotent to be idempotent")
+	}
+
+	payload := map[string][]byte{"k": []byte("v")}
+	if batch.SetCustomPayload(payload); !reflect.DeepEqual(batch.CustomPayload, payload) {
+		t.Fatalf("expected the custom payload %v, got %v", payload, batch.CustomPayload)
+	}
+}
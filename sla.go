@@ -0,0 +1,213 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SLAGroup is how the requests are grouped by an SLAObserver.
+type SLAGroup int
+
+const (
+	// SLAPerHost evaluates the requests of each host separately.
+	SLAPerHost SLAGroup = iota
+	// SLAPerKeyspace evaluates the requests of each keyspace separately.
+	SLAPerKeyspace
+)
+
+// SLAConfig configures an SLAObserver.
+type SLAConfig struct {
+	// Window is the duration of the windows the requests are evaluated over.
+	// Default: 1 minute
+	Window time.Duration
+
+	// MaxLatency is the average latency of the attempts of a window above
+	// which an alert is raised, 0 to ignore the latency.
+	MaxLatency time.Duration
+
+	// MaxErrorRate is the fraction, between 0 and 1, of failed attempts of a
+	// window above which an alert is raised, 0 to ignore the errors.
+	MaxErrorRate float64
+
+	// MinRequests is the number of attempts a window needs to be evaluated,
+	// so that a few slow or failed requests do not raise alerts.
+	// Default: 10
+	MinRequests int
+
+	// GroupBy is how the requests are grouped. Default: SLAPerHost
+	GroupBy SLAGroup
+
+	// Alert is called with the report of each window exceeding the
+	// thresholds. It is called synchronously by the observer, so it must not
+	// block.
+	Alert func(SLAReport)
+}
+
+// SLAReport describes a window of requests which exceeded the thresholds of an
+// SLAObserver.
+type SLAReport struct {
+	// Host is the host the requests were sent to, nil when the requests are
+	// grouped per keyspace.
+	Host *HostInfo
+	// Keyspace is the keyspace of the requests, empty when the requests are
+	// grouped per host.
+	Keyspace string
+
+	Start time.Time
+	End   time.Time
+
+	// Requests is the number of attempts of queries and batches.
+	Requests int
+	// Errors is the number of failed attempts.
+	Errors int
+	// ErrorRate is the fraction of failed attempts.
+	ErrorRate float64
+	// Latency is the average latency of the attempts.
+	Latency time.Duration
+
+	// LatencyExceeded and ErrorRateExceeded report which thresholds were
+	// exceeded.
+	LatencyExceeded   bool
+	ErrorRateExceeded bool
+}
+
+// slaWindow accumulates the requests of a group during a window.
+type slaWindow struct {
+	host     *HostInfo
+	start    time.Time
+	requests int
+	errors   int
+	latency  time.Duration
+}
+
+// SLAObserver is a QueryObserver and BatchObserver which raises alerts when
+// the latency or the error rate of the requests to a host or a keyspace
+// exceeds thresholds, for lightweight alerting without a metrics stack:
+//
+//	observer := gocql.NewSLAObserver(gocql.SLAConfig{
+//		MaxLatency:   50 * time.Millisecond,
+//		MaxErrorRate: 0.01,
+//		Alert: func(r gocql.SLAReport) {
+//			log.Printf("SLA exceeded by %v: %+v", r.Host, r)
+//		},
+//	})
+//	cluster.QueryObserver = observer
+//	cluster.BatchObserver = observer
+//
+// The requests are evaluated over consecutive windows. A window is evaluated
+// once a request of its group is observed after its end, so no alert is
+// raised for groups which no longer receive requests.
+type SLAObserver struct {
+	cfg SLAConfig
+	// now is a field so that it can be overridden in tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*slaWindow
+}
+
+// NewSLAObserver returns an SLAObserver with the given configuration.
+func NewSLAObserver(cfg SLAConfig) *SLAObserver {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	return &SLAObserver{
+		cfg:     cfg,
+		now:     time.Now,
+		windows: make(map[string]*slaWindow),
+	}
+}
+
+func (o *SLAObserver) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	o.observe(q.Host, q.Keyspace, q.End.Sub(q.Start), q.Err)
+}
+
+func (o *SLAObserver) ObserveBatch(ctx context.Context, b ObservedBatch) {
+	o.observe(b.Host, b.Keyspace, b.End.Sub(b.Start), b.Err)
+}
+
+func (o *SLAObserver) observe(host *HostInfo, keyspace string, latency time.Duration, err error) {
+	var key string
+	switch o.cfg.GroupBy {
+	case SLAPerKeyspace:
+		key = keyspace
+		host = nil
+	default:
+		if host == nil {
+			return
+		}
+		key = host.HostID()
+	}
+
+	now := o.now()
+
+	o.mu.Lock()
+	w, ok := o.windows[key]
+	var report *SLAReport
+	if ok && now.Sub(w.start) >= o.cfg.Window {
+		report = o.evaluate(w, keyspace, w.start.Add(o.cfg.Window))
+		ok = false
+	}
+	if !ok {
+		w = &slaWindow{host: host, start: now}
+		o.windows[key] = w
+	}
+	w.requests++
+	w.latency += latency
+	if err != nil {
+		w.errors++
+	}
+	o.mu.Unlock()
+
+	if report != nil && o.cfg.Alert != nil {
+		o.cfg.Alert(*report)
+	}
+}
+
+// evaluate returns the report of w if it exceeds the thresholds, nil otherwise.
+func (o *SLAObserver) evaluate(w *slaWindow, keyspace string, end time.Time) *SLAReport {
+	if w.requests < o.cfg.MinRequests {
+		return nil
+	}
+
+	r := &SLAReport{
+		Host:      w.host,
+		Start:     w.start,
+		End:       end,
+		Requests:  w.requests,
+		Errors:    w.errors,
+		ErrorRate: float64(w.errors) / float64(w.requests),
+		Latency:   w.latency / time.Duration(w.requests),
+	}
+	if o.cfg.GroupBy == SLAPerKeyspace {
+		r.Keyspace = keyspace
+	}
+	r.LatencyExceeded = o.cfg.MaxLatency > 0 && r.Latency > o.cfg.MaxLatency
+	r.ErrorRateExceeded = o.cfg.MaxErrorRate > 0 && r.ErrorRate > o.cfg.MaxErrorRate
+	if !r.LatencyExceeded && !r.ErrorRateExceeded {
+		return nil
+	}
+	return r
+}
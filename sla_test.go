@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSLAObserver(t *testing.T) {
+	var reports []SLAReport
+	o := NewSLAObserver(SLAConfig{
+		MaxLatency:   20 * time.Millisecond,
+		MaxErrorRate: 0.1,
+		MinRequests:  5,
+		Alert: func(r SLAReport) {
+			reports = append(reports, r)
+		},
+	})
+	now := time.Unix(1000, 0)
+	o.now = func() time.Time { return now }
+
+	fast := &HostInfo{hostId: "fast", connectAddress: net.IPv4(10, 0, 0, 1)}
+	slow := &HostInfo{hostId: "slow", connectAddress: net.IPv4(10, 0, 0, 2)}
+	observe := func(host *HostInfo, latency time.Duration, err error) {
+		o.ObserveQuery(context.Background(), ObservedQuery{Host: host, Keyspace: "ks", Start: now, End: now.Add(latency), Err: err})
+	}
+
+	for i := 0; i < 10; i++ {
+		observe(fast, 5*time.Millisecond, nil)
+		observe(slow, 50*time.Millisecond, nil)
+		now = now.Add(time.Second)
+	}
+	if len(reports) != 0 {
+		t.Fatalf("expected no report before the end of the window, got %v", reports)
+	}
+
+	// the windows are evaluated by the first requests after their end
+	now = now.Add(time.Minute)
+	observe(fast, 5*time.Millisecond, nil)
+	observe(slow, 5*time.Millisecond, nil)
+	if len(reports) != 1 {
+		t.Fatalf("expected a single report, got %v", reports)
+	}
+	r := reports[0]
+	if r.Host != slow || !r.LatencyExceeded || r.ErrorRateExceeded || r.Requests != 10 || r.Latency != 50*time.Millisecond {
+		t.Fatalf("unexpected report %+v", r)
+	}
+
+	// errors
+	reports = nil
+	for i := 0; i < 9; i++ {
+		observe(fast, 5*time.Millisecond, errors.New("failed"))
+	}
+	now = now.Add(time.Minute)
+	observe(fast, 5*time.Millisecond, nil)
+	if len(reports) != 1 || !reports[0].ErrorRateExceeded || reports[0].Errors != 9 || reports[0].Requests != 10 {
+		t.Fatalf("expected an error rate report, got %+v", reports)
+	}
+}
+
+func TestSLAObserverPerKeyspace(t *testing.T) {
+	var reports []SLAReport
+	o := NewSLAObserver(SLAConfig{
+		MaxErrorRate: 0.5,
+		MinRequests:  2,
+		GroupBy:      SLAPerKeyspace,
+		Alert: func(r SLAReport) {
+			reports = append(reports, r)
+		},
+	})
+	now := time.Unix(1000, 0)
+	o.now = func() time.Time { return now }
+
+	host := &HostInfo{hostId: "a"}
+	for _, ks := range []string{"ks1", "ks1", "ks2", "ks2"} {
+		var err error
+		if ks == "ks1" {
+			err = errors.New("failed")
+		}
+		o.ObserveBatch(context.Background(), ObservedBatch{Host: host, Keyspace: ks, Start: now, End: now, Err: err})
+	}
+	now = now.Add(time.Minute)
+	o.ObserveBatch(context.Background(), ObservedBatch{Host: host, Keyspace: "ks1", Start: now, End: now})
+	o.ObserveBatch(context.Background(), ObservedBatch{Host: host, Keyspace: "ks2", Start: now, End: now})
+
+	if len(reports) != 1 || reports[0].Keyspace != "ks1" || reports[0].Host != nil || reports[0].ErrorRate != 1 {
+		t.Fatalf("expected a report for ks1, got %+v", reports)
+	}
+}
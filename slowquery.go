@@ -0,0 +1,129 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// SlowQueryConfig configures the reporting of slow queries, see
+// ClusterConfig.SlowQuery.
+type SlowQueryConfig struct {
+	// Threshold is the latency above which an attempt of a query is slow.
+	// Required.
+	Threshold time.Duration
+
+	// SampleRate, if between 0 and 1 exclusive, is the fraction of the slow
+	// queries which are reported, picked at random.
+	// Default: 0 (all the slow queries are reported)
+	SampleRate float64
+
+	// Observer is called with the slow queries.
+	// Default: the slow queries are logged by the logger of the session
+	Observer SlowQueryObserver
+}
+
+// SlowQuery is an attempt of a query which took longer than the threshold of
+// the SlowQueryConfig.
+type SlowQuery struct {
+	Keyspace  string
+	Statement string
+	// ValueSizes are the sizes in bytes of the bound values, 0 for null and
+	// unset values.
+	ValueSizes []int
+
+	// Host is the coordinator of the attempt.
+	Host *HostInfo
+	// Attempt is the index of the attempt, 0 for the first attempt.
+	Attempt int
+
+	// Page is the number of the page fetched by the attempt, 0 for the first
+	// page, and PageSize its page size, 0 if the query is not paged.
+	Page     int
+	PageSize int
+	// Rows is the number of rows returned by the attempt, and MorePages
+	// whether more pages follow.
+	Rows      int
+	MorePages bool
+
+	Start   time.Time
+	Latency time.Duration
+	Err     error
+}
+
+// SlowQueryObserver is the interface implemented by the observers of slow
+// queries.
+type SlowQueryObserver interface {
+	// ObserveSlowQuery is called with each slow query reported, concurrently
+	// for the queries executed concurrently.
+	ObserveSlowQuery(context.Context, SlowQuery)
+}
+
+// SlowQueryObserverFunc is a function implementing SlowQueryObserver.
+type SlowQueryObserverFunc func(context.Context, SlowQuery)
+
+func (fn SlowQueryObserverFunc) ObserveSlowQuery(ctx context.Context, q SlowQuery) {
+	fn(ctx, q)
+}
+
+// slowQueryReporter reports the attempts of queries above the threshold of
+// the config.
+type slowQueryReporter struct {
+	cfg    SlowQueryConfig
+	logger StdLogger
+	// sample returns a random number in [0, 1), it is replaced in tests.
+	sample func() float64
+}
+
+func newSlowQueryReporter(cfg SlowQueryConfig, logger StdLogger) *slowQueryReporter {
+	return &slowQueryReporter{cfg: cfg, logger: logger, sample: rand.Float64}
+}
+
+// report reports the attempt of qry if it is slow.
+func (r *slowQueryReporter) report(qry *Query, keyspace string, start time.Time, latency time.Duration, iter *Iter, host *HostInfo, attempt int) {
+	if r == nil || latency < r.cfg.Threshold {
+		return
+	}
+	if rate := r.cfg.SampleRate; rate > 0 && rate < 1 && r.sample() >= rate {
+		return
+	}
+
+	slow := SlowQuery{
+		Keyspace:   keyspace,
+		Statement:  qry.stmt,
+		ValueSizes: iter.valueSizes,
+		Host:       host,
+		Attempt:    attempt,
+		Page:       qry.page,
+		PageSize:   qry.pageSize,
+		Rows:       iter.numRows,
+		MorePages:  iter.meta.morePages(),
+		Start:      start,
+		Latency:    latency,
+		Err:        iter.err,
+	}
+	if r.cfg.Observer != nil {
+		r.cfg.Observer.ObserveSlowQuery(qry.Context(), slow)
+		return
+	}
+	r.logger.Printf("gocql: slow query on %s (%v, attempt %d, page %d, %d rows, error %v): %s\n",
+		host.ConnectAddressAndPort(), latency, attempt, qry.page, iter.numRows, iter.err, qry.stmt)
+}
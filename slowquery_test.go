@@ -0,0 +1,76 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryReporter(t *testing.T) {
+	var reported []SlowQuery
+	r := newSlowQueryReporter(SlowQueryConfig{
+		Threshold:  100 * time.Millisecond,
+		SampleRate: 0.5,
+		Observer: SlowQueryObserverFunc(func(ctx context.Context, q SlowQuery) {
+			reported = append(reported, q)
+		}),
+	}, nil)
+	samples := []float64{0.2, 0.7}
+	r.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+
+	host := &HostInfo{hostId: "host"}
+	qry := &Query{stmt: "SELECT * FROM t WHERE k = ?", page: 2, pageSize: 100}
+	iter := &Iter{numRows: 100, valueSizes: []int{4}, meta: resultMetadata{flags: flagHasMorePages}}
+
+	r.report(qry, "ks", time.Time{}, 50*time.Millisecond, iter, host, 0)
+	r.report(qry, "ks", time.Time{}, 150*time.Millisecond, iter, host, 1)
+	r.report(qry, "ks", time.Time{}, 150*time.Millisecond, iter, host, 2)
+	if len(reported) != 1 {
+		t.Fatalf("expected 1 slow query to be sampled, got %d", len(reported))
+	}
+
+	q := reported[0]
+	if q.Keyspace != "ks" || q.Statement != qry.stmt || q.Host != host || q.Attempt != 1 ||
+		q.Page != 2 || q.PageSize != 100 || q.Rows != 100 || !q.MorePages ||
+		q.Latency != 150*time.Millisecond || len(q.ValueSizes) != 1 || q.ValueSizes[0] != 4 {
+		t.Fatalf("unexpected slow query %+v", q)
+	}
+
+	var nilReporter *slowQueryReporter
+	nilReporter.report(qry, "ks", time.Time{}, time.Hour, iter, host, 0)
+}
+
+func TestSlowQueryReporterLog(t *testing.T) {
+	var buf bytes.Buffer
+	r := newSlowQueryReporter(SlowQueryConfig{Threshold: time.Millisecond}, log.New(&buf, "", 0))
+	r.report(&Query{stmt: "SELECT"}, "ks", time.Time{}, time.Second, &Iter{err: errors.New("failed")}, &HostInfo{port: 9042}, 0)
+	if msg := buf.String(); !strings.Contains(msg, "slow query") || !strings.Contains(msg, "SELECT") || !strings.Contains(msg, "failed") {
+		t.Fatalf("unexpected log message %q", msg)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stdsql
+
+import (
+	"database/sql/driver"
+	"io"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/inf.v0"
+)
+
+// rows reads the rows of an iterator, tuple columns are read as one column per
+// element named like gocql.TupleColumnName.
+type rows struct {
+	iter    *gocql.Iter
+	columns []string
+}
+
+func newRows(iter *gocql.Iter) (*rows, error) {
+	rd, err := iter.RowData()
+	if err != nil {
+		iter.Close()
+		return nil, err
+	}
+	return &rows{iter: iter, columns: rd.Columns}, nil
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return r.iter.Close()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	rd, err := r.iter.RowData()
+	if err != nil {
+		return err
+	}
+	// scan into pointers to the values so that nulls are read as nil
+	ptrs := make([]interface{}, len(rd.Values))
+	for i, v := range rd.Values {
+		ptr := reflect.New(reflect.TypeOf(v))
+		ptr.Elem().Set(reflect.ValueOf(v))
+		ptrs[i] = ptr.Interface()
+	}
+	if !r.iter.Scan(ptrs...) {
+		if err := r.iter.Close(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, ptr := range ptrs {
+		v := reflect.ValueOf(ptr).Elem()
+		if v.IsNil() {
+			dest[i] = nil
+		} else {
+			dest[i] = driverValue(v.Elem().Interface())
+		}
+	}
+	return nil
+}
+
+// driverValue converts the values created by gocql.TypeInfo.New to the types
+// of driver.Value, the other values are returned as is.
+func driverValue(v interface{}) driver.Value {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case time.Duration:
+		return int64(v)
+	case gocql.UUID:
+		return v.String()
+	case *inf.Dec:
+		if v == nil {
+			return nil
+		}
+		return v.String()
+	case *big.Int:
+		if v == nil {
+			return nil
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
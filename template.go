@@ -0,0 +1,88 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import "context"
+
+// QueryTemplate is a statement and query options which can be shared by
+// goroutines to create and execute queries of the statement with different
+// values. Unlike a Query, which must not be modified or executed concurrently,
+// a QueryTemplate is immutable: each query created from it is independent.
+//
+//	insert := session.QueryTemplate(`INSERT INTO users (id, name) VALUES (?, ?)`, func(q *gocql.Query) {
+//		q.Consistency(gocql.LocalQuorum).Idempotent(true)
+//	})
+//
+//	// from any goroutine
+//	err := insert.Exec(ctx, id, name)
+type QueryTemplate struct {
+	qry Query
+}
+
+// QueryTemplate returns a template of queries of stmt, with the options set by
+// configure, if not nil, on a query of the session. The options are copied by
+// the queries of the template. configure must set the options on the query it
+// is passed, the query returned by Query.WithContext is ignored: the context
+// is set per query.
+func (s *Session) QueryTemplate(stmt string, configure func(q *Query)) *QueryTemplate {
+	qry := s.Query(stmt)
+	if configure != nil {
+		configure(qry)
+	}
+
+	t := &QueryTemplate{qry: *qry}
+	t.qry.values = nil
+	t.qry.context = nil
+	qry.Release()
+	return t
+}
+
+// Statement returns the statement of the template.
+func (t *QueryTemplate) Statement() string {
+	return t.qry.stmt
+}
+
+// Bind returns a new query of the template with the given values. The query
+// can be modified and executed like the ones returned by Session.Query without
+// affecting the template and its other queries.
+func (t *QueryTemplate) Bind(values ...interface{}) *Query {
+	qry := queryPool.Get().(*Query)
+	*qry = t.qry
+	qry.values = values
+	qry.routingInfo = &queryRoutingInfo{}
+	qry.refCount = 1
+	qry.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
+	return qry
+}
+
+// Exec executes a query of the template with the given values and context.
+func (t *QueryTemplate) Exec(ctx context.Context, values ...interface{}) error {
+	qry := t.Bind(values...)
+	qry.context = ctx
+	defer qry.Release()
+	return qry.Exec()
+}
+
+// Iter executes a query of the template with the given values and context,
+// and returns an iterator over its result.
+func (t *QueryTemplate) Iter(ctx context.Context, values ...interface{}) *Iter {
+	qry := t.Bind(values...)
+	qry.context = ctx
+	return qry.Iter()
+}
@@ -0,0 +1,180 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package gocql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	timerWheelTick  = 10 * time.Millisecond
+	timerWheelSlots = 512
+)
+
+// timerWheel is a hashed timer wheel expiring the timeouts of the requests of
+// a connection, so that requests do not each allocate a runtime timer. Timers
+// are hashed into the slots of the wheel by their expiry and checked once per
+// tick by a goroutine, which is started by schedule and stops once no timer is
+// left or ctx is done, so that idle connections do not wake up every tick.
+// Timers expire up to one tick late.
+type timerWheel struct {
+	ctx  context.Context
+	tick time.Duration
+
+	mu      sync.Mutex
+	slots   []*wheelTimer
+	pos     int
+	count   int
+	running bool
+	// last is the time the wheel was last advanced to.
+	last time.Time
+}
+
+// wheelTimer is a timer of a timerWheel, it is embedded in the values it
+// times out to avoid allocating it separately.
+type wheelTimer struct {
+	// C receives a value when the timer expires. It is allocated on the first
+	// schedule and reused when the timer is scheduled again.
+	C chan struct{}
+
+	wheel      *timerWheel
+	slot       int
+	rounds     int
+	prev, next *wheelTimer
+}
+
+func newTimerWheel(ctx context.Context, tick time.Duration, slots int) *timerWheel {
+	return &timerWheel{
+		ctx:   ctx,
+		tick:  tick,
+		slots: make([]*wheelTimer, slots),
+	}
+}
+
+// schedule schedules t to expire after d, it must not be scheduled already.
+func (w *timerWheel) schedule(t *wheelTimer, d time.Duration) {
+	if t.C == nil {
+		t.C = make(chan struct{}, 1)
+	} else {
+		// drop the expiry of the previous schedule if it was not received
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.running {
+		w.running = true
+		w.last = now
+		go w.run()
+	}
+
+	// the ticks are counted from the last time the wheel was advanced to, so
+	// that timers never expire early
+	ticks := int((now.Sub(w.last) + d + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	t.wheel = w
+	t.slot = (w.pos + ticks) % len(w.slots)
+	t.rounds = (ticks - 1) / len(w.slots)
+	t.prev = nil
+	t.next = w.slots[t.slot]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.slots[t.slot] = t
+	w.count++
+}
+
+// stop removes t from the wheel, it returns false if t expired or was not
+// scheduled.
+func (w *timerWheel) stop(t *wheelTimer) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t.wheel != w {
+		return false
+	}
+	w.remove(t)
+	return true
+}
+
+func (w *timerWheel) remove(t *wheelTimer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.slots[t.slot] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next, t.wheel = nil, nil, nil
+	w.count--
+}
+
+func (w *timerWheel) run() {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if !w.advance(now) {
+				return
+			}
+		case <-w.ctx.Done():
+			w.mu.Lock()
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+	}
+}
+
+// advance advances the wheel by the ticks elapsed until now, expiring the
+// timers due. It returns false, marking the wheel as not running, if no timer
+// is left, so that the next schedule starts the wheel again.
+func (w *timerWheel) advance(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ; !w.last.Add(w.tick).After(now); w.last = w.last.Add(w.tick) {
+		w.pos = (w.pos + 1) % len(w.slots)
+		for t := w.slots[w.pos]; t != nil; {
+			next := t.next
+			if t.rounds > 0 {
+				t.rounds--
+			} else {
+				w.remove(t)
+				t.C <- struct{}{}
+			}
+			t = next
+		}
+	}
+
+	if w.count == 0 {
+		w.running = false
+		return false
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package gocql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimerWheel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := newTimerWheel(ctx, time.Millisecond, 8)
+
+	// the timers of 20ms go around the wheel of 8ms
+	var short, long, stopped wheelTimer
+	start := time.Now()
+	w.schedule(&short, 5*time.Millisecond)
+	w.schedule(&long, 20*time.Millisecond)
+	w.schedule(&stopped, 10*time.Millisecond)
+
+	if !w.stop(&stopped) {
+		t.Fatal("expected to stop scheduled timer")
+	}
+
+	<-short.C
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("timer of 5ms expired after %v", elapsed)
+	}
+	<-long.C
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("timer of 20ms expired after %v", elapsed)
+	}
+	if w.stop(&long) {
+		t.Fatal("expected not to stop expired timer")
+	}
+
+	select {
+	case <-stopped.C:
+		t.Fatal("stopped timer expired")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the timer is reused once expired
+	start = time.Now()
+	w.schedule(&short, 5*time.Millisecond)
+	<-short.C
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("rescheduled timer of 5ms expired after %v", elapsed)
+	}
+
+	// the wheel goes idle once no timer is left
+	waitWheelRunning(t, w, false)
+
+	// and starts again with the next timer
+	start = time.Now()
+	w.schedule(&short, 5*time.Millisecond)
+	w.mu.Lock()
+	running := w.running
+	w.mu.Unlock()
+	if !running {
+		t.Fatal("expected the wheel to run with a timer scheduled")
+	}
+	<-short.C
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("timer of 5ms scheduled on an idle wheel expired after %v", elapsed)
+	}
+	waitWheelRunning(t, w, false)
+
+	// the wheel stops when its context is done, even with timers left
+	w.schedule(&long, time.Hour)
+	cancel()
+	waitWheelRunning(t, w, false)
+}
+
+func waitWheelRunning(t *testing.T, w *timerWheel, running bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		w.mu.Lock()
+		r := w.running
+		w.mu.Unlock()
+		if r == running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected wheel running=%v", running)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func BenchmarkTimerWheel(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := newTimerWheel(ctx, timerWheelTick, timerWheelSlots)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var t wheelTimer
+		for pb.Next() {
+			w.schedule(&t, time.Second)
+			w.stop(&t)
+		}
+	})
+}
@@ -32,10 +32,13 @@ import (
 	"bytes"
 	"crypto/md5"
 	"fmt"
+	"math"
 	"math/big"
+	"math/bits"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gocql/gocql/internal/murmur"
 )
@@ -80,6 +83,39 @@ func (m murmur3Token) Less(token token) bool {
 	return m < token.(murmur3Token)
 }
 
+// RoutingKey serializes the values of the partition key columns of a table,
+// of the given types and in the order of the partition key, into the routing
+// key Cassandra hashes to place the partition.
+func RoutingKey(types []TypeInfo, values ...interface{}) ([]byte, error) {
+	if len(types) == 0 || len(types) != len(values) {
+		return nil, fmt.Errorf("gocql: expected %d partition key values, got %d", len(types), len(values))
+	}
+
+	info := &routingKeyInfo{indexes: make([]int, len(types)), types: types}
+	for i := range info.indexes {
+		info.indexes[i] = i
+	}
+	return createRoutingKey(info, values)
+}
+
+// Murmur3Token returns the token of the Murmur3Partitioner, the default one of
+// Cassandra, for a routing key as returned by RoutingKey.
+func Murmur3Token(routingKey []byte) int64 {
+	return murmur.Murmur3H1(routingKey)
+}
+
+// TokenShard maps a Murmur3Partitioner token to one of n shards, each owning
+// a contiguous and equal part of the token ring, so that partitions close on
+// the ring, and thus likely to share replicas, fall into the same shard.
+func TokenShard(token int64, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	// order the tokens from 0 to 2**64-1, then scale them down to [0, n)
+	hi, _ := bits.Mul64(uint64(token)^(1<<63), uint64(n))
+	return int(hi)
+}
+
 // order preserving partitioner and token
 type orderedPartitioner struct{}
 type orderedToken string
@@ -165,19 +201,26 @@ type tokenRing struct {
 	hosts []*HostInfo
 }
 
+func newPartitioner(name string) (partitioner, error) {
+	if strings.HasSuffix(name, "Murmur3Partitioner") {
+		return murmur3Partitioner{}, nil
+	} else if strings.HasSuffix(name, "OrderedPartitioner") {
+		return orderedPartitioner{}, nil
+	} else if strings.HasSuffix(name, "RandomPartitioner") {
+		return randomPartitioner{}, nil
+	}
+	return nil, fmt.Errorf("unsupported partitioner '%s'", name)
+}
+
 func newTokenRing(partitioner string, hosts []*HostInfo) (*tokenRing, error) {
-	tokenRing := &tokenRing{
-		hosts: hosts,
+	p, err := newPartitioner(partitioner)
+	if err != nil {
+		return nil, err
 	}
 
-	if strings.HasSuffix(partitioner, "Murmur3Partitioner") {
-		tokenRing.partitioner = murmur3Partitioner{}
-	} else if strings.HasSuffix(partitioner, "OrderedPartitioner") {
-		tokenRing.partitioner = orderedPartitioner{}
-	} else if strings.HasSuffix(partitioner, "RandomPartitioner") {
-		tokenRing.partitioner = randomPartitioner{}
-	} else {
-		return nil, fmt.Errorf("unsupported partitioner '%s'", partitioner)
+	tokenRing := &tokenRing{
+		partitioner: p,
+		hosts:       hosts,
 	}
 
 	for _, host := range hosts {
@@ -244,3 +287,215 @@ func (t *tokenRing) GetHostForToken(token token) (host *HostInfo, endToken token
 	v := t.tokens[p]
 	return v.host, v.token
 }
+
+// TokenRange is a range of the token ring, starting after Start and ending
+// with End inclusive. The first range of the ring wraps around, it starts after
+// the last token of the ring.
+type TokenRange struct {
+	Start string
+	End   string
+}
+
+// TokenMetadata is a snapshot of the token ring of the cluster, which computes
+// tokens and replicas like the token aware host policy does. It is not updated
+// when the ring changes, see Session.TokenMetadata.
+type TokenMetadata struct {
+	ring             *tokenRing
+	keyspaceMetadata func(keyspace string) (*KeyspaceMetadata, error)
+	logger           StdLogger
+
+	mu sync.Mutex
+	// replicas caches the replica maps per keyspace, nil for keyspaces whose
+	// replication strategy is not known.
+	replicas map[string]tokenRingReplicas
+}
+
+// Partitioner returns the name of the partitioner of the cluster.
+func (m *TokenMetadata) Partitioner() string {
+	return m.ring.partitioner.Name()
+}
+
+// Token returns the token of the partition with the given routing key, see
+// Query.GetRoutingKey.
+func (m *TokenMetadata) Token(routingKey []byte) string {
+	return m.ring.partitioner.Hash(routingKey).String()
+}
+
+// TokenRanges returns the ranges of the token ring delimited by the tokens of
+// the hosts, ordered by their end token.
+func (m *TokenMetadata) TokenRanges() []TokenRange {
+	tokens := m.ring.tokens
+	ranges := make([]TokenRange, len(tokens))
+	for i, ht := range tokens {
+		ranges[i] = TokenRange{
+			Start: tokens[(i+len(tokens)-1)%len(tokens)].token.String(),
+			End:   ht.token.String(),
+		}
+	}
+	return ranges
+}
+
+// Replicas returns the replicas in keyspace of the partition with the given
+// routing key, starting with the primary replica. Only the primary replica is
+// returned if the replication strategy of the keyspace is not supported.
+func (m *TokenMetadata) Replicas(keyspace string, routingKey []byte) ([]*HostInfo, error) {
+	return m.replicasFor(keyspace, m.ring.partitioner.Hash(routingKey))
+}
+
+// RangeReplicas returns the replicas in keyspace of a range returned by
+// TokenRanges, starting with the primary replica.
+func (m *TokenMetadata) RangeReplicas(keyspace string, r TokenRange) ([]*HostInfo, error) {
+	return m.replicasFor(keyspace, m.ring.partitioner.ParseString(r.End))
+}
+
+func (m *TokenMetadata) replicasFor(keyspace string, t token) ([]*HostInfo, error) {
+	if len(m.ring.tokens) == 0 {
+		return nil, fmt.Errorf("gocql: no tokens in the token ring")
+	}
+
+	replicas, err := m.keyspaceReplicas(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if replicas == nil {
+		host, _ := m.ring.GetHostForToken(t)
+		return []*HostInfo{host}, nil
+	}
+
+	ht := replicas.replicasFor(t)
+	hosts := make([]*HostInfo, len(ht.hosts))
+	copy(hosts, ht.hosts)
+	return hosts, nil
+}
+
+// keyspaceReplicas returns the replica map of keyspace, or nil if its
+// replication strategy is not supported.
+func (m *TokenMetadata) keyspaceReplicas(keyspace string) (tokenRingReplicas, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if replicas, ok := m.replicas[keyspace]; ok {
+		return replicas, nil
+	}
+
+	ks, err := m.keyspaceMetadata(keyspace)
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas tokenRingReplicas
+	if strat := getStrategy(ks, m.logger); strat != nil {
+		replicas = strat.replicaMap(m.ring)
+	}
+	m.replicas[keyspace] = replicas
+	return replicas, nil
+}
+
+// HostOwnership is the fraction of the token ring replicated by a host.
+type HostOwnership struct {
+	Host *HostInfo
+	// Ownership is the fraction of the token ring, between 0 and 1, for
+	// which the host is a replica.
+	Ownership float64
+}
+
+// TokenOwnership reports the fraction of the token ring each host owns for a
+// keyspace, as computed by the client from the token map and the replication
+// strategy of the keyspace.
+type TokenOwnership struct {
+	Keyspace string
+	Hosts    []HostOwnership
+}
+
+// Imbalanced returns the hosts whose ownership differs from the mean ownership
+// of the hosts in their datacenter by more than threshold times that mean, so
+// a threshold of 0.2 flags hosts owning 20% more or less than their peers.
+func (o *TokenOwnership) Imbalanced(threshold float64) []HostOwnership {
+	type dcOwnership struct {
+		total float64
+		hosts int
+	}
+	dcs := make(map[string]*dcOwnership)
+	for _, h := range o.Hosts {
+		dc := dcs[h.Host.DataCenter()]
+		if dc == nil {
+			dc = &dcOwnership{}
+			dcs[h.Host.DataCenter()] = dc
+		}
+		dc.total += h.Ownership
+		dc.hosts++
+	}
+
+	var imbalanced []HostOwnership
+	for _, h := range o.Hosts {
+		dc := dcs[h.Host.DataCenter()]
+		mean := dc.total / float64(dc.hosts)
+		if mean > 0 && math.Abs(h.Ownership-mean) > threshold*mean {
+			imbalanced = append(imbalanced, h)
+		}
+	}
+	return imbalanced
+}
+
+// 2 ** 127, the size of the RandomPartitioner token range
+var randomTokenRange = new(big.Int).Lsh(big.NewInt(1), 127)
+
+// tokenRangeFraction returns the fraction of the ring covered by the range
+// starting after start and ending with end, or false if the partitioner does
+// not distribute tokens uniformly.
+func tokenRangeFraction(start, end token) (float64, bool) {
+	switch end := end.(type) {
+	case murmur3Token:
+		width := uint64(end) - uint64(start.(murmur3Token))
+		if width == 0 {
+			return 1, true
+		}
+		return float64(width) / math.Exp2(64), true
+	case *randomToken:
+		width := new(big.Int).Sub((*big.Int)(end), (*big.Int)(start.(*randomToken)))
+		if width.Sign() <= 0 {
+			width.Add(width, randomTokenRange)
+		}
+		fraction, _ := new(big.Rat).SetFrac(width, randomTokenRange).Float64()
+		return fraction, true
+	default:
+		return 0, false
+	}
+}
+
+// tokenOwnership computes the ownership of every host of tokenRing for the
+// given replica map, or the primary ranges of the hosts if replicas is empty.
+func tokenOwnership(keyspace string, tokenRing *tokenRing, replicas tokenRingReplicas) (*TokenOwnership, error) {
+	if replicas == nil {
+		for _, ht := range tokenRing.tokens {
+			replicas = append(replicas, hostTokens{token: ht.token, hosts: []*HostInfo{ht.host}})
+		}
+	}
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("gocql: no tokens in the token ring")
+	}
+
+	ownership := make(map[*HostInfo]float64, len(tokenRing.hosts))
+	for _, host := range tokenRing.hosts {
+		ownership[host] = 0
+	}
+	for i, r := range replicas {
+		start := replicas[(i+len(replicas)-1)%len(replicas)].token
+		fraction, ok := tokenRangeFraction(start, r.token)
+		if !ok {
+			return nil, fmt.Errorf("gocql: token ownership is not supported by %s", tokenRing.partitioner.Name())
+		}
+		for _, host := range r.hosts {
+			ownership[host] += fraction
+		}
+	}
+
+	res := &TokenOwnership{Keyspace: keyspace, Hosts: make([]HostOwnership, 0, len(ownership))}
+	for host, owned := range ownership {
+		res.Hosts = append(res.Hosts, HostOwnership{Host: host, Ownership: owned})
+	}
+	sort.Slice(res.Hosts, func(i, j int) bool {
+		return res.Hosts[i].Host.HostID() < res.Hosts[j].Host.HostID()
+	})
+	return res, nil
+}
@@ -33,6 +33,7 @@ import (
 	"fmt"
 	"math/big"
 	"net"
+	"reflect"
 	"sort"
 	"strconv"
 	"testing"
@@ -343,3 +344,191 @@ func TestTokenRing_Random(t *testing.T) {
 		t.Errorf("Expected address 1 for token \"24324545443332\", but was %s", actual.ConnectAddress())
 	}
 }
+
+func TestTokenOwnership(t *testing.T) {
+	newHost := func(id string, dc string, token string) *HostInfo {
+		return &HostInfo{hostId: id, dataCenter: dc, tokens: []string{token}}
+	}
+	hosts := []*HostInfo{
+		newHost("a", "dc1", "-4611686018427387904"),
+		newHost("b", "dc1", "0"),
+		newHost("c", "dc1", "4611686018427387904"),
+		newHost("d", "dc1", "-9223372036854775808"),
+	}
+	ring, err := newTokenRing("Murmur3Partitioner", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ownership, err := tokenOwnership("ks", ring, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range ownership.Hosts {
+		if h.Ownership != 0.25 {
+			t.Errorf("expected host %s to own 0.25 of the ring, got %v", h.Host.HostID(), h.Ownership)
+		}
+	}
+	if imbalanced := ownership.Imbalanced(0.1); len(imbalanced) != 0 {
+		t.Errorf("expected no imbalanced hosts, got %v", imbalanced)
+	}
+
+	ownership, err = tokenOwnership("ks", ring, (&simpleStrategy{rf: 2}).replicaMap(ring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range ownership.Hosts {
+		if h.Ownership != 0.5 {
+			t.Errorf("expected host %s to replicate 0.5 of the ring, got %v", h.Host.HostID(), h.Ownership)
+		}
+	}
+
+	hosts[1].tokens = []string{"2305843009213693952"}
+	ring, err = newTokenRing("Murmur3Partitioner", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownership, err = tokenOwnership("ks", ring, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imbalanced := ownership.Imbalanced(0.2)
+	if len(imbalanced) != 2 || imbalanced[0].Host.HostID() != "b" || imbalanced[1].Host.HostID() != "c" {
+		t.Fatalf("expected hosts b and c to be imbalanced, got %v", imbalanced)
+	}
+
+	ring, err = newTokenRing("OrderedPartitioner", hostsForTests(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokenOwnership("ks", ring, nil); err == nil {
+		t.Fatal("expected an error for the ordered partitioner")
+	}
+}
+
+func TestTokenMetadata(t *testing.T) {
+	newHost := func(id string, token string) *HostInfo {
+		return &HostInfo{hostId: id, dataCenter: "dc1", rack: "r1", tokens: []string{token}}
+	}
+	hosts := []*HostInfo{
+		newHost("a", "-4611686018427387904"),
+		newHost("b", "0"),
+		newHost("c", "4611686018427387904"),
+	}
+	ring, err := newTokenRing("Murmur3Partitioner", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &TokenMetadata{
+		ring: ring,
+		keyspaceMetadata: func(keyspace string) (*KeyspaceMetadata, error) {
+			switch keyspace {
+			case "simple":
+				return &KeyspaceMetadata{
+					Name:            keyspace,
+					StrategyClass:   "org.apache.cassandra.locator.SimpleStrategy",
+					StrategyOptions: map[string]interface{}{"replication_factor": "2"},
+				}, nil
+			case "local":
+				return &KeyspaceMetadata{Name: keyspace, StrategyClass: "LocalStrategy"}, nil
+			}
+			return nil, ErrKeyspaceDoesNotExist
+		},
+		logger:   &defaultLogger{},
+		replicas: make(map[string]tokenRingReplicas),
+	}
+
+	if p := m.Partitioner(); p != "Murmur3Partitioner" {
+		t.Errorf("expected Murmur3Partitioner, got %s", p)
+	}
+	key := []byte("key")
+	if token := m.Token(key); token != strconv.FormatInt(Murmur3Token(key), 10) {
+		t.Errorf("unexpected token %s for routing key", token)
+	}
+
+	expectedRanges := []TokenRange{
+		{Start: "4611686018427387904", End: "-4611686018427387904"},
+		{Start: "-4611686018427387904", End: "0"},
+		{Start: "0", End: "4611686018427387904"},
+	}
+	ranges := m.TokenRanges()
+	if !reflect.DeepEqual(ranges, expectedRanges) {
+		t.Fatalf("expected token ranges %v, got %v", expectedRanges, ranges)
+	}
+
+	replicas, err := m.RangeReplicas("simple", ranges[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != 2 || replicas[0] != hosts[1] || replicas[1] != hosts[2] {
+		t.Errorf("expected replicas b and c for range %v, got %v", ranges[1], replicas)
+	}
+
+	// only the primary replica is known without a supported strategy
+	replicas, err = m.RangeReplicas("local", ranges[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != 1 || replicas[0] != hosts[0] {
+		t.Errorf("expected primary replica a for range %v, got %v", ranges[0], replicas)
+	}
+
+	replicas, err = m.Replicas("simple", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary, _ := ring.GetHostForToken(ring.partitioner.Hash(key))
+	if len(replicas) != 2 || replicas[0] != primary {
+		t.Errorf("expected 2 replicas starting with %v, got %v", primary, replicas)
+	}
+
+	if _, err := m.Replicas("missing", key); err != ErrKeyspaceDoesNotExist {
+		t.Errorf("expected ErrKeyspaceDoesNotExist, got %v", err)
+	}
+}
+
+func TestRoutingKeyMurmur3Token(t *testing.T) {
+	intType := NativeType{proto: protoVersion4, typ: TypeInt}
+	textType := NativeType{proto: protoVersion4, typ: TypeVarchar}
+
+	key, err := RoutingKey([]TypeInfo{intType}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, []byte{0, 0, 0, 1}) {
+		t.Fatalf("unexpected single column routing key % x", key)
+	}
+	// token of the int partition key 1, as computed by Cassandra
+	if token := Murmur3Token(key); token != -4069959284402364209 {
+		t.Fatalf("unexpected token %d", token)
+	}
+
+	key, err = RoutingKey([]TypeInfo{intType, textType}, 1, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, []byte{0, 4, 0, 0, 0, 1, 0, 0, 1, 'a', 0}) {
+		t.Fatalf("unexpected composite routing key % x", key)
+	}
+
+	if _, err := RoutingKey([]TypeInfo{intType, textType}, 1); err == nil {
+		t.Fatal("expected an error for missing values")
+	}
+}
+
+func TestTokenShard(t *testing.T) {
+	tests := []struct {
+		token    int64
+		expected int
+	}{
+		{-9223372036854775808, 0},
+		{-1, 1},
+		{0, 2},
+		{9223372036854775807, 3},
+	}
+	for _, test := range tests {
+		if shard := TokenShard(test.token, 4); shard != test.expected {
+			t.Errorf("expected token %d in shard %d, got %d", test.token, test.expected, shard)
+		}
+	}
+}
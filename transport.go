@@ -0,0 +1,115 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// Transport is a bidirectional stream of bytes to a host over which CQL frames
+// are exchanged. It is the subset of net.Conn used by the driver, so that
+// transports which are not network connections, such as QUIC streams or
+// in-process pipes to an embedded server, can be plugged in.
+//
+// Implementations which also implement RemoteAddr() net.Addr report that
+// address in connection logs and errors.
+//
+// Experimental, this interface may change.
+type Transport interface {
+	io.ReadWriteCloser
+
+	// SetReadDeadline sets the deadline for future Read calls, a zero value
+	// means Read will not time out.
+	SetReadDeadline(t time.Time) error
+
+	// SetWriteDeadline sets the deadline for future Write calls, a zero value
+	// means Write will not time out.
+	SetWriteDeadline(t time.Time) error
+}
+
+// TransportFactory creates the transports over which connections to hosts are
+// established. The returned transport must be directly usable for the CQL
+// protocol, in particular the factory is responsible for setting up TLS if
+// needed.
+//
+// Experimental, this interface may change.
+type TransportFactory interface {
+	NewTransport(ctx context.Context, host *HostInfo) (Transport, error)
+}
+
+// transportHostDialer adapts a TransportFactory to a HostDialer.
+type transportHostDialer struct {
+	factory TransportFactory
+}
+
+func (d *transportHostDialer) DialHost(ctx context.Context, host *HostInfo) (*DialedHost, error) {
+	transport, err := d.factory.NewTransport(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, ok := transport.(net.Conn)
+	if !ok {
+		conn = &transportConn{Transport: transport, remoteAddr: transportAddr(host.HostnameAndPort())}
+	}
+
+	_, isTCP := conn.(*net.TCPConn)
+	return &DialedHost{
+		Conn: conn,
+		// write coalescing can only use writev on TCP connections.
+		DisableCoalesce: !isTCP,
+	}, nil
+}
+
+// transportConn implements net.Conn on top of a Transport.
+type transportConn struct {
+	Transport
+	remoteAddr net.Addr
+}
+
+func (c *transportConn) LocalAddr() net.Addr {
+	if t, ok := c.Transport.(interface{ LocalAddr() net.Addr }); ok {
+		return t.LocalAddr()
+	}
+	return transportAddr("")
+}
+
+func (c *transportConn) RemoteAddr() net.Addr {
+	if t, ok := c.Transport.(interface{ RemoteAddr() net.Addr }); ok {
+		return t.RemoteAddr()
+	}
+	return c.remoteAddr
+}
+
+func (c *transportConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// transportAddr is the net.Addr of a Transport which does not report its
+// addresses.
+type transportAddr string
+
+func (a transportAddr) Network() string { return "transport" }
+func (a transportAddr) String() string  { return string(a) }
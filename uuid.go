@@ -30,12 +30,14 @@ package gocql
 // http://tools.ietf.org/html/rfc4122
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/sha1"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -82,27 +84,71 @@ func init() {
 // ParseUUID parses a 32 digit hexadecimal number (that might contain hypens)
 // representing an UUID.
 func ParseUUID(input string) (UUID, error) {
-	var u UUID
-	j := 0
-	for _, r := range input {
-		switch {
-		case r == '-' && j&1 == 0:
-			continue
-		case r >= '0' && r <= '9' && j < 32:
-			u[j/2] |= byte(r-'0') << uint(4-j&1*4)
-		case r >= 'a' && r <= 'f' && j < 32:
-			u[j/2] |= byte(r-'a'+10) << uint(4-j&1*4)
-		case r >= 'A' && r <= 'F' && j < 32:
-			u[j/2] |= byte(r-'A'+10) << uint(4-j&1*4)
-		default:
+	var p uuidParser
+	for i := 0; i < len(input); i++ {
+		if !p.next(input[i]) {
 			return UUID{}, fmt.Errorf("invalid UUID %q", input)
 		}
-		j += 1
 	}
-	if j != 32 {
+	if !p.done() {
 		return UUID{}, fmt.Errorf("invalid UUID %q", input)
 	}
-	return u, nil
+	return p.u, nil
+}
+
+// ParseUUIDBytes is like ParseUUID but parses the textual representation of
+// an UUID from a byte slice without converting it to a string first.
+func ParseUUIDBytes(input []byte) (UUID, error) {
+	var p uuidParser
+	for _, c := range input {
+		if !p.next(c) {
+			return UUID{}, fmt.Errorf("invalid UUID %q", input)
+		}
+	}
+	if !p.done() {
+		return UUID{}, fmt.Errorf("invalid UUID %q", input)
+	}
+	return p.u, nil
+}
+
+// hexValues maps an ASCII character to its hexadecimal value, or to 0xFF if
+// the character is not a hexadecimal digit.
+var hexValues = func() (t [256]byte) {
+	for i := range t {
+		t[i] = 0xFF
+	}
+	for c := 0; c < 10; c++ {
+		t['0'+c] = byte(c)
+	}
+	for c := 0; c < 6; c++ {
+		t['a'+c] = byte(c + 10)
+		t['A'+c] = byte(c + 10)
+	}
+	return t
+}()
+
+// uuidParser decodes the textual representation of an UUID one byte at a
+// time. Hyphens are accepted between any two bytes of the UUID.
+type uuidParser struct {
+	u UUID
+	j int
+}
+
+func (p *uuidParser) next(c byte) bool {
+	if c == '-' && p.j&1 == 0 {
+		return true
+	}
+	v := hexValues[c]
+	if v == 0xFF || p.j >= 32 {
+		return false
+	}
+	p.u[p.j/2] |= v << uint(4-p.j&1*4)
+	p.j++
+	return true
+}
+
+func (p *uuidParser) done() bool {
+	return p.j == 32
 }
 
 // UUIDFromBytes converts a raw byte slice to an UUID.
@@ -152,10 +198,96 @@ func getTimestamp(t time.Time) int64 {
 
 // TimeUUID generates a new time based UUID (version 1) using the current
 // time as the timestamp.
+//
+// If a generator was installed with SetTimeUUIDGenerator, it is used to
+// generate the UUID.
 func TimeUUID() UUID {
+	if g, _ := timeUUIDGenerator.Load().(*TimeUUIDGenerator); g != nil {
+		return g.Next()
+	}
 	return UUIDFromTime(time.Now())
 }
 
+var timeUUIDGenerator atomic.Value // *TimeUUIDGenerator
+
+// SetTimeUUIDGenerator sets the generator used by TimeUUID. Passing nil
+// restores the default behavior of TimeUUID.
+func SetTimeUUIDGenerator(g *TimeUUIDGenerator) {
+	timeUUIDGenerator.Store(g)
+}
+
+// TimeUUIDGenerator generates time based UUIDs (version 1) with a fixed node
+// identifier and clock sequence. Timestamps of generated UUIDs are strictly
+// increasing, even if the wall clock goes backwards (for example due to NTP
+// adjustments or leap seconds) or many UUIDs are requested within the same
+// 100-nanosecond interval, so a generator never returns the same UUID twice.
+//
+// Unlike UUIDFromTime, which derives the node from the MAC address of the
+// machine, the node can be chosen by the application. This is useful when
+// MAC addresses are not stable or not unique, as is often the case with
+// containers. See TimeUUIDNodeFromName.
+//
+// A TimeUUIDGenerator is safe for concurrent use.
+type TimeUUIDGenerator struct {
+	mu            sync.Mutex
+	node          [6]byte
+	clockSeq      uint32
+	lastTimestamp int64
+
+	// now is a field so that it can be overridden in tests
+	now func() time.Time
+}
+
+// NewTimeUUIDGenerator creates a generator which uses the given node
+// identifier (up to 6 bytes) and clock sequence (14 bits).
+//
+// RFC 4122 recommends incrementing the clock sequence whenever the clock may
+// have been set backwards since UUIDs were last generated with the same node,
+// for example across restarts. Applications which persist ClockSeq can pass
+// the persisted value plus one here; others can use a random value.
+func NewTimeUUIDGenerator(node []byte, clockSeq uint16) *TimeUUIDGenerator {
+	g := &TimeUUIDGenerator{
+		clockSeq: uint32(clockSeq) & 0x3FFF,
+		now:      time.Now,
+	}
+	copy(g.node[:], node)
+	return g
+}
+
+// Next returns a new time based UUID using the current time as the timestamp.
+func (g *TimeUUIDGenerator) Next() UUID {
+	g.mu.Lock()
+	ts := getTimestamp(g.now())
+	if ts <= g.lastTimestamp {
+		ts = g.lastTimestamp + 1
+	}
+	g.lastTimestamp = ts
+	g.mu.Unlock()
+
+	return TimeUUIDWith(ts, g.clockSeq, g.node[:])
+}
+
+// Node returns the node identifier of generated UUIDs.
+func (g *TimeUUIDGenerator) Node() []byte {
+	node := g.node
+	return node[:]
+}
+
+// ClockSeq returns the clock sequence of generated UUIDs.
+func (g *TimeUUIDGenerator) ClockSeq() uint16 {
+	return uint16(g.clockSeq)
+}
+
+// TimeUUIDNodeFromName derives a stable 6 byte node identifier from name,
+// such as a pod or host name. The multicast bit is set as recommended by
+// RFC 4122 for node identifiers which are not IEEE 802 addresses.
+func TimeUUIDNodeFromName(name string) []byte {
+	sum := sha1.Sum([]byte(name))
+	node := sum[:6]
+	node[0] |= 0x01
+	return node
+}
+
 // The min and max clock values for a UUID.
 //
 // Cassandra's TimeUUIDType compares the lsb parts as signed byte arrays.
@@ -228,19 +360,34 @@ func TimeUUIDWith(t int64, clock uint32, node []byte) UUID {
 // String returns the UUID in it's canonical form, a 32 digit hexadecimal
 // number in the form of xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
 func (u UUID) String() string {
+	var buf [36]byte
+	u.encodeHex(buf[:])
+	return string(buf[:])
+}
+
+// AppendText appends the canonical form of the UUID, as returned by String,
+// to b and returns the extended buffer.
+func (u UUID) AppendText(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, 36)...)
+	u.encodeHex(b[n:])
+	return b, nil
+}
+
+// encodeHex writes the canonical form of the UUID into dst which must be
+// at least 36 bytes long.
+func (u UUID) encodeHex(dst []byte) {
 	var offsets = [...]int{0, 2, 4, 6, 9, 11, 14, 16, 19, 21, 24, 26, 28, 30, 32, 34}
 	const hexString = "0123456789abcdef"
-	r := make([]byte, 36)
+	_ = dst[35]
 	for i, b := range u {
-		r[offsets[i]] = hexString[b>>4]
-		r[offsets[i]+1] = hexString[b&0xF]
+		dst[offsets[i]] = hexString[b>>4]
+		dst[offsets[i]+1] = hexString[b&0xF]
 	}
-	r[8] = '-'
-	r[13] = '-'
-	r[18] = '-'
-	r[23] = '-'
-	return string(r)
-
+	dst[8] = '-'
+	dst[13] = '-'
+	dst[18] = '-'
+	dst[23] = '-'
 }
 
 // Bytes returns the raw byte slice for this UUID. A UUID is always 128 bits
@@ -316,17 +463,20 @@ func (u UUID) Time() time.Time {
 
 // Marshaling for JSON
 func (u UUID) MarshalJSON() ([]byte, error) {
-	return []byte(`"` + u.String() + `"`), nil
+	b := make([]byte, 0, 38)
+	b = append(b, '"')
+	b, _ = u.AppendText(b)
+	return append(b, '"'), nil
 }
 
 // Unmarshaling for JSON
 func (u *UUID) UnmarshalJSON(data []byte) error {
-	str := strings.Trim(string(data), `"`)
+	str := bytes.Trim(data, `"`)
 	if len(str) > 36 {
 		return fmt.Errorf("invalid JSON UUID %s", str)
 	}
 
-	parsed, err := ParseUUID(str)
+	parsed, err := ParseUUIDBytes(str)
 	if err == nil {
 		copy(u[:], parsed[:])
 	}
@@ -335,10 +485,10 @@ func (u *UUID) UnmarshalJSON(data []byte) error {
 }
 
 func (u UUID) MarshalText() ([]byte, error) {
-	return []byte(u.String()), nil
+	return u.AppendText(make([]byte, 0, 36))
 }
 
 func (u *UUID) UnmarshalText(text []byte) (err error) {
-	*u, err = ParseUUID(string(text))
+	*u, err = ParseUUIDBytes(text)
 	return
 }
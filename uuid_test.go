@@ -105,6 +105,58 @@ func TestPredefinedUUID(t *testing.T) {
 	}
 }
 
+func TestParseUUIDBytes(t *testing.T) {
+	for i := range testsUUID {
+		want, err := ParseUUID(testsUUID[i].input)
+		if err != nil {
+			t.Fatalf("ParseUUID #%d: %v", i, err)
+		}
+
+		got, err := ParseUUIDBytes([]byte(testsUUID[i].input))
+		if err != nil {
+			t.Errorf("ParseUUIDBytes #%d: %v", i, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseUUIDBytes #%d: expected %v got %v", i, want, got)
+		}
+	}
+
+	for _, input := range []string{"", "4f00", "z4f00409-cef8-4822-802c-deb20704c365", "b4f00409-cef8-4822-802c-deb20704c3655", "b4f00409-cef8-4822-802c-deb20704c36\u00e9"} {
+		if _, err := ParseUUIDBytes([]byte(input)); err == nil || !strings.Contains(err.Error(), "invalid UUID") {
+			t.Errorf("ParseUUIDBytes(%q): expected invalid UUID error, got '%v'", input, err)
+		}
+	}
+}
+
+func TestUUIDAppendText(t *testing.T) {
+	u, err := ParseUUID("486f3a88-775b-11e3-ae07-d231feb1dc81")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := u.AppendText([]byte("uuid="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "uuid=486f3a88-775b-11e3-ae07-d231feb1dc81"; string(got) != want {
+		t.Fatalf("expected %q got %q", want, got)
+	}
+}
+
+func TestUUIDAllocs(t *testing.T) {
+	u := MustRandomUUID()
+	text := []byte(u.String())
+	buf := make([]byte, 0, 36)
+
+	if n := testing.AllocsPerRun(100, func() { ParseUUIDBytes(text) }); n != 0 {
+		t.Errorf("ParseUUIDBytes: expected no allocations, got %v", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { u.AppendText(buf[:0]) }); n != 0 {
+		t.Errorf("AppendText: expected no allocations, got %v", n)
+	}
+}
+
 func TestInvalidUUIDCharacter(t *testing.T) {
 	_, err := ParseUUID("z4f00409-cef8-4822-802c-deb20704c365")
 	if err == nil || !strings.Contains(err.Error(), "invalid UUID") {
@@ -308,3 +360,92 @@ func TestMaxTimeUUID(t *testing.T) {
 		t.Errorf("nodes are not equal:  expected %08b, got %08b", maxNode, nodeFromUUID)
 	}
 }
+
+func BenchmarkParseUUID(b *testing.B) {
+	input := MustRandomUUID().String()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseUUID(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseUUIDBytes(b *testing.B) {
+	input := []byte(MustRandomUUID().String())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseUUIDBytes(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUUIDString(b *testing.B) {
+	u := MustRandomUUID()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = u.String()
+	}
+}
+
+func BenchmarkUUIDAppendText(b *testing.B) {
+	u := MustRandomUUID()
+	buf := make([]byte, 0, 36)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = u.AppendText(buf[:0])
+	}
+}
+
+func TestTimeUUIDGenerator(t *testing.T) {
+	node := TimeUUIDNodeFromName("pod-1")
+	if len(node) != 6 || node[0]&0x01 == 0 {
+		t.Fatalf("expected 6 byte node with multicast bit set, got %x", node)
+	}
+	if other := TimeUUIDNodeFromName("pod-1"); !bytes.Equal(node, other) {
+		t.Fatalf("expected node to be stable, got %x and %x", node, other)
+	}
+
+	g := NewTimeUUIDGenerator(node, 0xFFFF)
+	if g.ClockSeq() != 0x3FFF {
+		t.Fatalf("expected clock sequence to be truncated to 14 bits, got %x", g.ClockSeq())
+	}
+
+	now := time.Date(2016, 12, 31, 23, 59, 59, 0, time.UTC)
+	g.now = func() time.Time { return now }
+
+	seen := make(map[UUID]bool)
+	var last int64
+	for i := 0; i < 100; i++ {
+		// the clock stalls and then goes backwards, as with a leap second
+		if i == 50 {
+			now = now.Add(-time.Second)
+		}
+		u := g.Next()
+		if seen[u] {
+			t.Fatalf("duplicate UUID %v", u)
+		}
+		seen[u] = true
+
+		if u.Version() != 1 {
+			t.Fatalf("expected version 1, got %d", u.Version())
+		}
+		if !bytes.Equal(u.Node(), node) {
+			t.Fatalf("expected node %x, got %x", node, u.Node())
+		}
+		if u.Clock() != 0x3FFF {
+			t.Fatalf("expected clock sequence %x, got %x", 0x3FFF, u.Clock())
+		}
+		if u.Timestamp() <= last {
+			t.Fatalf("timestamps must strictly grow: last=%v ts=%v", last, u.Timestamp())
+		}
+		last = u.Timestamp()
+	}
+
+	SetTimeUUIDGenerator(g)
+	defer SetTimeUUIDGenerator(nil)
+	if u := TimeUUID(); u.Timestamp() <= last || !bytes.Equal(u.Node(), node) {
+		t.Fatalf("expected TimeUUID to use the installed generator, got %v", u)
+	}
+}
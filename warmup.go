@@ -0,0 +1,113 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// WarmUpError is returned by Session.WarmUp when statements could not be
+// prepared or their routing information could not be fetched.
+type WarmUpError struct {
+	// Errors maps the statements which failed to their first error.
+	Errors map[string]error
+}
+
+func (e *WarmUpError) Error() string {
+	stmts := make([]string, 0, len(e.Errors))
+	for stmt := range e.Errors {
+		stmts = append(stmts, stmt)
+	}
+	sort.Strings(stmts)
+	return fmt.Sprintf("gocql: unable to warm up %d statements, %q: %v", len(stmts), stmts[0], e.Errors[stmts[0]])
+}
+
+// WarmUp prepares the given statements on all the hosts the session is
+// connected to, and fetches the metadata their queries are routed with, so
+// that the first queries executing them do not wait for it. It is meant to be
+// called with the hot statements of an application once the session is
+// created, for example from a readiness check after a deploy.
+//
+// The statements are prepared in the keyspace of the session, like the
+// queries which do not set their keyspace. WarmUp returns nil if all the
+// statements were warmed up on all the hosts, ErrNoConnections if no host is
+// connected, or a *WarmUpError otherwise.
+func (s *Session) WarmUp(ctx context.Context, stmts ...string) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[string]error)
+	)
+	fail := func(stmt string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := errs[stmt]; !ok {
+			errs[stmt] = err
+		}
+	}
+
+	hosts := 0
+	for _, host := range s.ring.allHosts() {
+		if !host.IsUp() {
+			continue
+		}
+		pool, ok := s.pool.getPool(host)
+		if !ok {
+			continue
+		}
+		conn := pool.Pick()
+		if conn == nil {
+			continue
+		}
+
+		hosts++
+		wg.Add(1)
+		go func(host *HostInfo, conn *Conn) {
+			defer wg.Done()
+			for _, stmt := range stmts {
+				if _, err := conn.prepareStatement(ctx, stmt, nil); err != nil {
+					fail(stmt, fmt.Errorf("host %s: %w", host.ConnectAddressAndPort(), err))
+				}
+			}
+		}(host, conn)
+	}
+
+	if hosts == 0 {
+		return ErrNoConnections
+	}
+
+	for _, stmt := range stmts {
+		wg.Add(1)
+		go func(stmt string) {
+			defer wg.Done()
+			if _, err := s.routingKeyInfo(ctx, stmt); err != nil {
+				fail(stmt, err)
+			}
+		}(stmt)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &WarmUpError{Errors: errs}
+}
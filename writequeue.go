@@ -0,0 +1,346 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrWriteQueueFull is returned by WriteQueue.Exec when a write could not be
+// executed and the queue has no room left to buffer it.
+var ErrWriteQueueFull = errors.New("gocql: write queue is full")
+
+// QueuedWrite is a write buffered by a WriteQueue.
+type QueuedWrite struct {
+	Stmt        string
+	Values      []interface{}
+	Consistency Consistency
+	// Timestamp is the write timestamp, in microseconds, the write is
+	// replayed with, so that it does not overwrite the writes which
+	// happened after it was buffered.
+	Timestamp int64
+	// Queued is when the write was buffered.
+	Queued time.Time
+}
+
+// WriteQueueStorage stores the writes buffered by a WriteQueue, in order.
+// Storages persisting the writes, so that they survive a restart of the
+// application, are responsible for serializing the values of the writes.
+//
+// The methods are not called concurrently.
+type WriteQueueStorage interface {
+	// Push appends w to the tail of the queue.
+	Push(w QueuedWrite) error
+	// Peek returns the write at the head of the queue, if any.
+	Peek() (w QueuedWrite, ok bool, err error)
+	// Pop removes the write at the head of the queue.
+	Pop() error
+	// Len returns the number of writes in the queue.
+	Len() int
+}
+
+// WriteQueueConfig configures a WriteQueue.
+type WriteQueueConfig struct {
+	// Storage stores the buffered writes, in memory if nil.
+	Storage WriteQueueStorage
+
+	// MaxWrites is the maximum number of buffered writes, unlimited if 0.
+	MaxWrites int
+
+	// MaxAge is how long a write is buffered at most, the writes older
+	// than MaxAge are dropped instead of replayed. Unlimited if 0.
+	MaxAge time.Duration
+
+	// ReplayInterval is how often the replay of the buffered writes is
+	// attempted, 1 second if 0.
+	ReplayInterval time.Duration
+}
+
+// WriteQueueMetrics are the counters of a WriteQueue.
+type WriteQueueMetrics struct {
+	// Queued is the number of writes buffered.
+	Queued uint64
+	// Replayed is the number of buffered writes replayed successfully.
+	Replayed uint64
+	// Failed is the number of buffered writes dropped because their replay
+	// failed for another reason than the cluster being unreachable.
+	Failed uint64
+	// DroppedFull is the number of writes rejected with ErrWriteQueueFull.
+	DroppedFull uint64
+	// DroppedAge is the number of buffered writes dropped because they were
+	// older than MaxAge.
+	DroppedAge uint64
+	// Len is the number of writes currently buffered.
+	Len int
+}
+
+// WriteQueue executes idempotent writes, buffering them when the cluster is
+// unreachable and replaying them in order once it is reachable again. It lets
+// applications tolerate short outages of the cluster, or of the network to
+// it, at the cost of the writes being applied late.
+//
+// The writes of a goroutine are executed in order: while writes are buffered,
+// the new writes are buffered after them rather than executed. The writes
+// executed concurrently by several goroutines are not ordered with each other,
+// as a write executed while another one fails may be applied before the other
+// one is buffered.
+type WriteQueue struct {
+	session *Session
+	cfg     WriteQueueConfig
+	// execQuery executes the writes which are not buffered and exec replays
+	// the buffered ones, they are replaced in tests.
+	execQuery func(qry *Query) error
+	exec      func(w QueuedWrite) error
+
+	mu sync.Mutex
+
+	queued      uint64
+	replayed    uint64
+	failed      uint64
+	droppedFull uint64
+	droppedAge  uint64
+
+	quit      chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewWriteQueue returns a WriteQueue executing the writes with s, and starts
+// the replay of the writes already in cfg.Storage, if any. Close must be
+// called to stop the replay.
+func NewWriteQueue(s *Session, cfg WriteQueueConfig) *WriteQueue {
+	q := newWriteQueue(cfg, func(w QueuedWrite) error {
+		return s.Query(w.Stmt, w.Values...).
+			Consistency(w.Consistency).
+			WithTimestamp(w.Timestamp).
+			Idempotent(true).
+			Exec()
+	})
+	q.session = s
+	go q.replayLoop()
+	return q
+}
+
+func newWriteQueue(cfg WriteQueueConfig, exec func(w QueuedWrite) error) *WriteQueue {
+	if cfg.Storage == nil {
+		cfg.Storage = &memoryWriteQueueStorage{}
+	}
+	if cfg.ReplayInterval <= 0 {
+		cfg.ReplayInterval = time.Second
+	}
+	return &WriteQueue{
+		cfg:       cfg,
+		execQuery: (*Query).Exec,
+		exec:      exec,
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Exec executes the write qry, or buffers it if the cluster is unreachable or
+// writes are already buffered. The writes which are not idempotent are never
+// buffered, their errors are returned as is.
+//
+// The statement, values, consistency and timestamp of the buffered writes are
+// replayed, the other options of qry are not. The timestamp of qry is set to
+// the current time if it has none, so that the replay does not overwrite the
+// writes which happened after qry.
+func (q *WriteQueue) Exec(qry *Query) error {
+	if !qry.IsIdempotent() {
+		return q.execQuery(qry)
+	}
+
+	w := QueuedWrite{
+		Stmt:        qry.stmt,
+		Values:      qry.values,
+		Consistency: qry.cons,
+		Timestamp:   qry.defaultTimestampValue,
+	}
+	if w.Timestamp == 0 {
+		w.Timestamp = time.Now().UnixNano() / 1000
+		qry.WithTimestamp(w.Timestamp)
+	}
+
+	// the writes are buffered after the buffered ones, deciding so under the
+	// lock so that the replay does not empty the queue in between.
+	q.mu.Lock()
+	if q.cfg.Storage.Len() > 0 {
+		defer q.mu.Unlock()
+		return q.pushLocked(w)
+	}
+	q.mu.Unlock()
+
+	err := q.execQuery(qry)
+	if err == nil || !isUnreachableErr(err) {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pushLocked(w)
+}
+
+// pushLocked buffers w, it must be called with q.mu held.
+func (q *WriteQueue) pushLocked(w QueuedWrite) error {
+	if q.cfg.MaxWrites > 0 && q.cfg.Storage.Len() >= q.cfg.MaxWrites {
+		atomic.AddUint64(&q.droppedFull, 1)
+		return ErrWriteQueueFull
+	}
+	w.Queued = time.Now()
+	if err := q.cfg.Storage.Push(w); err != nil {
+		return err
+	}
+	atomic.AddUint64(&q.queued, 1)
+	return nil
+}
+
+// Metrics returns the counters of the queue.
+func (q *WriteQueue) Metrics() WriteQueueMetrics {
+	q.mu.Lock()
+	n := q.cfg.Storage.Len()
+	q.mu.Unlock()
+
+	return WriteQueueMetrics{
+		Queued:      atomic.LoadUint64(&q.queued),
+		Replayed:    atomic.LoadUint64(&q.replayed),
+		Failed:      atomic.LoadUint64(&q.failed),
+		DroppedFull: atomic.LoadUint64(&q.droppedFull),
+		DroppedAge:  atomic.LoadUint64(&q.droppedAge),
+		Len:         n,
+	}
+}
+
+// Close stops the replay of the buffered writes. The writes which are still
+// buffered are kept in the storage.
+func (q *WriteQueue) Close() {
+	q.closeOnce.Do(func() {
+		close(q.quit)
+	})
+	<-q.done
+}
+
+func (q *WriteQueue) replayLoop() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.cfg.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.replay()
+		case <-q.quit:
+			return
+		}
+	}
+}
+
+// replay replays the buffered writes in order, until the queue is empty or
+// the cluster is unreachable.
+func (q *WriteQueue) replay() {
+	for {
+		select {
+		case <-q.quit:
+			return
+		default:
+		}
+
+		q.mu.Lock()
+		w, ok, err := q.cfg.Storage.Peek()
+		q.mu.Unlock()
+		if err != nil {
+			q.logf("gocql: unable to read write queue: %v\n", err)
+			return
+		} else if !ok {
+			return
+		}
+
+		if q.cfg.MaxAge > 0 && time.Since(w.Queued) > q.cfg.MaxAge {
+			atomic.AddUint64(&q.droppedAge, 1)
+		} else if err := q.exec(w); err != nil {
+			if isUnreachableErr(err) {
+				return
+			}
+			q.logf("gocql: dropping queued write %q: %v\n", w.Stmt, err)
+			atomic.AddUint64(&q.failed, 1)
+		} else {
+			atomic.AddUint64(&q.replayed, 1)
+		}
+
+		q.mu.Lock()
+		err = q.cfg.Storage.Pop()
+		q.mu.Unlock()
+		if err != nil {
+			q.logf("gocql: unable to remove write from write queue: %v\n", err)
+			return
+		}
+	}
+}
+
+func (q *WriteQueue) logf(format string, v ...interface{}) {
+	if q.session != nil {
+		q.session.logger.Printf(format, v...)
+	}
+}
+
+// isUnreachableErr returns whether err means the cluster could not be reached,
+// rather than the write was rejected.
+func isUnreachableErr(err error) bool {
+	for _, target := range []error{ErrNoConnections, ErrConnectionClosed, ErrTimeoutNoResponse, ErrNoStreams, ErrHostOverloaded} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// memoryWriteQueueStorage is the default WriteQueueStorage, keeping the
+// writes in memory.
+type memoryWriteQueueStorage struct {
+	writes []QueuedWrite
+}
+
+func (s *memoryWriteQueueStorage) Push(w QueuedWrite) error {
+	s.writes = append(s.writes, w)
+	return nil
+}
+
+func (s *memoryWriteQueueStorage) Peek() (QueuedWrite, bool, error) {
+	if len(s.writes) == 0 {
+		return QueuedWrite{}, false, nil
+	}
+	return s.writes[0], true, nil
+}
+
+func (s *memoryWriteQueueStorage) Pop() error {
+	if len(s.writes) > 0 {
+		s.writes[0] = QueuedWrite{}
+		s.writes = s.writes[1:]
+	}
+	return nil
+}
+
+func (s *memoryWriteQueueStorage) Len() int {
+	return len(s.writes)
+}
@@ -0,0 +1,179 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gocql
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeCluster records the writes executed by a WriteQueue.
+type fakeCluster struct {
+	down    bool
+	reject  string
+	applied []string
+}
+
+func (c *fakeCluster) execQuery(qry *Query) error {
+	return c.exec(QueuedWrite{Stmt: qry.stmt})
+}
+
+func (c *fakeCluster) exec(w QueuedWrite) error {
+	if c.down {
+		return ErrNoConnections
+	} else if w.Stmt == c.reject {
+		return errors.New("rejected")
+	}
+	c.applied = append(c.applied, w.Stmt)
+	return nil
+}
+
+func newTestWriteQueue(cfg WriteQueueConfig) (*WriteQueue, *fakeCluster) {
+	cluster := &fakeCluster{}
+	q := newWriteQueue(cfg, cluster.exec)
+	q.execQuery = cluster.execQuery
+	return q, cluster
+}
+
+func idempotentWrite(stmt string) *Query {
+	return &Query{stmt: stmt, idempotent: true}
+}
+
+func TestWriteQueue(t *testing.T) {
+	q, cluster := newTestWriteQueue(WriteQueueConfig{})
+
+	if err := q.Exec(idempotentWrite("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster.down = true
+	for _, stmt := range []string{"b", "c"} {
+		if err := q.Exec(idempotentWrite(stmt)); err != nil {
+			t.Fatalf("expected %s to be buffered, got %v", stmt, err)
+		}
+	}
+	if err := q.Exec(&Query{stmt: "not idempotent"}); err != ErrNoConnections {
+		t.Fatalf("expected the non idempotent write to fail with %v, got %v", ErrNoConnections, err)
+	}
+
+	// the writes stay buffered while the cluster is unreachable
+	q.replay()
+	if n := q.Metrics().Len; n != 2 {
+		t.Fatalf("expected 2 buffered writes, got %d", n)
+	}
+
+	// the new writes are buffered after the others to keep the order
+	cluster.down = false
+	cluster.reject = "e"
+	for _, stmt := range []string{"d", "e"} {
+		if err := q.Exec(idempotentWrite(stmt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q.replay()
+	if expected := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(cluster.applied, expected) {
+		t.Fatalf("expected the writes %v to be applied, got %v", expected, cluster.applied)
+	}
+
+	expected := WriteQueueMetrics{Queued: 4, Replayed: 3, Failed: 1}
+	if metrics := q.Metrics(); metrics != expected {
+		t.Fatalf("expected metrics %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestWriteQueueLimits(t *testing.T) {
+	q, cluster := newTestWriteQueue(WriteQueueConfig{MaxWrites: 2, MaxAge: time.Minute})
+
+	cluster.down = true
+	for _, stmt := range []string{"a", "b"} {
+		if err := q.Exec(idempotentWrite(stmt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Exec(idempotentWrite("c")); err != ErrWriteQueueFull {
+		t.Fatalf("expected %v, got %v", ErrWriteQueueFull, err)
+	}
+
+	// age the first write
+	storage := q.cfg.Storage.(*memoryWriteQueueStorage)
+	storage.writes[0].Queued = time.Now().Add(-2 * time.Minute)
+
+	cluster.down = false
+	q.replay()
+	if expected := []string{"b"}; !reflect.DeepEqual(cluster.applied, expected) {
+		t.Fatalf("expected the writes %v to be applied, got %v", expected, cluster.applied)
+	}
+
+	expected := WriteQueueMetrics{Queued: 2, Replayed: 1, DroppedFull: 1, DroppedAge: 1}
+	if metrics := q.Metrics(); metrics != expected {
+		t.Fatalf("expected metrics %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestWriteQueueTimestamp(t *testing.T) {
+	q, cluster := newTestWriteQueue(WriteQueueConfig{})
+	cluster.down = true
+
+	qry := idempotentWrite("a")
+	if err := q.Exec(qry); err != nil {
+		t.Fatal(err)
+	}
+	if qry.defaultTimestampValue == 0 {
+		t.Fatal("expected the write to be given a timestamp")
+	}
+
+	w, ok, err := q.cfg.Storage.Peek()
+	if err != nil || !ok {
+		t.Fatalf("expected a buffered write, got %v, %v", ok, err)
+	}
+	if w.Timestamp != qry.defaultTimestampValue {
+		t.Errorf("expected the buffered write to have timestamp %d, got %d", qry.defaultTimestampValue, w.Timestamp)
+	}
+
+	if err := q.Exec(idempotentWrite("b").WithTimestamp(42)); err != nil {
+		t.Fatal(err)
+	}
+	q.cfg.Storage.Pop()
+	if w, _, _ := q.cfg.Storage.Peek(); w.Timestamp != 42 {
+		t.Errorf("expected the buffered write to keep its timestamp 42, got %d", w.Timestamp)
+	}
+}
+
+func TestIsUnreachableErr(t *testing.T) {
+	tests := []struct {
+		err         error
+		unreachable bool
+	}{
+		{ErrNoConnections, true},
+		{fmt.Errorf("exec: %w", ErrConnectionClosed), true},
+		{fmt.Errorf("dial: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), true},
+		{errors.New("rejected"), false},
+		{&RequestErrWriteTimeout{}, false},
+	}
+	for _, test := range tests {
+		if got := isUnreachableErr(test.err); got != test.unreachable {
+			t.Errorf("expected isUnreachableErr(%v) to be %v, got %v", test.err, test.unreachable, got)
+		}
+	}
+}
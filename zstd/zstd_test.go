@@ -0,0 +1,43 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZstdCompressor(t *testing.T) {
+	c, err := NewZstdCompressor()
+	require.NoError(t, err)
+	require.Equal(t, "zstd", c.Name())
+
+	_, err = c.Decode([]byte{0, 1, 2})
+	require.Error(t, err)
+
+	original := bytes.Repeat([]byte("My Test String"), 10)
+	encoded, err := c.Encode(original)
+	require.NoError(t, err)
+	require.Less(t, len(encoded), len(original))
+	decoded, err := c.Decode(encoded)
+	require.NoError(t, err)
+	require.Equal(t, original, decoded)
+}